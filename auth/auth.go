@@ -96,6 +96,19 @@ func FromEnvironment() (Provider, error) {
 		return nil, fmt.Errorf("length of 'SNELLER_INDEX_KEY' is %d, has to be %d", len(indexKey), blockfmt.KeyLength)
 	}
 
+	// the master key is optional;
+	// objects are only encrypted if it is set
+	var masterKey []byte
+	if text := os.Getenv("SNELLER_MASTER_KEY"); text != "" {
+		masterKey, err = base64.StdEncoding.DecodeString(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'SNELLER_MASTER_KEY': %s", err)
+		}
+		if len(masterKey) != blockfmt.MasterKeyLength {
+			return nil, fmt.Errorf("length of 'SNELLER_MASTER_KEY' is %d, has to be %d", len(masterKey), blockfmt.MasterKeyLength)
+		}
+	}
+
 	creds := S3Static{
 		CheckToken: func(t string) error {
 			if t != token {
@@ -107,6 +120,7 @@ func FromEnvironment() (Provider, error) {
 			ID:          "default",
 			Region:      region,
 			IndexKey:    indexKey,
+			MasterKey:   masterKey,
 			Credentials: S3BearerCredentials{},
 		},
 	}
@@ -25,6 +25,7 @@ import (
 
 	"github.com/SnellerInc/sneller/aws"
 	"github.com/SnellerInc/sneller/aws/s3"
+	"github.com/SnellerInc/sneller/cgroup"
 	"github.com/SnellerInc/sneller/db"
 	"github.com/SnellerInc/sneller/ion/blockfmt"
 )
@@ -46,16 +47,45 @@ type S3Bearer struct {
 // should be returned from the HTTP server implementing
 // the S3Bearer API.
 type S3BearerIdentity struct {
-	ID       string `json:"TenantID"`
+	ID string `json:"TenantID"`
+	// Subject, if present, is the principal
+	// (a user or a service) to which the token
+	// was issued. It is recorded in the query
+	// audit log. See db.SubjectTenant.
+	Subject  string `json:"Subject,omitempty"`
 	Region   string `json:"Region"`
 	IndexKey []byte `json:"IndexKey,omitempty"`
-	Bucket   string `json:"SnellerBucket"`
+	// MasterKey, if present, is the key used to
+	// wrap the data keys of encrypted objects.
+	// New objects are encrypted if MasterKey is set.
+	// See db.EncryptedTenant.
+	MasterKey []byte `json:"MasterKey,omitempty"`
+	Bucket    string `json:"SnellerBucket"`
 	// Credentials is a JSON-compatible
 	// representation of the AWS SDK "Credentials" structure
 	Credentials S3BearerCredentials `json:"Credentials"`
 	// MaxScanBytes is the maximum number of bytes
 	// allowed to be scanned on any query.
 	MaxScanBytes uint64 `json:"MaxScanBytes"`
+	// QueryTimeout, if non-zero, is the maximum
+	// number of seconds that any query may run.
+	// See db.TenantConfig.QueryTimeout.
+	QueryTimeout int `json:"QueryTimeout,omitempty"`
+	// Grants, if present, is the list of
+	// tables the tenant may query along with
+	// the column masks and row filters
+	// that apply to them.
+	// See db.TenantConfig.Grants.
+	Grants []db.Grant `json:"Grants,omitempty"`
+	// MaxConcurrency, if non-zero, is the
+	// maximum number of concurrent queries.
+	// See db.TenantConfig.MaxConcurrency.
+	MaxConcurrency int `json:"MaxConcurrency,omitempty"`
+	// Limits, if present, is the set of
+	// resource limits for the tenant's
+	// query process.
+	// See db.TenantConfig.Limits.
+	Limits *cgroup.Limits `json:"Limits,omitempty"`
 }
 
 type S3BearerCredentials struct {
@@ -93,6 +123,14 @@ func (s *S3BearerIdentity) Tenant(ctx context.Context) (db.Tenant, error) {
 	if copy(k[:], s.IndexKey) != len(k[:]) {
 		return nil, fmt.Errorf("invalid len(IndexKey)=%d", len(s.IndexKey))
 	}
+	var mk *blockfmt.MasterKey
+	if s.MasterKey != nil {
+		if len(s.MasterKey) != blockfmt.MasterKeyLength {
+			return nil, fmt.Errorf("invalid len(MasterKey)=%d", len(s.MasterKey))
+		}
+		mk = new(blockfmt.MasterKey)
+		copy(mk[:], s.MasterKey)
+	}
 	c := &s.Credentials
 	if s.Expired() {
 		return nil, fmt.Errorf("credentials already expired at %s", c.Expires)
@@ -100,6 +138,24 @@ func (s *S3BearerIdentity) Tenant(ctx context.Context) (db.Tenant, error) {
 	if c.AccessKeyID == "" || c.SecretAccessKey == "" || s.Region == "" {
 		return nil, fmt.Errorf("S3BearerIdentity missing proper credentials")
 	}
+	for i := range s.Grants {
+		if _, err := s.Grants[i].RowFilter(); err != nil {
+			return nil, err
+		}
+		for j := range s.Grants[i].Masks {
+			if m := &s.Grants[i].Masks[j]; !m.Valid() {
+				return nil, fmt.Errorf("invalid mask (path %q, action %q)", m.Path, m.Action)
+			}
+		}
+	}
+	if s.MaxConcurrency < 0 {
+		return nil, fmt.Errorf("invalid MaxConcurrency %d", s.MaxConcurrency)
+	}
+	if s.Limits != nil {
+		if err := s.Limits.Validate(); err != nil {
+			return nil, err
+		}
+	}
 	root := &db.S3FS{}
 	root.Ctx = ctx
 	root.Client = &s3.DefaultClient
@@ -107,9 +163,16 @@ func (s *S3BearerIdentity) Tenant(ctx context.Context) (db.Tenant, error) {
 	root.Key = aws.DeriveKey(c.BaseURI, c.AccessKeyID, c.SecretAccessKey, s.Region, "s3")
 	root.Key.Token = c.SessionToken
 	cfg := &db.TenantConfig{
-		MaxScanBytes: s.MaxScanBytes,
+		MaxScanBytes:   s.MaxScanBytes,
+		QueryTimeout:   time.Duration(s.QueryTimeout) * time.Second,
+		Grants:         s.Grants,
+		MaxConcurrency: s.MaxConcurrency,
+		Limits:         s.Limits,
 	}
-	return S3Tenant(ctx, s.ID, root, k, cfg), nil
+	t := newS3Tenant(ctx, s.ID, root, k, cfg)
+	t.mkey = mk
+	t.subject = s.Subject
+	return t, nil
 }
 
 func (s *S3Bearer) client() *http.Client {
@@ -156,10 +219,17 @@ type s3Tenant struct {
 	id   string
 	root *db.S3FS
 	ikey *blockfmt.Key
+	mkey *blockfmt.MasterKey
 	cfg  *db.TenantConfig
+
+	subject string
 }
 
 func S3Tenant(ctx context.Context, id string, root *db.S3FS, key *blockfmt.Key, cfg *db.TenantConfig) db.Tenant {
+	return newS3Tenant(ctx, id, root, key, cfg)
+}
+
+func newS3Tenant(ctx context.Context, id string, root *db.S3FS, key *blockfmt.Key, cfg *db.TenantConfig) *s3Tenant {
 	t := &s3Tenant{
 		S3Resolver: db.S3Resolver{
 			Ctx: ctx,
@@ -181,6 +251,10 @@ func (s *s3Tenant) Key() *blockfmt.Key        { return s.ikey }
 func (s *s3Tenant) Root() (db.InputFS, error) { return s.root, nil }
 func (s *s3Tenant) Config() *db.TenantConfig  { return s.cfg }
 
+func (s *s3Tenant) MasterKey() *blockfmt.MasterKey { return s.mkey }
+
+func (s *s3Tenant) Subject() string { return s.subject }
+
 // S3Static is a Provider that is backed
 // by a single static S3 identity.
 type S3Static struct {
@@ -0,0 +1,329 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package avro implements converting Apache Avro
+// object container files to binary ION format.
+package avro
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+
+	"github.com/SnellerInc/sneller/ion"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	// ErrMagicMismatch is returned when the
+	// input is not an Avro object container file.
+	ErrMagicMismatch = errors.New("avro: not an object container file")
+	// ErrInvalidSchema is returned when the
+	// writer schema of a file cannot be parsed.
+	ErrInvalidSchema = errors.New("avro: invalid schema")
+	// ErrCorrupt is returned when the
+	// encoded data does not match the schema.
+	ErrCorrupt = errors.New("avro: corrupt data")
+)
+
+var magic = []byte{'O', 'b', 'j', 1}
+
+const syncSize = 16
+
+// maxBlockSize is the largest (compressed)
+// data block that we are willing to read
+const maxBlockSize = 1 << 30
+
+// reader reads the framing of an object container file
+type reader struct {
+	src   *bufio.Reader
+	sync  [syncSize]byte
+	codec string
+	// buffers for the current block
+	raw, block []byte
+	zstd       *zstd.Decoder
+}
+
+func (r *reader) long() (int64, error) {
+	u, err := binary.ReadUvarint(r.src)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		return 0, fmt.Errorf("%w: %s", ErrCorrupt, err)
+	}
+	return int64(u>>1) ^ -int64(u&1), nil
+}
+
+func (r *reader) full(n int64) ([]byte, error) {
+	if n < 0 || n > maxBlockSize {
+		return nil, fmt.Errorf("%w: length %d out of range", ErrCorrupt, n)
+	}
+	if int64(cap(r.raw)) < n {
+		r.raw = make([]byte, n)
+	}
+	r.raw = r.raw[:n]
+	_, err := io.ReadFull(r.src, r.raw)
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	return r.raw, nil
+}
+
+func noEOF(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: unexpected end of file", ErrCorrupt)
+	}
+	return err
+}
+
+// header reads the file header and
+// returns the writer schema
+func (r *reader) header() (*schema, error) {
+	var m [4]byte
+	if _, err := io.ReadFull(r.src, m[:]); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrMagicMismatch
+		}
+		return nil, err
+	}
+	if !bytes.Equal(m[:], magic) {
+		return nil, ErrMagicMismatch
+	}
+	var text []byte
+	r.codec = "null"
+	for {
+		n, err := r.long()
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		if n == 0 {
+			break
+		}
+		if n < 0 {
+			n = -n
+			if _, err := r.long(); err != nil {
+				return nil, noEOF(err)
+			}
+		}
+		for ; n > 0; n-- {
+			k, err := r.str()
+			if err != nil {
+				return nil, err
+			}
+			v, err := r.str()
+			if err != nil {
+				return nil, err
+			}
+			switch k {
+			case "avro.schema":
+				text = []byte(v)
+			case "avro.codec":
+				r.codec = v
+			}
+		}
+	}
+	if _, err := io.ReadFull(r.src, r.sync[:]); err != nil {
+		return nil, noEOF(err)
+	}
+	switch r.codec {
+	case "null", "deflate", "snappy":
+	case "zstandard":
+		dec, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		r.zstd = dec
+	default:
+		return nil, fmt.Errorf("avro: unsupported codec %q", r.codec)
+	}
+	if text == nil {
+		return nil, fmt.Errorf("%w: missing avro.schema", ErrInvalidSchema)
+	}
+	return parseSchema(text)
+}
+
+func (r *reader) str() (string, error) {
+	n, err := r.long()
+	if err != nil {
+		return "", noEOF(err)
+	}
+	b, err := r.full(n)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// next reads the next data block and returns
+// the number of objects in the block and the
+// decompressed block, or io.EOF at the end of the file
+func (r *reader) next() (int64, []byte, error) {
+	count, err := r.long()
+	if err != nil {
+		return 0, nil, err
+	}
+	if count < 0 {
+		return 0, nil, fmt.Errorf("%w: negative object count", ErrCorrupt)
+	}
+	size, err := r.long()
+	if err != nil {
+		return 0, nil, noEOF(err)
+	}
+	raw, err := r.full(size)
+	if err != nil {
+		return 0, nil, err
+	}
+	var sync [syncSize]byte
+	if _, err := io.ReadFull(r.src, sync[:]); err != nil {
+		return 0, nil, noEOF(err)
+	}
+	if sync != r.sync {
+		return 0, nil, fmt.Errorf("%w: sync marker mismatch", ErrCorrupt)
+	}
+	block, err := r.decompress(raw)
+	return count, block, err
+}
+
+func (r *reader) decompress(raw []byte) ([]byte, error) {
+	var err error
+	switch r.codec {
+	case "deflate":
+		fr := flate.NewReader(bytes.NewReader(raw))
+		var buf bytes.Buffer
+		buf.Grow(3 * len(raw))
+		if _, err = buf.ReadFrom(fr); err != nil {
+			return nil, err
+		}
+		r.block = buf.Bytes()
+	case "snappy":
+		// snappy blocks are followed by the
+		// big-endian CRC32 of the decompressed data
+		if len(raw) < 4 {
+			return nil, fmt.Errorf("%w: snappy block too short", ErrCorrupt)
+		}
+		body, sum := raw[:len(raw)-4], binary.BigEndian.Uint32(raw[len(raw)-4:])
+		n, err := s2.DecodedLen(body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrCorrupt, err)
+		}
+		if cap(r.block) < n {
+			r.block = make([]byte, n)
+		}
+		r.block, err = s2.Decode(r.block[:n], body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrCorrupt, err)
+		}
+		if crc32.ChecksumIEEE(r.block) != sum {
+			return nil, fmt.Errorf("%w: snappy checksum mismatch", ErrCorrupt)
+		}
+	case "zstandard":
+		r.block, err = r.zstd.DecodeAll(raw, r.block[:0])
+		if err != nil {
+			return nil, err
+		}
+	default:
+		r.block = raw
+	}
+	return r.block, nil
+}
+
+// Convert reads an Avro object container file
+// from r and writes each object into dst as a
+// structure, along with the provided constants.
+// The objects are decoded using the writer schema
+// embedded in the file, which must be a record or a map.
+//
+// The null, deflate, snappy, and zstandard codecs
+// are supported. Enums are converted to strings,
+// fixed and bytes to blobs, maps to structures,
+// and unions to the value of the selected branch.
+// The date and timestamp-millis/micros logical types
+// produce timestamps, which are added to the sparse
+// index unless they are inside arrays or maps.
+// Decimals produce integers (when the scale is zero)
+// or floating-point numbers.
+func Convert(r io.Reader, dst *ion.Chunker, cons []ion.Field) error {
+	rd := &reader{src: bufio.NewReader(r)}
+	s, err := rd.header()
+	if rd.zstd != nil {
+		defer rd.zstd.Close()
+	}
+	if err != nil {
+		return err
+	}
+	if s.kind != kindRecord && s.kind != kindMap {
+		return fmt.Errorf("%w: top-level schema must be a record or a map", ErrInvalidSchema)
+	}
+
+	// make sure constant field IDs are interned
+	prev := ion.Symbol(0)
+	for i := range cons {
+		cons[i].Sym = dst.Symbols.Intern(cons[i].Label)
+		if cons[i].Sym < prev {
+			return fmt.Errorf("avro: internal error: constant interned symbols out-of-order")
+		}
+		prev = cons[i].Sym
+	}
+	s.intern(&dst.Symbols, make(map[*schema]bool))
+
+	d := decoder{dst: &dst.Buffer, st: &dst.Symbols, ranges: &dst.Ranges}
+	if s.kind == kindMap {
+		// don't index arbitrary map keys
+		d.noindex = 1
+	}
+	for {
+		count, block, err := rd.next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if count > math.MaxInt32 {
+			return fmt.Errorf("%w: object count %d out of range", ErrCorrupt, count)
+		}
+		d.buf = block
+		for ; count > 0; count-- {
+			dst.BeginStruct(-1)
+			for i := range cons {
+				dst.BeginField(cons[i].Sym)
+				cons[i].Value.Encode(&dst.Buffer, &dst.Symbols)
+			}
+			if s.kind == kindRecord {
+				err = d.fields(s, 0)
+			} else {
+				err = d.entries(s, 0)
+			}
+			if err != nil {
+				return err
+			}
+			dst.EndStruct()
+			if err := dst.Commit(); err != nil {
+				return err
+			}
+		}
+		if len(d.buf) != 0 {
+			return fmt.Errorf("%w: %d trailing bytes in block", ErrCorrupt, len(d.buf))
+		}
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package avro
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/SnellerInc/sneller/ion"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// encoder produces Avro binary encoded data
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) long(n int64) *encoder {
+	e.buf = binary.AppendUvarint(e.buf, uint64(n<<1)^uint64(n>>63))
+	return e
+}
+
+func (e *encoder) str(s string) *encoder {
+	e.long(int64(len(s)))
+	e.buf = append(e.buf, s...)
+	return e
+}
+
+func (e *encoder) raw(b ...byte) *encoder {
+	e.buf = append(e.buf, b...)
+	return e
+}
+
+func (e *encoder) double(f float64) *encoder {
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(f))
+	return e
+}
+
+func (e *encoder) float(f float32) *encoder {
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, math.Float32bits(f))
+	return e
+}
+
+var testSync = []byte("0123456789abcdef")
+
+// ocf produces an object container file with
+// one data block per entry in blocks
+func ocf(t *testing.T, schema, codec string, counts []int, blocks [][]byte) []byte {
+	var e encoder
+	e.raw(magic...)
+	e.long(2)
+	e.str("avro.schema").str(schema)
+	e.str("avro.codec").str(codec)
+	e.long(0)
+	e.raw(testSync...)
+	for i := range blocks {
+		var data []byte
+		switch codec {
+		case "null":
+			data = blocks[i]
+		case "deflate":
+			var buf bytes.Buffer
+			w, err := flate.NewWriter(&buf, flate.BestCompression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(blocks[i])
+			w.Close()
+			data = buf.Bytes()
+		case "snappy":
+			data = snappy.Encode(nil, blocks[i])
+			data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(blocks[i]))
+		case "zstandard":
+			enc, err := zstd.NewWriter(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data = enc.EncodeAll(blocks[i], nil)
+			enc.Close()
+		}
+		e.long(int64(counts[i]))
+		e.long(int64(len(data)))
+		e.raw(data...)
+		e.raw(testSync...)
+	}
+	return e.buf
+}
+
+func convert(t *testing.T, file []byte) (string, error) {
+	var out bytes.Buffer
+	dst := ion.Chunker{
+		Align: 1024 * 1024,
+		W:     ion.NewJSONWriter(&out, '\n'),
+	}
+	err := Convert(bytes.NewReader(file), &dst, []ion.Field{{Label: "input_file", Value: ion.String("test.avro")}})
+	if err != nil {
+		return "", err
+	}
+	if err := dst.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return out.String(), nil
+}
+
+const testSchema = `{
+  "type": "record",
+  "name": "Event",
+  "namespace": "com.example",
+  "fields": [
+    {"name": "id", "type": "long"},
+    {"name": "name", "type": ["null", "string"]},
+    {"name": "ok", "type": "boolean"},
+    {"name": "kind", "type": {"type": "enum", "name": "Kind", "symbols": ["CLICK", "VIEW"]}},
+    {"name": "score", "type": "double"},
+    {"name": "ratio", "type": "float"},
+    {"name": "tags", "type": {"type": "array", "items": "string"}},
+    {"name": "attrs", "type": {"type": "map", "values": "int"}},
+    {"name": "hash", "type": {"type": "fixed", "name": "MD5", "size": 2}},
+    {"name": "ts", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "us", "type": {"type": "long", "logicalType": "timestamp-micros"}},
+    {"name": "day", "type": {"type": "int", "logicalType": "date"}},
+    {"name": "price", "type": {"type": "bytes", "logicalType": "decimal", "precision": 9, "scale": 2}},
+    {"name": "count", "type": {"type": "fixed", "name": "Count", "size": 3, "logicalType": "decimal", "precision": 6}},
+    {"name": "parent", "type": ["null", {"type": "record", "name": "Ref", "fields": [
+      {"name": "id", "type": "long"},
+      {"name": "next", "type": ["null", "Ref"]}
+    ]}]},
+    {"name": "other", "type": ["null", "com.example.MD5"]}
+  ]
+}`
+
+func testRecords() (int, []byte) {
+	var e encoder
+	// first record
+	e.long(1)
+	e.long(1).str("first")
+	e.raw(1)
+	e.long(1)
+	e.double(1.5)
+	e.float(0.25)
+	// array in two blocks, the second with a byte size
+	e.long(1).str("a").long(-1).long(2).str("b").long(0)
+	e.long(2).str("x").long(-1).str("y").long(100).long(0)
+	e.raw(0xab, 0xcd)
+	e.long(1136214245000)
+	e.long(1136214245123456)
+	e.long(13150)
+	e.long(2).raw(0xfe, 0x0c) // -500 -> -5.00
+	e.raw(0x01, 0x00, 0x00)   // 65536
+	e.long(1).long(10).long(1).long(11).long(0)
+	e.long(1).raw(0x01, 0x02)
+
+	// second record
+	e.long(2)
+	e.long(0)
+	e.raw(0)
+	e.long(0)
+	e.double(-2)
+	e.float(1)
+	e.long(0)
+	e.long(0)
+	e.raw(0x00, 0x01)
+	e.long(0)
+	e.long(0)
+	e.long(0)
+	e.long(1).raw(0x2a) // 42 -> 0.42
+	e.raw(0xff, 0xff, 0xff)
+	e.long(0)
+	e.long(0)
+	return 2, e.buf
+}
+
+const testOutput = `{"name": "first", "input_file": "test.avro", "id": 1, "ok": true, "kind": "VIEW", "score": 1.5, "ratio": 0.25, "tags": ["a", "b"], "attrs": {"x": -1, "y": 100}, "hash": "q80=", "ts": "2006-01-02T15:04:05Z", "us": "2006-01-02T15:04:05.123456Z", "day": "2006-01-02T00:00:00Z", "price": -5, "count": 65536, "parent": {"id": 10, "next": {"id": 11, "next": null}}, "other": "AQI="}
+{"name": null, "input_file": "test.avro", "id": 2, "ok": false, "kind": "CLICK", "score": -2, "ratio": 1, "tags": [], "attrs": {}, "hash": "AAE=", "ts": "1970-01-01T00:00:00Z", "us": "1970-01-01T00:00:00Z", "day": "1970-01-01T00:00:00Z", "price": 0.42, "count": -1, "parent": null, "other": null}
+`
+
+func TestConvert(t *testing.T) {
+	n, data := testRecords()
+	for _, codec := range []string{"null", "deflate", "snappy", "zstandard"} {
+		t.Run(codec, func(t *testing.T) {
+			// one block with both records,
+			// then both records split into blocks
+			counts := []int{n, 0}
+			blocks := [][]byte{data, nil}
+			want := testOutput
+			file := ocf(t, testSchema, codec, counts, blocks)
+			got, err := convert(t, file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+			counts = []int{n, n}
+			blocks = [][]byte{data, data}
+			file = ocf(t, testSchema, codec, counts, blocks)
+			got, err = convert(t, file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want+want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want+want)
+			}
+		})
+	}
+}
+
+func TestConvertMap(t *testing.T) {
+	var e encoder
+	e.long(2).str("b").str("x").str("a").str("y").long(0)
+	file := ocf(t, `{"type": "map", "values": "string"}`, "null", []int{1}, [][]byte{e.buf})
+	got, err := convert(t, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"input_file": "test.avro", "b": "x", "a": "y"}` + "\n"
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	n, data := testRecords()
+	good := ocf(t, testSchema, "null", []int{n}, [][]byte{data})
+	// truncate the second record
+	short := ocf(t, testSchema, "null", []int{n}, [][]byte{data[:len(data)-4]})
+	// union index out of range
+	var e encoder
+	e.long(2) // only two branches
+	badUnion := ocf(t, `{"type": "record", "name": "r", "fields": [{"name": "x", "type": ["null", "int"]}]}`,
+		"null", []int{1}, [][]byte{e.buf})
+
+	runs := []struct {
+		name string
+		file []byte
+		want error
+	}{
+		{"not avro", []byte("{\"json\": true}"), ErrMagicMismatch},
+		{"empty", nil, ErrMagicMismatch},
+		{"truncated", good[:len(good)-20], ErrCorrupt},
+		{"sync", append(good[:len(good)-1:len(good)-1], 'x'), ErrCorrupt},
+		{"short block", short, ErrCorrupt},
+		{"union", badUnion, ErrCorrupt},
+		{"schema", ocf(t, `{"type": "record", "name": "r", "fields": [{"name": "x", "type": "Unknown"}]}`, "null", nil, nil), ErrInvalidSchema},
+		{"top-level", ocf(t, `"string"`, "null", nil, nil), ErrInvalidSchema},
+	}
+	for i := range runs {
+		_, err := convert(t, runs[i].file)
+		if !errors.Is(err, runs[i].want) {
+			t.Errorf("%s: got error %v, want %v", runs[i].name, err, runs[i].want)
+		}
+	}
+	_, err := convert(t, ocf(t, testSchema, "bzip2", nil, nil))
+	if err == nil || !strings.Contains(err.Error(), "unsupported codec") {
+		t.Errorf("bzip2: unexpected error %v", err)
+	}
+}
@@ -0,0 +1,324 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package avro
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/SnellerInc/sneller/date"
+	"github.com/SnellerInc/sneller/ion"
+)
+
+// maxDepth is the maximum nesting depth of
+// values, which bounds the recursion through
+// recursive schemas
+const maxDepth = 512
+
+// maxIndexingDepth is the maximum depth of
+// record fields for which timestamp ranges
+// are recorded (see jsonrl.MaxIndexingDepth)
+const maxIndexingDepth = 3
+
+// decoder decodes Avro binary encoded values
+type decoder struct {
+	buf []byte
+	dst *ion.Buffer
+	st  *ion.Symtab
+
+	// ranges, if non-nil, receives the timestamps
+	// of record fields that are not inside lists or maps
+	ranges  *ion.Ranges
+	path    []ion.Symbol
+	noindex int
+	symbuf  ion.Symbuf
+}
+
+func (d *decoder) corrupt(f string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrCorrupt, fmt.Sprintf(f, args...))
+}
+
+// long decodes a zig-zag encoded variable-length integer
+// (ints and longs have the same encoding)
+func (d *decoder) long() (int64, error) {
+	u, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		return 0, d.corrupt("invalid varint")
+	}
+	d.buf = d.buf[n:]
+	return int64(u>>1) ^ -int64(u&1), nil
+}
+
+func (d *decoder) take(n int) ([]byte, error) {
+	if n < 0 || n > len(d.buf) {
+		return nil, d.corrupt("length %d out of range", n)
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b, nil
+}
+
+// bytes decodes a length-prefixed byte sequence
+func (d *decoder) bytes() ([]byte, error) {
+	n, err := d.long()
+	if err != nil {
+		return nil, err
+	}
+	if n > math.MaxInt32 {
+		return nil, d.corrupt("length %d out of range", n)
+	}
+	return d.take(int(n))
+}
+
+// blockCount decodes the item count of
+// an array or map block
+func (d *decoder) blockCount() (int64, error) {
+	n, err := d.long()
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		// a negative count is followed
+		// by the size of the block in bytes
+		n = -n
+		if _, err := d.long(); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// value decodes a value of type s into d.dst
+func (d *decoder) value(s *schema, depth int) error {
+	if depth > maxDepth {
+		return d.corrupt("values nested too deeply")
+	}
+	switch s.kind {
+	case kindNull:
+		d.dst.WriteNull()
+	case kindBoolean:
+		b, err := d.take(1)
+		if err != nil {
+			return err
+		}
+		d.dst.WriteBool(b[0] != 0)
+	case kindInt, kindLong:
+		n, err := d.long()
+		if err != nil {
+			return err
+		}
+		switch s.logical {
+		case logicalDate:
+			d.time(date.Unix(n*86400, 0))
+		case logicalTimestampMillis:
+			d.time(date.UnixMicro(n * 1000))
+		case logicalTimestampMicros:
+			d.time(date.UnixMicro(n))
+		default:
+			d.dst.WriteInt(n)
+		}
+	case kindFloat:
+		b, err := d.take(4)
+		if err != nil {
+			return err
+		}
+		d.dst.WriteFloat64(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))))
+	case kindDouble:
+		b, err := d.take(8)
+		if err != nil {
+			return err
+		}
+		d.dst.WriteFloat64(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+	case kindBytes, kindFixed:
+		var b []byte
+		var err error
+		if s.kind == kindFixed {
+			b, err = d.take(s.size)
+		} else {
+			b, err = d.bytes()
+		}
+		if err != nil {
+			return err
+		}
+		if s.logical == logicalDecimal {
+			d.decimal(b, s.scale)
+		} else {
+			d.dst.WriteBlob(b)
+		}
+	case kindString:
+		b, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		d.dst.WriteStringBytes(b)
+	case kindRecord:
+		d.dst.BeginStruct(-1)
+		if err := d.fields(s, depth); err != nil {
+			return err
+		}
+		d.dst.EndStruct()
+	case kindEnum:
+		n, err := d.long()
+		if err != nil {
+			return err
+		}
+		if n < 0 || n >= int64(len(s.symbols)) {
+			return d.corrupt("enum %q: index %d out of range", s.name, n)
+		}
+		d.dst.WriteString(s.symbols[n])
+	case kindArray:
+		d.noindex++
+		defer func() { d.noindex-- }()
+		d.dst.BeginList(-1)
+		for {
+			n, err := d.blockCount()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				break
+			}
+			for ; n > 0; n-- {
+				if err := d.value(s.items, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+		d.dst.EndList()
+	case kindMap:
+		d.noindex++
+		defer func() { d.noindex-- }()
+		d.dst.BeginStruct(-1)
+		if err := d.entries(s, depth); err != nil {
+			return err
+		}
+		d.dst.EndStruct()
+	case kindUnion:
+		n, err := d.long()
+		if err != nil {
+			return err
+		}
+		if n < 0 || n >= int64(len(s.types)) {
+			return d.corrupt("union index %d out of range", n)
+		}
+		return d.value(s.types[n], depth+1)
+	default:
+		return d.corrupt("unexpected type %d", s.kind)
+	}
+	return nil
+}
+
+// fields decodes the fields of the record s
+// into the current structure
+func (d *decoder) fields(s *schema, depth int) error {
+	for i := range s.fields {
+		d.dst.BeginField(s.fields[i].sym)
+		d.path = append(d.path, s.fields[i].sym)
+		err := d.value(s.fields[i].typ, depth+1)
+		d.path = d.path[:len(d.path)-1]
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// time writes a timestamp and records
+// it in the ranges for its path
+func (d *decoder) time(t date.Time) {
+	d.dst.WriteTime(t)
+	if d.ranges == nil || d.noindex > 0 || len(d.path) > maxIndexingDepth {
+		return
+	}
+	d.symbuf.Prepare(len(d.path))
+	for i := range d.path {
+		d.symbuf.Push(d.path[i])
+	}
+	d.ranges.AddTime(d.symbuf, t)
+}
+
+// entries decodes the entries of the map s
+// into the current structure
+func (d *decoder) entries(s *schema, depth int) error {
+	for {
+		n, err := d.blockCount()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		for ; n > 0; n-- {
+			key, err := d.bytes()
+			if err != nil {
+				return err
+			}
+			d.dst.BeginField(d.st.Intern(string(key)))
+			if err := d.value(s.items, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// decimal writes a two's-complement big-endian
+// unscaled integer with the given scale; values with
+// a scale of zero that fit into 64 bits are written
+// as integers, and everything else as a float
+func (d *decoder) decimal(b []byte, scale int) {
+	if len(b) <= 8 {
+		var v int64
+		for i := range b {
+			v = v<<8 | int64(b[i])
+		}
+		if len(b) > 0 && len(b) < 8 {
+			// sign-extend
+			shift := 64 - 8*len(b)
+			v = v << shift >> shift
+		}
+		if scale == 0 {
+			d.dst.WriteInt(v)
+			return
+		}
+		if scale < len(pow10) && v > -(1<<53) && v < 1<<53 {
+			d.dst.WriteFloat64(float64(v) / pow10[scale])
+			return
+		}
+	}
+	x := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		// subtract 2^(8*len(b)) for negative values
+		x.Sub(x, new(big.Int).Lsh(big.NewInt(1), uint(8*len(b))))
+	}
+	if scale == 0 && x.IsInt64() {
+		d.dst.WriteInt(x.Int64())
+		return
+	}
+	f := new(big.Float).SetInt(x)
+	if scale > 0 {
+		div := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)
+		f.Quo(f, new(big.Float).SetInt(div))
+	}
+	v, _ := f.Float64()
+	d.dst.WriteFloat64(v)
+}
+
+// exactly representable powers of 10
+var pow10 = []float64{
+	1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10, 1e11,
+	1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18, 1e19, 1e20, 1e21, 1e22,
+}
@@ -0,0 +1,316 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package avro
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/SnellerInc/sneller/ion"
+)
+
+type kind uint8
+
+const (
+	kindNull kind = iota
+	kindBoolean
+	kindInt
+	kindLong
+	kindFloat
+	kindDouble
+	kindBytes
+	kindString
+	kindRecord
+	kindEnum
+	kindArray
+	kindMap
+	kindUnion
+	kindFixed
+)
+
+var primitives = map[string]kind{
+	"null":    kindNull,
+	"boolean": kindBoolean,
+	"int":     kindInt,
+	"long":    kindLong,
+	"float":   kindFloat,
+	"double":  kindDouble,
+	"bytes":   kindBytes,
+	"string":  kindString,
+}
+
+// logical is an Avro logical type
+// that changes how a value is converted
+type logical uint8
+
+const (
+	logicalNone logical = iota
+	logicalDate
+	logicalTimestampMillis
+	logicalTimestampMicros
+	logicalDecimal
+)
+
+// schema is a parsed Avro schema
+type schema struct {
+	kind    kind
+	logical logical
+	name    string    // full name of a named type
+	fields  []field   // kindRecord
+	symbols []string  // kindEnum
+	items   *schema   // kindArray, kindMap
+	types   []*schema // kindUnion
+	size    int       // kindFixed
+	scale   int       // logicalDecimal
+}
+
+type field struct {
+	name string
+	sym  ion.Symbol
+	typ  *schema
+}
+
+// parser resolves references to named types
+type parser struct {
+	named map[string]*schema
+}
+
+// parseSchema parses the JSON representation
+// of an Avro schema (as stored in the avro.schema
+// metadata of an object container file)
+func parseSchema(text []byte) (*schema, error) {
+	var v interface{}
+	if err := json.Unmarshal(text, &v); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSchema, err)
+	}
+	p := &parser{named: make(map[string]*schema)}
+	return p.parse(v, "")
+}
+
+func (p *parser) errorf(f string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidSchema, fmt.Sprintf(f, args...))
+}
+
+// fullname returns the full name of a named
+// type given its name and the enclosing namespace
+func fullname(name, namespace string) string {
+	if strings.Contains(name, ".") || namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+func (p *parser) parse(v interface{}, namespace string) (*schema, error) {
+	switch v := v.(type) {
+	case string:
+		if k, ok := primitives[v]; ok {
+			return &schema{kind: k}, nil
+		}
+		if s := p.named[fullname(v, namespace)]; s != nil {
+			return s, nil
+		}
+		if s := p.named[v]; s != nil {
+			return s, nil
+		}
+		return nil, p.errorf("unknown type %q", v)
+	case []interface{}:
+		s := &schema{kind: kindUnion}
+		for i := range v {
+			t, err := p.parse(v[i], namespace)
+			if err != nil {
+				return nil, err
+			}
+			if t.kind == kindUnion {
+				return nil, p.errorf("unions may not immediately contain other unions")
+			}
+			s.types = append(s.types, t)
+		}
+		return s, nil
+	case map[string]interface{}:
+		return p.parseComplex(v, namespace)
+	default:
+		return nil, p.errorf("unexpected %T in schema", v)
+	}
+}
+
+func (p *parser) parseComplex(v map[string]interface{}, namespace string) (*schema, error) {
+	typ, ok := v["type"]
+	if !ok {
+		return nil, p.errorf("missing \"type\"")
+	}
+	name, _ := typ.(string)
+	var s *schema
+	switch name {
+	case "record", "error", "enum", "fixed":
+		var err error
+		s, namespace, err = p.define(v, namespace)
+		if err != nil {
+			return nil, err
+		}
+	case "array", "map":
+		key := "items"
+		s = &schema{kind: kindArray}
+		if name == "map" {
+			key, s.kind = "values", kindMap
+		}
+		items, ok := v[key]
+		if !ok {
+			return nil, p.errorf("%s is missing %q", name, key)
+		}
+		var err error
+		s.items, err = p.parse(items, namespace)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		// a primitive type (possibly with a logical type)
+		// or a reference to a named type
+		t, err := p.parse(typ, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if lt, ok := v["logicalType"].(string); ok && t.kind < kindRecord {
+			c := *t
+			s = &c
+			s.setLogical(lt, v)
+			return s, nil
+		}
+		return t, nil
+	}
+	if lt, ok := v["logicalType"].(string); ok {
+		s.setLogical(lt, v)
+	}
+	return s, nil
+}
+
+// define parses a named type
+func (p *parser) define(v map[string]interface{}, namespace string) (*schema, string, error) {
+	name, _ := v["name"].(string)
+	if name == "" {
+		return nil, "", p.errorf("named type is missing \"name\"")
+	}
+	if ns, ok := v["namespace"].(string); ok && !strings.Contains(name, ".") {
+		namespace = ns
+	}
+	full := fullname(name, namespace)
+	if i := strings.LastIndexByte(full, '.'); i >= 0 {
+		namespace = full[:i]
+	}
+	if p.named[full] != nil {
+		return nil, "", p.errorf("type %q is defined more than once", full)
+	}
+	s := &schema{name: full}
+	switch v["type"] {
+	case "record", "error":
+		s.kind = kindRecord
+		// register the name first so that
+		// the record can refer to itself
+		p.named[full] = s
+		fields, _ := v["fields"].([]interface{})
+		for i := range fields {
+			f, ok := fields[i].(map[string]interface{})
+			if !ok {
+				return nil, "", p.errorf("record %q: unexpected %T in fields", full, fields[i])
+			}
+			fname, _ := f["name"].(string)
+			if fname == "" {
+				return nil, "", p.errorf("record %q: field is missing \"name\"", full)
+			}
+			ftype, ok := f["type"]
+			if !ok {
+				return nil, "", p.errorf("record %q: field %q is missing \"type\"", full, fname)
+			}
+			t, err := p.parse(ftype, namespace)
+			if err != nil {
+				return nil, "", err
+			}
+			s.fields = append(s.fields, field{name: fname, typ: t})
+		}
+	case "enum":
+		s.kind = kindEnum
+		symbols, _ := v["symbols"].([]interface{})
+		for i := range symbols {
+			str, ok := symbols[i].(string)
+			if !ok {
+				return nil, "", p.errorf("enum %q: unexpected %T in symbols", full, symbols[i])
+			}
+			s.symbols = append(s.symbols, str)
+		}
+		p.named[full] = s
+	case "fixed":
+		s.kind = kindFixed
+		size, ok := v["size"].(float64)
+		if !ok || size < 0 {
+			return nil, "", p.errorf("fixed %q: invalid size", full)
+		}
+		s.size = int(size)
+		p.named[full] = s
+	}
+	return s, namespace, nil
+}
+
+// setLogical sets the logical type of s;
+// per the specification, logical types that
+// are unknown or invalid for the underlying
+// type are ignored
+func (s *schema) setLogical(name string, v map[string]interface{}) {
+	switch name {
+	case "date":
+		if s.kind == kindInt {
+			s.logical = logicalDate
+		}
+	case "timestamp-millis", "local-timestamp-millis":
+		if s.kind == kindLong {
+			s.logical = logicalTimestampMillis
+		}
+	case "timestamp-micros", "local-timestamp-micros":
+		if s.kind == kindLong {
+			s.logical = logicalTimestampMicros
+		}
+	case "decimal":
+		if s.kind != kindBytes && s.kind != kindFixed {
+			return
+		}
+		scale, _ := v["scale"].(float64)
+		if scale < 0 {
+			return
+		}
+		s.logical = logicalDecimal
+		s.scale = int(scale)
+	}
+}
+
+// intern interns the field names of all
+// of the records reachable from s
+func (s *schema) intern(st *ion.Symtab, seen map[*schema]bool) {
+	if seen[s] {
+		return
+	}
+	seen[s] = true
+	switch s.kind {
+	case kindRecord:
+		for i := range s.fields {
+			s.fields[i].sym = st.Intern(s.fields[i].name)
+			s.fields[i].typ.intern(st, seen)
+		}
+	case kindArray, kindMap:
+		s.items.intern(st, seen)
+	case kindUnion:
+		for i := range s.types {
+			s.types[i].intern(st, seen)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cgroup
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cpuPeriod is the period, in microseconds,
+// written to cpu.max
+const cpuPeriod = 100000
+
+// Limits is a set of resource limits
+// that can be applied to a cgroup
+// with Dir.SetLimits.
+//
+// The zero value of each field indicates
+// that the corresponding resource is unlimited
+// (or has the kernel's default weight).
+type Limits struct {
+	// MemoryMax is the value of memory.max in bytes.
+	// When MemoryMax is set, memory.oom.group is also
+	// set so that every process in the cgroup is
+	// killed when the limit is exceeded.
+	MemoryMax int64 `json:"MemoryMax,omitempty"`
+	// CPUWeight is the value of cpu.weight,
+	// which must be in the range [1, 10000].
+	// (The kernel default is 100.)
+	CPUWeight int `json:"CPUWeight,omitempty"`
+	// CPUMax is the maximum number of CPUs
+	// worth of time that the cgroup may use
+	// (for example, 1.5 indicates one and one
+	// half CPUs) and determines cpu.max.
+	CPUMax float64 `json:"CPUMax,omitempty"`
+	// IO is the list of io.max settings.
+	IO []IOLimit `json:"IO,omitempty"`
+}
+
+// IOLimit is a set of io.max limits for
+// one block device. Zero values indicate
+// no limit.
+type IOLimit struct {
+	// Device is the "major:minor"
+	// number of the block device.
+	Device    string `json:"Device"`
+	ReadBPS   int64  `json:"ReadBPS,omitempty"`
+	WriteBPS  int64  `json:"WriteBPS,omitempty"`
+	ReadIOPS  int64  `json:"ReadIOPS,omitempty"`
+	WriteIOPS int64  `json:"WriteIOPS,omitempty"`
+}
+
+func validDevice(dev string) bool {
+	maj, min, ok := strings.Cut(dev, ":")
+	if !ok {
+		return false
+	}
+	_, err0 := strconv.ParseUint(maj, 10, 32)
+	_, err1 := strconv.ParseUint(min, 10, 32)
+	return err0 == nil && err1 == nil
+}
+
+// Validate returns an error if l
+// contains an invalid setting.
+func (l *Limits) Validate() error {
+	if l.MemoryMax < 0 {
+		return fmt.Errorf("invalid MemoryMax %d", l.MemoryMax)
+	}
+	if l.CPUWeight < 0 || l.CPUWeight > 10000 {
+		return fmt.Errorf("CPUWeight %d out of range [1, 10000]", l.CPUWeight)
+	}
+	if l.CPUMax < 0 || math.IsNaN(l.CPUMax) || math.IsInf(l.CPUMax, 0) {
+		return fmt.Errorf("invalid CPUMax %g", l.CPUMax)
+	}
+	for i := range l.IO {
+		io := &l.IO[i]
+		if !validDevice(io.Device) {
+			return fmt.Errorf("invalid io device %q", io.Device)
+		}
+		if io.ReadBPS < 0 || io.WriteBPS < 0 || io.ReadIOPS < 0 || io.WriteIOPS < 0 {
+			return fmt.Errorf("negative io limit for device %s", io.Device)
+		}
+	}
+	return nil
+}
+
+// Controllers returns the list of controllers
+// that must be enabled in the parent of a
+// cgroup in order to apply l to it.
+func (l *Limits) Controllers() []string {
+	var out []string
+	if l.MemoryMax > 0 {
+		out = append(out, "memory")
+	}
+	if l.CPUWeight > 0 || l.CPUMax > 0 {
+		out = append(out, "cpu")
+	}
+	if len(l.IO) > 0 {
+		out = append(out, "io")
+	}
+	return out
+}
+
+// defaultCPUWeight is the kernel
+// default value of cpu.weight
+const defaultCPUWeight = 100
+
+// Tighten returns the limits that result from
+// combining o with l (which may be nil), taking
+// the stricter of the two settings for each limit.
+// Zero values in o indicate that o sets no limit,
+// so they never remove or relax a limit in l.
+func (l *Limits) Tighten(o *Limits) *Limits {
+	out := &Limits{}
+	if l != nil {
+		*out = *l
+		out.IO = append([]IOLimit(nil), l.IO...)
+	}
+	out.MemoryMax = minlimit(out.MemoryMax, o.MemoryMax)
+	if o.CPUWeight > 0 {
+		w := out.CPUWeight
+		if w == 0 {
+			w = defaultCPUWeight
+		}
+		if o.CPUWeight < w {
+			out.CPUWeight = o.CPUWeight
+		}
+	}
+	if o.CPUMax > 0 && (out.CPUMax == 0 || o.CPUMax < out.CPUMax) {
+		out.CPUMax = o.CPUMax
+	}
+	for i := range o.IO {
+		var io *IOLimit
+		for j := range out.IO {
+			if out.IO[j].Device == o.IO[i].Device {
+				io = &out.IO[j]
+				break
+			}
+		}
+		if io == nil {
+			out.IO = append(out.IO, IOLimit{Device: o.IO[i].Device})
+			io = &out.IO[len(out.IO)-1]
+		}
+		io.ReadBPS = minlimit(io.ReadBPS, o.IO[i].ReadBPS)
+		io.WriteBPS = minlimit(io.WriteBPS, o.IO[i].WriteBPS)
+		io.ReadIOPS = minlimit(io.ReadIOPS, o.IO[i].ReadIOPS)
+		io.WriteIOPS = minlimit(io.WriteIOPS, o.IO[i].WriteIOPS)
+	}
+	return out
+}
+
+// minlimit returns the stricter of
+// two limits where zero means no limit
+func minlimit(a, b int64) int64 {
+	if a <= 0 || b > 0 && b < a {
+		return b
+	}
+	return a
+}
+
+func maxval(v int64) string {
+	if v <= 0 {
+		return "max"
+	}
+	return strconv.FormatInt(v, 10)
+}
+
+func (io *IOLimit) line() string {
+	return fmt.Sprintf("%s rbps=%s wbps=%s riops=%s wiops=%s", io.Device,
+		maxval(io.ReadBPS), maxval(io.WriteBPS), maxval(io.ReadIOPS), maxval(io.WriteIOPS))
+}
+
+// Parent returns the parent of d.
+func (d Dir) Parent() Dir { return Dir(filepath.Dir(string(d))) }
+
+// EnableControllers enables the given
+// controllers for the children of d
+// by writing to cgroup.subtree_control.
+func (d Dir) EnableControllers(ctrl ...string) error {
+	if len(ctrl) == 0 {
+		return nil
+	}
+	var buf []byte
+	for i := range ctrl {
+		if i > 0 {
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, '+')
+		buf = append(buf, ctrl[i]...)
+	}
+	return d.WriteLine("cgroup.subtree_control", buf)
+}
+
+// SetLimits applies l to d.
+//
+// Only the controllers returned by l.Controllers
+// are written, so the zero value of Limits does
+// not require any controllers to be enabled.
+// Limits that were previously applied with SetLimits
+// and are not present in l are reset.
+func (d Dir) SetLimits(l *Limits) error {
+	if l.MemoryMax > 0 {
+		if err := d.WriteLine("memory.max", []byte(maxval(l.MemoryMax))); err != nil {
+			return err
+		}
+		if err := d.WriteInt("memory.oom.group", 1); err != nil {
+			return err
+		}
+	} else if d.has("memory.max") {
+		if err := d.WriteLine("memory.max", []byte("max")); err != nil {
+			return err
+		}
+	}
+	if l.CPUWeight > 0 || d.has("cpu.weight") {
+		weight := l.CPUWeight
+		if weight == 0 {
+			weight = 100
+		}
+		if err := d.WriteInt("cpu.weight", weight); err != nil {
+			return err
+		}
+	}
+	if l.CPUMax > 0 || d.has("cpu.max") {
+		quota := "max"
+		if l.CPUMax > 0 {
+			quota = strconv.FormatInt(int64(math.Ceil(l.CPUMax*cpuPeriod)), 10)
+		}
+		if err := d.WriteLine("cpu.max", []byte(quota+" "+strconv.Itoa(cpuPeriod))); err != nil {
+			return err
+		}
+	}
+	return d.setIO(l.IO)
+}
+
+func (d Dir) has(name string) bool {
+	_, err := os.Stat(d.join(name))
+	return err == nil
+}
+
+// setIO writes each line of io.max, resetting
+// the limits for any device that is currently
+// limited but not present in lst
+func (d Dir) setIO(lst []IOLimit) error {
+	if len(lst) == 0 && !d.has("io.max") {
+		return nil
+	}
+	cur, err := d.readLines("io.max")
+	if err != nil && len(lst) == 0 {
+		return nil
+	}
+	for _, line := range cur {
+		dev, _, _ := strings.Cut(line, " ")
+		found := false
+		for i := range lst {
+			if lst[i].Device == dev {
+				found = true
+				break
+			}
+		}
+		if !found {
+			reset := IOLimit{Device: dev}
+			if err := d.WriteLine("io.max", []byte(reset.line())); err != nil {
+				return err
+			}
+		}
+	}
+	for i := range lst {
+		if err := d.WriteLine("io.max", []byte(lst[i].line())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d Dir) readLines(name string) ([]string, error) {
+	f, err := os.Open(d.join(name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" {
+			out = append(out, line)
+		}
+	}
+	return out, s.Err()
+}
+
+// ReadKeyed reads a flat-keyed file
+// (like memory.events) from d.
+func (d Dir) ReadKeyed(name string) (map[string]int64, error) {
+	lines, err := d.readLines(name)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]int64, len(lines))
+	for _, line := range lines {
+		k, v, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("%s: unexpected line %q", name, line)
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		out[k] = n
+	}
+	return out, nil
+}
+
+// OOMKills returns the number of processes
+// in d that have been killed by the OOM killer,
+// as reported by memory.events.
+func (d Dir) OOMKills() (int64, error) {
+	ev, err := d.ReadKeyed("memory.events")
+	if err != nil {
+		return 0, err
+	}
+	return ev["oom_kill"], nil
+}
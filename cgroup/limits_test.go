@@ -0,0 +1,186 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cgroup
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeDir creates a directory containing
+// the given (empty) files
+func fakeDir(t *testing.T, files ...string) Dir {
+	dir := Dir(t.TempDir())
+	truncate(t, dir, files...)
+	return dir
+}
+
+func truncate(t *testing.T, d Dir, files ...string) {
+	for _, f := range files {
+		err := os.WriteFile(d.join(f), nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readLine reads the first line of a file
+// (regular files are not truncated when they
+// are written, so anything after the first
+// line may be left over from a previous write)
+func readLine(t *testing.T, d Dir, name string) string {
+	buf, err := os.ReadFile(d.join(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, _, _ := strings.Cut(string(buf), "\n")
+	return line
+}
+
+func TestSetLimits(t *testing.T) {
+	files := []string{"memory.max", "memory.oom.group", "cpu.weight", "cpu.max", "io.max"}
+	d := fakeDir(t, files...)
+	l := &Limits{
+		MemoryMax: 1 << 30,
+		CPUWeight: 50,
+		CPUMax:    1.5,
+		IO: []IOLimit{{
+			Device:    "259:0",
+			ReadBPS:   1 << 20,
+			WriteIOPS: 100,
+		}},
+	}
+	if err := l.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := l.Controllers(); !reflect.DeepEqual(got, []string{"memory", "cpu", "io"}) {
+		t.Errorf("got controllers %v", got)
+	}
+	if err := d.SetLimits(l); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"memory.max":       "1073741824",
+		"memory.oom.group": "1",
+		"cpu.weight":       "50",
+		"cpu.max":          "150000 100000",
+		"io.max":           "259:0 rbps=1048576 wbps=max riops=max wiops=100",
+	}
+	for name, text := range want {
+		if got := readLine(t, d, name); got != text {
+			t.Errorf("%s: got %q, want %q", name, got, text)
+		}
+	}
+	// resetting to the zero value
+	// should remove every limit
+	// (io.max lists the previous device
+	// in the same way that the kernel would)
+	err := os.WriteFile(d.join("io.max"), []byte(l.IO[0].line()+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetLimits(&Limits{}); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]string{
+		"memory.max": "max",
+		"cpu.weight": "100",
+		"cpu.max":    "max 100000",
+		"io.max":     "259:0 rbps=max wbps=max riops=max wiops=max",
+	}
+	for name, text := range want {
+		if got := readLine(t, d, name); got != text {
+			t.Errorf("%s: got %q, want %q", name, got, text)
+		}
+	}
+}
+
+func TestSetLimitsNoControllers(t *testing.T) {
+	d := fakeDir(t)
+	if err := d.SetLimits(&Limits{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetLimits(&Limits{MemoryMax: 1000}); err == nil {
+		t.Fatal("expected an error without memory.max")
+	}
+}
+
+func TestLimitsValidate(t *testing.T) {
+	bad := []Limits{
+		{MemoryMax: -1},
+		{CPUWeight: 10001},
+		{CPUMax: -0.5},
+		{IO: []IOLimit{{Device: "sda"}}},
+		{IO: []IOLimit{{Device: "8:0", ReadBPS: -1}}},
+	}
+	for i := range bad {
+		if err := bad[i].Validate(); err == nil {
+			t.Errorf("case %d: expected an error", i)
+		}
+	}
+}
+
+func TestLimitsTighten(t *testing.T) {
+	cur := &Limits{
+		MemoryMax: 1 << 30,
+		CPUMax:    2,
+		IO:        []IOLimit{{Device: "8:0", ReadBPS: 1000}},
+	}
+	cases := []struct {
+		cur, in, want *Limits
+	}{
+		// zero values never remove a limit
+		{cur, &Limits{}, cur},
+		// larger values never relax a limit
+		{cur, &Limits{MemoryMax: 1 << 40, CPUMax: 8, CPUWeight: 10000}, cur},
+		{
+			cur,
+			&Limits{MemoryMax: 1 << 20, CPUMax: 1, CPUWeight: 50,
+				IO: []IOLimit{{Device: "8:0", ReadBPS: 2000, WriteBPS: 10}, {Device: "8:16", ReadIOPS: 5}}},
+			&Limits{MemoryMax: 1 << 20, CPUMax: 1, CPUWeight: 50,
+				IO: []IOLimit{{Device: "8:0", ReadBPS: 1000, WriteBPS: 10}, {Device: "8:16", ReadIOPS: 5}}},
+		},
+		// no current limits
+		{nil, &Limits{MemoryMax: 1 << 20}, &Limits{MemoryMax: 1 << 20}},
+		{nil, &Limits{}, &Limits{}},
+	}
+	for i := range cases {
+		got := cases[i].cur.Tighten(cases[i].in)
+		if !reflect.DeepEqual(got, cases[i].want) {
+			t.Errorf("case %d: got %+v, want %+v", i, got, cases[i].want)
+		}
+	}
+	if len(cur.IO) != 1 || cur.IO[0].WriteBPS != 0 {
+		t.Errorf("Tighten modified its receiver: %+v", cur)
+	}
+}
+
+func TestOOMKills(t *testing.T) {
+	d := fakeDir(t)
+	text := "low 0\nhigh 12\nmax 40\noom 2\noom_kill 1\noom_group_kill 1\n"
+	err := os.WriteFile(d.join("memory.events"), []byte(text), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := d.OOMKills()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("got %d OOM kills", n)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/base64"
+	"sync"
+)
+
+// CacheEntry is a cached query result.
+type CacheEntry struct {
+	// ETag is the ETag of the result
+	// returned by the server.
+	ETag string
+	// Body is the complete ion stream
+	// returned by the server.
+	Body []byte
+}
+
+// Cache is the interface used by Client
+// to store query results.
+//
+// Results are only stored once they have
+// been read completely and without error.
+// Subsequent executions of the same query
+// send the ETag of the cached result to the
+// server, and the cached result is re-used
+// if the server reports that it has not changed.
+type Cache interface {
+	// Get returns the entry associated with key.
+	Get(key string) (*CacheEntry, bool)
+	// Put associates an entry with key.
+	Put(key string, e *CacheEntry)
+	// MaxEntrySize returns the size of the
+	// largest result that should be stored.
+	MaxEntrySize() int
+}
+
+func cacheKey(token, database, query string) string {
+	h := sha256.New()
+	h.Write([]byte(token))
+	h.Write([]byte{0})
+	h.Write([]byte(database))
+	h.Write([]byte{0})
+	h.Write([]byte(query))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// MemoryCache is a Cache that stores
+// results in memory, evicting the least
+// recently used results when its total
+// size exceeds a limit.
+type MemoryCache struct {
+	max, size int
+
+	lock    sync.Mutex
+	lru     list.List // of *memoryEntry; front is most recent
+	entries map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key   string
+	entry *CacheEntry
+}
+
+// NewMemoryCache constructs a MemoryCache
+// that holds up to max bytes of results.
+func NewMemoryCache(max int) *MemoryCache {
+	return &MemoryCache{
+		max:     max,
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Get implements Cache.Get
+func (m *MemoryCache) Get(key string) (*CacheEntry, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	el, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	m.lru.MoveToFront(el)
+	return el.Value.(*memoryEntry).entry, true
+}
+
+// Put implements Cache.Put
+func (m *MemoryCache) Put(key string, e *CacheEntry) {
+	if len(e.Body) > m.max {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if el, ok := m.entries[key]; ok {
+		m.remove(el)
+	}
+	m.entries[key] = m.lru.PushFront(&memoryEntry{key: key, entry: e})
+	m.size += len(e.Body)
+	for m.size > m.max {
+		m.remove(m.lru.Back())
+	}
+}
+
+func (m *MemoryCache) remove(el *list.Element) {
+	me := m.lru.Remove(el).(*memoryEntry)
+	delete(m.entries, me.key)
+	m.size -= len(me.entry.Body)
+}
+
+// MaxEntrySize implements Cache.MaxEntrySize
+func (m *MemoryCache) MaxEntrySize() int { return m.max }
@@ -0,0 +1,255 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package client implements a client
+// for the snellerd HTTP API.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Client is a client for a snellerd endpoint.
+type Client struct {
+	// Endpoint is the base URL of
+	// the snellerd HTTP API
+	// (e.g. http://localhost:8000).
+	Endpoint string
+	// Token is the bearer token
+	// used to authenticate requests.
+	Token string
+	// Client is the HTTP client used to
+	// perform requests. If Client is nil,
+	// http.DefaultClient is used.
+	Client *http.Client
+	// Cache, if non-nil, holds the results of
+	// queries so that they can be revalidated
+	// using their ETag rather than re-executed
+	// when the underlying data has not changed.
+	Cache Cache
+}
+
+// StatusError is the error returned when
+// snellerd responds with an unexpected HTTP status.
+type StatusError struct {
+	// StatusCode is the HTTP status code.
+	StatusCode int
+	// Text is the body of the response,
+	// which usually describes the error.
+	Text string
+}
+
+// Error implements error
+func (s *StatusError) Error() string {
+	text := http.StatusText(s.StatusCode)
+	if s.Text != "" {
+		text = s.Text
+	}
+	return fmt.Sprintf("snellerd: %d %s", s.StatusCode, text)
+}
+
+func (c *Client) client() *http.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) request(ctx context.Context, method, path string, args url.Values, body io.Reader) (*http.Request, error) {
+	u := strings.TrimSuffix(c.Endpoint, "/") + path
+	if len(args) > 0 {
+		u += "?" + args.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	return req, nil
+}
+
+// do performs req and returns the response
+// if its status is one of the given codes
+func (c *Client) do(req *http.Request, codes ...int) (*http.Response, error) {
+	res, err := c.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		if res.StatusCode == code {
+			return res, nil
+		}
+	}
+	defer res.Body.Close()
+	text, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+	return nil, &StatusError{
+		StatusCode: res.StatusCode,
+		Text:       strings.TrimSpace(string(text)),
+	}
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, args url.Values, dst any) error {
+	req, err := c.request(ctx, http.MethodGet, path, args, nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return json.NewDecoder(res.Body).Decode(dst)
+}
+
+// Database describes a database.
+type Database struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// Databases returns the list of databases.
+func (c *Client) Databases(ctx context.Context) ([]Database, error) {
+	var out []Database
+	err := c.getJSON(ctx, "/databases", nil, &out)
+	return out, err
+}
+
+// Tables returns the list of tables in a database.
+func (c *Client) Tables(ctx context.Context, database string) ([]string, error) {
+	var out []string
+	err := c.getJSON(ctx, "/tables", url.Values{"database": {database}}, &out)
+	return out, err
+}
+
+// Input describes one input object of a table.
+type Input struct {
+	// Path is the path of the object.
+	Path string `json:"path"`
+	// ETag is the ETag of the object
+	// at the time it was ingested.
+	ETag string `json:"etag"`
+	// Accepted is true if the object
+	// was ingested without errors.
+	Accepted bool `json:"accepted"`
+	// Packfile is the packed file that
+	// contains the data from the object,
+	// if it is known.
+	Packfile string `json:"packfile,omitempty"`
+}
+
+// Inputs returns up to max of the inputs of a table
+// in path order, beginning after the path start.
+// If max is negative, all of the inputs are returned.
+func (c *Client) Inputs(ctx context.Context, database, table, start string, max int) ([]Input, error) {
+	args := url.Values{
+		"database": {database},
+		"table":    {table},
+	}
+	if start != "" {
+		args.Set("start", start)
+	}
+	if max >= 0 {
+		args.Set("max", strconv.Itoa(max))
+	}
+	req, err := c.request(ctx, http.MethodGet, "/inputs", args, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var out []Input
+	dec := json.NewDecoder(bufio.NewReader(res.Body))
+	for {
+		var in Input
+		err := dec.Decode(&in)
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+		out = append(out, in)
+	}
+}
+
+// Query executes a query using database
+// as the default database and returns
+// the rows of the result.
+// The caller must call Rows.Close when
+// it is done reading rows.
+//
+// Errors that occur after the query has
+// started to produce rows are returned
+// by Rows.Err.
+func (c *Client) Query(ctx context.Context, database, query string) (*Rows, error) {
+	args := url.Values{}
+	if database != "" {
+		args.Set("database", database)
+	}
+	var req *http.Request
+	var err error
+	var key string
+	var cached *CacheEntry
+	if c.Cache != nil {
+		// the server only revalidates GET requests
+		args.Set("query", query)
+		req, err = c.request(ctx, http.MethodGet, "/executeQuery", args, nil)
+		key = cacheKey(c.Token, database, query)
+		if e, ok := c.Cache.Get(key); ok {
+			cached = e
+			if err == nil {
+				req.Header.Set("If-None-Match", e.ETag)
+			}
+		}
+	} else {
+		req, err = c.request(ctx, http.MethodPost, "/executeQuery", args, strings.NewReader(query))
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/ion")
+	res, err := c.do(req, http.StatusOK, http.StatusNotModified)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotModified {
+		res.Body.Close()
+		if cached == nil {
+			return nil, &StatusError{StatusCode: res.StatusCode}
+		}
+		return newRows(io.NopCloser(bytes.NewReader(cached.Body)), nil), nil
+	}
+	etag := res.Header.Get("ETag")
+	if c.Cache == nil || etag == "" {
+		return newRows(res.Body, nil), nil
+	}
+	rec := &recorder{buf: []byte{}, limit: c.Cache.MaxEntrySize()}
+	rows := newRows(res.Body, rec)
+	rows.save = func(body []byte) {
+		c.Cache.Put(key, &CacheEntry{ETag: etag, Body: body})
+	}
+	return rows, nil
+}
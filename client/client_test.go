@@ -0,0 +1,313 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/SnellerInc/sneller/ion"
+	"github.com/SnellerInc/sneller/plan"
+	"github.com/SnellerInc/sneller/tenant/tnproto"
+)
+
+// stream produces a result stream
+// in the format written by snellerd
+type stream struct {
+	st  ion.Symtab
+	buf ion.Buffer
+}
+
+func (s *stream) row(fields ...ion.Field) {
+	ion.NewStruct(&s.st, fields).Encode(&s.buf, &s.st)
+}
+
+func (s *stream) annotation(label string, fields ...ion.Field) {
+	s.buf.BeginAnnotation(1)
+	s.buf.BeginField(s.st.Intern(label))
+	ion.NewStruct(&s.st, fields).Encode(&s.buf, &s.st)
+	s.buf.EndAnnotation()
+}
+
+func (s *stream) bytes() []byte {
+	var out ion.Buffer
+	s.st.Marshal(&out, true)
+	return append(out.Bytes(), s.buf.Bytes()...)
+}
+
+func testClient(t *testing.T, h http.HandlerFunc) *Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return &Client{Endpoint: srv.URL + "/", Token: "secret"}
+}
+
+func TestQuery(t *testing.T) {
+	var s stream
+	s.row(ion.Field{Label: "name", Value: ion.String("foo")}, ion.Field{Label: "count", Value: ion.Int(3)})
+	s.row(ion.Field{Label: "name", Value: ion.String("bar")}, ion.Field{Label: "count", Value: ion.Int(5)})
+	s.annotation("final_status",
+		ion.Field{Label: "hits", Value: ion.Int(1)},
+		ion.Field{Label: "scanned", Value: ion.Int(1000)},
+		ion.Field{Label: "queue_depth", Value: ion.Int(2)},
+		ion.Field{Label: "queue_wait", Value: ion.Float(0.5)},
+	)
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.URL.Path != "/executeQuery" ||
+			r.URL.Query().Get("database") != "db" || string(body) != "SELECT * FROM t" ||
+			r.Header.Get("Accept") != "application/ion" {
+			t.Errorf("unexpected request %s %s %q", r.Method, r.URL, body)
+		}
+		w.Write(s.bytes())
+	})
+	rows, err := c.Query(context.Background(), "db", "SELECT * FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	type row struct {
+		Name  string `ion:"name"`
+		Count int    `ion:"count"`
+	}
+	var got []row
+	var first ion.Datum
+	for rows.Next() {
+		if first.Empty() {
+			first, err = rows.Datum()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		var r row
+		if err := rows.Unmarshal(&r); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := []row{{"foo", 3}, {"bar", 5}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got rows %v", got)
+	}
+	if name, _ := first.Field("name").String(); name != "foo" {
+		t.Errorf("first row %v", first)
+	}
+	if stats := rows.Stats(); !reflect.DeepEqual(stats, &plan.ExecStats{CacheHits: 1, BytesScanned: 1000}) {
+		t.Errorf("got stats %+v", stats)
+	}
+	if depth, wait := rows.Queue(); depth != 2 || wait != 500*time.Millisecond {
+		t.Errorf("got queue depth %d wait %s", depth, wait)
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	var midstream, final, truncated stream
+	midstream.row(ion.Field{Label: "x", Value: ion.Int(1)})
+	midstream.annotation("query_error", ion.Field{Label: "error_message", Value: ion.String("out of memory")})
+	final.annotation("final_status", ion.Field{Label: "error", Value: ion.String("tenant crashed")})
+	truncated.row(ion.Field{Label: "x", Value: ion.Int(1)})
+
+	streams := map[string][]byte{
+		"midstream": midstream.bytes(),
+		"final":     final.bytes(),
+		"truncated": truncated.bytes(),
+	}
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		res, ok := streams[string(body)]
+		if !ok {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		w.Write(res)
+	})
+	check := func(query string, want error) {
+		t.Helper()
+		rows, err := c.Query(context.Background(), "", query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+		}
+		if err := rows.Err(); !reflect.DeepEqual(err, want) {
+			t.Errorf("%s: got error %v", query, err)
+		}
+	}
+	check("midstream", &tnproto.RemoteError{Text: "out of memory"})
+	check("final", &tnproto.RemoteError{Text: "tenant crashed"})
+	check("truncated", ErrNoStatus)
+
+	_, err := c.Query(context.Background(), "", "SELECT")
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusBadRequest || se.Text != "bad query" {
+		t.Errorf("got error %v", err)
+	}
+	c.Token = "wrong"
+	_, err = c.Query(context.Background(), "", "final")
+	if !errors.As(err, &se) || se.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestQueryCache(t *testing.T) {
+	executed := 0
+	etag := `"v1"`
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Query().Get("query") == "" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		executed++
+		var s stream
+		s.row(ion.Field{Label: "n", Value: ion.Int(int64(executed))})
+		s.annotation("final_status")
+		w.Write(s.bytes())
+	})
+	c.Cache = NewMemoryCache(1024)
+
+	query := func(text string) uint64 {
+		t.Helper()
+		rows, err := c.Query(context.Background(), "db", text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var n uint64
+		for rows.Next() {
+			d, err := rows.Datum()
+			if err != nil {
+				t.Fatal(err)
+			}
+			n, _ = d.Field("n").Uint()
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := query("SELECT n"); n != 1 {
+		t.Fatalf("first query returned %d", n)
+	}
+	// the cached result is re-used
+	if n := query("SELECT n"); n != 1 || executed != 1 {
+		t.Fatalf("second query returned %d (executed %d)", n, executed)
+	}
+	// different query text is not
+	if n := query("SELECT n AS n"); n != 2 {
+		t.Fatalf("third query returned %d", n)
+	}
+	// the result is updated when the
+	// server produces a new ETag
+	etag = `"v2"`
+	if n := query("SELECT n"); n != 3 {
+		t.Fatalf("fourth query returned %d", n)
+	}
+	if n := query("SELECT n"); n != 3 || executed != 3 {
+		t.Fatalf("fifth query returned %d (executed %d)", n, executed)
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	m := NewMemoryCache(10)
+	m.Put("a", &CacheEntry{ETag: "a", Body: make([]byte, 4)})
+	m.Put("b", &CacheEntry{ETag: "b", Body: make([]byte, 4)})
+	m.Get("a")
+	m.Put("c", &CacheEntry{ETag: "c", Body: make([]byte, 4)})
+	// b is the least recently used
+	if _, ok := m.Get("b"); ok {
+		t.Error("b not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if e, ok := m.Get(key); !ok || e.ETag != key {
+			t.Errorf("missing %s", key)
+		}
+	}
+	m.Put("d", &CacheEntry{ETag: "d", Body: make([]byte, 11)})
+	if _, ok := m.Get("d"); ok {
+		t.Error("oversized entry stored")
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/databases":
+			w.Write([]byte(`[{"name":"db0"},{"name":"db1","description":"the other one"}]`))
+		case "/tables":
+			if q.Get("database") != "db0" {
+				http.Error(w, "no such database", http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(`["t0","t1"]`))
+		case "/inputs":
+			if q.Get("database") != "db0" || q.Get("table") != "t0" || q.Get("start") != "a" || q.Get("max") != "2" {
+				t.Errorf("unexpected request %s", r.URL)
+			}
+			w.Write([]byte("{\"path\":\"b\",\"etag\":\"e0\",\"accepted\":true,\"packfile\":\"p\"}\n"))
+			w.Write([]byte("{\"path\":\"c\",\"etag\":\"e1\",\"accepted\":false}\n"))
+		}
+	})
+	ctx := context.Background()
+	dbs, err := c.Databases(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dbs, []Database{{Name: "db0"}, {Name: "db1", Description: "the other one"}}) {
+		t.Errorf("got databases %v", dbs)
+	}
+	tables, err := c.Tables(ctx, "db0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tables, []string{"t0", "t1"}) {
+		t.Errorf("got tables %v", tables)
+	}
+	_, err = c.Tables(ctx, "db2")
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusNotFound {
+		t.Errorf("got error %v", err)
+	}
+	inputs, err := c.Inputs(ctx, "db0", "t0", "a", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Input{
+		{Path: "b", ETag: "e0", Accepted: true, Packfile: "p"},
+		{Path: "c", ETag: "e1"},
+	}
+	if !reflect.DeepEqual(inputs, want) {
+		t.Errorf("got inputs %v", inputs)
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/SnellerInc/sneller/ion"
+	"github.com/SnellerInc/sneller/plan"
+	"github.com/SnellerInc/sneller/tenant/tnproto"
+)
+
+// ErrNoStatus is returned by Rows.Err when
+// the result stream ended without the final
+// status written by the server, which means
+// that the result may be incomplete.
+var ErrNoStatus = errors.New("client: query results ended without a final status")
+
+// Rows is an iterator over the rows
+// of a query result.
+//
+// The result is decoded as it is read
+// from the server. Errors reported by
+// the server while the query is running
+// are returned by Rows.Err as a
+// *tnproto.RemoteError, or as a
+// *plan.LimitError if the query exceeded
+// its time limit or scan limit, in which
+// case Rows.Stats returns the statistics
+// collected before the query was aborted.
+type Rows struct {
+	body io.ReadCloser
+	src  *bufio.Reader
+	st   ion.Symtab
+	buf  []byte
+	row  []byte
+	done bool
+	err  error
+
+	stats      plan.ExecStats
+	queueDepth int
+	queueWait  time.Duration
+
+	// if save is non-nil, the body recorded
+	// by record is passed to save when the
+	// final status has been read without error
+	record *recorder
+	save   func([]byte)
+}
+
+type recorder struct {
+	src   io.Reader
+	buf   []byte
+	limit int
+}
+
+func (r *recorder) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	if r.buf != nil {
+		if len(r.buf)+n > r.limit {
+			r.buf = nil // too large to save
+		} else {
+			r.buf = append(r.buf, p[:n]...)
+		}
+	}
+	return n, err
+}
+
+// newRows returns Rows that decode the
+// result from body; if rec is non-nil,
+// body is read through rec
+func newRows(body io.ReadCloser, rec *recorder) *Rows {
+	r := &Rows{body: body, record: rec}
+	if rec != nil {
+		rec.src = body
+		r.src = bufio.NewReaderSize(rec, 64*1024)
+	} else {
+		r.src = bufio.NewReaderSize(body, 64*1024)
+	}
+	return r
+}
+
+// Next advances to the next row and
+// returns true, or returns false if
+// there are no more rows or an error
+// occurred. (See Rows.Err.)
+func (r *Rows) Next() bool {
+	r.row = nil
+	if r.done {
+		return false
+	}
+	for {
+		_, size, err := ion.Peek(r.src)
+		if err != nil {
+			if err == io.EOF {
+				err = ErrNoStatus
+			}
+			r.finish(err)
+			return false
+		}
+		if cap(r.buf) < size {
+			r.buf = make([]byte, size)
+		}
+		item := r.buf[:size]
+		if _, err := io.ReadFull(r.src, item); err != nil {
+			r.finish(err)
+			return false
+		}
+		if ion.IsBVM(item) {
+			if _, err := r.st.Unmarshal(item); err != nil {
+				r.finish(err)
+				return false
+			}
+			continue
+		}
+		if ion.TypeOf(item) != ion.AnnotationType {
+			r.row = item
+			return true
+		}
+		if err := r.annotation(item); err != nil || r.done {
+			r.finish(err)
+			return false
+		}
+	}
+}
+
+// annotation handles an annotated value
+// in the result stream
+func (r *Rows) annotation(item []byte) error {
+	sym, body, _, err := ion.ReadAnnotation(item)
+	if err != nil {
+		return err
+	}
+	switch {
+	case sym == ion.SystemSymSymbolTable:
+		_, err = r.st.Unmarshal(item)
+		return err
+	case r.st.Get(sym) == "query_error":
+		// query_error::{error_message: "..."} or
+		// query_error::{error_message: "...", limit: {...}}
+		r.done = true
+		var msg struct {
+			Message string `ion:"error_message"`
+		}
+		var limit []byte
+		_, err := ion.UnpackStruct(&r.st, body, func(name string, field []byte) error {
+			if name == "limit" {
+				limit = field
+			}
+			return nil
+		})
+		if err == nil {
+			_, err = ion.Unmarshal(&r.st, body, &msg)
+		}
+		if err != nil {
+			return fmt.Errorf("client: decoding query_error: %w", err)
+		}
+		if limit != nil {
+			lerr := new(plan.LimitError)
+			if err := lerr.Decode(limit, &r.st); err != nil {
+				return fmt.Errorf("client: decoding query_error: %w", err)
+			}
+			r.stats = lerr.Stats
+			return lerr
+		}
+		return &tnproto.RemoteError{Text: msg.Message}
+	case r.st.Get(sym) == "final_status":
+		// final_status::{error: "..."} or
+		// final_status::{hits: ..., misses: ..., ...}
+		r.done = true
+		var status struct {
+			Error      string  `ion:"error"`
+			QueueDepth int     `ion:"queue_depth"`
+			QueueWait  float64 `ion:"queue_wait"`
+		}
+		if _, err := ion.Unmarshal(&r.st, body, &status); err != nil {
+			return fmt.Errorf("client: decoding final_status: %w", err)
+		}
+		if status.Error != "" {
+			return &tnproto.RemoteError{Text: status.Error}
+		}
+		if err := r.stats.Decode(body, &r.st); err != nil {
+			return fmt.Errorf("client: decoding final_status: %w", err)
+		}
+		r.queueDepth = status.QueueDepth
+		r.queueWait = time.Duration(status.QueueWait * float64(time.Second))
+		return nil
+	}
+	// ignore other annotations
+	return nil
+}
+
+func (r *Rows) finish(err error) {
+	r.done = true
+	r.err = err
+	if err == nil && r.save != nil && r.record.buf != nil {
+		r.save(r.record.buf)
+	}
+	r.save = nil
+}
+
+// Datum returns the current row.
+func (r *Rows) Datum() (ion.Datum, error) {
+	if r.row == nil {
+		return ion.Empty, fmt.Errorf("client: Rows.Datum called without a current row")
+	}
+	d, _, err := ion.ReadDatum(&r.st, r.row)
+	if err != nil {
+		return ion.Empty, err
+	}
+	// the row buffer is re-used by Next
+	return d.Clone(), nil
+}
+
+// Unmarshal unmarshals the current row
+// into dst using ion.Unmarshal.
+func (r *Rows) Unmarshal(dst any) error {
+	if r.row == nil {
+		return fmt.Errorf("client: Rows.Unmarshal called without a current row")
+	}
+	_, err := ion.Unmarshal(&r.st, r.row, dst)
+	return err
+}
+
+// Err returns the error, if any, that
+// was encountered while reading rows.
+// Err should be called once Next
+// has returned false.
+func (r *Rows) Err() error { return r.err }
+
+// Stats returns the execution statistics
+// of the query. The statistics are only
+// available once Next has returned false
+// and Err has returned nil (or a *plan.LimitError).
+func (r *Rows) Stats() *plan.ExecStats { return &r.stats }
+
+// Queue returns the number of queries that
+// were queued ahead of the query and the time
+// that the query waited before it was executed.
+// Like Stats, the results are only available
+// once all of the rows have been read.
+func (r *Rows) Queue() (depth int, wait time.Duration) {
+	return r.queueDepth, r.queueWait
+}
+
+// Close closes the result stream.
+// If Close is called before all the
+// rows have been read, the query is
+// canceled.
+func (r *Rows) Close() error {
+	r.done = true
+	r.save = nil
+	return r.body.Close()
+}
@@ -16,6 +16,7 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -38,9 +39,12 @@ var (
 	dashv        bool
 	dashh        bool
 	dashf        bool
+	dashs        bool
 	dashm        int64
+	dashi        time.Duration
 	dasho        string
 	token        string
+	endpoint     string
 	authEndPoint string
 	printVersion bool
 	printBuild   bool
@@ -60,9 +64,12 @@ func init() {
 	flag.BoolVar(&dashv, "v", false, "verbose")
 	flag.BoolVar(&dashh, "h", false, "show usage help")
 	flag.BoolVar(&dashf, "f", false, "force rebuild")
+	flag.BoolVar(&dashs, "s", false, "infer the shape of new data during sync")
 	flag.Int64Var(&dashm, "m", 100*giga, "maximum input bytes read per index update")
 	flag.StringVar(&dasho, "o", "-", "output file (or - for stdin) for unpack")
+	flag.DurationVar(&dashi, "i", 0, "interval at which compact runs repeatedly (0 means run once)")
 	flag.StringVar(&token, "token", "", "JWT token or custom bearer token (default: fetch from SNELLER_TOKEN environment variable)")
+	flag.StringVar(&endpoint, "endpoint", "", "snellerd endpoint for scheduled queries (default: fetch from SNELLER_ENDPOINT environment variable)")
 	flag.StringVar(&authEndPoint, "a", "", "authorization specification (file://, empty uses environment)")
 	flag.BoolVar(&printBuild, "build", false, "print the build info of executable")
 	flag.BoolVar(&printVersion, "version", false, "print the version of executable")
@@ -154,7 +161,6 @@ func gc(creds db.Tenant, dbname, tblpat string) {
 	if dashv {
 		conf.Logf = logf
 	}
-	key := creds.Key()
 	for _, tab := range tables {
 		match, err := path.Match(tblpat, tab)
 		if err != nil {
@@ -163,7 +169,7 @@ func gc(creds db.Tenant, dbname, tblpat string) {
 		if !match {
 			continue
 		}
-		idx, err := db.OpenIndex(ofs, dbname, tab, key)
+		idx, err := db.OpenIndexFor(ofs, dbname, tab, creds, 0)
 		if err != nil {
 			exitf("opening index for %s/%s: %s", dbname, tab, err)
 		}
@@ -191,6 +197,7 @@ func sync(dbname, tblpat string) {
 			Force:         dashf,
 			MaxScanBytes:  dashm,
 			GCMinimumAge:  5 * time.Minute,
+			InferShape:    dashs,
 		}
 		if dashv {
 			b.Logf = logf
@@ -205,6 +212,38 @@ func sync(dbname, tblpat string) {
 	}
 }
 
+// entry point for 'sdb compact ...'
+func compact(dbname, tblpat string) {
+	for {
+		var err error
+		for {
+			b := db.Builder{
+				Align:         1024 * 1024,
+				RangeMultiple: 100,
+				Force:         dashf,
+				GCMinimumAge:  5 * time.Minute,
+			}
+			if dashv {
+				b.Logf = logf
+			}
+			err = b.Compact(creds(), dbname, tblpat)
+			if !errors.Is(err, db.ErrBuildAgain) {
+				break
+			}
+			// the table is being scanned; wait
+			// for the scan to make some progress
+			time.Sleep(time.Second)
+		}
+		if err != nil {
+			exitf("compact: %s", err)
+		}
+		if dashi <= 0 {
+			return
+		}
+		time.Sleep(dashi)
+	}
+}
+
 var hsizes = []byte{'K', 'M', 'G', 'T', 'P', 'E'}
 
 func human(size int64) string {
@@ -249,7 +288,7 @@ func describeTrailer(t *blockfmt.Trailer, compsize int64) {
 
 func describe(creds db.Tenant, dbname, table string) {
 	ofs := root(creds)
-	idx, err := db.OpenIndex(ofs, dbname, table, creds.Key())
+	idx, err := db.OpenIndexFor(ofs, dbname, table, creds, 0)
 	if err != nil {
 		exitf("opening index: %s", err)
 	}
@@ -275,6 +314,33 @@ func describe(creds db.Tenant, dbname, table string) {
 	fmt.Printf("total blocks:       %d\n", blocks)
 	fmt.Printf("total compressed:   %s\n", human(totalComp))
 	fmt.Printf("total decompressed: %s (%.2fx)\n", human(totalDecomp), float64(totalDecomp)/float64(totalComp))
+	def, err := db.OpenDefinition(ofs, dbname, table)
+	if err == nil && def.Schema != nil {
+		describeSchema(def.Schema)
+	}
+}
+
+func describeSchema(s *db.Schema) {
+	if s.Strict {
+		fmt.Printf("schema (strict):\n")
+	} else {
+		fmt.Printf("schema:\n")
+	}
+	for i := range s.Fields {
+		f := &s.Fields[i]
+		var attrs []string
+		if f.Required {
+			attrs = append(attrs, "required")
+		}
+		if f.Nullable {
+			attrs = append(attrs, "nullable")
+		}
+		fmt.Printf("\t%s %s", f.Path, f.Type)
+		if len(attrs) > 0 {
+			fmt.Printf(" (%s)", strings.Join(attrs, ", "))
+		}
+		fmt.Printf("\n")
+	}
 }
 
 func fetch(creds db.Tenant, files ...string) {
@@ -303,7 +369,7 @@ func fetch(creds db.Tenant, files ...string) {
 
 func inputs(creds db.Tenant, dbname, table string) {
 	ofs := outfs(creds)
-	idx, err := db.OpenIndex(ofs, dbname, table, creds.Key())
+	idx, err := db.OpenIndexFor(ofs, dbname, table, creds, 0)
 	if err != nil {
 		exitf("opening index: %s", err)
 	}
@@ -318,16 +384,48 @@ func inputs(creds db.Tenant, dbname, table string) {
 	}
 }
 
+// entry point for 'sdb shape ...'
+func shape(creds db.Tenant, dbname, table string) {
+	s, err := db.OpenShape(outfs(creds), dbname, table)
+	if err != nil {
+		exitf("opening shape: %s", err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+	err = enc.Encode(s)
+	if err != nil {
+		exitf("%s", err)
+	}
+}
+
+// activeToken returns the token provided
+// via -token or $SNELLER_TOKEN
+func activeToken() string {
+	if token != "" {
+		return token
+	}
+	return os.Getenv("SNELLER_TOKEN")
+}
+
+// snellerEndpoint returns the snellerd endpoint
+// provided via -endpoint or $SNELLER_ENDPOINT
+func snellerEndpoint() string {
+	ep := endpoint
+	if ep == "" {
+		ep = os.Getenv("SNELLER_ENDPOINT")
+	}
+	if ep == "" {
+		exitf("no endpoint provided via -endpoint or $SNELLER_ENDPOINT")
+	}
+	return ep
+}
+
 func creds() db.Tenant {
 	if localTenant {
 		return db.NewLocalTenantFromPath(tmpdir)
 	}
 
-	activeToken := token
-	if activeToken == "" {
-		activeToken = os.Getenv("SNELLER_TOKEN")
-	}
-
+	activeToken := activeToken()
 	if activeToken == "" {
 		exitf("no token provided via -token or $SNELLER_TOKEN")
 	}
@@ -355,7 +453,7 @@ func (e *errorWriter) Write(p []byte) (int, error) {
 
 func validate(creds db.Tenant, dbname, table string) {
 	ofs := root(creds)
-	idx, err := db.OpenIndex(ofs, dbname, table, creds.Key())
+	idx, err := db.OpenIndexFor(ofs, dbname, table, creds, 0)
 	if err != nil {
 		exitf("opening index: %s", err)
 	}
@@ -374,6 +472,7 @@ func validate(creds db.Tenant, dbname, table string) {
 		if err != nil {
 			exitf("opening %s: %s", descs[i].Path, err)
 		}
+		unwrapKey(creds, descs[i].Path, descs[i].Trailer)
 		blockfmt.Validate(f, descs[i].Trailer, &e)
 		f.Close()
 	}
@@ -448,8 +547,16 @@ func unpack(args []string) {
 	}
 	defer out.Close()
 	var d blockfmt.Decoder
+	var tenant db.Tenant
 	for i := range args {
 		src, trailer := openarg(args[i])
+		if trailer.Encryption != nil {
+			// only authorize if we have to
+			if tenant == nil {
+				tenant = creds()
+			}
+			unwrapKey(tenant, args[i], trailer)
+		}
 		d.Set(trailer, len(trailer.Blocks))
 		data := io.LimitReader(src, trailer.Offset)
 		_, err := d.Copy(out, data)
@@ -459,6 +566,75 @@ func unpack(args []string) {
 	}
 }
 
+// unwrapKey unwraps the data key of t with
+// the master key of creds if t is encrypted,
+// falling back to $SNELLER_OLD_MASTER_KEY for
+// objects that were written before a "rekey"
+func unwrapKey(creds db.Tenant, name string, t *blockfmt.Trailer) {
+	if t.Encryption == nil || t.Encryption.DataKey != nil {
+		return
+	}
+	key := db.MasterKey(creds)
+	if key == nil {
+		exitf("%s is encrypted, but the tenant has no master key", name)
+	}
+	err := t.Encryption.Unwrap(key)
+	if errors.Is(err, blockfmt.ErrWrongKey) {
+		if old := oldMasterKey(); old != nil {
+			err = t.Encryption.Unwrap(old)
+		}
+	}
+	if err != nil {
+		exitf("%s: %s", name, err)
+	}
+}
+
+// oldMasterKey returns the master key in
+// $SNELLER_OLD_MASTER_KEY, or nil if it is not set
+func oldMasterKey() *blockfmt.MasterKey {
+	text := os.Getenv("SNELLER_OLD_MASTER_KEY")
+	if text == "" {
+		return nil
+	}
+	buf, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		exitf("invalid $SNELLER_OLD_MASTER_KEY: %s", err)
+	}
+	if len(buf) != blockfmt.MasterKeyLength {
+		exitf("length of $SNELLER_OLD_MASTER_KEY is %d, has to be %d", len(buf), blockfmt.MasterKeyLength)
+	}
+	key := new(blockfmt.MasterKey)
+	copy(key[:], buf)
+	return key
+}
+
+// entry point for 'sdb rekey ...'
+func rekey(dbname, tblpat string) {
+	old := oldMasterKey()
+	if old == nil {
+		exitf("$SNELLER_OLD_MASTER_KEY must be set to the previous master key")
+	}
+	var err error
+	for {
+		b := db.Builder{
+			GCMinimumAge: 5 * time.Minute,
+		}
+		if dashv {
+			b.Logf = logf
+		}
+		err = b.Rekey(creds(), dbname, tblpat, old)
+		if !errors.Is(err, db.ErrBuildAgain) {
+			break
+		}
+		// the table is being scanned; wait
+		// for the scan to make some progress
+		time.Sleep(time.Second)
+	}
+	if err != nil {
+		exitf("rekey: %s", err)
+	}
+}
+
 type applet struct {
 	name string // command name
 	help string // list of options
@@ -522,6 +698,10 @@ the command
 synchronizes all the tables that match <pattern> within
 the database <db> against the list of objects specified
 in the associated definition.json files (see also "create")
+
+If the -s flag is provided, the shape of the newly
+ingested data is merged into the shape of each table
+(see also "shape")
 `,
 		run: func(args []string) bool {
 			if len(args) < 2 || len(args) > 3 {
@@ -534,6 +714,136 @@ in the associated definition.json files (see also "create")
 			return true
 		},
 	},
+	{
+		name: "compact",
+		help: "<db> <table-pattern?>",
+		desc: `compact the packed objects of a table
+The command
+  $ sdb compact <db> <pattern>
+rewrites the small packed objects of all the tables
+that match <pattern> within the database <db> into
+larger objects. If the table definition includes a
+"cluster" key, for example
+
+  {
+    "name": "<table-name>",
+    "cluster": ["customer_id", "ts"],
+    ...
+  }
+
+then the rows in each rewritten object are sorted
+by the listed fields.
+
+With the -i <interval> flag, compaction runs
+repeatedly at the given interval until the
+process is terminated.
+With the -f flag, objects that would be rewritten
+on their own are re-sorted as well.
+`,
+		run: func(args []string) bool {
+			if len(args) < 2 || len(args) > 3 {
+				return false
+			}
+			if len(args) == 2 {
+				args = append(args, "*")
+			}
+			compact(args[1], args[2])
+			return true
+		},
+	},
+	{
+		name: "rekey",
+		help: "<db> <table-pattern?>",
+		desc: `re-wrap the data keys of encrypted objects
+The command
+  $ sdb rekey <db> <pattern>
+re-wraps the data key of each encrypted packed
+object in the tables that match <pattern> within
+the database <db> with the current master key
+of the tenant. The previous master key must be
+provided (base64-encoded) in $SNELLER_OLD_MASTER_KEY.
+
+Each re-keyed object is copied to a new object
+whose trailer holds the re-wrapped data key
+(the blocks are not decrypted), and the original
+object is removed by garbage collection.
+Running the command again after a failure is safe.
+`,
+		run: func(args []string) bool {
+			if len(args) < 2 || len(args) > 3 {
+				return false
+			}
+			if len(args) == 2 {
+				args = append(args, "*")
+			}
+			rekey(args[1], args[2])
+			return true
+		},
+	},
+	{
+		name: "schedule",
+		help: "<db> <schedule.json>",
+		desc: `add or replace a scheduled query
+The command
+  $ sdb schedule <db> schedule.json
+uploads a copy of schedule.json to
+the tenant root file system at
+  /schedules/<db>/<name>.json
+using the name given in the schedule.json file
+
+The schedule.json is expected to be a JSON
+document with the following structure:
+
+  {
+    "name": "<query-name>",
+    "schedule": "*/15 * * * *",
+    "query": "SELECT COUNT(*) FROM events",
+    "table": "<table-name>"
+  }
+
+The schedule is a cron expression (in UTC).
+The results of each run are appended to
+"table" in <db>, or POSTed as NDJSON to
+the URL in "webhook", or discarded if
+neither is given. (See also "scheduler")
+`,
+		run: func(args []string) bool {
+			if len(args) != 3 {
+				return false
+			}
+			schedule(creds(), args[1], args[2])
+			return true
+		},
+	},
+	{
+		name: "scheduler",
+		help: "<db>",
+		desc: `run the scheduled queries of a database
+The command
+  $ sdb scheduler <db>
+runs until it is terminated, running the
+scheduled queries of <db> (see "schedule")
+against the snellerd endpoint given by
+-endpoint or $SNELLER_ENDPOINT using the
+token given by -token or $SNELLER_TOKEN.
+The list of scheduled queries is re-read
+every minute.
+
+Each run is recorded in the table
+"schedule_history" in <db> with the name
+and text of the query, the start time,
+the duration (in nanoseconds), whether the
+run succeeded, the error (if any), and the
+execution statistics of the query.
+`,
+		run: func(args []string) bool {
+			if len(args) != 2 {
+				return false
+			}
+			runScheduler(args[1])
+			return true
+		},
+	},
 	{
 		name: "gc",
 		help: "<db> <table-pattern?>",
@@ -566,7 +876,8 @@ The command
   $ sdb describe <db> <table>
 will output a textual description
 of the index file associated with
-the given database+table.
+the given database+table, followed by
+the declared schema of the table (if any).
 `,
 		run: func(args []string) bool {
 			if len(args) != 3 {
@@ -576,6 +887,28 @@ the given database+table.
 			return true
 		},
 	},
+	{
+		name: "shape",
+		help: "<db> <table>",
+		desc: `shape <db> <table>
+The command
+  $ sdb shape <db> <table>
+outputs the inferred shape of the given
+database+table as JSON. The shape includes
+the types observed for each path in the table
+and a report of the paths that were added,
+removed, or changed type in the most recent
+ingest. The shape is only updated by
+"sync" when the -s flag is provided.
+`,
+		run: func(args []string) bool {
+			if len(args) != 3 {
+				return false
+			}
+			shape(creds(), args[1], args[2])
+			return true
+		},
+	},
 	{
 		name: "inputs",
 		help: "<db> <table>",
@@ -701,6 +1034,7 @@ func main() {
 		fmt.Fprintf(os.Stderr, "  -a       auth-spec: file://\n")
 		fmt.Fprintf(os.Stderr, "           pointing local credentials (empty uses environment)\n")
 		fmt.Fprintf(os.Stderr, "  -token   token: the token to pass to the auth server (empty uses $SNELLER_TOKEN)\n")
+		fmt.Fprintf(os.Stderr, "  -endpoint endpoint: the snellerd endpoint for \"scheduler\" (empty uses $SNELLER_ENDPOINT)\n")
 		fmt.Fprintf(os.Stderr, "  -version show program version\n")
 		fmt.Fprintf(os.Stderr, "  -build   show program build info\n")
 		fmt.Fprintf(os.Stderr, "Available commands:\n")
@@ -0,0 +1,361 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/SnellerInc/sneller/client"
+	"github.com/SnellerInc/sneller/date"
+	"github.com/SnellerInc/sneller/db"
+	"github.com/SnellerInc/sneller/expr"
+	"github.com/SnellerInc/sneller/expr/partiql"
+	"github.com/SnellerInc/sneller/ion"
+	"github.com/SnellerInc/sneller/ion/blockfmt"
+	"github.com/SnellerInc/sneller/plan"
+)
+
+// entry point for 'sdb schedule ...'
+func schedule(creds db.Tenant, dbname, defpath string) {
+	f, err := os.Open(defpath)
+	if err != nil {
+		exitf("%s", err)
+	}
+	defer f.Close()
+	q := new(db.ScheduledQuery)
+	err = json.NewDecoder(f).Decode(q)
+	if err != nil {
+		exitf("%s: %s", defpath, err)
+	}
+	if dashv {
+		logf("scheduling query %q in db %q", q.Name, dbname)
+	}
+	err = db.WriteSchedule(outfs(creds), dbname, q)
+	if err != nil {
+		exitf("writing scheduled query: %s", err)
+	}
+}
+
+// scheduler runs the scheduled
+// queries of one database
+type scheduler struct {
+	owner  db.Tenant
+	root   db.InputFS
+	dbname string
+	// client is used to run queries
+	client *client.Client
+	// hooks is used to POST results to webhooks;
+	// http.DefaultClient is used if hooks is nil
+	hooks *http.Client
+	logf  func(f string, args ...any)
+
+	next    map[string]time.Time
+	crons   map[string]string
+	running map[string]bool
+	// done receives the name of each
+	// query when its run completes
+	done chan string
+}
+
+// run is one run of a scheduled query
+type run struct {
+	query    *db.ScheduledQuery
+	start    time.Time
+	duration time.Duration
+	err      error
+	stats    plan.ExecStats
+}
+
+// tick starts each scheduled query that is due at now.
+// A query that is added or whose schedule is changed
+// is first run at the next time its schedule matches
+// after now, and a query is not started while its
+// previous run is still in progress.
+func (s *scheduler) tick(ctx context.Context, now time.Time) error {
+	lst, err := db.Schedules(s.root, s.dbname)
+	if err != nil {
+		return err
+	}
+	if s.next == nil {
+		s.next = make(map[string]time.Time)
+		s.crons = make(map[string]string)
+		s.running = make(map[string]bool)
+		s.done = make(chan string)
+	}
+	s.reap()
+	seen := make(map[string]bool, len(lst))
+	for _, q := range lst {
+		seen[q.Name] = true
+		c, err := db.ParseCron(q.Schedule)
+		if err != nil {
+			// already validated by db.Schedules
+			return err
+		}
+		next, ok := s.next[q.Name]
+		if !ok || s.crons[q.Name] != q.Schedule {
+			s.next[q.Name] = c.Next(now)
+			s.crons[q.Name] = q.Schedule
+			continue
+		}
+		if next.IsZero() || now.Before(next) {
+			continue
+		}
+		s.next[q.Name] = c.Next(now)
+		if s.running[q.Name] {
+			s.logf("scheduled query %s: skipping run at %s; previous run still in progress", q.Name, next.Format(time.RFC3339))
+			continue
+		}
+		s.running[q.Name] = true
+		go func(q *db.ScheduledQuery) {
+			r := s.exec(ctx, q)
+			if err := s.record(r); err != nil {
+				s.logf("scheduled query %s: recording run: %s", q.Name, err)
+			}
+			s.done <- q.Name
+		}(q)
+	}
+	for name := range s.next {
+		if !seen[name] {
+			delete(s.next, name)
+			delete(s.crons, name)
+		}
+	}
+	return nil
+}
+
+// reap collects the runs that have completed
+func (s *scheduler) reap() {
+	for {
+		select {
+		case name := <-s.done:
+			delete(s.running, name)
+		default:
+			return
+		}
+	}
+}
+
+// wait waits for all of the
+// runs in progress to complete
+func (s *scheduler) wait() {
+	for len(s.running) > 0 {
+		delete(s.running, <-s.done)
+	}
+}
+
+// exec runs q and delivers its results
+func (s *scheduler) exec(ctx context.Context, q *db.ScheduledQuery) *run {
+	r := &run{query: q, start: time.Now()}
+	r.err = s.deliver(ctx, q, &r.stats)
+	r.duration = time.Since(r.start)
+	if r.err != nil {
+		s.logf("scheduled query %s failed after %s: %s", q.Name, r.duration, r.err)
+	} else if dashv {
+		s.logf("scheduled query %s completed in %s", q.Name, r.duration)
+	}
+	return r
+}
+
+func (s *scheduler) deliver(ctx context.Context, q *db.ScheduledQuery, stats *plan.ExecStats) error {
+	text, err := s.queryText(q)
+	if err != nil {
+		return err
+	}
+	rows, err := s.client.Query(ctx, s.dbname, text)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if q.Webhook != "" {
+		err = s.post(ctx, q.Webhook, rows)
+	} else {
+		for rows.Next() {
+		}
+		err = rows.Err()
+	}
+	if err != nil {
+		return err
+	}
+	*stats = *rows.Stats()
+	return nil
+}
+
+// queryText returns the text of the query to run for q;
+// if q has a table, the query is rewritten to append
+// its results to the table (or to create the table
+// if it does not exist yet)
+func (s *scheduler) queryText(q *db.ScheduledQuery) (string, error) {
+	if q.Table == "" {
+		return q.Query, nil
+	}
+	parsed, err := partiql.Parse([]byte(q.Query))
+	if err != nil {
+		return "", err
+	}
+	if parsed.Into != nil || parsed.Explain != expr.ExplainNone {
+		return "", fmt.Errorf("a query with a table cannot use INTO or EXPLAIN")
+	}
+	parsed.Into = &expr.Path{First: s.dbname, Rest: &expr.Dot{Field: q.Table}}
+	parsed.IntoMode = expr.IntoInsert
+	_, err = fs.Stat(s.root, db.IndexPath(s.dbname, q.Table))
+	if errors.Is(err, fs.ErrNotExist) {
+		parsed.IntoMode = expr.IntoCreate
+	} else if err != nil {
+		return "", err
+	}
+	return parsed.Text(), nil
+}
+
+// post POSTs rows to url as NDJSON
+func (s *scheduler) post(ctx context.Context, url string, rows *client.Rows) error {
+	pr, pw := io.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		err := writeNDJSON(pw, rows)
+		pw.CloseWithError(err)
+		errc <- err
+	}()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, pr)
+	if err == nil {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		hc := s.hooks
+		if hc == nil {
+			hc = http.DefaultClient
+		}
+		var res *http.Response
+		res, err = hc.Do(req)
+		if err == nil {
+			defer res.Body.Close()
+			if res.StatusCode/100 != 2 {
+				text, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+				err = fmt.Errorf("webhook: %s %s", res.Status, strings.TrimSpace(string(text)))
+			}
+		}
+	}
+	// unblock the writer if the
+	// body was not consumed
+	pr.Close()
+	if werr := <-errc; werr != nil && !errors.Is(werr, io.ErrClosedPipe) {
+		// the query failed
+		return werr
+	}
+	return err
+}
+
+// writeNDJSON writes each row as a line of JSON
+func writeNDJSON(w io.Writer, rows *client.Rows) error {
+	var st ion.Symtab
+	var row, buf ion.Buffer
+	var rd bufio.Reader
+	bw := bufio.NewWriter(w)
+	for rows.Next() {
+		d, err := rows.Datum()
+		if err != nil {
+			return err
+		}
+		st.Reset()
+		row.Reset()
+		buf.Reset()
+		d.Encode(&row, &st)
+		st.Marshal(&buf, true)
+		buf.UnsafeAppend(row.Bytes())
+		rd.Reset(bytes.NewReader(buf.Bytes()))
+		_, err = ion.ToJSON(bw, &rd)
+		if err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// record appends r to the schedule history table
+func (s *scheduler) record(r *run) error {
+	var st ion.Symtab
+	var row, buf ion.Buffer
+	row.BeginStruct(-1)
+	row.BeginField(st.Intern("name"))
+	row.WriteString(r.query.Name)
+	row.BeginField(st.Intern("query"))
+	row.WriteString(r.query.Query)
+	row.BeginField(st.Intern("start"))
+	row.WriteTime(date.FromTime(r.start))
+	row.BeginField(st.Intern("duration"))
+	row.WriteInt(int64(r.duration))
+	row.BeginField(st.Intern("success"))
+	row.WriteBool(r.err == nil)
+	if r.err != nil {
+		row.BeginField(st.Intern("error"))
+		row.WriteString(r.err.Error())
+	}
+	row.BeginField(st.Intern("stats"))
+	r.stats.Encode(&row, &st)
+	row.EndStruct()
+	st.Marshal(&buf, true)
+	buf.UnsafeAppend(row.Bytes())
+
+	b := db.Builder{
+		Align:        1024 * 1024,
+		GCMinimumAge: 5 * time.Minute,
+	}
+	if dashv {
+		b.Logf = s.logf
+	}
+	for {
+		err := b.InsertRows(s.owner, s.dbname, db.ScheduleHistoryTable,
+			bytes.NewReader(buf.Bytes()), blockfmt.UnsafeION())
+		if !errors.Is(err, db.ErrBuildAgain) {
+			return err
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// entry point for 'sdb scheduler ...'
+func runScheduler(dbname string) {
+	creds := creds()
+	s := &scheduler{
+		owner:  creds,
+		root:   root(creds),
+		dbname: dbname,
+		client: &client.Client{
+			Endpoint: snellerEndpoint(),
+			Token:    activeToken(),
+		},
+		logf: logf,
+	}
+	ctx := context.Background()
+	for {
+		now := time.Now()
+		if err := s.tick(ctx, now); err != nil {
+			logf("loading scheduled queries: %s", err)
+		}
+		// wake up at the start of the next minute
+		time.Sleep(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SnellerInc/sneller/client"
+	"github.com/SnellerInc/sneller/db"
+	"github.com/SnellerInc/sneller/ion"
+	"github.com/SnellerInc/sneller/ion/blockfmt"
+)
+
+// fakeResults returns a result stream in
+// the format written by snellerd
+func fakeResults() []byte {
+	var st ion.Symtab
+	var body, out ion.Buffer
+	for i := 0; i < 2; i++ {
+		ion.NewStruct(&st, []ion.Field{{Label: "x", Value: ion.Int(int64(i))}}).Encode(&body, &st)
+	}
+	body.BeginAnnotation(1)
+	body.BeginField(st.Intern("final_status"))
+	ion.NewStruct(&st, []ion.Field{{Label: "scanned", Value: ion.Int(1000)}}).Encode(&body, &st)
+	body.EndAnnotation()
+	st.Marshal(&out, true)
+	return append(out.Bytes(), body.Bytes()...)
+}
+
+// history returns the rows of the schedule history table
+func history(t *testing.T, owner db.Tenant) []ion.Datum {
+	root, err := owner.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := db.OpenIndex(root, "default", db.ScheduleHistoryTable, owner.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []ion.Datum
+	for i := range idx.Inline {
+		f, err := root.Open(idx.Inline[i].Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var d blockfmt.Decoder
+		var buf bytes.Buffer
+		trailer := idx.Inline[i].Trailer
+		d.Set(trailer, len(trailer.Blocks))
+		_, err = d.Copy(&buf, io.LimitReader(f, trailer.Offset))
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var st ion.Symtab
+		rest := buf.Bytes()
+		for len(rest) > 0 {
+			var row ion.Datum
+			row, rest, err = ion.ReadDatum(&st, rest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !row.Null() {
+				out = append(out, row)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, _ := out[i].Field("name").String()
+		b, _ := out[j].Field("name").String()
+		return a < b
+	})
+	return out
+}
+
+func TestScheduler(t *testing.T) {
+	// (main declares a function called sync,
+	// so a channel serves as the mutex)
+	lock := make(chan struct{}, 1)
+	var queries []string
+	var posted string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/executeQuery":
+			lock <- struct{}{}
+			queries = append(queries, string(body))
+			<-lock
+			if strings.Contains(string(body), "missing") {
+				http.Error(w, "table not found", http.StatusBadRequest)
+				return
+			}
+			w.Write(fakeResults())
+		case "/hook":
+			if r.Header.Get("Content-Type") != "application/x-ndjson" {
+				t.Errorf("unexpected content type %q", r.Header.Get("Content-Type"))
+			}
+			lock <- struct{}{}
+			posted = string(body)
+			<-lock
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	owner := db.NewLocalTenantFromPath(dir)
+	root, err := owner.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []*db.ScheduledQuery{{
+		Name:     "counts",
+		Schedule: "*/15 * * * *",
+		Query:    "SELECT COUNT(*) FROM t",
+		Table:    "counts",
+	}, {
+		Name:     "hook",
+		Schedule: "*/15 * * * *",
+		Query:    "SELECT x FROM t",
+		Webhook:  srv.URL + "/hook",
+	}, {
+		Name:     "missing",
+		Schedule: "@daily",
+		Query:    "SELECT * FROM missing",
+	}} {
+		if err := db.WriteSchedule(root.(db.OutputFS), "default", q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := &scheduler{
+		owner:  owner,
+		root:   root,
+		dbname: "default",
+		client: &client.Client{Endpoint: srv.URL},
+		logf:   t.Logf,
+	}
+	start := time.Date(2022, 3, 4, 23, 50, 0, 0, time.UTC)
+	ctx := context.Background()
+	// the first tick only computes
+	// the next run of each query
+	if err := s.tick(ctx, start); err != nil {
+		t.Fatal(err)
+	}
+	s.wait()
+	if len(queries) != 0 {
+		t.Fatalf("unexpected queries %q", queries)
+	}
+	if err := s.tick(ctx, start.Add(5*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	s.wait()
+	if err := s.tick(ctx, start.Add(10*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	s.wait()
+	if err := s.tick(ctx, start.Add(11*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	s.wait()
+
+	sort.Strings(queries)
+	want := []string{
+		"CREATE TABLE default.counts AS SELECT COUNT(*) FROM t",
+		"SELECT * FROM missing",
+		"SELECT x FROM t",
+	}
+	if strings.Join(queries, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got queries %q", queries)
+	}
+	if posted != "{\"x\": 0}\n{\"x\": 1}\n" {
+		t.Errorf("got webhook body %q", posted)
+	}
+
+	rows := history(t, owner)
+	if len(rows) != 3 {
+		t.Fatalf("got %d history rows", len(rows))
+	}
+	for i, name := range []string{"counts", "hook", "missing"} {
+		row := rows[i]
+		got, _ := row.Field("name").String()
+		ok, _ := row.Field("success").Bool()
+		scanned, _ := row.Field("stats").Field("scanned").Uint()
+		if got != name {
+			t.Errorf("row %d: name %q", i, got)
+		}
+		if name == "missing" {
+			msg, _ := row.Field("error").String()
+			if ok || !strings.Contains(msg, "table not found") {
+				t.Errorf("row %d: success %v, error %q", i, ok, msg)
+			}
+			continue
+		}
+		if !ok || scanned != 1000 {
+			t.Errorf("row %d: success %v, scanned %d", i, ok, scanned)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/SnellerInc/sneller/db"
+	"github.com/SnellerInc/sneller/ion"
+	"github.com/SnellerInc/sneller/plan"
+)
+
+// keywords are the keywords
+// offered for completion
+var keywords = []string{
+	"SELECT", "FROM", "WHERE", "GROUP", "BY", "HAVING", "ORDER",
+	"LIMIT", "OFFSET", "AS", "AND", "OR", "NOT", "IN", "IS", "NULL",
+	"MISSING", "LIKE", "ILIKE", "BETWEEN", "CASE", "WHEN", "THEN",
+	"ELSE", "END", "DISTINCT", "COUNT", "SUM", "MIN", "MAX", "AVG",
+	"UNION", "ALL", "WITH", "ASC", "DESC", "CAST", "COALESCE",
+	"EXPLAIN", "UTCNOW", "DATE_TRUNC", "SYSTEM_DATASHAPE",
+}
+
+// completer produces completions for
+// keywords, databases, tables and the
+// field paths of tables
+type completer struct {
+	env    plan.Env
+	root   fs.FS  // nil if there are no databases
+	dbname string // the default database
+
+	// context is the text of the
+	// statement entered so far, which
+	// determines the tables for which
+	// fields are completed
+	context string
+
+	dbs    []string
+	tables map[string][]string // db -> tables
+	fields map[string][]string // db.table -> field paths
+}
+
+func newCompleter(env plan.Env, root fs.FS, dbname string) *completer {
+	return &completer{
+		env:    env,
+		root:   root,
+		dbname: dbname,
+		tables: make(map[string][]string),
+		fields: make(map[string][]string),
+	}
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '.' || c == '$' || c == '"' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// complete implements lineEditor.complete
+func (c *completer) complete(line string, pos int) (int, []string) {
+	start := pos
+	for start > 0 && isWordChar(line[start-1]) {
+		start--
+	}
+	word := line[start:pos]
+	var out []string
+	add := func(candidate string) {
+		if len(candidate) >= len(word) && strings.EqualFold(candidate[:len(word)], word) {
+			out = append(out, candidate)
+		}
+	}
+	if dot := strings.LastIndexByte(word, '.'); dot >= 0 {
+		prefix := word[:dot]
+		if c.isDatabase(prefix) {
+			for _, t := range c.tablesOf(prefix) {
+				add(prefix + "." + t)
+			}
+		}
+		// the prefix may be a table, an
+		// alias or part of a field path
+		for _, f := range c.contextFields(line[:pos]) {
+			add(prefix + "." + f)
+			add(f)
+		}
+	} else {
+		for _, k := range keywords {
+			add(k)
+		}
+		for _, d := range c.databases() {
+			add(d)
+		}
+		if c.dbname != "" {
+			for _, t := range c.tablesOf(c.dbname) {
+				add(t)
+			}
+		}
+		for _, f := range c.contextFields(line[:pos]) {
+			add(f)
+		}
+	}
+	sort.Strings(out)
+	out = dedup(out)
+	return start, out
+}
+
+func dedup(lst []string) []string {
+	if len(lst) == 0 {
+		return lst
+	}
+	out := lst[:1]
+	for _, s := range lst[1:] {
+		if s != out[len(out)-1] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func (c *completer) databases() []string {
+	if c.root == nil {
+		return nil
+	}
+	if c.dbs == nil {
+		c.dbs, _ = db.List(c.root)
+		if c.dbs == nil {
+			c.dbs = []string{}
+		}
+	}
+	return c.dbs
+}
+
+func (c *completer) isDatabase(name string) bool {
+	for _, d := range c.databases() {
+		if d == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *completer) tablesOf(dbname string) []string {
+	if c.root == nil {
+		return nil
+	}
+	lst, ok := c.tables[dbname]
+	if !ok {
+		lst, _ = db.Tables(c.root, dbname)
+		c.tables[dbname] = lst
+	}
+	return lst
+}
+
+// contextFields returns the field paths of the
+// tables that are referenced in the statement
+func (c *completer) contextFields(line string) []string {
+	text := c.context + " " + line
+	var out []string
+	seen := make(map[string]bool)
+	visit := func(dbname, table string) {
+		key := dbname + "." + table
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, c.fieldsOf(dbname, table)...)
+		}
+	}
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool {
+		return r > 127 || !isWordChar(byte(r)) || r == '"'
+	}) {
+		dbname, table, ok := strings.Cut(word, ".")
+		if ok && c.isDatabase(dbname) {
+			if contains(c.tablesOf(dbname), table) {
+				visit(dbname, table)
+			}
+			continue
+		}
+		if c.dbname != "" && contains(c.tablesOf(c.dbname), word) {
+			visit(c.dbname, word)
+		}
+	}
+	return out
+}
+
+func contains(lst []string, s string) bool {
+	for i := range lst {
+		if lst[i] == s {
+			return true
+		}
+	}
+	return false
+}
+
+// shapeSample is the number of rows
+// used to compute the shape of a table
+// that has no shape recorded at ingest
+const shapeSample = 1000
+
+// fieldsOf returns the field paths of a table,
+// using the shape recorded when the table was
+// ingested if there is one or else the result of
+// SYSTEM_DATASHAPE(*) over a sample of its rows
+func (c *completer) fieldsOf(dbname, table string) []string {
+	key := dbname + "." + table
+	if lst, ok := c.fields[key]; ok {
+		return lst
+	}
+	var lst []string
+	if shape, err := db.OpenShape(c.root, dbname, table); err == nil {
+		for path := range shape.Fields {
+			lst = append(lst, path)
+		}
+	} else {
+		lst = c.datashape(dbname, table)
+	}
+	out := lst[:0]
+	for _, path := range lst {
+		if !strings.Contains(path, "$items") {
+			out = append(out, path)
+		}
+	}
+	sort.Strings(out)
+	c.fields[key] = out
+	return out
+}
+
+func (c *completer) datashape(dbname, table string) []string {
+	text := fmt.Sprintf("SELECT SYSTEM_DATASHAPE(*) FROM (SELECT * FROM %q.%q LIMIT %d)", dbname, table, shapeSample)
+	q, err := compile([]byte(text))
+	if err != nil {
+		return nil
+	}
+	tree, err := plan.New(q, c.env)
+	if err != nil {
+		return nil
+	}
+	var out bytes.Buffer
+	var stats plan.ExecStats
+	if err := plan.Exec(tree, &out, &stats); err != nil {
+		return nil
+	}
+	var st ion.Symtab
+	var lst []string
+	buf := out.Bytes()
+	for len(buf) > 0 {
+		if ion.IsBVM(buf) || ion.TypeOf(buf) == ion.AnnotationType {
+			buf, err = st.Unmarshal(buf)
+			if err != nil {
+				return nil
+			}
+			continue
+		}
+		var d ion.Datum
+		d, buf, err = ion.ReadDatum(&st, buf)
+		if err != nil {
+			return nil
+		}
+		fields, _ := d.Field("fields").Struct()
+		fields.Each(func(f ion.Field) bool {
+			lst = append(lst, f.Label)
+			return true
+		})
+	}
+	return lst
+}
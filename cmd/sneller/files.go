@@ -0,0 +1,452 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/SnellerInc/sneller/date"
+	"github.com/SnellerInc/sneller/ion/blockfmt"
+	"github.com/SnellerInc/sneller/vm"
+	"github.com/SnellerInc/sneller/xsv"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/exp/slices"
+)
+
+// filesDir is the directory within
+// cachedir that holds converted files
+const filesDir = "sneller-files"
+
+// bump this when the output of
+// the conversion changes so that
+// old cache entries are not used
+const filesVersion = 2
+
+// inferRows is the number of rows sampled
+// from each file to pick the types of CSV
+// and TSV columns when no hints are provided
+const inferRows = 100
+
+// formatOf returns the longest suffix of name
+// that appears in blockfmt.SuffixToFormat,
+// or the empty string if there isn't one
+func formatOf(name string) string {
+	suffix := ""
+	for s := range blockfmt.SuffixToFormat {
+		if len(s) > len(suffix) && strings.HasSuffix(name, s) {
+			suffix = s
+		}
+	}
+	return suffix
+}
+
+// isConverted returns true if the table
+// expression fname should be read with
+// fileTable rather than as a packed file
+func isConverted(fname string) bool {
+	if strings.ContainsAny(fname, "*?[") || formatOf(fname) != "" {
+		return true
+	}
+	info, err := os.Stat(fname)
+	return err == nil && info.IsDir()
+}
+
+// matchFiles returns the files matched
+// by pattern in lexical order; directories
+// are searched recursively for files
+// in a known format
+func matchFiles(pattern string) ([]string, error) {
+	lst, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, name := range lst {
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			out = append(out, name)
+			continue
+		}
+		err = filepath.WalkDir(name, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && formatOf(p) != "" {
+				out = append(out, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%s: no matching files", pattern)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// fileTable returns a table containing the
+// rows of the files matching pattern, which are
+// converted to the packed format on first use
+// and cached in cachedir
+func fileTable(pattern string, hints []byte, fields []string) (vm.Table, error) {
+	files, err := matchFiles(pattern)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]fs.FileInfo, len(files))
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n%s\n", filesVersion, hints)
+	for i, name := range files {
+		infos[i], err = os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		abs, err := filepath.Abs(name)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(h, "%s\n%d\n%d\n", abs, infos[i].Size(), infos[i].ModTime().UnixNano())
+	}
+	out := path.Join(filesDir, hex.EncodeToString(h.Sum(nil))[:32]+".zion")
+	dir := blockfmt.NewDirFS(cachedir)
+	if _, err := fs.Stat(dir, out); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		err = convertFiles(dir, out, files, infos, hints)
+		if err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.Open(filepath.Join(cachedir, out))
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return srcTable(f, info.Size(), fields)
+}
+
+// convertFiles converts files into
+// a single packed object at out
+func convertFiles(dir *blockfmt.DirFS, out string, files []string, infos []fs.FileInfo, hints []byte) error {
+	if hints != nil {
+		return convert(dir, out, files, infos, func(string) []byte { return hints })
+	}
+	inferred, err := inferHints(files, inferRows)
+	if err != nil {
+		return err
+	}
+	err = convert(dir, out, files, infos, func(name string) []byte { return inferred[name] })
+	if err == nil || len(inferred) == 0 {
+		return err
+	}
+	// the sampled rows may not be representative
+	// of the rest, so pick the types from every row
+	// and try again; the converters accept every
+	// value that inferHints accepts for a type,
+	// so this only fails for other reasons
+	inferred, err = inferHints(files, -1)
+	if err != nil {
+		return err
+	}
+	return convert(dir, out, files, infos, func(name string) []byte { return inferred[name] })
+}
+
+// convert converts files into a single packed
+// object at out using hints(name) as the hints
+// for each file
+func convert(dir *blockfmt.DirFS, out string, files []string, infos []fs.FileInfo, hints func(name string) []byte) error {
+	inputs := make([]blockfmt.Input, len(files))
+	for i, name := range files {
+		suffix := formatOf(name)
+		if suffix == "" {
+			return fmt.Errorf("%s: unknown file format", name)
+		}
+		f, err := blockfmt.SuffixToFormat[suffix](hints(name))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		inputs[i] = blockfmt.Input{
+			Path: name,
+			Size: infos[i].Size(),
+			R:    &lazyFile{name: name},
+			F:    f,
+		}
+	}
+	up, err := dir.Create(out)
+	if err != nil {
+		return err
+	}
+	const align = 1024 * 1024
+	c := blockfmt.Converter{
+		Inputs:    inputs,
+		Output:    up,
+		Comp:      "zstd",
+		Align:     align,
+		FlushMeta: align * 100,
+	}
+	err = c.Run()
+	if err != nil && !c.MultiStream() {
+		// multi-stream errors already
+		// include the input path
+		for i := range c.Inputs {
+			if c.Inputs[i].Err != nil {
+				return fmt.Errorf("%s: %w", c.Inputs[i].Path, err)
+			}
+		}
+	}
+	return err
+}
+
+// lazyFile is an io.ReadCloser that
+// opens a file on the first call to Read,
+// so that converting many files does not
+// require all of them to be open at once
+type lazyFile struct {
+	name string
+	f    *os.File
+}
+
+func (l *lazyFile) Read(p []byte) (int, error) {
+	if l.f == nil {
+		f, err := os.Open(l.name)
+		if err != nil {
+			return 0, err
+		}
+		l.f = f
+	}
+	return l.f.Read(p)
+}
+
+func (l *lazyFile) Close() error {
+	if l.f == nil {
+		return nil
+	}
+	return l.f.Close()
+}
+
+// isXSV returns true if files with
+// the format suffix are CSV or TSV files
+func isXSV(suffix string) bool {
+	return strings.HasPrefix(suffix, ".csv") || strings.HasPrefix(suffix, ".tsv")
+}
+
+// inferHints produces hints for the CSV and TSV
+// files in files from their header rows, keyed by
+// file name. The type of each column is picked once
+// for all of the files with the same format and
+// header, from the first rows of each file, or
+// from every row if rows is negative.
+func inferHints(files []string, rows int) (map[string][]byte, error) {
+	type group struct {
+		header, types []string
+		files         []string
+	}
+	var groups []*group
+	byKey := make(map[string]*group)
+	for _, name := range files {
+		suffix := formatOf(name)
+		if !isXSV(suffix) {
+			continue
+		}
+		header, types, err := sample(name, suffix, rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: inferring hints (use -hints to provide them): %w", name, err)
+		}
+		key := suffix[:len(".csv")] + "\x00" + strings.Join(header, "\x00")
+		g := byKey[key]
+		if g == nil {
+			g = &group{header: header, types: types}
+			byKey[key] = g
+			groups = append(groups, g)
+		} else {
+			for i := range types {
+				g.types[i] = merge(g.types[i], types[i])
+			}
+		}
+		g.files = append(g.files, name)
+	}
+	out := make(map[string][]byte)
+	for _, g := range groups {
+		hint := xsv.Hint{SkipRecords: 1}
+		for i := range g.header {
+			name := g.header[i]
+			if name == "" {
+				// columns without a name are
+				// named by their position
+				name = "_" + strconv.Itoa(i+1)
+			}
+			typ := g.types[i]
+			if typ == "" {
+				typ = xsv.TypeString
+			}
+			hint.Fields = append(hint.Fields, xsv.FieldHint{
+				Name: name,
+				Type: typ,
+			})
+		}
+		buf, err := json.Marshal(&hint)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range g.files {
+			out[name] = buf
+		}
+	}
+	return out, nil
+}
+
+// sample reads the header row of a CSV or TSV
+// file and picks the type of each column from
+// up to rows rows, or from every row if rows is
+// negative; the type of columns without any
+// values is the empty string
+func sample(name, suffix string, rows int) (header, types []string, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	switch {
+	case strings.HasSuffix(suffix, ".gz"):
+		rz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer rz.Close()
+		r = rz
+	case strings.HasSuffix(suffix, ".zst"):
+		rz, err := zstd.NewReader(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer rz.Close()
+		r = rz
+	}
+	var ch xsv.RowChopper
+	if strings.HasPrefix(suffix, ".csv") {
+		ch = &xsv.CsvChopper{}
+	} else {
+		ch = &xsv.TsvChopper{}
+	}
+	header, err = ch.GetNext(r)
+	if err != nil {
+		if err == io.EOF {
+			err = errors.New("missing header row")
+		}
+		return nil, nil, err
+	}
+	// the chopper re-uses the returned slice
+	header = slices.Clone(header)
+	types = make([]string, len(header))
+	for i := 0; rows < 0 || i < rows; i++ {
+		row, err := ch.GetNext(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		for j := range row {
+			if j < len(types) && row[j] != "" {
+				types[j] = widen(types[j], row[j])
+			}
+		}
+	}
+	return header, types, nil
+}
+
+// merge returns the narrowest column type
+// that can represent values of both types
+func merge(a, b string) string {
+	switch {
+	case a == "" || a == b:
+		return b
+	case b == "":
+		return a
+	case a == xsv.TypeInt && b == xsv.TypeNumber,
+		a == xsv.TypeNumber && b == xsv.TypeInt:
+		return xsv.TypeNumber
+	}
+	return xsv.TypeString
+}
+
+// widen returns the narrowest column type
+// that can represent both values of type
+// typ and the value text
+func widen(typ, text string) string {
+	is := func(t string) bool {
+		switch t {
+		case xsv.TypeInt:
+			_, err := strconv.ParseInt(text, 10, 64)
+			return err == nil
+		case xsv.TypeNumber:
+			_, err := strconv.ParseFloat(text, 64)
+			return err == nil
+		case xsv.TypeBool:
+			_, err := strconv.ParseBool(text)
+			return err == nil
+		case xsv.TypeDateTime:
+			_, ok := date.Parse([]byte(text))
+			return ok
+		}
+		return false
+	}
+	switch typ {
+	case "":
+		for _, t := range []string{xsv.TypeInt, xsv.TypeNumber, xsv.TypeBool, xsv.TypeDateTime} {
+			if is(t) {
+				return t
+			}
+		}
+	case xsv.TypeInt:
+		if is(xsv.TypeInt) {
+			return typ
+		}
+		if is(xsv.TypeNumber) {
+			return xsv.TypeNumber
+		}
+	case xsv.TypeNumber, xsv.TypeBool, xsv.TypeDateTime:
+		if is(typ) {
+			return typ
+		}
+	}
+	return xsv.TypeString
+}
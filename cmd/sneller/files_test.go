@@ -0,0 +1,184 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SnellerInc/sneller/xsv"
+)
+
+func TestInferHints(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "x.csv")
+	text := "s,i,f,b,t,\n" +
+		"x,1,1,true,2022-01-02T03:04:05Z,a\n" +
+		"\"y,z\",-3,2.5,false,2022-01-03T03:04:05Z,\n" +
+		"1,,1e3,,,b\n"
+	if err := os.WriteFile(name, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hints, err := inferHints([]string{name}, inferRows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := xsv.ParseHint(hints[name])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.SkipRecords != 1 {
+		t.Errorf("SkipRecords = %d", h.SkipRecords)
+	}
+	var got [][2]string
+	for i := range h.Fields {
+		got = append(got, [2]string{h.Fields[i].Name, h.Fields[i].Type})
+	}
+	want := [][2]string{
+		{"s", "string"},
+		{"i", "int"},
+		{"f", "number"},
+		{"b", "bool"},
+		{"t", "datetime"},
+		{"_6", "string"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestInferHintsFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, text string) string {
+		name = filepath.Join(dir, name)
+		if err := os.WriteFile(name, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return name
+	}
+	a := write("a.csv", "x,y\n1,2\n")
+	b := write("b.csv", "x,y\n1.5,\n")
+	c := write("c.csv", "y,x\n1,2\n")
+	// the last value is not sampled
+	d := write("d.tsv", "x\n"+strings.Repeat("1\n", inferRows)+"yes\n")
+	e := write("e.json", "{}")
+	types := func(hints map[string][]byte, name string) []string {
+		h, err := xsv.ParseHint(hints[name])
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for i := range h.Fields {
+			out = append(out, h.Fields[i].Type)
+		}
+		return out
+	}
+	files := []string{a, b, c, d, e}
+	hints, err := inferHints(files, inferRows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hints) != 4 {
+		t.Errorf("got hints for %d files", len(hints))
+	}
+	runs := []struct {
+		name string
+		want []string
+	}{
+		// a and b share a header,
+		// so their types are merged
+		{a, []string{"number", "int"}},
+		{b, []string{"number", "int"}},
+		{c, []string{"int", "int"}},
+		{d, []string{"int"}},
+	}
+	for i := range runs {
+		if got := types(hints, runs[i].name); !reflect.DeepEqual(got, runs[i].want) {
+			t.Errorf("%s: got %v, want %v", runs[i].name, got, runs[i].want)
+		}
+	}
+	hints, err = inferHints(files, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := types(hints, d); !reflect.DeepEqual(got, []string{"string"}) {
+		t.Errorf("all rows: got %v", got)
+	}
+}
+
+func TestFileTable(t *testing.T) {
+	cachedir = t.TempDir()
+	dir := t.TempDir()
+	write := func(name, text string) {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.csv", "x,y\n1,foo\n2,bar\n")
+	write("b.json", `{"x": 3, "y": "baz"}`)
+	write("c.txt", "not a known format")
+
+	files, err := matchFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || filepath.Base(files[0]) != "a.csv" || filepath.Base(files[1]) != "b.json" {
+		t.Fatalf("matched %v", files)
+	}
+	cached := func() []string {
+		lst, _ := filepath.Glob(filepath.Join(cachedir, filesDir, "*"))
+		return lst
+	}
+	for _, pattern := range []string{dir, dir, filepath.Join(dir, "*.csv")} {
+		tbl, err := fileTable(pattern, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tbl.(*readerTable).clo.Close()
+	}
+	// the second query re-used the
+	// result of the first conversion
+	if lst := cached(); len(lst) != 2 {
+		t.Fatalf("cache contains %v", lst)
+	}
+	write("a.csv", "x,y\n1,foo\n2,bar\n3,qux\n")
+	tbl, err := fileTable(dir, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbl.(*readerTable).clo.Close()
+	if lst := cached(); len(lst) != 3 {
+		t.Fatalf("cache contains %v", lst)
+	}
+	if _, err := fileTable(filepath.Join(dir, "*.parquet"), nil, nil); err == nil {
+		t.Error("expected an error for a pattern without matches")
+	}
+	if !isConverted("x.parquet") {
+		t.Error("parquet files are not converted")
+	}
+	// a value that doesn't match the type picked
+	// from the sampled rows causes the types to
+	// be picked from every row instead
+	write("d.csv", "x,y\n"+strings.Repeat("1,2\n", inferRows)+"1,two\n")
+	tbl, err = fileTable(filepath.Join(dir, "d.csv"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbl.(*readerTable).clo.Close()
+}
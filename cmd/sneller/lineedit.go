@@ -0,0 +1,326 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// errInterrupted is returned by
+// lineEditor.readLine when the user
+// presses Ctrl-C
+var errInterrupted = errors.New("interrupted")
+
+// maxHistory is the maximum number
+// of history entries that are kept
+const maxHistory = 1000
+
+// lineEditor reads lines from a terminal
+// in raw mode, supporting the usual emacs-style
+// editing keys, history and tab completion
+type lineEditor struct {
+	in  *bufio.Reader
+	out *bufio.Writer
+
+	// history holds previous entries,
+	// from oldest to newest
+	history []string
+	// complete, if non-nil, returns the position
+	// in line at which the word being completed
+	// begins and the candidate replacements
+	// for that word
+	complete func(line string, pos int) (int, []string)
+
+	prompt string
+	buf    []rune
+	pos    int
+	// hist is the index in history of the
+	// entry being edited; saved holds the new
+	// line while history is being browsed
+	hist  int
+	saved []rune
+}
+
+func newLineEditor(in io.Reader, out io.Writer) *lineEditor {
+	return &lineEditor{
+		in:  bufio.NewReader(in),
+		out: bufio.NewWriter(out),
+	}
+}
+
+// addHistory adds a line to the history
+func (e *lineEditor) addHistory(line string) {
+	if line == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+}
+
+// readLine reads one line using prompt.
+// It returns io.EOF if the user presses
+// Ctrl-D on an empty line and errInterrupted
+// if the user presses Ctrl-C.
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	e.prompt = prompt
+	e.buf = e.buf[:0]
+	e.pos = 0
+	e.hist = len(e.history)
+	e.saved = nil
+	e.refresh()
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			e.pos = len(e.buf)
+			e.refresh()
+			e.out.WriteString("\r\n")
+			e.out.Flush()
+			return string(e.buf), nil
+		case ctrl('C'):
+			e.out.WriteString("^C\r\n")
+			e.out.Flush()
+			return "", errInterrupted
+		case ctrl('D'):
+			if len(e.buf) == 0 {
+				e.out.WriteString("\r\n")
+				e.out.Flush()
+				return "", io.EOF
+			}
+			e.delete(e.pos, e.pos+1)
+		case ctrl('A'):
+			e.pos = 0
+		case ctrl('E'):
+			e.pos = len(e.buf)
+		case ctrl('B'):
+			e.move(-1)
+		case ctrl('F'):
+			e.move(1)
+		case ctrl('H'), 127:
+			e.delete(e.pos-1, e.pos)
+		case ctrl('K'):
+			e.delete(e.pos, len(e.buf))
+		case ctrl('U'):
+			e.delete(0, e.pos)
+		case ctrl('W'):
+			e.delete(e.wordStart(), e.pos)
+		case ctrl('L'):
+			e.out.WriteString("\x1b[H\x1b[2J")
+		case ctrl('P'):
+			e.browse(-1)
+		case ctrl('N'):
+			e.browse(1)
+		case '\t':
+			e.tab()
+		case 27:
+			e.escape()
+		default:
+			if unicode.IsPrint(r) {
+				e.insert([]rune{r})
+			}
+		}
+		e.refresh()
+	}
+}
+
+func ctrl(c rune) rune { return c & 0x1f }
+
+// escape handles an escape sequence
+func (e *lineEditor) escape() {
+	r, _, err := e.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return
+	}
+	r, _, err = e.in.ReadRune()
+	if err != nil {
+		return
+	}
+	if r >= '0' && r <= '9' {
+		// ESC [ n ~
+		var n rune
+		for ; r >= '0' && r <= '9' && err == nil; r, _, err = e.in.ReadRune() {
+			n = n*10 + r - '0'
+		}
+		switch n {
+		case 1, 7:
+			e.pos = 0
+		case 3:
+			e.delete(e.pos, e.pos+1)
+		case 4, 8:
+			e.pos = len(e.buf)
+		}
+		return
+	}
+	switch r {
+	case 'A':
+		e.browse(-1)
+	case 'B':
+		e.browse(1)
+	case 'C':
+		e.move(1)
+	case 'D':
+		e.move(-1)
+	case 'H':
+		e.pos = 0
+	case 'F':
+		e.pos = len(e.buf)
+	}
+}
+
+func (e *lineEditor) move(n int) {
+	e.pos += n
+	if e.pos < 0 {
+		e.pos = 0
+	} else if e.pos > len(e.buf) {
+		e.pos = len(e.buf)
+	}
+}
+
+func (e *lineEditor) insert(r []rune) {
+	tail := make([]rune, 0, len(r)+len(e.buf)-e.pos)
+	tail = append(tail, r...)
+	tail = append(tail, e.buf[e.pos:]...)
+	e.buf = append(e.buf[:e.pos], tail...)
+	e.pos += len(r)
+}
+
+// delete removes the runes in [from, to)
+func (e *lineEditor) delete(from, to int) {
+	if from < 0 {
+		from = 0
+	}
+	if to > len(e.buf) {
+		to = len(e.buf)
+	}
+	if from >= to {
+		return
+	}
+	e.buf = append(e.buf[:from], e.buf[to:]...)
+	if e.pos > to {
+		e.pos -= to - from
+	} else if e.pos > from {
+		e.pos = from
+	}
+}
+
+// wordStart returns the position of the
+// start of the word preceding the cursor
+func (e *lineEditor) wordStart() int {
+	i := e.pos
+	for i > 0 && unicode.IsSpace(e.buf[i-1]) {
+		i--
+	}
+	for i > 0 && !unicode.IsSpace(e.buf[i-1]) {
+		i--
+	}
+	return i
+}
+
+// browse moves through the history by n entries
+func (e *lineEditor) browse(n int) {
+	i := e.hist + n
+	if i < 0 || i > len(e.history) {
+		return
+	}
+	if e.hist == len(e.history) {
+		e.saved = append(e.saved[:0], e.buf...)
+	}
+	e.hist = i
+	if i == len(e.history) {
+		e.buf = append(e.buf[:0], e.saved...)
+	} else {
+		e.buf = append(e.buf[:0], []rune(e.history[i])...)
+	}
+	e.pos = len(e.buf)
+}
+
+// tab performs completion at the cursor
+func (e *lineEditor) tab() {
+	if e.complete == nil {
+		return
+	}
+	line := string(e.buf[:e.pos])
+	start, candidates := e.complete(line, len(line))
+	if len(candidates) == 0 {
+		return
+	}
+	word := []rune(line[start:])
+	prefix := []rune(commonPrefix(candidates))
+	if len(prefix) > len(word) || len(candidates) == 1 {
+		e.delete(e.pos-len(word), e.pos)
+		e.insert(prefix)
+		return
+	}
+	// nothing more can be inserted,
+	// so display the alternatives
+	e.out.WriteString("\r\n")
+	printColumns(e.out, candidates, 80)
+}
+
+// commonPrefix returns the longest
+// common prefix of lst
+func commonPrefix(lst []string) string {
+	prefix := lst[0]
+	for _, s := range lst[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// printColumns prints lst in columns
+// that fit within the given width
+func printColumns(w *bufio.Writer, lst []string, width int) {
+	colwidth := 0
+	for _, s := range lst {
+		if n := len([]rune(s)) + 2; n > colwidth {
+			colwidth = n
+		}
+	}
+	cols := width / colwidth
+	if cols < 1 {
+		cols = 1
+	}
+	for i, s := range lst {
+		if (i+1)%cols == 0 || i == len(lst)-1 {
+			fmt.Fprintf(w, "%s\r\n", s)
+		} else {
+			fmt.Fprintf(w, "%-*s", colwidth, s)
+		}
+	}
+}
+
+// refresh redraws the current line
+func (e *lineEditor) refresh() {
+	e.out.WriteString("\r")
+	e.out.WriteString(e.prompt)
+	e.out.WriteString(string(e.buf))
+	e.out.WriteString("\x1b[K\r")
+	if n := len([]rune(e.prompt)) + e.pos; n > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dC", n)
+	}
+	e.out.Flush()
+}
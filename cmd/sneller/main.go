@@ -51,6 +51,8 @@ var (
 	dashg        bool
 	dashg2       bool
 	dashg3       bool
+	dashhints    string
+	dashi        bool
 	dasho        string
 	dashr        string
 	dashtoken    string
@@ -78,10 +80,12 @@ func init() {
 	flag.StringVar(&dashd, "d", "", "default database name (requires -auth, -r or -local)")
 	flag.BoolVar(&dashf, "f", false, "read arguments as files containing queries")
 	flag.BoolVar(&dashg, "g", false, "just dump the query plan graphviz; do not execute")
+	flag.BoolVar(&dashi, "i", false, "run queries interactively (the default if no queries are given and stdin is a terminal)")
 	flag.BoolVar(&dashg2, "g2", false, "just dump DFA of first regex graphviz; do not execute")
 	flag.BoolVar(&dashg3, "g3", false, "just dump data-structure of first regex; do not execute")
 	flag.BoolVar(&dashj, "j", false, "write output as JSON instead of ion")
 	flag.BoolVar(&dashN, "N", false, "interpret input as NDJSON")
+	flag.StringVar(&dashhints, "hints", "", "file containing ingest hints for converted files (CSV and TSV hints are inferred by default)")
 	flag.StringVar(&dasho, "o", "", "file for output (default is stdout)")
 	flag.StringVar(&dashr, "r", "", "root of database object storage (S3 only)")
 	flag.BoolVar(&printStats, "S", false, "print execution statistics on stderr")
@@ -168,6 +172,16 @@ func parse(arg string) *expr.Query {
 	} else {
 		buf = []byte(arg)
 	}
+	q, err := compile(buf)
+	if err != nil {
+		exit(err)
+	}
+	return q
+}
+
+// compile parses and checks a query,
+// underlining the location of syntax errors
+func compile(buf []byte) (*expr.Query, error) {
 	q, err := partiql.Parse(buf)
 	if err != nil {
 		var lexError *partiql.LexerError
@@ -180,15 +194,15 @@ func parse(arg string) *expr.Query {
 
 			underlineError(buf, position, length)
 		}
-		exit(err)
+		return nil, err
 	}
 
 	err = q.Check()
 	if err != nil {
-		exit(err)
+		return nil, err
 	}
 
-	return q
+	return q, nil
 }
 
 var newline = []byte{'\n'}
@@ -291,6 +305,24 @@ func mkenv() plan.Env {
 			return s3object(fname)
 		}
 		fname = expandUser(fname)
+		fields := h.Fields
+		if h.AllFields {
+			fields = nil
+		} else if fields == nil {
+			// len(fields)==0 but non-nil really means zero fields
+			fields = []string{}
+		}
+		if !dashN && isConverted(fname) {
+			var hints []byte
+			if dashhints != "" {
+				var err error
+				hints, err = os.ReadFile(expandUser(dashhints))
+				if err != nil {
+					return nil, err
+				}
+			}
+			return fileTable(fname, hints, fields)
+		}
 
 		f, err := os.Open(fname)
 		if err != nil {
@@ -303,13 +335,6 @@ func mkenv() plan.Env {
 		if dashN {
 			return &jstable{in: f, size: i.Size()}, nil
 		}
-		fields := h.Fields
-		if h.AllFields {
-			fields = nil
-		} else if fields == nil {
-			// len(fields)==0 but non-nil really means zero fields
-			fields = []string{}
-		}
 		return srcTable(f, i.Size(), fields)
 	})
 }
@@ -377,7 +402,9 @@ func printHelp() {
 		usagePlaceholder,
 		"Query options",
 		"N",
+		"hints",
 		"f",
+		"i",
 		"Output target",
 		"o",
 		"S",
@@ -424,7 +451,8 @@ func main() {
 	}
 
 	args := flag.Args()
-	if len(args) == 0 {
+	interactive := dashi || (len(args) == 0 && isTerminal(int(os.Stdin.Fd())))
+	if len(args) == 0 && !interactive {
 		flag.CommandLine.Usage()
 		os.Exit(1)
 	}
@@ -444,6 +472,22 @@ func main() {
 		dst = f
 		defer f.Close()
 	}
+	if interactive {
+		if len(args) > 0 {
+			exitf("-i cannot be used with queries given as arguments")
+		}
+		format := formatTable
+		if dashj {
+			format = formatJSON
+		}
+		err := runREPL(mkenv(), dst, format)
+		dst.Close()
+		if err != nil {
+			exit(err)
+		}
+		return
+	}
+
 	var bg sync.WaitGroup
 	if dashj {
 		// if we are writing as JSON, have
@@ -0,0 +1,195 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/SnellerInc/sneller/ion"
+)
+
+// table accumulates rows so that
+// they can be printed with aligned columns
+type table struct {
+	cols  []string
+	index map[string]int
+	rows  [][]string
+	// numeric[i] is true if every
+	// value in column i is a number
+	numeric []bool
+}
+
+// readTable reads the ion stream buf into
+// a table; the columns in cols come first,
+// followed by any other columns in order
+// of their first appearance
+func readTable(buf []byte, cols []string) (*table, error) {
+	t := &table{index: make(map[string]int)}
+	for _, c := range cols {
+		if _, ok := t.index[c]; !ok {
+			t.index[c] = len(t.cols)
+			t.cols = append(t.cols, c)
+			t.numeric = append(t.numeric, true)
+		}
+	}
+	var st ion.Symtab
+	var err error
+	for len(buf) > 0 {
+		if ion.IsBVM(buf) || ion.TypeOf(buf) == ion.AnnotationType {
+			buf, err = st.Unmarshal(buf)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var d ion.Datum
+		d, buf, err = ion.ReadDatum(&st, buf)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := d.Struct()
+		if !ok {
+			continue
+		}
+		row := make([]string, len(t.cols))
+		err = s.Each(func(f ion.Field) bool {
+			i, ok := t.index[f.Label]
+			if !ok {
+				i = len(t.cols)
+				t.index[f.Label] = i
+				t.cols = append(t.cols, f.Label)
+				t.numeric = append(t.numeric, true)
+				row = append(row, "")
+			}
+			row[i] = cellText(f.Value)
+			switch f.Value.Type() {
+			case ion.IntType, ion.UintType, ion.FloatType, ion.DecimalType, ion.NullType:
+			default:
+				t.numeric[i] = false
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		t.rows = append(t.rows, row)
+	}
+	return t, nil
+}
+
+// cellText returns the text of a value in a table
+func cellText(d ion.Datum) string {
+	switch d.Type() {
+	case ion.NullType:
+		return "NULL"
+	case ion.StringType, ion.SymbolType:
+		s, _ := d.String()
+		return strings.NewReplacer("\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(s)
+	case ion.IntType:
+		i, _ := d.Int()
+		return strconv.FormatInt(i, 10)
+	case ion.UintType:
+		u, _ := d.Uint()
+		return strconv.FormatUint(u, 10)
+	case ion.FloatType:
+		f, _ := d.Float()
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	case ion.BoolType:
+		b, _ := d.Bool()
+		return strconv.FormatBool(b)
+	case ion.TimestampType:
+		ts, _ := d.Timestamp()
+		return ts.Time().Format(time.RFC3339Nano)
+	}
+	// everything else is printed as JSON
+	var st ion.Symtab
+	var tmp ion.Buffer
+	d.Encode(&tmp, &st)
+	var stream ion.Buffer
+	st.Marshal(&stream, true)
+	var out bytes.Buffer
+	ion.ToJSON(&out, bufio.NewReader(io.MultiReader(bytes.NewReader(stream.Bytes()), bytes.NewReader(tmp.Bytes()))))
+	return strings.TrimSpace(out.String())
+}
+
+// write prints the table to w
+func (t *table) write(w io.Writer) error {
+	widths := make([]int, len(t.cols))
+	for i, c := range t.cols {
+		widths[i] = utf8.RuneCountInString(c)
+	}
+	for _, row := range t.rows {
+		for i, cell := range row {
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	b := bufio.NewWriter(w)
+	var sb strings.Builder
+	line := func(cells []string, center bool) {
+		sb.Reset()
+		for i := range t.cols {
+			cell := ""
+			if i < len(cells) {
+				cell = cells[i]
+			}
+			if i > 0 {
+				sb.WriteString("|")
+			}
+			pad := widths[i] - utf8.RuneCountInString(cell)
+			left := 0
+			if center {
+				left = pad / 2
+			} else if t.numeric[i] {
+				left = pad
+			}
+			sb.WriteString(" ")
+			sb.WriteString(strings.Repeat(" ", left))
+			sb.WriteString(cell)
+			sb.WriteString(strings.Repeat(" ", pad-left))
+			sb.WriteString(" ")
+		}
+		// trailing padding is not printed
+		b.WriteString(strings.TrimRight(sb.String(), " "))
+		b.WriteString("\n")
+	}
+	if len(t.cols) > 0 {
+		line(t.cols, true)
+		for i := range t.cols {
+			if i > 0 {
+				b.WriteString("+")
+			}
+			b.WriteString(strings.Repeat("-", widths[i]+2))
+		}
+		b.WriteString("\n")
+	}
+	for _, row := range t.rows {
+		line(row, false)
+	}
+	if len(t.rows) == 1 {
+		b.WriteString("(1 row)\n")
+	} else {
+		fmt.Fprintf(b, "(%d rows)\n", len(t.rows))
+	}
+	return b.Flush()
+}
@@ -0,0 +1,375 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/SnellerInc/sneller"
+	"github.com/SnellerInc/sneller/expr"
+	"github.com/SnellerInc/sneller/ion"
+	"github.com/SnellerInc/sneller/plan"
+	"golang.org/x/sys/cpu"
+)
+
+const (
+	prompt         = "sneller> "
+	continuePrompt = "      -> "
+	historyFile    = ".sneller_history"
+)
+
+// output formats of the REPL
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatIon   = "ion"
+)
+
+const replHelp = `Enter SQL statements terminated by ';'.
+
+  \format [table|json|ion]  show or set the output format
+  \timing [on|off]          show the execution time of each statement
+  \explain [on|off]         show the query plan instead of executing statements
+  \? or \help               show this help
+  \q or \quit               exit
+`
+
+// repl is an interactive session
+type repl struct {
+	env  plan.Env
+	out  io.Writer
+	errs io.Writer
+
+	// editor is used when stdin is a terminal;
+	// otherwise lines are read from lines
+	editor *lineEditor
+	lines  *bufio.Reader
+	comp   *completer
+	// history is the file to which
+	// history entries are appended
+	history string
+
+	format  string
+	timing  bool
+	explain bool
+
+	// pending is the text of
+	// an incomplete statement
+	pending strings.Builder
+}
+
+func runREPL(env plan.Env, out io.Writer, format string) error {
+	r := &repl{
+		env:    env,
+		out:    out,
+		errs:   os.Stderr,
+		format: format,
+	}
+	var root fs.FS
+	if te, ok := env.(*sneller.TenantEnv); ok {
+		root = te.Root
+	}
+	r.comp = newCompleter(env, root, dashd)
+	if isTerminal(int(os.Stdin.Fd())) {
+		r.editor = newLineEditor(os.Stdin, os.Stdout)
+		r.editor.complete = r.comp.complete
+		if home, err := os.UserHomeDir(); err == nil {
+			r.history = filepath.Join(home, historyFile)
+			r.loadHistory()
+		}
+		fmt.Fprintf(r.errs, "Type \\? for help.\n")
+	} else {
+		r.lines = bufio.NewReader(os.Stdin)
+	}
+	for {
+		p := prompt
+		if r.pending.Len() > 0 {
+			p = continuePrompt
+		}
+		line, err := r.readLine(p)
+		if err == errInterrupted {
+			r.pending.Reset()
+			continue
+		}
+		if err == io.EOF {
+			return r.finish()
+		}
+		if err != nil {
+			return err
+		}
+		if r.pending.Len() == 0 && strings.HasPrefix(strings.TrimSpace(line), `\`) {
+			r.addHistory(line)
+			if r.command(strings.Fields(strings.TrimSpace(line))) {
+				return nil
+			}
+			continue
+		}
+		r.pending.WriteString(line)
+		r.pending.WriteString("\n")
+		for {
+			text := r.pending.String()
+			stmt, end := splitStatement(text)
+			if end < 0 {
+				break
+			}
+			r.pending.Reset()
+			rest := strings.TrimLeft(text[end:], " \t\r\n")
+			r.addHistory(strings.Join(strings.Fields(text[:end]), " "))
+			if stmt != "" {
+				r.run(stmt)
+			}
+			if strings.HasPrefix(rest, `\`) {
+				// a command following a statement
+				if r.command(strings.Fields(rest)) {
+					return nil
+				}
+				rest = ""
+			}
+			r.pending.WriteString(rest)
+		}
+	}
+}
+
+// finish executes a final statement
+// that is not terminated by ';'
+func (r *repl) finish() error {
+	if stmt, _ := splitStatement(r.pending.String() + ";"); stmt != "" {
+		r.run(stmt)
+	}
+	return nil
+}
+
+func (r *repl) readLine(prompt string) (string, error) {
+	if r.editor == nil {
+		line, err := r.lines.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		return strings.TrimSuffix(line, "\n"), err
+	}
+	r.comp.context = r.pending.String()
+	restore, err := makeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+	return r.editor.readLine(prompt)
+}
+
+func (r *repl) loadHistory() {
+	buf, err := os.ReadFile(r.history)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(buf), "\n") {
+		r.editor.addHistory(line)
+	}
+}
+
+func (r *repl) addHistory(line string) {
+	if r.editor == nil || line == "" {
+		return
+	}
+	r.editor.addHistory(line)
+	if r.history == "" {
+		return
+	}
+	f, err := os.OpenFile(r.history, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(f, line)
+	f.Close()
+}
+
+// command executes a backslash command
+// and returns true if the session should end
+func (r *repl) command(args []string) bool {
+	toggle := func(name string, val *bool) {
+		switch {
+		case len(args) == 1:
+			*val = !*val
+		case args[1] == "on":
+			*val = true
+		case args[1] == "off":
+			*val = false
+		default:
+			fmt.Fprintf(r.errs, "\\%s: expected on or off\n", name)
+			return
+		}
+		state := "off"
+		if *val {
+			state = "on"
+		}
+		fmt.Fprintf(r.errs, "%s is %s.\n", name, state)
+	}
+	switch args[0] {
+	case `\q`, `\quit`:
+		return true
+	case `\?`, `\help`:
+		fmt.Fprint(r.errs, replHelp)
+	case `\timing`:
+		toggle("timing", &r.timing)
+	case `\explain`:
+		toggle("explain", &r.explain)
+	case `\format`:
+		if len(args) > 1 {
+			switch args[1] {
+			case formatTable, formatJSON, formatIon:
+				r.format = args[1]
+			default:
+				fmt.Fprintf(r.errs, "\\format: unknown format %q\n", args[1])
+				return false
+			}
+		}
+		fmt.Fprintf(r.errs, "format is %s.\n", r.format)
+	default:
+		fmt.Fprintf(r.errs, "unknown command %s; type \\? for help\n", args[0])
+	}
+	return false
+}
+
+// run executes one statement and
+// prints its result
+func (r *repl) run(text string) {
+	err := r.exec(text)
+	if err != nil {
+		fmt.Fprintf(r.errs, "error: %s\n", err)
+	}
+}
+
+func (r *repl) exec(text string) error {
+	q, err := compile([]byte(text))
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	tree, err := plan.New(q, r.env)
+	if err != nil {
+		return err
+	}
+	if r.explain {
+		fmt.Fprint(r.out, tree.String())
+		return nil
+	}
+	if !cpu.X86.HasAVX512 {
+		return errors.New("CPU doesn't support AVX-512")
+	}
+	var buf bytes.Buffer
+	var stats plan.ExecStats
+	err = plan.Exec(tree, &buf, &stats)
+	if err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+	switch r.format {
+	case formatJSON:
+		_, err = ion.ToJSON(r.out, bufio.NewReader(&buf))
+	case formatIon:
+		_, err = r.out.Write(buf.Bytes())
+	default:
+		var t *table
+		t, err = readTable(buf.Bytes(), columns(q))
+		if err == nil {
+			err = t.write(r.out)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if r.timing {
+		fmt.Fprintf(r.errs, "Time: %s (scanned %s)\n", elapsed.Round(time.Microsecond), formatSize(stats.BytesScanned))
+	}
+	return nil
+}
+
+// columns returns the names of the columns
+// produced by q, if they are known
+func columns(q *expr.Query) []string {
+	sel, ok := q.Body.(*expr.Select)
+	if !ok {
+		return nil
+	}
+	var out []string
+	for i := range sel.Columns {
+		if _, ok := sel.Columns[i].Expr.(expr.Star); ok {
+			continue
+		}
+		if name := sel.Columns[i].Result(); name != "" {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// splitStatement returns the first statement
+// in text that is terminated by ';' (without
+// comments, which the parser does not accept)
+// and the position following the ';'.
+// If text does not contain a complete
+// statement, splitStatement returns -1.
+func splitStatement(text string) (string, int) {
+	var stmt strings.Builder
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; c {
+		case ';':
+			return strings.TrimSpace(stmt.String()), i + 1
+		case '\'', '"', '`':
+			j := i + 1
+			for ; j < len(text) && text[j] != c; j++ {
+				if text[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(text) {
+				return "", -1
+			}
+			stmt.WriteString(text[i : j+1])
+			i = j
+		case '-':
+			if i+1 < len(text) && text[i+1] == '-' {
+				for i < len(text) && text[i] != '\n' {
+					i++
+				}
+				stmt.WriteByte('\n')
+				continue
+			}
+			stmt.WriteByte(c)
+		case '/':
+			if i+1 < len(text) && text[i+1] == '*' {
+				end := strings.Index(text[i+2:], "*/")
+				if end < 0 {
+					return "", -1
+				}
+				i += end + 3
+				stmt.WriteByte(' ')
+				continue
+			}
+			stmt.WriteByte(c)
+		default:
+			stmt.WriteByte(c)
+		}
+	}
+	return "", -1
+}
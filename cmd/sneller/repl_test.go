@@ -0,0 +1,139 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SnellerInc/sneller/ion"
+)
+
+func TestSplitStatement(t *testing.T) {
+	testcases := []struct {
+		text, stmt, rest string
+	}{
+		{"SELECT 1", "", ""},
+		{"SELECT 1;", "SELECT 1", ""},
+		{"SELECT 1; \\timing", "SELECT 1", " \\timing"},
+		{"SELECT 'a;b' AS x; SELECT 2;", "SELECT 'a;b' AS x", " SELECT 2;"},
+		{"SELECT \"x;y\" FROM t;", "SELECT \"x;y\" FROM t", ""},
+		{"SELECT 'a\\';b';", "SELECT 'a\\';b'", ""},
+		{"SELECT 'unterminated;", "", ""},
+		{"SELECT x -- a comment; with a semicolon\nFROM t;", "SELECT x \nFROM t", ""},
+		{"SELECT /* ; */ x FROM t;", "SELECT   x FROM t", ""},
+		{"SELECT /* unterminated;", "", ""},
+		{"SELECT x - 1 / 2;", "SELECT x - 1 / 2", ""},
+	}
+	for _, tc := range testcases {
+		stmt, end := splitStatement(tc.text)
+		if tc.stmt == "" {
+			if end >= 0 {
+				t.Errorf("%q: unexpected statement %q", tc.text, stmt)
+			}
+			continue
+		}
+		if stmt != tc.stmt || end < 0 || tc.text[end:] != tc.rest {
+			t.Errorf("%q: got %q, %d", tc.text, stmt, end)
+		}
+	}
+}
+
+func TestLineEditor(t *testing.T) {
+	keys := strings.Join([]string{
+		"select 1\r",
+		"abc\x01x\x05y\x1b[D\x1b[Dz\r", // Ctrl-A, Ctrl-E, arrows
+		"hello world\x17there\r",       // Ctrl-W
+		"abc\x7f\x7fd\r",               // backspace
+		"\x10\x10\r",                   // Ctrl-P twice
+		"se\t1\r",                      // completion
+		"\x03",                         // Ctrl-C
+		"\x04",                         // Ctrl-D
+	}, "")
+	e := newLineEditor(strings.NewReader(keys), io.Discard)
+	e.complete = func(line string, pos int) (int, []string) {
+		return 0, []string{"select", "selected"}
+	}
+	var got []string
+	for {
+		line, err := e.readLine("> ")
+		if err == errInterrupted {
+			got = append(got, "^C")
+			continue
+		}
+		if err != nil {
+			if err != io.EOF {
+				t.Fatal(err)
+			}
+			break
+		}
+		got = append(got, line)
+		e.addHistory(line)
+	}
+	want := []string{
+		"select 1",
+		"xabzcy",
+		"hello there",
+		"ad",
+		"hello there",
+		"select1",
+		"^C",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestTable(t *testing.T) {
+	var st ion.Symtab
+	var buf ion.Buffer
+	rows := []ion.Struct{
+		ion.NewStruct(&st, []ion.Field{
+			{Label: "name", Value: ion.String("foo")},
+			{Label: "n", Value: ion.Int(3)},
+		}),
+		ion.NewStruct(&st, []ion.Field{
+			{Label: "n", Value: ion.Int(-12)},
+			{Label: "tags", Value: ion.NewList(&st, []ion.Datum{ion.String("x")}).Datum()},
+		}),
+	}
+	for i := range rows {
+		rows[i].Encode(&buf, &st)
+	}
+	var stream ion.Buffer
+	st.Marshal(&stream, true)
+	tbl, err := readTable(append(stream.Bytes(), buf.Bytes()...), []string{"n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := tbl.write(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"  n  | name | tags",
+		"-----+------+-------",
+		"   3 | foo  |",
+		" -12 |      | [\"x\"]",
+		"(2 rows)",
+		"",
+	}, "\n")
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
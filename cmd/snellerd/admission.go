@@ -0,0 +1,285 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// priority is a query priority class;
+// lower values are admitted first
+type priority int
+
+const (
+	prioInteractive priority = iota
+	prioBatch
+
+	numPriorities
+)
+
+func (p priority) String() string {
+	switch p {
+	case prioInteractive:
+		return "interactive"
+	case prioBatch:
+		return "batch"
+	default:
+		return fmt.Sprintf("priority(%d)", int(p))
+	}
+}
+
+// parsePriority determines the priority class
+// of a request from the X-Sneller-Priority header
+// or the "priority" query parameter;
+// the default is interactive
+func parsePriority(r *http.Request) (priority, error) {
+	str := r.Header.Get("X-Sneller-Priority")
+	if str == "" {
+		str = r.URL.Query().Get("priority")
+	}
+	switch str {
+	case "", "interactive":
+		return prioInteractive, nil
+	case "batch":
+		return prioBatch, nil
+	default:
+		return 0, fmt.Errorf("unknown priority %q", str)
+	}
+}
+
+var (
+	// errQueueFull is returned by admission.acquire
+	// when the wait queue is already full
+	errQueueFull = errors.New("too many queued queries")
+	// errQueueTimeout is returned by admission.acquire
+	// when a query waited in the queue for too long
+	errQueueTimeout = errors.New("timed out waiting for a query slot")
+)
+
+// admission limits the number of queries
+// that execute concurrently, both globally
+// and for each tenant
+//
+// Queries that cannot execute immediately
+// wait in a bounded queue; queries with a
+// higher priority are admitted first, and
+// queries within the same priority are
+// admitted in the order in which they arrived.
+type admission struct {
+	// maxGlobal is the maximum number of
+	// concurrent queries; if it is zero,
+	// there is no global limit
+	maxGlobal int
+	// maxTenant is the default maximum number
+	// of concurrent queries for each tenant;
+	// if it is zero, there is no default limit
+	maxTenant int
+	// maxQueue is the maximum number of
+	// queries waiting to be admitted
+	maxQueue int
+	// timeout is the maximum amount of
+	// time that a query waits to be admitted
+	timeout time.Duration
+
+	lock    sync.Mutex
+	running int
+	tenants map[string]int
+	queues  [numPriorities][]*waiter
+}
+
+type waiter struct {
+	tenant   string
+	limit    int
+	ready    chan struct{}
+	admitted bool
+}
+
+// ticket is the permission
+// to execute one query
+type ticket struct {
+	a      *admission
+	tenant string
+	// wait is the amount of time
+	// spent waiting in the queue
+	wait time.Duration
+	// depth is the number of queries
+	// that were queued ahead of this one
+	depth int
+}
+
+// release returns t's slot
+func (t *ticket) release() {
+	if t.a != nil {
+		t.a.release(t.tenant)
+	}
+}
+
+func (a *admission) canRun(tenant string, limit int) bool {
+	return (a.maxGlobal <= 0 || a.running < a.maxGlobal) &&
+		(limit <= 0 || a.tenants[tenant] < limit)
+}
+
+func (a *admission) start(tenant string) {
+	a.running++
+	if a.tenants == nil {
+		a.tenants = make(map[string]int)
+	}
+	a.tenants[tenant]++
+}
+
+func (a *admission) queued() int {
+	n := 0
+	for i := range a.queues {
+		n += len(a.queues[i])
+	}
+	return n
+}
+
+// acquire waits for a slot for a query
+// from the given tenant to execute
+//
+// If limit is non-zero, it overrides the
+// default per-tenant concurrency limit.
+// The caller must call ticket.release once
+// the query has finished executing.
+func (a *admission) acquire(ctx context.Context, tenant string, limit int, prio priority) (*ticket, error) {
+	if a == nil {
+		return &ticket{}, nil
+	}
+	if limit <= 0 {
+		limit = a.maxTenant
+	}
+	a.lock.Lock()
+	// dispatch runs every time a slot is
+	// released, so none of the queued queries
+	// can run right now; if this one can, it
+	// isn't jumping ahead of anything
+	if a.canRun(tenant, limit) {
+		a.start(tenant)
+		a.lock.Unlock()
+		return &ticket{a: a, tenant: tenant}, nil
+	}
+	ahead := 0
+	for p := prioInteractive; p <= prio; p++ {
+		ahead += len(a.queues[p])
+	}
+	if a.queued() >= a.maxQueue {
+		a.lock.Unlock()
+		return nil, errQueueFull
+	}
+	w := &waiter{tenant: tenant, limit: limit, ready: make(chan struct{})}
+	a.queues[prio] = append(a.queues[prio], w)
+	a.lock.Unlock()
+
+	start := time.Now()
+	timer := time.NewTimer(a.timeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-w.ready:
+		return &ticket{a: a, tenant: tenant, wait: time.Since(start), depth: ahead}, nil
+	case <-timer.C:
+		err = errQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if w.admitted {
+		// raced with dispatch
+		if err == errQueueTimeout {
+			return &ticket{a: a, tenant: tenant, wait: time.Since(start), depth: ahead}, nil
+		}
+		a.releaseLocked(tenant)
+		return nil, err
+	}
+	q := a.queues[prio]
+	for i := range q {
+		if q[i] == w {
+			a.queues[prio] = append(q[:i], q[i+1:]...)
+			break
+		}
+	}
+	return nil, err
+}
+
+func (a *admission) release(tenant string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.releaseLocked(tenant)
+}
+
+func (a *admission) releaseLocked(tenant string) {
+	a.running--
+	if a.tenants[tenant]--; a.tenants[tenant] <= 0 {
+		delete(a.tenants, tenant)
+	}
+	a.dispatch()
+}
+
+// dispatch admits as many waiters as possible;
+// a waiter whose tenant is at its limit does
+// not block the waiters behind it
+func (a *admission) dispatch() {
+	for p := range a.queues {
+		q := a.queues[p]
+		j := 0
+		for i := range q {
+			w := q[i]
+			if a.canRun(w.tenant, w.limit) {
+				a.start(w.tenant)
+				w.admitted = true
+				close(w.ready)
+				continue
+			}
+			q[j] = w
+			j++
+		}
+		for i := j; i < len(q); i++ {
+			q[i] = nil
+		}
+		a.queues[p] = q[:j]
+	}
+}
+
+// retryAfter is the value of the
+// Retry-After header, in seconds,
+// sent along with queueing errors
+func (a *admission) retryAfter() string {
+	secs := int(math.Ceil(a.timeout.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	return strconv.Itoa(secs)
+}
+
+// admissionError writes the response
+// for an error returned from acquire
+func (a *admission) admissionError(w http.ResponseWriter, err error) {
+	w.Header().Set("Retry-After", a.retryAfter())
+	switch err {
+	case errQueueFull:
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	default:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	}
+}
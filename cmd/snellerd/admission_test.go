@@ -0,0 +1,166 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// acquireAsync calls a.acquire in a goroutine
+// and waits until the request is queued
+func acquireAsync(t *testing.T, a *admission, tenant string, prio priority) chan *ticket {
+	t.Helper()
+	a.lock.Lock()
+	before := a.queued()
+	a.lock.Unlock()
+	out := make(chan *ticket, 1)
+	go func() {
+		tk, err := a.acquire(context.Background(), tenant, 0, prio)
+		if err != nil {
+			t.Error(err)
+		}
+		out <- tk
+	}()
+	for {
+		a.lock.Lock()
+		n := a.queued()
+		a.lock.Unlock()
+		if n > before {
+			return out
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func mustAcquire(t *testing.T, a *admission, tenant string) *ticket {
+	t.Helper()
+	tk, err := a.acquire(context.Background(), tenant, 0, prioInteractive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tk
+}
+
+func TestAdmissionPriority(t *testing.T) {
+	a := &admission{maxGlobal: 1, maxQueue: 10, timeout: time.Minute}
+	first := mustAcquire(t, a, "x")
+	batch := acquireAsync(t, a, "x", prioBatch)
+	interactive := acquireAsync(t, a, "y", prioInteractive)
+	first.release()
+	// the interactive query should be
+	// admitted before the batch query
+	var tk *ticket
+	select {
+	case tk = <-interactive:
+	case <-batch:
+		t.Fatal("batch query admitted before interactive query")
+	}
+	if tk.depth != 0 {
+		t.Errorf("interactive query depth %d", tk.depth)
+	}
+	tk.release()
+	tk = <-batch
+	if tk.depth != 0 || tk.wait == 0 {
+		t.Errorf("batch query depth %d wait %s", tk.depth, tk.wait)
+	}
+	tk.release()
+	if a.running != 0 || len(a.tenants) != 0 {
+		t.Errorf("running = %d, tenants = %v after release", a.running, a.tenants)
+	}
+}
+
+func TestAdmissionTenantLimit(t *testing.T) {
+	a := &admission{maxGlobal: 3, maxTenant: 1, maxQueue: 10, timeout: time.Minute}
+	x := mustAcquire(t, a, "x")
+	// a second query from x must wait,
+	// but it shouldn't block y
+	waiting := acquireAsync(t, a, "x", prioInteractive)
+	y := mustAcquire(t, a, "y")
+	y.release()
+	select {
+	case <-waiting:
+		t.Fatal("tenant limit not enforced")
+	default:
+	}
+	x.release()
+	(<-waiting).release()
+}
+
+func TestAdmissionErrors(t *testing.T) {
+	a := &admission{maxGlobal: 1, maxQueue: 1, timeout: 10 * time.Millisecond}
+	tk := mustAcquire(t, a, "x")
+	defer tk.release()
+	_, err := a.acquire(context.Background(), "x", 0, prioInteractive)
+	if err != errQueueTimeout {
+		t.Fatalf("expected timeout; got %v", err)
+	}
+	w := httptest.NewRecorder()
+	a.admissionError(w, err)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("timeout: got status %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	a.timeout = time.Minute
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := a.acquire(ctx, "y", 0, prioBatch)
+		done <- err
+	}()
+	for {
+		a.lock.Lock()
+		n := a.queued()
+		a.lock.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	_, err = a.acquire(context.Background(), "z", 0, prioInteractive)
+	if err != errQueueFull {
+		t.Fatalf("expected a full queue; got %v", err)
+	}
+	w = httptest.NewRecorder()
+	a.admissionError(w, err)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Errorf("full: got status %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected cancellation; got %v", err)
+	}
+	if n := a.queued(); n != 0 {
+		t.Errorf("%d queries still queued", n)
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	r := httptest.NewRequest("GET", "/executeQuery?priority=batch", nil)
+	if p, err := parsePriority(r); err != nil || p != prioBatch {
+		t.Errorf("got %s, %v", p, err)
+	}
+	r.Header.Set("X-Sneller-Priority", "interactive")
+	if p, err := parsePriority(r); err != nil || p != prioInteractive {
+		t.Errorf("got %s, %v", p, err)
+	}
+	r.Header.Set("X-Sneller-Priority", "urgent")
+	if _, err := parsePriority(r); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,373 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SnellerInc/sneller/date"
+	"github.com/SnellerInc/sneller/db"
+	"github.com/SnellerInc/sneller/ion"
+	"github.com/SnellerInc/sneller/ion/blockfmt"
+	"github.com/SnellerInc/sneller/plan"
+)
+
+const (
+	// auditDatabase is the database in the root
+	// of each tenant to which its audit records
+	// are written; each node writes to its own
+	// table, named auditTable + "_" + node
+	auditDatabase = db.AuditDatabase
+	auditTable    = "queries"
+
+	// default auditor parameters
+	defaultAuditInterval = time.Minute
+	defaultAuditBatch    = 1000
+
+	// auditMaxFailed is the maximum number of
+	// batches kept for retrying after a failed write
+	auditMaxFailed = 64
+	// auditExpireInterval is how often
+	// old records are expired for each tenant
+	auditExpireInterval = time.Hour
+)
+
+// audit record status values
+const (
+	auditOK          = "ok"
+	auditError       = "error"
+	auditCanceled    = "canceled"
+	auditRejected    = "rejected"
+	auditNotModified = "not_modified"
+)
+
+// auditRecord describes one query
+type auditRecord struct {
+	id       string
+	tenant   string
+	subject  string
+	protocol string
+	database string
+	// query is the redacted query text
+	query  string
+	tables []string
+	start  time.Time
+	status string
+	err    error
+	stats  plan.ExecStats
+}
+
+// set sets the status of r and the error,
+// if any, that caused it; it is a no-op if r is nil
+func (r *auditRecord) set(status string, err error) {
+	if r != nil {
+		r.status = status
+		r.err = err
+	}
+}
+
+// planStatus returns the status of
+// a query that could not be planned
+func planStatus(err error) string {
+	var limit *errPlanLimit
+	if errors.Is(err, fs.ErrPermission) || errors.As(err, &limit) {
+		return auditRejected
+	}
+	return auditError
+}
+
+func (r *auditRecord) encode(dst *ion.Buffer, st *ion.Symtab, duration time.Duration) {
+	str := func(name, value string) {
+		if value != "" {
+			dst.BeginField(st.Intern(name))
+			dst.WriteString(value)
+		}
+	}
+	dst.BeginStruct(-1)
+	str("query_id", r.id)
+	str("tenant", r.tenant)
+	str("subject", r.subject)
+	str("protocol", r.protocol)
+	str("database", r.database)
+	str("query", r.query)
+	if len(r.tables) > 0 {
+		dst.BeginField(st.Intern("tables"))
+		dst.BeginList(-1)
+		for i := range r.tables {
+			dst.WriteString(r.tables[i])
+		}
+		dst.EndList()
+	}
+	dst.BeginField(st.Intern("start"))
+	dst.WriteTime(date.FromTime(r.start))
+	dst.BeginField(st.Intern("duration"))
+	dst.WriteInt(int64(duration))
+	str("status", r.status)
+	if r.err != nil {
+		str("error", r.err.Error())
+	}
+	dst.BeginField(st.Intern("scanned"))
+	dst.WriteInt(r.stats.BytesScanned)
+	dst.BeginField(st.Intern("hits"))
+	dst.WriteInt(r.stats.CacheHits)
+	dst.BeginField(st.Intern("misses"))
+	dst.WriteInt(r.stats.CacheMisses)
+	dst.EndStruct()
+}
+
+// auditBatch is a batch of records
+// that belong to the same tenant
+type auditBatch struct {
+	owner db.Tenant
+	st    ion.Symtab
+	body  ion.Buffer
+	count int
+}
+
+// auditor writes one audit record per query
+// into the sneller_audit.queries_<node> table
+// of the tenant that ran the query
+//
+// Records are buffered and written as one
+// packed object per batch, so the audit log
+// can be queried like any other table.
+// Every node writes to a table of its own,
+// since updates to the index of a table are
+// not atomic across nodes.
+type auditor struct {
+	// node is the name of this node,
+	// which determines the audit table
+	node string
+	// interval is the maximum amount of
+	// time that a record is buffered
+	interval time.Duration
+	// batch is the number of records of
+	// one tenant that trigger a write
+	batch int
+	// retention, if non-zero, is how long
+	// records are kept before they are expired
+	retention time.Duration
+	logf      func(f string, args ...any)
+
+	lock    sync.Mutex
+	pending map[string]*auditBatch
+	// failed holds the batches that could
+	// not be written; they are retried
+	// on the next flush
+	failed []*auditBatch
+
+	// wlock serializes flushes
+	wlock sync.Mutex
+	// expired is the last time the records
+	// of each tenant were expired
+	expired map[string]time.Time
+
+	kick chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// table returns the name of the table to which
+// the node writes; if node is empty, the table
+// is auditTable
+func (a *auditor) table() string {
+	if a.node == "" {
+		return auditTable
+	}
+	return auditTable + "_" + a.node
+}
+
+// auditNode converts name (usually a host name)
+// into a node name that can be part of a table name
+func auditNode(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' ||
+			r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func (a *auditor) batchSize() int {
+	if a.batch > 0 {
+		return a.batch
+	}
+	return defaultAuditBatch
+}
+
+// start starts writing records
+// in the background
+func (a *auditor) start() {
+	a.kick = make(chan struct{}, 1)
+	a.stop = make(chan struct{})
+	a.done = make(chan struct{})
+	interval := a.interval
+	if interval <= 0 {
+		interval = defaultAuditInterval
+	}
+	go a.run(interval)
+}
+
+func (a *auditor) run(interval time.Duration) {
+	defer close(a.done)
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-a.stop:
+			a.flush(true)
+			return
+		case <-tick.C:
+			a.flush(true)
+		case <-a.kick:
+			a.flush(false)
+		}
+	}
+}
+
+// close writes the buffered records
+// and stops writing in the background
+func (a *auditor) close() {
+	if a == nil {
+		return
+	}
+	if a.stop == nil {
+		a.flush(true)
+		return
+	}
+	select {
+	case <-a.stop:
+	default:
+		close(a.stop)
+	}
+	<-a.done
+}
+
+// log adds rec to the audit log of owner;
+// it is a no-op if a or rec is nil
+func (a *auditor) log(owner db.Tenant, rec *auditRecord) {
+	if a == nil || rec == nil {
+		return
+	}
+	duration := time.Since(rec.start)
+	id := owner.ID()
+	a.lock.Lock()
+	if a.pending == nil {
+		a.pending = make(map[string]*auditBatch)
+	}
+	b := a.pending[id]
+	if b == nil {
+		b = &auditBatch{owner: owner}
+		a.pending[id] = b
+	}
+	rec.encode(&b.body, &b.st, duration)
+	b.count++
+	full := b.count >= a.batchSize()
+	a.lock.Unlock()
+	if full && a.kick != nil {
+		select {
+		case a.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// flush writes the batches that are full,
+// or all of the batches if all is set,
+// along with the batches that previously
+// failed to be written
+func (a *auditor) flush(all bool) {
+	a.wlock.Lock()
+	defer a.wlock.Unlock()
+	a.lock.Lock()
+	batches := a.failed
+	a.failed = nil
+	for id, b := range a.pending {
+		if all || b.count >= a.batchSize() {
+			batches = append(batches, b)
+			delete(a.pending, id)
+		}
+	}
+	a.lock.Unlock()
+	for _, b := range batches {
+		err := a.write(b)
+		if err == nil {
+			a.expire(b.owner)
+			continue
+		}
+		a.logf("tenant %s: writing %d audit records: %s", b.owner.ID(), b.count, err)
+		a.lock.Lock()
+		if len(a.failed) < auditMaxFailed {
+			a.failed = append(a.failed, b)
+		} else {
+			a.logf("tenant %s: dropping %d audit records", b.owner.ID(), b.count)
+		}
+		a.lock.Unlock()
+	}
+}
+
+func (a *auditor) builder() *db.Builder {
+	return &db.Builder{
+		Align:        1024 * 1024,
+		GCMinimumAge: 5 * time.Minute,
+	}
+}
+
+// write appends the records in b to the audit table
+func (a *auditor) write(b *auditBatch) error {
+	var buf ion.Buffer
+	b.st.Marshal(&buf, true)
+	buf.UnsafeAppend(b.body.Bytes())
+	bld := a.builder()
+	for tries := 0; ; tries++ {
+		err := bld.InsertRows(b.owner, auditDatabase, a.table(),
+			bytes.NewReader(buf.Bytes()), blockfmt.UnsafeION())
+		if !errors.Is(err, db.ErrBuildAgain) || tries >= 5 {
+			return err
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// expire removes the records of owner that are
+// older than the retention period, at most once
+// per auditExpireInterval
+func (a *auditor) expire(owner db.Tenant) {
+	if a.retention <= 0 {
+		return
+	}
+	id := owner.ID()
+	now := time.Now()
+	if last, ok := a.expired[id]; ok && now.Sub(last) < auditExpireInterval {
+		return
+	}
+	if a.expired == nil {
+		a.expired = make(map[string]time.Time)
+	}
+	a.expired[id] = now
+	before := date.FromTime(now.Add(-a.retention))
+	n, err := a.builder().Expire(owner, auditDatabase, a.table(), "start", before)
+	if err != nil {
+		a.logf("tenant %s: expiring audit records: %s", id, err)
+	} else if n > 0 {
+		a.logf("tenant %s: expired %d audit objects before %s", id, n, before)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SnellerInc/sneller/client"
+	"github.com/SnellerInc/sneller/tenant"
+)
+
+func TestAudit(t *testing.T) {
+	tt := testdirEnviron(t)
+	s := server{
+		logger:    testlogger(t),
+		sandbox:   tenant.CanSandbox(),
+		cachedir:  t.TempDir(),
+		tenantcmd: []string{"./snellerd-test-binary", "worker"},
+		peers:     noPeers{},
+		auth:      testAuth{tt},
+		audit:     &auditor{node: "test", interval: time.Hour},
+	}
+	httpsock := listen(t)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	s.aboutToServe = wg.Done
+	go s.Serve(httpsock, nil)
+	wg.Wait()
+	defer s.Close()
+
+	ctx := context.Background()
+	c := &client.Client{
+		Endpoint: "http://" + httpsock.Addr().String(),
+		Token:    "snellerd-test",
+	}
+	run := func(query string) error {
+		t.Helper()
+		rows, err := c.Query(ctx, "default", query)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+		}
+		return rows.Err()
+	}
+	if err := run("SELECT COUNT(*) FROM parking WHERE Color = 'GY'"); err != nil {
+		t.Fatal(err)
+	}
+	if err := run("SELECT * FROM missing"); err == nil {
+		t.Fatal("expected an error")
+	}
+	s.audit.flush(true)
+
+	type record struct {
+		Status  string   `ion:"status"`
+		Query   string   `ion:"query"`
+		Tables  []string `ion:"tables"`
+		Scanned int64    `ion:"scanned"`
+		Tenant  string   `ion:"tenant"`
+		Error   string   `ion:"error"`
+	}
+	rows, err := c.Query(ctx, "", `SELECT * FROM TABLE_GLOB(sneller_audit."queries_*") ORDER BY status DESC LIMIT 10`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []record
+	for rows.Next() {
+		var r record
+		if err := rows.Unmarshal(&r); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d records: %+v", len(got), got)
+	}
+	ok, failed := got[0], got[1]
+	if ok.Status != auditOK || ok.Scanned == 0 || ok.Tenant != tt.ID() ||
+		strings.Join(ok.Tables, ",") != "default.parking" {
+		t.Errorf("unexpected record %+v", ok)
+	}
+	if strings.Contains(ok.Query, "GY") {
+		t.Errorf("query %q was not redacted", ok.Query)
+	}
+	if failed.Status != auditError || failed.Error == "" {
+		t.Errorf("unexpected record %+v", failed)
+	}
+
+	// the audit query itself is recorded as well
+	s.audit.flush(true)
+	rows, err = c.Query(ctx, "", `SELECT COUNT(*) AS n FROM TABLE_GLOB(sneller_audit."queries_*")
+WHERE status <> 'ok' AND start > DATE_ADD(DAY, -1, UTCNOW())`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var out struct {
+		N int `ion:"n"`
+	}
+	for rows.Next() {
+		if err := rows.Unmarshal(&out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if out.N != 1 {
+		t.Errorf("got %d failed queries", out.N)
+	}
+
+	// queries can't tamper with the audit log
+	err = run("CREATE OR REPLACE TABLE sneller_audit.queries_test AS SELECT * FROM parking")
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("replacing the audit table: got error %v", err)
+	}
+}
+
+func TestAuditNode(t *testing.T) {
+	if got := auditNode("ip-10-0-0-1.ec2.internal"); got != "ip_10_0_0_1_ec2_internal" {
+		t.Errorf("got node %q", got)
+	}
+	a := &auditor{}
+	if got := a.table(); got != "queries" {
+		t.Errorf("got table %q", got)
+	}
+	a.node = "n1"
+	if got := a.table(); got != "queries_n1" {
+		t.Errorf("got table %q", got)
+	}
+}
@@ -111,6 +111,12 @@ func (r *requester) getInputs(db, table string) *http.Request {
 	return req
 }
 
+func (r *requester) getSchema(db, table string) *http.Request {
+	req := r.get(fmt.Sprintf("/schema?database=%s&table=%s", url.QueryEscape(db), url.QueryEscape(table)))
+	req.Header.Set("Authorization", "Bearer snellerd-test")
+	return req
+}
+
 type testAuth struct {
 	self db.Tenant
 }
@@ -158,6 +164,8 @@ func TestBadRequest(t *testing.T) {
 	}{
 		{"SELECT 3||x FROM parking", "ill-typed"},
 		{"SELECT LEAST(TRIM(x)) FROM parking WHERE x = 3", "ill-typed"},
+		{"SELECT x FROM parking WHERE y = ?", "unbound parameter 1"},
+		{"SELECT x FROM parking WHERE y = $y", `unbound parameter \$y`},
 	}
 
 	cl := http.DefaultClient
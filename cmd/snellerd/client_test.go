@@ -0,0 +1,108 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/SnellerInc/sneller/client"
+	"github.com/SnellerInc/sneller/tenant"
+	"github.com/SnellerInc/sneller/tenant/tnproto"
+)
+
+func TestClient(t *testing.T) {
+	tt := testdirEnviron(t)
+	s := server{
+		logger:    testlogger(t),
+		sandbox:   tenant.CanSandbox(),
+		cachedir:  t.TempDir(),
+		tenantcmd: []string{"./snellerd-test-binary", "worker"},
+		peers:     noPeers{},
+		auth:      testAuth{tt},
+	}
+	httpsock := listen(t)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	s.aboutToServe = wg.Done
+	go s.Serve(httpsock, nil)
+	wg.Wait()
+	defer s.Close()
+
+	ctx := context.Background()
+	c := &client.Client{
+		Endpoint: "http://" + httpsock.Addr().String(),
+		Token:    "snellerd-test",
+		Cache:    client.NewMemoryCache(1024 * 1024),
+	}
+	tables, err := c.Tables(ctx, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tables, []string{"combined", "parking", "parking2", "taxi"}) {
+		t.Errorf("got tables %v", tables)
+	}
+
+	count := func(query string) (int, int64) {
+		t.Helper()
+		rows, err := c.Query(ctx, "default", query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var out struct {
+			N int `ion:"n"`
+		}
+		for rows.Next() {
+			if err := rows.Unmarshal(&out); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return out.N, rows.Stats().BytesScanned
+	}
+	n, scanned := count("SELECT COUNT(*) AS n FROM parking")
+	if n != 1023 || scanned == 0 {
+		t.Errorf("got count %d scanned %d", n, scanned)
+	}
+	// the second execution is served from the cache
+	n, _ = count("SELECT COUNT(*) AS n FROM parking")
+	if n != 1023 {
+		t.Errorf("got cached count %d", n)
+	}
+
+	// this query fails after the response has started
+	rows, err := c.Query(ctx, "", `SELECT
+   (SELECT DISTINCT COALESCE(Ticket,Issue.Tick,tpep_pickup_datetime),
+                    COALESCE(Ticket,Issue.Tick,tpep_dropoff_datetime)
+     FROM default.taxi ++ default.parking2 ++ default.parking)
+   AS list`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	var re *tnproto.RemoteError
+	if err := rows.Err(); !errors.As(err, &re) || !strings.Contains(re.Text, "subreplacement exceeds limit") {
+		t.Errorf("got error %v", rows.Err())
+	}
+}
@@ -23,6 +23,8 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -33,10 +35,12 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/SnellerInc/sneller/db"
 	"github.com/SnellerInc/sneller/ion"
 	"github.com/SnellerInc/sneller/ion/blockfmt"
+	"github.com/SnellerInc/sneller/plan"
 	"github.com/SnellerInc/sneller/tenant"
 
 	"golang.org/x/exp/slices"
@@ -152,6 +156,7 @@ func testdirEnviron(t *testing.T) db.Tenant {
 		Fallback: func(_ string) blockfmt.RowFormat {
 			return blockfmt.UnsafeION()
 		},
+		InferShape: true,
 	}
 	tt := db.NewLocalTenant(dfs)
 	err = b.Sync(tt, "default", "*")
@@ -297,6 +302,145 @@ func TestQueryError(t *testing.T) {
 	t.Logf("error message: %s", msg)
 }
 
+func TestParseLimits(t *testing.T) {
+	r := httptest.NewRequest("GET", "/executeQuery?timeout=2s&max_scan_bytes=5000", nil)
+	lim := plan.Limits{Timeout: time.Minute, MaxScan: 1000}
+	if err := parseLimits(r, &lim); err != nil {
+		t.Fatal(err)
+	}
+	// the timeout is lowered, but
+	// the scan limit is not raised
+	if lim.Timeout != 2*time.Second || lim.MaxScan != 1000 {
+		t.Errorf("got %+v", lim)
+	}
+	r = httptest.NewRequest("GET", "/executeQuery?timeout=1.5", nil)
+	lim = plan.Limits{}
+	if err := parseLimits(r, &lim); err != nil || lim.Timeout != 1500*time.Millisecond {
+		t.Errorf("got %+v, %v", lim, err)
+	}
+	for _, arg := range []string{"timeout=-1s", "timeout=soon", "max_scan_bytes=0", "max_scan_bytes=lots"} {
+		r = httptest.NewRequest("GET", "/executeQuery?"+arg, nil)
+		if err := parseLimits(r, &lim); err == nil {
+			t.Errorf("%s: expected an error", arg)
+		}
+	}
+}
+
+// test that the limits of a request
+// are applied to a split query
+func TestQueryLimits(t *testing.T) {
+	tt := testdirEnviron(t)
+	peersock0, peersock1 := listen(t), listen(t)
+	s := server{
+		logger:    testlogger(t),
+		sandbox:   tenant.CanSandbox(),
+		cachedir:  t.TempDir(),
+		tenantcmd: []string{"./snellerd-test-binary", "worker"},
+		splitSize: 16 * 1024,
+		peers:     makePeers(t, peersock0.Addr().(*net.TCPAddr), peersock1.Addr().(*net.TCPAddr)),
+		auth:      testAuth{tt},
+	}
+	httpsock := listen(t)
+	peer := server{
+		logger:    testlogger(t),
+		sandbox:   s.sandbox,
+		cachedir:  t.TempDir(),
+		tenantcmd: s.tenantcmd,
+		splitSize: s.splitSize,
+		peers:     makePeers(t, peersock0.Addr().(*net.TCPAddr), peersock1.Addr().(*net.TCPAddr)),
+	}
+	httpsock2 := listen(t)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	s.aboutToServe = (&wg).Done
+	peer.aboutToServe = (&wg).Done
+	go s.Serve(httpsock, peersock0)
+	go peer.Serve(httpsock2, peersock1)
+	wg.Wait()
+
+	defer s.Close()
+	defer peer.Close()
+
+	rq := &requester{
+		t:    t,
+		host: "http://" + httpsock.Addr().String(),
+	}
+	run := func(args url.Values) (int, []byte) {
+		args.Set("database", "default")
+		args.Set("query", "SELECT COUNT(*) FROM parking2 ++ taxi")
+		req := rq.get("/executeQuery?" + args.Encode())
+		req.Header.Set("Authorization", "Bearer snellerd-test")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		buf, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.StatusCode, buf
+	}
+
+	code, buf := run(url.Values{"timeout": {"never"}})
+	if code != http.StatusBadRequest {
+		t.Fatalf("status code %d %s", code, buf)
+	}
+	// a split query that may exceed the scan
+	// limit of the request is rejected up front
+	code, buf = run(url.Values{"max_scan_bytes": {"1000"}})
+	if code != http.StatusBadRequest {
+		t.Fatalf("status code %d %s", code, buf)
+	}
+	code, buf = run(url.Values{"timeout": {"1ns"}})
+	if code != http.StatusOK {
+		t.Fatalf("status code %d %s", code, buf)
+	}
+	var st ion.Symtab
+	buf, err := st.Unmarshal(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the partial results (if any) are
+	// followed by a symbol table and
+	// query_error::{error_message: "...", limit: {...}}
+	for ion.TypeOf(buf) != ion.AnnotationType || ion.IsBVM(buf) {
+		if ion.IsBVM(buf) {
+			buf, err = st.Unmarshal(buf)
+		} else {
+			buf = buf[ion.SizeOf(buf):]
+		}
+		if err != nil || len(buf) == 0 {
+			t.Fatalf("no query_error (%v)", err)
+		}
+	}
+	sym, body, _, err := ion.ReadAnnotation(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Get(sym) != "query_error" {
+		t.Fatalf("annotation is %q?", st.Get(sym))
+	}
+	var lerr *plan.LimitError
+	_, err = ion.UnpackStruct(&st, body, func(name string, field []byte) error {
+		if name == "limit" {
+			lerr = new(plan.LimitError)
+			return lerr.Decode(field, &st)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lerr == nil {
+		t.Fatal("no limit in query_error")
+	}
+	if lerr.Timeout != time.Nanosecond {
+		t.Errorf("unexpected error %+v", lerr)
+	}
+	t.Logf("error: %s", lerr)
+}
+
 // test the server running on a tmpfs that
 // has been populated with some test tables
 func TestSimpleFS(t *testing.T) {
@@ -425,6 +569,38 @@ func TestSimpleFS(t *testing.T) {
 			t.Fatal(err)
 		}
 	}
+	{
+		// test that the inferred shape is available
+		req := rq.getSchema("default", "parking")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("get schema: %s", res.Status)
+		}
+		var ret tableSchema
+		err = json.NewDecoder(res.Body).Decode(&ret)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ret.Shape == nil || ret.Shape.Total != 1023 {
+			t.Fatalf("unexpected shape %+v", ret.Shape)
+		}
+		if len(ret.Shape.Fields["Ticket"].Types()) == 0 {
+			t.Errorf("no types for Ticket in shape %v", ret.Shape.Fields)
+		}
+
+		res, err = http.DefaultClient.Do(rq.getSchema("default", "no-such-table"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("get schema of missing table: %s", res.Status)
+		}
+	}
 
 	checkTiming := func(t *testing.T, res *http.Response) {
 		t.Helper()
@@ -441,7 +617,7 @@ func TestSimpleFS(t *testing.T) {
 				t.Error("query encountered an error")
 			}
 			switch keyvalues[0] {
-			case "exec", "miss", "hit", "scanned":
+			case "exec", "miss", "hit", "scanned", "retry", "queue":
 			default:
 				t.Errorf("unrecognized Server-Timing response %v", keyvalues)
 			}
@@ -469,6 +645,9 @@ func TestSimpleFS(t *testing.T) {
 				str, _ := final.Field("error").String()
 				t.Fatalf("query error: %s", str)
 			}
+			if final.Field("queue_depth").Empty() || final.Field("queue_wait").Empty() {
+				t.Error("missing queue stats in final_status")
+			}
 			scanned, _ := final.Field("scanned").Uint()
 			if maxscan > 0 && scanned == 0 {
 				t.Fatalf("scanned = 0; maxscan = %d", maxscan)
@@ -641,4 +820,175 @@ SELECT ROUND(SUM(total_amount)) AS "sum" FROM default.taxi WHERE VendorID = (SEL
 		}
 		checkTiming(t, res)
 	}
+
+	// get coverage of parameters
+	// and prepared statements
+	do := func(req *http.Request, status int) []byte {
+		t.Helper()
+		req.Header.Set("Authorization", "Bearer snellerd-test")
+		req.Header.Set("Accept", "application/json")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != status {
+			t.Fatalf("got status %s (%s); wanted %d", res.Status, body, status)
+		}
+		return body
+	}
+	const want = `[{"Location": "721 S WESTLAKE"}]`
+	body := `{"query": "SELECT Location FROM default.parking WHERE Route = ? AND IssueTime = ?", "params": ["2A75", 945]}`
+	req, err := http.NewRequest(http.MethodPost, rq.host+"/executeQuery", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if got := string(do(req, http.StatusOK)); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	req = rq.get("/executeQuery?" + url.Values{
+		"query":    {"SELECT Location FROM parking WHERE Route = $route AND IssueTime = $time"},
+		"params":   {`{"route": "2A75", "time": 945}`},
+		"database": {"default"},
+	}.Encode())
+	if got := string(do(req, http.StatusOK)); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	req, err = http.NewRequest(http.MethodPost, rq.host+"/prepare?database=default",
+		strings.NewReader("SELECT Location FROM parking WHERE Route = $route AND IssueTime = $time"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prep prepareResponse
+	err = json.Unmarshal(do(req, http.StatusOK), &prep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(prep.Params, []string{"$route", "$time"}) {
+		t.Errorf("unexpected parameters %v", prep.Params)
+	}
+	// the statement was planned when it was
+	// prepared, and executions re-use the plan
+	// until the tables it references change
+	s.stmts.lock.Lock()
+	st := s.stmts.stmts[prep.Statement]
+	s.stmts.lock.Unlock()
+	st.lock.Lock()
+	planned := st.plan
+	st.lock.Unlock()
+	if planned == nil {
+		t.Fatal("statement was not planned")
+	}
+	for _, args := range []struct {
+		params, result string
+	}{
+		{`{"route": "2A75", "time": 945}`, want},
+		{`{"route": "2A75", "time": 0}`, `[]`},
+		// re-use the same statement with the same
+		// parameters after it has been planned
+		{`{"route": "2A75", "time": 945}`, want},
+	} {
+		req = rq.get("/executeQuery?" + url.Values{
+			"statement": {prep.Statement},
+			"params":    {args.params},
+		}.Encode())
+		if got := string(do(req, http.StatusOK)); got != args.result {
+			t.Errorf("params %s: got %q, want %q", args.params, got, args.result)
+		}
+		st.lock.Lock()
+		cur := st.plan
+		st.lock.Unlock()
+		if cur != planned {
+			t.Errorf("params %s: statement was planned again", args.params)
+		}
+	}
+	// simulate a change to the table
+	st.lock.Lock()
+	st.hash = []byte("stale")
+	st.lock.Unlock()
+	req = rq.get("/executeQuery?" + url.Values{
+		"statement": {prep.Statement},
+		"params":    {`{"route": "2A75", "time": 945}`},
+	}.Encode())
+	if got := string(do(req, http.StatusOK)); got != want {
+		t.Errorf("after re-planning: got %q, want %q", got, want)
+	}
+	st.lock.Lock()
+	replanned, hash := st.plan, st.hash
+	st.lock.Unlock()
+	if replanned == nil || replanned == planned || string(hash) == "stale" {
+		t.Error("stale statement was not planned again")
+	}
+
+	// missing and unknown parameters are rejected
+	req = rq.get("/executeQuery?" + url.Values{
+		"statement": {prep.Statement},
+		"params":    {`{"route": "2A75"}`},
+	}.Encode())
+	do(req, http.StatusBadRequest)
+	req = rq.get("/executeQuery?" + url.Values{
+		"statement": {prep.Statement},
+		"params":    {`{"route": "2A75", "time": 945, "other": 1}`},
+	}.Encode())
+	do(req, http.StatusBadRequest)
+
+	req, err = http.NewRequest(http.MethodDelete, rq.host+"/prepare?statement="+prep.Statement, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	do(req, http.StatusNoContent)
+	req = rq.get("/executeQuery?statement=" + prep.Statement)
+	do(req, http.StatusNotFound)
+}
+
+// configTenant is a db.Tenant
+// with a db.TenantConfig
+type configTenant struct {
+	db.Tenant
+	cfg *db.TenantConfig
+}
+
+func (c configTenant) Config() *db.TenantConfig { return c.cfg }
+
+func TestSchemaRowFilter(t *testing.T) {
+	tt := configTenant{
+		Tenant: testdirEnviron(t),
+		cfg: &db.TenantConfig{
+			Grants: []db.Grant{
+				{Database: "default", Table: "parking", Filter: "Make = 'HOND'"},
+				{Database: "default", Table: "*"},
+			},
+		},
+	}
+	s := &server{
+		logger: testlogger(t),
+		auth:   testAuth{tt},
+	}
+	rq := &requester{t: t, host: "http://localhost"}
+	schema := func(table string) *tableSchema {
+		w := httptest.NewRecorder()
+		s.schemaHandler(w, rq.getSchema("default", table))
+		if w.Code != http.StatusOK {
+			t.Fatalf("get schema of %s: %d %s", table, w.Code, w.Body.String())
+		}
+		ret := new(tableSchema)
+		if err := json.NewDecoder(w.Body).Decode(ret); err != nil {
+			t.Fatal(err)
+		}
+		return ret
+	}
+	// the shape describes the rows that
+	// the row filter hides as well
+	if ret := schema("parking"); ret.Shape != nil {
+		t.Errorf("got shape %+v for a table with a row filter", ret.Shape)
+	}
+	if ret := schema("parking2"); ret.Shape == nil {
+		t.Error("no shape for a table without a row filter")
+	}
 }
@@ -28,9 +28,9 @@ import (
 	"time"
 
 	"github.com/SnellerInc/sneller"
+	"github.com/SnellerInc/sneller/cgroup"
 	"github.com/SnellerInc/sneller/db"
 	"github.com/SnellerInc/sneller/expr"
-	"github.com/SnellerInc/sneller/expr/partiql"
 	"github.com/SnellerInc/sneller/ion"
 	"github.com/SnellerInc/sneller/plan"
 	"github.com/SnellerInc/sneller/plan/pir"
@@ -76,9 +76,10 @@ func setError(w http.ResponseWriter) {
 	w.Header().Set("Server-Timing", "error;desc=\"Query Execution Error\"")
 }
 
-func setTiming(w http.ResponseWriter, elapsed time.Duration, stats *plan.ExecStats) {
-	w.Header().Add("Server-Timing", fmt.Sprintf("exec;dur=%g, miss;desc=\"Cache Misses\";count=%d, hit;desc=\"Cache Hits\";count=%d, scanned;desc=\"Bytes Scanned\";count=%d",
-		float64(elapsed)/float64(time.Millisecond), stats.CacheMisses, stats.CacheHits, stats.BytesScanned))
+func setTiming(w http.ResponseWriter, elapsed time.Duration, stats *plan.ExecStats, tk *ticket) {
+	w.Header().Add("Server-Timing", fmt.Sprintf("exec;dur=%g, miss;desc=\"Cache Misses\";count=%d, hit;desc=\"Cache Hits\";count=%d, scanned;desc=\"Bytes Scanned\";count=%d, retry;desc=\"Retries\";count=%d, queue;desc=\"Queue Wait\";dur=%g;count=%d",
+		float64(elapsed)/float64(time.Millisecond), stats.CacheMisses, stats.CacheHits, stats.BytesScanned, stats.Retries,
+		float64(tk.wait)/float64(time.Millisecond), tk.depth))
 }
 
 // after 15 minutes, stop waiting for a result
@@ -88,6 +89,7 @@ const queryKillTimeout = 15 * time.Minute
 // example invocation:
 // curl -v -H 'Authorization: sneller' -H 'Accept: application/ion' 'http://localhost:8080/executeQuery?database=sf1-new&query=SELECT%20%2A%20FROM%20nation%20LIMIT%2010'
 // curl -v -X POST -H 'Authorization: sneller' -H 'Accept: application/ion' --data-raw 'SELECT * FROM nation LIMIT 10' 'http://localhost:8080/executeQuery?database=sf1-new'
+// curl -v -X POST -H 'Authorization: sneller' -H 'Content-Type: application/json' --data-raw '{"query": "SELECT * FROM nation WHERE n_name = ?", "params": ["FRANCE"]}' 'http://localhost:8080/executeQuery?database=sf1-new'
 func (s *server) executeQueryHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	start := time.Now()
@@ -97,25 +99,27 @@ func (s *server) executeQueryHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	authElapsed := time.Since(start)
 	tenantID := creds.ID()
+	queryID := uuid.New()
 
-	var query []byte
-	switch r.Method {
-	case http.MethodGet, http.MethodHead:
-		str := r.URL.Query().Get("query")
-		if str == "" {
-			http.Error(w, "no query parameter", http.StatusBadRequest)
-			return
+	// HEAD requests don't run the query,
+	// so they are not audited
+	var audit *auditRecord
+	if r.Method != http.MethodHead {
+		audit = &auditRecord{
+			id:       queryID.String(),
+			tenant:   tenantID,
+			subject:  db.Subject(creds),
+			protocol: "http",
+			start:    start,
 		}
-		query = []byte(str)
+	}
+	defer func() { s.audit.log(creds, audit) }()
 
-	case http.MethodPost:
-		// restrict the size of the query text to something reasonable
-		body := http.MaxBytesReader(w, r.Body, 128*1024*1024)
-		query, err = io.ReadAll(body)
-		if err != nil {
-			http.Error(w, "cannot read query", http.StatusBadRequest)
-			return
-		}
+	req, err := readQueryRequest(w, r)
+	if err != nil {
+		audit.set(auditError, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	// Determine the output format
@@ -127,7 +131,9 @@ func (s *server) executeQueryHandler(w http.ResponseWriter, r *http.Request) {
 		encodingFormat = tnproto.OutputChunkedJSON
 	case "application/ion":
 		if explicitJSON {
-			http.Error(w, fmt.Sprintf("can't request JSON and explicitly accept %q", acceptHeader), http.StatusBadRequest)
+			err := fmt.Errorf("can't request JSON and explicitly accept %q", acceptHeader)
+			audit.set(auditError, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 		encodingFormat = tnproto.OutputChunkedIon
@@ -143,69 +149,70 @@ func (s *server) executeQueryHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	default:
 		s.logger.Printf("invalid accept header value %q", acceptHeader)
+		audit.set(auditError, fmt.Errorf("invalid Accept header %q", acceptHeader))
 		http.Error(w, "invalid 'Accept' header", http.StatusBadRequest)
 		return
 	}
 
-	defaultDatabase := r.URL.Query().Get("database")
-	parsedQuery, err := partiql.Parse(query)
+	prio, err := parsePriority(r)
 	if err != nil {
+		audit.set(auditError, err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	err = parsedQuery.Check()
-	if err != nil {
+
+	execLim := execLimits(creds)
+	if err := parseLimits(r, &execLim); err != nil {
+		audit.set(auditError, err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	normalized := parsedQuery.Text()
-	redacted := parsedQuery.Text()
+	parsed, err := s.parseQuery(tenantID, r.URL.Query().Get("database"), req)
+	if err != nil {
+		audit.set(auditError, err)
+		if errors.Is(err, errNoStatement) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
 
-	var id tnproto.ID
-	var key tnproto.Key
-	hash := sha256.Sum256([]byte(tenantID))
-	copy(id[:], hash[:])
-	hash = sha256.Sum256([]byte(tenantID + string(creds.Key()[:])))
-	copy(key[:], hash[:])
+	parsedQuery, defaultDatabase := parsed.query, parsed.database
+	normalized := parsedQuery.Text()
+	redacted := parsedQuery.Redacted()
+	if audit != nil {
+		audit.database = defaultDatabase
+		audit.query = redacted
+	}
 
-	// determine scan limit
-	maxScan := uint64(DefaultMaxScan)
-	if ct, ok := creds.(db.TenantConfigurable); ok {
-		cfg := ct.Config()
-		if cfg != nil && cfg.MaxScanBytes > 0 {
-			maxScan = cfg.MaxScanBytes
-		}
+	id, key := tenantKeys(creds)
+	maxScan, limits, maxConcurrency := tenantLimits(creds)
+	if execLim.MaxScan > 0 && (maxScan == 0 || uint64(execLim.MaxScan) < maxScan) {
+		maxScan = uint64(execLim.MaxScan)
 	}
 
 	planEnv, err := sneller.Environ(creds, defaultDatabase)
 	if err != nil {
+		audit.set(auditRejected, err)
 		http.Error(w, "tenant ID disallowed", http.StatusForbidden)
 		s.logger.Printf("refusing query: %s", err)
 		return
 	}
-	endPoints := s.peers.Get()
 
-	queryID := uuid.New()
 	w.Header().Add("X-Sneller-Query-ID", queryID.String())
 
-	var tree *plan.Tree
 	start = time.Now()
-	if len(endPoints) == 0 {
-		// TODO: apply scan limits to unsplit
-		// queries
-		tree, err = plan.New(parsedQuery, planEnv)
-	} else {
-		split := s.newSplitter(id, key, endPoints)
-		tree, err = plan.NewSplit(parsedQuery, planEnv, split)
-		if err == nil {
-			w.Header().Set("X-Sneller-Max-Scanned-Bytes", utoa(split.MaxScan))
-			if maxScan > 0 && split.MaxScan > maxScan {
-				err = &errPlanLimit{scan: split.MaxScan, max: maxScan}
-			}
-		}
+	tree, split, err := s.planQuery(parsedQuery, parsed.prepared(planEnv), parsed.bindings, planEnv, id, key, maxScan, limits)
+	if split != nil {
+		w.Header().Set("X-Sneller-Max-Scanned-Bytes", utoa(split.MaxScan))
+	}
+	if audit != nil {
+		audit.tables = planEnv.Tables()
 	}
 	if err != nil {
+		audit.set(planStatus(err), err)
 		s.logger.Printf("tenant %s query ID %s planning failed: %s", tenantID, queryID, err)
 		planError(w, err)
 		return
@@ -235,6 +242,7 @@ func (s *server) executeQueryHandler(w http.ResponseWriter, r *http.Request) {
 			for _, matchEtag := range strings.Split(ifNoneMatch, ",") {
 				matchEtag = strings.TrimSpace(matchEtag)
 				if eTag == matchEtag {
+					audit.set(auditNotModified, nil)
 					w.WriteHeader(http.StatusNotModified)
 					return
 				}
@@ -245,11 +253,13 @@ func (s *server) executeQueryHandler(w http.ResponseWriter, r *http.Request) {
 			if ifModifiedSince != "" {
 				ifModifiedSinceTime, err := time.Parse(http.TimeFormat, ifModifiedSince)
 				if err != nil {
+					audit.set(auditError, err)
 					w.WriteHeader(http.StatusBadRequest)
 					return
 				}
 
 				if !newestBlobTime.After(ifModifiedSinceTime) {
+					audit.set(auditNotModified, nil)
 					w.WriteHeader(http.StatusNotModified)
 					return
 				}
@@ -262,6 +272,20 @@ func (s *server) executeQueryHandler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
+
+	// wait for a query slot
+	tk, err := s.admit.acquire(ctx, tenantID, maxConcurrency, prio)
+	if err != nil {
+		s.logger.Printf("tenant %s query ID %s (%s) not admitted: %s", tenantID, queryID, prio, err)
+		audit.set(auditRejected, err)
+		s.admit.admissionError(w, err)
+		return
+	}
+	defer tk.release()
+	if tk.wait > 0 {
+		s.logger.Printf("tenant %s query ID %s (%s) queued behind %d for %s", tenantID, queryID, prio, tk.depth, tk.wait)
+	}
+
 	sendTrailer := contains(r.Header.Values("TE"), "trailers")
 	if sendTrailer {
 		w.Header().Add("Trailer", "Server-Timing")
@@ -273,8 +297,20 @@ func (s *server) executeQueryHandler(w http.ResponseWriter, r *http.Request) {
 		res:   w,
 	}
 	startrun := time.Now()
-	rc, err := s.manager.Do(id, key, tree, encodingFormat, conn)
+	if err := s.manager.SetLimits(id, limits); err != nil {
+		audit.set(auditError, err)
+		s.logger.Printf("tenant %s query ID %s: updating resource limits: %s", tenantID, queryID, err)
+		w.Header().Del("Trailer")
+		http.Error(w, "couldn't apply resource limits", http.StatusInternalServerError)
+		return
+	}
+	rc, err := s.manager.DoWithLimits(id, key, tree, &execLim, encodingFormat, conn)
 	if err != nil {
+		if errors.Is(err, tenant.ErrOverloaded) {
+			audit.set(auditRejected, err)
+		} else {
+			audit.set(auditError, err)
+		}
 		if !conn.hijacked {
 			// didn't call w.WriteHeader() yet;
 			// we can write a plaintext error
@@ -304,6 +340,9 @@ func (s *server) executeQueryHandler(w http.ResponseWriter, r *http.Request) {
 	var stats plan.ExecStats
 	deadlined := setDeadline(rc, queryKillTimeout)
 	err = tenant.Check(rc, &stats)
+	if audit != nil {
+		audit.stats = stats
+	}
 	if err != nil {
 		canceled := false
 		if ctxerr := r.Context().Err(); ctxerr != nil {
@@ -315,9 +354,23 @@ func (s *server) executeQueryHandler(w http.ResponseWriter, r *http.Request) {
 			setError(w)
 		}
 		if canceled {
+			audit.set(auditCanceled, err)
 			s.logger.Printf("tenant %s query ID %s canceled after %s", tenantID, queryID, time.Since(startrun))
 			return
 		}
+		var lerr *plan.LimitError
+		if errors.As(err, &lerr) {
+			// the tenant has already written
+			// the error to the output stream
+			audit.set(auditError, err)
+			s.logger.Printf("tenant %s query ID %s aborted after %s: %s (bytes %d)", tenantID, queryID, time.Since(startrun), err, stats.BytesScanned)
+			return
+		}
+		if errors.Is(err, tenant.ErrOOMKilled) && encodingFormat == tnproto.OutputChunkedIon {
+			// the tenant couldn't report this error itself
+			writeError(w, err.Error())
+		}
+		audit.set(auditError, err)
 		s.logger.Printf("tenant %s query ID %s %q execution failed (check): %v", tenantID, queryID, redacted, err)
 		if deadlined && isTimeout(err) {
 			s.logger.Printf("tenant %s query ID %s killing tenant worker %s due to timeout", tenantID, queryID, id)
@@ -325,15 +378,134 @@ func (s *server) executeQueryHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	audit.set(auditOK, nil)
 	elapsed := time.Since(startrun)
 	if sendTrailer {
-		setTiming(w, elapsed, &stats)
+		setTiming(w, elapsed, &stats, tk)
 	}
 	if encodingFormat == tnproto.OutputChunkedIon {
-		writeStatus(w, &stats)
+		writeStatus(w, &stats, tk)
 	}
-	s.logger.Printf("tenant %s query ID %s duration %s bytes %d hits %d misses %d",
-		tenantID, queryID, elapsed, stats.BytesScanned, stats.CacheHits, stats.CacheMisses)
+	s.logger.Printf("tenant %s query ID %s duration %s bytes %d hits %d misses %d retries %d",
+		tenantID, queryID, elapsed, stats.BytesScanned, stats.CacheHits, stats.CacheMisses, stats.Retries)
+}
+
+// tenantKeys returns the tenant process ID
+// and key used to run queries for creds
+func tenantKeys(creds db.Tenant) (tnproto.ID, tnproto.Key) {
+	var id tnproto.ID
+	var key tnproto.Key
+	tenantID := creds.ID()
+	hash := sha256.Sum256([]byte(tenantID))
+	copy(id[:], hash[:])
+	hash = sha256.Sum256([]byte(tenantID + string(creds.Key()[:])))
+	copy(key[:], hash[:])
+	return id, key
+}
+
+// tenantLimits returns the scan limit, the resource
+// limits and the concurrency limit that apply to
+// the queries of creds
+func tenantLimits(creds db.Tenant) (maxScan uint64, limits *cgroup.Limits, maxConcurrency int) {
+	maxScan = DefaultMaxScan
+	if ct, ok := creds.(db.TenantConfigurable); ok {
+		cfg := ct.Config()
+		if cfg != nil && cfg.MaxScanBytes > 0 {
+			maxScan = cfg.MaxScanBytes
+		}
+		if cfg != nil {
+			limits = cfg.Limits
+			maxConcurrency = cfg.MaxConcurrency
+		}
+	}
+	return maxScan, limits, maxConcurrency
+}
+
+// execLimits returns the limits enforced
+// while the queries of creds execute
+func execLimits(creds db.Tenant) plan.Limits {
+	var lim plan.Limits
+	if ct, ok := creds.(db.TenantConfigurable); ok {
+		if cfg := ct.Config(); cfg != nil {
+			lim.Timeout = cfg.QueryTimeout
+			lim.MaxScan = int64(cfg.MaxScanBytes)
+		}
+	}
+	return lim
+}
+
+// parseLimits applies the timeout and max_scan_bytes
+// parameters of r to lim; a request may only lower
+// the limits that already apply to it
+//
+// The timeout is either a duration like "30s"
+// or a plain number of seconds.
+func parseLimits(r *http.Request, lim *plan.Limits) error {
+	q := r.URL.Query()
+	if str := q.Get("timeout"); str != "" {
+		d, err := time.ParseDuration(str)
+		if err != nil {
+			secs, serr := strconv.ParseFloat(str, 64)
+			if serr != nil {
+				return fmt.Errorf("invalid timeout %q", str)
+			}
+			d = time.Duration(secs * float64(time.Second))
+		}
+		if d <= 0 {
+			return fmt.Errorf("invalid timeout %q", str)
+		}
+		if lim.Timeout == 0 || d < lim.Timeout {
+			lim.Timeout = d
+		}
+	}
+	if str := q.Get("max_scan_bytes"); str != "" {
+		n, err := strconv.ParseInt(str, 10, 64)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid max_scan_bytes %q", str)
+		}
+		if lim.MaxScan == 0 || n < lim.MaxScan {
+			lim.MaxScan = n
+		}
+	}
+	return nil
+}
+
+// planQuery plans q, splitting it across the
+// current set of peers if there are any.
+// The returned splitter is nil if the query
+// was not split.
+// If a split query may scan more than maxScan bytes
+// (and maxScan is non-zero), planQuery returns
+// an *errPlanLimit. The resource limits are sent
+// to the peers along with each remote request.
+//
+// If prep is non-nil, it is the plan of the
+// prepared statement that q was bound from,
+// and the tree is produced by binding b to it
+// rather than by planning q.
+func (s *server) planQuery(q *expr.Query, prep *plan.Prepared, b *expr.Bindings, env *sneller.FSEnv, id tnproto.ID, key tnproto.Key, maxScan uint64, limits *cgroup.Limits) (*plan.Tree, *sneller.Splitter, error) {
+	newSplit := func(split plan.Splitter) (*plan.Tree, error) {
+		if prep != nil {
+			return prep.NewSplit(b, env, split)
+		}
+		return plan.NewSplit(q, env, split)
+	}
+	endPoints := s.peers.Get()
+	if len(endPoints) == 0 {
+		// TODO: apply scan limits to unsplit
+		// queries
+		tree, err := newSplit(nil)
+		return tree, nil, err
+	}
+	split := s.newSplitter(id, key, endPoints, limits)
+	tree, err := newSplit(split)
+	if err != nil {
+		return nil, nil, err
+	}
+	if maxScan > 0 && split.MaxScan > maxScan {
+		return nil, split, &errPlanLimit{scan: split.MaxScan, max: maxScan}
+	}
+	return tree, split, nil
 }
 
 // satisfied by net.Conn and friends
@@ -404,6 +576,11 @@ func planError(w http.ResponseWriter, err error) {
 		io.WriteString(w, "table does not exist\n")
 		return
 	}
+	if errors.Is(err, fs.ErrPermission) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, "access to table denied\n")
+		return
+	}
 	if isBadQuery(err, w) {
 		return
 	}
@@ -427,13 +604,25 @@ func writeError(w http.ResponseWriter, errtext string) {
 	w.Write(tmp.Bytes())
 }
 
-func writeStatus(w http.ResponseWriter, stats *plan.ExecStats) {
-	var tmp ion.Buffer
+func writeStatus(w http.ResponseWriter, stats *plan.ExecStats, tk *ticket) {
+	var tmp, stat, queue ion.Buffer
 	var st ion.Symtab
 	resultsym := st.Intern("final_status")
+	stats.Encode(&stat, &st)
+	// the queue fields are interned after
+	// the fields of the stats, so appending
+	// them keeps the fields in symbol order
+	queue.BeginStruct(-1)
+	queue.BeginField(st.Intern("queue_depth"))
+	queue.WriteInt(int64(tk.depth))
+	queue.BeginField(st.Intern("queue_wait"))
+	queue.WriteFloat64(tk.wait.Seconds())
+	queue.EndStruct()
+	fields, _ := ion.Contents(stat.Bytes())
+	extra, _ := ion.Contents(queue.Bytes())
 	tmp.BeginAnnotation(1)
 	tmp.BeginField(resultsym)
-	stats.Encode(&tmp, &st)
+	tmp.UnsafeAppendFields(append(fields, extra...))
 	tmp.EndAnnotation()
 	split := tmp.Size()
 	st.Marshal(&tmp, true)
@@ -69,7 +69,7 @@ func (s *server) inputsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "couldn't open db+table", http.StatusInternalServerError)
 		return
 	}
-	idx, err := db.OpenIndex(root, databaseName, tableName, tenant.Key())
+	idx, err := db.OpenIndexFor(root, databaseName, tableName, tenant, 0)
 	if err != nil {
 		s.logger.Printf("handling /inputs: OpenIndex: %s", err)
 		http.Error(w, "couldn't open index file", http.StatusInternalServerError)
@@ -0,0 +1,386 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SnellerInc/sneller"
+	"github.com/SnellerInc/sneller/expr"
+	"github.com/SnellerInc/sneller/expr/partiql"
+	"github.com/SnellerInc/sneller/ion"
+	"github.com/SnellerInc/sneller/plan"
+	"github.com/google/uuid"
+)
+
+// maxQueryBody is the maximum size
+// of the body of a query request
+const maxQueryBody = 128 * 1024 * 1024
+
+// defaultMaxStatements is the default
+// number of prepared statements that
+// are retained by a server
+const defaultMaxStatements = 4096
+
+// queryRequest is the query text,
+// prepared statement and parameters
+// supplied to executeQuery or prepare
+type queryRequest struct {
+	text      []byte
+	statement string
+	params    ion.Datum
+}
+
+// readQueryRequest reads the query text,
+// statement ID and parameters of r.
+//
+// The query text is read from the 'query' URL
+// parameter of a GET request or the body of a
+// POST request, the statement ID is read from
+// the 'statement' URL parameter, and parameters
+// are read from the 'params' URL parameter as JSON.
+// If the body of a POST request has the content type
+// application/json or application/ion, the body
+// is a structure with "query", "statement"
+// and "params" fields instead.
+func readQueryRequest(w http.ResponseWriter, r *http.Request) (*queryRequest, error) {
+	args := r.URL.Query()
+	req := &queryRequest{statement: args.Get("statement")}
+	if str := args.Get("params"); str != "" {
+		var st ion.Symtab
+		d, err := ion.FromJSON(&st, json.NewDecoder(strings.NewReader(str)))
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse params: %w", err)
+		}
+		req.params = d
+	}
+	if r.Method != http.MethodPost {
+		req.text = []byte(args.Get("query"))
+		return req, nil
+	}
+	// restrict the size of the query text to something reasonable
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxQueryBody))
+	if err != nil {
+		return nil, errors.New("cannot read query")
+	}
+	ctype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch ctype {
+	case "application/json":
+		var st ion.Symtab
+		d, err := ion.FromJSON(&st, json.NewDecoder(bytes.NewReader(body)))
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse request body: %w", err)
+		}
+		return req, req.setBody(d)
+	case "application/ion":
+		var st ion.Symtab
+		d, _, err := ion.ReadDatum(&st, body)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse request body: %w", err)
+		}
+		return req, req.setBody(d)
+	}
+	req.text = body
+	return req, nil
+}
+
+// setBody sets the fields of req
+// from the structure in a request body
+func (req *queryRequest) setBody(d ion.Datum) error {
+	s, ok := d.Struct()
+	if !ok {
+		return errors.New("request body is not a structure")
+	}
+	return s.Each(func(f ion.Field) bool {
+		switch f.Label {
+		case "query":
+			str, _ := f.Value.String()
+			req.text = []byte(str)
+		case "statement":
+			req.statement, _ = f.Value.String()
+		case "params":
+			req.params = f.Value
+		}
+		return true
+	})
+}
+
+// bindings returns the parameter
+// bindings of req, or nil if there are none
+func (req *queryRequest) bindings() (*expr.Bindings, error) {
+	if req.params.Empty() {
+		return nil, nil
+	}
+	return expr.NewBindings(req.params)
+}
+
+// prepared is a statement that
+// has been parsed by prepareHandler
+type prepared struct {
+	tenant   string
+	database string
+	query    *expr.Query
+	used     time.Time
+
+	// lock protects the fields below
+	lock sync.Mutex
+	// plan is the statement planned without
+	// its parameters bound, or nil if it
+	// cannot be planned until they are bound
+	plan *plan.Prepared
+	// tables are the tables that were referenced
+	// when the statement was planned (see FSEnv.Tables),
+	// and hash is the hash of their state (see FSEnv.CacheValues)
+	tables []string
+	hash   []byte
+}
+
+// planned returns the plan for the statement,
+// planning it again using env if any of the
+// tables it references have changed since it
+// was planned. If the statement cannot be
+// planned before its parameters are bound,
+// planned returns nil.
+func (p *prepared) planned(env *sneller.FSEnv) *plan.Prepared {
+	p.lock.Lock()
+	pp, tables, hash := p.plan, p.tables, p.hash
+	p.lock.Unlock()
+	if hash != nil && env.Load(tables) == nil {
+		if cur, _ := env.CacheValues(); bytes.Equal(cur, hash) {
+			return pp
+		}
+	}
+	pp, err := plan.Prepare(p.query, env)
+	if err != nil {
+		pp = nil
+	}
+	hash, _ = env.CacheValues()
+	p.lock.Lock()
+	p.plan, p.tables, p.hash = pp, env.Tables(), hash
+	p.lock.Unlock()
+	return pp
+}
+
+// stmtCache holds prepared statements
+// by statement ID; the zero value is
+// an empty cache that holds up to
+// defaultMaxStatements statements
+type stmtCache struct {
+	lock  sync.Mutex
+	max   int
+	stmts map[string]*prepared
+}
+
+// put adds p to the cache and returns its
+// statement ID; if the cache is full, the
+// least-recently-used statement is evicted
+func (c *stmtCache) put(p *prepared) string {
+	id := uuid.New().String()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.stmts == nil {
+		c.stmts = make(map[string]*prepared)
+	}
+	max := c.max
+	if max <= 0 {
+		max = defaultMaxStatements
+	}
+	if len(c.stmts) >= max {
+		oldest := ""
+		for k, v := range c.stmts {
+			if oldest == "" || v.used.Before(c.stmts[oldest].used) {
+				oldest = k
+			}
+		}
+		delete(c.stmts, oldest)
+	}
+	p.used = time.Now()
+	c.stmts[id] = p
+	return id
+}
+
+// get returns the statement with the given
+// ID if it was prepared by the tenant
+func (c *stmtCache) get(tenant, id string) (*prepared, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	p, ok := c.stmts[id]
+	if !ok || p.tenant != tenant {
+		return nil, false
+	}
+	p.used = time.Now()
+	return p, true
+}
+
+// drop removes the statement with the given ID
+// and returns whether it was prepared by the tenant
+func (c *stmtCache) drop(tenant, id string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	p, ok := c.stmts[id]
+	if !ok || p.tenant != tenant {
+		return false
+	}
+	delete(c.stmts, id)
+	return true
+}
+
+// parsedQuery is a query with its parameters bound
+type parsedQuery struct {
+	query    *expr.Query
+	database string
+	// stmt is the prepared statement that
+	// the query was bound from, if any, and
+	// bindings are the values of its parameters
+	stmt     *prepared
+	bindings *expr.Bindings
+}
+
+// parseQuery returns the query for req
+// with its parameters bound. If req refers
+// to a prepared statement, the database that
+// the statement was prepared with is used
+// if database is empty.
+func (s *server) parseQuery(tenant, database string, req *queryRequest) (*parsedQuery, error) {
+	var q *expr.Query
+	var stmt *prepared
+	if req.statement != "" {
+		if len(req.text) > 0 {
+			return nil, errors.New("cannot supply both a query and a statement")
+		}
+		p, ok := s.stmts.get(tenant, req.statement)
+		if !ok {
+			return nil, errNoStatement
+		}
+		q, stmt = p.query, p
+		if database == "" {
+			database = p.database
+		}
+	} else {
+		if len(req.text) == 0 {
+			return nil, errors.New("no query parameter")
+		}
+		var err error
+		q, err = partiql.Parse(req.text)
+		if err != nil {
+			return nil, err
+		}
+	}
+	b, err := req.bindings()
+	if err != nil {
+		return nil, err
+	}
+	if b == nil && stmt != nil {
+		// planning may modify the query,
+		// so always bind a copy of a
+		// prepared statement
+		b = &expr.Bindings{}
+	}
+	if b != nil {
+		q, err = q.Bind(b)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := q.Check(); err != nil {
+		return nil, err
+	}
+	return &parsedQuery{query: q, database: database, stmt: stmt, bindings: b}, nil
+}
+
+// prepared returns the plan of the prepared
+// statement that pq was bound from, or nil if
+// pq must be planned from its text instead
+func (pq *parsedQuery) prepared(env *sneller.FSEnv) *plan.Prepared {
+	// the statement was planned
+	// with its own default database
+	if pq.stmt == nil || pq.database != pq.stmt.database {
+		return nil
+	}
+	return pq.stmt.planned(env)
+}
+
+var errNoStatement = errors.New("no such prepared statement")
+
+// prepareResponse is the response to
+// a successful prepare request
+type prepareResponse struct {
+	Statement string   `json:"statement"`
+	Params    []string `json:"params"`
+}
+
+// example invocation:
+// curl -v -X POST -H 'Authorization: Bearer ...' --data-raw 'SELECT * FROM nation WHERE n_name = $name' 'http://localhost:8080/prepare?database=sf1-new'
+// curl -v -X DELETE -H 'Authorization: Bearer ...' 'http://localhost:8080/prepare?statement=...'
+func (s *server) prepareHandler(w http.ResponseWriter, r *http.Request) {
+	creds, err := s.getTenant(r.Context(), w, r)
+	if err != nil {
+		return
+	}
+	tenantID := creds.ID()
+	if r.Method == http.MethodDelete {
+		id := r.URL.Query().Get("statement")
+		if !s.stmts.drop(tenantID, id) {
+			http.Error(w, errNoStatement.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	req, err := readQueryRequest(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.text) == 0 {
+		http.Error(w, "no query", http.StatusBadRequest)
+		return
+	}
+	// the statement is checked when it is executed,
+	// since it cannot be checked until its
+	// parameters have been bound, but it is planned
+	// now if possible so that executions only
+	// need to bind their parameters to the plan
+	q, err := partiql.Parse(req.text)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params := q.Params()
+	res := prepareResponse{Params: make([]string, len(params))}
+	for i := range params {
+		res.Params[i] = expr.ToString(params[i])
+	}
+	p := &prepared{
+		tenant:   tenantID,
+		database: r.URL.Query().Get("database"),
+		query:    q,
+	}
+	if env, err := sneller.Environ(creds, p.database); err == nil {
+		p.planned(env)
+	}
+	res.Statement = s.stmts.put(p)
+	s.logger.Printf("tenant %s prepared statement %s", tenantID, res.Statement)
+	writeResultResponse(w, http.StatusOK, res)
+}
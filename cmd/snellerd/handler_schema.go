@@ -0,0 +1,108 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+
+	"github.com/SnellerInc/sneller/db"
+)
+
+// tableSchema is the response to /schema
+type tableSchema struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	// Schema is the declared schema, if any
+	Schema *db.Schema `json:"schema,omitempty"`
+	// Shape is the inferred shape, if any;
+	// it is omitted for tables with row filters
+	Shape *db.Shape `json:"shape,omitempty"`
+}
+
+func (s *server) schemaHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	tenant, err := s.getTenant(ctx, w, r)
+	if err != nil {
+		return
+	}
+
+	databaseName := r.URL.Query().Get("database")
+	if databaseName == "" {
+		http.Error(w, "no database", http.StatusBadRequest)
+		return
+	}
+	tableName := r.URL.Query().Get("table")
+	if tableName == "" {
+		http.Error(w, "no table", http.StatusBadRequest)
+		return
+	}
+	var masks []db.Mask
+	filtered := false
+	if tc, ok := tenant.(db.TenantConfigurable); ok {
+		grant, ok := tc.Config().Access(databaseName, tableName)
+		if !ok {
+			http.Error(w, "access to table denied", http.StatusForbidden)
+			return
+		}
+		if grant != nil {
+			masks = grant.Masks
+			filtered = grant.Filter != ""
+		}
+	}
+	root, err := tenant.Root()
+	if err != nil {
+		http.Error(w, "couldn't open db+table", http.StatusInternalServerError)
+		return
+	}
+
+	out := tableSchema{
+		Database: databaseName,
+		Table:    tableName,
+	}
+	def, err := db.OpenDefinition(root, databaseName, tableName)
+	if err == nil {
+		out.Schema = def.Schema
+		if out.Schema != nil {
+			out.Schema = out.Schema.Masked(masks)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		s.logger.Printf("handling /schema: OpenDefinition: %s", err)
+		http.Error(w, "couldn't open table definition", http.StatusInternalServerError)
+		return
+	}
+	out.Shape, err = db.OpenShape(root, databaseName, tableName)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		s.logger.Printf("handling /schema: OpenShape: %s", err)
+		http.Error(w, "couldn't open table shape", http.StatusInternalServerError)
+		return
+	}
+	if out.Shape != nil {
+		out.Shape = out.Shape.Masked(masks)
+	}
+	if def == nil && out.Shape == nil {
+		http.Error(w, "no such table", http.StatusNotFound)
+		return
+	}
+	if filtered {
+		// the shape describes every row in the
+		// table, including the rows that the
+		// row filter of the grant hides
+		out.Shape = nil
+	}
+	writeResultResponse(w, http.StatusOK, &out)
+}
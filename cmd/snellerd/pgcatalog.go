@@ -0,0 +1,458 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/SnellerInc/sneller/db"
+	"github.com/SnellerInc/sneller/expr"
+	"github.com/SnellerInc/sneller/ion"
+	"github.com/SnellerInc/sneller/plan"
+	"github.com/SnellerInc/sneller/vm"
+)
+
+// transaction control statements are accepted
+// (and ignored) since every query is read-only
+var pgCommandTags = map[string]string{
+	"BEGIN":      "BEGIN",
+	"START":      "START TRANSACTION",
+	"COMMIT":     "COMMIT",
+	"END":        "COMMIT",
+	"ROLLBACK":   "ROLLBACK",
+	"ABORT":      "ROLLBACK",
+	"RESET":      "RESET",
+	"DISCARD":    "DISCARD ALL",
+	"DEALLOCATE": "DEALLOCATE",
+}
+
+var (
+	pgSetRegexp  = regexp.MustCompile(`(?is)^SET\s+(?:SESSION\s+|LOCAL\s+)?([a-z_.]+)\s*(?:=|\s+TO\s+)\s*(.*)$`)
+	pgShowRegexp = regexp.MustCompile(`(?is)^SHOW\s+([a-z_.]+)$`)
+	pgFuncRegexp = regexp.MustCompile(`(?is)^SELECT\s+(?:pg_catalog\.)?([a-z_]+)\s*(\(\s*\))?(?:\s+AS\s+("[^"]+"|[a-z_][a-z0-9_]*))?$`)
+)
+
+// session handles the statements that
+// only concern the session rather than
+// any tables; it returns false if the
+// statement in q is not one of them
+func (c *pgconn) session(q *pgquery) (bool, error) {
+	text := q.text
+	word := strings.ToUpper(strings.Fields(text)[0])
+	if tag, ok := pgCommandTags[word]; ok {
+		q.tag = tag
+		return true, nil
+	}
+	if m := pgSetRegexp.FindStringSubmatch(text); m != nil {
+		val := strings.TrimSpace(m[2])
+		val = strings.Trim(val, `'"`)
+		c.settings[strings.ToLower(m[1])] = val
+		q.tag = "SET"
+		return true, nil
+	}
+	if m := pgShowRegexp.FindStringSubmatch(text); m != nil {
+		name := strings.ToLower(m[1])
+		val, ok := c.settings[name]
+		if !ok {
+			return true, pgErrorf(pgUndefinedObject, "unrecognized configuration parameter %q", name)
+		}
+		q.static = []ion.Struct{row(name, ion.String(val))}
+		q.cols = []pgcol{{name: name, oid: pgText}}
+		return true, nil
+	}
+	if m := pgFuncRegexp.FindStringSubmatch(text); m != nil {
+		fn := strings.ToLower(m[1])
+		var val ion.Datum
+		var oid uint32 = pgText
+		switch fn {
+		case "version":
+			val = ion.String(fmt.Sprintf("PostgreSQL %s (Sneller %s)", pgServerVersion, version))
+		case "current_database", "current_catalog":
+			val = ion.String(c.catalog())
+		case "current_schema":
+			if c.dbname != "" {
+				val = ion.String(c.dbname)
+			} else {
+				val = ion.Null
+			}
+		case "current_user", "session_user", "user":
+			val = ion.String(c.settings["user"])
+		case "pg_backend_pid":
+			val = ion.Int(int64(c.pid))
+			oid = pgInt4
+		default:
+			return false, nil
+		}
+		if m[2] == "" && fn != "current_catalog" && !strings.HasSuffix(fn, "user") && fn != "current_schema" {
+			// only the SQL-standard functions
+			// may be called without parentheses
+			return false, nil
+		}
+		name := fn
+		if m[3] != "" {
+			name = strings.Trim(m[3], `"`)
+		}
+		q.static = []ion.Struct{row(name, val)}
+		q.cols = []pgcol{{name: name, oid: oid}}
+		return true, nil
+	}
+	return false, nil
+}
+
+// catalog returns the name of the
+// database the client connected to
+func (c *pgconn) catalog() string {
+	if name := c.params["database"]; name != "" {
+		return name
+	}
+	return "sneller"
+}
+
+func row(kv ...interface{}) ion.Struct {
+	fields := make([]ion.Field, 0, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		fields = append(fields, ion.Field{Label: kv[i].(string), Value: kv[i+1].(ion.Datum)})
+	}
+	return ion.NewStruct(nil, fields)
+}
+
+// pgCatalogs are the tables of the
+// information_schema and pg_catalog schemas
+var pgCatalogs = map[string]func(e *catalogEnv) ([]ion.Struct, error){
+	"information_schema.schemata": func(e *catalogEnv) ([]ion.Struct, error) {
+		dbs, err := e.databases()
+		if err != nil {
+			return nil, err
+		}
+		out := make([]ion.Struct, len(dbs))
+		for i := range dbs {
+			out[i] = row(
+				"catalog_name", ion.String(e.conn.catalog()),
+				"schema_name", ion.String(dbs[i]),
+				"schema_owner", ion.String(e.conn.settings["user"]),
+			)
+		}
+		return out, nil
+	},
+	"information_schema.tables": func(e *catalogEnv) ([]ion.Struct, error) {
+		var out []ion.Struct
+		err := e.tables(func(dbname, table string) error {
+			out = append(out, row(
+				"table_catalog", ion.String(e.conn.catalog()),
+				"table_schema", ion.String(dbname),
+				"table_name", ion.String(table),
+				"table_type", ion.String("BASE TABLE"),
+			))
+			return nil
+		})
+		return out, err
+	},
+	"information_schema.columns": func(e *catalogEnv) ([]ion.Struct, error) {
+		var out []ion.Struct
+		err := e.tables(func(dbname, table string) error {
+			cols, err := e.columns(dbname, table)
+			for i := range cols {
+				nullable := "YES"
+				if !cols[i].nullable {
+					nullable = "NO"
+				}
+				out = append(out, row(
+					"table_catalog", ion.String(e.conn.catalog()),
+					"table_schema", ion.String(dbname),
+					"table_name", ion.String(table),
+					"column_name", ion.String(cols[i].name),
+					"ordinal_position", ion.Int(int64(i+1)),
+					"data_type", ion.String(cols[i].typ),
+					"is_nullable", ion.String(nullable),
+				))
+			}
+			return err
+		})
+		return out, err
+	},
+	"pg_catalog.pg_namespace": func(e *catalogEnv) ([]ion.Struct, error) {
+		dbs, err := e.databases()
+		if err != nil {
+			return nil, err
+		}
+		out := make([]ion.Struct, len(dbs))
+		for i := range dbs {
+			out[i] = row(
+				"oid", ion.Int(int64(i+1)),
+				"nspname", ion.String(dbs[i]),
+			)
+		}
+		return out, nil
+	},
+	"pg_catalog.pg_tables": func(e *catalogEnv) ([]ion.Struct, error) {
+		var out []ion.Struct
+		err := e.tables(func(dbname, table string) error {
+			out = append(out, row(
+				"schemaname", ion.String(dbname),
+				"tablename", ion.String(table),
+				"tableowner", ion.String(e.conn.settings["user"]),
+			))
+			return nil
+		})
+		return out, err
+	},
+	"pg_catalog.pg_database": func(e *catalogEnv) ([]ion.Struct, error) {
+		return []ion.Struct{row(
+			"oid", ion.Int(1),
+			"datname", ion.String(e.conn.catalog()),
+		)}, nil
+	},
+}
+
+// catalogTable returns the name of the
+// catalog table referenced by tbl, if any
+func catalogTable(tbl expr.Node) (string, bool) {
+	p, ok := tbl.(*expr.Path)
+	if !ok {
+		return "", false
+	}
+	schema := strings.ToLower(p.First)
+	if schema != "information_schema" && schema != "pg_catalog" {
+		return "", false
+	}
+	d, ok := p.Rest.(*expr.Dot)
+	if !ok || d.Rest != nil {
+		return "", false
+	}
+	return schema + "." + strings.ToLower(d.Field), true
+}
+
+type tableFinder struct {
+	catalog, other int
+}
+
+func (t *tableFinder) Visit(n expr.Node) expr.Visitor {
+	if tbl, ok := n.(*expr.Table); ok {
+		if _, ok := catalogTable(tbl.Expr); ok {
+			t.catalog++
+		} else {
+			t.other++
+		}
+	}
+	return t
+}
+
+// catalogEnv returns the plan.Env used to
+// execute a query of catalog tables, or nil
+// if the query does not reference them
+func (c *pgconn) catalogEnv(q *expr.Query) (plan.Env, error) {
+	var tf tableFinder
+	expr.Walk(&tf, q.Body)
+	for i := range q.With {
+		expr.Walk(&tf, q.With[i].As)
+	}
+	if tf.catalog == 0 {
+		return nil, nil
+	}
+	if tf.other > 0 {
+		return nil, pgErrorf(pgFeatureNotSupp, "queries cannot combine catalog tables with other tables")
+	}
+	return &catalogEnv{conn: c}, nil
+}
+
+// catalogEnv is a plan.Env that serves the
+// catalog tables from memory
+type catalogEnv struct {
+	conn *pgconn
+	root fs.FS
+	cfg  *db.TenantConfig
+}
+
+// catalogHandle is a plan.TableHandle
+// for the rows of a catalog table
+type catalogHandle struct {
+	buf   []byte
+	align int
+}
+
+func (h *catalogHandle) Open(_ context.Context) (vm.Table, error) {
+	return vm.BufferTable(h.buf, h.align), nil
+}
+
+func (h *catalogHandle) Encode(dst *ion.Buffer, st *ion.Symtab) error {
+	return errors.New("cannot encode catalog tables")
+}
+
+const catalogAlign = 64 * 1024
+
+func (e *catalogEnv) Stat(tbl expr.Node, _ *plan.Hints) (plan.TableHandle, error) {
+	name, _ := catalogTable(tbl)
+	fn, ok := pgCatalogs[name]
+	if !ok {
+		return nil, pgErrorf(pgUndefinedTable, "relation %q does not exist", name)
+	}
+	rows, err := fn(e)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	cn := ion.Chunker{W: &out, Align: catalogAlign}
+	for i := range rows {
+		rows[i].Encode(&cn.Buffer, &cn.Symbols)
+		if err := cn.Commit(); err != nil {
+			return nil, err
+		}
+	}
+	if err := cn.Flush(); err != nil {
+		return nil, err
+	}
+	return &catalogHandle{buf: out.Bytes(), align: catalogAlign}, nil
+}
+
+func (e *catalogEnv) init() error {
+	if e.root != nil {
+		return nil
+	}
+	root, err := e.conn.creds.Root()
+	if err != nil {
+		return err
+	}
+	e.root = root
+	if tc, ok := e.conn.creds.(db.TenantConfigurable); ok {
+		e.cfg = tc.Config()
+	}
+	return nil
+}
+
+// databases lists the databases
+// of the tenant
+func (e *catalogEnv) databases() ([]string, error) {
+	if err := e.init(); err != nil {
+		return nil, err
+	}
+	return db.List(e.root)
+}
+
+// tables calls fn for each table
+// that the tenant may query
+func (e *catalogEnv) tables(fn func(dbname, table string) error) error {
+	dbs, err := e.databases()
+	if err != nil {
+		return err
+	}
+	for _, dbname := range dbs {
+		tables, err := db.Tables(e.root, dbname)
+		if err != nil {
+			return err
+		}
+		for _, table := range tables {
+			if _, ok := e.cfg.Access(dbname, table); !ok {
+				continue
+			}
+			if err := fn(dbname, table); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type catalogColumn struct {
+	name     string
+	typ      string
+	nullable bool
+}
+
+// pgTypeNames maps the type names of
+// db.SchemaField and db.FieldShape
+// to PostgreSQL type names
+var pgTypeNames = map[string]string{
+	"bool":      "boolean",
+	"int":       "bigint",
+	"float":     "double precision",
+	"decimal":   "numeric",
+	"string":    "text",
+	"timestamp": "timestamp with time zone",
+	"struct":    "json",
+	"list":      "json",
+	"blob":      "bytea",
+}
+
+func pgTypeName(typ string) string {
+	if name, ok := pgTypeNames[typ]; ok {
+		return name
+	}
+	return "text"
+}
+
+// columns returns the top-level columns of a table
+// from its declared schema or its inferred shape
+func (e *catalogEnv) columns(dbname, table string) ([]catalogColumn, error) {
+	def, err := db.OpenDefinition(e.root, dbname, table)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	var out []catalogColumn
+	if def != nil && def.Schema != nil {
+		for _, f := range def.Schema.Fields {
+			if strings.Contains(f.Path, ".") {
+				continue
+			}
+			out = append(out, catalogColumn{
+				name:     f.Path,
+				typ:      pgTypeName(f.Type),
+				nullable: f.Nullable || !f.Required,
+			})
+		}
+		return out, nil
+	}
+	shape, err := db.OpenShape(e.root, dbname, table)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for name, f := range shape.Fields {
+		if strings.Contains(name, ".") {
+			continue
+		}
+		// fields that are absent from
+		// some rows are nullable
+		seen := int64(0)
+		var types []string
+		for _, t := range f.Types() {
+			seen += f[t]
+			if t != "null" {
+				types = append(types, t)
+			}
+		}
+		typ := "text"
+		if len(types) == 1 {
+			typ = pgTypeName(types[0])
+		}
+		out = append(out, catalogColumn{
+			name:     name,
+			typ:      typ,
+			nullable: f["null"] > 0 || seen < shape.Total,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].name < out[j].name
+	})
+	return out, nil
+}
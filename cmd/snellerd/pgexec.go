@@ -0,0 +1,389 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/SnellerInc/sneller"
+	"github.com/SnellerInc/sneller/db"
+	"github.com/SnellerInc/sneller/expr"
+	"github.com/SnellerInc/sneller/expr/partiql"
+	"github.com/SnellerInc/sneller/ion"
+	"github.com/SnellerInc/sneller/plan"
+	"github.com/SnellerInc/sneller/plan/pir"
+	"github.com/SnellerInc/sneller/tenant"
+	"github.com/SnellerInc/sneller/tenant/tnproto"
+	"github.com/SnellerInc/sneller/usock"
+	"github.com/google/uuid"
+)
+
+// pgquery is a single statement
+// that is ready to be executed
+type pgquery struct {
+	text  string
+	empty bool
+	// tag is the command tag of
+	// a statement that returns no rows
+	tag string
+	// cols are the result columns;
+	// if they could not be determined
+	// before the query is executed,
+	// cols is nil until the first row
+	// has been produced
+	cols []pgcol
+	// static is the result of
+	// a session statement
+	static []ion.Struct
+	// query is the query to execute;
+	// if env is non-nil, the query is
+	// executed locally using env
+	// rather than by the tenant
+	query *expr.Query
+	env   plan.Env
+}
+
+func (q *pgquery) returnsRows() bool {
+	return !q.empty && q.tag == ""
+}
+
+// setcols sets the columns of q
+// from the fields of row
+func (q *pgquery) setcols(row ion.Struct) {
+	q.cols = []pgcol{}
+	row.Each(func(f ion.Field) bool {
+		q.cols = append(q.cols, pgcol{
+			name: f.Label,
+			oid:  typeOID(expr.TypeSet(1 << f.Value.Type())),
+		})
+		return true
+	})
+}
+
+// prepare parses a single statement
+// and determines its result columns
+func (c *pgconn) prepare(text string) (*pgquery, error) {
+	q := &pgquery{text: text}
+	if len(splitStatements(text)) == 0 {
+		q.empty = true
+		return q, nil
+	}
+	if ok, err := c.session(q); ok {
+		return q, err
+	}
+	parsed, err := partiql.Parse([]byte(text))
+	if err != nil {
+		return nil, pgErrorf(pgSyntaxError, "%s", err)
+	}
+	if err := parsed.Check(); err != nil {
+		var typ *expr.TypeError
+		if errors.As(err, &typ) {
+			return nil, pgErrorf(pgDatatypeMismatch, "%s", err)
+		}
+		return nil, pgErrorf(pgSyntaxError, "%s", err)
+	}
+	q.query = parsed
+	env, err := c.catalogEnv(parsed)
+	if err != nil {
+		return nil, err
+	}
+	q.env = env
+	if env == nil {
+		fsenv, err := sneller.Environ(c.creds, c.dbname)
+		if err != nil {
+			c.srv.logger.Printf("refusing postgres query: %s", err)
+			return nil, pgErrorf(pgPrivilege, "tenant ID disallowed")
+		}
+		env = fsenv
+	}
+	if parsed.Explain != expr.ExplainNone {
+		// the columns are determined
+		// by the output of the plan
+		return q, nil
+	}
+	// pir.Build may modify the query,
+	// so the types are computed using a copy
+	typed, err := partiql.Parse([]byte(text))
+	if err != nil {
+		return nil, pgErrorf(pgSyntaxError, "%s", err)
+	}
+	trace, err := pir.Build(typed, typeEnv{env})
+	if err != nil {
+		return nil, pgPlanError(err)
+	}
+	bind := trace.FinalBindings()
+	if len(bind) == 0 {
+		return q, nil
+	}
+	types := trace.FinalTypes()
+	q.cols = make([]pgcol, len(bind))
+	for i := range bind {
+		q.cols[i] = pgcol{name: bind[i].Result(), oid: typeOID(types[i])}
+	}
+	return q, nil
+}
+
+// typeEnv is the pir.Env used to
+// determine the result types of a query
+type typeEnv struct {
+	env plan.Env
+}
+
+func (t typeEnv) Schema(e expr.Node) expr.Hint {
+	if s, ok := t.env.(plan.Schemer); ok {
+		return s.Schema(e)
+	}
+	return nil
+}
+
+func (t typeEnv) Index(e expr.Node) (pir.Index, error) {
+	return nil, nil
+}
+
+// rows executes q and calls fn for each
+// row of the result; if fn returns errStopRows,
+// the query is stopped without an error
+func (c *pgconn) rows(q *pgquery, fn func(ion.Struct) error) error {
+	var err error
+	switch {
+	case q.static != nil:
+		for i := range q.static {
+			if err = fn(q.static[i]); err != nil {
+				break
+			}
+		}
+	case q.env != nil:
+		err = c.local(q, fn)
+	default:
+		err = c.dispatch(q, fn)
+	}
+	if err == errStopRows {
+		return nil
+	}
+	return err
+}
+
+// local executes a query in this process
+func (c *pgconn) local(q *pgquery, fn func(ion.Struct) error) error {
+	tree, err := plan.New(q.query, q.env)
+	if err != nil {
+		return pgPlanError(err)
+	}
+	var out bytes.Buffer
+	var stats plan.ExecStats
+	err = plan.Exec(tree, &out, &stats)
+	if err != nil {
+		return err
+	}
+	return readRows(&out, fn)
+}
+
+// dispatch executes a query using
+// the tenant process of the connection
+func (c *pgconn) dispatch(q *pgquery, fn func(ion.Struct) error) error {
+	s := c.srv
+	tenantID := c.creds.ID()
+	id, key := tenantKeys(c.creds)
+	maxScan, limits, maxConcurrency := tenantLimits(c.creds)
+	audit := &auditRecord{
+		id:       uuid.New().String(),
+		tenant:   tenantID,
+		subject:  db.Subject(c.creds),
+		protocol: "postgres",
+		database: c.dbname,
+		query:    q.query.Redacted(),
+		start:    time.Now(),
+	}
+	defer s.audit.log(c.creds, audit)
+	env, err := sneller.Environ(c.creds, c.dbname)
+	if err != nil {
+		audit.set(auditRejected, err)
+		s.logger.Printf("refusing postgres query: %s", err)
+		return pgErrorf(pgPrivilege, "tenant ID disallowed")
+	}
+	tree, _, err := s.planQuery(q.query, nil, nil, env, id, key, maxScan, limits)
+	audit.tables = env.Tables()
+	if err != nil {
+		audit.set(planStatus(err), err)
+		s.logger.Printf("tenant %s postgres query planning failed: %s", tenantID, err)
+		return pgPlanError(err)
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	tk, err := s.admit.acquire(ctx, tenantID, maxConcurrency, prioInteractive)
+	if err != nil {
+		audit.set(auditRejected, err)
+		return pgErrorf(pgTooManyQueries, "%s", err)
+	}
+	defer tk.release()
+	if err := s.manager.SetLimits(id, limits); err != nil {
+		audit.set(auditError, err)
+		s.logger.Printf("tenant %s: updating resource limits: %s", tenantID, err)
+		return err
+	}
+	here, there, err := usock.SocketPair()
+	if err != nil {
+		audit.set(auditError, err)
+		return err
+	}
+	defer here.Close()
+	lim := execLimits(c.creds)
+	rc, err := s.manager.DoWithLimits(id, key, tree, &lim, tnproto.OutputRaw, there)
+	// the tenant has its own copy of there
+	there.Close()
+	if err != nil {
+		if errors.Is(err, tenant.ErrOverloaded) {
+			audit.set(auditRejected, err)
+			return pgErrorf(pgTooManyQueries, "%s", err)
+		}
+		audit.set(auditError, err)
+		s.logger.Printf("tenant %s postgres query %q execution failed (do): %v", tenantID, audit.query, err)
+		return pgErrorf(pgInternalError, "error dispatching query")
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			rc.Close()
+			here.Close()
+		case <-done:
+		}
+	}()
+	deadlined := setDeadline(rc, queryKillTimeout)
+	rerr := readRows(here, fn)
+	if rerr != nil {
+		// stop the query
+		here.Close()
+	}
+	var stats plan.ExecStats
+	err = tenant.Check(rc, &stats)
+	audit.stats = stats
+	if ctx.Err() != nil {
+		audit.set(auditCanceled, ctx.Err())
+		return pgErrorf(pgQueryCanceled, "canceling statement due to user request")
+	}
+	if rerr != nil {
+		audit.set(auditError, rerr)
+		return rerr
+	}
+	var lerr *plan.LimitError
+	if errors.As(err, &lerr) {
+		audit.set(auditError, err)
+		s.logger.Printf("tenant %s postgres query aborted: %s (bytes %d)", tenantID, err, stats.BytesScanned)
+		if lerr.Timeout != 0 {
+			return pgErrorf(pgQueryCanceled, "canceling statement due to statement timeout")
+		}
+		return pgErrorf(pgLimitExceeded, "%s", err)
+	}
+	if err != nil {
+		audit.set(auditError, err)
+		s.logger.Printf("tenant %s postgres query %q execution failed (check): %v", tenantID, audit.query, err)
+		if deadlined && isTimeout(err) {
+			s.manager.Quit(id)
+		}
+		return pgErrorf(pgInternalError, "%s", err)
+	}
+	audit.set(auditOK, nil)
+	s.logger.Printf("tenant %s postgres query bytes %d hits %d misses %d",
+		tenantID, stats.BytesScanned, stats.CacheHits, stats.CacheMisses)
+	return nil
+}
+
+// readRows reads an ion stream from r
+// and calls fn for each structure
+func readRows(r io.Reader, fn func(ion.Struct) error) error {
+	rd := bufio.NewReaderSize(r, 64*1024)
+	var st ion.Symtab
+	var buf []byte
+	for {
+		_, size, err := ion.Peek(rd)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if cap(buf) < size {
+			buf = make([]byte, size)
+		}
+		item := buf[:size]
+		if _, err := io.ReadFull(rd, item); err != nil {
+			return err
+		}
+		if ion.IsBVM(item) {
+			// a new symbol table
+			if _, err := st.Unmarshal(item); err != nil {
+				return err
+			}
+			continue
+		}
+		switch ion.TypeOf(item) {
+		case ion.StructType:
+		case ion.AnnotationType:
+			// other annotations (i.e. query_error)
+			// are reported by the tenant separately
+			sym, _, _, err := ion.ReadAnnotation(item)
+			if err == nil && sym == ion.SystemSymSymbolTable {
+				if _, err := st.Unmarshal(item); err != nil {
+					return err
+				}
+			}
+			continue
+		default:
+			continue
+		}
+		d, _, err := ion.ReadDatum(&st, item)
+		if err != nil {
+			return err
+		}
+		s, _ := d.Struct()
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+}
+
+// pgPlanError converts an error from
+// planning a query into a pgError
+func pgPlanError(err error) error {
+	var syntax *expr.SyntaxError
+	var typ *expr.TypeError
+	var compile *pir.CompileError
+	var limit *errPlanLimit
+	var pe *pgError
+	switch {
+	case errors.As(err, &pe):
+		return pe
+	case errors.Is(err, fs.ErrNotExist):
+		return pgErrorf(pgUndefinedTable, "table does not exist")
+	case errors.Is(err, fs.ErrPermission):
+		return pgErrorf(pgPrivilege, "access to table denied")
+	case errors.As(err, &syntax):
+		return pgErrorf(pgSyntaxError, "%s", syntax.Error())
+	case errors.As(err, &typ):
+		return pgErrorf(pgDatatypeMismatch, "%s", typ.Error())
+	case errors.As(err, &compile):
+		return pgErrorf(pgSyntaxError, "%s", compile.Error())
+	case errors.As(err, &limit):
+		return pgErrorf(pgLimitExceeded, "%s", limit.Error())
+	}
+	return pgErrorf(pgInternalError, "couldn't create query plan")
+}
@@ -0,0 +1,555 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/SnellerInc/sneller/expr"
+	"github.com/SnellerInc/sneller/ion"
+)
+
+// pgstmt is a statement created with
+// a Parse message
+type pgstmt struct {
+	text   string
+	params []uint32 // parameter types ($1, $2, ...)
+	// q is the statement with all of
+	// the parameters bound to NULL;
+	// it is used to describe the statement
+	q *pgquery
+}
+
+// pgportal is a statement with bound
+// parameters created with a Bind message
+type pgportal struct {
+	q       *pgquery
+	formats []int // result column formats
+	// rows holds the encoded DataRow messages
+	// of a portal that has been executed
+	// and has not been completely returned
+	rows     [][]byte
+	executed bool
+	sent     int
+}
+
+// format returns the format of column i
+func (p *pgportal) format(i int) int {
+	switch len(p.formats) {
+	case 0:
+		return 0
+	case 1:
+		return p.formats[0]
+	}
+	if i < len(p.formats) {
+		return p.formats[i]
+	}
+	return 0
+}
+
+var errStopRows = errors.New("stop reading rows")
+
+// simpleQuery handles a Query message,
+// which may contain more than one statement
+func (c *pgconn) simpleQuery(text string) {
+	stmts := splitStatements(text)
+	if len(stmts) == 0 {
+		c.begin('I') // EmptyQueryResponse
+		c.end()
+		return
+	}
+	for _, text := range stmts {
+		q, err := c.prepare(text)
+		if err == nil {
+			err = c.run(q, &pgportal{q: q}, true)
+		}
+		if err != nil {
+			c.error(err)
+			return
+		}
+	}
+}
+
+// extended handles a message of the
+// extended query protocol
+func (c *pgconn) extended(typ byte, msg *pgreader) error {
+	switch typ {
+	case 'P': // Parse
+		name, text := msg.cstring(), msg.cstring()
+		params := make([]uint32, msg.int16())
+		for i := range params {
+			params[i] = msg.uint32()
+		}
+		if msg.err != nil {
+			return msg.err
+		}
+		if _, ok := c.stmts[name]; ok && name != "" {
+			return pgErrorf("42P05", "prepared statement %q already exists", name)
+		}
+		st := &pgstmt{text: text, params: params}
+		if n := paramCount(text); n > len(st.params) {
+			st.params = append(st.params, make([]uint32, n-len(st.params))...)
+		}
+		untyped := false
+		args := make([]expr.Node, len(st.params))
+		for i := range args {
+			args[i] = paramPlaceholder(st.params[i])
+			untyped = untyped || st.params[i] == 0
+		}
+		q, err := c.prepare(bindParams(text, args))
+		if err != nil {
+			// a NULL placeholder can make an
+			// otherwise valid statement ill-typed,
+			// so only syntax errors are reported
+			// before the parameters are bound
+			pe, ok := err.(*pgError)
+			if !untyped || !ok || pe.code != pgDatatypeMismatch {
+				return err
+			}
+			q = nil
+		}
+		st.q = q
+		c.stmts[name] = st
+		c.begin('1') // ParseComplete
+		c.end()
+	case 'B': // Bind
+		portal, name := msg.cstring(), msg.cstring()
+		formats := make([]int, msg.int16())
+		for i := range formats {
+			formats[i] = msg.int16()
+		}
+		values := make([][]byte, msg.int16())
+		for i := range values {
+			n := msg.int32()
+			if n >= 0 {
+				values[i] = msg.take(n)
+			}
+		}
+		p := &pgportal{formats: make([]int, msg.int16())}
+		for i := range p.formats {
+			p.formats[i] = msg.int16()
+		}
+		if msg.err != nil {
+			return msg.err
+		}
+		st, ok := c.stmts[name]
+		if !ok {
+			return pgErrorf(pgInvalidStatement, "prepared statement %q does not exist", name)
+		}
+		if len(values) != len(st.params) {
+			return pgErrorf(pgProtocolViolation, "bind message supplies %d parameters, but prepared statement %q requires %d", len(values), name, len(st.params))
+		}
+		args := make([]expr.Node, len(values))
+		for i := range values {
+			format := 0
+			if len(formats) == 1 {
+				format = formats[0]
+			} else if i < len(formats) {
+				format = formats[i]
+			}
+			lit, err := paramLiteral(values[i], st.params[i], format)
+			if err != nil {
+				return err
+			}
+			args[i] = lit
+		}
+		if len(args) == 0 {
+			p.q = st.q
+		} else {
+			q, err := c.prepare(bindParams(st.text, args))
+			if err != nil {
+				return err
+			}
+			p.q = q
+		}
+		c.portals[portal] = p
+		c.begin('2') // BindComplete
+		c.end()
+	case 'D': // Describe
+		kind, name := msg.byte(), msg.cstring()
+		if msg.err != nil {
+			return msg.err
+		}
+		switch kind {
+		case 'S':
+			st, ok := c.stmts[name]
+			if !ok {
+				return pgErrorf(pgInvalidStatement, "prepared statement %q does not exist", name)
+			}
+			c.begin('t') // ParameterDescription
+			c.int16(len(st.params))
+			for _, oid := range st.params {
+				if oid == 0 {
+					oid = pgText
+				}
+				c.int32(int(oid))
+			}
+			c.end()
+			if st.q == nil {
+				// the result is unknown until
+				// the parameters are bound
+				c.begin('n') // NoData
+				c.end()
+				break
+			}
+			if err := c.probe(st.q); err != nil {
+				return err
+			}
+			c.describe(st.q, &pgportal{q: st.q})
+		case 'P':
+			p, ok := c.portals[name]
+			if !ok {
+				return pgErrorf(pgInvalidCursor, "portal %q does not exist", name)
+			}
+			if p.q.returnsRows() && p.q.cols == nil && !p.executed {
+				// the columns are only known
+				// once the query has produced a row
+				if err := c.buffer(p); err != nil {
+					return err
+				}
+			}
+			c.describe(p.q, p)
+		default:
+			return pgErrorf(pgProtocolViolation, "invalid describe kind %q", kind)
+		}
+	case 'E': // Execute
+		name, max := msg.cstring(), msg.int32()
+		if msg.err != nil {
+			return msg.err
+		}
+		p, ok := c.portals[name]
+		if !ok {
+			return pgErrorf(pgInvalidCursor, "portal %q does not exist", name)
+		}
+		return c.execute(p, max)
+	case 'C': // Close
+		kind, name := msg.byte(), msg.cstring()
+		if msg.err != nil {
+			return msg.err
+		}
+		switch kind {
+		case 'S':
+			delete(c.stmts, name)
+		case 'P':
+			delete(c.portals, name)
+		default:
+			return pgErrorf(pgProtocolViolation, "invalid close kind %q", kind)
+		}
+		c.begin('3') // CloseComplete
+		c.end()
+	default:
+		return pgErrorf(pgProtocolViolation, "unexpected message type %q", typ)
+	}
+	return nil
+}
+
+// describe writes the RowDescription of q
+// (or NoData if it doesn't return rows)
+func (c *pgconn) describe(q *pgquery, p *pgportal) {
+	if !q.returnsRows() {
+		c.begin('n') // NoData
+		c.end()
+		return
+	}
+	c.begin('T')
+	c.int16(len(q.cols))
+	for i := range q.cols {
+		col := &q.cols[i]
+		c.cstring(col.name)
+		c.int32(0) // table OID
+		c.int16(0) // column number
+		c.int32(int(col.oid))
+		c.int16(col.size())
+		c.int32(-1) // type modifier
+		c.int16(p.format(i))
+	}
+	c.end()
+}
+
+// probe determines the columns of q by
+// running it until it produces a row
+// if they could not be determined
+// when q was prepared
+func (c *pgconn) probe(q *pgquery) error {
+	if !q.returnsRows() || q.cols != nil {
+		return nil
+	}
+	err := c.rows(q, func(row ion.Struct) error {
+		q.setcols(row)
+		return errStopRows
+	})
+	if q.cols == nil {
+		q.cols = []pgcol{}
+	}
+	return err
+}
+
+// execute handles an Execute message
+// returning at most max rows (if max > 0)
+func (c *pgconn) execute(p *pgportal, max int) error {
+	if !p.executed && max <= 0 {
+		return c.run(p.q, p, false)
+	}
+	if !p.executed {
+		if err := c.buffer(p); err != nil {
+			return err
+		}
+	}
+	if p.q.empty {
+		c.begin('I') // EmptyQueryResponse
+		c.end()
+		return nil
+	}
+	if !p.q.returnsRows() {
+		c.complete(p.q.tag)
+		return nil
+	}
+	n := len(p.rows)
+	if max > 0 && max < n {
+		n = max
+	}
+	for _, row := range p.rows[:n] {
+		c.wr.Write(row)
+	}
+	p.rows = p.rows[n:]
+	p.sent += n
+	if len(p.rows) > 0 {
+		c.begin('s') // PortalSuspended
+		c.end()
+		return nil
+	}
+	c.complete("SELECT " + strconv.Itoa(p.sent))
+	return nil
+}
+
+// buffer executes the query of p and
+// saves the resulting rows in p.rows
+func (c *pgconn) buffer(p *pgportal) error {
+	p.executed = true
+	if !p.q.returnsRows() {
+		return nil
+	}
+	return c.rows(p.q, func(row ion.Struct) error {
+		if p.q.cols == nil {
+			p.q.setcols(row)
+		}
+		c.begin('D')
+		err := c.datarow(p, row)
+		if err != nil {
+			return err
+		}
+		p.rows = append(p.rows, append([]byte(nil), c.out...))
+		return nil
+	})
+}
+
+// run executes q and writes all of its rows
+// followed by a CommandComplete message;
+// if describe is set, the rows are preceded
+// by a RowDescription
+func (c *pgconn) run(q *pgquery, p *pgportal, describe bool) error {
+	p.executed = true
+	if q.empty {
+		c.begin('I') // EmptyQueryResponse
+		c.end()
+		return nil
+	}
+	if !q.returnsRows() {
+		c.complete(q.tag)
+		return nil
+	}
+	described := false
+	if describe && q.cols != nil {
+		c.describe(q, p)
+		described = true
+	}
+	n := 0
+	err := c.rows(q, func(row ion.Struct) error {
+		if q.cols == nil {
+			q.setcols(row)
+		}
+		if describe && !described {
+			c.describe(q, p)
+			described = true
+		}
+		c.begin('D')
+		if err := c.datarow(p, row); err != nil {
+			return err
+		}
+		n++
+		_, err := c.wr.Write(c.out)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if describe && !described {
+		if q.cols == nil {
+			q.cols = []pgcol{}
+		}
+		c.describe(q, p)
+	}
+	c.complete("SELECT " + strconv.Itoa(n))
+	return nil
+}
+
+// datarow appends the columns of a DataRow
+// message for row to c.out and sets the
+// length of the message
+func (c *pgconn) datarow(p *pgportal, row ion.Struct) error {
+	cols := p.q.cols
+	c.int16(len(cols))
+	fields := row.Fields(nil)
+	for i := range cols {
+		var val ion.Datum
+		if i < len(fields) && fields[i].Label == cols[i].name {
+			val = fields[i].Value
+		} else {
+			for j := range fields {
+				if fields[j].Label == cols[i].name {
+					val = fields[j].Value
+					break
+				}
+			}
+		}
+		pos := len(c.out)
+		c.int32(0)
+		out, ok, err := appendValue(c.out, val, &cols[i], p.format(i))
+		if err != nil {
+			return err
+		}
+		c.out = out
+		size := int32(len(c.out) - pos - 4)
+		if !ok {
+			size = -1
+		}
+		binary.BigEndian.PutUint32(c.out[pos:], uint32(size))
+	}
+	binary.BigEndian.PutUint32(c.out[1:], uint32(len(c.out)-1))
+	return nil
+}
+
+// scanSQL calls fn with the offset of each byte
+// of text that is not part of a string literal,
+// quoted identifier or comment; fn returns the
+// offset at which scanning continues
+func scanSQL(text string, fn func(i int) int) {
+	for i := 0; i < len(text); {
+		switch {
+		case text[i] == '\'' || text[i] == '"' || text[i] == '`':
+			q := text[i]
+			i++
+			for i < len(text) {
+				if text[i] == '\\' && q == '\'' {
+					i += 2
+					continue
+				}
+				i++
+				if text[i-1] == q {
+					if i < len(text) && text[i] == q {
+						i++
+						continue
+					}
+					break
+				}
+			}
+		case strings.HasPrefix(text[i:], "--"):
+			end := strings.IndexByte(text[i:], '\n')
+			if end < 0 {
+				return
+			}
+			i += end + 1
+		case strings.HasPrefix(text[i:], "/*"):
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 {
+				return
+			}
+			i += end + 4
+		default:
+			i = fn(i)
+		}
+	}
+}
+
+// splitStatements splits text into
+// the statements separated by semicolons
+func splitStatements(text string) []string {
+	var out []string
+	add := func(s string) {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	start := 0
+	scanSQL(text, func(i int) int {
+		if text[i] == ';' {
+			add(text[start:i])
+			start = i + 1
+		}
+		return i + 1
+	})
+	add(text[start:])
+	return out
+}
+
+// scanParams calls fn for each parameter
+// reference ($1, $2, ...) in text
+func scanParams(text string, fn func(start, end, n int)) {
+	scanSQL(text, func(i int) int {
+		if text[i] != '$' {
+			return i + 1
+		}
+		j := i + 1
+		for j < len(text) && text[j] >= '0' && text[j] <= '9' {
+			j++
+		}
+		if n, err := strconv.Atoi(text[i+1 : j]); err == nil && n > 0 {
+			fn(i, j, n)
+		}
+		return j
+	})
+}
+
+// paramCount returns the number of
+// parameters referenced by text
+func paramCount(text string) int {
+	max := 0
+	scanParams(text, func(_, _, n int) {
+		if n > max {
+			max = n
+		}
+	})
+	return max
+}
+
+// bindParams replaces the parameter
+// references in text with args
+func bindParams(text string, args []expr.Node) string {
+	var out strings.Builder
+	last := 0
+	scanParams(text, func(start, end, n int) {
+		if n > len(args) {
+			return
+		}
+		out.WriteString(text[last:start])
+		out.WriteString(expr.ToString(args[n-1]))
+		last = end
+	})
+	out.WriteString(text[last:])
+	return out.String()
+}
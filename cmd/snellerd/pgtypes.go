@@ -0,0 +1,381 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SnellerInc/sneller/date"
+	"github.com/SnellerInc/sneller/expr"
+	"github.com/SnellerInc/sneller/ion"
+)
+
+// PostgreSQL type OIDs
+const (
+	pgBool        = 16
+	pgBytea       = 17
+	pgInt8        = 20
+	pgInt2        = 21
+	pgInt4        = 23
+	pgText        = 25
+	pgOID         = 26
+	pgJSON        = 114
+	pgFloat4      = 700
+	pgFloat8      = 701
+	pgBpchar      = 1042
+	pgVarchar     = 1043
+	pgDate        = 1082
+	pgTimestamp   = 1114
+	pgTimestamptz = 1184
+	pgNumeric     = 1700
+)
+
+// pgcol describes a result column
+type pgcol struct {
+	name string
+	oid  uint32
+}
+
+// size returns the typlen of the column type
+func (c *pgcol) size() int {
+	switch c.oid {
+	case pgBool:
+		return 1
+	case pgInt8, pgFloat8, pgTimestamptz:
+		return 8
+	default:
+		return -1
+	}
+}
+
+// typeOID returns the type of a column
+// that produces values in the given set
+func typeOID(t expr.TypeSet) uint32 {
+	// NULL and MISSING are both NULL
+	t &^= expr.MissingType | expr.NullType
+	switch {
+	case t == 0:
+		return pgText
+	case t.Only(expr.BoolType):
+		return pgBool
+	case t.Only(expr.IntegerType):
+		return pgInt8
+	case t.Only(expr.NumericType):
+		return pgFloat8
+	case t.Only(expr.TimeType):
+		return pgTimestamptz
+	case t.Only(expr.ListType | expr.StructType):
+		return pgJSON
+	case t.Only(expr.TypeSet(1 << ion.BlobType)):
+		return pgBytea
+	default:
+		return pgText
+	}
+}
+
+// pgEpoch is the origin of binary timestamps
+var pgEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// appendValue appends the encoding of d as a value
+// of column c to dst in the text (format 0)
+// or binary (format 1) format; it returns
+// false if the value is NULL
+func appendValue(dst []byte, d ion.Datum, c *pgcol, format int) ([]byte, bool, error) {
+	switch d.Type() {
+	case ion.InvalidType, ion.NullType:
+		return dst, false, nil
+	}
+	if format == 0 {
+		return appendText(dst, d), true, nil
+	}
+	mismatch := func() error {
+		return pgErrorf(pgDatatypeMismatch, "column %q: cannot encode %s value as type %d", c.name, d.Type(), c.oid)
+	}
+	switch c.oid {
+	case pgBool:
+		b, ok := d.Bool()
+		if !ok {
+			return dst, true, mismatch()
+		}
+		if b {
+			return append(dst, 1), true, nil
+		}
+		return append(dst, 0), true, nil
+	case pgInt8:
+		i, ok := datumInt(d)
+		if !ok {
+			return dst, true, mismatch()
+		}
+		return binary.BigEndian.AppendUint64(dst, uint64(i)), true, nil
+	case pgFloat8:
+		f, ok := d.Float()
+		if !ok {
+			i, iok := datumInt(d)
+			if !iok {
+				return dst, true, mismatch()
+			}
+			f = float64(i)
+		}
+		return binary.BigEndian.AppendUint64(dst, math.Float64bits(f)), true, nil
+	case pgTimestamptz:
+		t, ok := d.Timestamp()
+		if !ok {
+			return dst, true, mismatch()
+		}
+		us := t.Time().Sub(pgEpoch).Microseconds()
+		return binary.BigEndian.AppendUint64(dst, uint64(us)), true, nil
+	case pgBytea:
+		b, ok := d.Blob()
+		if !ok {
+			return dst, true, mismatch()
+		}
+		return append(dst, b...), true, nil
+	default:
+		// the binary representation of
+		// text and json is the same as
+		// the text representation
+		return appendText(dst, d), true, nil
+	}
+}
+
+func datumInt(d ion.Datum) (int64, bool) {
+	if i, ok := d.Int(); ok {
+		return i, true
+	}
+	if u, ok := d.Uint(); ok && u <= math.MaxInt64 {
+		return int64(u), true
+	}
+	return 0, false
+}
+
+// appendText appends the text representation of d
+func appendText(dst []byte, d ion.Datum) []byte {
+	switch d.Type() {
+	case ion.BoolType:
+		b, _ := d.Bool()
+		if b {
+			return append(dst, 't')
+		}
+		return append(dst, 'f')
+	case ion.IntType:
+		i, _ := d.Int()
+		return strconv.AppendInt(dst, i, 10)
+	case ion.UintType:
+		u, _ := d.Uint()
+		return strconv.AppendUint(dst, u, 10)
+	case ion.FloatType:
+		f, _ := d.Float()
+		switch {
+		case math.IsNaN(f):
+			return append(dst, "NaN"...)
+		case math.IsInf(f, 1):
+			return append(dst, "Infinity"...)
+		case math.IsInf(f, -1):
+			return append(dst, "-Infinity"...)
+		}
+		return strconv.AppendFloat(dst, f, 'g', -1, 64)
+	case ion.StringType, ion.SymbolType:
+		s, _ := d.String()
+		return append(dst, s...)
+	case ion.TimestampType:
+		t, _ := d.Timestamp()
+		return t.Time().AppendFormat(dst, "2006-01-02 15:04:05.999999-07")
+	case ion.BlobType:
+		b, _ := d.Blob()
+		dst = append(dst, `\x`...)
+		return append(dst, hex.EncodeToString(b)...)
+	default:
+		return appendJSON(dst, d)
+	}
+}
+
+// appendJSON appends the JSON representation of d
+func appendJSON(dst []byte, d ion.Datum) []byte {
+	switch d.Type() {
+	case ion.BoolType, ion.IntType, ion.UintType:
+		return appendText(dst, d)
+	case ion.FloatType:
+		f, _ := d.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return append(dst, "null"...)
+		}
+		return appendText(dst, d)
+	case ion.StringType, ion.SymbolType:
+		s, _ := d.String()
+		return appendJSONString(dst, s)
+	case ion.TimestampType:
+		t, _ := d.Timestamp()
+		dst = append(dst, '"')
+		dst = t.AppendRFC3339Nano(dst)
+		return append(dst, '"')
+	case ion.BlobType:
+		b, _ := d.Blob()
+		return appendJSONString(dst, base64.StdEncoding.EncodeToString(b))
+	case ion.ListType:
+		l, _ := d.List()
+		dst = append(dst, '[')
+		first := true
+		l.Each(func(d ion.Datum) bool {
+			if !first {
+				dst = append(dst, ',')
+			}
+			first = false
+			dst = appendJSON(dst, d)
+			return true
+		})
+		return append(dst, ']')
+	case ion.StructType:
+		s, _ := d.Struct()
+		dst = append(dst, '{')
+		first := true
+		s.Each(func(f ion.Field) bool {
+			if !first {
+				dst = append(dst, ',')
+			}
+			first = false
+			dst = appendJSONString(dst, f.Label)
+			dst = append(dst, ':')
+			dst = appendJSON(dst, f.Value)
+			return true
+		})
+		return append(dst, '}')
+	default:
+		return append(dst, "null"...)
+	}
+}
+
+func appendJSONString(dst []byte, s string) []byte {
+	buf, _ := json.Marshal(s)
+	return append(dst, buf...)
+}
+
+// paramPlaceholder returns the value
+// used in place of a parameter of type oid
+// when a statement is parsed before it
+// has been bound
+func paramPlaceholder(oid uint32) expr.Node {
+	switch oid {
+	case pgBool:
+		return expr.Bool(false)
+	case pgInt2, pgInt4, pgInt8, pgOID:
+		return expr.Integer(0)
+	case pgFloat4, pgFloat8, pgNumeric:
+		return expr.Float(0)
+	case pgTimestamp, pgTimestamptz, pgDate:
+		return &expr.Timestamp{}
+	case pgText, pgVarchar, pgBpchar:
+		return expr.String("")
+	}
+	return expr.Null{}
+}
+
+// paramLiteral converts the value of a bound
+// parameter into a literal expression
+func paramLiteral(val []byte, oid uint32, format int) (expr.Node, error) {
+	if val == nil {
+		return expr.Null{}, nil
+	}
+	if format == 1 {
+		return binaryParam(val, oid)
+	}
+	text := string(val)
+	switch oid {
+	case pgBool:
+		switch strings.ToLower(text) {
+		case "t", "true", "y", "yes", "on", "1":
+			return expr.Bool(true), nil
+		case "f", "false", "n", "no", "off", "0":
+			return expr.Bool(false), nil
+		}
+	case pgInt2, pgInt4, pgInt8, pgOID:
+		i, err := strconv.ParseInt(text, 10, 64)
+		if err == nil {
+			return expr.Integer(i), nil
+		}
+	case pgFloat4, pgFloat8, pgNumeric:
+		f, err := strconv.ParseFloat(text, 64)
+		if err == nil {
+			return expr.Float(f), nil
+		}
+	case pgTimestamp, pgTimestamptz, pgDate:
+		if t, ok := parseTimestamp(text); ok {
+			return &expr.Timestamp{Value: t}, nil
+		}
+	case 0:
+		// unspecified: numbers are
+		// numbers and everything else
+		// is a string
+		if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return expr.Integer(i), nil
+		}
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return expr.Float(f), nil
+		}
+		return expr.String(text), nil
+	default:
+		return expr.String(text), nil
+	}
+	return nil, pgErrorf(pgDatatypeMismatch, "invalid input %q for parameter type %d", text, oid)
+}
+
+func binaryParam(val []byte, oid uint32) (expr.Node, error) {
+	switch {
+	case oid == pgBool && len(val) == 1:
+		return expr.Bool(val[0] != 0), nil
+	case oid == pgInt2 && len(val) == 2:
+		return expr.Integer(int16(binary.BigEndian.Uint16(val))), nil
+	case (oid == pgInt4 || oid == pgOID) && len(val) == 4:
+		return expr.Integer(int32(binary.BigEndian.Uint32(val))), nil
+	case oid == pgInt8 && len(val) == 8:
+		return expr.Integer(int64(binary.BigEndian.Uint64(val))), nil
+	case oid == pgFloat4 && len(val) == 4:
+		return expr.Float(math.Float32frombits(binary.BigEndian.Uint32(val))), nil
+	case oid == pgFloat8 && len(val) == 8:
+		return expr.Float(math.Float64frombits(binary.BigEndian.Uint64(val))), nil
+	case (oid == pgTimestamp || oid == pgTimestamptz) && len(val) == 8:
+		us := int64(binary.BigEndian.Uint64(val))
+		t := pgEpoch.Add(time.Duration(us) * time.Microsecond)
+		return &expr.Timestamp{Value: date.FromTime(t)}, nil
+	case oid == pgText || oid == pgVarchar || oid == pgBpchar || oid == pgJSON:
+		return expr.String(string(val)), nil
+	}
+	return nil, pgErrorf(pgFeatureNotSupp, "binary format not supported for parameter type %d", oid)
+}
+
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+func parseTimestamp(text string) (date.Time, bool) {
+	for _, layout := range timestampLayouts {
+		t, err := time.Parse(layout, text)
+		if err == nil {
+			return date.FromTime(t), true
+		}
+	}
+	return date.Time{}, false
+}
@@ -0,0 +1,531 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/SnellerInc/sneller/db"
+)
+
+// This file implements the connection handling of
+// the PostgreSQL (v3) wire protocol frontend.
+// See https://www.postgresql.org/docs/current/protocol.html
+
+const (
+	pgProtocol3   = 196608
+	pgSSLRequest  = 80877103
+	pgGSSRequest  = 80877104
+	pgCancelQuery = 80877102
+
+	// maximum size of a single client message
+	pgMaxMessage = 128 * 1024 * 1024
+	// reported as server_version
+	pgServerVersion = "14.0"
+)
+
+// SQLSTATE codes used in error responses
+const (
+	pgProtocolViolation = "08P01"
+	pgInvalidPassword   = "28P01"
+	pgFeatureNotSupp    = "0A000"
+	pgSyntaxError       = "42601"
+	pgDatatypeMismatch  = "42804"
+	pgUndefinedTable    = "42P01"
+	pgUndefinedObject   = "42704"
+	pgInvalidStatement  = "26000"
+	pgInvalidCursor     = "34000"
+	pgPrivilege         = "42501"
+	pgTooManyQueries    = "53300"
+	pgLimitExceeded     = "54000"
+	pgQueryCanceled     = "57014"
+	pgInternalError     = "XX000"
+)
+
+// pgError is an error with a SQLSTATE code
+type pgError struct {
+	code string
+	msg  string
+}
+
+func (e *pgError) Error() string { return e.msg }
+
+func pgErrorf(code, f string, args ...interface{}) *pgError {
+	return &pgError{code: code, msg: fmt.Sprintf(f, args...)}
+}
+
+// pgfrontend keeps track of the open connections
+// to the PostgreSQL protocol listener so that
+// queries can be canceled from other connections
+type pgfrontend struct {
+	lock  sync.Mutex
+	l     net.Listener
+	conns map[uint32]*pgconn
+	wg    sync.WaitGroup
+}
+
+// ServePG serves the PostgreSQL wire protocol on l.
+// ServePG must be called after Serve has started
+// the tenant manager.
+func (s *server) ServePG(l net.Listener) error {
+	s.pg.lock.Lock()
+	s.pg.l = l
+	s.pg.lock.Unlock()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		s.pg.wg.Add(1)
+		go func() {
+			defer s.pg.wg.Done()
+			c := &pgconn{
+				srv:  s,
+				conn: conn,
+				rd:   bufio.NewReader(conn),
+				wr:   bufio.NewWriter(conn),
+			}
+			err := c.serve()
+			if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				s.logger.Printf("postgres connection from %s: %s", conn.RemoteAddr(), err)
+			}
+			conn.Close()
+		}()
+	}
+}
+
+// close closes the listener and waits
+// for the open connections to finish
+func (p *pgfrontend) close() {
+	p.lock.Lock()
+	if p.l != nil {
+		p.l.Close()
+	}
+	for _, c := range p.conns {
+		c.conn.Close()
+	}
+	p.lock.Unlock()
+	p.wg.Wait()
+}
+
+// register assigns c a process ID and secret key
+func (p *pgfrontend) register(c *pgconn) {
+	var buf [8]byte
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.conns == nil {
+		p.conns = make(map[uint32]*pgconn)
+	}
+	for {
+		rand.Read(buf[:])
+		c.pid = binary.BigEndian.Uint32(buf[:]) & 0x7fffffff
+		c.secret = binary.BigEndian.Uint32(buf[4:])
+		if _, ok := p.conns[c.pid]; !ok && c.pid != 0 {
+			break
+		}
+	}
+	p.conns[c.pid] = c
+}
+
+func (p *pgfrontend) unregister(c *pgconn) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.conns, c.pid)
+}
+
+// cancel cancels the query running on the
+// connection with the given process ID
+// if the secret key matches
+func (p *pgfrontend) cancel(pid, secret uint32) {
+	p.lock.Lock()
+	c := p.conns[pid]
+	p.lock.Unlock()
+	if c != nil && c.secret == secret {
+		c.interrupt()
+	}
+}
+
+// pgconn is a single client connection
+type pgconn struct {
+	srv  *server
+	conn net.Conn
+	rd   *bufio.Reader
+	wr   *bufio.Writer
+	out  []byte // message being written
+	in   []byte // last message read
+
+	pid, secret uint32
+
+	params map[string]string
+	// settings are the run-time parameters
+	// (see SET and SHOW)
+	settings map[string]string
+	creds    db.Tenant
+	dbname   string
+
+	stmts   map[string]*pgstmt
+	portals map[string]*pgportal
+
+	lock   sync.Mutex
+	cancel context.CancelFunc
+}
+
+// interrupt cancels the running query, if any
+func (c *pgconn) interrupt() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
+
+// context returns the context used to
+// run a single query; the returned cancel
+// function must be called once the query is done
+func (c *pgconn) context() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.lock.Lock()
+	c.cancel = cancel
+	c.lock.Unlock()
+	return ctx, func() {
+		c.lock.Lock()
+		c.cancel = nil
+		c.lock.Unlock()
+		cancel()
+	}
+}
+
+func (c *pgconn) serve() error {
+	ok, err := c.startup()
+	if err != nil || !ok {
+		return err
+	}
+	c.srv.pg.register(c)
+	defer c.srv.pg.unregister(c)
+	c.stmts = make(map[string]*pgstmt)
+	c.portals = make(map[string]*pgportal)
+	c.ready()
+	if err := c.wr.Flush(); err != nil {
+		return err
+	}
+	// after an error in the extended query
+	// protocol, messages are discarded until Sync
+	skip := false
+	for {
+		typ, err := c.read()
+		if err != nil {
+			return err
+		}
+		msg := pgreader{buf: c.in}
+		switch typ {
+		case 'X': // Terminate
+			return nil
+		case 'Q': // Query
+			skip = false
+			c.simpleQuery(msg.cstring())
+			c.ready()
+		case 'S': // Sync
+			skip = false
+			c.portals = make(map[string]*pgportal)
+			c.ready()
+		case 'H': // Flush
+		default:
+			if skip {
+				continue
+			}
+			err := c.extended(typ, &msg)
+			if err != nil {
+				c.error(err)
+				skip = true
+			}
+		}
+		if c.rd.Buffered() == 0 || typ == 'H' {
+			if err := c.wr.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// startup handles the startup and authentication
+// of a connection; it returns false if the connection
+// should be closed without an error
+func (c *pgconn) startup() (bool, error) {
+	for {
+		var hdr [8]byte
+		_, err := io.ReadFull(c.rd, hdr[:])
+		if err != nil {
+			return false, err
+		}
+		size := int(binary.BigEndian.Uint32(hdr[:]))
+		if size < 8 || size > 10000 {
+			return false, fmt.Errorf("bad startup message size %d", size)
+		}
+		body := make([]byte, size-8)
+		_, err = io.ReadFull(c.rd, body)
+		if err != nil {
+			return false, err
+		}
+		msg := pgreader{buf: body}
+		switch code := binary.BigEndian.Uint32(hdr[4:]); code {
+		case pgSSLRequest, pgGSSRequest:
+			// encryption is not supported;
+			// the client may continue unencrypted
+			if _, err := c.conn.Write([]byte{'N'}); err != nil {
+				return false, err
+			}
+			continue
+		case pgCancelQuery:
+			pid, secret := msg.uint32(), msg.uint32()
+			if msg.err == nil {
+				c.srv.pg.cancel(pid, secret)
+			}
+			return false, nil
+		case pgProtocol3:
+			c.params = make(map[string]string)
+			for {
+				k := msg.cstring()
+				if k == "" || msg.err != nil {
+					break
+				}
+				c.params[k] = msg.cstring()
+			}
+			if msg.err != nil {
+				return false, msg.err
+			}
+			return c.authenticate()
+		default:
+			c.error(pgErrorf(pgFeatureNotSupp, "unsupported protocol version %d.%d", code>>16, code&0xffff))
+			return false, c.wr.Flush()
+		}
+	}
+}
+
+// authenticate asks for a cleartext password
+// and uses it as the token for the auth.Provider
+func (c *pgconn) authenticate() (bool, error) {
+	c.begin('R')
+	c.int32(3) // AuthenticationCleartextPassword
+	c.end()
+	if err := c.wr.Flush(); err != nil {
+		return false, err
+	}
+	typ, err := c.read()
+	if err != nil {
+		return false, err
+	}
+	if typ != 'p' {
+		c.error(pgErrorf(pgProtocolViolation, "expected password message, got %q", typ))
+		return false, c.wr.Flush()
+	}
+	msg := pgreader{buf: c.in}
+	token := msg.cstring()
+	creds, err := c.srv.auth.Authorize(context.Background(), token)
+	if err != nil {
+		c.srv.logger.Printf("postgres connection from %s: authorization failed: %s", c.conn.RemoteAddr(), err)
+		c.error(pgErrorf(pgInvalidPassword, "authentication failed for user %q", c.params["user"]))
+		return false, c.wr.Flush()
+	}
+	c.creds = creds
+	c.dbname = c.params["database"]
+	if c.dbname == c.params["user"] {
+		// clients default the database
+		// to the user name when none is given
+		c.dbname = ""
+	}
+	c.begin('R')
+	c.int32(0) // AuthenticationOk
+	c.end()
+	c.settings = make(map[string]string)
+	for k, v := range c.params {
+		c.settings[strings.ToLower(k)] = v
+	}
+	for _, kv := range [][2]string{
+		{"server_version", pgServerVersion},
+		{"server_encoding", "UTF8"},
+		{"client_encoding", "UTF8"},
+		{"DateStyle", "ISO, MDY"},
+		{"IntervalStyle", "postgres"},
+		{"TimeZone", "UTC"},
+		{"integer_datetimes", "on"},
+		{"standard_conforming_strings", "on"},
+		{"application_name", c.params["application_name"]},
+	} {
+		c.begin('S')
+		c.cstring(kv[0])
+		c.cstring(kv[1])
+		c.end()
+		c.settings[strings.ToLower(kv[0])] = kv[1]
+	}
+	return true, nil
+}
+
+// read reads the next message into c.in
+func (c *pgconn) read() (byte, error) {
+	var hdr [5]byte
+	_, err := io.ReadFull(c.rd, hdr[:])
+	if err != nil {
+		return 0, err
+	}
+	size := int(binary.BigEndian.Uint32(hdr[1:]))
+	if size < 4 || size > pgMaxMessage {
+		return 0, fmt.Errorf("bad message size %d", size)
+	}
+	if cap(c.in) >= size-4 {
+		c.in = c.in[:size-4]
+	} else {
+		c.in = make([]byte, size-4)
+	}
+	_, err = io.ReadFull(c.rd, c.in)
+	if err != nil {
+		return 0, err
+	}
+	return hdr[0], nil
+}
+
+func (c *pgconn) begin(typ byte) {
+	c.out = append(c.out[:0], typ, 0, 0, 0, 0)
+}
+
+func (c *pgconn) int16(v int) {
+	c.out = binary.BigEndian.AppendUint16(c.out, uint16(v))
+}
+
+func (c *pgconn) int32(v int) {
+	c.out = binary.BigEndian.AppendUint32(c.out, uint32(v))
+}
+
+func (c *pgconn) cstring(s string) {
+	c.out = append(c.out, s...)
+	c.out = append(c.out, 0)
+}
+
+// end sets the length of the current
+// message and buffers it for writing
+func (c *pgconn) end() {
+	binary.BigEndian.PutUint32(c.out[1:], uint32(len(c.out)-1))
+	c.wr.Write(c.out)
+}
+
+func (c *pgconn) ready() {
+	c.begin('Z')
+	c.out = append(c.out, 'I')
+	c.end()
+}
+
+func (c *pgconn) complete(tag string) {
+	c.begin('C')
+	c.cstring(tag)
+	c.end()
+}
+
+// error writes an ErrorResponse for err
+func (c *pgconn) error(err error) {
+	pe, ok := err.(*pgError)
+	if !ok {
+		pe = &pgError{code: pgInternalError, msg: err.Error()}
+	}
+	c.begin('E')
+	for _, f := range []struct {
+		typ byte
+		val string
+	}{
+		{'S', "ERROR"},
+		{'V', "ERROR"},
+		{'C', pe.code},
+		{'M', pe.msg},
+	} {
+		c.out = append(c.out, f.typ)
+		c.cstring(f.val)
+	}
+	c.out = append(c.out, 0)
+	c.end()
+}
+
+// pgreader decodes the fields of a message;
+// the first decoding error is saved in err
+type pgreader struct {
+	buf []byte
+	err error
+}
+
+var errShortMessage = pgErrorf(pgProtocolViolation, "message too short")
+
+func (r *pgreader) take(n int) []byte {
+	if r.err != nil || n < 0 || len(r.buf) < n {
+		if r.err == nil {
+			r.err = errShortMessage
+		}
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *pgreader) byte() byte {
+	b := r.take(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *pgreader) int16() int {
+	b := r.take(2)
+	if b == nil {
+		return 0
+	}
+	return int(int16(binary.BigEndian.Uint16(b)))
+}
+
+func (r *pgreader) uint32() uint32 {
+	b := r.take(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *pgreader) int32() int {
+	return int(int32(r.uint32()))
+}
+
+func (r *pgreader) cstring() string {
+	if r.err != nil {
+		return ""
+	}
+	i := bytes.IndexByte(r.buf, 0)
+	if i < 0 {
+		r.err = errShortMessage
+		return ""
+	}
+	s := string(r.buf[:i])
+	r.buf = r.buf[i+1:]
+	return s
+}
@@ -0,0 +1,367 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/SnellerInc/sneller/tenant"
+)
+
+// pgclient is a minimal client
+// for the PostgreSQL wire protocol
+type pgclient struct {
+	t    *testing.T
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+// pgresult is the result of
+// a statement; errors are stored
+// as their SQLSTATE in code
+type pgresult struct {
+	cols []string
+	oids []uint32
+	rows [][]string
+	tag  string
+	code string
+}
+
+func (c *pgclient) send(typ byte, parts ...interface{}) {
+	var body []byte
+	if typ != 0 {
+		body = append(body, typ)
+	}
+	body = append(body, 0, 0, 0, 0)
+	for _, p := range parts {
+		switch p := p.(type) {
+		case string:
+			body = append(body, p...)
+			body = append(body, 0)
+		case int16:
+			body = binary.BigEndian.AppendUint16(body, uint16(p))
+		case int32:
+			body = binary.BigEndian.AppendUint32(body, uint32(p))
+		case []byte:
+			body = append(body, p...)
+		default:
+			c.t.Fatalf("cannot send %T", p)
+		}
+	}
+	start := 0
+	if typ != 0 {
+		start = 1
+	}
+	binary.BigEndian.PutUint32(body[start:], uint32(len(body)-start))
+	if _, err := c.conn.Write(body); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *pgclient) recv() (byte, []byte) {
+	var hdr [5]byte
+	if _, err := c.rd.Read(hdr[:1]); err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := readFull(c.rd, hdr[1:]); err != nil {
+		c.t.Fatal(err)
+	}
+	body := make([]byte, binary.BigEndian.Uint32(hdr[1:])-4)
+	if _, err := readFull(c.rd, body); err != nil {
+		c.t.Fatal(err)
+	}
+	return hdr[0], body
+}
+
+func readFull(rd *bufio.Reader, buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		m, err := rd.Read(buf[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func errorCode(body []byte) string {
+	msg := pgreader{buf: body}
+	code := ""
+	for {
+		typ := msg.byte()
+		if typ == 0 {
+			return code
+		}
+		val := msg.cstring()
+		if typ == 'C' {
+			code = val
+		}
+	}
+}
+
+// results reads messages until ReadyForQuery
+// and returns the results of each statement
+func (c *pgclient) results() []pgresult {
+	var out []pgresult
+	cur := &pgresult{}
+	for {
+		typ, body := c.recv()
+		msg := pgreader{buf: body}
+		switch typ {
+		case 'Z':
+			return out
+		case 'T':
+			n := msg.int16()
+			cur.cols = []string{}
+			for i := 0; i < n; i++ {
+				cur.cols = append(cur.cols, msg.cstring())
+				msg.take(6)
+				cur.oids = append(cur.oids, msg.uint32())
+				msg.take(8)
+			}
+		case 'D':
+			n := msg.int16()
+			row := make([]string, n)
+			for i := range row {
+				size := msg.int32()
+				if size < 0 {
+					row[i] = "NULL"
+				} else {
+					row[i] = string(msg.take(size))
+				}
+			}
+			cur.rows = append(cur.rows, row)
+		case 'C', 's':
+			cur.tag = msg.cstring()
+			if typ == 's' {
+				cur.tag = "suspended"
+			}
+			out = append(out, *cur)
+			cur = &pgresult{}
+		case 'E':
+			cur.code = errorCode(body)
+			out = append(out, *cur)
+			cur = &pgresult{}
+		case 'I':
+			cur.tag = "empty"
+			out = append(out, *cur)
+			cur = &pgresult{}
+		case '1', '2', '3', 't', 'n', 'S', 'K':
+		default:
+			c.t.Fatalf("unexpected message %q", typ)
+		}
+	}
+}
+
+func (c *pgclient) query(text string) []pgresult {
+	c.send('Q', text)
+	return c.results()
+}
+
+func pgconnect(t *testing.T, addr net.Addr, password string) (*pgclient, string) {
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	c := &pgclient{t: t, conn: conn, rd: bufio.NewReader(conn)}
+	// SSL is refused
+	c.send(0, int32(pgSSLRequest))
+	var b [1]byte
+	if _, err := c.rd.Read(b[:]); err != nil || b[0] != 'N' {
+		t.Fatalf("SSL response %q %v", b[0], err)
+	}
+	c.send(0, int32(pgProtocol3), "user", "test", "database", "default", "")
+	typ, body := c.recv()
+	if typ != 'R' || binary.BigEndian.Uint32(body) != 3 {
+		t.Fatalf("expected cleartext password request; got %q %x", typ, body)
+	}
+	c.send('p', password)
+	typ, body = c.recv()
+	if typ == 'E' {
+		return c, errorCode(body)
+	}
+	if typ != 'R' || binary.BigEndian.Uint32(body) != 0 {
+		t.Fatalf("expected AuthenticationOk; got %q %x", typ, body)
+	}
+	if res := c.results(); len(res) != 0 {
+		t.Fatalf("unexpected results %v", res)
+	}
+	return c, ""
+}
+
+func TestPostgresProtocol(t *testing.T) {
+	tt := testdirEnviron(t)
+	s := server{
+		logger:    testlogger(t),
+		sandbox:   tenant.CanSandbox(),
+		cachedir:  t.TempDir(),
+		tenantcmd: []string{"./snellerd-test-binary", "worker"},
+		peers:     noPeers{},
+		auth:      testAuth{tt},
+	}
+	httpsock, pgsock := listen(t), listen(t)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	s.aboutToServe = wg.Done
+	go s.Serve(httpsock, nil)
+	wg.Wait()
+	go s.ServePG(pgsock)
+	defer s.Close()
+
+	if _, code := pgconnect(t, pgsock.Addr(), "wrong"); code != pgInvalidPassword {
+		t.Fatalf("expected authentication to fail; got %q", code)
+	}
+	c, code := pgconnect(t, pgsock.Addr(), "snellerd-test")
+	if code != "" {
+		t.Fatal(code)
+	}
+
+	check := func(got, want []pgresult) {
+		t.Helper()
+		for i := range got {
+			// only compare OIDs if they
+			// are part of the expected result
+			if i < len(want) && want[i].oids == nil {
+				got[i].oids = nil
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got  %+v", got)
+			t.Errorf("want %+v", want)
+		}
+	}
+
+	// simple queries
+	check(c.query("SELECT COUNT(*) AS n FROM parking WHERE Fine > 100;"), []pgresult{{
+		cols: []string{"n"},
+		oids: []uint32{pgInt8},
+		rows: [][]string{{"35"}},
+		tag:  "SELECT 1",
+	}})
+	check(c.query("SET application_name = 'test'; SHOW application_name"), []pgresult{
+		{tag: "SET"},
+		{cols: []string{"application_name"}, rows: [][]string{{"test"}}, tag: "SELECT 1"},
+	})
+	check(c.query("SELECT Ticket FROM parking ORDER BY Ticket LIMIT 2"), []pgresult{{
+		cols: []string{"Ticket"},
+		rows: [][]string{{"1103341116"}, {"1103700150"}},
+		tag:  "SELECT 2",
+	}})
+	check(c.query(" ; "), []pgresult{{tag: "empty"}})
+	// errors end the query
+	check(c.query("SELECT * FROM; SELECT 1"), []pgresult{{code: pgSyntaxError}})
+	check(c.query("SELECT * FROM no_such_table"), []pgresult{{code: pgUndefinedTable}})
+
+	// catalog queries
+	check(c.query("SELECT table_name FROM information_schema.tables WHERE table_schema = 'default' ORDER BY table_name LIMIT 100"), []pgresult{{
+		cols: []string{"table_name"},
+		rows: [][]string{{"combined"}, {"parking"}, {"parking2"}, {"taxi"}},
+		tag:  "SELECT 4",
+	}})
+	check(c.query("SELECT nspname FROM pg_catalog.pg_namespace"), []pgresult{{
+		cols: []string{"nspname"},
+		rows: [][]string{{"default"}},
+		tag:  "SELECT 1",
+	}})
+	check(c.query("SELECT current_database()"), []pgresult{{
+		cols: []string{"current_database"},
+		rows: [][]string{{"default"}},
+		tag:  "SELECT 1",
+	}})
+
+	// extended protocol: parameters
+	// and partial execution
+	c.send('P', "stmt", "SELECT COUNT(*) AS n FROM parking WHERE Fine > $1", int16(1), int32(pgInt8))
+	c.send('B', "", "stmt", int16(0), int16(1), int32(3), []byte("100"), int16(0))
+	c.send('D', []byte{'P'}, "")
+	c.send('E', "", int32(0))
+	c.send('B', "", "stmt", int16(1), int16(1), int16(1), int32(8), binary.BigEndian.AppendUint64(nil, 200), int16(1), int16(1))
+	c.send('E', "", int32(0))
+	c.send('S')
+	res := c.results()
+	if len(res) != 2 {
+		t.Fatalf("got %+v", res)
+	}
+	check(res[:1], []pgresult{{
+		cols: []string{"n"},
+		oids: []uint32{pgInt8},
+		rows: [][]string{{"35"}},
+		tag:  "SELECT 1",
+	}})
+	if len(res[1].rows) != 1 || binary.BigEndian.Uint64([]byte(res[1].rows[0][0])) >= 35 {
+		t.Errorf("unexpected binary result %+v", res[1])
+	}
+
+	// untyped parameters are only
+	// type-checked once they are bound
+	c.send('P', "", "SELECT COUNT(*) AS n FROM parking WHERE Fine > $1", int16(0))
+	c.send('B', "", "", int16(0), int16(1), int32(3), []byte("100"), int16(0))
+	c.send('E', "", int32(0))
+	c.send('S')
+	check(c.results(), []pgresult{{rows: [][]string{{"35"}}, tag: "SELECT 1"}})
+
+	c.send('P', "", "SELECT Ticket FROM parking ORDER BY Ticket LIMIT 3", int16(0))
+	c.send('B', "p", "", int16(0), int16(0), int16(0))
+	c.send('E', "p", int32(2))
+	c.send('E', "p", int32(2))
+	c.send('S')
+	check(c.results(), []pgresult{
+		{rows: [][]string{{"1103341116"}, {"1103700150"}}, tag: "suspended"},
+		{rows: [][]string{{"1104803000"}}, tag: "SELECT 3"},
+	})
+
+	// after an error, messages
+	// are skipped until Sync
+	c.send('P', "", "SELECT * FROM", int16(0))
+	c.send('B', "", "", int16(0), int16(0), int16(0))
+	c.send('E', "", int32(0))
+	c.send('S')
+	check(c.results(), []pgresult{{code: pgSyntaxError}})
+	check(c.query("SELECT COUNT(*) AS n FROM parking"), []pgresult{{
+		cols: []string{"n"},
+		rows: [][]string{{"1023"}},
+		tag:  "SELECT 1",
+	}})
+	c.send('X')
+}
+
+func TestSplitStatements(t *testing.T) {
+	tcs := []struct {
+		text string
+		want []string
+	}{
+		{"SELECT 1", []string{"SELECT 1"}},
+		{"SELECT 1; SELECT 2;", []string{"SELECT 1", "SELECT 2"}},
+		{"SELECT ';' AS x; -- comment; here\nSELECT \"a;b\"", []string{"SELECT ';' AS x", "-- comment; here\nSELECT \"a;b\""}},
+		{"SELECT 'it''s;' /* ; */", []string{"SELECT 'it''s;' /* ; */"}},
+		{" ; ;", nil},
+	}
+	for i := range tcs {
+		got := splitStatements(tcs[i].text)
+		if !reflect.DeepEqual(got, tcs[i].want) {
+			t.Errorf("%q: got %q", tcs[i].text, got)
+		}
+	}
+	if n := paramCount("SELECT $1, '$2' FROM t WHERE x = $3"); n != 3 {
+		t.Errorf("paramCount: got %d", n)
+	}
+}
@@ -38,8 +38,19 @@ func runDaemon(args []string) {
 	authEndpoint := daemonCmd.String("a", "", "authorization specification (file://, http://, https://, empty uses environment)")
 	daemonEndpoint := daemonCmd.String("e", "127.0.0.1:8000", "endpoint to listen on (REST API)")
 	remoteEndpoint := daemonCmd.String("r", "127.0.0.1:9000", "endpoint to listen on for remote requests (inter-node)")
+	pgEndpoint := daemonCmd.String("pg", "", "endpoint to listen on for PostgreSQL wire protocol clients (empty disables the listener)")
 	cgroupRoot := daemonCmd.String("cgroot", "", "delegated cgroup root for tenant processes")
 	peerExec := daemonCmd.String("x", "", "command to exec for fetching peers")
+	replicas := daemonCmd.Int("replicas", 0, "number of peers eligible to process each blob when peers fail (0 means every peer)")
+	maxQueries := daemonCmd.Int("max-queries", 0, "maximum number of concurrent queries (0 means no limit)")
+	maxTenantQueries := daemonCmd.Int("tenant-max-queries", 0, "default maximum number of concurrent queries per tenant (0 means no limit)")
+	maxQueued := daemonCmd.Int("max-queued", 100, "maximum number of queries waiting for a query slot")
+	queueTimeout := daemonCmd.Duration("queue-timeout", 30*time.Second, "maximum time a query waits for a query slot")
+	audit := daemonCmd.Bool("audit", false, "record each query in the sneller_audit.queries_<node> table of its tenant")
+	auditNodeName := daemonCmd.String("audit-node", "", "node name used in the audit table name (default: host name)")
+	auditFlush := daemonCmd.Duration("audit-flush", defaultAuditInterval, "maximum time an audit record is buffered before it is written")
+	auditBatch := daemonCmd.Int("audit-batch", defaultAuditBatch, "number of buffered audit records of one tenant that triggers a write")
+	auditRetention := daemonCmd.Duration("audit-retention", 0, "how long audit records are kept (0 means forever)")
 	debugSock := daemonCmd.Int("debug", -1, "file descriptor to listen on for pprof debug activity")
 
 	if daemonCmd.Parse(args) != nil {
@@ -63,6 +74,29 @@ func runDaemon(args []string) {
 		sandbox:   tenant.CanSandbox(),
 		tenantcmd: []string{exe, "worker"},
 		peers:     noPeers{},
+		replicas:  *replicas,
+		admit: &admission{
+			maxGlobal: *maxQueries,
+			maxTenant: *maxTenantQueries,
+			maxQueue:  *maxQueued,
+			timeout:   *queueTimeout,
+		},
+	}
+	if *audit {
+		node := *auditNodeName
+		if node == "" {
+			node, err = os.Hostname()
+			if err != nil {
+				logger.Fatalf("determining audit node name: %s", err)
+			}
+		}
+		server.audit = &auditor{
+			node:      auditNode(node),
+			interval:  *auditFlush,
+			batch:     *auditBatch,
+			retention: *auditRetention,
+			logf:      logger.Printf,
+		}
 	}
 	httpl, err := net.Listen("tcp", *daemonEndpoint)
 	if err != nil {
@@ -75,6 +109,13 @@ func runDaemon(args []string) {
 			server.logger.Fatal(err)
 		}
 	}
+	var pgl net.Listener
+	if *pgEndpoint != "" {
+		pgl, err = net.Listen("tcp", *pgEndpoint)
+		if err != nil {
+			server.logger.Fatal(err)
+		}
+	}
 	provider, err := auth.Parse(*authEndpoint)
 	if err != nil {
 		if len(*authEndpoint) == 0 {
@@ -100,6 +141,8 @@ func runDaemon(args []string) {
 			cmd: strings.Fields(*peerExec),
 		}
 	}
+	started := make(chan struct{})
+	server.aboutToServe = func() { close(started) }
 	go func() {
 		server.logger.Printf("Sneller daemon %s listening on %v\n", version, httpl.Addr())
 		err := server.Serve(httpl, tenantl)
@@ -107,6 +150,18 @@ func runDaemon(args []string) {
 			server.logger.Fatal(err)
 		}
 	}()
+	if pgl != nil {
+		go func() {
+			// the tenant manager is
+			// created by Serve
+			<-started
+			server.logger.Printf("PostgreSQL frontend listening on %v\n", pgl.Addr())
+			err := server.ServePG(pgl)
+			if err != nil {
+				server.logger.Fatal(err)
+			}
+		}()
+	}
 
 	c := make(chan os.Signal, 1)
 
@@ -53,9 +53,27 @@ type server struct {
 	// split size used to configure the splitter,
 	// can be left 0 to use the default
 	splitSize int64
+	// number of peers eligible to process
+	// each blob; see sneller.Splitter.Replicas
+	replicas int
+
+	// admit limits query concurrency;
+	// if it is nil, there are no limits
+	admit *admission
+
+	// stmts holds the statements
+	// created with /prepare
+	stmts stmtCache
+
+	// audit records each query;
+	// if it is nil, queries are not audited
+	audit *auditor
 
 	// when started, the http server
 	srv http.Server
+	// when started, the PostgreSQL
+	// protocol frontend (see ServePG)
+	pg pgfrontend
 	// when started, the address of the http listener
 	// and the tenant remote socket, respectively
 	bound, remote net.Addr
@@ -68,15 +86,20 @@ func (s *server) Close() error {
 	s.manager.Stop()
 	s.peers.Stop()
 	s.srv.Close()
+	s.pg.close()
+	s.audit.close()
 	return nil
 }
 
 func (s *server) Shutdown(ctx context.Context) error {
+	s.pg.close()
 	if s.manager != nil {
 		s.manager.Stop()
 		s.manager = nil
 	}
-	return s.srv.Shutdown(ctx)
+	err := s.srv.Shutdown(ctx)
+	s.audit.close()
+	return err
 }
 
 func (s *server) handler() *http.ServeMux {
@@ -84,9 +107,11 @@ func (s *server) handler() *http.ServeMux {
 	r.HandleFunc("/", s.handle(s.versionHandler, http.MethodGet))
 	r.HandleFunc("/ping", s.handle(s.pingHandler, http.MethodGet))
 	r.HandleFunc("/executeQuery", s.handle(s.executeQueryHandler, http.MethodHead, http.MethodGet, http.MethodPost))
+	r.HandleFunc("/prepare", s.handle(s.prepareHandler, http.MethodPost, http.MethodDelete))
 	r.HandleFunc("/databases", s.handle(s.databasesHandler, http.MethodGet))
 	r.HandleFunc("/tables", s.handle(s.tablesHandler, http.MethodGet))
 	r.HandleFunc("/inputs", s.handle(s.inputsHandler, http.MethodGet))
+	r.HandleFunc("/schema", s.handle(s.schemaHandler, http.MethodGet))
 	return r
 }
 
@@ -123,6 +148,12 @@ func (s *server) Serve(httpsock, tenantsock net.Listener) error {
 	if err != nil {
 		s.logger.Fatal(err)
 	}
+	if s.audit != nil {
+		if s.audit.logf == nil {
+			s.audit.logf = s.logger.Printf
+		}
+		s.audit.start()
+	}
 	s.srv.Handler = s.handler()
 	if s.aboutToServe != nil {
 		s.aboutToServe()
@@ -130,12 +161,14 @@ func (s *server) Serve(httpsock, tenantsock net.Listener) error {
 	return s.srv.Serve(httpsock)
 }
 
-func (s *server) newSplitter(id tnproto.ID, key tnproto.Key, peers []*net.TCPAddr) *sneller.Splitter {
+func (s *server) newSplitter(id tnproto.ID, key tnproto.Key, peers []*net.TCPAddr, limits *cgroup.Limits) *sneller.Splitter {
 	split := &sneller.Splitter{
 		SplitSize: s.splitSize,
 		WorkerID:  id,
 		WorkerKey: key,
 		Peers:     peers,
+		Replicas:  s.replicas,
+		Limits:    limits,
 	}
 	if s.remote != nil {
 		split.SelfAddr = s.remote.String()
@@ -15,7 +15,9 @@
 // Package date implements optimized date-parsing routines
 // specific to the date formats that we support.
 //
-// Currently, only RFC3339Nano dates are supported.
+// Parse recognizes RFC3339Nano dates; other
+// formats can be described with strptime-style
+// layouts (see CompileFormat).
 package date
 
 //go:generate ragel -Z -G2 parse_date.rl
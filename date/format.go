@@ -0,0 +1,442 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package date
+
+import (
+	"fmt"
+	"time"
+)
+
+// A Format is a compiled strptime-style layout
+// for parsing timestamps that are not in RFC3339
+// format. See CompileFormat for the supported
+// directives.
+type Format struct {
+	layout string
+	zone   *Zone
+	steps  []FormatStep
+	offset bool
+}
+
+// FormatOp is an operation performed
+// while parsing a timestamp with a Format.
+type FormatOp uint8
+
+const (
+	// FormatDigits parses between Min and Max
+	// decimal digits into the component Field.
+	FormatDigits FormatOp = iota
+	// FormatFraction parses between 1 and 9
+	// decimal digits as the fraction of a second.
+	FormatFraction
+	// FormatLiteral matches the byte Char.
+	FormatLiteral
+	// FormatSpace skips zero or more
+	// whitespace characters.
+	FormatSpace
+	// FormatMonthName matches an English month
+	// name or its three-letter abbreviation.
+	FormatMonthName
+	// FormatWeekdayName matches an English weekday
+	// name or its three-letter abbreviation.
+	// The weekday is not checked against the date.
+	FormatWeekdayName
+	// FormatMeridiem matches AM or PM.
+	FormatMeridiem
+	// FormatOffset matches a UTC offset
+	// of the form Z, ±hh, ±hhmm, or ±hh:mm.
+	FormatOffset
+	// FormatZoneName matches UTC, GMT, or Z.
+	FormatZoneName
+	// FormatHour12 converts the hour (which
+	// must be between 1 and 12) from a 12-hour
+	// clock using the result of FormatMeridiem.
+	FormatHour12
+	// FormatYear2 converts a two-digit year
+	// into a year between 1969 and 2068.
+	FormatYear2
+)
+
+// Timestamp components parsed by FormatDigits.
+const (
+	FieldYear = iota
+	FieldMonth
+	FieldDay
+	FieldHour
+	FieldMinute
+	FieldSecond
+)
+
+// FormatStep is one step of a compiled Format.
+type FormatStep struct {
+	Op       FormatOp
+	Field    int  // FormatDigits
+	Min, Max int  // FormatDigits
+	Char     byte // FormatLiteral
+}
+
+// CompileFormat compiles a strptime-style layout.
+// The following directives are supported:
+//
+//	%Y  year (up to 4 digits)
+//	%y  year within the century (69-99 are 1969-1999)
+//	%m  month (1-12)
+//	%b  month name or abbreviation (also %B, %h)
+//	%d  day of the month (1-31)
+//	%e  day of the month with optional leading spaces
+//	%a  weekday name or abbreviation (also %A)
+//	%H  hour (0-23)
+//	%I  hour on a 12-hour clock (1-12)
+//	%p  AM or PM
+//	%M  minute (0-59)
+//	%S  second (0-60)
+//	%f  fraction of a second (1-9 digits)
+//	%z  UTC offset: Z, ±hh, ±hhmm, or ±hh:mm
+//	%Z  UTC, GMT, or Z
+//	%T  equivalent to %H:%M:%S
+//	%F  equivalent to %Y-%m-%d
+//	%D  equivalent to %m/%d/%y
+//	%R  equivalent to %H:%M
+//	%n  whitespace (also %t)
+//	%%  a literal %
+//
+// Whitespace in the layout matches zero or more
+// whitespace characters in the input, and every
+// other character must match exactly.
+// The year, month, and day default to 1970-01-01
+// when they are not part of the layout.
+//
+// Unless the layout includes %z or %Z,
+// timestamps are interpreted as wall-clock
+// times in zone, or as UTC times if zone is nil.
+func CompileFormat(layout string, zone *Zone) (*Format, error) {
+	f := &Format{layout: layout, zone: zone}
+	var hour12, year2 bool
+	if err := f.compile(layout, &hour12, &year2); err != nil {
+		return nil, err
+	}
+	if year2 {
+		f.steps = append(f.steps, FormatStep{Op: FormatYear2})
+	}
+	if hour12 {
+		f.steps = append(f.steps, FormatStep{Op: FormatHour12})
+	}
+	return f, nil
+}
+
+func isspace(c byte) bool {
+	return c == ' ' || (c >= '\t' && c <= '\r')
+}
+
+func (f *Format) space() {
+	if n := len(f.steps); n > 0 && f.steps[n-1].Op == FormatSpace {
+		return
+	}
+	f.steps = append(f.steps, FormatStep{Op: FormatSpace})
+}
+
+func (f *Format) digits(field, max int) {
+	f.steps = append(f.steps, FormatStep{Op: FormatDigits, Field: field, Min: 1, Max: max})
+}
+
+func (f *Format) compile(layout string, hour12, year2 *bool) error {
+	for i := 0; i < len(layout); i++ {
+		c := layout[i]
+		if isspace(c) {
+			f.space()
+			continue
+		}
+		if c != '%' {
+			f.steps = append(f.steps, FormatStep{Op: FormatLiteral, Char: c})
+			continue
+		}
+		i++
+		if i == len(layout) {
+			return fmt.Errorf("date: format %q ends with %%", f.layout)
+		}
+		var err error
+		switch layout[i] {
+		case 'Y':
+			f.digits(FieldYear, 4)
+		case 'y':
+			f.digits(FieldYear, 2)
+			*year2 = true
+		case 'm':
+			f.digits(FieldMonth, 2)
+		case 'b', 'B', 'h':
+			f.steps = append(f.steps, FormatStep{Op: FormatMonthName})
+		case 'd':
+			f.digits(FieldDay, 2)
+		case 'e':
+			f.space()
+			f.digits(FieldDay, 2)
+		case 'a', 'A':
+			f.steps = append(f.steps, FormatStep{Op: FormatWeekdayName})
+		case 'H':
+			f.digits(FieldHour, 2)
+		case 'I':
+			f.digits(FieldHour, 2)
+			*hour12 = true
+		case 'p':
+			f.steps = append(f.steps, FormatStep{Op: FormatMeridiem})
+		case 'M':
+			f.digits(FieldMinute, 2)
+		case 'S':
+			f.digits(FieldSecond, 2)
+		case 'f':
+			f.steps = append(f.steps, FormatStep{Op: FormatFraction})
+		case 'z':
+			f.steps = append(f.steps, FormatStep{Op: FormatOffset})
+			f.offset = true
+		case 'Z':
+			f.steps = append(f.steps, FormatStep{Op: FormatZoneName})
+			f.offset = true
+		case 'T':
+			err = f.compile("%H:%M:%S", hour12, year2)
+		case 'F':
+			err = f.compile("%Y-%m-%d", hour12, year2)
+		case 'D':
+			err = f.compile("%m/%d/%y", hour12, year2)
+		case 'R':
+			err = f.compile("%H:%M", hour12, year2)
+		case 'n', 't':
+			f.space()
+		case '%':
+			f.steps = append(f.steps, FormatStep{Op: FormatLiteral, Char: '%'})
+		default:
+			return fmt.Errorf("date: format %q: unsupported directive %%%c", f.layout, layout[i])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// String returns the layout of f.
+func (f *Format) String() string { return f.layout }
+
+// Zone returns the time zone used for
+// timestamps without a UTC offset, or nil
+// if those timestamps are interpreted as UTC.
+func (f *Format) Zone() *Zone { return f.zone }
+
+// HasOffset returns true if the layout
+// of f includes a UTC offset (%z or %Z),
+// in which case f.Zone is never used.
+func (f *Format) HasOffset() bool { return f.offset }
+
+// Steps returns the sequence of operations
+// performed by f.Parse. The returned slice
+// must not be modified.
+func (f *Format) Steps() []FormatStep { return f.steps }
+
+var monthNames = []string{
+	"jan", "feb", "mar", "apr", "may", "jun",
+	"jul", "aug", "sep", "oct", "nov", "dec",
+}
+
+var weekdayNames = []string{
+	"sun", "mon", "tue", "wed", "thu", "fri", "sat",
+}
+
+var zoneNames = []string{"utc", "gmt"}
+
+func isalpha(c byte) bool {
+	c |= 0x20
+	return c >= 'a' && c <= 'z'
+}
+
+// matchPrefix matches one of names (which are
+// lowercase and three letters long) at the start
+// of data, ignoring case, and returns the index
+// of the name and the number of bytes consumed
+func matchPrefix(data []byte, names []string) (int, int) {
+	if len(data) < 3 {
+		return -1, 0
+	}
+	for i := range names {
+		if data[0]|0x20 == names[i][0] &&
+			data[1]|0x20 == names[i][1] &&
+			data[2]|0x20 == names[i][2] {
+			return i, 3
+		}
+	}
+	return -1, 0
+}
+
+// matchName is like matchPrefix, but
+// any letters following the prefix are
+// consumed as well (so that both "Jan"
+// and "January" are accepted)
+func matchName(data []byte, names []string) (int, int) {
+	i, n := matchPrefix(data, names)
+	if i < 0 {
+		return i, n
+	}
+	for n < len(data) && isalpha(data[n]) {
+		n++
+	}
+	return i, n
+}
+
+func parseDigits(data []byte, min, max int) (v, n int) {
+	for n < max && n < len(data) && data[n] >= '0' && data[n] <= '9' {
+		v = v*10 + int(data[n]-'0')
+		n++
+	}
+	if n < min {
+		return 0, -1
+	}
+	return v, n
+}
+
+// Parse parses a timestamp from data
+// according to f and returns the time and true,
+// or the zero time and false if data does not
+// match f. The whole of data must be consumed.
+func (f *Format) Parse(data []byte) (Time, bool) {
+	fields := [6]int{FieldYear: 1970, FieldMonth: 1, FieldDay: 1}
+	ns, pm, off := 0, 0, 0
+	hasoff := false
+	for i := range f.steps {
+		s := &f.steps[i]
+		switch s.Op {
+		case FormatDigits:
+			v, n := parseDigits(data, s.Min, s.Max)
+			if n < 0 {
+				return Time{}, false
+			}
+			fields[s.Field] = v
+			data = data[n:]
+		case FormatFraction:
+			v, n := parseDigits(data, 1, 9)
+			if n < 0 {
+				return Time{}, false
+			}
+			for j := n; j < 9; j++ {
+				v *= 10
+			}
+			ns = v
+			data = data[n:]
+		case FormatLiteral:
+			if len(data) == 0 || data[0] != s.Char {
+				return Time{}, false
+			}
+			data = data[1:]
+		case FormatSpace:
+			for len(data) > 0 && isspace(data[0]) {
+				data = data[1:]
+			}
+		case FormatMonthName:
+			m, n := matchName(data, monthNames)
+			if m < 0 {
+				return Time{}, false
+			}
+			fields[FieldMonth] = m + 1
+			data = data[n:]
+		case FormatWeekdayName:
+			d, n := matchName(data, weekdayNames)
+			if d < 0 {
+				return Time{}, false
+			}
+			data = data[n:]
+		case FormatMeridiem:
+			if len(data) < 2 || data[1]|0x20 != 'm' {
+				return Time{}, false
+			}
+			switch data[0] | 0x20 {
+			case 'a':
+				pm = 0
+			case 'p':
+				pm = 12
+			default:
+				return Time{}, false
+			}
+			data = data[2:]
+		case FormatOffset:
+			if len(data) > 0 && data[0]|0x20 == 'z' {
+				off, hasoff = 0, true
+				data = data[1:]
+				break
+			}
+			if len(data) < 3 || (data[0] != '+' && data[0] != '-') {
+				return Time{}, false
+			}
+			neg := data[0] == '-'
+			h, n := parseDigits(data[1:], 2, 2)
+			if n < 0 || h > 23 {
+				return Time{}, false
+			}
+			data = data[3:]
+			m := 0
+			if len(data) > 0 && data[0] == ':' {
+				m, n = parseDigits(data[1:], 2, 2)
+				if n < 0 {
+					return Time{}, false
+				}
+				data = data[3:]
+			} else if v, n := parseDigits(data, 2, 2); n > 0 {
+				m = v
+				data = data[2:]
+			}
+			if m > 59 {
+				return Time{}, false
+			}
+			off = h*60 + m
+			if neg {
+				off = -off
+			}
+			hasoff = true
+		case FormatZoneName:
+			if len(data) > 0 && data[0]|0x20 == 'z' {
+				data = data[1:]
+			} else if _, n := matchPrefix(data, zoneNames); n > 0 {
+				data = data[n:]
+			} else {
+				return Time{}, false
+			}
+			off, hasoff = 0, true
+		case FormatHour12:
+			h := fields[FieldHour]
+			if h < 1 || h > 12 {
+				return Time{}, false
+			}
+			fields[FieldHour] = h%12 + pm
+		case FormatYear2:
+			if fields[FieldYear] < 69 {
+				fields[FieldYear] += 2000
+			} else {
+				fields[FieldYear] += 1900
+			}
+		}
+	}
+	if len(data) != 0 ||
+		fields[FieldMonth] < 1 || fields[FieldMonth] > 12 ||
+		fields[FieldDay] < 1 || fields[FieldDay] > daysin(fields[FieldYear], fields[FieldMonth]) ||
+		fields[FieldHour] > 23 || fields[FieldMinute] > 59 ||
+		fields[FieldSecond] > 60 {
+		return Time{}, false
+	}
+	t := Date(fields[FieldYear], fields[FieldMonth], fields[FieldDay],
+		fields[FieldHour], fields[FieldMinute], fields[FieldSecond], ns)
+	if hasoff {
+		return t.Add(-time.Duration(off) * time.Minute), true
+	}
+	if f.zone != nil {
+		return f.zone.UTC(t), true
+	}
+	return t, true
+}
@@ -0,0 +1,93 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package date
+
+import (
+	"testing"
+)
+
+func TestFormatParse(t *testing.T) {
+	ny, err := LoadZone("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := []struct {
+		layout string
+		zone   *Zone
+		input  string
+		want   Time
+		ok     bool
+	}{
+		// Apache common log format
+		{"%d/%b/%Y:%H:%M:%S %z", nil, "02/Jan/2006:15:04:05 -0700", Date(2006, 1, 2, 22, 4, 5, 0), true},
+		{"%d/%b/%Y:%H:%M:%S %z", nil, "02/jan/2006:15:04:05 +05:30", Date(2006, 1, 2, 9, 34, 5, 0), true},
+		{"%d/%b/%Y:%H:%M:%S %z", nil, "02/Jan/2006:15:04:05", Time{}, false},
+		{"%d/%b/%Y:%H:%M:%S %z", nil, "02/Jnu/2006:15:04:05 -0700", Time{}, false},
+		// no zone
+		{"%Y-%m-%d %H:%M:%S", nil, "2006-01-02 15:04:05", Date(2006, 1, 2, 15, 4, 5, 0), true},
+		{"%Y-%m-%d %H:%M:%S", nil, "2006-01-02  15:04:05", Date(2006, 1, 2, 15, 4, 5, 0), true},
+		{"%Y-%m-%d %H:%M:%S", nil, "2006-01-0215:04:05", Date(2006, 1, 2, 15, 4, 5, 0), true},
+		{"%Y-%m-%d %H:%M:%S", nil, "2006-01-02 15:04:05 ", Time{}, false},
+		{"%Y-%m-%d %H:%M:%S", nil, "2006-13-02 15:04:05", Time{}, false},
+		{"%Y-%m-%d %H:%M:%S", nil, "2006-01-02 24:04:05", Time{}, false},
+		{"%Y-%m-%d %H:%M:%S", ny, "2006-01-02 15:04:05", Date(2006, 1, 2, 20, 4, 5, 0), true},
+		{"%Y-%m-%d %H:%M:%S", ny, "2006-07-02 15:04:05", Date(2006, 7, 2, 19, 4, 5, 0), true},
+		{"%F %T.%f", nil, "2006-01-02 15:04:05.123", Date(2006, 1, 2, 15, 4, 5, 123000000), true},
+		{"%F %T.%f", nil, "2006-01-02 15:04:05.", Time{}, false},
+		{"%Y%m%d", nil, "20060102", Date(2006, 1, 2, 0, 0, 0, 0), true},
+		// days beyond the end of the month
+		{"%Y-%m-%d", nil, "2023-02-31", Time{}, false},
+		{"%Y-%m-%d", nil, "2023-02-29", Time{}, false},
+		{"%Y-%m-%d", nil, "1900-02-29", Time{}, false},
+		{"%Y-%m-%d", nil, "2000-02-29", Date(2000, 2, 29, 0, 0, 0, 0), true},
+		{"%Y-%m-%d", nil, "2024-02-29", Date(2024, 2, 29, 0, 0, 0, 0), true},
+		{"%Y-%m-%d", nil, "2023-04-31", Time{}, false},
+		{"%Y-%m-%d", nil, "2023-12-31", Date(2023, 12, 31, 0, 0, 0, 0), true},
+		// RFC1123
+		{"%a, %d %b %Y %T %Z", nil, "Mon, 02 Jan 2006 15:04:05 GMT", Date(2006, 1, 2, 15, 4, 5, 0), true},
+		{"%a, %d %b %Y %T %Z", ny, "Monday, 02 January 2006 15:04:05 UTC", Date(2006, 1, 2, 15, 4, 5, 0), true},
+		{"%a, %d %b %Y %T %Z", nil, "Mon, 02 Jan 2006 15:04:05 MST", Time{}, false},
+		// 12-hour clock and two-digit years
+		{"%D %I:%M %p", nil, "01/02/06 3:04 PM", Date(2006, 1, 2, 15, 4, 0, 0), true},
+		{"%D %I:%M %p", nil, "01/02/99 12:04 am", Date(1999, 1, 2, 0, 4, 0, 0), true},
+		{"%D %I:%M %p", nil, "01/02/99 13:04 am", Time{}, false},
+		{"%e %b %Y", nil, " 2 Jan 2006", Date(2006, 1, 2, 0, 0, 0, 0), true},
+		{"%H:%M %%", nil, "15:04 %", Date(1970, 1, 1, 15, 4, 0, 0), true},
+		{"%Y-%m-%dT%H:%M:%S%z", nil, "2006-01-02T15:04:05Z", Date(2006, 1, 2, 15, 4, 5, 0), true},
+		{"%Y-%m-%dT%H:%M:%S%z", nil, "2006-01-02T15:04:05-07", Date(2006, 1, 2, 22, 4, 5, 0), true},
+	}
+	for i := range runs {
+		f, err := CompileFormat(runs[i].layout, runs[i].zone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := f.Parse([]byte(runs[i].input))
+		if ok != runs[i].ok {
+			t.Errorf("%q %q: ok = %v", runs[i].layout, runs[i].input, ok)
+			continue
+		}
+		if !got.Equal(runs[i].want) {
+			t.Errorf("%q %q: got %s, want %s", runs[i].layout, runs[i].input, got, runs[i].want)
+		}
+	}
+}
+
+func TestCompileFormatErrors(t *testing.T) {
+	for _, layout := range []string{"%Y-%m-%", "%Q", "%s"} {
+		if _, err := CompileFormat(layout, nil); err == nil {
+			t.Errorf("%q: expected an error", layout)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package date
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	// time zones are resolved from the embedded
+	// database so that query results do not depend
+	// on the zoneinfo files installed on the host
+	_ "time/tzdata"
+)
+
+// The range of years for which zone
+// transitions are computed. Offsets before
+// the first transition are those of the
+// first zone in effect; offsets after the last
+// transition are those of the last zone in effect.
+const (
+	zoneFirstYear = 1900
+	zoneLastYear  = 2100
+)
+
+// A Zone is a table of UTC offset transitions
+// for a time zone.
+type Zone struct {
+	name string
+	// times[i] is the time (in Unix microseconds)
+	// at which offsets[i] (also in microseconds)
+	// takes effect; times[0] is always math.MinInt64
+	times   []int64
+	offsets []int64
+	// local is the same table keyed
+	// by wall-clock time rather than UTC
+	// (see Zone.UTC)
+	local []int64
+}
+
+var zones sync.Map // map[string]*Zone
+
+// LoadZone returns the Zone with the given
+// IANA time zone name (e.g. "America/New_York").
+// The zone database is embedded in the binary,
+// so the result does not depend upon the host.
+func LoadZone(name string) (*Zone, error) {
+	if z, ok := zones.Load(name); ok {
+		return z.(*Zone), nil
+	}
+	// time.LoadLocation interprets "" and "Local"
+	// specially; neither is meaningful in a query
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("invalid time zone %q", name)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	z := &Zone{name: name}
+	t := time.Date(zoneFirstYear, 1, 1, 0, 0, 0, 0, loc)
+	_, off := t.Zone()
+	z.times = append(z.times, math.MinInt64)
+	z.offsets = append(z.offsets, int64(off)*1e6)
+	// time.Time.ZoneBounds is not reliable for
+	// times beyond the last explicit transition
+	// in the database, so the transitions are found
+	// by stepping forward one day at a time and
+	// then searching for the exact second at which
+	// the offset changed (transitions less than a
+	// day apart do not occur in practice)
+	for t.Year() < zoneLastYear {
+		next := t.Add(24 * time.Hour)
+		if _, noff := next.Zone(); noff != off {
+			lo, hi := t.Unix(), next.Unix()
+			for hi-lo > 1 {
+				mid := lo + (hi-lo)/2
+				if _, moff := time.Unix(mid, 0).In(loc).Zone(); moff == off {
+					lo = mid
+				} else {
+					hi = mid
+				}
+			}
+			z.times = append(z.times, hi*1e6)
+			z.offsets = append(z.offsets, int64(noff)*1e6)
+			off = noff
+		}
+		t = next
+	}
+	z.local = make([]int64, len(z.times))
+	z.local[0] = math.MinInt64
+	for i := 1; i < len(z.times); i++ {
+		// the wall-clock time at which the new offset
+		// starts to apply is the later of the two
+		// readings of the clock at the transition
+		off := z.offsets[i]
+		if prev := z.offsets[i-1]; prev > off {
+			off = prev
+		}
+		z.local[i] = z.times[i] + off
+	}
+	actual, _ := zones.LoadOrStore(name, z)
+	return actual.(*Zone), nil
+}
+
+// String returns the name of z.
+func (z *Zone) String() string { return z.name }
+
+// Transitions returns the times (in Unix microseconds)
+// at which the UTC offset of z changes along with the
+// offsets (also in microseconds) that take effect at
+// those times. The first time is always math.MinInt64.
+// The returned slices must not be modified.
+func (z *Zone) Transitions() (times, offsets []int64) {
+	return z.times, z.offsets
+}
+
+// LocalTransitions is like Transitions, but the
+// times are wall-clock times in z (represented
+// as Unix microseconds) rather than UTC times.
+// Subtracting the offset in effect at a wall-clock
+// time yields the corresponding UTC time.
+func (z *Zone) LocalTransitions() (times, offsets []int64) {
+	return z.local, z.offsets
+}
+
+func search(times, offsets []int64, us int64) int64 {
+	i := sort.Search(len(times), func(i int) bool {
+		return times[i] > us
+	})
+	return offsets[i-1]
+}
+
+// Offset returns the UTC offset, in microseconds,
+// of z at the time us (in Unix microseconds).
+func (z *Zone) Offset(us int64) int64 {
+	return search(z.times, z.offsets, us)
+}
+
+// Local returns the wall-clock time in z
+// at the instant t, represented as a UTC time.
+func (z *Zone) Local(t Time) Time {
+	return t.Add(time.Duration(z.Offset(t.UnixMicro())) * time.Microsecond)
+}
+
+// UTC is the inverse of Local: it returns the
+// instant at which the wall clock in z reads t.
+//
+// Wall-clock times that occur twice because
+// of a transition are mapped to the earlier of
+// the two instants, and wall-clock times that
+// are skipped by a transition are mapped using
+// the offset in effect before the transition
+// (so 02:30 on the day that clocks move from
+// 02:00 to 03:00 becomes 03:30).
+func (z *Zone) UTC(t Time) Time {
+	off := search(z.local, z.offsets, t.UnixMicro())
+	return t.Add(-time.Duration(off) * time.Microsecond)
+}
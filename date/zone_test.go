@@ -0,0 +1,91 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package date
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestZoneLocal(t *testing.T) {
+	names := []string{
+		"UTC",
+		"America/New_York",
+		"Europe/Berlin",
+		"Australia/Lord_Howe",
+		"Asia/Kolkata",
+		"Pacific/Chatham",
+	}
+	start := time.Date(1950, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+	end := time.Date(2080, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+	for _, name := range names {
+		z, err := LoadZone(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 5000; i++ {
+			sec := start + rand.Int63n(end-start)
+			tm := time.Unix(sec, 0).In(loc)
+			y, mo, d := tm.Date()
+			h, mi, s := tm.Clock()
+			want := Date(y, int(mo), d, h, mi, s, 0)
+			got := z.Local(Unix(sec, 0))
+			if !got.Equal(want) {
+				t.Fatalf("%s: %s: got %s, want %s", name, tm, got, want)
+			}
+			// every wall-clock time that occurs
+			// only once must round-trip
+			if back := z.UTC(got); !back.Equal(Unix(sec, 0)) {
+				_, off0 := tm.Add(-time.Hour).Zone()
+				_, off1 := tm.Add(time.Hour).Zone()
+				if off0 == off1 {
+					t.Fatalf("%s: %s: UTC(%s) = %s", name, tm, got, back)
+				}
+			}
+		}
+	}
+}
+
+func TestZoneTransitions(t *testing.T) {
+	z, err := LoadZone("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := []struct {
+		local, utc Time
+	}{
+		// ambiguous: 01:30 EDT and 01:30 EST
+		{Date(2022, 11, 6, 1, 30, 0, 0), Date(2022, 11, 6, 5, 30, 0, 0)},
+		// skipped: 02:30 EST is 03:30 EDT
+		{Date(2022, 3, 13, 2, 30, 0, 0), Date(2022, 3, 13, 7, 30, 0, 0)},
+		{Date(2022, 3, 13, 0, 0, 0, 0), Date(2022, 3, 13, 5, 0, 0, 0)},
+		{Date(2022, 3, 14, 0, 0, 0, 0), Date(2022, 3, 14, 4, 0, 0, 0)},
+	}
+	for i := range runs {
+		if got := z.UTC(runs[i].local); !got.Equal(runs[i].utc) {
+			t.Errorf("UTC(%s) = %s, want %s", runs[i].local, got, runs[i].utc)
+		}
+	}
+	for _, bad := range []string{"", "Local", "Mars/Olympus_Mons"} {
+		if _, err := LoadZone(bad); err == nil {
+			t.Errorf("LoadZone(%q) succeeded", bad)
+		}
+	}
+}
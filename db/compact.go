@@ -0,0 +1,417 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package db
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SnellerInc/sneller/date"
+	"github.com/SnellerInc/sneller/ion"
+	"github.com/SnellerInc/sneller/ion/blockfmt"
+	"github.com/SnellerInc/sneller/sorting"
+
+	"golang.org/x/exp/slices"
+)
+
+// DefaultCompactSize is the default target
+// decompressed size of objects produced by compaction.
+//
+// Compaction buffers the decompressed contents
+// of each group of objects in memory while they
+// are sorted, so this also bounds the memory
+// used to compact a single group.
+const DefaultCompactSize = 512 * mega
+
+func (b *Builder) compactSize() int64 {
+	if b.CompactSize > 0 {
+		return b.CompactSize
+	}
+	return DefaultCompactSize
+}
+
+// Compact rewrites the packed objects of each
+// table matching tblpat within db so that small
+// objects are coalesced into objects of approximately
+// b.CompactSize decompressed bytes. If the table
+// Definition specifies a Cluster key, then the rows
+// of each rewritten object are sorted by that key,
+// which makes the per-block ranges in the object
+// trailers more selective.
+//
+// Only objects in blockfmt.Index.Inline that are
+// smaller than the target size are considered for
+// compaction, and objects are only coalesced with
+// other objects in the same partition. An object
+// that would be rewritten on its own is left as-is
+// unless b.Force is set, since objects produced by
+// compaction are already sorted.
+//
+// Compact returns ErrBuildAgain if a table index
+// is currently being scanned. (See Builder.Scan.)
+func (b *Builder) Compact(who Tenant, db, tblpat string) error {
+	if tblpat == "" {
+		tblpat = "*"
+	}
+	dst, err := who.Root()
+	if err != nil {
+		return err
+	}
+	possible, err := fs.Glob(dst, DefinitionPath(db, tblpat))
+	if err != nil {
+		return err
+	}
+	errlist := make([]error, len(possible))
+	var wg sync.WaitGroup
+	wg.Add(len(possible))
+	for i := range possible {
+		tab, _ := path.Split(possible[i])
+		go func(i int, table string) {
+			defer wg.Done()
+			st, err := b.open(db, table, who)
+			if err != nil {
+				errlist[i] = err
+				return
+			}
+			errlist[i] = st.compact()
+		}(i, path.Base(tab))
+	}
+	wg.Wait()
+	return combine(errlist)
+}
+
+// compactGroup is a list of indices
+// into blockfmt.Index.Inline that will
+// be rewritten into a single object
+type compactGroup struct {
+	part string
+	lst  []int
+}
+
+// compactGroups determines the list of
+// groups of objects within idx.Inline that
+// should be rewritten
+func (st *tableState) compactGroups(idx *blockfmt.Index) []compactGroup {
+	target := st.conf.compactSize()
+	type pending struct {
+		compactGroup
+		size int64
+	}
+	pend := make(map[string]*pending)
+	var out []compactGroup
+	done := func(p *pending) {
+		if len(p.lst) > 1 || (len(p.lst) == 1 && st.conf.Force && len(st.def.Cluster) > 0) {
+			out = append(out, p.compactGroup)
+		}
+	}
+	for i := range idx.Inline {
+		size := idx.Inline[i].Trailer.Decompressed()
+		if size >= target {
+			continue
+		}
+		part, ok := st.partitionFor(idx.Inline[i].Path)
+		if !ok {
+			continue
+		}
+		p := pend[part]
+		if p != nil && p.size+size > target {
+			done(p)
+			p = nil
+		}
+		if p == nil {
+			p = &pending{compactGroup: compactGroup{part: part}}
+			pend[part] = p
+		}
+		p.lst = append(p.lst, i)
+		p.size += size
+	}
+	for _, p := range pend {
+		done(p)
+	}
+	// keep the output deterministic
+	slices.SortFunc(out, func(x, y compactGroup) bool {
+		return x.lst[0] < y.lst[0]
+	})
+	return out
+}
+
+func (st *tableState) compact() error {
+	var cache IndexCache
+	idx, err := st.index(&cache)
+	if err != nil {
+		return err
+	}
+	if idx.Scanning {
+		return ErrBuildAgain
+	}
+	groups := st.compactGroups(idx)
+	if len(groups) == 0 {
+		st.conf.logf("table %s/%s: nothing to compact", st.db, st.table)
+		return nil
+	}
+	// groups are compacted sequentially
+	// so that we only buffer one group
+	// in memory at a time
+	out := make([]blockfmt.Descriptor, len(groups))
+	for i := range groups {
+		err := st.compactGroup(idx, &groups[i], &out[i])
+		if err != nil {
+			return fmt.Errorf("compacting %s/%s: %w", st.db, st.table, err)
+		}
+	}
+	// the compacted object takes the place
+	// of the newest object in its group
+	replace := make(map[int]int)
+	remove := make(map[int]bool)
+	for i := range groups {
+		lst := groups[i].lst
+		replace[lst[len(lst)-1]] = i
+		for _, j := range lst {
+			remove[j] = true
+		}
+	}
+	expiry := date.Now().Add(st.conf.GCMinimumAge)
+	inline := make([]blockfmt.Descriptor, 0, len(idx.Inline))
+	for i := range idx.Inline {
+		if g, ok := replace[i]; ok {
+			inline = append(inline, out[g])
+		}
+		if remove[i] {
+			st.conf.logf("compacted %s", idx.Inline[i].Path)
+			idx.ToDelete = append(idx.ToDelete, blockfmt.Quarantined{
+				Path:   idx.Inline[i].Path,
+				Expiry: expiry,
+			})
+			continue
+		}
+		inline = append(inline, idx.Inline[i])
+	}
+	idx.Inline = inline
+	idx.Created = date.Now().Truncate(time.Microsecond)
+	err = st.flush(idx, &cache)
+	if err != nil {
+		return err
+	}
+	return st.runGC(idx)
+}
+
+// clusterKeys returns the list of
+// key paths from st.def.Cluster
+func (st *tableState) clusterKeys() [][]string {
+	keys := make([][]string, len(st.def.Cluster))
+	for i := range st.def.Cluster {
+		keys[i] = strings.Split(st.def.Cluster[i], ".")
+	}
+	return keys
+}
+
+func (st *tableState) compactGroup(idx *blockfmt.Index, g *compactGroup, dst *blockfmt.Descriptor) error {
+	rc := &rowCollector{
+		keys: st.clusterKeys(),
+		out:  new(ion.Symtab),
+	}
+	var ranges [][]string
+	seen := make(map[string]bool)
+	for _, i := range g.lst {
+		desc := &idx.Inline[i]
+		t, err := st.unwrap(desc)
+		if err != nil {
+			return err
+		}
+		f, err := open(st.ofs, desc.Path, desc.ETag, desc.Size)
+		if err != nil {
+			return err
+		}
+		err = rc.collect(f, t)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", desc.Path, err)
+		}
+		for _, name := range desc.Trailer.Sparse.FieldNames() {
+			if !seen[name] {
+				seen[name] = true
+				ranges = append(ranges, strings.Split(name, "."))
+			}
+		}
+	}
+	rc.sort()
+	first := &idx.Inline[g.lst[0]]
+	c := blockfmt.Converter{
+		Inputs: []blockfmt.Input{{
+			Path: first.Path,
+			ETag: first.ETag,
+			R:    io.NopCloser(strings.NewReader("")),
+			F: &clusterFormat{
+				st:     rc.out,
+				rows:   rc.rows,
+				ranges: ranges,
+			},
+		}},
+		Align:     st.conf.align(),
+		FlushMeta: st.conf.flushMeta(),
+		Comp:      st.conf.comp(),
+		// every object in the group belongs to
+		// the same partition, so the constants
+		// are identical for each of them
+		Constants: first.Trailer.Sparse.Consts().Fields(nil),
+	}
+	return st.writeObject(&c, g.part, dst)
+}
+
+// clusterRow is a single row along with
+// its encoded cluster key values
+type clusterRow struct {
+	key  [][]byte
+	body []byte
+}
+
+// rowCollector is an io.Writer that accepts
+// the output of blockfmt.Decoder.Copy and
+// re-encodes each row using a single symbol table
+type rowCollector struct {
+	keys [][]string
+	in   ion.Symtab // symbol table of the current input
+	out  *ion.Symtab
+	buf  ion.Buffer
+	rows []clusterRow
+}
+
+// collect adds all of the rows in the packed
+// object described by t and read from src
+func (rc *rowCollector) collect(src io.Reader, t *blockfmt.Trailer) error {
+	if len(t.Blocks) == 0 {
+		return nil
+	}
+	rc.in.Reset()
+	var d blockfmt.Decoder
+	d.Set(t, len(t.Blocks))
+	_, err := d.Copy(rc, io.LimitReader(src, t.Offset-t.Blocks[0].Offset))
+	return err
+}
+
+func (rc *rowCollector) Write(p []byte) (int, error) {
+	n := len(p)
+	var err error
+	for len(p) > 0 {
+		if ion.IsBVM(p) || ion.TypeOf(p) == ion.AnnotationType {
+			p, err = rc.in.Unmarshal(p)
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+		size := ion.SizeOf(p)
+		if size <= 0 || size > len(p) {
+			return 0, fmt.Errorf("object size %d out of range [:%d]", size, len(p))
+		}
+		// skip nop pads, etc.
+		if ion.TypeOf(p) == ion.StructType {
+			d, _, err := ion.ReadDatum(&rc.in, p[:size])
+			if err != nil {
+				return 0, err
+			}
+			rc.add(d)
+		}
+		p = p[size:]
+	}
+	return n, nil
+}
+
+func (rc *rowCollector) add(d ion.Datum) {
+	row := clusterRow{key: make([][]byte, len(rc.keys))}
+	for i := range rc.keys {
+		v := d
+		for _, name := range rc.keys[i] {
+			v = v.Field(name)
+		}
+		if v.Empty() {
+			continue
+		}
+		rc.buf.Reset()
+		v.Encode(&rc.buf, rc.out)
+		row.key[i] = slices.Clone(rc.buf.Bytes())
+	}
+	// note: d shares memory with the decoder
+	// output, so it must be copied here
+	rc.buf.Reset()
+	d.Encode(&rc.buf, rc.out)
+	row.body = slices.Clone(rc.buf.Bytes())
+	rc.rows = append(rc.rows, row)
+}
+
+// missing cluster keys sort like nulls
+var missingKey = []byte{0x0f}
+
+func (rc *rowCollector) sort() {
+	if len(rc.keys) == 0 {
+		return
+	}
+	ord := sorting.Ordering{
+		Direction: sorting.Ascending,
+		Nulls:     sorting.NullsFirst,
+	}
+	slices.SortStableFunc(rc.rows, func(x, y clusterRow) bool {
+		for i := range x.key {
+			a, b := x.key[i], y.key[i]
+			if a == nil {
+				a = missingKey
+			}
+			if b == nil {
+				b = missingKey
+			}
+			if c := ord.Compare(a, b); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+// clusterFormat is a blockfmt.RowFormat
+// that writes rows that have already been
+// collected and sorted by a rowCollector
+//
+// The rows already include any partition
+// constants, so the constants passed to
+// Convert are ignored.
+type clusterFormat struct {
+	st     *ion.Symtab
+	rows   []clusterRow
+	ranges [][]string
+}
+
+func (c *clusterFormat) Name() string { return "ion" }
+
+func (c *clusterFormat) Convert(_ io.Reader, dst *ion.Chunker, _ []ion.Field) error {
+	dst.WalkTimeRanges = c.ranges
+	var buf ion.Buffer
+	c.st.Marshal(&buf, true)
+	_, err := dst.Write(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	for i := range c.rows {
+		_, err = dst.Write(c.rows[i].body)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
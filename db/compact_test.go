@@ -0,0 +1,182 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package db
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SnellerInc/sneller/ion"
+	"github.com/SnellerInc/sneller/ion/blockfmt"
+)
+
+func TestCompact(t *testing.T) {
+	checkFiles(t)
+	tmpdir := t.TempDir()
+	dfs := newDirFS(t, tmpdir)
+	owner := newTenant(dfs)
+	err := WriteDefinition(dfs, "default", &Definition{
+		Name:    "rows",
+		Cluster: []string{"group", "id"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := Builder{
+		Align: 1024,
+		// prevent merging on append so that
+		// each append produces a new object
+		MinMergeSize: 1,
+		Logf:         t.Logf,
+	}
+	const files, rows = 3, 50
+	for i := 0; i < files; i++ {
+		var text strings.Builder
+		for _, j := range rand.Perm(rows) {
+			id := i*rows + j
+			fmt.Fprintf(&text, "{\"id\": %d, \"group\": %d}\n", id, id%4)
+		}
+		name := fmt.Sprintf("input-%d.json", i)
+		err := os.WriteFile(filepath.Join(tmpdir, name), []byte(text.String()), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lst, err := collectGlob(dfs, nil, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = b.append(owner, "default", "rows", lst, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	idx, err := OpenIndex(dfs, "default", "rows", owner.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Inline) != files {
+		t.Fatalf("expected %d objects before compaction; got %d", files, len(idx.Inline))
+	}
+
+	err = b.Compact(owner, "default", "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err = OpenIndex(dfs, "default", "rows", owner.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Inline) != 1 {
+		t.Fatalf("expected 1 object after compaction; got %d", len(idx.Inline))
+	}
+	if len(idx.ToDelete) != files {
+		t.Errorf("expected %d objects in ToDelete; got %d", files, len(idx.ToDelete))
+	}
+
+	desc := &idx.Inline[0]
+	f, err := dfs.Open(desc.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rc := &rowCollector{
+		keys: [][]string{{"group"}, {"id"}},
+		out:  new(ion.Symtab),
+	}
+	err = rc.collect(f, desc.Trailer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.rows) != files*rows {
+		t.Fatalf("got %d rows back; expected %d", len(rc.rows), files*rows)
+	}
+	getint := func(buf []byte) int64 {
+		d, _, err := ion.ReadDatum(rc.out, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u, ok := d.Uint(); ok {
+			return int64(u)
+		}
+		i, ok := d.Int()
+		if !ok {
+			t.Fatalf("unexpected datum %v", d)
+		}
+		return i
+	}
+	var lastgroup, lastid int64 = -1, -1
+	for i := range rc.rows {
+		group, id := getint(rc.rows[i].key[0]), getint(rc.rows[i].key[1])
+		if group < lastgroup || (group == lastgroup && id <= lastid) {
+			t.Fatalf("row %d: (%d, %d) out of order after (%d, %d)", i, group, id, lastgroup, lastid)
+		}
+		lastgroup, lastid = group, id
+	}
+
+	// a second compaction should have nothing to do
+	err = b.Compact(owner, "default", "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx2, err := OpenIndex(dfs, "default", "rows", owner.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx2.Inline) != 1 || idx2.Inline[0].Path != desc.Path {
+		t.Fatal("second compaction rewrote objects")
+	}
+	checkContents(t, idx2, dfs)
+}
+
+func TestCompactGroups(t *testing.T) {
+	mkdesc := func(part string, size int) blockfmt.Descriptor {
+		return blockfmt.Descriptor{
+			ObjectInfo: blockfmt.ObjectInfo{
+				Path: "db/foo/bar/" + part + "/packed-x.zion",
+			},
+			Trailer: &blockfmt.Trailer{
+				Blocks: []blockfmt.Blockdesc{{Chunks: size}},
+			},
+		}
+	}
+	st := &tableState{
+		def:   &Definition{Name: "bar"},
+		conf:  Builder{CompactSize: 10},
+		db:    "foo",
+		table: "bar",
+	}
+	idx := &blockfmt.Index{
+		Inline: []blockfmt.Descriptor{
+			mkdesc("a", 4),
+			mkdesc("b", 4),
+			mkdesc("a", 4),
+			mkdesc("a", 20), // too large
+			mkdesc("a", 4),
+			mkdesc("b", 9),
+			mkdesc("c", 1),
+		},
+	}
+	got := st.compactGroups(idx)
+	want := []compactGroup{
+		{part: "a", lst: []int{0, 2}},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -42,6 +42,18 @@ type Input struct {
 	// eliminate some of the data as it is parsed.
 	// Hints data is format-specific.
 	Hints json.RawMessage `json:"hints,omitempty"`
+	// Transform, if non-empty, is a query of the form
+	//
+	//	SELECT ... FROM input [WHERE ...]
+	//
+	// that is evaluated over the rows of each
+	// input file as it is ingested. The query may
+	// project, rename and derive fields, and the
+	// WHERE clause may drop rows. Partition fields
+	// are added to the rows after they have been
+	// transformed, so they cannot be referenced
+	// from the query.
+	Transform string `json:"transform,omitempty"`
 }
 
 // A Partition defines a synthetic field that is
@@ -80,6 +92,15 @@ type Definition struct {
 	// are generated from components of the input
 	// URI and used to partition table data.
 	Partitions []Partition `json:"partitions,omitempty"`
+	// Cluster is the list of field paths
+	// (using '.' to separate path components)
+	// by which rows are sorted when packed
+	// objects are compacted. See Builder.Compact.
+	Cluster []string `json:"cluster,omitempty"`
+	// Schema, if non-nil, is the declared schema
+	// of the table. Rows are checked against the
+	// schema as they are ingested. See Schema.
+	Schema *Schema `json:"schema,omitempty"`
 	// Features is a list of feature flags that
 	// can be used to turn on features for beta-testing.
 	Features []string `json:"beta_features,omitempty"`
@@ -155,6 +176,18 @@ func WriteDefinition(dst OutputFS, db string, s *Definition) error {
 	if s.Name == "" {
 		return fmt.Errorf("cannot write definition with no Name")
 	}
+	if s.Schema != nil {
+		if err := s.Schema.Validate(); err != nil {
+			return err
+		}
+	}
+	for i := range s.Inputs {
+		if s.Inputs[i].Transform != "" {
+			if _, err := compileTransform(s.Inputs[i].Transform); err != nil {
+				return err
+			}
+		}
+	}
 	buf, err := json.MarshalIndent(s, "", "\t")
 	if err != nil {
 		return err
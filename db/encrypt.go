@@ -0,0 +1,252 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+
+	"github.com/SnellerInc/sneller/date"
+	"github.com/SnellerInc/sneller/expr/blob"
+	"github.com/SnellerInc/sneller/ion/blockfmt"
+)
+
+// ErrNoMasterKey is returned when a tenant
+// without a master key (see EncryptedTenant)
+// reads encrypted objects or re-keys a table.
+var ErrNoMasterKey = errors.New("tenant has no master key")
+
+// unwrapped returns t if it is not encrypted or if
+// its data key has already been unwrapped, or a copy
+// of t with the data key unwrapped with key otherwise.
+// The input trailer is never modified, since it
+// may be shared with an index cache.
+func unwrapped(t *blockfmt.Trailer, key *blockfmt.MasterKey) (*blockfmt.Trailer, error) {
+	if t == nil || t.Encryption == nil || t.Encryption.DataKey != nil {
+		return t, nil
+	}
+	if key == nil {
+		return nil, ErrNoMasterKey
+	}
+	enc := *t.Encryption
+	if err := enc.Unwrap(key); err != nil {
+		return nil, err
+	}
+	out := *t
+	out.Encryption = &enc
+	return &out, nil
+}
+
+// unwrap returns the trailer of desc with its
+// data key unwrapped with the tenant master key
+func (st *tableState) unwrap(desc *blockfmt.Descriptor) (*blockfmt.Trailer, error) {
+	t, err := unwrapped(desc.Trailer, MasterKey(st.owner))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", desc.Path, err)
+	}
+	return t, nil
+}
+
+// UnwrapKeys unwraps the data key of each
+// encrypted blob in lst with the master key of who
+// so that the blobs can be read by a query.
+//
+// Note that the unwrapped data keys are
+// included in the serialized form of the blobs,
+// so lst should be treated as a credential.
+func UnwrapKeys(who Tenant, lst *blob.List) error {
+	key := MasterKey(who)
+	for i := range lst.Contents {
+		c, ok := lst.Contents[i].(*blob.Compressed)
+		if !ok {
+			continue
+		}
+		t, err := unwrapped(c.Trailer, key)
+		if err != nil {
+			return err
+		}
+		if t != c.Trailer {
+			// don't modify the blob in place
+			cc := *c
+			cc.Trailer = t
+			lst.Contents[i] = &cc
+		}
+	}
+	return nil
+}
+
+// Rekey re-wraps the data keys of the encrypted
+// objects in the tables matching tblpat in db
+// so that they are wrapped with the current
+// master key of who rather than old.
+// Data keys that are already wrapped with the
+// current master key are left unchanged, so
+// Rekey may be run again if it fails partway.
+//
+// The index of each table, the lists of descriptors
+// that it references, and the files that record its
+// inputs are sealed again with the current master key.
+//
+// Each re-keyed object is copied to a new object
+// whose trailer holds the re-wrapped data key, so
+// that the object can be read back from its own
+// trailer (for example, by sdb unpack) with the
+// current master key; the blocks themselves are
+// not decrypted. The original objects are
+// quarantined and removed by garbage collection.
+func (b *Builder) Rekey(who Tenant, db, tblpat string, old *blockfmt.MasterKey) error {
+	if tblpat == "" {
+		tblpat = "*"
+	}
+	if MasterKey(who) == nil {
+		return ErrNoMasterKey
+	}
+	dst, err := who.Root()
+	if err != nil {
+		return err
+	}
+	possible, err := fs.Glob(dst, IndexPath(db, tblpat))
+	if err != nil {
+		return err
+	}
+	for i := range possible {
+		table := path.Base(path.Dir(possible[i]))
+		err := b.rekeyTable(who, db, table, old)
+		if err != nil {
+			return fmt.Errorf("rekey %s.%s: %w", db, table, err)
+		}
+	}
+	return nil
+}
+
+func (b *Builder) rekeyTable(who Tenant, db, table string, old *blockfmt.MasterKey) error {
+	st, err := b.open(db, table, who)
+	if err != nil {
+		return err
+	}
+	// metadata sealed with the old master key
+	// is unsealed with it and sealed again on flush
+	st.sealer.Fallback = old
+	var cache IndexCache
+	idx, err := st.index(&cache)
+	if err != nil {
+		return err
+	}
+	if idx.Scanning {
+		return ErrBuildAgain
+	}
+	idx.Inputs.Backing = st.ofs
+	err = idx.Inputs.Reseal()
+	if err != nil {
+		return err
+	}
+	key := MasterKey(who)
+	rekeyed := 0
+	var replaced []string
+	update := func(d *blockfmt.Descriptor) (bool, error) {
+		if d.Trailer == nil || d.Trailer.Encryption == nil {
+			return false, nil
+		}
+		// always start from the stored
+		// wrapped key, even if the data
+		// key happens to be unwrapped
+		e := new(blockfmt.Encryption)
+		*e = *d.Trailer.Encryption
+		e.DataKey = nil
+		err := e.Unwrap(old)
+		if errors.Is(err, blockfmt.ErrWrongKey) && e.Unwrap(key) == nil {
+			return false, nil // already re-keyed
+		}
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", d.Path, err)
+		}
+		if err := e.Rewrap(key); err != nil {
+			return false, err
+		}
+		t := *d.Trailer
+		t.Encryption = e
+		prev := d.Path
+		if err := st.rewriteTrailer(d, &t); err != nil {
+			return false, fmt.Errorf("%s: %w", prev, err)
+		}
+		replaced = append(replaced, prev)
+		rekeyed++
+		return true, nil
+	}
+	for i := range idx.Inline {
+		_, err := update(&idx.Inline[i])
+		if err != nil {
+			return err
+		}
+	}
+	dir := path.Join("db", db, table)
+	err = idx.UpdateIndirect(st.ofs, dir, st.conf.GCMinimumAge, update)
+	if err != nil {
+		return err
+	}
+	if rekeyed == 0 && !st.sealer.UsedFallback() {
+		return nil
+	}
+	expiry := date.Now().Add(st.conf.GCMinimumAge)
+	for i := range replaced {
+		idx.ToDelete = append(idx.ToDelete, blockfmt.Quarantined{
+			Path:   replaced[i],
+			Expiry: expiry,
+		})
+	}
+	b.logf("table %s.%s: re-keyed %d objects", db, table, rekeyed)
+	err = st.flush(idx, &cache)
+	if err != nil {
+		return err
+	}
+	return st.runGC(idx)
+}
+
+// rewriteTrailer copies the object described by d
+// to a new object in the same directory with the
+// trailer t and updates d to describe the new object
+func (st *tableState) rewriteTrailer(d *blockfmt.Descriptor, t *blockfmt.Trailer) error {
+	src, err := st.ofs.Open(d.Path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fp := path.Join(path.Dir(d.Path), "packed-"+uuid()+suffixForComp(t.Algo))
+	out, err := st.ofs.Create(fp)
+	if err != nil {
+		return err
+	}
+	err = blockfmt.CopyWithTrailer(out, src, t)
+	if err != nil {
+		abort(out)
+		return err
+	}
+	etag, lastmod, err := getInfo(st.ofs, fp, out)
+	if err != nil {
+		return err
+	}
+	st.conf.logf("table %s: rewrote %s as %s", st.table, d.Path, fp)
+	d.ObjectInfo = blockfmt.ObjectInfo{
+		Path:         fp,
+		LastModified: date.FromTime(lastmod),
+		ETag:         etag,
+		Format:       d.Format,
+		Size:         out.Size(),
+	}
+	d.Trailer = t
+	return nil
+}
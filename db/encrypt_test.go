@@ -0,0 +1,431 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package db
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SnellerInc/sneller/expr/blob"
+	"github.com/SnellerInc/sneller/ion"
+	"github.com/SnellerInc/sneller/ion/blockfmt"
+
+	"golang.org/x/exp/slices"
+)
+
+type encryptedTenant struct {
+	*testTenant
+	mkey *blockfmt.MasterKey
+}
+
+func (t *encryptedTenant) MasterKey() *blockfmt.MasterKey { return t.mkey }
+
+func randomMasterKey() *blockfmt.MasterKey {
+	ret := new(blockfmt.MasterKey)
+	rand.Read(ret[:])
+	return ret
+}
+
+// allDescs returns every descriptor in idx
+func allDescs(t *testing.T, ifs InputFS, idx *blockfmt.Index) []blockfmt.Descriptor {
+	descs, err := idx.Indirect.Search(ifs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(descs, idx.Inline...)
+}
+
+// countRows reads each of the blobs returned
+// by Blobs(ifs, idx, nil) and returns the total
+// number of rows
+func countRows(t *testing.T, ifs InputFS, idx *blockfmt.Index, lst *blob.List) int {
+	// Blobs returns the inline objects first
+	descs, err := idx.Indirect.Search(ifs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	descs = append(slices.Clone(idx.Inline), descs...)
+	if len(descs) != len(lst.Contents) {
+		t.Fatalf("%d blobs for %d objects", len(lst.Contents), len(descs))
+	}
+	rows := 0
+	for i := range lst.Contents {
+		f, err := ifs.Open(descs[i].Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc := &rowCollector{out: new(ion.Symtab)}
+		err = rc.collect(f, lst.Contents[i].(*blob.Compressed).Trailer)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows += len(rc.rows)
+	}
+	return rows
+}
+
+func TestEncryptedRekey(t *testing.T) {
+	checkFiles(t)
+	tmpdir := t.TempDir()
+	dfs := newDirFS(t, tmpdir)
+	oldkey := randomMasterKey()
+	owner := &encryptedTenant{
+		testTenant: newTenant(dfs),
+		mkey:       oldkey,
+	}
+	b := Builder{
+		Align:        1024,
+		MinMergeSize: 1,
+		// force some descriptors into
+		// the indirect tree
+		MaxInlineBytes: 1,
+		Logf:           t.Logf,
+	}
+	const files, rows = 4, 20
+	for i := 0; i < files; i++ {
+		name := fmt.Sprintf("input-%d.json", i)
+		var text []byte
+		for j := 0; j < rows; j++ {
+			text = fmt.Appendf(text, "{\"id\": %d, \"file\": %d}\n", i*rows+j, i)
+		}
+		err := os.WriteFile(filepath.Join(tmpdir, name), text, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lst, err := collectGlob(dfs, nil, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = b.append(owner, "default", "rows", lst, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// ingest enough inputs at once that
+	// the tree of inputs is written out
+	const more = 60
+	for i := 0; i < more; i++ {
+		text := fmt.Appendf(nil, "{\"id\": %d, \"file\": %d}\n", files*rows+i, files+i)
+		err := os.WriteFile(filepath.Join(tmpdir, fmt.Sprintf("more-%d.json", i)), text, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	parts, err := collectGlob(dfs, nil, "more-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.append(owner, "default", "rows", parts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const total = files*rows + more
+
+	// the index and the files it references
+	// must be sealed with the master key
+	sealed := func(key *blockfmt.MasterKey) {
+		t.Helper()
+		for _, pat := range []string{"index", "indirect-*", "inputs-*"} {
+			names, err := fs.Glob(dfs, "db/default/rows/"+pat)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(names) == 0 {
+				t.Fatalf("no files match %s", pat)
+			}
+			idx, err := OpenIndexFor(dfs, "default", "rows", owner, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			live := make(map[string]bool)
+			for i := range idx.Indirect.Refs {
+				live[idx.Indirect.Refs[i].Path] = true
+			}
+			idx.Inputs.Backing = dfs
+			idx.Inputs.EachFile(func(name string) { live[name] = true })
+			for _, name := range names {
+				if pat != "index" && !live[name] {
+					continue // garbage
+				}
+				buf, err := fs.ReadFile(dfs, name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !blockfmt.IsSealed(buf) {
+					t.Fatalf("%s is not sealed", name)
+				}
+				_, err = (&blockfmt.Sealer{Master: key}).Unseal(name, buf)
+				if err != nil {
+					t.Fatalf("%s: %s", name, err)
+				}
+			}
+		}
+	}
+	sealed(oldkey)
+	_, err = OpenIndex(dfs, "default", "rows", owner.Key())
+	if !errors.Is(err, blockfmt.ErrSealed) {
+		t.Fatalf("OpenIndex without a master key: got error %v", err)
+	}
+
+	idx, err := OpenIndexFor(dfs, "default", "rows", owner, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Indirect.Refs) == 0 {
+		t.Fatal("expected indirect refs")
+	}
+	descs := allDescs(t, dfs, idx)
+	if len(descs) != files+1 {
+		t.Fatalf("got %d objects; expected %d", len(descs), files+1)
+	}
+	for i := range descs {
+		e := descs[i].Trailer.Encryption
+		if e == nil {
+			t.Fatalf("%s is not encrypted", descs[i].Path)
+		}
+		if e.DataKey != nil {
+			t.Fatalf("%s: data key was stored in the index", descs[i].Path)
+		}
+	}
+
+	check := func(idx *blockfmt.Index) {
+		t.Helper()
+		lst, err := Blobs(dfs, idx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = UnwrapKeys(owner, lst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := countRows(t, dfs, idx, lst); n != total {
+			t.Fatalf("got %d rows; expected %d", n, total)
+		}
+		idx.Inputs.Backing = dfs
+		inputs := 0
+		err = idx.Inputs.Walk("", func(string, string, int) bool {
+			inputs++
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inputs != files+more {
+			t.Fatalf("got %d inputs; expected %d", inputs, files+more)
+		}
+		for i := range idx.Inline {
+			if idx.Inline[i].Trailer.Encryption.DataKey != nil {
+				t.Fatal("UnwrapKeys modified the index")
+			}
+		}
+	}
+	check(idx)
+
+	// the trailer stored in each object must
+	// hold the data key wrapped with key
+	objects := func(idx *blockfmt.Index, key *blockfmt.MasterKey) {
+		t.Helper()
+		descs := allDescs(t, dfs, idx)
+		for i := range descs {
+			f, err := dfs.Open(descs[i].Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			trailer, err := blockfmt.ReadTrailer(f.(io.ReaderAt), descs[i].Size)
+			f.Close()
+			if err != nil {
+				t.Fatalf("%s: %s", descs[i].Path, err)
+			}
+			if trailer.Offset != descs[i].Trailer.Offset || len(trailer.Blocks) != len(descs[i].Trailer.Blocks) {
+				t.Fatalf("%s: trailer does not match the index", descs[i].Path)
+			}
+			if trailer.Encryption == nil {
+				t.Fatalf("%s: trailer is not encrypted", descs[i].Path)
+			}
+			if err := trailer.Encryption.Unwrap(key); err != nil {
+				t.Fatalf("%s: %s", descs[i].Path, err)
+			}
+		}
+	}
+	objects(idx, oldkey)
+
+	// rotate the master key
+	newkey := randomMasterKey()
+	owner.mkey = newkey
+	_, err = OpenIndexFor(dfs, "default", "rows", owner, 0)
+	if !errors.Is(err, blockfmt.ErrWrongKey) {
+		t.Fatalf("OpenIndexFor with a new master key: got error %v", err)
+	}
+	lst, err := Blobs(dfs, idx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = UnwrapKeys(owner, lst)
+	if !errors.Is(err, blockfmt.ErrWrongKey) {
+		t.Fatalf("UnwrapKeys with a new master key: got error %v", err)
+	}
+	err = b.Rekey(owner, "default", "*", randomMasterKey())
+	if !errors.Is(err, blockfmt.ErrWrongKey) {
+		t.Fatalf("Rekey with the wrong old key: got error %v", err)
+	}
+	err = b.Rekey(owner, "default", "*", oldkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed(newkey)
+	idx, err = OpenIndexFor(dfs, "default", "rows", owner, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(idx)
+	if len(idx.ToDelete) == 0 {
+		t.Error("expected the old indirect refs to be quarantined")
+	}
+	objects(idx, newkey)
+	quarantined := make(map[string]bool)
+	for i := range idx.ToDelete {
+		quarantined[idx.ToDelete[i].Path] = true
+	}
+	for i := range descs {
+		if !quarantined[descs[i].Path] {
+			t.Errorf("expected %s to be quarantined", descs[i].Path)
+		}
+	}
+	// re-keying again is a no-op
+	err = b.Rekey(owner, "default", "*", oldkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// compaction must read the re-keyed
+	// objects and write new encrypted ones
+	err = b.Compact(owner, "default", "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err = OpenIndexFor(dfs, "default", "rows", owner, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(idx)
+
+	// a tenant without a master key
+	// cannot read the table
+	lst, err = Blobs(dfs, idx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = UnwrapKeys(owner.testTenant, lst)
+	if !errors.Is(err, ErrNoMasterKey) {
+		t.Fatalf("UnwrapKeys without a master key: got error %v", err)
+	}
+}
+
+func TestEncryptedRejects(t *testing.T) {
+	checkFiles(t)
+	tmpdir := t.TempDir()
+	dfs := newDirFS(t, tmpdir)
+	key := randomMasterKey()
+	owner := &encryptedTenant{
+		testTenant: newTenant(dfs),
+		mkey:       key,
+	}
+	err := WriteDefinition(dfs, "default", &Definition{
+		Name: "rows",
+		Schema: &Schema{
+			Fields: []SchemaField{{Path: "id", Type: "int", Required: true}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var text []byte
+	const rows = 20
+	for i := 0; i < rows; i++ {
+		if i%2 == 0 {
+			text = fmt.Appendf(text, "{\"id\": %d}\n", i)
+		} else {
+			text = fmt.Appendf(text, "{\"id\": \"not-a-number\", \"secret\": %d}\n", i)
+		}
+	}
+	err = os.WriteFile(filepath.Join(tmpdir, "input.json"), text, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lst, err := collectGlob(dfs, nil, "input.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := Builder{Align: 1024, Logf: t.Logf}
+	err = b.append(owner, "default", "rows", lst, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no plaintext rejects may be written
+	plain, err := fs.Glob(dfs, RejectsPath("default", "rows")+"/rejects-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plain) != 0 {
+		t.Fatalf("plaintext rejects written for an encrypted tenant: %v", plain)
+	}
+	enc, err := fs.Glob(dfs, RejectsPath("default", "rows")+"/rejects-*.ion.zst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(enc) != 1 {
+		t.Fatalf("expected 1 encrypted rejects object; found %v", enc)
+	}
+	f, err := dfs.Open(enc[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	trailer, err := blockfmt.ReadTrailer(f.(io.ReaderAt), info.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trailer.Encryption == nil {
+		t.Fatal("rejects object is not encrypted")
+	}
+	if err := trailer.Encryption.Unwrap(key); err != nil {
+		t.Fatal(err)
+	}
+	rc := &rowCollector{out: new(ion.Symtab), keys: [][]string{{"reason"}}}
+	err = rc.collect(io.NewSectionReader(f.(io.ReaderAt), 0, info.Size()), trailer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.rows) != rows/2 {
+		t.Fatalf("got %d rejected rows; expected %d", len(rc.rows), rows/2)
+	}
+	for i := range rc.rows {
+		if len(rc.rows[i].key[0]) == 0 {
+			t.Errorf("rejected row %d has no reason", i)
+		}
+	}
+}
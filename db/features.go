@@ -24,6 +24,8 @@ func (b *Builder) SetFeatures(lst []string) {
 		switch x {
 		case "legacy-zstd":
 			b.Algo = "zstd"
+		case "infer-shape":
+			b.InferShape = true
 		}
 	}
 }
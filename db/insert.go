@@ -0,0 +1,257 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/SnellerInc/sneller/date"
+	"github.com/SnellerInc/sneller/ion/blockfmt"
+)
+
+// ErrTableExists is returned by Builder.Create
+// when the table to be created already exists.
+var ErrTableExists = errors.New("table already exists")
+
+// Insert appends a list of packed objects
+// that have already been written into the
+// directory of db/table to the index of
+// an existing table.
+//
+// Like Builder.Sync, Insert only updates the
+// index if it has not been modified since it was
+// read, and it returns ErrBuildAgain if the
+// index is currently being scanned.
+func (b *Builder) Insert(who Tenant, db, table string, lst []blockfmt.Descriptor) error {
+	st, err := b.open(db, table, who)
+	if err != nil {
+		return err
+	}
+	var cache IndexCache
+	idx, err := st.index(&cache)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("table %s.%s does not exist: %w", db, table, err)
+		}
+		return err
+	}
+	st.preciseGC(idx)
+	idx.Inputs.Backing = st.ofs
+	if idx.Scanning {
+		return ErrBuildAgain
+	}
+	// statistics are only maintained for indexes
+	// that have had them from the beginning, and
+	// we have no statistics for the new objects
+	idx.Stats = nil
+	idx.Algo = "zstd"
+	idx.Created = date.Now().Truncate(time.Microsecond)
+	idx.Inline = append(idx.Inline, lst...)
+	err = st.flush(idx, &cache)
+	if err != nil {
+		return err
+	}
+	return st.runGC(idx)
+}
+
+// InsertRows packs the rows read from r in the
+// given format into a new object in the directory
+// of db/table and appends the object to the index
+// of the table, creating the table if it does not
+// exist. Like Insert, InsertRows returns
+// ErrBuildAgain if the index is currently
+// being scanned.
+func (b *Builder) InsertRows(who Tenant, db, table string, r io.Reader, f blockfmt.RowFormat) error {
+	st, err := b.open(db, table, who)
+	if err != nil {
+		return err
+	}
+	c := blockfmt.Converter{
+		Inputs: []blockfmt.Input{{
+			R: io.NopCloser(r),
+			F: f,
+		}},
+		Align:     st.conf.align(),
+		FlushMeta: st.conf.flushMeta(),
+		Comp:      st.conf.comp(),
+	}
+	lst := make([]blockfmt.Descriptor, 1)
+	err = st.writeObject(&c, "", &lst[0])
+	if err != nil {
+		return err
+	}
+	err = b.Insert(who, db, table, lst)
+	if errors.Is(err, fs.ErrNotExist) {
+		err = b.Create(who, db, table, lst, false)
+		if errors.Is(err, ErrTableExists) {
+			// lost a race with another writer
+			err = b.Insert(who, db, table, lst)
+		}
+	}
+	return err
+}
+
+// Create writes the index of a new table containing
+// a list of packed objects that have already been
+// written into the directory of db/table.
+//
+// If the table already exists, then Create returns
+// ErrTableExists unless replace is set, in which case
+// the objects of the existing table are quarantined
+// for deletion (see blockfmt.Index.ToDelete) and the
+// index is replaced with one that references only lst.
+// Tables that are ingested from a Definition cannot
+// be replaced, since their inputs would be ingested
+// again on the next Sync.
+//
+// The index is only written if the table has not
+// been created or modified since it was read, so the
+// table either contains all of the objects in lst
+// or none of them.
+func (b *Builder) Create(who Tenant, db, table string, lst []blockfmt.Descriptor, replace bool) error {
+	st, err := b.open(db, table, who)
+	if err != nil {
+		return err
+	}
+	var cache IndexCache
+	old, err := st.index(&cache)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if old != nil && !replace {
+		return fmt.Errorf("%s.%s: %w", db, table, ErrTableExists)
+	}
+	idx := &blockfmt.Index{
+		Name:    table,
+		Algo:    "zstd",
+		Created: date.Now().Truncate(time.Microsecond),
+		Inline:  lst,
+	}
+	if old != nil {
+		ifs, err := who.Root()
+		if err != nil {
+			return err
+		}
+		if _, err := OpenDefinition(ifs, db, table); err == nil {
+			return fmt.Errorf("cannot replace %s.%s: table has a definition", db, table)
+		}
+		if old.Scanning {
+			return ErrBuildAgain
+		}
+		err = st.quarantine(old, idx)
+		if err != nil {
+			return err
+		}
+	}
+	err = st.flush(idx, &cache)
+	if err != nil {
+		return err
+	}
+	return st.runGC(idx)
+}
+
+// Expire removes the packed objects in which every
+// value of the timestamp field (a path using '.' to
+// separate path components) is before the given time
+// from the index of db/table, and returns the number
+// of objects that were removed. The removed objects
+// are quarantined for deletion (see blockfmt.Index.ToDelete).
+//
+// Objects without a time range for the field are kept,
+// as are the objects referenced by blockfmt.Index.Indirect,
+// which is only populated for tables that are too large
+// to be expired cheaply this way.
+//
+// Like Insert, Expire returns ErrBuildAgain
+// if the index is currently being scanned.
+func (b *Builder) Expire(who Tenant, db, table, field string, before date.Time) (int, error) {
+	st, err := b.open(db, table, who)
+	if err != nil {
+		return 0, err
+	}
+	var cache IndexCache
+	idx, err := st.index(&cache)
+	if err != nil {
+		return 0, err
+	}
+	st.preciseGC(idx)
+	idx.Inputs.Backing = st.ofs
+	if idx.Scanning {
+		return 0, ErrBuildAgain
+	}
+	path := strings.Split(field, ".")
+	expiry := date.Now().Add(st.conf.GCMinimumAge)
+	kept := idx.Inline[:0]
+	removed := 0
+	for i := range idx.Inline {
+		d := &idx.Inline[i]
+		if ti := d.Trailer.Sparse.Get(path); ti != nil {
+			if max, ok := ti.Max(); ok && max.Before(before) {
+				idx.ToDelete = append(idx.ToDelete, blockfmt.Quarantined{
+					Path:   d.Path,
+					Expiry: expiry,
+				})
+				removed++
+				continue
+			}
+		}
+		kept = append(kept, *d)
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	b.logf("table %s.%s: expiring %d objects before %s", db, table, removed, before)
+	idx.Inline = kept
+	idx.Stats = nil
+	idx.Created = date.Now().Truncate(time.Microsecond)
+	err = st.flush(idx, &cache)
+	if err != nil {
+		return 0, err
+	}
+	return removed, st.runGC(idx)
+}
+
+// quarantine adds every object referenced
+// by old to the list of objects in idx that
+// should be deleted once they expire
+func (st *tableState) quarantine(old, idx *blockfmt.Index) error {
+	descs, err := old.Indirect.Search(st.ofs, nil)
+	if err != nil {
+		return err
+	}
+	expiry := date.Now().Add(st.conf.GCMinimumAge)
+	add := func(p string) {
+		idx.ToDelete = append(idx.ToDelete, blockfmt.Quarantined{
+			Path:   p,
+			Expiry: expiry,
+		})
+	}
+	idx.ToDelete = append(idx.ToDelete, old.ToDelete...)
+	for i := range descs {
+		add(descs[i].Path)
+	}
+	for i := range old.Indirect.Refs {
+		add(old.Indirect.Refs[i].Path)
+	}
+	for i := range old.Inline {
+		add(old.Inline[i].Path)
+	}
+	return nil
+}
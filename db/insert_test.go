@@ -0,0 +1,84 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SnellerInc/sneller/date"
+	"github.com/SnellerInc/sneller/ion/blockfmt"
+)
+
+func TestExpire(t *testing.T) {
+	dfs := newDirFS(t, t.TempDir())
+	owner := newTenant(dfs)
+	b := Builder{Align: 1024, Logf: t.Logf}
+	batches := []string{
+		`{"start": "2022-01-01T00:00:00Z", "n": 1} {"start": "2022-01-31T00:00:00Z", "n": 2}`,
+		`{"start": "2022-02-01T00:00:00Z", "n": 3} {"start": "2022-03-01T00:00:00Z", "n": 4}`,
+		`{"start": "2022-03-02T00:00:00Z", "n": 5}`,
+		`{"n": 6}`,
+	}
+	for i := range batches {
+		err := b.InsertRows(owner, "default", "audit", strings.NewReader(batches[i]), blockfmt.MustSuffixToFormat(".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	cutoff := date.Date(2022, 2, 15, 0, 0, 0, 0)
+	n, err := b.Expire(owner, "default", "audit", "start", cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expired %d objects", n)
+	}
+	idx, err := OpenIndex(dfs, "default", "audit", owner.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Inline) != 3 {
+		t.Fatalf("%d objects left", len(idx.Inline))
+	}
+	if len(idx.ToDelete) != 1 {
+		t.Fatalf("%d objects to delete", len(idx.ToDelete))
+	}
+	lst, err := Blobs(dfs, idx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows := countRows(t, dfs, idx, lst); rows != 4 {
+		t.Fatalf("%d rows left", rows)
+	}
+
+	// nothing else is old enough
+	n, err = b.Expire(owner, "default", "audit", "start", cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("expired %d more objects", n)
+	}
+	// the object without a start time is kept
+	n, err = b.Expire(owner, "default", "audit", "start", date.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expired %d objects", n)
+	}
+}
@@ -280,7 +280,7 @@ outer:
 				}
 				return err
 			}
-			fm, err := bld.Format(def.Inputs[j].Format, p, def.Inputs[j].Hints)
+			fm, err := bld.inputFormat(&def.Inputs[j], p)
 			if err != nil {
 				return err
 			}
@@ -112,7 +112,6 @@ func (st *tableState) scan(idx *blockfmt.Index, flushOnComplete bool) (int, erro
 			// invalid definition?
 			return 0, err
 		}
-		format := st.def.Inputs[i].Format
 		seek := idx.Cursors[i]
 		prefix := infs.Prefix()
 		walk := func(p string, f fs.File, err error) error {
@@ -162,7 +161,7 @@ func (st *tableState) scan(idx *blockfmt.Index, flushOnComplete bool) (int, erro
 				seek = p
 				return nil
 			}
-			fm, err := st.conf.Format(format, p, st.def.Inputs[i].Hints)
+			fm, err := st.conf.inputFormat(&st.def.Inputs[i], p)
 			if err != nil {
 				return err
 			}
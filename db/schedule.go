@@ -0,0 +1,323 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/bits"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScheduleHistoryTable is the table in each
+// database in which the runs of the scheduled
+// queries of the database are recorded.
+const ScheduleHistoryTable = "schedule_history"
+
+// ScheduledQuery is a named query
+// that is run periodically.
+type ScheduledQuery struct {
+	// Name is the name of the scheduled query.
+	// Name should match the location of the
+	// ScheduledQuery within the db filesystem hierarchy.
+	Name string `json:"name"`
+	// Schedule is a cron expression that
+	// determines when the query is run.
+	// See ParseCron.
+	Schedule string `json:"schedule"`
+	// Query is the text of the query.
+	Query string `json:"query"`
+	// Table, if non-empty, is the table in the
+	// same database to which the results of
+	// each run are appended.
+	Table string `json:"table,omitempty"`
+	// Webhook, if non-empty, is the URL to which
+	// the results of each run are POSTed as NDJSON.
+	Webhook string `json:"webhook,omitempty"`
+}
+
+// SchedulePath returns the path at which
+// the scheduled query with the given name
+// in db would live relative to the root of the FS.
+func SchedulePath(db, name string) string {
+	return path.Join("schedules", db, name+".json")
+}
+
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') &&
+			!(c >= '0' && c <= '9') && c != '_' && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate checks that s is well-formed.
+// (The query itself is only checked
+// when it is run.)
+func (s *ScheduledQuery) Validate() error {
+	if !validName(s.Name) {
+		return fmt.Errorf("invalid scheduled query name %q", s.Name)
+	}
+	if _, err := ParseCron(s.Schedule); err != nil {
+		return err
+	}
+	if strings.TrimSpace(s.Query) == "" {
+		return fmt.Errorf("scheduled query %s: no query", s.Name)
+	}
+	if s.Table != "" && s.Webhook != "" {
+		return fmt.Errorf("scheduled query %s: cannot deliver results to both a table and a webhook", s.Name)
+	}
+	if s.Table == ScheduleHistoryTable {
+		return fmt.Errorf("scheduled query %s: cannot write to %s", s.Name, ScheduleHistoryTable)
+	}
+	return nil
+}
+
+// OpenSchedule opens the scheduled
+// query with the given name in db.
+func OpenSchedule(s fs.FS, db, name string) (*ScheduledQuery, error) {
+	f, err := s.Open(SchedulePath(db, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := checkDef(f); err != nil {
+		return nil, err
+	}
+	q := new(ScheduledQuery)
+	err = json.NewDecoder(f).Decode(q)
+	if err != nil {
+		return nil, err
+	}
+	if q.Name != name {
+		return nil, fmt.Errorf("scheduled query name %q doesn't match %q", q.Name, name)
+	}
+	return q, q.Validate()
+}
+
+// WriteSchedule writes a scheduled query to
+// the given database, replacing any existing
+// scheduled query with the same name.
+func WriteSchedule(dst OutputFS, db string, s *ScheduledQuery) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	buf, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = dst.WriteFile(SchedulePath(db, s.Name), buf)
+	return err
+}
+
+// Schedules returns the scheduled queries in db.
+func Schedules(s fs.FS, db string) ([]*ScheduledQuery, error) {
+	names, err := fs.Glob(s, SchedulePath(db, "*"))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*ScheduledQuery, 0, len(names))
+	for i := range names {
+		name := strings.TrimSuffix(path.Base(names[i]), ".json")
+		q, err := OpenSchedule(s, db, name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue // removed concurrently
+			}
+			return nil, fmt.Errorf("%s: %w", names[i], err)
+		}
+		out = append(out, q)
+	}
+	return out, nil
+}
+
+// Cron is a parsed cron expression.
+// All times are interpreted in UTC.
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	// if either the day of the month or the
+	// day of the week is '*', both must match;
+	// otherwise a day matches if either matches
+	domStar, dowStar bool
+}
+
+type cronField struct {
+	min, max int
+	names    []string
+}
+
+var cronFields = [5]cronField{
+	{min: 0, max: 59},
+	{min: 0, max: 23},
+	{min: 1, max: 31},
+	{min: 1, max: 12, names: []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}},
+	// 7 is also Sunday
+	{min: 0, max: 7, names: []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}},
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses a cron expression with the
+// five fields "minute hour day-of-month month day-of-week".
+// Each field is '*' or a comma-separated list of
+// values or ranges (a-b), each optionally followed by
+// a step (/n). Months and days of the week may
+// also be given by their three-letter English names.
+// The macros @yearly, @monthly, @weekly, @daily
+// and @hourly are accepted as well.
+func ParseCron(expr string) (*Cron, error) {
+	expr = strings.TrimSpace(expr)
+	if m, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = m
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression %q: expected %d fields", expr, len(cronFields))
+	}
+	var c Cron
+	dst := [5]*uint64{&c.minute, &c.hour, &c.dom, &c.month, &c.dow}
+	for i := range parts {
+		set, err := cronFields[i].parse(parts[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %w", expr, err)
+		}
+		*dst[i] = set
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domStar = strings.HasPrefix(parts[2], "*")
+	c.dowStar = strings.HasPrefix(parts[4], "*")
+	return &c, nil
+}
+
+func (f *cronField) value(s string) (int, error) {
+	for i := range f.names {
+		if strings.EqualFold(s, f.names[i]) {
+			return f.min + i, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if n < f.min || n > f.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", n, f.min, f.max)
+	}
+	return n, nil
+}
+
+func (f *cronField) parse(s string) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(s, ",") {
+		rng, stepstr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepstr)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepstr)
+			}
+		}
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			first, last, isRange := strings.Cut(rng, "-")
+			var err error
+			lo, err = f.value(first)
+			if err != nil {
+				return 0, err
+			}
+			switch {
+			case isRange:
+				hi, err = f.value(last)
+				if err != nil {
+					return 0, err
+				}
+				if hi < lo {
+					return 0, fmt.Errorf("invalid range %q", rng)
+				}
+			case !hasStep:
+				hi = lo
+			}
+		}
+		for i := lo; i <= hi; i += step {
+			set |= 1 << i
+		}
+	}
+	return set, nil
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<int(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first time after t that
+// matches c, or the zero time if no time within
+// the next five years matches c.
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		if c.month&(1<<int(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if c.hour&(1<<t.Hour()) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if c.minute&(1<<t.Minute()) == 0 {
+			// skip directly to the next matching minute
+			// in this hour, if there is one
+			rest := c.minute >> t.Minute()
+			if rest == 0 {
+				t = t.Truncate(time.Hour).Add(time.Hour)
+			} else {
+				t = t.Add(time.Duration(bits.TrailingZeros64(rest)) * time.Minute)
+			}
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,158 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SnellerInc/sneller/ion/blockfmt"
+)
+
+func TestCron(t *testing.T) {
+	at := func(s string) time.Time {
+		t.Helper()
+		tm, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	testcases := []struct {
+		expr, from, want string
+	}{
+		{"* * * * *", "2022-03-04T05:06:07Z", "2022-03-04T05:07:00Z"},
+		{"*/15 * * * *", "2022-03-04T05:06:07Z", "2022-03-04T05:15:00Z"},
+		{"*/15 * * * *", "2022-03-04T05:45:00Z", "2022-03-04T06:00:00Z"},
+		{"30 2 * * *", "2022-03-04T05:06:07Z", "2022-03-05T02:30:00Z"},
+		{"@hourly", "2022-03-04T05:06:07Z", "2022-03-04T06:00:00Z"},
+		{"@daily", "2022-12-31T23:59:00Z", "2023-01-01T00:00:00Z"},
+		{"@monthly", "2022-03-04T05:06:07Z", "2022-04-01T00:00:00Z"},
+		// 2022-03-04 is a Friday
+		{"0 9 * * MON-FRI", "2022-03-04T10:00:00Z", "2022-03-07T09:00:00Z"},
+		{"0 0 * * 7", "2022-03-04T10:00:00Z", "2022-03-06T00:00:00Z"},
+		// day of month OR day of week
+		{"0 0 10 * SUN", "2022-03-04T10:00:00Z", "2022-03-06T00:00:00Z"},
+		{"0 0 5 * SUN", "2022-03-04T10:00:00Z", "2022-03-05T00:00:00Z"},
+		{"0 0 29 FEB *", "2022-03-04T10:00:00Z", "2024-02-29T00:00:00Z"},
+		{"5,10-12/2 0 1 1,jul *", "2022-03-04T10:00:00Z", "2022-07-01T00:05:00Z"},
+		{"0 0 30 2 *", "2022-03-04T10:00:00Z", "0001-01-01T00:00:00Z"},
+	}
+	for _, tc := range testcases {
+		c, err := ParseCron(tc.expr)
+		if err != nil {
+			t.Errorf("%s: %s", tc.expr, err)
+			continue
+		}
+		got := c.Next(at(tc.from))
+		if !got.Equal(at(tc.want)) {
+			t.Errorf("%s: Next(%s) = %s, want %s", tc.expr, tc.from, got.Format(time.RFC3339), tc.want)
+		}
+	}
+	for _, bad := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"x * * * *",
+		"@never",
+	} {
+		if _, err := ParseCron(bad); err == nil {
+			t.Errorf("expected an error parsing %q", bad)
+		}
+	}
+}
+
+func TestSchedules(t *testing.T) {
+	dfs := NewDirFS(t.TempDir())
+	defer dfs.Close()
+	queries := []*ScheduledQuery{{
+		Name:     "daily-counts",
+		Schedule: "@daily",
+		Query:    "SELECT COUNT(*) FROM t",
+		Table:    "counts",
+	}, {
+		Name:     "errors",
+		Schedule: "*/5 * * * *",
+		Query:    "SELECT * FROM t WHERE level = 'error'",
+		Webhook:  "https://example.com/hook",
+	}}
+	for _, q := range queries {
+		if err := WriteSchedule(dfs, "default", q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bad := []*ScheduledQuery{
+		{Name: "../x", Schedule: "@daily", Query: "SELECT 1"},
+		{Name: "x", Schedule: "@sometimes", Query: "SELECT 1"},
+		{Name: "x", Schedule: "@daily"},
+		{Name: "x", Schedule: "@daily", Query: "SELECT 1", Table: "t", Webhook: "http://localhost"},
+		{Name: "x", Schedule: "@daily", Query: "SELECT 1", Table: ScheduleHistoryTable},
+	}
+	for _, q := range bad {
+		if err := WriteSchedule(dfs, "default", q); err == nil {
+			t.Errorf("expected an error writing %+v", q)
+		}
+	}
+	lst, err := Schedules(dfs, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lst) != len(queries) {
+		t.Fatalf("got %d scheduled queries", len(lst))
+	}
+	for i := range lst {
+		if *lst[i] != *queries[i] {
+			t.Errorf("got %+v, want %+v", lst[i], queries[i])
+		}
+	}
+	lst, err = Schedules(dfs, "other")
+	if err != nil || len(lst) != 0 {
+		t.Fatalf("other database: %v, %v", lst, err)
+	}
+}
+
+func TestInsertRows(t *testing.T) {
+	dfs := newDirFS(t, t.TempDir())
+	owner := newTenant(dfs)
+	b := Builder{Align: 1024, Logf: t.Logf}
+	for i := 0; i < 2; i++ {
+		rows := `{"run": 1, "ok": true} {"run": 2, "ok": false}`
+		err := b.InsertRows(owner, "default", "history", strings.NewReader(rows), blockfmt.MustSuffixToFormat(".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	idx, err := OpenIndex(dfs, "default", "history", owner.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Inline) != 2 {
+		t.Fatalf("got %d objects", len(idx.Inline))
+	}
+	lst, err := Blobs(dfs, idx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, dfs, idx, lst); n != 4 {
+		t.Fatalf("got %d rows", n)
+	}
+}
@@ -0,0 +1,682 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/SnellerInc/sneller/date"
+	"github.com/SnellerInc/sneller/expr"
+	"github.com/SnellerInc/sneller/ion"
+	"github.com/SnellerInc/sneller/ion/blockfmt"
+)
+
+// Schema is a declared table schema.
+//
+// When a Definition includes a Schema,
+// each row is checked against the schema
+// as it is ingested. Values that do not have
+// the declared type are coerced to that type
+// when possible (for example, the string "123"
+// is coerced to an int field as 123), and rows
+// that cannot be made to conform to the schema
+// are written to a rejects object instead of
+// the table. (See RejectsPath.)
+//
+// The query planner trusts the declared
+// schema when type-checking queries.
+type Schema struct {
+	// Fields is the list of declared fields.
+	Fields []SchemaField `json:"fields"`
+	// Strict indicates that rows may only
+	// contain the fields declared in Fields
+	// (plus any partition fields). Rows with
+	// undeclared fields are rejected, and
+	// queries that reference undeclared
+	// fields fail to plan.
+	//
+	// Only the top level of each row and the
+	// contents of structures that have declared
+	// sub-fields are restricted.
+	Strict bool `json:"strict,omitempty"`
+}
+
+// SchemaField is a single field in a Schema.
+type SchemaField struct {
+	// Path is the path to the field,
+	// using '.' to separate path components.
+	Path string `json:"path"`
+	// Type is one of "bool", "int", "float",
+	// "string", "timestamp", "struct", "list",
+	// "blob", or "any".
+	Type string `json:"type"`
+	// Nullable indicates that the field
+	// may be NULL.
+	Nullable bool `json:"nullable,omitempty"`
+	// Required indicates that the field
+	// must be present in every row.
+	// A field that is not required may be
+	// absent from a row. Sub-fields of a
+	// structure are only required when
+	// the structure is present.
+	Required bool `json:"required,omitempty"`
+}
+
+var schemaTypes = map[string]expr.TypeSet{
+	"bool":      expr.BoolType,
+	"int":       expr.IntegerType,
+	"float":     expr.FloatType,
+	"string":    expr.StringType,
+	"timestamp": expr.TimeType,
+	"struct":    expr.TypeSet(1 << ion.StructType),
+	"list":      expr.TypeSet(1 << ion.ListType),
+	"blob":      expr.TypeSet(1 << ion.BlobType),
+	"any":       expr.AnyType,
+}
+
+// schemaNode is one node in the compiled
+// representation of a Schema
+type schemaNode struct {
+	field  *SchemaField // nil for the root and implicit structs
+	strict bool
+	sub    map[string]*schemaNode
+	order  []string // declaration order of sub
+}
+
+func (n *schemaNode) child(name string) *schemaNode {
+	c := n.sub[name]
+	if c == nil {
+		if n.sub == nil {
+			n.sub = make(map[string]*schemaNode)
+		}
+		c = &schemaNode{strict: n.strict}
+		n.sub[name] = c
+		n.order = append(n.order, name)
+	}
+	return c
+}
+
+func (n *schemaNode) typ() string {
+	if n.field == nil {
+		return "struct"
+	}
+	return n.field.Type
+}
+
+// compile validates s and produces
+// the tree representation of s; the
+// list of partitions is used to determine
+// which top-level fields are implicitly declared
+func (s *Schema) compile(parts []Partition) (*schemaNode, error) {
+	root := &schemaNode{strict: s.Strict}
+	for i := range s.Fields {
+		f := &s.Fields[i]
+		if _, ok := schemaTypes[f.Type]; !ok {
+			return nil, fmt.Errorf("schema field %q: unknown type %q", f.Path, f.Type)
+		}
+		if f.Path == "" {
+			return nil, fmt.Errorf("schema field with empty path")
+		}
+		n := root
+		for _, name := range strings.Split(f.Path, ".") {
+			if name == "" {
+				return nil, fmt.Errorf("schema field %q: invalid path", f.Path)
+			}
+			if t := n.typ(); t != "struct" {
+				return nil, fmt.Errorf("schema field %q: parent has type %q", f.Path, t)
+			}
+			n = n.child(name)
+		}
+		if n.field != nil {
+			return nil, fmt.Errorf("schema field %q declared more than once", f.Path)
+		}
+		if len(n.sub) > 0 && f.Type != "struct" {
+			return nil, fmt.Errorf("schema field %q has sub-fields but type %q", f.Path, f.Type)
+		}
+		n.field = f
+	}
+	for i := range parts {
+		if root.sub[parts[i].Field] == nil {
+			root.child(parts[i].Field).field = &SchemaField{
+				Path: parts[i].Field,
+				Type: "any",
+			}
+		}
+	}
+	return root, nil
+}
+
+// Validate checks that s is a valid schema.
+func (s *Schema) Validate() error {
+	_, err := s.compile(nil)
+	return err
+}
+
+// Hint returns an expr.Hint that describes
+// the types of the fields in s. The fields
+// of the given partitions are declared
+// implicitly, as they are during ingest.
+func (s *Schema) Hint(parts []Partition) (expr.Hint, error) {
+	root, err := s.compile(parts)
+	if err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// TypeOf implements expr.Hint.TypeOf
+func (n *schemaNode) TypeOf(e expr.Node) expr.TypeSet {
+	p, ok := e.(*expr.Path)
+	if !ok {
+		return expr.NoHint(e)
+	}
+	cur := n.lookup(p.First)
+	for rest := p.Rest; rest != nil && cur != nil; {
+		d, ok := rest.(*expr.Dot)
+		if !ok {
+			// list indexing, etc.
+			if cur.typ() != "list" && cur.typ() != "any" {
+				return expr.MissingType
+			}
+			return expr.AnyType
+		}
+		if cur.typ() != "struct" {
+			if cur.typ() == "any" {
+				return expr.AnyType
+			}
+			return expr.MissingType
+		}
+		parent := cur
+		cur = cur.lookup(d.Field)
+		if cur == nil && !parent.restricts() {
+			return expr.AnyType
+		}
+		rest = d.Rest
+	}
+	if cur == nil {
+		if n.restricts() {
+			return expr.MissingType
+		}
+		return expr.AnyType
+	}
+	if cur.field == nil {
+		// implicit structure created by
+		// a declaration of a nested path
+		return expr.TypeSet(1<<ion.StructType) | expr.MissingType
+	}
+	t := schemaTypes[cur.field.Type]
+	if t == expr.AnyType {
+		return t
+	}
+	if cur.field.Nullable {
+		t |= expr.NullType
+	}
+	if !cur.field.Required {
+		t |= expr.MissingType
+	}
+	return t
+}
+
+func (n *schemaNode) lookup(name string) *schemaNode {
+	return n.sub[name]
+}
+
+// restricts returns whether n only
+// permits the declared sub-fields
+func (n *schemaNode) restricts() bool {
+	return n.strict && len(n.sub) > 0
+}
+
+// conform checks d against the schema rooted at n,
+// returning the (possibly coerced) row or an error
+// describing why the row was rejected
+func (n *schemaNode) conform(d ion.Datum, st *ion.Symtab, where string) (ion.Datum, error) {
+	s, ok := d.Struct()
+	if !ok {
+		return d, fmt.Errorf("%s: expected a struct; found %s", describePath(where), d.Type())
+	}
+	fields := s.Fields(nil)
+	seen := 0
+	changed := false
+	out := fields[:0]
+	for i := range fields {
+		f := fields[i]
+		c := n.lookup(f.Label)
+		if c == nil {
+			if n.restricts() {
+				return d, fmt.Errorf("%s: field not declared in schema", joinPath(where, f.Label))
+			}
+			out = append(out, f)
+			continue
+		}
+		seen++
+		v, err := c.conformValue(f.Value, st, joinPath(where, f.Label))
+		if err != nil {
+			return d, err
+		}
+		if v.Type() != f.Value.Type() || !v.Equal(f.Value) {
+			changed = true
+		}
+		f.Value = v
+		out = append(out, f)
+	}
+	if seen < len(n.sub) {
+		for _, name := range n.order {
+			c := n.sub[name]
+			if c.field != nil && c.field.Required && !has(s, name) {
+				return d, fmt.Errorf("%s: required field is missing", joinPath(where, name))
+			}
+		}
+	}
+	if !changed {
+		return d, nil
+	}
+	return ion.NewStruct(st, out).Datum(), nil
+}
+
+func (n *schemaNode) conformValue(v ion.Datum, st *ion.Symtab, where string) (ion.Datum, error) {
+	if v.Null() {
+		if n.field != nil && !n.field.Nullable && n.field.Type != "any" {
+			return v, fmt.Errorf("%s: null not allowed", where)
+		}
+		return v, nil
+	}
+	typ := n.typ()
+	if typ == "struct" {
+		if v.Type() != ion.StructType {
+			return v, fmt.Errorf("%s: expected a struct; found %s", where, v.Type())
+		}
+		if len(n.sub) == 0 {
+			return v, nil
+		}
+		return n.conform(v, st, where)
+	}
+	ret, ok := coerce(v, typ)
+	if !ok {
+		return v, fmt.Errorf("%s: cannot use %s value as %s", where, v.Type(), typ)
+	}
+	return ret, nil
+}
+
+func has(s ion.Struct, name string) bool {
+	_, ok := s.FieldByName(name)
+	return ok
+}
+
+func joinPath(where, name string) string {
+	if where == "" {
+		return name
+	}
+	return where + "." + name
+}
+
+func describePath(where string) string {
+	if where == "" {
+		return "row"
+	}
+	return where
+}
+
+// coerce attempts to convert v to the schema type typ
+func coerce(v ion.Datum, typ string) (ion.Datum, bool) {
+	switch typ {
+	case "any":
+		return v, true
+	case "bool":
+		switch v.Type() {
+		case ion.BoolType:
+			return v, true
+		case ion.StringType, ion.SymbolType:
+			s, _ := v.String()
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return v, false
+			}
+			return ion.Bool(b), true
+		}
+	case "int":
+		switch v.Type() {
+		case ion.IntType, ion.UintType:
+			return v, true
+		case ion.FloatType:
+			f, _ := v.Float()
+			if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+				return v, false
+			}
+			return ion.Int(int64(f)), true
+		case ion.StringType, ion.SymbolType:
+			s, _ := v.String()
+			i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+			if err != nil {
+				return v, false
+			}
+			return ion.Int(i), true
+		}
+	case "float":
+		switch v.Type() {
+		case ion.FloatType:
+			return v, true
+		case ion.IntType:
+			i, _ := v.Int()
+			return ion.Float(float64(i)), true
+		case ion.UintType:
+			u, _ := v.Uint()
+			return ion.Float(float64(u)), true
+		case ion.StringType, ion.SymbolType:
+			s, _ := v.String()
+			f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				return v, false
+			}
+			return ion.Float(f), true
+		}
+	case "string":
+		switch v.Type() {
+		case ion.StringType:
+			return v, true
+		case ion.SymbolType:
+			s, _ := v.String()
+			return ion.String(s), true
+		case ion.IntType:
+			i, _ := v.Int()
+			return ion.String(strconv.FormatInt(i, 10)), true
+		case ion.UintType:
+			u, _ := v.Uint()
+			return ion.String(strconv.FormatUint(u, 10)), true
+		case ion.FloatType:
+			f, _ := v.Float()
+			return ion.String(strconv.FormatFloat(f, 'g', -1, 64)), true
+		case ion.BoolType:
+			b, _ := v.Bool()
+			return ion.String(strconv.FormatBool(b)), true
+		}
+	case "timestamp":
+		switch v.Type() {
+		case ion.TimestampType:
+			return v, true
+		case ion.StringType, ion.SymbolType:
+			s, _ := v.String()
+			t, ok := date.Parse([]byte(s))
+			if !ok {
+				return v, false
+			}
+			return ion.Timestamp(t), true
+		}
+	case "list":
+		return v, v.Type() == ion.ListType
+	case "blob":
+		return v, v.Type() == ion.BlobType
+	}
+	return v, false
+}
+
+// timePaths returns the paths of every
+// field declared with type "timestamp"
+func (s *Schema) timePaths() [][]string {
+	var out [][]string
+	for i := range s.Fields {
+		if s.Fields[i].Type == "timestamp" {
+			out = append(out, strings.Split(s.Fields[i].Path, "."))
+		}
+	}
+	return out
+}
+
+// Masked returns a copy of s as it would
+// appear to a tenant whose grant has the
+// given masks: hidden fields and the
+// sub-fields of masked fields are removed,
+// and masked fields are declared nullable
+// with the type they are masked to.
+func (s *Schema) Masked(masks []Mask) *Schema {
+	if len(masks) == 0 {
+		return s
+	}
+	out := &Schema{Strict: s.Strict}
+	for _, f := range s.Fields {
+		m, sub := findMask(masks, f.Path)
+		if m != nil {
+			if sub || m.Action == MaskHide {
+				continue
+			}
+			switch f.Type {
+			case "int", "float", "string":
+				if m.Action == MaskNull {
+					f.Type = "any"
+				}
+			default:
+				f.Type = "any"
+			}
+			f.Nullable = true
+		}
+		out.Fields = append(out.Fields, f)
+	}
+	return out
+}
+
+// RejectsPath returns the path prefix
+// of rejects objects for a table. Rows that
+// do not conform to the table Schema are
+// written as NDJSON to objects in this directory.
+// Each line has the form
+//
+//	{"input": "<input path>", "reason": "<reason>", "row": {...}}
+//
+// If the tenant has a master key (see EncryptedTenant),
+// the same records are written to encrypted packed
+// objects named rejects-*.ion.zst instead, which can
+// be read with "sdb unpack".
+func RejectsPath(db, table string) string {
+	return path.Join("db", db, table, "rejects")
+}
+
+// rejects collects the rows rejected
+// during a single conversion
+type rejects struct {
+	lock  sync.Mutex
+	st    ion.Symtab
+	buf   ion.Buffer
+	count int
+}
+
+func (r *rejects) add(input string, reason error, row ion.Datum) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.buf.BeginStruct(-1)
+	r.buf.BeginField(r.st.Intern("input"))
+	r.buf.WriteString(input)
+	r.buf.BeginField(r.st.Intern("reason"))
+	r.buf.WriteString(reason.Error())
+	r.buf.BeginField(r.st.Intern("row"))
+	row.Encode(&r.buf, &r.st)
+	r.buf.EndStruct()
+	r.count++
+}
+
+// flush writes the rejected rows (if any)
+// to a new object in the rejects directory
+// of the table and returns its path.
+// If the table owner has a master key, the rows
+// are written to a packed object encrypted with it.
+func (r *rejects) flush(st *tableState) (string, error) {
+	if r.count == 0 {
+		return "", nil
+	}
+	var hdr ion.Buffer
+	r.st.Marshal(&hdr, true)
+	if key := MasterKey(st.owner); key != nil {
+		return r.flushEncrypted(st, key, hdr.Bytes())
+	}
+	var text strings.Builder
+	w := ion.NewJSONWriter(&text, '\n')
+	_, err := w.Write(append(hdr.Bytes(), r.buf.Bytes()...))
+	if err != nil {
+		return "", err
+	}
+	p := path.Join(RejectsPath(st.db, st.table), "rejects-"+uuid()+".json")
+	_, err = st.ofs.WriteFile(p, []byte(text.String()))
+	return p, err
+}
+
+func (r *rejects) flushEncrypted(st *tableState, key *blockfmt.MasterKey, hdr []byte) (string, error) {
+	p := path.Join(RejectsPath(st.db, st.table), "rejects-"+uuid()+suffixForComp("zstd"))
+	out, err := st.ofs.Create(p)
+	if err != nil {
+		return "", err
+	}
+	c := blockfmt.Converter{
+		Output: out,
+		Comp:   "zstd",
+		Inputs: []blockfmt.Input{{
+			Path: p,
+			R:    io.NopCloser(io.MultiReader(bytes.NewReader(hdr), bytes.NewReader(r.buf.Bytes()))),
+			F:    blockfmt.UnsafeION(),
+		}},
+		Align:     st.conf.align(),
+		FlushMeta: st.conf.flushMeta(),
+		MasterKey: key,
+	}
+	if err := c.Run(); err != nil {
+		abort(out)
+		return "", err
+	}
+	return p, nil
+}
+
+// schemaFormat is a blockfmt.RowFormat that
+// checks the rows produced by another RowFormat
+// against a table schema
+//
+// Since the rows are re-encoded after they
+// have been checked, time ranges are only
+// collected for the fields that the schema
+// declares as timestamps.
+type schemaFormat struct {
+	inner   blockfmt.RowFormat
+	input   string
+	root    *schemaNode
+	ranges  [][]string
+	rejects *rejects
+}
+
+func (f *schemaFormat) Name() string { return f.inner.Name() }
+
+func (f *schemaFormat) Convert(r io.Reader, dst *ion.Chunker, cons []ion.Field) error {
+	w := &schemaWriter{f: f, dst: dst, lastsyms: -1}
+	// start with the symbols already present in dst
+	// so that dst doesn't have to flush when we
+	// hand it our symbol table
+	dst.Symbols.CloneInto(&w.out)
+	saved := dst.WalkTimeRanges
+	dst.WalkTimeRanges = f.ranges
+	defer func() {
+		dst.WalkTimeRanges = saved
+	}()
+	inner := ion.Chunker{
+		W:          w,
+		Align:      dst.Align,
+		RangeAlign: dst.RangeAlign,
+	}
+	err := f.inner.Convert(r, &inner, cons)
+	if err != nil {
+		return err
+	}
+	return inner.Flush()
+}
+
+// schemaWriter accepts the output of
+// an ion.Chunker and writes conforming
+// rows into dst
+type schemaWriter struct {
+	f        *schemaFormat
+	dst      *ion.Chunker
+	in, out  ion.Symtab
+	buf      ion.Buffer
+	tmp      ion.Buffer
+	lastsyms int // out.MaxID() when last written to dst
+}
+
+func (w *schemaWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	var err error
+	w.buf.Reset()
+	for len(p) > 0 {
+		if ion.IsBVM(p) || ion.TypeOf(p) == ion.AnnotationType {
+			p, err = w.in.Unmarshal(p)
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+		size := ion.SizeOf(p)
+		if size <= 0 || size > len(p) {
+			return 0, fmt.Errorf("object size %d out of range [:%d]", size, len(p))
+		}
+		// skip nop pads, etc.
+		if ion.TypeOf(p) == ion.StructType {
+			d, _, err := ion.ReadDatum(&w.in, p[:size])
+			if err != nil {
+				return 0, err
+			}
+			d, err = w.f.root.conform(d, &w.in, "")
+			if err != nil {
+				w.f.rejects.add(w.f.input, err, d)
+			} else {
+				d.Encode(&w.buf, &w.out)
+			}
+		}
+		p = p[size:]
+	}
+	if w.out.MaxID() != w.lastsyms {
+		w.tmp.Reset()
+		w.out.Marshal(&w.tmp, true)
+		if _, err := w.dst.Write(w.tmp.Bytes()); err != nil {
+			return 0, err
+		}
+		w.lastsyms = w.out.MaxID()
+	}
+	if _, err := w.dst.Write(w.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// withSchema wraps each of the inputs in lst
+// so that rows are checked against st.def.Schema
+func (st *tableState) withSchema(lst []blockfmt.Input) (*rejects, error) {
+	root, err := st.def.Schema.compile(st.def.Partitions)
+	if err != nil {
+		return nil, err
+	}
+	rj := &rejects{}
+	ranges := st.def.Schema.timePaths()
+	for i := range lst {
+		lst[i].F = &schemaFormat{
+			inner:   lst[i].F,
+			input:   lst[i].Path,
+			root:    root,
+			ranges:  ranges,
+			rejects: rj,
+		}
+	}
+	return rj, nil
+}
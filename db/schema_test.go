@@ -15,11 +15,21 @@
 package db
 
 import (
+	"bufio"
 	"encoding/json"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/SnellerInc/sneller/date"
+	"github.com/SnellerInc/sneller/expr"
+	"github.com/SnellerInc/sneller/expr/partiql"
+	"github.com/SnellerInc/sneller/ion"
+	"github.com/SnellerInc/sneller/plan/pir"
 )
 
 func TestDecodeDefinition(t *testing.T) {
@@ -83,3 +93,375 @@ func TestDecodeDefinition(t *testing.T) {
 		t.Fatal("results not equivalent")
 	}
 }
+
+func TestSchemaConform(t *testing.T) {
+	s := &Schema{
+		Strict: true,
+		Fields: []SchemaField{
+			{Path: "id", Type: "int", Required: true},
+			{Path: "score", Type: "float", Nullable: true},
+			{Path: "name", Type: "string"},
+			{Path: "ok", Type: "bool"},
+			{Path: "when", Type: "timestamp"},
+			{Path: "user.email", Type: "string", Required: true},
+			{Path: "extra", Type: "any"},
+		},
+	}
+	root, err := s.compile([]Partition{{Field: "region"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st ion.Symtab
+	row := func(fields ...ion.Field) ion.Datum {
+		return ion.NewStruct(&st, fields).Datum()
+	}
+	f := func(name string, v ion.Datum) ion.Field {
+		return ion.Field{Label: name, Value: v}
+	}
+	when, _ := date.Parse([]byte("2022-10-01T00:00:00Z"))
+	tcs := []struct {
+		in, want ion.Datum
+		reason   string
+	}{
+		{
+			in:   row(f("id", ion.Int(1))),
+			want: row(f("id", ion.Int(1))),
+		},
+		{
+			// coerce everything
+			in: row(f("id", ion.String("12")), f("score", ion.Int(3)),
+				f("name", ion.Float(1.5)), f("ok", ion.String("true")),
+				f("when", ion.String("2022-10-01T00:00:00Z"))),
+			want: row(f("id", ion.Int(12)), f("score", ion.Float(3)),
+				f("name", ion.String("1.5")), f("ok", ion.Bool(true)),
+				f("when", ion.Timestamp(when))),
+		},
+		{
+			in:   row(f("id", ion.Float(4)), f("score", ion.Null), f("region", ion.String("us"))),
+			want: row(f("id", ion.Int(4)), f("score", ion.Null), f("region", ion.String("us"))),
+		},
+		{
+			in:     row(f("score", ion.Float(1))),
+			reason: "id: required field is missing",
+		},
+		{
+			in:     row(f("id", ion.Float(1.5))),
+			reason: "id: cannot use float value as int",
+		},
+		{
+			in:     row(f("id", ion.Int(1)), f("name", ion.Null)),
+			reason: "name: null not allowed",
+		},
+		{
+			in:     row(f("id", ion.Int(1)), f("other", ion.Int(1))),
+			reason: "other: field not declared in schema",
+		},
+		{
+			in:     row(f("id", ion.Int(1)), f("user", ion.String("x"))),
+			reason: "user: expected a struct; found string",
+		},
+		{
+			in:     row(f("id", ion.Int(1)), f("user", row())),
+			reason: "user.email: required field is missing",
+		},
+		{
+			in:     row(f("id", ion.Int(1)), f("user", row(f("email", ion.String("x")), f("ssn", ion.Int(0))))),
+			reason: "user.ssn: field not declared in schema",
+		},
+		{
+			in:     row(f("id", ion.Int(1)), f("when", ion.String("yesterday"))),
+			reason: "when: cannot use string value as timestamp",
+		},
+		{
+			in:   row(f("id", ion.Uint(1)), f("extra", row(f("anything", ion.Null)))),
+			want: row(f("id", ion.Uint(1)), f("extra", row(f("anything", ion.Null)))),
+		},
+	}
+	for i := range tcs {
+		got, err := root.conform(tcs[i].in, &st, "")
+		if tcs[i].reason != "" {
+			if err == nil {
+				t.Errorf("case %d: expected error %q", i, tcs[i].reason)
+			} else if err.Error() != tcs[i].reason {
+				t.Errorf("case %d: got error %q, want %q", i, err, tcs[i].reason)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: %s", i, err)
+			continue
+		}
+		if !got.Equal(tcs[i].want) {
+			t.Errorf("case %d: got %v, want %v", i, got, tcs[i].want)
+		}
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	bad := []Schema{
+		{Fields: []SchemaField{{Path: "x", Type: "integer"}}},
+		{Fields: []SchemaField{{Path: "", Type: "int"}}},
+		{Fields: []SchemaField{{Path: "x..y", Type: "int"}}},
+		{Fields: []SchemaField{{Path: "x", Type: "int"}, {Path: "x", Type: "int"}}},
+		{Fields: []SchemaField{{Path: "x", Type: "int"}, {Path: "x.y", Type: "int"}}},
+		{Fields: []SchemaField{{Path: "x.y", Type: "int"}, {Path: "x", Type: "list"}}},
+	}
+	for i := range bad {
+		if err := bad[i].Validate(); err == nil {
+			t.Errorf("case %d: expected an error", i)
+		}
+	}
+	good := Schema{Fields: []SchemaField{{Path: "x.y", Type: "int"}, {Path: "x", Type: "struct"}}}
+	if err := good.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSchemaMasked(t *testing.T) {
+	s := &Schema{
+		Strict: true,
+		Fields: []SchemaField{
+			{Path: "a", Type: "int", Required: true},
+			{Path: "b", Type: "struct"},
+			{Path: "b.c", Type: "int"},
+			{Path: "d", Type: "string", Required: true},
+			{Path: "e", Type: "string"},
+			{Path: "f", Type: "timestamp"},
+			{Path: "g", Type: "struct"},
+			{Path: "g.h", Type: "int"},
+		},
+	}
+	got := s.Masked([]Mask{
+		{Path: "b", Action: MaskHide},
+		{Path: "d", Action: MaskNull},
+		{Path: "e", Action: MaskRedact},
+		{Path: "f", Action: MaskRedact},
+		{Path: "g", Action: MaskNull},
+	})
+	want := &Schema{
+		Strict: true,
+		Fields: []SchemaField{
+			{Path: "a", Type: "int", Required: true},
+			{Path: "d", Type: "any", Nullable: true, Required: true},
+			{Path: "e", Type: "string", Nullable: true},
+			{Path: "f", Type: "any", Nullable: true},
+			{Path: "g", Type: "any", Nullable: true},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestSchemaHint(t *testing.T) {
+	s := &Schema{
+		Strict: true,
+		Fields: []SchemaField{
+			{Path: "id", Type: "int", Required: true},
+			{Path: "score", Type: "float", Nullable: true},
+			{Path: "user.email", Type: "string"},
+			{Path: "tags", Type: "list"},
+			{Path: "extra", Type: "any"},
+		},
+	}
+	hint, err := s.Hint(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := func(str string) expr.Node {
+		p, err := expr.ParsePath(str)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	tcs := []struct {
+		path string
+		want expr.TypeSet
+	}{
+		{"id", expr.IntegerType},
+		{"score", expr.FloatType | expr.NullType | expr.MissingType},
+		{"user.email", expr.StringType | expr.MissingType},
+		{"user.name", expr.MissingType},
+		{"user", expr.TypeSet(1<<ion.StructType) | expr.MissingType},
+		{"other", expr.MissingType},
+		{"tags[0]", expr.AnyType},
+		{"id.x", expr.MissingType},
+		{"extra.x.y", expr.AnyType},
+	}
+	for i := range tcs {
+		got := hint.TypeOf(path(tcs[i].path))
+		if got != tcs[i].want {
+			t.Errorf("%s: got %x, want %x", tcs[i].path, got, tcs[i].want)
+		}
+	}
+	s.Strict = false
+	hint, _ = s.Hint(nil)
+	if got := hint.TypeOf(path("other")); got != expr.AnyType {
+		t.Errorf("non-strict: got %x for undeclared field", got)
+	}
+}
+
+// hintEnv is a pir.Env that
+// provides the same hint for every table
+type hintEnv struct {
+	hint expr.Hint
+}
+
+func (h hintEnv) Schema(expr.Node) expr.Hint { return h.hint }
+
+func (h hintEnv) Index(expr.Node) (pir.Index, error) { return nil, nil }
+
+func TestSchemaHintPartitions(t *testing.T) {
+	s := &Schema{
+		Strict: true,
+		Fields: []SchemaField{
+			{Path: "id", Type: "int", Required: true},
+		},
+	}
+	parts := []Partition{{Field: "region"}}
+	q, err := partiql.Parse([]byte("SELECT id FROM t WHERE region = 'us'"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ingest accepts rows with partition fields,
+	// so queries may reference them as well
+	hint, err := s.Hint(parts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pir.Build(q, hintEnv{hint}); err != nil {
+		t.Errorf("partitioned: %s", err)
+	}
+	hint, err = s.Hint(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pir.Build(q, hintEnv{hint}); err == nil {
+		t.Error("unpartitioned: expected an error for an undeclared field")
+	}
+}
+
+func TestSchemaIngest(t *testing.T) {
+	checkFiles(t)
+	tmpdir := t.TempDir()
+	dfs := newDirFS(t, tmpdir)
+	owner := newTenant(dfs)
+	err := WriteDefinition(dfs, "default", &Definition{
+		Name: "rows",
+		Schema: &Schema{
+			Fields: []SchemaField{
+				{Path: "id", Type: "int", Required: true},
+				{Path: "n", Type: "float"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var text strings.Builder
+	const rows = 20
+	for i := 0; i < rows; i++ {
+		switch i % 4 {
+		case 0:
+			fmt.Fprintf(&text, "{\"id\": %d, \"n\": %d}\n", i, i)
+		case 1:
+			fmt.Fprintf(&text, "{\"id\": \"%d\", \"n\": \"%d.5\"}\n", i, i)
+		case 2:
+			fmt.Fprintf(&text, "{\"id\": %d, \"other\": \"foo\"}\n", i)
+		case 3:
+			fmt.Fprintf(&text, "{\"id\": \"not-a-number\", \"n\": %d}\n", i)
+		}
+	}
+	err = os.WriteFile(filepath.Join(tmpdir, "input.json"), []byte(text.String()), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lst, err := collectGlob(dfs, nil, "input.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := Builder{Align: 1024, Logf: t.Logf}
+	err = b.append(owner, "default", "rows", lst, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := OpenIndex(dfs, "default", "rows", owner.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Inline) != 1 {
+		t.Fatalf("expected 1 object; got %d", len(idx.Inline))
+	}
+	f, err := dfs.Open(idx.Inline[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rc := &rowCollector{
+		keys: [][]string{{"id"}, {"n"}},
+		out:  new(ion.Symtab),
+	}
+	err = rc.collect(f, idx.Inline[0].Trailer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const accepted = rows / 4 * 3
+	if len(rc.rows) != accepted {
+		t.Fatalf("got %d rows; expected %d", len(rc.rows), accepted)
+	}
+	for i := range rc.rows {
+		d, _, err := ion.ReadDatum(rc.out, rc.rows[i].key[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := d.Int(); !ok {
+			if _, ok := d.Uint(); !ok {
+				t.Errorf("row %d: id %v is not an integer", i, d)
+			}
+		}
+		if len(rc.rows[i].key[1]) == 0 {
+			continue
+		}
+		d, _, err = ion.ReadDatum(rc.out, rc.rows[i].key[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Type() != ion.FloatType {
+			t.Errorf("row %d: n %v is not a float", i, d)
+		}
+	}
+
+	// the rejected rows should be in the rejects object
+	rejects, err := fs.Glob(dfs, RejectsPath("default", "rows")+"/rejects-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rejects) != 1 {
+		t.Fatalf("expected 1 rejects object; found %v", rejects)
+	}
+	rf, err := dfs.Open(rejects[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	lines := 0
+	scan := bufio.NewScanner(rf)
+	for scan.Scan() {
+		var rec struct {
+			Input  string          `json:"input"`
+			Reason string          `json:"reason"`
+			Row    json.RawMessage `json:"row"`
+		}
+		if err := json.Unmarshal(scan.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(rec.Input, "input.json") || rec.Reason == "" || len(rec.Row) == 0 {
+			t.Errorf("unexpected rejects record %s", scan.Bytes())
+		}
+		lines++
+	}
+	if lines != rows/4 {
+		t.Errorf("got %d rejected rows; expected %d", lines, rows/4)
+	}
+}
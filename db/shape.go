@@ -0,0 +1,454 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/SnellerInc/sneller/date"
+	"github.com/SnellerInc/sneller/ion"
+	"github.com/SnellerInc/sneller/ion/blockfmt"
+	"github.com/SnellerInc/sneller/vm"
+
+	"golang.org/x/exp/slices"
+)
+
+// Shape is the inferred shape of the data in a table.
+//
+// When Builder.InferShape is set, the Builder
+// computes SYSTEM_DATASHAPE(*) over the objects
+// it writes during each ingest and merges the
+// result into the Shape stored at ShapePath.
+type Shape struct {
+	// Updated is the time at which
+	// the shape was last updated.
+	Updated date.Time `json:"updated"`
+	// Total is the total number of rows
+	// that have been examined.
+	Total int64 `json:"total"`
+	// Fields is the merged shape of
+	// every ingest, indexed by path.
+	Fields map[string]FieldShape `json:"fields"`
+	// Last is the shape of the objects
+	// written by the most recent ingest.
+	Last map[string]FieldShape `json:"last"`
+	// Drift is the difference between
+	// Last and the shape of the ingest
+	// that preceded it.
+	Drift *Drift `json:"drift,omitempty"`
+	// Error, if non-empty, indicates
+	// that the shape is incomplete.
+	// (Typically this is because the data
+	// has too many distinct fields.)
+	Error string `json:"error,omitempty"`
+}
+
+// FieldShape is the number of times that
+// each type (i.e. "int", "string", etc.)
+// has been observed for one path.
+type FieldShape map[string]int64
+
+// Types returns the sorted list of
+// types that have been observed.
+func (f FieldShape) Types() []string {
+	out := make([]string, 0, len(f))
+	for k, v := range f {
+		if v > 0 {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Drift describes how the shape of a table
+// changed between two consecutive ingests.
+type Drift struct {
+	// Added is the list of paths that were
+	// not present in the previous ingest.
+	Added []string `json:"added,omitempty"`
+	// Removed is the list of paths that
+	// were present in the previous ingest
+	// but not in the most recent one.
+	Removed []string `json:"removed,omitempty"`
+	// Changed is the list of paths that
+	// were observed with a different
+	// set of types.
+	Changed []TypeChange `json:"changed,omitempty"`
+}
+
+// TypeChange is a change in the set of
+// types observed for a path.
+type TypeChange struct {
+	Path string   `json:"path"`
+	Old  []string `json:"old"`
+	New  []string `json:"new"`
+}
+
+// Empty returns true if d describes no changes.
+func (d *Drift) Empty() bool {
+	return d == nil || len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// ShapePath returns the path at which
+// the inferred shape of a table is stored.
+func ShapePath(db, table string) string {
+	return path.Join("db", db, table, "shape.json")
+}
+
+// OpenShape opens the inferred shape of a table.
+// OpenShape returns an error matching fs.ErrNotExist
+// if no shape has been computed for the table.
+func OpenShape(src fs.FS, db, table string) (*Shape, error) {
+	buf, err := fs.ReadFile(src, ShapePath(db, table))
+	if err != nil {
+		return nil, err
+	}
+	s := new(Shape)
+	err = json.Unmarshal(buf, s)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", ShapePath(db, table), err)
+	}
+	return s, nil
+}
+
+func diffShapes(prev, cur map[string]FieldShape) *Drift {
+	d := new(Drift)
+	for p, f := range cur {
+		old, ok := prev[p]
+		if !ok {
+			d.Added = append(d.Added, p)
+			continue
+		}
+		ot, nt := old.Types(), f.Types()
+		if !slices.Equal(ot, nt) {
+			d.Changed = append(d.Changed, TypeChange{Path: p, Old: ot, New: nt})
+		}
+	}
+	for p := range prev {
+		if _, ok := cur[p]; !ok {
+			d.Removed = append(d.Removed, p)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	slices.SortFunc(d.Changed, func(x, y TypeChange) bool {
+		return x.Path < y.Path
+	})
+	return d
+}
+
+// update merges the shape of a new ingest
+// (with total rows) into s and computes Drift
+func (s *Shape) update(total int64, last map[string]FieldShape, errmsg string) {
+	if s.Fields == nil {
+		s.Fields = make(map[string]FieldShape)
+	}
+	if s.Last != nil {
+		s.Drift = diffShapes(s.Last, last)
+	} else {
+		s.Drift = nil
+	}
+	for p, f := range last {
+		dst := s.Fields[p]
+		if dst == nil {
+			dst = make(FieldShape, len(f))
+			s.Fields[p] = dst
+		}
+		for k, v := range f {
+			dst[k] += v
+		}
+	}
+	s.Last = last
+	s.Total += total
+	if errmsg != "" {
+		s.Error = errmsg
+	}
+	s.Updated = date.Now().Truncate(time.Second)
+}
+
+// subtractShape subtracts the type counts
+// in sub from dst and removes the types
+// and fields that have no counts left
+func subtractShape(dst, sub map[string]FieldShape) {
+	for p, f := range sub {
+		d := dst[p]
+		if d == nil {
+			continue
+		}
+		for k, v := range f {
+			if d[k] -= v; d[k] <= 0 {
+				delete(d, k)
+			}
+		}
+		if len(d) == 0 {
+			delete(dst, p)
+		}
+	}
+}
+
+// shapeTypes is the set of fields in the
+// output of SYSTEM_DATASHAPE(*) that are
+// type counts (the rest are statistics)
+var shapeTypes = []string{
+	"null", "bool", "int", "float", "decimal", "timestamp", "string",
+	"list", "struct", "sexp", "clob", "blob", "annotation",
+}
+
+func count(d ion.Datum) (int64, bool) {
+	if u, ok := d.Uint(); ok {
+		return int64(u), true
+	}
+	return d.Int()
+}
+
+// decodeDatashape decodes the result
+// of SYSTEM_DATASHAPE(*)
+func decodeDatashape(buf []byte) (int64, map[string]FieldShape, string, error) {
+	var st ion.Symtab
+	var total int64
+	var errmsg string
+	fields := make(map[string]FieldShape)
+	for len(buf) > 0 {
+		if ion.IsBVM(buf) || ion.TypeOf(buf) == ion.AnnotationType {
+			var err error
+			buf, err = st.Unmarshal(buf)
+			if err != nil {
+				return 0, nil, "", err
+			}
+			continue
+		}
+		d, rest, err := ion.ReadDatum(&st, buf)
+		if err != nil {
+			return 0, nil, "", err
+		}
+		buf = rest
+		s, ok := d.Struct()
+		if !ok {
+			continue
+		}
+		err = s.Each(func(f ion.Field) bool {
+			switch f.Label {
+			case "total":
+				total, _ = count(f.Value)
+			case "error":
+				errmsg, _ = f.Value.String()
+			case "fields":
+				lst, ok := f.Value.Struct()
+				if !ok {
+					return true
+				}
+				lst.Each(func(f ion.Field) bool {
+					types, ok := f.Value.Struct()
+					if !ok {
+						return true
+					}
+					shape := make(FieldShape)
+					types.Each(func(t ion.Field) bool {
+						if !slices.Contains(shapeTypes, t.Label) {
+							return true
+						}
+						if n, ok := count(t.Value); ok && n > 0 {
+							shape[t.Label] = n
+						}
+						return true
+					})
+					fields[f.Label] = shape
+					return true
+				})
+			}
+			return true
+		})
+		if err != nil {
+			return 0, nil, "", err
+		}
+	}
+	return total, fields, errmsg, nil
+}
+
+// datashape computes SYSTEM_DATASHAPE(*)
+// over the rows in the objects in lst
+func (st *tableState) datashape(lst []blockfmt.Descriptor) (int64, map[string]FieldShape, string, error) {
+	var out vm.QueryBuffer
+	sink := vm.NewSystemDatashape(&out)
+	w, err := sink.Open()
+	if err != nil {
+		return 0, nil, "", err
+	}
+	for i := range lst {
+		err = st.copyRows(w, &lst[i])
+		if err != nil {
+			w.Close()
+			return 0, nil, "", fmt.Errorf("%s: %w", lst[i].Path, err)
+		}
+	}
+	err = w.Close()
+	if err != nil {
+		return 0, nil, "", err
+	}
+	err = sink.Close()
+	if err != nil {
+		return 0, nil, "", err
+	}
+	return decodeDatashape(out.Bytes())
+}
+
+func (st *tableState) copyRows(dst io.Writer, desc *blockfmt.Descriptor) error {
+	t, err := st.unwrap(desc)
+	if err != nil {
+		return err
+	}
+	if t == nil || len(t.Blocks) == 0 {
+		return nil
+	}
+	f, err := open(st.ofs, desc.Path, desc.ETag, desc.Size)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var d blockfmt.Decoder
+	d.Set(t, len(t.Blocks))
+	_, err = d.Copy(dst, io.LimitReader(f, t.Offset-t.Blocks[0].Offset))
+	return err
+}
+
+// updateShape computes the shape of the rows
+// written by the most recent ingest and merges it
+// into the shape stored at ShapePath
+//
+// The rows written by the ingest are the rows in
+// the objects in lst, minus the rows in the objects
+// in prepended (which were re-written into some
+// of the objects in lst and have already been
+// accounted for by a previous ingest).
+func (st *tableState) updateShape(lst, prepended []blockfmt.Descriptor) error {
+	total, last, errmsg, err := st.datashape(lst)
+	if err != nil {
+		return err
+	}
+	if len(prepended) > 0 {
+		ptotal, plast, perrmsg, err := st.datashape(prepended)
+		if err != nil {
+			return err
+		}
+		total -= ptotal
+		subtractShape(last, plast)
+		if errmsg == "" {
+			errmsg = perrmsg
+		}
+	}
+	s, err := OpenShape(st.ofs, st.db, st.table)
+	if errors.Is(err, fs.ErrNotExist) {
+		s = new(Shape)
+	} else if err != nil {
+		return err
+	}
+	s.update(total, last, errmsg)
+	buf, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = st.ofs.WriteFile(ShapePath(st.db, st.table), buf)
+	if err != nil {
+		return err
+	}
+	if !s.Drift.Empty() {
+		st.conf.logf("table %s: shape changed: %d added, %d removed, %d changed",
+			st.table, len(s.Drift.Added), len(s.Drift.Removed), len(s.Drift.Changed))
+	}
+	return nil
+}
+
+// maskShape returns the shape that f would
+// have once the action of m was applied
+func maskShape(f FieldShape, m *Mask) FieldShape {
+	out := make(FieldShape)
+	for k, v := range f {
+		if m.Action == MaskRedact && (k == "int" || k == "float" || k == "string") {
+			out[k] += v
+		} else {
+			out["null"] += v
+		}
+	}
+	return out
+}
+
+func maskFields(fields map[string]FieldShape, masks []Mask) map[string]FieldShape {
+	if fields == nil {
+		return nil
+	}
+	out := make(map[string]FieldShape, len(fields))
+	for p, f := range fields {
+		m, sub := findMask(masks, p)
+		switch {
+		case m == nil:
+			out[p] = f
+		case sub || m.Action == MaskHide:
+			// not visible
+		default:
+			out[p] = maskShape(f, m)
+		}
+	}
+	return out
+}
+
+func maskPaths(lst []string, masks []Mask) []string {
+	var out []string
+	for _, p := range lst {
+		if m, sub := findMask(masks, p); m == nil || !sub && m.Action != MaskHide {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Masked returns a copy of s as it would
+// appear to a tenant whose grant has the
+// given masks: hidden fields and the
+// sub-fields of masked fields are removed,
+// and the types of masked fields are
+// replaced with the types they are
+// masked to.
+func (s *Shape) Masked(masks []Mask) *Shape {
+	if len(masks) == 0 {
+		return s
+	}
+	out := *s
+	out.Fields = maskFields(s.Fields, masks)
+	out.Last = maskFields(s.Last, masks)
+	if s.Drift != nil {
+		d := &Drift{
+			Added:   maskPaths(s.Drift.Added, masks),
+			Removed: maskPaths(s.Drift.Removed, masks),
+		}
+		for _, c := range s.Drift.Changed {
+			if m, _ := findMask(masks, c.Path); m == nil {
+				d.Changed = append(d.Changed, c)
+			}
+		}
+		out.Drift = d
+		if d.Empty() {
+			out.Drift = nil
+		}
+	}
+	return &out
+}
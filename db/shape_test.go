@@ -0,0 +1,205 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package db
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestShapeUpdate(t *testing.T) {
+	var s Shape
+	s.update(2, map[string]FieldShape{
+		"a":   {"int": 2},
+		"b":   {"string": 1},
+		"c":   {"struct": 1},
+		"c.d": {"int": 1},
+	}, "")
+	if s.Drift != nil {
+		t.Errorf("unexpected drift %+v on first update", s.Drift)
+	}
+	s.update(3, map[string]FieldShape{
+		"a": {"int": 1, "string": 2},
+		"b": {"string": 3},
+		"e": {"bool": 3},
+	}, "")
+	want := &Drift{
+		Added:   []string{"e"},
+		Removed: []string{"c", "c.d"},
+		Changed: []TypeChange{{Path: "a", Old: []string{"int"}, New: []string{"int", "string"}}},
+	}
+	if !reflect.DeepEqual(s.Drift, want) {
+		t.Errorf("got drift %+v, want %+v", s.Drift, want)
+	}
+	if s.Total != 5 {
+		t.Errorf("got total %d", s.Total)
+	}
+	if !reflect.DeepEqual(s.Fields["a"], FieldShape{"int": 3, "string": 2}) {
+		t.Errorf("got merged shape %v for a", s.Fields["a"])
+	}
+	if _, ok := s.Fields["c.d"]; !ok {
+		t.Error("merged shape lost field c.d")
+	}
+	s.update(1, map[string]FieldShape{
+		"a": {"string": 1, "int": 1},
+		"b": {"string": 1},
+		"e": {"bool": 1},
+	}, "")
+	if !s.Drift.Empty() {
+		t.Errorf("unexpected drift %+v", s.Drift)
+	}
+}
+
+func TestShapeMasked(t *testing.T) {
+	fields := map[string]FieldShape{
+		"a":     {"int": 2},
+		"b":     {"string": 1, "struct": 1},
+		"b.c":   {"int": 1},
+		"d":     {"int": 1, "bool": 1},
+		"e":     {"float": 2, "timestamp": 1},
+		"e.f":   {"int": 1},
+		"g.h":   {"string": 2},
+		"g.h.i": {"int": 1},
+	}
+	s := &Shape{
+		Total:  2,
+		Fields: fields,
+		Last:   fields,
+		Drift: &Drift{
+			Added:   []string{"a", "b.c", "d"},
+			Removed: []string{"g.h.i"},
+			Changed: []TypeChange{
+				{Path: "d", Old: []string{"int"}, New: []string{"bool", "int"}},
+				{Path: "e", Old: []string{"float"}, New: []string{"float", "timestamp"}},
+			},
+		},
+	}
+	masks := []Mask{
+		{Path: "b", Action: MaskHide},
+		{Path: "d", Action: MaskNull},
+		{Path: "e", Action: MaskRedact},
+		{Path: "g.h", Action: MaskHide},
+	}
+	want := map[string]FieldShape{
+		"a": {"int": 2},
+		"d": {"null": 2},
+		"e": {"float": 2, "null": 1},
+	}
+	m := s.Masked(masks)
+	if !reflect.DeepEqual(m.Fields, want) {
+		t.Errorf("got fields %v, want %v", m.Fields, want)
+	}
+	if !reflect.DeepEqual(m.Last, want) {
+		t.Errorf("got last %v, want %v", m.Last, want)
+	}
+	wantDrift := &Drift{Added: []string{"a", "d"}}
+	if !reflect.DeepEqual(m.Drift, wantDrift) {
+		t.Errorf("got drift %+v, want %+v", m.Drift, wantDrift)
+	}
+	// the original must be untouched
+	if len(s.Fields) != 8 || len(s.Drift.Changed) != 2 {
+		t.Error("Masked modified its receiver")
+	}
+	if s.Masked(nil) != s {
+		t.Error("Masked(nil) should return the receiver")
+	}
+}
+
+func TestInferShape(t *testing.T) {
+	t.Run("append", func(t *testing.T) {
+		testInferShape(t, 1)
+	})
+	// the second ingest re-writes the
+	// object written by the first one,
+	// which must not be counted twice
+	t.Run("prepend", func(t *testing.T) {
+		testInferShape(t, 1<<20)
+	})
+}
+
+func testInferShape(t *testing.T, mergeSize int) {
+	checkFiles(t)
+	tmpdir := t.TempDir()
+	dfs := newDirFS(t, tmpdir)
+	owner := newTenant(dfs)
+	err := WriteDefinition(dfs, "default", &Definition{Name: "rows"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := Builder{
+		Align:        1024,
+		MinMergeSize: mergeSize,
+		InferShape:   true,
+		Logf:         t.Logf,
+	}
+	_, err = OpenShape(dfs, "default", "rows")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist; got %v", err)
+	}
+	inputs := []string{
+		`{"id": 0, "name": "foo", "tags": ["x"]}
+{"id": 1, "name": "bar", "tags": []}`,
+		`{"id": 2, "name": 3, "extra": {"x": true}}`,
+	}
+	for i, text := range inputs {
+		name := "input-" + string(rune('0'+i)) + ".json"
+		err := os.WriteFile(filepath.Join(tmpdir, name), []byte(text), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lst, err := collectGlob(dfs, nil, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = b.append(owner, "default", "rows", lst, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	idx, err := OpenIndex(dfs, "default", "rows", owner.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := idx.Objects(); mergeSize > 1 && n != 1 {
+		t.Fatalf("got %d objects; expected the first one to be re-written", n)
+	}
+	s, err := OpenShape(dfs, "default", "rows")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Total != 3 {
+		t.Errorf("got total %d; expected 3", s.Total)
+	}
+	if got := s.Fields["name"]; !reflect.DeepEqual(got, FieldShape{"string": 2, "int": 1}) {
+		t.Errorf("got shape %v for name", got)
+	}
+	if s.Drift == nil {
+		t.Fatal("no drift report")
+	}
+	if !reflect.DeepEqual(s.Drift.Added, []string{"extra", "extra.x"}) {
+		t.Errorf("got added %v", s.Drift.Added)
+	}
+	if len(s.Drift.Removed) == 0 || s.Drift.Removed[0] != "tags" {
+		t.Errorf("got removed %v", s.Drift.Removed)
+	}
+	want := []TypeChange{{Path: "name", Old: []string{"string"}, New: []string{"int"}}}
+	if !reflect.DeepEqual(s.Drift.Changed, want) {
+		t.Errorf("got changed %+v", s.Drift.Changed)
+	}
+}
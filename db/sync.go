@@ -29,6 +29,8 @@ import (
 	"github.com/SnellerInc/sneller/date"
 	"github.com/SnellerInc/sneller/ion"
 	"github.com/SnellerInc/sneller/ion/blockfmt"
+
+	"golang.org/x/exp/slices"
 )
 
 // DefaultMinMerge is the default minimum merge size.
@@ -90,6 +92,11 @@ type Builder struct {
 	// size of objects. If MinMergeSize is zero,
 	// then DefaultMinMerge is used.
 	MinMergeSize int
+	// CompactSize is the target decompressed
+	// size of objects produced by Compact.
+	// If CompactSize is zero, then
+	// DefaultCompactSize is used.
+	CompactSize int64
 	// Force forces a full index rebuild
 	// even when the input appears to be up-to-date.
 	Force bool
@@ -135,6 +142,12 @@ type Builder struct {
 	// how this value is used.
 	GCMinimumAge time.Duration
 
+	// InferShape, if true, causes the Builder
+	// to compute the shape of newly-ingested data
+	// and merge it into the table Shape.
+	// See Shape and ShapePath.
+	InferShape bool
+
 	// InputMinimumAge is the mininum time
 	// that an input file leaf should be left
 	// around after it is no longer referenced.
@@ -176,6 +189,21 @@ func (b *Builder) Format(chosen, name string, hints []byte) (blockfmt.RowFormat,
 	return nil, nil
 }
 
+// inputFormat picks the row format for an object
+// that matches in (see Builder.Format) and wraps
+// it so that in.Transform is applied to its rows
+func (b *Builder) inputFormat(in *Input, name string) (blockfmt.RowFormat, error) {
+	f, err := b.Format(in.Format, name, in.Hints)
+	if err != nil || f == nil || in.Transform == "" {
+		return f, err
+	}
+	t, err := compileTransform(in.Transform)
+	if err != nil {
+		return nil, err
+	}
+	return &transformFormat{inner: f, t: t}, nil
+}
+
 func (b *Builder) logf(f string, args ...interface{}) {
 	if b.Logf != nil {
 		b.Logf(f, args...)
@@ -188,6 +216,10 @@ type tableState struct {
 	owner     Tenant
 	ofs       OutputFS
 	db, table string
+	// sealer seals the index and the files
+	// that it references if owner has
+	// a master key; otherwise it is nil
+	sealer *blockfmt.Sealer
 }
 
 func (b *Builder) open(db, table string, owner Tenant) (*tableState, error) {
@@ -213,6 +245,12 @@ func (b *Builder) open(db, table string, owner Tenant) (*tableState, error) {
 		db:    db,
 		table: table,
 	}
+	if mk := MasterKey(owner); mk != nil {
+		ts.sealer, err = blockfmt.NewSealer(mk)
+		if err != nil {
+			return nil, err
+		}
+	}
 	ts.conf.SetFeatures(def.Features)
 	return ts, nil
 }
@@ -222,7 +260,7 @@ func (st *tableState) index(cache *IndexCache) (*blockfmt.Index, error) {
 		return cache.value, nil
 	}
 	ipath := IndexPath(st.db, st.table)
-	idx, info, err := openIndex(st.ofs, ipath, st.owner.Key(), 0)
+	idx, info, err := openIndex(st.ofs, ipath, st.owner.Key(), st.sealer, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -563,17 +601,27 @@ func uuid() string {
 	return strings.TrimSuffix(base32.StdEncoding.EncodeToString(buf[:]), "======")
 }
 
+// sign signs idx and seals it for
+// storage at path p if st.sealer is set
+func (st *tableState) sign(p string, idx *blockfmt.Index) ([]byte, error) {
+	buf, err := blockfmt.Sign(st.owner.Key(), idx)
+	if err != nil {
+		return nil, err
+	}
+	return st.sealer.Seal(p, buf)
+}
+
 func (st *tableState) emptyIndex(cache *IndexCache) error {
 	idx := blockfmt.Index{
 		Created: date.Now().Truncate(time.Microsecond),
 		Name:    st.table,
 		// no Inline, etc.
 	}
-	buf, err := blockfmt.Sign(st.owner.Key(), &idx)
+	p := IndexPath(st.db, st.table)
+	buf, err := st.sign(p, &idx)
 	if err != nil {
 		return err
 	}
-	p := IndexPath(st.db, st.table)
 	etag, err := st.ofs.WriteFile(p, buf)
 	if err == nil {
 		overwrite(cache, &idx, etag)
@@ -716,7 +764,7 @@ func (st *tableState) writeIndex(idx *blockfmt.Index, cache *IndexCache) error {
 			}
 		}
 	}
-	buf, err := blockfmt.Sign(st.owner.Key(), idx)
+	buf, err := st.sign(idp, idx)
 	if err != nil {
 		return err
 	}
@@ -737,6 +785,7 @@ func (st *tableState) flush(idx *blockfmt.Index, cache *IndexCache) (err error)
 	idx.Name = st.table
 	idx.UserData = st.userdata()
 	idx.Inputs.Backing = st.ofs
+	idx.SetSealer(st.sealer)
 	dir := path.Join("db", st.db, st.table)
 	err = idx.SyncInputs(dir, st.conf.inputMinAge())
 	if err != nil {
@@ -786,11 +835,16 @@ func (e *errUpdateFailed) Unwrap() error {
 func (st *tableState) force(idx *blockfmt.Index, parts []partition, cache *IndexCache) error {
 	extra := make([]blockfmt.Descriptor, 0, len(parts))
 	errs := make([]error, len(parts))
+	stats := make([]*blockfmt.Stats, len(parts))
+	// the objects that are re-written
+	// along with the new rows
+	var prepended []blockfmt.Descriptor
 	var wg sync.WaitGroup
 	wg.Add(len(parts))
 	for i := range parts {
 		var prepend, dst *blockfmt.Descriptor
 		if p := parts[i].prepend; p >= 0 {
+			prepended = append(prepended, idx.Inline[p])
 			prepend = &idx.Inline[p]
 			dst = &idx.Inline[p]
 		} else {
@@ -799,7 +853,7 @@ func (st *tableState) force(idx *blockfmt.Index, parts []partition, cache *Index
 		}
 		go func(i int) {
 			defer wg.Done()
-			errs[i] = st.forcePart(prepend, dst, &parts[i])
+			stats[i], errs[i] = st.forcePart(prepend, dst, &parts[i])
 		}(i)
 	}
 	wg.Wait()
@@ -821,6 +875,17 @@ func (st *tableState) force(idx *blockfmt.Index, parts []partition, cache *Index
 			}
 		}
 	}
+	// statistics are only maintained for indexes
+	// that have had them from the beginning, since
+	// otherwise they wouldn't cover every row
+	if idx.Stats == nil && idx.Objects() == 0 {
+		idx.Stats = new(blockfmt.Stats)
+	}
+	if idx.Stats != nil {
+		for i := range stats {
+			idx.Stats.Merge(stats[i])
+		}
+	}
 	idx.Algo = "zstd"
 	idx.Created = date.Now().Truncate(time.Microsecond)
 	idx.Inline = append(idx.Inline, extra...)
@@ -828,12 +893,37 @@ func (st *tableState) force(idx *blockfmt.Index, parts []partition, cache *Index
 	if err != nil {
 		return err
 	}
+	if st.conf.InferShape {
+		written := extra
+		for i := range parts {
+			if p := parts[i].prepend; p >= 0 {
+				written = append(written, idx.Inline[p])
+			}
+		}
+		// the new data has already been committed,
+		// so a failure here shouldn't fail the update
+		if err := st.updateShape(written, prepended); err != nil {
+			st.conf.logf("table %s: updating shape: %s", st.table, err)
+		}
+	}
 	return st.runGC(idx)
 }
 
-func (st *tableState) forcePart(prepend, dst *blockfmt.Descriptor, part *partition) error {
+// forcePart writes the inputs in part to a new object
+// and returns the statistics of the rows that were written
+func (st *tableState) forcePart(prepend, dst *blockfmt.Descriptor, part *partition) (*blockfmt.Stats, error) {
+	inputs := part.lst
+	var rj *rejects
+	if st.def.Schema != nil {
+		inputs = slices.Clone(inputs)
+		var err error
+		rj, err = st.withSchema(inputs)
+		if err != nil {
+			return nil, err
+		}
+	}
 	c := blockfmt.Converter{
-		Inputs:    part.lst,
+		Inputs:    inputs,
 		Align:     st.conf.align(),
 		FlushMeta: st.conf.flushMeta(),
 		Comp:      st.conf.comp(),
@@ -843,23 +933,49 @@ func (st *tableState) forcePart(prepend, dst *blockfmt.Descriptor, part *partiti
 	if prepend != nil {
 		f, err := open(st.ofs, prepend.Path, prepend.ETag, prepend.Size)
 		if err != nil {
-			return fmt.Errorf("opening %s for re-ingest: %w", prepend.Path, err)
+			return nil, fmt.Errorf("opening %s for re-ingest: %w", prepend.Path, err)
 		}
 		defer f.Close()
-		tr := prepend.Trailer
+		tr, err := st.unwrap(prepend)
+		if err != nil {
+			return nil, err
+		}
 		// NOTE: make sure R is an *s3.File here when we're on AWS;
 		// that way we can use server-side copy for some prepends
 		c.Prepend.R = f
 		c.Prepend.Trailer = tr
 	}
 
+	err := st.writeObject(&c, part.name, dst)
+	if err != nil {
+		return nil, err
+	}
+	if rj == nil {
+		return c.Stats(), nil
+	}
+	p, err := rj.flush(st)
+	if err != nil {
+		return nil, fmt.Errorf("writing rejected rows: %w", err)
+	}
+	if p != "" {
+		st.conf.logf("table %s: %d rows did not conform to the schema; wrote %s", st.table, rj.count, p)
+	}
+	return c.Stats(), nil
+}
+
+// writeObject runs c with its output directed
+// to a new packed object within the partition
+// part and populates dst with the descriptor
+// of the new object.
+func (st *tableState) writeObject(c *blockfmt.Converter, part string, dst *blockfmt.Descriptor) error {
 	name := "packed-" + uuid() + suffixForComp(c.Comp)
-	fp := path.Join("db", st.db, st.table, part.name, name)
+	fp := path.Join("db", st.db, st.table, part, name)
 	out, err := st.ofs.Create(fp)
 	if err != nil {
 		return err
 	}
 	c.Output = out
+	c.MasterKey = MasterKey(st.owner)
 	err = c.Run()
 	if err != nil {
 		abort(out)
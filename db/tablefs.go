@@ -109,7 +109,7 @@ const MaxIndexSize = 15 * 1024 * 1024
 // The key must correspond to the key used to sign the index
 // when it was first inserted into the index.
 func OpenIndex(s fs.FS, db, table string, key *blockfmt.Key) (*blockfmt.Index, error) {
-	i, _, err := openIndex(s, IndexPath(db, table), key, 0)
+	i, _, err := openIndex(s, IndexPath(db, table), key, nil, 0)
 	return i, err
 }
 
@@ -118,11 +118,26 @@ func OpenIndex(s fs.FS, db, table string, key *blockfmt.Key) (*blockfmt.Index, e
 // index is suitable for queries, but not for
 // synchronizing tables.
 func OpenPartialIndex(s fs.FS, db, table string, key *blockfmt.Key) (*blockfmt.Index, error) {
-	i, _, err := openIndex(s, IndexPath(db, table), key, blockfmt.FlagSkipInputs)
+	i, _, err := openIndex(s, IndexPath(db, table), key, nil, blockfmt.FlagSkipInputs)
 	return i, err
 }
 
-func openIndex(s fs.FS, ipath string, key *blockfmt.Key, opts blockfmt.Flag) (*blockfmt.Index, fs.FileInfo, error) {
+// OpenIndexFor is equivalent to OpenIndex (or
+// OpenPartialIndex, if opts includes blockfmt.FlagSkipInputs)
+// using the key of the tenant who owns the table.
+// If the tenant has a master key (see MasterKey),
+// it is used to unseal the index and the files
+// that it references.
+func OpenIndexFor(s fs.FS, db, table string, who Tenant, opts blockfmt.Flag) (*blockfmt.Index, error) {
+	var sealer *blockfmt.Sealer
+	if mk := MasterKey(who); mk != nil {
+		sealer = &blockfmt.Sealer{Master: mk}
+	}
+	i, _, err := openIndex(s, IndexPath(db, table), who.Key(), sealer, opts)
+	return i, err
+}
+
+func openIndex(s fs.FS, ipath string, key *blockfmt.Key, sealer *blockfmt.Sealer, opts blockfmt.Flag) (*blockfmt.Index, fs.FileInfo, error) {
 	// prevent DoS: make sure index
 	// is reasonably sized
 	f, err := s.Open(ipath)
@@ -142,8 +157,16 @@ func openIndex(s fs.FS, ipath string, key *blockfmt.Key, opts blockfmt.Flag) (*b
 	if err != nil {
 		return nil, info, err
 	}
-	idx, err := blockfmt.DecodeIndex(key, buf[:n], opts)
-	return idx, info, err
+	mem, err := sealer.Unseal(ipath, buf[:n])
+	if err != nil {
+		return nil, info, err
+	}
+	idx, err := blockfmt.DecodeIndex(key, mem, opts)
+	if err != nil {
+		return nil, info, err
+	}
+	idx.SetSealer(sealer)
+	return idx, info, nil
 }
 
 // ListTables list the names of all tables in the given
@@ -15,6 +15,14 @@
 package db
 
 import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/SnellerInc/sneller/cgroup"
+	"github.com/SnellerInc/sneller/expr"
+	"github.com/SnellerInc/sneller/expr/partiql"
 	"github.com/SnellerInc/sneller/ion/blockfmt"
 )
 
@@ -49,6 +57,161 @@ type TenantConfig struct {
 	// allowed to be scanned for each query. If
 	// this is 0, there is no limit.
 	MaxScanBytes uint64
+
+	// QueryTimeout, if non-zero, is the maximum
+	// amount of time that each query may execute.
+	// Both QueryTimeout and MaxScanBytes are
+	// enforced while queries execute; see plan.Limits.
+	QueryTimeout time.Duration
+
+	// Grants is the list of tables that
+	// the tenant is allowed to query.
+	// If Grants is nil, the tenant may
+	// query every table under its root.
+	// (A non-nil, zero-length list denies
+	// access to every table.)
+	Grants []Grant
+
+	// MaxConcurrency, if non-zero, is the
+	// maximum number of queries that the
+	// tenant may execute concurrently on
+	// each query server.
+	MaxConcurrency int
+
+	// Limits, if non-nil, is the set of
+	// resource limits applied to the cgroup
+	// of the tenant's query process.
+	Limits *cgroup.Limits
+}
+
+// AuditDatabase is the database in the root
+// of each tenant to which snellerd writes the
+// audit log of the tenant's queries. Queries
+// may read from it, but not write to it.
+const AuditDatabase = "sneller_audit"
+
+// Grant grants access to a set of tables.
+type Grant struct {
+	// Database and Table are glob patterns
+	// (see path.Match) matching the database
+	// and table names covered by this grant.
+	Database string `json:"Database"`
+	Table    string `json:"Table"`
+	// Masks is the list of masking rules
+	// that apply to the rows of each table
+	// covered by this grant.
+	Masks []Mask `json:"Masks,omitempty"`
+	// Filter, if non-empty, is a PartiQL
+	// predicate that every row of a table
+	// covered by this grant must satisfy
+	// in order to be visible to the tenant
+	// (for example, "org_id = 'acme'").
+	Filter string `json:"Filter,omitempty"`
+}
+
+// RowFilter parses g.Filter and returns
+// the resulting expression, or nil if
+// g.Filter is empty.
+func (g *Grant) RowFilter() (expr.Node, error) {
+	if g.Filter == "" {
+		return nil, nil
+	}
+	q, err := partiql.Parse([]byte("SELECT * FROM t WHERE " + g.Filter))
+	if err != nil {
+		return nil, fmt.Errorf("parsing row filter %q: %w", g.Filter, err)
+	}
+	// make sure the text didn't smuggle
+	// in anything other than a predicate
+	sel, ok := q.Body.(*expr.Select)
+	if !ok || q.With != nil || q.Into != nil || q.Explain != expr.ExplainNone ||
+		sel.Where == nil || sel.GroupBy != nil || sel.Having != nil ||
+		sel.OrderBy != nil || sel.Limit != nil || sel.Offset != nil ||
+		sel.HasDistinct() {
+		return nil, fmt.Errorf("row filter %q is not a predicate", g.Filter)
+	}
+	return sel.Where, nil
+}
+
+// MaskAction is the action taken by a Mask.
+type MaskAction string
+
+const (
+	// MaskHide removes the masked field from
+	// each row, so that it is MISSING.
+	MaskHide MaskAction = "hide"
+	// MaskRedact replaces integer, float, and
+	// string values of the masked field with a
+	// keyed hash of the original value (see
+	// expr.Redact), and all other values with NULL.
+	MaskRedact MaskAction = "redact"
+	// MaskNull replaces the masked field with NULL.
+	MaskNull MaskAction = "null"
+)
+
+// Mask is a rule for masking the value
+// of a field in every row of a table.
+type Mask struct {
+	// Path is the path to the masked field,
+	// using '.' to separate path components.
+	Path   string     `json:"Path"`
+	Action MaskAction `json:"Action"`
+}
+
+// Valid returns whether m has a
+// non-empty Path and a known Action.
+func (m *Mask) Valid() bool {
+	if m.Path == "" {
+		return false
+	}
+	switch m.Action {
+	case MaskHide, MaskRedact, MaskNull:
+		return true
+	}
+	return false
+}
+
+// findMask returns the mask in masks that
+// applies to path, if any, and whether path
+// is a sub-field of the masked field rather
+// than the masked field itself. A mask of a
+// parent field takes precedence over a mask
+// of one of its sub-fields.
+func findMask(masks []Mask, path string) (*Mask, bool) {
+	var out *Mask
+	for i := range masks {
+		m := &masks[i]
+		if strings.HasPrefix(path, m.Path+".") {
+			return m, true
+		}
+		if path == m.Path && out == nil {
+			out = m
+		}
+	}
+	return out, false
+}
+
+// Access determines whether the tenant
+// may query db.table. If access is granted,
+// Access returns true along with the first
+// matching entry in c.Grants, or a nil *Grant
+// if access is unrestricted. A nil *TenantConfig
+// grants unrestricted access to every table.
+func (c *TenantConfig) Access(db, table string) (*Grant, bool) {
+	if c == nil || c.Grants == nil {
+		return nil, true
+	}
+	for i := range c.Grants {
+		g := &c.Grants[i]
+		if match(g.Database, db) && match(g.Table, table) {
+			return g, true
+		}
+	}
+	return nil, false
+}
+
+func match(pattern, name string) bool {
+	ok, err := path.Match(pattern, name)
+	return ok && err == nil
 }
 
 // TenantConfigurable is a tenant that may provide
@@ -61,3 +224,47 @@ type TenantConfigurable interface {
 	// indicate all defaults should be used.
 	Config() *TenantConfig
 }
+
+// EncryptedTenant is a tenant whose
+// packed objects are encrypted at rest.
+type EncryptedTenant interface {
+	Tenant
+
+	// MasterKey returns the key used to wrap
+	// the data key of each packed object
+	// written on behalf of this tenant.
+	// MasterKey may return nil to indicate
+	// that new objects are not encrypted.
+	MasterKey() *blockfmt.MasterKey
+}
+
+// MasterKey returns the master key of t
+// if t implements EncryptedTenant,
+// or nil otherwise.
+func MasterKey(t Tenant) *blockfmt.MasterKey {
+	if et, ok := t.(EncryptedTenant); ok {
+		return et.MasterKey()
+	}
+	return nil
+}
+
+// SubjectTenant is a tenant that knows the
+// principal (a user or a service) to which the
+// token used to authorize the tenant was issued.
+type SubjectTenant interface {
+	Tenant
+
+	// Subject returns the principal, or the empty
+	// string if the principal is not known.
+	Subject() string
+}
+
+// Subject returns the subject of t
+// if t implements SubjectTenant,
+// or the empty string otherwise.
+func Subject(t Tenant) string {
+	if st, ok := t.(SubjectTenant); ok {
+		return st.Subject()
+	}
+	return ""
+}
@@ -0,0 +1,108 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTenantConfigAccess(t *testing.T) {
+	masks := []Mask{{Path: "email", Action: MaskRedact}}
+	cfg := &TenantConfig{
+		Grants: []Grant{
+			{Database: "logs", Table: "private-*", Masks: masks},
+			{Database: "logs", Table: "*"},
+		},
+	}
+	cases := []struct {
+		cfg       *TenantConfig
+		db, table string
+		masks     []Mask
+		ok        bool
+	}{
+		{nil, "any", "table", nil, true},
+		{&TenantConfig{}, "any", "table", nil, true},
+		{&TenantConfig{Grants: []Grant{}}, "any", "table", nil, false},
+		{cfg, "logs", "private-users", masks, true},
+		{cfg, "logs", "public", nil, true},
+		{cfg, "other", "public", nil, false},
+	}
+	for i := range cases {
+		c := &cases[i]
+		g, ok := c.cfg.Access(c.db, c.table)
+		var masks []Mask
+		if g != nil {
+			masks = g.Masks
+		}
+		if ok != c.ok || !reflect.DeepEqual(masks, c.masks) {
+			t.Errorf("case %d: got (%v, %v), want (%v, %v)", i, masks, ok, c.masks, c.ok)
+		}
+	}
+}
+
+func TestMaskValid(t *testing.T) {
+	valid := []Mask{
+		{Path: "a", Action: MaskHide},
+		{Path: "a.b", Action: MaskRedact},
+		{Path: "c", Action: MaskNull},
+	}
+	for i := range valid {
+		if !valid[i].Valid() {
+			t.Errorf("%+v should be valid", valid[i])
+		}
+	}
+	invalid := []Mask{
+		{Path: "", Action: MaskHide},
+		{Path: "a", Action: "drop"},
+	}
+	for i := range invalid {
+		if invalid[i].Valid() {
+			t.Errorf("%+v should be invalid", invalid[i])
+		}
+	}
+}
+
+func TestGrantRowFilter(t *testing.T) {
+	valid := []string{
+		"org_id = 'acme'",
+		"org_id = 'acme' AND region IN ('us', 'eu')",
+	}
+	for _, text := range valid {
+		g := Grant{Filter: text}
+		e, err := g.RowFilter()
+		if err != nil {
+			t.Errorf("%q: %s", text, err)
+		} else if e == nil {
+			t.Errorf("%q: nil expression", text)
+		}
+	}
+	invalid := []string{
+		"org_id = ",
+		"TRUE ORDER BY x",
+		"TRUE LIMIT 1",
+		"TRUE GROUP BY x",
+	}
+	for _, text := range invalid {
+		g := Grant{Filter: text}
+		if _, err := g.RowFilter(); err == nil {
+			t.Errorf("%q: expected an error", text)
+		}
+	}
+	g := Grant{}
+	if e, err := g.RowFilter(); e != nil || err != nil {
+		t.Errorf("empty filter: got (%v, %v)", e, err)
+	}
+}
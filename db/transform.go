@@ -0,0 +1,273 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package db
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/SnellerInc/sneller/date"
+	"github.com/SnellerInc/sneller/expr"
+	"github.com/SnellerInc/sneller/expr/partiql"
+	"github.com/SnellerInc/sneller/ion"
+	"github.com/SnellerInc/sneller/ion/blockfmt"
+	"github.com/SnellerInc/sneller/plan/pir"
+	"github.com/SnellerInc/sneller/vm"
+)
+
+// transformTable is the name of the table
+// that Input.Transform queries refer to
+const transformTable = "input"
+
+// maxTransformDepth is the maximum depth of
+// structure fields for which the time ranges
+// of transformed rows are recorded
+const maxTransformDepth = 3
+
+// transform is a compiled Input.Transform
+type transform struct {
+	trace *pir.Trace
+}
+
+// compileTransform parses and checks the text
+// of an Input.Transform query. Only queries that
+// project and filter rows of the input table are
+// accepted, i.e. queries of the form
+//
+//	SELECT ... FROM input [AS alias] [WHERE ...]
+func compileTransform(text string) (*transform, error) {
+	q, err := partiql.Parse([]byte(text))
+	if err != nil {
+		return nil, fmt.Errorf("transform: %w", err)
+	}
+	t, err := pir.Build(q, nil)
+	if err != nil {
+		return nil, fmt.Errorf("transform: %w", err)
+	}
+	for s := t.Final(); s != nil; s = pir.Input(s) {
+		switch s := s.(type) {
+		case *pir.IterTable:
+			if !expr.IsIdentifier(s.Table.Expr, transformTable) {
+				return nil, fmt.Errorf("transform: table %s is not %q", expr.ToString(s.Table.Expr), transformTable)
+			}
+		case *pir.Bind, *pir.Filter, pir.NoOutput:
+		default:
+			return nil, fmt.Errorf("transform: unsupported operation in %q (only projection and filtering are allowed)", text)
+		}
+	}
+	return &transform{trace: t}, nil
+}
+
+// sink builds the query that writes
+// the transformed rows to dst; it returns
+// nil if the transform produces no rows
+func (t *transform) sink(dst vm.QuerySink) (vm.QuerySink, error) {
+	var err error
+	for s := t.trace.Final(); s != nil; s = pir.Input(s) {
+		switch s := s.(type) {
+		case pir.NoOutput:
+			return nil, nil
+		case *pir.Bind:
+			dst = vm.NewProjection(vm.Selection(s.Bindings()), dst)
+		case *pir.Filter:
+			dst, err = vm.NewFilter(s.Where, dst)
+		case *pir.IterTable:
+			if s.Filter != nil {
+				dst, err = vm.NewFilter(s.Filter, dst)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dst, nil
+}
+
+// transformFormat is a blockfmt.RowFormat that
+// evaluates an Input.Transform query over the
+// rows produced by another RowFormat
+//
+// The row constants are added to the rows
+// after they have been transformed, and the
+// time ranges of the transformed rows are
+// recomputed since the transform may rename,
+// derive or drop timestamp fields.
+type transformFormat struct {
+	inner blockfmt.RowFormat
+	t     *transform
+}
+
+func (f *transformFormat) Name() string { return f.inner.Name() }
+
+func (f *transformFormat) Convert(r io.Reader, dst *ion.Chunker, cons []ion.Field) error {
+	out := &transformOutput{dst: dst, cons: cons}
+	q, err := f.t.sink(out)
+	if err != nil {
+		return err
+	}
+	var w io.WriteCloser = nopCloser{io.Discard}
+	if q != nil {
+		w, err = q.Open()
+		if err != nil {
+			return err
+		}
+	}
+	align := dst.Align
+	if align > vm.PageSize {
+		align = vm.PageSize
+	}
+	page := vm.Malloc()
+	defer vm.Free(page)
+	inner := ion.Chunker{
+		W:          &vmWriter{dst: w, page: page},
+		Align:      align,
+		RangeAlign: dst.RangeAlign,
+	}
+	err = f.inner.Convert(r, &inner, nil)
+	if err == nil {
+		err = inner.Flush()
+	}
+	err2 := w.Close()
+	if q != nil {
+		if err3 := q.Close(); err2 == nil {
+			err2 = err3
+		}
+	}
+	if err == nil {
+		err = err2
+	}
+	return err
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// vmWriter copies chunks into vm memory
+// before writing them to dst
+type vmWriter struct {
+	dst  io.Writer
+	page []byte
+}
+
+func (w *vmWriter) Write(p []byte) (int, error) {
+	if len(p) > len(w.page) {
+		return 0, fmt.Errorf("chunk of %d bytes larger than page size %d", len(p), len(w.page))
+	}
+	n := copy(w.page, p)
+	_, err := w.dst.Write(w.page[:n])
+	return len(p), err
+}
+
+// transformOutput is the vm.QuerySink
+// that receives the transformed rows and
+// encodes them (along with the row constants) into dst
+type transformOutput struct {
+	dst    *ion.Chunker
+	cons   []ion.Field
+	st     ion.Symtab
+	symbuf ion.Symbuf
+	path   []ion.Symbol
+}
+
+func (o *transformOutput) Open() (io.WriteCloser, error) { return o, nil }
+
+func (o *transformOutput) Close() error { return nil }
+
+func (o *transformOutput) Write(p []byte) (int, error) {
+	n := len(p)
+	var err error
+	for len(p) > 0 {
+		if ion.IsBVM(p) || ion.TypeOf(p) == ion.AnnotationType {
+			p, err = o.st.Unmarshal(p)
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+		size := ion.SizeOf(p)
+		if size <= 0 || size > len(p) {
+			return 0, fmt.Errorf("object size %d out of range [:%d]", size, len(p))
+		}
+		// skip nop pads, etc.
+		if ion.TypeOf(p) == ion.StructType {
+			d, _, err := ion.ReadDatum(&o.st, p[:size])
+			if err != nil {
+				return 0, err
+			}
+			s, _ := d.Struct()
+			if err := o.write(s); err != nil {
+				return 0, err
+			}
+		}
+		p = p[size:]
+	}
+	return n, nil
+}
+
+func (o *transformOutput) write(s ion.Struct) error {
+	dst := o.dst
+	dst.BeginStruct(-1)
+	err := s.Each(func(f ion.Field) bool {
+		for i := range o.cons {
+			if o.cons[i].Label == f.Label {
+				return true
+			}
+		}
+		o.field(f.Label, f.Value)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for i := range o.cons {
+		o.field(o.cons[i].Label, o.cons[i].Value)
+	}
+	dst.EndStruct()
+	return dst.Commit()
+}
+
+// field encodes a field into o.dst and
+// records the time ranges of its value
+func (o *transformOutput) field(label string, v ion.Datum) {
+	sym := o.dst.Symbols.Intern(label)
+	o.dst.BeginField(sym)
+	v.Encode(&o.dst.Buffer, &o.dst.Symbols)
+	o.path = append(o.path[:0], sym)
+	o.ranges(v)
+}
+
+func (o *transformOutput) ranges(v ion.Datum) {
+	if ts, ok := v.Timestamp(); ok {
+		o.symbuf.Prepare(len(o.path))
+		for i := range o.path {
+			o.symbuf.Push(o.path[i])
+		}
+		o.dst.Ranges.AddTime(o.symbuf, date.Time(ts))
+		return
+	}
+	s, ok := v.Struct()
+	if !ok || len(o.path) >= maxTransformDepth {
+		return
+	}
+	s.Each(func(f ion.Field) bool {
+		o.path = append(o.path, o.dst.Symbols.Intern(f.Label))
+		o.ranges(f.Value)
+		o.path = o.path[:len(o.path)-1]
+		return true
+	})
+}
@@ -0,0 +1,140 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package db
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SnellerInc/sneller/date"
+	"github.com/SnellerInc/sneller/ion"
+	"github.com/SnellerInc/sneller/ion/blockfmt"
+)
+
+func TestCompileTransform(t *testing.T) {
+	good := []string{
+		"SELECT * FROM input",
+		"SELECT a, b AS c FROM input WHERE a > 0",
+		"SELECT x.a AS a FROM input AS x",
+		"SELECT a FROM input WHERE FALSE",
+	}
+	for _, text := range good {
+		if _, err := compileTransform(text); err != nil {
+			t.Errorf("%s: %s", text, err)
+		}
+	}
+	bad := []string{
+		"SELECT a FROM",
+		"SELECT a FROM other",
+		"SELECT COUNT(*) FROM input",
+		"SELECT DISTINCT a FROM input",
+		"SELECT a FROM input LIMIT 10",
+	}
+	for _, text := range bad {
+		if _, err := compileTransform(text); err == nil {
+			t.Errorf("%s: expected an error", text)
+		}
+	}
+}
+
+func TestTransformIngest(t *testing.T) {
+	checkFiles(t)
+	tmpdir := t.TempDir()
+	dfs := newDirFS(t, tmpdir)
+	owner := newTenant(dfs)
+
+	def := &Definition{
+		Name: "logs",
+		Inputs: []Input{{
+			Pattern:   "file://logs/{region}/*.json",
+			Transform: "SELECT SPLIT_PART(host, '.', 1) AS host, CAST(n AS FLOAT) AS n, ts AS time FROM input WHERE level <> 'debug'",
+		}},
+		Partitions: []Partition{{Field: "region"}},
+	}
+	bad := *def
+	bad.Inputs = []Input{{Pattern: def.Inputs[0].Pattern, Transform: "SELECT COUNT(*) FROM input"}}
+	if err := WriteDefinition(dfs, "default", &bad); err == nil {
+		t.Fatal("expected an invalid transform to be rejected")
+	}
+	if err := WriteDefinition(dfs, "default", def); err != nil {
+		t.Fatal(err)
+	}
+	text := `{"host": "a.example.com", "n": 1, "level": "info", "ts": "2022-10-01T12:00:00Z", "region": "ignored"}
+{"host": "b.example.com", "n": 2, "level": "debug", "ts": "2022-10-01T13:00:00Z"}
+{"host": "c.example.com", "n": 3, "level": "error", "ts": "2022-10-01T14:00:00Z"}
+`
+	dir := filepath.Join(tmpdir, "logs", "us-east-1")
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "0.json"), []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b := Builder{Align: 1024, Logf: t.Logf}
+	if err := b.Sync(owner, "default", "logs"); err != nil {
+		t.Fatal(err)
+	}
+	idx, err := OpenIndex(dfs, "default", "logs", owner.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Inline) != 1 {
+		t.Fatalf("expected 1 object; got %d", len(idx.Inline))
+	}
+	// statistics should cover the transformed rows
+	if n, ok := idx.Rows(); !ok || n != 2 {
+		t.Errorf("got Rows() = %d, %v", n, ok)
+	}
+	if f, ok := idx.NullFraction("level"); !ok || f != 1 {
+		t.Errorf("got NullFraction(level) = %g, %v", f, ok)
+	}
+	trailer := idx.Inline[0].Trailer
+	f, err := dfs.Open(idx.Inline[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var out strings.Builder
+	var dec blockfmt.Decoder
+	dec.Set(trailer, len(trailer.Blocks))
+	_, err = dec.Copy(ion.NewJSONWriter(&out, '\n'), io.LimitReader(f, trailer.Offset))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"host": "a", "n": 1, "time": "2022-10-01T12:00:00Z", "region": "us-east-1"}
+{"host": "c", "n": 3, "time": "2022-10-01T14:00:00Z", "region": "us-east-1"}
+`
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	// the sparse index should cover
+	// the renamed timestamp field
+	if trailer.Sparse.Get([]string{"ts"}) != nil {
+		t.Error("unexpected sparse index for ts")
+	}
+	ti := trailer.Sparse.Get([]string{"time"})
+	if ti == nil {
+		t.Fatal("no sparse index for time")
+	}
+	min, _ := ti.Min()
+	max, _ := ti.Max()
+	if !min.Equal(date.Date(2022, 10, 1, 12, 0, 0, 0)) || !max.Equal(date.Date(2022, 10, 1, 14, 0, 0, 0)) {
+		t.Errorf("unexpected time range %s to %s", min, max)
+	}
+}
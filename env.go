@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/SnellerInc/sneller/db"
 	"github.com/SnellerInc/sneller/expr"
 	"github.com/SnellerInc/sneller/expr/blob"
 	"github.com/SnellerInc/sneller/ion"
@@ -55,6 +56,14 @@ func (f *FilterHandle) Encode(dst *ion.Buffer, st *ion.Symtab) error {
 		dst.BeginField(st.Intern("all_fields"))
 		dst.WriteBool(true)
 	}
+	if len(f.Masks) > 0 {
+		dst.BeginField(st.Intern("masks"))
+		encodeMasks(dst, st, f.Masks)
+	}
+	if f.RowFilter != nil {
+		dst.BeginField(st.Intern("row_filter"))
+		f.RowFilter.Encode(dst, st)
+	}
 	dst.BeginField(st.Intern("blobs"))
 	f.Blobs.Encode(dst, st)
 	dst.EndStruct()
@@ -95,6 +104,10 @@ func (f *FilterHandle) Decode(st *ion.Symtab, mem []byte) error {
 			})
 		case "all_fields":
 			f.AllFields, mem, err = ion.ReadBool(mem)
+		case "masks":
+			f.Masks, mem, err = decodeMasks(st, mem)
+		case "row_filter":
+			f.RowFilter, mem, err = expr.Decode(st, mem)
 		default:
 			return fmt.Errorf("unrecognized filterHandle field %q", st.Get(sym))
 		}
@@ -121,6 +134,14 @@ type FilterHandle struct {
 	// Blobs is the list of blobs that make up the
 	// table this handle refers to.
 	Blobs *blob.List
+	// Masks is the list of column masks
+	// that are applied to every row in
+	// the table before it is queried.
+	Masks []db.Mask
+	// RowFilter, if non-nil, is a predicate
+	// that every row produced by the table
+	// has to satisfy (see plan.Hints.RowFilter).
+	RowFilter expr.Node
 
 	// cached result of compileFilter(Expr)
 	compiled blockfmt.Filter
@@ -136,7 +157,7 @@ func (f *FilterHandle) CompileFilter() (*blockfmt.Filter, bool) {
 	if f.Expr == nil {
 		return nil, true
 	}
-	f.compiled.Compile(f.Expr)
+	f.compiled.Compile(unmasked(f.Expr, f.Masks))
 	if f.compiled.Trivial() {
 		return nil, false
 	}
@@ -19,9 +19,12 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
+	"sort"
 
 	"github.com/SnellerInc/sneller/ion"
 	"github.com/SnellerInc/sneller/ion/blockfmt"
+
+	"golang.org/x/exp/slices"
 )
 
 // Compressed reads a blockfmt-formatted blob
@@ -72,6 +75,7 @@ func (d *blobDecoder) decodeComp(fields []byte) (*Compressed, error) {
 	c := d.compressed()
 	var err error
 	var sym ion.Symbol
+	var datakey []byte
 	st := d.td.Symbols
 	for len(fields) > 0 {
 		sym, fields, err = ion.ReadLabel(fields)
@@ -86,6 +90,8 @@ func (d *blobDecoder) decodeComp(fields []byte) (*Compressed, error) {
 			if err == nil {
 				fields = fields[ion.SizeOf(fields):]
 			}
+		case "data-key":
+			datakey, fields, err = ion.ReadBytes(fields)
 		case "etext":
 			c.etext, fields, err = ion.ReadString(fields)
 		case "skip":
@@ -108,6 +114,12 @@ func (d *blobDecoder) decodeComp(fields []byte) (*Compressed, error) {
 			return nil, fmt.Errorf("blob.Compressed decode: %w", err)
 		}
 	}
+	if datakey != nil {
+		if c.Trailer == nil || c.Trailer.Encryption == nil {
+			return nil, fmt.Errorf("blob.Compressed decode: data key without encryption")
+		}
+		c.Trailer.Encryption.DataKey = slices.Clone(datakey)
+	}
 	return c, nil
 }
 
@@ -119,6 +131,12 @@ func (c *Compressed) encode(be *blobEncoder, dst *ion.Buffer, st *ion.Symtab) {
 	be.encode(c.From, dst, st)
 	dst.BeginField(st.Intern("trailer"))
 	c.Trailer.Encode(dst, st)
+	if e := c.Trailer.Encryption; e != nil && e.DataKey != nil {
+		// the data key is not part of the trailer,
+		// so it has to be passed along separately
+		dst.BeginField(st.Intern("data-key"))
+		dst.WriteBlob(e.DataKey)
+	}
 	if c.etext != "" {
 		dst.BeginField(st.Intern("etext"))
 		dst.WriteString(c.etext)
@@ -195,6 +213,19 @@ func (c *Compressed) Decompressor() (io.ReadCloser, error) {
 	return dd, nil
 }
 
+// blockAt returns the index of the block
+// in t that starts at off, or first if
+// no block starts at off
+func blockAt(t *blockfmt.Trailer, first int, off int64) int {
+	i := sort.Search(len(t.Blocks), func(i int) bool {
+		return t.Blocks[i].Offset >= off
+	})
+	if i < len(t.Blocks) && t.Blocks[i].Offset == off {
+		return i
+	}
+	return first
+}
+
 func (c *Compressed) Reader(start, size int64) (io.ReadCloser, error) {
 	start += c.Trailer.Blocks[0].Offset
 	rd, err := c.From.Reader(start, size)
@@ -203,7 +234,7 @@ func (c *Compressed) Reader(start, size int64) (io.ReadCloser, error) {
 	}
 	cr := &compressedReader{}
 	cr.ReadCloser = rd
-	cr.dec.Set(c.Trailer, len(c.Trailer.Blocks))
+	cr.dec.SetRange(c.Trailer, blockAt(c.Trailer, 0, start), len(c.Trailer.Blocks))
 	return cr, nil
 }
 
@@ -234,7 +265,7 @@ func (c *CompressedPart) Reader(start, size int64) (io.ReadCloser, error) {
 	}
 	cr := &compressedReader{}
 	cr.ReadCloser = rd
-	cr.dec.Set(c.Parent.Trailer, c.EndBlock)
+	cr.dec.SetRange(c.Parent.Trailer, blockAt(c.Parent.Trailer, c.StartBlock, start), c.EndBlock)
 	return cr, nil
 }
 
@@ -250,7 +281,7 @@ func (c *CompressedPart) Decompressor() (io.ReadCloser, error) {
 	}
 	dd := &decompressor{}
 	dd.src = rd
-	dd.dec.Set(c.Parent.Trailer, c.EndBlock)
+	dd.dec.SetRange(c.Parent.Trailer, c.StartBlock, c.EndBlock)
 	return dd, nil
 }
 
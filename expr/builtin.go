@@ -219,6 +219,11 @@ const (
 	ToUnixEpoch
 	ToUnixMicro
 
+	AtTimeZone   // AT_TIME_ZONE(ts, zone) implements ts AT TIME ZONE zone
+	FromTimeZone // FROM_TIME_ZONE(ts, zone) is the inverse of AT_TIME_ZONE
+
+	ParseTimestamp // PARSE_TIMESTAMP(str, format, [zone])
+
 	GeoHash
 	GeoTileX
 	GeoTileY
@@ -571,6 +576,116 @@ func simplifyDateTrunc(part Timepart) func(Hint, []Node) Node {
 	}
 }
 
+// TimeZone returns the time zone
+// named by the string literal n
+func TimeZone(n Node) (*date.Zone, error) {
+	str, ok := n.(String)
+	if !ok {
+		return nil, errsyntaxf("time zone %s is not a string literal", ToString(n))
+	}
+	z, err := date.LoadZone(string(str))
+	if err != nil {
+		return nil, errsyntaxf("%s", err)
+	}
+	return z, nil
+}
+
+func checkTimeZone(h Hint, args []Node) error {
+	if len(args) != 2 {
+		return mismatch(2, len(args))
+	}
+	if !TypeOf(args[0], h).AnyOf(TimeType) {
+		return errtypef(args[0], "not compatible with type %s", TimeType)
+	}
+	_, err := TimeZone(args[1])
+	return err
+}
+
+func simplifyTimeZone(inverse bool) func(Hint, []Node) Node {
+	return func(h Hint, args []Node) Node {
+		if len(args) != 2 {
+			return nil
+		}
+		ts, ok := args[0].(*Timestamp)
+		if !ok {
+			return nil
+		}
+		z, err := TimeZone(args[1])
+		if err != nil {
+			return nil
+		}
+		if inverse {
+			return &Timestamp{Value: z.UTC(ts.Value)}
+		}
+		return &Timestamp{Value: z.Local(ts.Value)}
+	}
+}
+
+// TimeFormat returns the timestamp format
+// described by the arguments following the
+// first argument of PARSE_TIMESTAMP
+func TimeFormat(args []Node) (*date.Format, error) {
+	layout, ok := args[0].(String)
+	if !ok {
+		return nil, errsyntaxf("format %s is not a string literal", ToString(args[0]))
+	}
+	var z *date.Zone
+	if len(args) > 1 {
+		var err error
+		z, err = TimeZone(args[1])
+		if err != nil {
+			return nil, err
+		}
+	}
+	f, err := date.CompileFormat(string(layout), z)
+	if err != nil {
+		return nil, errsyntaxf("%s", err)
+	}
+	return f, nil
+}
+
+// PARSE_TIMESTAMP(str, format, [zone])
+func checkParseTimestamp(h Hint, args []Node) error {
+	if len(args) != 2 && len(args) != 3 {
+		return errsyntaxf("PARSE_TIMESTAMP expects 2 or 3 arguments, got %d", len(args))
+	}
+	if !TypeOf(args[0], h).AnyOf(StringType) {
+		return errtypef(args[0], "not compatible with type %s", StringType)
+	}
+	_, err := TimeFormat(args[1:])
+	return err
+}
+
+func simplifyParseTimestamp(h Hint, args []Node) Node {
+	if len(args) != 2 && len(args) != 3 {
+		return nil
+	}
+	str, ok := args[0].(String)
+	if !ok {
+		return nil
+	}
+	f, err := TimeFormat(args[1:])
+	if err != nil {
+		return nil
+	}
+	ts, ok := f.Parse([]byte(str))
+	if !ok {
+		return Missing{}
+	}
+	return &Timestamp{Value: ts}
+}
+
+// TIME_BUCKET(ts, interval, [zone])
+func checkTimeBucket(h Hint, args []Node) error {
+	if len(args) == 3 {
+		if _, err := TimeZone(args[2]); err != nil {
+			return err
+		}
+		args = args[:2]
+	}
+	return fixedArgs(TimeType, NumericType)(h, args)
+}
+
 func checkInSubquery(h Hint, args []Node) error {
 	if len(args) != 2 {
 		return mismatch(2, len(args))
@@ -1116,6 +1231,9 @@ var builtinInfo = [maxBuiltin]binfo{
 	DateTruncYear:          {check: fixedTime, private: true, ret: TimeType | MissingType, simplify: simplifyDateTrunc(Year)},
 	ToUnixEpoch:            {check: fixedTime, ret: IntegerType | MissingType},
 	ToUnixMicro:            {check: fixedTime, ret: IntegerType | MissingType},
+	AtTimeZone:             {check: checkTimeZone, private: true, ret: TimeType | MissingType, simplify: simplifyTimeZone(false)},
+	FromTimeZone:           {check: checkTimeZone, private: true, ret: TimeType | MissingType, simplify: simplifyTimeZone(true)},
+	ParseTimestamp:         {check: checkParseTimestamp, ret: TimeType | MissingType, simplify: simplifyParseTimestamp},
 
 	GeoHash:     {check: fixedArgs(NumericType, NumericType, IntegerType), ret: StringType | MissingType},
 	GeoTileX:    {check: fixedArgs(NumericType, IntegerType), ret: StringType | MissingType},
@@ -1133,7 +1251,7 @@ var builtinInfo = [maxBuiltin]binfo{
 	ListReplacement:   {check: checkScalarReplacement, private: true, ret: ListType},
 	StructReplacement: {check: checkScalarReplacement, private: true, ret: StructType},
 
-	TimeBucket: {check: fixedArgs(TimeType, NumericType), ret: NumericType | MissingType},
+	TimeBucket: {check: checkTimeBucket, ret: NumericType | MissingType},
 
 	MakeList:   {ret: ListType, private: true, text: makeListText, simplify: simplifyMakeList},
 	MakeStruct: {ret: StructType, private: true, text: makeStructText, simplify: simplifyMakeStruct},
@@ -2,7 +2,7 @@ package expr
 
 // Code generated automatically; DO NOT EDIT
 
-var builtin2Name = [114]string{
+var builtin2Name = [117]string{
 	"CONCAT",                   // Concat
 	"TRIM",                     // Trim
 	"LTRIM",                    // Ltrim
@@ -97,6 +97,9 @@ var builtin2Name = [114]string{
 	"DATE_TRUNC_YEAR",          // DateTruncYear
 	"TO_UNIX_EPOCH",            // ToUnixEpoch
 	"TO_UNIX_MICRO",            // ToUnixMicro
+	"AT_TIME_ZONE",             // AtTimeZone
+	"FROM_TIME_ZONE",           // FromTimeZone
+	"PARSE_TIMESTAMP",          // ParseTimestamp
 	"GEO_HASH",                 // GeoHash
 	"GEO_TILE_X",               // GeoTileX
 	"GEO_TILE_Y",               // GeoTileY
@@ -315,6 +318,12 @@ func name2Builtin(s string) BuiltinOp {
 		return ToUnixEpoch
 	case "TO_UNIX_MICRO":
 		return ToUnixMicro
+	case "AT_TIME_ZONE":
+		return AtTimeZone
+	case "FROM_TIME_ZONE":
+		return FromTimeZone
+	case "PARSE_TIMESTAMP":
+		return ParseTimestamp
 	case "GEO_HASH":
 		return GeoHash
 	case "GEO_TILE_X":
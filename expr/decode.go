@@ -124,6 +124,8 @@ func getEmpty(name string) composite {
 		return (*Rational)(new(big.Rat))
 	case "star":
 		return Star{}
+	case "param":
+		return &Param{}
 	case "path":
 		return &Path{}
 	case "cmp":
@@ -3180,6 +3180,22 @@ func DateTruncWeekday(from Node, dow Weekday) Node {
 	return Call(DateTruncDOW, from, Integer(dow))
 }
 
+// DateTruncZone is like DateTrunc, but
+// the timestamp is truncated according to
+// the wall-clock time in the given time zone
+func DateTruncZone(part Timepart, from Node, zone string) Node {
+	local := Call(AtTimeZone, from, String(zone))
+	return Call(FromTimeZone, DateTrunc(part, local), String(zone))
+}
+
+// DateTruncWeekdayZone is like DateTruncWeekday, but
+// the timestamp is truncated according to the
+// wall-clock time in the given time zone
+func DateTruncWeekdayZone(from Node, dow Weekday, zone string) Node {
+	local := Call(AtTimeZone, from, String(zone))
+	return Call(FromTimeZone, DateTruncWeekday(local, dow), String(zone))
+}
+
 // Field is a field in a Struct literal,
 type Field struct {
 	// Label is the label for the field
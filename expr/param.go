@@ -0,0 +1,300 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package expr
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SnellerInc/sneller/ion"
+)
+
+// Param is a query parameter placeholder;
+// either a positional parameter (?) or
+// a named parameter ($name).
+//
+// Parameters must be replaced with constants
+// using Query.Bind before a query is checked,
+// unless the Hint supplied to CheckHint is
+// an UnboundHint that permits them.
+type Param struct {
+	// Index is the 1-based position of a
+	// positional parameter in the query text,
+	// or 0 if the parameter is named.
+	Index int
+	// Name is the name of a named parameter.
+	Name string
+}
+
+func (p *Param) text(dst *strings.Builder, redact bool) {
+	if p.Name == "" {
+		dst.WriteString("?")
+		return
+	}
+	dst.WriteString("$")
+	dst.WriteString(p.Name)
+}
+
+func (p *Param) describe() string {
+	if p.Name == "" {
+		return fmt.Sprintf("parameter %d", p.Index)
+	}
+	return fmt.Sprintf("parameter $%s", p.Name)
+}
+
+func (p *Param) Equals(e Node) bool {
+	o, ok := e.(*Param)
+	return ok && *o == *p
+}
+
+func (p *Param) walk(v Visitor) {}
+
+func (p *Param) check(h Hint) error {
+	if u, ok := h.(UnboundHint); ok && u.AllowUnbound() {
+		return nil
+	}
+	return errsyntax(p, "unbound "+p.describe())
+}
+
+// UnboundHint may be implemented by a Hint
+// passed to CheckHint in order to check a
+// query before its parameters are bound.
+type UnboundHint interface {
+	Hint
+	// AllowUnbound returns true if
+	// unbound parameters are permitted.
+	AllowUnbound() bool
+}
+
+func (p *Param) Encode(dst *ion.Buffer, st *ion.Symtab) {
+	dst.BeginStruct(-1)
+	settype(dst, st, "param")
+	if p.Name != "" {
+		dst.BeginField(st.Intern("name"))
+		dst.WriteString(p.Name)
+	} else {
+		dst.BeginField(st.Intern("index"))
+		dst.WriteInt(int64(p.Index))
+	}
+	dst.EndStruct()
+}
+
+func (p *Param) setfield(name string, st *ion.Symtab, body []byte) error {
+	var err error
+	switch name {
+	case "name":
+		p.Name, _, err = ion.ReadString(body)
+	case "index":
+		var i int64
+		i, _, err = ion.ReadInt(body)
+		p.Index = int(i)
+	default:
+		return errUnexpectedField
+	}
+	return err
+}
+
+// Bindings are the values bound
+// to the parameters of a query.
+type Bindings struct {
+	// Positional holds the values of
+	// the positional parameters in order.
+	Positional []Constant
+	// Named holds the values of
+	// the named parameters.
+	Named map[string]Constant
+}
+
+// NewBindings creates Bindings from an ion
+// datum. A list is interpreted as a list of
+// positional parameters, and a struct is
+// interpreted as a set of named parameters.
+func NewBindings(d ion.Datum) (*Bindings, error) {
+	b := &Bindings{}
+	switch d.Type() {
+	case ion.ListType:
+		lst, _ := d.List()
+		var bad ion.Datum
+		err := lst.Each(func(d ion.Datum) bool {
+			c, ok := AsConstant(d)
+			if !ok {
+				bad = d
+				return false
+			}
+			b.Positional = append(b.Positional, c)
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !bad.Empty() {
+			return nil, fmt.Errorf("cannot use parameter %d of type %s", len(b.Positional)+1, bad.Type())
+		}
+	case ion.StructType:
+		s, _ := d.Struct()
+		b.Named = make(map[string]Constant, s.Len())
+		var bad ion.Field
+		err := s.Each(func(f ion.Field) bool {
+			c, ok := AsConstant(f.Value)
+			if !ok {
+				bad = f
+				return false
+			}
+			b.Named[f.Label] = c
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !bad.Value.Empty() {
+			return nil, fmt.Errorf("cannot use parameter $%s of type %s", bad.Label, bad.Value.Type())
+		}
+	default:
+		return nil, fmt.Errorf("parameters must be a list or a struct, not %s", d.Type())
+	}
+	return b, nil
+}
+
+type paramVisitor func(*Param)
+
+func (v paramVisitor) Visit(e Node) Visitor {
+	if p, ok := e.(*Param); ok {
+		v(p)
+	}
+	return v
+}
+
+func (q *Query) walkParams(fn func(*Param)) {
+	v := paramVisitor(fn)
+	for i := range q.With {
+		Walk(v, q.With[i].As)
+	}
+	Walk(v, q.Body)
+}
+
+// Params returns the parameters referenced
+// by the query in the order in which they
+// first appear. Each named parameter is
+// returned only once.
+func (q *Query) Params() []*Param {
+	var out []*Param
+	seen := make(map[Param]bool)
+	q.walkParams(func(p *Param) {
+		if !seen[*p] {
+			seen[*p] = true
+			out = append(out, p)
+		}
+	})
+	return out
+}
+
+type paramBinder struct {
+	b   *Bindings
+	err error
+}
+
+func (p *paramBinder) Walk(Node) Rewriter { return p }
+
+func (p *paramBinder) Rewrite(e Node) Node {
+	par, ok := e.(*Param)
+	if !ok {
+		return e
+	}
+	var c Constant
+	if par.Name != "" {
+		c, ok = p.b.Named[par.Name]
+	} else if ok = par.Index > 0 && par.Index <= len(p.b.Positional); ok {
+		c = p.b.Positional[par.Index-1]
+	}
+	if !ok {
+		if p.err == nil {
+			p.err = errsyntax(par, "no value for "+par.describe())
+		}
+		return e
+	}
+	return Copy(c)
+}
+
+// Bind returns a copy of q with each
+// parameter replaced with its value in b.
+// The query q itself is not modified,
+// so it may be bound more than once.
+//
+// Bind returns an error if a parameter
+// has no value in b or if b contains
+// values that are not referenced by q.
+func (q *Query) Bind(b *Bindings) (*Query, error) {
+	if err := b.Check(q.Params()); err != nil {
+		return nil, err
+	}
+	out := *q
+	rw := &paramBinder{b: b}
+	if q.With != nil {
+		out.With = make([]CTE, len(q.With))
+		for i := range q.With {
+			out.With[i].Table = q.With[i].Table
+			out.With[i].As = Rewrite(rw, Copy(q.With[i].As)).(*Select)
+		}
+	}
+	out.Body = Rewrite(rw, Copy(q.Body))
+	if rw.err != nil {
+		return nil, rw.err
+	}
+	return &out, nil
+}
+
+// Check returns an error if a parameter in
+// params has no value in b or if b contains
+// values for parameters that are not in params.
+func (b *Bindings) Check(params []*Param) error {
+	positional := 0
+	for _, p := range params {
+		if p.Name == "" {
+			positional++
+		} else if _, ok := b.Named[p.Name]; !ok {
+			return errsyntax(p, "no value for "+p.describe())
+		}
+	}
+	if len(b.Positional) != positional {
+		return errsyntaxf("query has %d positional parameters but %d values were given", positional, len(b.Positional))
+	}
+	if len(b.Named) > len(params)-positional {
+		for name := range b.Named {
+			if !hasNamed(params, name) {
+				return errsyntaxf("query has no parameter $%s", name)
+			}
+		}
+	}
+	return nil
+}
+
+// Bind replaces each parameter in e with
+// its value in b. Like Rewrite, Bind may
+// modify e in place, so callers that need
+// to preserve e should bind a Copy of it.
+func (b *Bindings) Bind(e Node) (Node, error) {
+	rw := &paramBinder{b: b}
+	e = Rewrite(rw, e)
+	return e, rw.err
+}
+
+func hasNamed(params []*Param, name string) bool {
+	for _, p := range params {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -45,6 +45,19 @@ type scanner struct {
 	notkw bool
 	// the last symbol returned by `Lex`
 	lastsym int
+	// create is set when the query begins
+	// with CREATE [OR REPLACE] TABLE, so the
+	// AS following the table name is followed
+	// by a keyword rather than an identifier
+	create bool
+	// body is set once the SELECT or WITH
+	// that begins the body of the query is seen
+	body bool
+	// positional is the number of positional
+	// parameters (?) seen so far, and named is
+	// set once a named parameter ($name) is seen
+	positional int
+	named      bool
 
 	// value of UTCNOW(); populated lazily
 	// (we need every instance of UTCNOW()
@@ -230,6 +243,8 @@ func (s *scanner) lex(l *yySymType) int {
 		s.notkw = false
 		s.pos++
 		return int(b)
+	case '?', '$':
+		return s.lexParam(l)
 	case '~':
 		switch s.peekat(1) {
 		case '*':
@@ -280,9 +295,14 @@ func (s *scanner) lexIdent(l *yySymType) int {
 		// don't perform string allocation if we have a keyword
 		term := lookupKeyword(s.from[startpos:s.pos])
 		if term != -1 {
+			if term == SELECT || term == WITH {
+				s.body = true
+			}
 			// following AS or BY, interpret the
 			// next word as a case-sensitive identifier
-			if term == AS {
+			if term == AS && s.create {
+				s.create = false
+			} else if term == AS {
 				s.chompws()
 				s.notkw = true
 			}
@@ -296,9 +316,47 @@ func (s *scanner) lexIdent(l *yySymType) int {
 	}
 	s.notkw = s.notkw || !wordend
 	l.str = string(s.from[startpos:s.pos])
+	if !s.body && bytes.EqualFold(s.from[startpos:s.pos], []byte("CREATE")) {
+		s.create = true
+	}
 	return ID
 }
 
+// lexParam lexes a positional (?) or
+// named ($name) query parameter
+func (s *scanner) lexParam(l *yySymType) int {
+	startpos := s.pos
+	s.notkw = false
+	s.pos++
+	if s.from[startpos] == '?' {
+		s.positional++
+		l.expr = &expr.Param{Index: s.positional}
+	} else {
+		for s.pos < len(s.from) && isident(s.from[s.pos]) {
+			s.pos++
+		}
+		if s.pos == startpos+1 {
+			s.err = &LexerError{
+				Position: startpos,
+				Length:   1,
+				Message:  "expected a parameter name following '$'",
+			}
+			return ERROR
+		}
+		s.named = true
+		l.expr = &expr.Param{Name: string(s.from[startpos+1 : s.pos])}
+	}
+	if s.named && s.positional > 0 {
+		s.err = &LexerError{
+			Position: startpos,
+			Length:   s.pos - startpos,
+			Message:  "cannot mix positional and named parameters",
+		}
+		return ERROR
+	}
+	return PARAM
+}
+
 // lexNumber lexes a number-like thing
 // (NOTE: this is too permissive; we do the actual
 // checking for valid numbers at parse time)
@@ -275,16 +275,59 @@ func buildUnion(n expr.Node, unions []unionItem) expr.Node {
 	}
 }
 
-func buildQuery(explain string, with []expr.CTE, selinto selectWithInto, unions []unionItem) (*expr.Query, error) {
-	exp, err := parseExplain(explain)
+// explainClause is the EXPLAIN [ANALYZE] [AS format]
+// clause of a query
+type explainClause struct {
+	format  string
+	analyze bool
+}
+
+// dmlClause is the INSERT INTO table or
+// CREATE [OR REPLACE] TABLE table AS
+// prefix of a query
+type dmlClause struct {
+	verb  []string
+	table expr.Node
+}
+
+func (d *dmlClause) mode() (expr.IntoMode, error) {
+	verb := strings.ToUpper(strings.Join(d.verb, " "))
+	switch verb {
+	case "INSERT":
+		return expr.IntoInsert, nil
+	case "CREATE TABLE":
+		return expr.IntoCreate, nil
+	case "CREATE OR REPLACE TABLE":
+		return expr.IntoReplace, nil
+	}
+	return expr.IntoNew, fmt.Errorf("unexpected %q", verb)
+}
+
+func buildQuery(explain explainClause, dml dmlClause, with []expr.CTE, selinto selectWithInto, unions []unionItem) (*expr.Query, error) {
+	exp, err := parseExplain(explain.format)
 	if err != nil {
 		return nil, err
 	}
 
-	return &expr.Query{
+	q := &expr.Query{
 		Explain: exp,
+		Analyze: explain.analyze,
 		With:    with,
 		Into:    selinto.into,
 		Body:    buildUnion(selinto.sel, unions),
-	}, nil
+	}
+	if dml.table != nil {
+		q.IntoMode, err = dml.mode()
+		if err != nil {
+			return nil, err
+		}
+		if q.Into != nil {
+			return nil, fmt.Errorf("%s cannot be combined with SELECT ... INTO", q.IntoMode)
+		}
+		if len(unions) > 0 {
+			return nil, fmt.Errorf("%s cannot be combined with UNION", q.IntoMode)
+		}
+		q.Into = dml.table
+	}
+	return q, nil
 }
@@ -15,6 +15,7 @@
 package partiql
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"testing"
@@ -71,6 +72,11 @@ var sameq = []string{
 	"WITH foo AS (SELECT x, y FROM table), bar AS (SELECT z, a FROM table) SELECT x FROM foo CROSS JOIN bar",
 	"SELECT * FROM (t1 ++ t2 ++ t3)",
 	"SELECT x, y INTO db.xyz FROM db.foo WHERE x = 'foo' AND y = 'bar'",
+	"INSERT INTO db.xyz SELECT x, y FROM db.foo WHERE x = 'foo'",
+	"CREATE TABLE db.xyz AS SELECT x, COUNT(*) FROM db.foo GROUP BY x",
+	"CREATE OR REPLACE TABLE db.xyz AS WITH foo AS (SELECT x FROM db.foo) SELECT x FROM foo",
+	"EXPLAIN INSERT INTO db.xyz SELECT * FROM db.foo",
+	"SELECT REPLACE(x, 'a', 'b') AS table, create FROM db.foo",
 	"SELECT x, SUM(x) OVER (PARTITION BY y, z ORDER BY col0 ASC NULLS FIRST, col1 DESC NULLS FIRST) FROM db.foo",
 	"SELECT COUNT(*) FROM table",
 	"SELECT COUNT(*) AS total, COUNT(x) FILTER (WHERE x > 0) AS greater FROM table",
@@ -95,6 +101,8 @@ var sameq = []string{
 	`SELECT * FROM table1 UNION SELECT * FROM table2`,
 	`SELECT * FROM table1 UNION ALL SELECT * FROM table2`,
 	`SELECT * FROM table1 UNION SELECT * FROM table2 UNION ALL SELECT * FROM table3 UNION SELECT * FROM table4`,
+	`SELECT x FROM table WHERE y = ? AND z < ? AND w = ?`,
+	`SELECT x, $name AS y FROM table WHERE z = $name OR w > $min`,
 }
 
 func TestParseSFW(t *testing.T) {
@@ -233,6 +241,22 @@ func TestParseNormalization(t *testing.T) {
 			"SELECT DATE_TRUNC(minute, UTCNOW()) FROM foo",
 			"SELECT `2006-01-02T15:04:00Z` FROM foo",
 		},
+		{
+			"SELECT x AT TIME ZONE 'Europe/Berlin' FROM foo",
+			`SELECT AT_TIME_ZONE(x, 'Europe\/Berlin') FROM foo`,
+		},
+		{
+			"SELECT EXTRACT(hour FROM x, 'Europe/Berlin') FROM foo",
+			`SELECT DATE_EXTRACT_HOUR(AT_TIME_ZONE(x, 'Europe\/Berlin')) FROM foo`,
+		},
+		{
+			"SELECT DATE_TRUNC(day, x, 'Europe/Berlin') FROM foo",
+			`SELECT FROM_TIME_ZONE(DATE_TRUNC_DAY(AT_TIME_ZONE(x, 'Europe\/Berlin')), 'Europe\/Berlin') FROM foo`,
+		},
+		{
+			"SELECT DATE_TRUNC(month, UTCNOW(), 'America/New_York') FROM foo",
+			"SELECT `2006-01-01T05:00:00Z` FROM foo",
+		},
 		{
 			"SELECT * FROM foo WHERE x IN (SELECT COUNT(x) FROM foo ORDER BY COUNT(x) DESC NULLS FIRST LIMIT 5)",
 			"SELECT * FROM foo WHERE IN_SUBQUERY(x, (SELECT COUNT(x) FROM foo ORDER BY COUNT(x) DESC NULLS FIRST LIMIT 5))",
@@ -402,6 +426,22 @@ func TestParseErrors(t *testing.T) {
 			query: `SELECT AVG(DISTINCT x)`,
 			msg:   `cannot use DISTINCT with AVG`,
 		},
+		{
+			query: `UPSERT INTO db.t SELECT * FROM db.u`,
+			msg:   `unexpected "UPSERT"`,
+		},
+		{
+			query: `CREATE VIEW db.t AS SELECT * FROM db.u`,
+			msg:   `unexpected "CREATE VIEW"`,
+		},
+		{
+			query: `INSERT INTO db.t SELECT * INTO db.v FROM db.u`,
+			msg:   `INSERT INTO cannot be combined with SELECT ... INTO`,
+		},
+		{
+			query: `CREATE TABLE db.t AS SELECT x FROM db.u UNION ALL SELECT x FROM db.v`,
+			msg:   `CREATE TABLE cannot be combined with UNION`,
+		},
 		{
 			query: `SELECT BOOL_OR(DISTINCT x)`,
 			msg:   `cannot use DISTINCT with BOOL_OR`,
@@ -490,6 +530,14 @@ func TestParseErrors(t *testing.T) {
 			query: `SELECT 1e---5`,
 			msg:   `strconv.ParseFloat: parsing "1e-": invalid syntax`,
 		},
+		{
+			query: `SELECT x FROM table WHERE y = ? AND z = $z`,
+			msg:   `cannot mix positional and named parameters`,
+		},
+		{
+			query: `SELECT x FROM table WHERE y = $`,
+			msg:   `expected a parameter name`,
+		},
 	}
 
 	for i := range testcases {
@@ -512,6 +560,85 @@ func TestParseErrors(t *testing.T) {
 	}
 }
 
+func TestParseParams(t *testing.T) {
+	testcases := []struct {
+		query string
+		args  string
+		want  string
+	}{
+		{
+			query: `SELECT x FROM table WHERE y = ? AND z < ? AND w = ?`,
+			args:  `[1, "two", {"a": 3}]`,
+			want:  `SELECT x FROM table WHERE y = 1 AND z < 'two' AND w = {'a': 3}`,
+		},
+		{
+			query: `WITH t AS (SELECT * FROM table WHERE a = $a) SELECT x, $b AS b FROM t WHERE y = $a`,
+			args:  `{"a": "x'y", "b": 2.5}`,
+			want:  `WITH t AS (SELECT * FROM table WHERE a = 'x\'y') SELECT x, 2.5 AS b FROM t WHERE y = 'x\'y'`,
+		},
+		{
+			query: `SELECT x FROM table WHERE y = '?' AND z = ?`,
+			args:  `[null]`,
+			want:  `SELECT x FROM table WHERE y = '?' AND z = NULL`,
+		},
+	}
+	for i := range testcases {
+		tc := testcases[i]
+		t.Run(fmt.Sprintf("case-%d", i), func(t *testing.T) {
+			q, err := Parse([]byte(tc.query))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q.Check() == nil {
+				t.Fatal("unbound query passed Check")
+			}
+			var st ion.Symtab
+			d, err := ion.FromJSON(&st, json.NewDecoder(strings.NewReader(tc.args)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := expr.NewBindings(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bound, err := q.Bind(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := bound.Check(); err != nil {
+				t.Fatal(err)
+			}
+			if got := bound.Text(); got != tc.want {
+				t.Errorf("got  %s", got)
+				t.Errorf("want %s", tc.want)
+			}
+			if q.Text() != tc.query {
+				t.Errorf("Bind modified the query: %s", q.Text())
+			}
+		})
+	}
+
+	q, err := Parse([]byte(`SELECT x FROM table WHERE y = ? AND z = ?`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = q.Bind(&expr.Bindings{Positional: []expr.Constant{expr.Integer(1)}})
+	if err == nil {
+		t.Error("expected an error binding too few parameters")
+	}
+	q, err = Parse([]byte(`SELECT x FROM table WHERE y = $y`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = q.Bind(&expr.Bindings{Named: map[string]expr.Constant{
+		"y": expr.Integer(1),
+		"z": expr.Integer(2),
+	}})
+	if err == nil {
+		t.Error("expected an error binding an unknown parameter")
+	}
+}
+
 func testEquivalence(t *testing.T, e expr.Node) {
 	var obuf ion.Buffer
 	var st ion.Symtab
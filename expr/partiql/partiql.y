@@ -36,6 +36,8 @@ import (
 %}
 
 %union {
+    explain  explainClause
+    dml      dmlClause
     bytes    []byte
     str      string
     yesno    bool
@@ -60,7 +62,7 @@ import (
 
 %token ERROR EOF
 %left UNION
-%token SELECT FROM WHERE GROUP ORDER BY HAVING LIMIT OFFSET WITH INTO EXPLAIN
+%token SELECT FROM WHERE GROUP ORDER BY HAVING LIMIT OFFSET WITH INTO EXPLAIN ANALYZE
 %token DISTINCT ALL AS EXISTS NULLS FIRST LAST ASC DESC UNPIVOT AT
 %token PARTITION
 %token VALUE
@@ -89,10 +91,11 @@ import (
 %left <empty> '+' '-'
 %left <empty> '*' '/' '%'
 %left <empty> CONCAT APPEND
+%left AT
 %left NEGATION_PRECEDENCE
 %nonassoc <empty> '.'
 
-%token <expr> NUMBER ION
+%token <expr> NUMBER ION PARAM
 %token <str> STRING
 
 %type <query> query
@@ -119,16 +122,18 @@ import (
 %type <limbs> case_limbs
 %type <wind> maybe_window
 %type <integer> trim_type
-%type <str> maybe_explain
+%type <explain> maybe_explain
+%type <dml> maybe_dml
+%type <yesno> maybe_analyze
 %type <unions> maybe_union
 %start query
 
 %%
 
 query:
-maybe_explain maybe_cte_bindings select_with_into_stmt maybe_union
+maybe_explain maybe_dml maybe_cte_bindings select_with_into_stmt maybe_union
 {
-  query, err := buildQuery($1, $2, $3, $4)
+  query, err := buildQuery($1, $2, $3, $4, $5)
   if err != nil {
     yylex.Error(err.Error())
   }
@@ -152,9 +157,22 @@ SELECT maybe_toplevel_distinct binding_list from_expr where_expr group_expr havi
 }
 
 maybe_explain:
-  EXPLAIN               { $$ = "default" }
-| EXPLAIN AS identifier { $$ = $3 }
-|                       { $$ = "" }
+  EXPLAIN maybe_analyze               { $$ = explainClause{format: "default", analyze: $2} }
+| EXPLAIN maybe_analyze AS identifier { $$ = explainClause{format: $4, analyze: $2} }
+|                                     { $$ = explainClause{} }
+
+maybe_analyze:
+ANALYZE { $$ = true } | { $$ = false }
+
+// INSERT, CREATE, REPLACE and TABLE are
+// matched as identifiers rather than keywords
+// so that they remain usable as field names
+// (and REPLACE as a function name)
+maybe_dml:
+  ID INTO path_expression              { $$ = dmlClause{verb: []string{$1}, table: $3} }
+| ID ID path_expression AS             { $$ = dmlClause{verb: []string{$1, $2}, table: $3} }
+| ID OR ID ID path_expression AS       { $$ = dmlClause{verb: []string{$1, "OR", $3, $4}, table: $5} }
+|                                      { $$ = dmlClause{} }
 
 maybe_into:
 INTO path_expression { $$ = $2 } | { $$ = nil }
@@ -199,6 +217,7 @@ NULL { $$ = expr.Null{} } |
 MISSING { $$ = expr.Missing{} } |
 STRING { $$ = expr.String($1) } |
 ION { $$ = $1 } |
+PARAM { $$ = $1 } |
 path_expression { $$ = $1 }
 
 // datum_or_parens is guaranteed to
@@ -318,6 +337,22 @@ datum_or_parens
   }
   $$ = expr.DateTrunc(part, $5)
 }
+| DATE_TRUNC '(' ID '(' ID ')' ',' expr ',' STRING ')'
+{
+  dow, ok := weekday($5)
+  if strings.ToUpper($3) != "WEEK" || !ok {
+    yylex.Error(__yyfmt__.Sprintf("bad DATE_TRUNC part %q(%q)", $3, $5))
+  }
+  $$ = expr.DateTruncWeekdayZone($8, dow, $10)
+}
+| DATE_TRUNC '(' ID ',' expr ',' STRING ')'
+{
+  part, ok := timePartFor($3, "DATE_TRUNC")
+  if !ok {
+    yylex.Error(__yyfmt__.Sprintf("bad DATE_TRUNC part %q", $3))
+  }
+  $$ = expr.DateTruncZone(part, $5, $7)
+}
 | EXTRACT '(' ID FROM expr ')'
 {
   part, ok := timePartFor($3, "EXTRACT")
@@ -326,6 +361,21 @@ datum_or_parens
   }
   $$ = expr.DateExtract(part, $5)
 }
+| EXTRACT '(' ID FROM expr ',' STRING ')'
+{
+  part, ok := timePartFor($3, "EXTRACT")
+  if !ok {
+    yylex.Error(__yyfmt__.Sprintf("bad EXTRACT part %q", $3))
+  }
+  $$ = expr.DateExtract(part, expr.Call(expr.AtTimeZone, $5, expr.String($7)))
+}
+| expr AT ID ID STRING
+{
+  if !strings.EqualFold($3, "TIME") || !strings.EqualFold($4, "ZONE") {
+    yylex.Error(__yyfmt__.Sprintf("unexpected %s %s after AT", $3, $4))
+  }
+  $$ = expr.Call(expr.AtTimeZone, $1, expr.String($5))
+}
 | UTCNOW '(' ')'
 {
   $$ = yylex.(*scanner).utcnow()
@@ -737,8 +787,11 @@ UNPIVOT unpivot_source AT identifier AS identifier { /*Cloning, as the buffer ge
 UNPIVOT unpivot_source AS identifier { /*Cloning, as the buffer gets overwritten*/ as := $4; $$ = &expr.Unpivot{ TupleRef: $2, As: &as, At: nil } } |
 UNPIVOT unpivot_source AT identifier { /*Cloning, as the buffer gets overwritten*/ at := $4; $$ = &expr.Unpivot{ TupleRef: $2, As: nil, At: &at } }
 
+// the precedence of this rule is higher than that
+// of AT so that UNPIVOT x AT y is not parsed
+// as the beginning of x AT TIME ZONE ...
 unpivot_source:
-expr { $$ = &expr.Table{Binding: expr.Bind($1, "")} }
+expr %prec NEGATION_PRECEDENCE { $$ = &expr.Table{Binding: expr.Bind($1, "")} }
 
 explicit_struct_definition:
 '{' field_value_list '}' { $$ = expr.Call(expr.MakeStruct, $2...) }
@@ -100,6 +100,7 @@ func init() {
 		{"TRAILING", TRAILING},
 		{"BOTH", BOTH},
 		{"EXPLAIN", EXPLAIN},
+		{"ANALYZE", ANALYZE},
 		{"ESCAPE", ESCAPE},
 	} {
 		code, ok := wordcode([]byte(pair.name))
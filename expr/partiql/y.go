@@ -27,6 +27,8 @@ import (
 //line partiql.y:38
 type yySymType struct {
 	yys      int
+	explain  explainClause
+	dml      dmlClause
 	bytes    []byte
 	str      string
 	yesno    bool
@@ -64,82 +66,84 @@ const OFFSET = 57357
 const WITH = 57358
 const INTO = 57359
 const EXPLAIN = 57360
-const DISTINCT = 57361
-const ALL = 57362
-const AS = 57363
-const EXISTS = 57364
-const NULLS = 57365
-const FIRST = 57366
-const LAST = 57367
-const ASC = 57368
-const DESC = 57369
-const UNPIVOT = 57370
-const AT = 57371
-const PARTITION = 57372
-const VALUE = 57373
-const LEADING = 57374
-const TRAILING = 57375
-const BOTH = 57376
-const COALESCE = 57377
-const NULLIF = 57378
-const EXTRACT = 57379
-const DATE_TRUNC = 57380
-const CAST = 57381
-const UTCNOW = 57382
-const DATE_ADD = 57383
-const DATE_DIFF = 57384
-const EARLIEST = 57385
-const LATEST = 57386
-const JOIN = 57387
-const LEFT = 57388
-const RIGHT = 57389
-const CROSS = 57390
-const INNER = 57391
-const OUTER = 57392
-const FULL = 57393
-const ON = 57394
-const APPROX_COUNT_DISTINCT = 57395
-const AGGREGATE = 57396
-const ID = 57397
-const NULL = 57398
-const TRUE = 57399
-const FALSE = 57400
-const MISSING = 57401
-const OR = 57402
-const AND = 57403
-const NOT = 57404
-const BETWEEN = 57405
-const CASE = 57406
-const WHEN = 57407
-const THEN = 57408
-const ELSE = 57409
-const END = 57410
-const TO = 57411
-const TRIM = 57412
-const EQ = 57413
-const NE = 57414
-const LT = 57415
-const LE = 57416
-const GT = 57417
-const GE = 57418
-const SIMILAR = 57419
-const REGEXP_MATCH_CI = 57420
-const ILIKE = 57421
-const LIKE = 57422
-const IN = 57423
-const IS = 57424
-const OVER = 57425
-const FILTER = 57426
-const ESCAPE = 57427
-const SHIFT_LEFT_LOGICAL = 57428
-const SHIFT_RIGHT_ARITHMETIC = 57429
-const SHIFT_RIGHT_LOGICAL = 57430
-const CONCAT = 57431
-const APPEND = 57432
-const NEGATION_PRECEDENCE = 57433
-const NUMBER = 57434
-const ION = 57435
-const STRING = 57436
+const ANALYZE = 57361
+const DISTINCT = 57362
+const ALL = 57363
+const AS = 57364
+const EXISTS = 57365
+const NULLS = 57366
+const FIRST = 57367
+const LAST = 57368
+const ASC = 57369
+const DESC = 57370
+const UNPIVOT = 57371
+const AT = 57372
+const PARTITION = 57373
+const VALUE = 57374
+const LEADING = 57375
+const TRAILING = 57376
+const BOTH = 57377
+const COALESCE = 57378
+const NULLIF = 57379
+const EXTRACT = 57380
+const DATE_TRUNC = 57381
+const CAST = 57382
+const UTCNOW = 57383
+const DATE_ADD = 57384
+const DATE_DIFF = 57385
+const EARLIEST = 57386
+const LATEST = 57387
+const JOIN = 57388
+const LEFT = 57389
+const RIGHT = 57390
+const CROSS = 57391
+const INNER = 57392
+const OUTER = 57393
+const FULL = 57394
+const ON = 57395
+const APPROX_COUNT_DISTINCT = 57396
+const AGGREGATE = 57397
+const ID = 57398
+const NULL = 57399
+const TRUE = 57400
+const FALSE = 57401
+const MISSING = 57402
+const OR = 57403
+const AND = 57404
+const NOT = 57405
+const BETWEEN = 57406
+const CASE = 57407
+const WHEN = 57408
+const THEN = 57409
+const ELSE = 57410
+const END = 57411
+const TO = 57412
+const TRIM = 57413
+const EQ = 57414
+const NE = 57415
+const LT = 57416
+const LE = 57417
+const GT = 57418
+const GE = 57419
+const SIMILAR = 57420
+const REGEXP_MATCH_CI = 57421
+const ILIKE = 57422
+const LIKE = 57423
+const IN = 57424
+const IS = 57425
+const OVER = 57426
+const FILTER = 57427
+const ESCAPE = 57428
+const SHIFT_LEFT_LOGICAL = 57429
+const SHIFT_RIGHT_ARITHMETIC = 57430
+const SHIFT_RIGHT_LOGICAL = 57431
+const CONCAT = 57432
+const APPEND = 57433
+const NEGATION_PRECEDENCE = 57434
+const NUMBER = 57435
+const ION = 57436
+const PARAM = 57437
+const STRING = 57438
 
 var yyToknames = [...]string{
 	"$end",
@@ -160,6 +164,7 @@ var yyToknames = [...]string{
 	"WITH",
 	"INTO",
 	"EXPLAIN",
+	"ANALYZE",
 	"DISTINCT",
 	"ALL",
 	"AS",
@@ -253,6 +258,7 @@ var yyToknames = [...]string{
 	"'.'",
 	"NUMBER",
 	"ION",
+	"PARAM",
 	"STRING",
 	"':'",
 }
@@ -268,304 +274,326 @@ var yyExca = [...]int16{
 	-1, 1,
 	1, -1,
 	-2, 0,
-	-1, 393,
-	67, 84,
-	68, 84,
-	70, 84,
-	71, 84,
-	72, 84,
-	80, 84,
-	81, 84,
-	82, 84,
-	83, 84,
-	84, 84,
-	85, 84,
-	-2, 141,
+	-1, 418,
+	68, 95,
+	69, 95,
+	71, 95,
+	72, 95,
+	73, 95,
+	81, 95,
+	82, 95,
+	83, 95,
+	84, 95,
+	85, 95,
+	86, 95,
+	-2, 152,
 }
 
 const yyPrivate = 57344
 
-const yyLast = 2176
+const yyLast = 2354
 
 var yyAct = [...]int16{
-	25, 361, 391, 189, 207, 387, 23, 376, 341, 307,
-	332, 286, 28, 115, 224, 131, 138, 218, 339, 24,
-	74, 75, 76, 78, 77, 79, 80, 81, 82, 83,
-	84, 85, 105, 75, 76, 78, 77, 79, 80, 81,
-	82, 83, 84, 85, 120, 121, 122, 338, 20, 124,
-	305, 127, 129, 79, 80, 81, 82, 83, 84, 85,
-	301, 41, 300, 132, 304, 246, 245, 243, 11, 13,
-	65, 242, 18, 137, 146, 147, 148, 149, 150, 151,
-	152, 153, 154, 155, 156, 157, 158, 71, 141, 240,
-	163, 162, 164, 165, 166, 167, 168, 169, 160, 126,
-	176, 177, 159, 208, 186, 209, 118, 190, 192, 193,
-	170, 116, 135, 185, 118, 199, 303, 190, 12, 50,
-	205, 81, 82, 83, 84, 85, 56, 54, 55, 57,
-	239, 143, 144, 238, 220, 76, 78, 77, 79, 80,
-	81, 82, 83, 84, 85, 308, 190, 84, 85, 237,
-	342, 244, 161, 174, 223, 311, 117, 60, 209, 143,
-	235, 256, 188, 257, 117, 241, 275, 274, 210, 173,
-	175, 172, 171, 53, 59, 58, 216, 14, 410, 206,
-	399, 217, 362, 221, 251, 178, 181, 182, 180, 258,
-	260, 299, 214, 179, 236, 215, 352, 184, 64, 283,
-	282, 271, 247, 249, 250, 248, 230, 232, 233, 229,
-	231, 349, 234, 260, 272, 279, 260, 259, 228, 281,
-	273, 345, 298, 284, 276, 252, 288, 142, 260, 265,
-	266, 140, 280, 222, 213, 198, 69, 68, 285, 373,
-	264, 263, 10, 136, 367, 343, 289, 290, 145, 134,
-	133, 119, 114, 113, 302, 112, 111, 312, 313, 310,
-	110, 315, 316, 309, 318, 319, 109, 321, 322, 108,
-	323, 324, 107, 277, 278, 12, 68, 106, 103, 320,
-	68, 102, 63, 317, 330, 197, 196, 195, 326, 327,
-	194, 335, 61, 295, 293, 337, 336, 331, 296, 294,
-	297, 292, 291, 143, 380, 211, 328, 408, 409, 406,
-	16, 329, 62, 212, 22, 347, 340, 19, 344, 7,
-	17, 3, 6, 388, 377, 333, 357, 21, 394, 378,
-	334, 362, 287, 66, 363, 368, 365, 225, 267, 140,
-	22, 364, 360, 9, 15, 226, 2, 370, 200, 366,
-	187, 371, 372, 227, 390, 369, 219, 130, 128, 139,
-	8, 183, 375, 405, 400, 5, 4, 46, 47, 381,
-	123, 27, 125, 255, 385, 104, 67, 49, 382, 392,
-	393, 1, 389, 386, 0, 0, 0, 0, 0, 0,
-	358, 359, 397, 398, 0, 190, 42, 0, 403, 0,
-	392, 0, 404, 0, 0, 407, 201, 202, 203, 32,
-	33, 38, 37, 34, 39, 35, 36, 0, 0, 0,
-	0, 0, 0, 0, 0, 0, 0, 30, 29, 12,
-	50, 0, 0, 51, 0, 52, 0, 56, 54, 55,
-	57, 0, 0, 0, 45, 44, 0, 31, 0, 0,
-	0, 0, 0, 40, 0, 0, 0, 0, 0, 0,
+	41, 382, 416, 213, 82, 412, 39, 399, 360, 328,
+	351, 306, 44, 246, 151, 94, 162, 19, 66, 40,
+	238, 430, 396, 395, 358, 72, 70, 71, 73, 31,
+	357, 326, 322, 321, 318, 152, 269, 268, 266, 265,
+	263, 187, 186, 184, 183, 36, 84, 325, 128, 324,
+	262, 261, 209, 329, 267, 361, 185, 94, 83, 332,
+	140, 141, 142, 198, 33, 144, 212, 147, 149, 264,
+	158, 94, 69, 75, 76, 74, 279, 157, 280, 197,
+	199, 196, 195, 87, 99, 101, 100, 102, 103, 104,
+	105, 106, 107, 108, 438, 161, 435, 170, 171, 172,
+	173, 174, 175, 176, 177, 178, 179, 180, 181, 182,
+	165, 156, 146, 84, 32, 188, 189, 190, 191, 192,
+	193, 94, 138, 200, 201, 33, 155, 210, 77, 94,
+	214, 216, 217, 194, 107, 108, 208, 410, 223, 214,
+	20, 22, 229, 409, 57, 104, 105, 106, 107, 108,
+	202, 205, 206, 204, 240, 18, 21, 21, 203, 24,
+	234, 425, 29, 235, 85, 270, 272, 273, 271, 236,
+	214, 11, 25, 260, 237, 32, 383, 81, 245, 371,
+	21, 283, 320, 368, 257, 230, 93, 243, 244, 98,
+	99, 101, 100, 102, 103, 104, 105, 106, 107, 108,
+	241, 102, 103, 104, 105, 106, 107, 108, 274, 86,
+	12, 303, 302, 281, 364, 259, 283, 295, 283, 282,
+	166, 319, 13, 283, 164, 294, 252, 254, 255, 251,
+	253, 304, 256, 296, 275, 299, 21, 167, 250, 301,
+	288, 289, 91, 242, 233, 222, 90, 394, 308, 287,
+	286, 300, 17, 388, 94, 362, 169, 154, 153, 305,
+	160, 139, 137, 136, 135, 21, 134, 133, 309, 310,
+	132, 131, 130, 19, 90, 129, 126, 323, 125, 80,
+	333, 334, 331, 90, 336, 337, 330, 339, 340, 341,
+	342, 343, 338, 344, 345, 112, 121, 120, 258, 221,
+	220, 219, 218, 168, 349, 114, 115, 116, 117, 118,
+	119, 111, 113, 109, 110, 95, 124, 350, 35, 23,
+	96, 97, 98, 99, 101, 100, 102, 103, 104, 105,
+	106, 107, 108, 5, 354, 78, 366, 359, 315, 363,
+	313, 356, 355, 316, 317, 314, 312, 378, 311, 27,
+	403, 231, 347, 384, 94, 386, 436, 437, 433, 232,
+	385, 381, 348, 159, 79, 38, 391, 34, 387, 30,
+	392, 393, 14, 28, 390, 7, 297, 298, 3, 37,
+	10, 413, 400, 398, 352, 419, 401, 353, 88, 383,
+	404, 307, 26, 389, 247, 408, 290, 164, 38, 405,
+	16, 248, 417, 418, 6, 414, 411, 4, 2, 21,
+	224, 211, 249, 94, 415, 239, 150, 423, 424, 148,
+	214, 163, 58, 429, 15, 207, 417, 432, 431, 426,
+	9, 434, 225, 226, 227, 48, 49, 54, 53, 50,
+	55, 51, 52, 8, 62, 63, 143, 43, 145, 278,
+	127, 89, 65, 46, 45, 19, 66, 1, 0, 67,
+	0, 68, 0, 72, 70, 71, 73, 0, 0, 0,
+	61, 60, 0, 47, 0, 0, 0, 0, 0, 56,
+	97, 98, 99, 101, 100, 102, 103, 104, 105, 106,
+	107, 108, 379, 380, 0, 0, 0, 0, 0, 0,
+	0, 58, 59, 0, 0, 0, 0, 64, 0, 0,
+	69, 75, 76, 74, 48, 49, 54, 53, 50, 55,
+	51, 52, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 46, 45, 19, 66, 0, 0, 67, 0,
+	68, 0, 72, 70, 71, 73, 0, 0, 0, 61,
+	60, 0, 47, 0, 0, 0, 0, 0, 56, 0,
+	0, 0, 0, 0, 38, 0, 0, 0, 0, 0,
 	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-	0, 0, 0, 0, 42, 0, 43, 0, 0, 0,
-	48, 0, 0, 0, 53, 59, 58, 32, 33, 38,
-	37, 34, 39, 35, 36, 0, 0, 0, 0, 0,
-	0, 0, 0, 0, 0, 30, 29, 12, 50, 0,
-	0, 51, 0, 52, 0, 56, 54, 55, 57, 0,
-	0, 0, 45, 44, 0, 31, 0, 0, 0, 0,
-	0, 40, 0, 0, 0, 0, 0, 22, 0, 0,
+	58, 59, 42, 0, 0, 0, 0, 0, 0, 69,
+	75, 76, 74, 48, 49, 54, 53, 50, 55, 51,
+	52, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 46, 45, 19, 66, 0, 0, 67, 0, 68,
+	0, 72, 70, 71, 73, 0, 0, 0, 61, 60,
+	0, 47, 0, 0, 0, 0, 0, 56, 0, 0,
 	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-	0, 0, 42, 0, 43, 26, 0, 0, 0, 0,
-	0, 0, 53, 59, 58, 32, 33, 38, 37, 34,
-	39, 35, 36, 0, 0, 0, 0, 0, 0, 0,
-	0, 0, 0, 30, 29, 12, 50, 0, 0, 51,
-	0, 52, 0, 56, 54, 55, 57, 0, 0, 0,
-	45, 44, 0, 31, 0, 0, 0, 0, 0, 40,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 58,
+	59, 215, 0, 0, 0, 0, 0, 0, 69, 75,
+	76, 74, 48, 49, 54, 53, 50, 55, 51, 52,
 	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	46, 45, 19, 66, 0, 228, 67, 0, 68, 0,
+	72, 70, 71, 73, 0, 0, 0, 61, 60, 0,
+	47, 0, 0, 0, 0, 0, 56, 0, 0, 0,
 	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-	42, 0, 43, 191, 0, 0, 0, 0, 0, 0,
-	53, 59, 58, 32, 33, 38, 37, 34, 39, 35,
-	36, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-	0, 30, 29, 12, 50, 0, 204, 51, 0, 52,
-	0, 56, 54, 55, 57, 0, 0, 0, 45, 44,
-	0, 31, 0, 0, 0, 0, 0, 40, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 58, 59,
+	215, 0, 0, 0, 0, 0, 0, 69, 75, 76,
+	74, 48, 49, 54, 53, 50, 55, 51, 52, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 46,
+	45, 19, 66, 0, 0, 67, 0, 68, 0, 72,
+	70, 71, 73, 0, 0, 0, 61, 60, 0, 47,
+	0, 0, 0, 0, 0, 56, 0, 0, 0, 0,
+	0, 38, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 58, 59, 215,
+	0, 0, 0, 0, 0, 0, 69, 75, 76, 74,
+	48, 49, 54, 53, 50, 55, 51, 52, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 46, 45,
+	19, 66, 0, 0, 67, 0, 68, 0, 72, 70,
+	71, 73, 0, 0, 0, 61, 60, 0, 47, 0,
+	0, 0, 0, 0, 56, 0, 0, 0, 0, 0,
 	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-	0, 0, 0, 0, 0, 0, 0, 0, 42, 0,
-	43, 191, 0, 0, 0, 0, 0, 0, 53, 59,
-	58, 32, 33, 38, 37, 34, 39, 35, 36, 0,
-	0, 270, 0, 0, 0, 0, 0, 0, 0, 30,
-	29, 12, 50, 0, 0, 51, 0, 52, 0, 56,
-	54, 55, 57, 0, 0, 0, 45, 44, 0, 31,
-	0, 0, 0, 0, 0, 40, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 58, 59, 0, 0,
+	0, 0, 0, 0, 0, 69, 75, 76, 74, 48,
+	49, 54, 53, 50, 55, 51, 52, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 46, 45, 19,
+	66, 0, 293, 67, 0, 68, 0, 72, 70, 71,
+	73, 0, 0, 0, 61, 60, 0, 47, 0, 0,
+	0, 0, 0, 56, 94, 0, 0, 0, 0, 0,
 	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-	269, 268, 0, 0, 0, 0, 0, 0, 43, 191,
-	100, 99, 0, 89, 98, 97, 53, 59, 58, 0,
-	0, 0, 0, 91, 92, 93, 94, 95, 96, 88,
-	90, 86, 87, 72, 101, 0, 22, 0, 73, 74,
-	75, 76, 78, 77, 79, 80, 81, 82, 83, 84,
-	85, 42, 0, 0, 0, 0, 0, 0, 0, 0,
-	0, 0, 0, 0, 32, 33, 38, 37, 34, 39,
-	35, 36, 0, 0, 0, 0, 0, 0, 0, 0,
-	0, 0, 30, 29, 12, 50, 0, 0, 51, 0,
-	52, 0, 56, 54, 55, 57, 0, 0, 0, 45,
-	44, 0, 31, 0, 0, 0, 0, 0, 40, 0,
+	0, 0, 0, 0, 0, 0, 59, 0, 0, 0,
+	0, 0, 292, 291, 69, 75, 76, 74, 0, 0,
+	0, 0, 123, 122, 0, 112, 121, 120, 427, 428,
+	0, 94, 0, 0, 0, 114, 115, 116, 117, 118,
+	119, 111, 113, 109, 110, 95, 124, 0, 0, 0,
+	96, 97, 98, 99, 101, 100, 102, 103, 104, 105,
+	106, 107, 108, 0, 0, 0, 0, 0, 0, 123,
+	122, 0, 112, 121, 120, 0, 0, 0, 0, 0,
+	0, 0, 114, 115, 116, 117, 118, 119, 111, 113,
+	109, 110, 95, 124, 94, 0, 0, 96, 97, 98,
+	99, 101, 100, 102, 103, 104, 105, 106, 107, 108,
 	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-	0, 0, 0, 0, 0, 0, 0, 0, 0, 42,
-	0, 43, 0, 0, 0, 0, 0, 0, 0, 53,
-	59, 58, 32, 33, 38, 37, 34, 39, 35, 36,
+	0, 0, 422, 421, 0, 0, 0, 0, 0, 0,
+	0, 0, 123, 122, 0, 112, 121, 120, 0, 0,
+	0, 0, 0, 0, 0, 114, 115, 116, 117, 118,
+	119, 111, 113, 109, 110, 95, 124, 94, 0, 0,
+	96, 97, 98, 99, 101, 100, 102, 103, 104, 105,
+	106, 107, 108, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 375, 374, 0, 0, 0,
+	0, 0, 0, 0, 0, 123, 122, 0, 112, 121,
+	120, 0, 0, 0, 0, 0, 0, 0, 114, 115,
+	116, 117, 118, 119, 111, 113, 109, 110, 95, 124,
+	94, 0, 0, 96, 97, 98, 99, 101, 100, 102,
+	103, 104, 105, 106, 107, 108, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 373, 372,
+	0, 0, 0, 0, 0, 0, 0, 0, 123, 122,
+	0, 112, 121, 120, 0, 0, 0, 0, 0, 0,
+	0, 114, 115, 116, 117, 118, 119, 111, 113, 109,
+	110, 95, 124, 94, 0, 0, 96, 97, 98, 99,
+	101, 100, 102, 103, 104, 105, 106, 107, 108, 0,
+	0, 0, 0, 0, 0, 0, 94, 0, 0, 0,
+	0, 277, 276, 0, 0, 0, 0, 0, 0, 0,
+	0, 123, 122, 0, 112, 121, 120, 0, 0, 0,
+	0, 0, 0, 0, 114, 115, 116, 117, 118, 119,
+	111, 113, 109, 110, 95, 124, 0, 0, 0, 96,
+	97, 98, 99, 101, 100, 102, 103, 104, 105, 106,
+	107, 108, 92, 111, 113, 109, 110, 95, 124, 0,
+	94, 0, 96, 97, 98, 99, 101, 100, 102, 103,
+	104, 105, 106, 107, 108, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 19, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 123, 122,
+	0, 112, 121, 120, 0, 0, 0, 0, 0, 0,
+	94, 114, 115, 116, 117, 118, 119, 111, 113, 109,
+	110, 95, 124, 0, 0, 0, 96, 97, 98, 99,
+	101, 100, 102, 103, 104, 105, 106, 107, 108, 420,
+	0, 0, 0, 0, 0, 0, 0, 0, 123, 122,
+	0, 112, 121, 120, 0, 0, 0, 0, 0, 0,
+	94, 114, 115, 116, 117, 118, 119, 111, 113, 109,
+	110, 95, 124, 0, 0, 0, 96, 97, 98, 99,
+	101, 100, 102, 103, 104, 105, 106, 107, 108, 407,
+	0, 0, 0, 0, 0, 0, 0, 0, 123, 122,
+	0, 112, 121, 120, 0, 0, 0, 0, 0, 0,
+	94, 114, 115, 116, 117, 118, 119, 111, 113, 109,
+	110, 95, 124, 0, 0, 0, 96, 97, 98, 99,
+	101, 100, 102, 103, 104, 105, 106, 107, 108, 406,
+	0, 0, 0, 0, 0, 0, 0, 0, 123, 122,
+	0, 112, 121, 120, 0, 0, 0, 0, 0, 0,
+	94, 114, 115, 116, 117, 118, 119, 111, 113, 109,
+	110, 95, 124, 0, 0, 0, 96, 97, 98, 99,
+	101, 100, 102, 103, 104, 105, 106, 107, 108, 397,
+	0, 0, 0, 0, 0, 0, 0, 0, 123, 122,
+	0, 112, 121, 120, 0, 0, 0, 0, 0, 0,
+	94, 114, 115, 116, 117, 118, 119, 111, 113, 109,
+	110, 95, 124, 0, 0, 0, 96, 97, 98, 99,
+	101, 100, 102, 103, 104, 105, 106, 107, 108, 377,
+	0, 0, 0, 0, 0, 0, 0, 0, 123, 122,
+	0, 112, 121, 120, 0, 0, 0, 0, 0, 0,
+	94, 114, 115, 116, 117, 118, 119, 111, 113, 109,
+	110, 95, 124, 0, 0, 0, 96, 97, 98, 99,
+	101, 100, 102, 103, 104, 105, 106, 107, 108, 376,
+	0, 0, 0, 0, 0, 0, 0, 0, 123, 122,
+	0, 112, 121, 120, 0, 0, 0, 0, 0, 0,
+	0, 114, 115, 116, 117, 118, 119, 111, 113, 109,
+	110, 95, 124, 94, 0, 0, 96, 97, 98, 99,
+	101, 100, 102, 103, 104, 105, 106, 107, 108, 0,
 	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-	30, 29, 12, 50, 0, 0, 51, 0, 52, 0,
-	56, 54, 55, 57, 0, 0, 0, 45, 44, 0,
-	31, 401, 402, 0, 0, 0, 40, 88, 90, 86,
-	87, 72, 101, 0, 0, 0, 73, 74, 75, 76,
-	78, 77, 79, 80, 81, 82, 83, 84, 85, 43,
-	0, 0, 0, 0, 0, 0, 0, 53, 59, 58,
-	0, 0, 100, 99, 0, 89, 98, 97, 0, 0,
-	0, 0, 0, 0, 0, 91, 92, 93, 94, 95,
-	96, 88, 90, 86, 87, 72, 101, 0, 0, 0,
-	73, 74, 75, 76, 78, 77, 79, 80, 81, 82,
-	83, 84, 85, 254, 253, 0, 0, 0, 0, 0,
-	0, 0, 0, 100, 99, 0, 89, 98, 97, 0,
-	70, 0, 0, 0, 0, 0, 91, 92, 93, 94,
-	95, 96, 88, 90, 86, 87, 72, 101, 0, 0,
-	0, 73, 74, 75, 76, 78, 77, 79, 80, 81,
-	82, 83, 84, 85, 12, 0, 0, 0, 0, 0,
-	0, 0, 0, 0, 0, 0, 100, 99, 0, 89,
-	98, 97, 0, 0, 0, 0, 0, 0, 0, 91,
-	92, 93, 94, 95, 96, 88, 90, 86, 87, 72,
-	101, 0, 0, 0, 73, 74, 75, 76, 78, 77,
-	79, 80, 81, 82, 83, 84, 85, 396, 0, 0,
-	0, 0, 0, 0, 0, 0, 100, 99, 0, 89,
-	98, 97, 0, 0, 0, 0, 0, 0, 0, 91,
-	92, 93, 94, 95, 96, 88, 90, 86, 87, 72,
-	101, 0, 0, 0, 73, 74, 75, 76, 78, 77,
-	79, 80, 81, 82, 83, 84, 85, 395, 0, 0,
-	0, 0, 0, 0, 0, 0, 100, 99, 0, 89,
-	98, 97, 0, 0, 0, 0, 0, 0, 0, 91,
-	92, 93, 94, 95, 96, 88, 90, 86, 87, 72,
-	101, 0, 0, 0, 73, 74, 75, 76, 78, 77,
-	79, 80, 81, 82, 83, 84, 85, 384, 0, 0,
-	0, 0, 0, 0, 0, 0, 100, 99, 0, 89,
-	98, 97, 0, 0, 0, 0, 0, 0, 0, 91,
-	92, 93, 94, 95, 96, 88, 90, 86, 87, 72,
-	101, 0, 0, 0, 73, 74, 75, 76, 78, 77,
-	79, 80, 81, 82, 83, 84, 85, 383, 0, 0,
-	0, 0, 0, 0, 0, 0, 100, 99, 0, 89,
-	98, 97, 0, 0, 0, 0, 0, 0, 0, 91,
-	92, 93, 94, 95, 96, 88, 90, 86, 87, 72,
-	101, 0, 0, 0, 73, 74, 75, 76, 78, 77,
-	79, 80, 81, 82, 83, 84, 85, 374, 0, 0,
-	0, 0, 0, 0, 0, 0, 100, 99, 0, 89,
-	98, 97, 0, 0, 0, 0, 0, 0, 0, 91,
-	92, 93, 94, 95, 96, 88, 90, 86, 87, 72,
-	101, 0, 0, 0, 73, 74, 75, 76, 78, 77,
-	79, 80, 81, 82, 83, 84, 85, 356, 0, 0,
-	0, 0, 0, 0, 0, 0, 100, 99, 0, 89,
-	98, 97, 0, 0, 0, 0, 0, 0, 0, 91,
-	92, 93, 94, 95, 96, 88, 90, 86, 87, 72,
-	101, 0, 0, 0, 73, 74, 75, 76, 78, 77,
-	79, 80, 81, 82, 83, 84, 85, 355, 0, 0,
-	0, 0, 0, 0, 0, 0, 100, 99, 0, 89,
-	98, 97, 0, 0, 0, 0, 0, 0, 0, 91,
-	92, 93, 94, 95, 96, 88, 90, 86, 87, 72,
-	101, 0, 0, 0, 73, 74, 75, 76, 78, 77,
-	79, 80, 81, 82, 83, 84, 85, 354, 0, 0,
-	0, 0, 0, 0, 0, 0, 100, 99, 0, 89,
-	98, 97, 0, 0, 0, 0, 0, 0, 0, 91,
-	92, 93, 94, 95, 96, 88, 90, 86, 87, 72,
-	101, 0, 0, 0, 73, 74, 75, 76, 78, 77,
-	79, 80, 81, 82, 83, 84, 85, 353, 0, 0,
-	0, 0, 0, 0, 0, 0, 100, 99, 0, 89,
-	98, 97, 0, 0, 0, 0, 0, 0, 0, 91,
-	92, 93, 94, 95, 96, 88, 90, 86, 87, 72,
-	101, 0, 0, 0, 73, 74, 75, 76, 78, 77,
-	79, 80, 81, 82, 83, 84, 85, 351, 0, 0,
-	0, 0, 0, 0, 0, 0, 0, 100, 99, 0,
-	89, 98, 97, 0, 0, 0, 0, 0, 0, 0,
-	91, 92, 93, 94, 95, 96, 88, 90, 86, 87,
-	72, 101, 0, 0, 0, 73, 74, 75, 76, 78,
-	77, 79, 80, 81, 82, 83, 84, 85, 350, 0,
-	0, 0, 0, 0, 0, 0, 0, 0, 100, 99,
-	0, 89, 98, 97, 0, 0, 0, 0, 0, 0,
-	0, 91, 92, 93, 94, 95, 96, 88, 90, 86,
-	87, 72, 101, 0, 0, 0, 73, 74, 75, 76,
-	78, 77, 79, 80, 81, 82, 83, 84, 85, 348,
-	0, 0, 0, 0, 0, 0, 0, 0, 100, 99,
-	0, 89, 98, 97, 0, 0, 0, 0, 0, 0,
-	0, 91, 92, 93, 94, 95, 96, 88, 90, 86,
-	87, 72, 101, 325, 0, 0, 73, 74, 75, 76,
-	78, 77, 79, 80, 81, 82, 83, 84, 85, 100,
-	99, 0, 89, 98, 97, 0, 0, 346, 0, 0,
-	0, 0, 91, 92, 93, 94, 95, 96, 88, 90,
-	86, 87, 72, 101, 0, 0, 0, 73, 74, 75,
-	76, 78, 77, 79, 80, 81, 82, 83, 84, 85,
-	0, 0, 100, 99, 0, 89, 98, 97, 0, 0,
-	0, 0, 0, 0, 0, 91, 92, 93, 94, 95,
-	96, 88, 90, 86, 87, 72, 101, 0, 0, 0,
-	73, 74, 75, 76, 78, 77, 79, 80, 81, 82,
-	83, 84, 85, 100, 99, 0, 89, 98, 97, 0,
-	0, 314, 0, 0, 0, 0, 91, 92, 93, 94,
-	95, 96, 88, 90, 86, 87, 72, 101, 0, 0,
-	0, 73, 74, 75, 76, 78, 77, 79, 80, 81,
-	82, 83, 84, 85, 306, 0, 0, 0, 262, 0,
-	0, 0, 0, 100, 99, 0, 89, 98, 97, 0,
-	0, 0, 0, 0, 0, 0, 91, 92, 93, 94,
-	95, 96, 88, 90, 86, 87, 72, 101, 0, 0,
-	0, 73, 74, 75, 76, 78, 77, 79, 80, 81,
-	82, 83, 84, 85, 100, 99, 0, 89, 98, 97,
-	0, 0, 0, 0, 0, 0, 0, 91, 92, 93,
-	94, 95, 96, 88, 90, 86, 87, 72, 101, 0,
-	0, 0, 73, 74, 75, 76, 78, 77, 79, 80,
-	81, 82, 83, 84, 85, 261, 0, 0, 0, 0,
-	0, 0, 0, 0, 0, 100, 99, 0, 89, 98,
-	97, 0, 0, 0, 0, 0, 0, 0, 91, 92,
-	93, 94, 95, 96, 88, 90, 86, 87, 72, 101,
-	0, 0, 0, 73, 74, 75, 76, 78, 77, 79,
-	80, 81, 82, 83, 84, 85, 100, 99, 0, 89,
-	98, 97, 0, 0, 0, 0, 0, 0, 0, 91,
-	92, 93, 94, 95, 96, 88, 90, 86, 87, 72,
-	101, 0, 0, 0, 73, 74, 75, 76, 78, 77,
-	79, 80, 81, 82, 83, 84, 85, 100, 99, 0,
-	89, 98, 97, 0, 0, 0, 0, 0, 0, 0,
-	379, 92, 93, 94, 95, 96, 88, 90, 86, 87,
-	72, 101, 0, 0, 0, 73, 74, 75, 76, 78,
-	77, 79, 80, 81, 82, 83, 84, 85, 99, 0,
-	89, 98, 97, 0, 0, 0, 0, 0, 0, 0,
-	91, 92, 93, 94, 95, 96, 88, 90, 86, 87,
-	72, 101, 0, 0, 0, 73, 74, 75, 76, 78,
-	77, 79, 80, 81, 82, 83, 84, 85, 89, 98,
-	97, 0, 0, 0, 0, 0, 0, 0, 91, 92,
-	93, 94, 95, 96, 88, 90, 86, 87, 72, 101,
-	0, 0, 0, 73, 74, 75, 76, 78, 77, 79,
-	80, 81, 82, 83, 84, 85,
+	0, 370, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 123, 122, 0, 112, 121, 120, 0, 0, 0,
+	0, 0, 0, 0, 114, 115, 116, 117, 118, 119,
+	111, 113, 109, 110, 95, 124, 94, 0, 0, 96,
+	97, 98, 99, 101, 100, 102, 103, 104, 105, 106,
+	107, 108, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 369, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 123, 122, 0, 112, 121, 120,
+	0, 0, 0, 0, 0, 0, 94, 114, 115, 116,
+	117, 118, 119, 111, 113, 109, 110, 95, 124, 0,
+	0, 0, 96, 97, 98, 99, 101, 100, 102, 103,
+	104, 105, 106, 107, 108, 367, 0, 0, 0, 0,
+	0, 0, 0, 0, 123, 122, 0, 112, 121, 120,
+	94, 0, 0, 0, 0, 0, 0, 114, 115, 116,
+	117, 118, 119, 111, 113, 109, 110, 95, 124, 0,
+	0, 0, 96, 97, 98, 99, 101, 100, 102, 103,
+	104, 105, 106, 107, 108, 0, 0, 0, 123, 122,
+	94, 112, 121, 120, 0, 0, 365, 0, 0, 0,
+	0, 114, 115, 116, 117, 118, 119, 111, 113, 109,
+	110, 95, 124, 346, 0, 0, 96, 97, 98, 99,
+	101, 100, 102, 103, 104, 105, 106, 107, 108, 122,
+	0, 112, 121, 120, 0, 94, 0, 0, 0, 0,
+	0, 114, 115, 116, 117, 118, 119, 111, 113, 109,
+	110, 95, 124, 0, 0, 0, 96, 97, 98, 99,
+	101, 100, 102, 103, 104, 105, 106, 107, 108, 0,
+	0, 0, 0, 123, 122, 0, 112, 121, 120, 94,
+	0, 0, 0, 0, 0, 0, 114, 115, 116, 117,
+	118, 119, 111, 113, 109, 110, 95, 124, 0, 0,
+	0, 96, 97, 98, 99, 101, 100, 102, 103, 104,
+	105, 106, 107, 108, 0, 0, 0, 123, 122, 0,
+	112, 121, 120, 0, 0, 335, 0, 0, 0, 94,
+	114, 115, 116, 117, 118, 119, 111, 113, 109, 110,
+	95, 124, 0, 0, 0, 96, 97, 98, 99, 101,
+	100, 102, 103, 104, 105, 106, 107, 108, 327, 0,
+	0, 0, 0, 0, 0, 285, 0, 123, 122, 0,
+	112, 121, 120, 94, 0, 0, 0, 0, 0, 0,
+	114, 115, 116, 117, 118, 119, 111, 113, 109, 110,
+	95, 124, 0, 0, 0, 96, 97, 98, 99, 101,
+	100, 102, 103, 104, 105, 106, 107, 108, 0, 0,
+	0, 123, 122, 0, 112, 121, 120, 0, 0, 0,
+	0, 0, 0, 0, 114, 115, 116, 117, 118, 119,
+	111, 113, 109, 110, 95, 124, 94, 0, 0, 96,
+	97, 98, 99, 101, 100, 102, 103, 104, 105, 106,
+	107, 108, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 284, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 123, 122, 0, 112, 121, 120,
+	94, 0, 0, 0, 0, 0, 0, 114, 115, 116,
+	117, 118, 119, 111, 113, 109, 110, 95, 124, 0,
+	0, 0, 96, 97, 98, 99, 101, 100, 102, 103,
+	104, 105, 106, 107, 108, 0, 0, 0, 123, 122,
+	0, 112, 121, 120, 94, 0, 0, 0, 0, 0,
+	0, 114, 115, 116, 117, 118, 119, 111, 113, 109,
+	110, 95, 124, 0, 0, 0, 96, 97, 98, 99,
+	101, 100, 102, 103, 104, 105, 106, 107, 108, 0,
+	0, 0, 123, 122, 0, 112, 121, 120, 0, 0,
+	0, 0, 0, 0, 0, 402, 115, 116, 117, 118,
+	119, 111, 113, 109, 110, 95, 124, 0, 0, 0,
+	96, 97, 98, 99, 101, 100, 102, 103, 104, 105,
+	106, 107, 108, 123, 122, 0, 112, 121, 120, 0,
+	0, 0, 0, 0, 0, 0, 114, 115, 116, 117,
+	118, 119, 111, 113, 109, 110, 95, 124, 0, 0,
+	0, 96, 97, 98, 99, 101, 100, 102, 103, 104,
+	105, 106, 107, 108,
 }
 
 var yyPact = [...]int16{
-	303, -1000, 306, 298, 336, 185, 220, 220, 338, 301,
-	220, 296, -1000, -1000, -1000, 307, 452, 240, 291, 226,
-	338, 333, 301, 219, -1000, 1039, -1000, -1000, -1000, 225,
-	222, 887, 221, 216, 213, 210, 204, 200, 199, 197,
-	196, 55, 195, 887, 887, 887, -1000, -1000, 887, -1000,
-	809, 887, -49, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
-	-1000, 194, 193, 333, -1000, 338, 452, 331, 452, 220,
-	220, -1000, 192, 887, 887, 887, 887, 887, 887, 887,
-	887, 887, 887, 887, 887, 887, -10, -14, 74, -21,
-	-22, 887, 887, 887, 887, 887, 887, 63, 83, 887,
-	887, 122, 94, 887, 88, 1949, 686, 887, 887, 235,
-	232, 231, 230, 177, 374, -1000, 608, 220, 48, 333,
-	-1000, 2068, 2068, 284, 1949, 176, -1000, 1949, 135, 1949,
-	119, -1000, -96, 887, 333, 175, -1000, 223, 328, 161,
-	452, -1000, -1000, 47, -1000, 530, -76, -64, 37, -48,
-	-48, -48, 18, 18, 41, 41, 41, -1000, -1000, 39,
-	36, -23, -1000, -1000, 881, 881, 881, 881, 881, 881,
-	97, -41, -45, 73, -46, -47, 2068, 2030, -1000, 139,
-	-1000, -1000, -1000, 887, 167, -1000, 986, 87, 887, 159,
-	1949, -1000, 1908, 1857, 184, 183, 173, 330, -1000, 723,
-	887, -1000, -1000, -1000, -1000, 156, 47, 107, 106, -1000,
-	166, 220, 220, -1000, 887, -1000, -49, -1000, 887, 142,
-	1949, 165, -1000, 328, 322, 887, 452, 452, -1000, 257,
-	-1000, 256, 249, 248, 255, -1000, 164, 133, -50, -52,
-	-1000, 63, 22, -30, -62, -1000, -1000, -1000, -1000, -1000,
-	-1000, 1816, 52, 52, -5, 78, 887, 887, 1766, -1000,
-	887, 887, 228, 887, 887, 224, 887, 887, -1000, 887,
-	887, 1725, -1000, -1000, 47, 47, -1000, 277, 290, 1949,
-	-1000, 1949, -1000, 887, -1000, 322, 312, 318, 1949, -1000,
-	239, -1000, -1000, -1000, 251, -1000, 250, -1000, -1000, -1000,
-	-1000, -1000, -1000, -65, -94, -1000, 52, 58, 189, 58,
-	163, -1000, 1682, 1949, 887, 1949, 1641, 153, 1591, 1540,
-	138, 1489, 1439, 1389, 1339, 887, -1000, -1000, 220, 220,
-	1949, 312, 320, 887, 452, 887, -1000, -1000, -1000, -1000,
-	58, -1000, 188, 326, -1000, 52, 887, 1949, -1000, -1000,
-	887, 887, 182, -1000, -1000, -1000, -1000, 1289, -1000, -1000,
-	320, 310, 317, 1949, 180, 1990, -1000, 274, 887, 58,
-	1949, 1239, 1189, 887, -1000, 310, 308, -5, 887, 887,
-	316, 1139, -1000, -1000, -1000, 1089, 308, -1000, -5, -1000,
-	123, -1000, 935, 881, 686, -1000, -1000, -1000, -1000, 887,
-	286, -1000, -1000, 171, -1000, -1000, 283, 120, -1000, -1000,
-	-1000,
+	360, -1000, 277, 356, 364, 154, 350, -1000, 393, 194,
+	217, 217, 217, 263, 217, 386, 353, 217, 347, -1000,
+	-1000, 4, 345, 262, -1000, -1000, 358, 478, 282, 342,
+	222, -1000, 217, 2, -1000, 217, 386, 391, 353, 225,
+	-1000, 1310, -1000, -1000, -1000, 221, 219, 873, 218, 215,
+	214, 213, 210, 209, 207, 206, 205, 65, 204, 873,
+	873, 873, -1000, -1000, 873, -1000, 794, 873, -79, -1000,
+	-1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, 201, 200,
+	391, 4, 16, 9, -1000, 341, -1000, 386, 478, 389,
+	478, 217, 217, -1000, 247, 199, 873, 873, 873, 873,
+	873, 873, 873, 873, 873, 873, 873, 873, 873, -70,
+	-71, -23, -72, -73, 873, 873, 873, 873, 873, 873,
+	-39, -8, 873, 873, 86, 32, 873, -9, 2160, 715,
+	873, 873, 246, 245, 244, 243, 186, 399, 636, 391,
+	-1000, 224, 224, 329, 2245, 185, -1000, 2160, 102, 2160,
+	111, -1000, -95, 873, 391, 184, -1000, 4, 4, -1000,
+	-1000, 216, 385, 180, 478, -1000, -1000, -1000, 242, 557,
+	383, 91, -15, 99, 99, 99, 41, 41, 27, 27,
+	27, 324, 324, -44, -45, -74, -1000, -1000, 1246, 1246,
+	1246, 1246, 1246, 1246, 0, -75, -76, -25, -77, -78,
+	224, 1870, -1000, 101, -1000, -1000, -1000, 873, 175, -1000,
+	1223, 1, 873, 160, 2160, -1000, 2116, 2053, 192, 191,
+	183, 388, -1000, 924, 873, -1000, -1000, -1000, -1000, 158,
+	174, 217, 217, -1000, 873, -1000, -79, -1000, 873, 153,
+	2160, 172, -1000, -1000, -1000, 385, 381, 873, 478, 478,
+	-1000, 302, -1000, 300, 294, 292, 298, -1000, -80, 162,
+	123, -81, -82, -1000, -39, -46, -48, -83, -1000, -1000,
+	-1000, -1000, -1000, -1000, 2009, -41, -41, -65, -19, 873,
+	873, 1959, -1000, 873, 873, 236, 873, 873, 233, 873,
+	873, -1000, 873, 873, 1915, -1000, -1000, 322, 340, 2160,
+	-1000, 2160, -1000, 873, -1000, 381, 371, 375, 2160, -1000,
+	281, -1000, -1000, -1000, 296, -1000, 295, -1000, -1000, -1000,
+	-1000, -1000, -1000, -1000, -84, -90, -1000, -41, -38, 198,
+	-38, 155, -1000, 1830, 2160, 873, 2160, 1786, 124, 1736,
+	1673, 120, 1160, 1097, 1610, 1560, 873, 217, 217, 2160,
+	371, 378, 873, 478, 873, -1000, -1000, -1000, -1000, -38,
+	-1000, 196, 384, -1000, -41, 873, 2160, -1000, -1000, 873,
+	873, 189, -1000, -91, -1000, -92, -1000, -1000, 1510, -1000,
+	-1000, 378, 368, 374, 2160, 188, 2204, -1000, 319, 873,
+	-38, 2160, 1460, 1410, 873, 84, 78, -1000, 368, 366,
+	-65, 873, 873, 373, 1360, -1000, -1000, -1000, 1034, -1000,
+	-1000, 366, -1000, -65, -1000, 103, -1000, 971, 1246, 715,
+	-1000, -1000, -93, -1000, -1000, 873, 334, -1000, -1000, 165,
+	37, -1000, -1000, 331, 35, -1000, -1000, -1000, -1000,
 }
 
 var yyPgo = [...]int16{
-	0, 381, 0, 377, 12, 157, 376, 14, 10, 375,
-	373, 372, 9, 371, 370, 368, 367, 366, 365, 13,
-	364, 363, 361, 61, 4, 48, 360, 11, 6, 19,
-	16, 359, 3, 358, 357, 15, 356, 310, 2, 1,
-	354, 353, 7, 5, 350, 8, 348, 346, 177, 345,
+	0, 457, 0, 452, 12, 128, 451, 13, 10, 450,
+	449, 448, 9, 447, 446, 445, 444, 443, 430, 29,
+	429, 427, 425, 144, 4, 45, 424, 11, 6, 19,
+	16, 421, 3, 419, 416, 14, 415, 349, 2, 1,
+	414, 412, 7, 5, 411, 8, 410, 408, 407, 404,
+	172, 401,
 }
 
 var yyR1 = [...]int8{
-	0, 1, 26, 25, 47, 47, 47, 6, 6, 17,
-	17, 48, 48, 48, 18, 18, 29, 29, 29, 29,
-	29, 5, 3, 3, 3, 3, 3, 3, 3, 3,
-	4, 4, 11, 11, 22, 22, 37, 37, 37, 2,
+	0, 1, 26, 25, 47, 47, 47, 49, 49, 48,
+	48, 48, 48, 6, 6, 17, 17, 50, 50, 50,
+	18, 18, 29, 29, 29, 29, 29, 5, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 4, 4, 11,
+	11, 22, 22, 37, 37, 37, 2, 2, 2, 2,
 	2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
 	2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
 	2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
@@ -573,142 +601,147 @@ var yyR1 = [...]int8{
 	2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
 	2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
 	2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
-	2, 2, 28, 28, 36, 36, 32, 32, 32, 33,
-	33, 33, 34, 34, 34, 35, 45, 45, 41, 41,
-	41, 41, 41, 41, 41, 49, 49, 30, 30, 31,
-	31, 31, 24, 19, 19, 19, 19, 23, 10, 10,
-	44, 44, 9, 9, 12, 12, 7, 7, 8, 8,
-	27, 27, 21, 21, 21, 20, 20, 20, 38, 40,
-	40, 39, 39, 42, 42, 43, 43, 13, 13, 13,
-	13, 14, 15, 16, 46, 46, 46,
+	2, 2, 2, 28, 28, 36, 36, 32, 32, 32,
+	33, 33, 33, 34, 34, 34, 35, 45, 45, 41,
+	41, 41, 41, 41, 41, 41, 51, 51, 30, 30,
+	31, 31, 31, 24, 19, 19, 19, 19, 23, 10,
+	10, 44, 44, 9, 9, 12, 12, 7, 7, 8,
+	8, 27, 27, 21, 21, 21, 20, 20, 20, 38,
+	40, 40, 39, 39, 42, 42, 43, 43, 13, 13,
+	13, 13, 14, 15, 16, 46, 46, 46,
 }
 
 var yyR2 = [...]int8{
-	0, 4, 11, 10, 1, 3, 0, 2, 0, 1,
-	0, 0, 3, 4, 6, 7, 3, 2, 1, 1,
-	1, 2, 1, 1, 1, 1, 1, 1, 1, 1,
-	1, 3, 1, 1, 1, 0, 5, 1, 0, 1,
-	7, 6, 6, 8, 5, 4, 6, 6, 8, 8,
-	9, 6, 6, 3, 4, 6, 6, 7, 3, 4,
-	5, 5, 4, 3, 3, 3, 3, 3, 3, 3,
-	3, 3, 3, 3, 3, 3, 2, 5, 3, 5,
-	3, 4, 3, 3, 3, 3, 3, 3, 3, 3,
-	5, 4, 6, 4, 6, 5, 4, 4, 2, 2,
-	3, 3, 3, 4, 3, 4, 3, 4, 3, 4,
-	1, 1, 1, 3, 1, 3, 1, 1, 3, 1,
-	3, 0, 1, 3, 0, 3, 7, 0, 1, 2,
-	2, 3, 2, 3, 2, 1, 2, 1, 0, 2,
-	3, 7, 1, 0, 3, 4, 4, 1, 0, 2,
-	4, 5, 0, 1, 0, 5, 0, 2, 0, 2,
-	0, 3, 0, 2, 2, 0, 1, 1, 3, 3,
-	1, 0, 3, 0, 2, 0, 2, 6, 6, 4,
-	4, 1, 3, 3, 1, 1, 1,
+	0, 5, 11, 10, 2, 4, 0, 1, 0, 3,
+	4, 6, 0, 2, 0, 1, 0, 0, 3, 4,
+	6, 7, 3, 2, 1, 1, 1, 2, 1, 1,
+	1, 1, 1, 1, 1, 1, 1, 1, 3, 1,
+	1, 1, 0, 5, 1, 0, 1, 7, 6, 6,
+	8, 5, 4, 6, 6, 8, 8, 9, 6, 11,
+	8, 6, 8, 5, 3, 4, 6, 6, 7, 3,
+	4, 5, 5, 4, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 2, 5, 3,
+	5, 3, 4, 3, 3, 3, 3, 3, 3, 3,
+	3, 5, 4, 6, 4, 6, 5, 4, 4, 2,
+	2, 3, 3, 3, 4, 3, 4, 3, 4, 3,
+	4, 1, 1, 1, 3, 1, 3, 1, 1, 3,
+	1, 3, 0, 1, 3, 0, 3, 7, 0, 1,
+	2, 2, 3, 2, 3, 2, 1, 2, 1, 0,
+	2, 3, 7, 1, 0, 3, 4, 4, 1, 0,
+	2, 4, 5, 0, 1, 0, 5, 0, 2, 0,
+	2, 0, 3, 0, 2, 2, 0, 1, 1, 3,
+	3, 1, 0, 3, 0, 2, 0, 2, 6, 6,
+	4, 4, 1, 3, 3, 1, 1, 1,
 }
 
 var yyChk = [...]int16{
-	-1000, -1, -47, 18, -17, -18, 16, 21, -26, 7,
-	57, -23, 55, -23, -48, 6, -37, 19, -23, 21,
-	-25, 20, 7, -28, -29, -2, 103, -13, -4, 54,
-	53, 73, 35, 36, 39, 41, 42, 38, 37, 40,
-	79, -23, 22, 102, 71, 70, -16, -15, 28, -3,
-	56, 59, 61, 110, 64, 65, 63, 66, 112, 111,
-	-5, 52, 21, 56, -48, -25, -37, -6, 57, 17,
-	21, -23, 90, 95, 96, 97, 98, 100, 99, 101,
-	102, 103, 104, 105, 106, 107, 88, 89, 86, 70,
-	87, 80, 81, 82, 83, 84, 85, 72, 71, 68,
-	67, 91, 56, 56, -9, -2, 56, 56, 56, 56,
-	56, 56, 56, 56, 56, -19, 56, 109, 59, 56,
+	-1000, -1, -47, 18, -48, 56, -49, 19, -17, -18,
+	16, 17, 56, 68, 22, -26, 7, 58, -23, 56,
+	-5, -23, -5, 56, -23, -50, 6, -37, 20, -23,
+	22, -19, 110, 60, 22, 56, -25, 21, 7, -28,
+	-29, -2, 104, -13, -4, 55, 54, 74, 36, 37,
+	40, 42, 43, 39, 38, 41, 80, -23, 23, 103,
+	72, 71, -16, -15, 29, -3, 57, 60, 62, 111,
+	65, 66, 64, 67, 114, 112, 113, -5, 53, 22,
+	57, -23, -24, 56, 111, -5, -50, -25, -37, -6,
+	58, 17, 22, -23, 30, 91, 96, 97, 98, 99,
+	101, 100, 102, 103, 104, 105, 106, 107, 108, 89,
+	90, 87, 71, 88, 81, 82, 83, 84, 85, 86,
+	73, 72, 69, 68, 92, 57, 57, -9, -2, 57,
+	57, 57, 57, 57, 57, 57, 57, 57, 57, 57,
 	-2, -2, -2, -14, -2, -11, -25, -2, -33, -2,
-	-34, -35, 112, 56, 56, -25, -48, -28, -30, -31,
-	8, -29, -5, -23, -23, 56, -2, -2, -2, -2,
-	-2, -2, -2, -2, -2, -2, -2, -2, -2, 112,
-	112, 78, 112, 112, -2, -2, -2, -2, -2, -2,
-	-4, 89, 88, 86, 70, 87, -2, -2, 63, 71,
-	66, 64, 65, -22, 103, 19, -2, -44, 74, -32,
-	-2, 103, -2, -2, 55, 55, 55, 55, 58, -2,
-	-46, 32, 33, 34, 58, -32, -23, -24, 55, 110,
-	-25, 21, 29, 58, 57, 60, 57, 62, 113, -36,
-	-2, -25, 58, -30, -7, 9, -49, -41, 57, 48,
-	45, 49, 46, 47, 51, -29, -25, -32, 94, 94,
-	112, 68, 112, 112, 78, 112, 112, 63, 66, 64,
-	65, -2, 58, 58, 57, -10, 74, 76, -2, 58,
-	57, 57, 21, 57, 57, 56, 57, 8, 58, 57,
-	8, -2, 58, -19, 60, 60, 58, -23, -23, -2,
-	-35, -2, 58, 57, 58, -7, -27, 10, -2, -29,
-	-29, 45, 45, 45, 50, 45, 50, 45, 58, 58,
-	112, 112, -4, 94, 94, 112, 58, -12, 93, -12,
-	-24, 77, -2, -2, 75, -2, -2, 55, -2, -2,
-	55, -2, -2, -2, -2, 8, -19, -19, 29, 21,
-	-2, -27, -8, 13, 12, 52, 45, 45, 112, 112,
-	-12, -45, 92, 56, -45, 58, 75, -2, 58, 58,
-	57, 57, 58, 58, 58, 58, 58, -2, -23, -23,
-	-8, -39, 11, -2, -28, -2, -45, 56, 9, -12,
-	-2, -2, -2, 57, 58, -39, -42, 14, 12, 80,
-	30, -2, -45, 58, 58, -2, -42, -43, 15, -24,
-	-40, -38, -2, -2, 12, 58, 58, -43, -24, 57,
-	-20, 26, 27, -32, -38, -21, 23, -39, 24, 25,
-	58,
+	-34, -35, 114, 57, 57, -25, -19, 61, 61, 22,
+	-50, -28, -30, -31, 8, -29, -5, -23, 56, 57,
+	-2, -2, -2, -2, -2, -2, -2, -2, -2, -2,
+	-2, -2, -2, 114, 114, 79, 114, 114, -2, -2,
+	-2, -2, -2, -2, -4, 90, 89, 87, 71, 88,
+	-2, -2, 64, 72, 67, 65, 66, -22, 104, 20,
+	-2, -44, 75, -32, -2, 104, -2, -2, 56, 56,
+	56, 56, 59, -2, -46, 33, 34, 35, 59, -32,
+	-25, 22, 30, 59, 58, 61, 58, 63, 115, -36,
+	-2, -25, 59, -19, -19, -30, -7, 9, -51, -41,
+	58, 49, 46, 50, 47, 48, 52, -29, 56, -25,
+	-32, 95, 95, 114, 69, 114, 114, 79, 114, 114,
+	64, 67, 65, 66, -2, 59, 59, 58, -10, 75,
+	77, -2, 59, 58, 58, 22, 58, 58, 57, 58,
+	8, 59, 58, 8, -2, 59, 59, -23, -23, -2,
+	-35, -2, 59, 58, 59, -7, -27, 10, -2, -29,
+	-29, 46, 46, 46, 51, 46, 51, 46, 114, 59,
+	59, 114, 114, -4, 95, 95, 114, 59, -12, 94,
+	-12, -24, 78, -2, -2, 76, -2, -2, 56, -2,
+	-2, 56, -2, -2, -2, -2, 8, 30, 22, -2,
+	-27, -8, 13, 12, 53, 46, 46, 114, 114, -12,
+	-45, 93, 57, -45, 59, 76, -2, 59, 59, 58,
+	58, 59, 59, 58, 59, 58, 59, 59, -2, -23,
+	-23, -8, -39, 11, -2, -28, -2, -45, 57, 9,
+	-12, -2, -2, -2, 58, 114, 114, 59, -39, -42,
+	14, 12, 81, 31, -2, -45, 59, 59, -2, 59,
+	59, -42, -43, 15, -24, -40, -38, -2, -2, 12,
+	59, 59, 58, -43, -24, 58, -20, 27, 28, -32,
+	114, -38, -21, 24, -39, 59, 25, 26, 59,
 }
 
 var yyDef = [...]int16{
-	6, -2, 10, 4, 0, 9, 0, 0, 11, 38,
-	0, 0, 147, 5, 1, 0, 0, 37, 0, 0,
-	11, 0, 38, 8, 112, 18, 19, 20, 39, 0,
-	0, 152, 0, 0, 0, 0, 0, 0, 0, 0,
-	0, 143, 0, 0, 0, 0, 110, 111, 0, 30,
-	0, 121, 124, 22, 23, 24, 25, 26, 27, 28,
-	29, 0, 0, 0, 12, 11, 0, 138, 0, 0,
-	0, 17, 0, 0, 0, 0, 0, 0, 0, 0,
+	6, -2, 12, 8, 16, 0, 4, 7, 0, 15,
+	0, 0, 0, 0, 0, 17, 45, 0, 0, 158,
+	9, 154, 0, 0, 5, 1, 0, 0, 44, 0,
+	0, 27, 0, 0, 10, 0, 17, 0, 45, 14,
+	123, 24, 25, 26, 46, 0, 0, 163, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 154, 0, 0,
+	0, 0, 121, 122, 0, 37, 0, 132, 135, 28,
+	29, 30, 31, 32, 33, 34, 35, 36, 0, 0,
+	0, 154, 0, 0, 153, 0, 18, 17, 0, 149,
+	0, 0, 0, 23, 0, 0, 0, 0, 0, 0,
 	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
 	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-	0, 0, 35, 0, 0, 153, 0, 0, 0, 0,
-	0, 0, 0, 0, 0, 21, 0, 0, 0, 0,
-	76, 98, 99, 0, 181, 0, 32, 33, 0, 119,
-	0, 122, 0, 0, 0, 0, 13, 138, 156, 137,
-	0, 113, 7, 143, 16, 0, 63, 64, 65, 66,
-	67, 68, 69, 70, 71, 72, 73, 74, 75, 78,
-	80, 0, 82, 83, 84, 85, 86, 87, 88, 89,
-	0, 0, 0, 0, 0, 0, 100, 101, 102, 0,
-	104, 106, 108, 0, 0, 34, 0, 148, 0, 0,
-	116, 117, 0, 0, 0, 0, 0, 0, 53, 0,
-	0, 184, 185, 186, 58, 0, 143, 0, 0, 142,
-	0, 0, 0, 31, 0, 183, 0, 182, 0, 0,
-	114, 0, 14, 156, 160, 0, 0, 0, 135, 0,
-	128, 0, 0, 0, 0, 139, 0, 0, 0, 0,
-	81, 0, 91, 93, 0, 96, 97, 103, 105, 107,
-	109, 0, 154, 154, 0, 0, 0, 0, 0, 45,
-	0, 0, 0, 0, 0, 0, 0, 0, 54, 0,
-	0, 0, 59, 144, 143, 143, 62, 179, 180, 120,
-	123, 125, 36, 0, 15, 160, 158, 0, 157, 140,
-	0, 136, 129, 130, 0, 132, 0, 134, 60, 61,
-	77, 79, 90, 0, 0, 95, 154, 127, 0, 127,
-	0, 44, 0, 149, 0, 118, 0, 0, 0, 0,
-	0, 0, 0, 0, 0, 0, 145, 146, 0, 0,
-	115, 158, 171, 0, 0, 0, 131, 133, 92, 94,
-	127, 41, 0, 0, 42, 154, 0, 150, 46, 47,
-	0, 0, 0, 51, 52, 55, 56, 0, 177, 178,
-	171, 173, 0, 159, 161, 0, 40, 0, 0, 127,
-	151, 0, 0, 0, 57, 173, 175, 0, 0, 0,
-	0, 0, 43, 48, 49, 0, 175, 2, 0, 174,
-	172, 170, 165, -2, 0, 155, 50, 3, 176, 0,
-	162, 166, 167, 171, 169, 168, 0, 0, 163, 164,
-	126,
+	0, 0, 0, 0, 0, 42, 0, 0, 164, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	87, 109, 110, 0, 192, 0, 39, 40, 0, 130,
+	0, 133, 0, 0, 0, 0, 155, 154, 154, 11,
+	19, 149, 167, 148, 0, 124, 13, 22, 0, 0,
+	74, 75, 76, 77, 78, 79, 80, 81, 82, 83,
+	84, 85, 86, 89, 91, 0, 93, 94, 95, 96,
+	97, 98, 99, 100, 0, 0, 0, 0, 0, 0,
+	111, 112, 113, 0, 115, 117, 119, 0, 0, 41,
+	0, 159, 0, 0, 127, 128, 0, 0, 0, 0,
+	0, 0, 64, 0, 0, 195, 196, 197, 69, 0,
+	0, 0, 0, 38, 0, 194, 0, 193, 0, 0,
+	125, 0, 20, 156, 157, 167, 171, 0, 0, 0,
+	146, 0, 139, 0, 0, 0, 0, 150, 0, 0,
+	0, 0, 0, 92, 0, 102, 104, 0, 107, 108,
+	114, 116, 118, 120, 0, 165, 165, 0, 0, 0,
+	0, 0, 52, 0, 0, 0, 0, 0, 0, 0,
+	0, 65, 0, 0, 0, 70, 73, 190, 191, 131,
+	134, 136, 43, 0, 21, 171, 169, 0, 168, 151,
+	0, 147, 140, 141, 0, 143, 0, 145, 63, 71,
+	72, 88, 90, 101, 0, 0, 106, 165, 138, 0,
+	138, 0, 51, 0, 160, 0, 129, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 126,
+	169, 182, 0, 0, 0, 142, 144, 103, 105, 138,
+	48, 0, 0, 49, 165, 0, 161, 53, 54, 0,
+	0, 0, 58, 0, 61, 0, 66, 67, 0, 188,
+	189, 182, 184, 0, 170, 172, 0, 47, 0, 0,
+	138, 162, 0, 0, 0, 0, 0, 68, 184, 186,
+	0, 0, 0, 0, 0, 50, 55, 56, 0, 60,
+	62, 186, 2, 0, 185, 183, 181, 176, -2, 0,
+	166, 57, 0, 3, 187, 0, 173, 177, 178, 182,
+	0, 180, 179, 0, 0, 59, 174, 175, 137,
 }
 
 var yyTok1 = [...]int8{
 	1, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 3, 3, 69, 3, 3, 3, 105, 97, 3,
-	56, 58, 103, 101, 57, 102, 109, 104, 3, 3,
-	3, 3, 3, 3, 3, 3, 3, 3, 113, 3,
+	3, 3, 3, 70, 3, 3, 3, 106, 98, 3,
+	57, 59, 104, 102, 58, 103, 110, 105, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 115, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 59, 3, 60, 96, 3, 3, 3, 3, 3,
+	3, 60, 3, 61, 97, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 3, 3, 61, 95, 62, 70,
+	3, 3, 3, 62, 96, 63, 71,
 }
 
 var yyTok2 = [...]int8{
@@ -717,11 +750,11 @@ var yyTok2 = [...]int8{
 	22, 23, 24, 25, 26, 27, 28, 29, 30, 31,
 	32, 33, 34, 35, 36, 37, 38, 39, 40, 41,
 	42, 43, 44, 45, 46, 47, 48, 49, 50, 51,
-	52, 53, 54, 55, 63, 64, 65, 66, 67, 68,
-	71, 72, 73, 74, 75, 76, 77, 78, 79, 80,
+	52, 53, 54, 55, 56, 64, 65, 66, 67, 68,
+	69, 72, 73, 74, 75, 76, 77, 78, 79, 80,
 	81, 82, 83, 84, 85, 86, 87, 88, 89, 90,
-	91, 92, 93, 94, 98, 99, 100, 106, 107, 108,
-	110, 111, 112,
+	91, 92, 93, 94, 95, 99, 100, 101, 107, 108,
+	109, 111, 112, 113, 114,
 }
 
 var yyTok3 = [...]int8{
@@ -1066,10 +1099,10 @@ yydefault:
 	switch yynt {
 
 	case 1:
-		yyDollar = yyS[yypt-4 : yypt+1]
-//line partiql.y:130
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line partiql.y:135
 		{
-			query, err := buildQuery(yyDollar[1].str, yyDollar[2].with, yyDollar[3].selinto, yyDollar[4].unions)
+			query, err := buildQuery(yyDollar[1].explain, yyDollar[2].dml, yyDollar[3].with, yyDollar[4].selinto, yyDollar[5].unions)
 			if err != nil {
 				yylex.Error(err.Error())
 			}
@@ -1078,7 +1111,7 @@ yydefault:
 		}
 	case 2:
 		yyDollar = yyS[yypt-11 : yypt+1]
-//line partiql.y:141
+//line partiql.y:146
 		{
 			distinct, distinctExpr := decodeDistinct(yyDollar[2].values)
 			yyVAL.selinto.sel = &expr.Select{Distinct: distinct, DistinctExpr: distinctExpr, Columns: yyDollar[3].bindings, From: yyDollar[5].from, Where: yyDollar[6].expr, GroupBy: yyDollar[7].bindings, Having: yyDollar[8].expr, OrderBy: yyDollar[9].orders, Limit: yyDollar[10].exprint, Offset: yyDollar[11].exprint}
@@ -1086,232 +1119,274 @@ yydefault:
 		}
 	case 3:
 		yyDollar = yyS[yypt-10 : yypt+1]
-//line partiql.y:149
+//line partiql.y:154
 		{
 			distinct, distinctExpr := decodeDistinct(yyDollar[2].values)
 			yyVAL.sel = &expr.Select{Distinct: distinct, DistinctExpr: distinctExpr, Columns: yyDollar[3].bindings, From: yyDollar[4].from, Where: yyDollar[5].expr, GroupBy: yyDollar[6].bindings, Having: yyDollar[7].expr, OrderBy: yyDollar[8].orders, Limit: yyDollar[9].exprint, Offset: yyDollar[10].exprint}
 		}
 	case 4:
-		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:155
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line partiql.y:160
 		{
-			yyVAL.str = "default"
+			yyVAL.explain = explainClause{format: "default", analyze: yyDollar[2].yesno}
 		}
 	case 5:
-		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:156
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line partiql.y:161
 		{
-			yyVAL.str = yyDollar[3].str
+			yyVAL.explain = explainClause{format: yyDollar[4].str, analyze: yyDollar[2].yesno}
 		}
 	case 6:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line partiql.y:157
+//line partiql.y:162
 		{
-			yyVAL.str = ""
+			yyVAL.explain = explainClause{}
 		}
 	case 7:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line partiql.y:165
+		{
+			yyVAL.yesno = true
+		}
+	case 8:
+		yyDollar = yyS[yypt-0 : yypt+1]
+//line partiql.y:165
+		{
+			yyVAL.yesno = false
+		}
+	case 9:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line partiql.y:172
+		{
+			yyVAL.dml = dmlClause{verb: []string{yyDollar[1].str}, table: yyDollar[3].expr}
+		}
+	case 10:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line partiql.y:173
+		{
+			yyVAL.dml = dmlClause{verb: []string{yyDollar[1].str, yyDollar[2].str}, table: yyDollar[3].expr}
+		}
+	case 11:
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line partiql.y:174
+		{
+			yyVAL.dml = dmlClause{verb: []string{yyDollar[1].str, "OR", yyDollar[3].str, yyDollar[4].str}, table: yyDollar[5].expr}
+		}
+	case 12:
+		yyDollar = yyS[yypt-0 : yypt+1]
+//line partiql.y:175
+		{
+			yyVAL.dml = dmlClause{}
+		}
+	case 13:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line partiql.y:160
+//line partiql.y:178
 		{
 			yyVAL.expr = yyDollar[2].expr
 		}
-	case 8:
+	case 14:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line partiql.y:160
+//line partiql.y:178
 		{
 			yyVAL.expr = nil
 		}
-	case 9:
+	case 15:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:163
+//line partiql.y:181
 		{
 			yyVAL.with = yyDollar[1].with
 		}
-	case 10:
+	case 16:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line partiql.y:163
+//line partiql.y:181
 		{
 			yyVAL.with = nil
 		}
-	case 11:
+	case 17:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line partiql.y:166
+//line partiql.y:184
 		{
 			yyVAL.unions = []unionItem{}
 		}
-	case 12:
+	case 18:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:167
+//line partiql.y:185
 		{
 			yyVAL.unions = append(yyVAL.unions, unionItem{typ: expr.UnionDistinct, sel: yyDollar[2].sel})
 			yyVAL.unions = append(yyVAL.unions, yyDollar[3].unions...)
 		}
-	case 13:
+	case 19:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line partiql.y:171
+//line partiql.y:189
 		{
 			yyVAL.unions = append(yyVAL.unions, unionItem{typ: expr.UnionAll, sel: yyDollar[3].sel})
 			yyVAL.unions = append(yyVAL.unions, yyDollar[4].unions...)
 		}
-	case 14:
+	case 20:
 		yyDollar = yyS[yypt-6 : yypt+1]
-//line partiql.y:177
+//line partiql.y:195
 		{
 			yyVAL.with = []expr.CTE{{Table: yyDollar[2].str, As: yyDollar[5].sel}}
 		}
-	case 15:
+	case 21:
 		yyDollar = yyS[yypt-7 : yypt+1]
-//line partiql.y:178
+//line partiql.y:196
 		{
 			yyVAL.with = append(yyDollar[1].with, expr.CTE{Table: yyDollar[3].str, As: yyDollar[6].sel})
 		}
-	case 16:
+	case 22:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:184
+//line partiql.y:202
 		{
 			yyVAL.bind = expr.Bind(yyDollar[1].expr, yyDollar[3].str)
 		}
-	case 17:
+	case 23:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line partiql.y:185
+//line partiql.y:203
 		{
 			yyVAL.bind = expr.Bind(yyDollar[1].expr, yyDollar[2].str)
 		}
-	case 18:
+	case 24:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:186
+//line partiql.y:204
 		{
 			yyVAL.bind = expr.Bind(yyDollar[1].expr, "")
 		}
-	case 19:
+	case 25:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:187
+//line partiql.y:205
 		{
 			yyVAL.bind = expr.Bind(expr.Star{}, "")
 		}
-	case 20:
+	case 26:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:188
+//line partiql.y:206
 		{
 			yyVAL.bind = expr.Bind(yyDollar[1].expr, "")
 		}
-	case 21:
+	case 27:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line partiql.y:191
+//line partiql.y:209
 		{
 			yyVAL.expr = &expr.Path{First: yyDollar[1].str, Rest: yyDollar[2].pc}
 		}
-	case 22:
+	case 28:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:195
+//line partiql.y:213
 		{
 			yyVAL.expr = yyDollar[1].expr
 		}
-	case 23:
+	case 29:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:196
+//line partiql.y:214
 		{
 			yyVAL.expr = expr.Bool(true)
 		}
-	case 24:
+	case 30:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:197
+//line partiql.y:215
 		{
 			yyVAL.expr = expr.Bool(false)
 		}
-	case 25:
+	case 31:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:198
+//line partiql.y:216
 		{
 			yyVAL.expr = expr.Null{}
 		}
-	case 26:
+	case 32:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:199
+//line partiql.y:217
 		{
 			yyVAL.expr = expr.Missing{}
 		}
-	case 27:
+	case 33:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:200
+//line partiql.y:218
 		{
 			yyVAL.expr = expr.String(yyDollar[1].str)
 		}
-	case 28:
+	case 34:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:201
+//line partiql.y:219
 		{
 			yyVAL.expr = yyDollar[1].expr
 		}
-	case 29:
+	case 35:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:202
+//line partiql.y:220
 		{
 			yyVAL.expr = yyDollar[1].expr
 		}
-	case 30:
+	case 36:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:214
+//line partiql.y:221
 		{
 			yyVAL.expr = yyDollar[1].expr
 		}
-	case 31:
+	case 37:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line partiql.y:233
+		{
+			yyVAL.expr = yyDollar[1].expr
+		}
+	case 38:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:215
+//line partiql.y:234
 		{
 			yyVAL.expr = yyDollar[2].expr
 		}
-	case 32:
+	case 39:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:218
+//line partiql.y:237
 		{
 			yyVAL.expr = yyDollar[1].sel
 		}
-	case 33:
+	case 40:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:219
+//line partiql.y:238
 		{
 			yyVAL.expr = yyDollar[1].expr
 		}
-	case 34:
+	case 41:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:222
+//line partiql.y:241
 		{
 			yyVAL.yesno = true
 		}
-	case 35:
+	case 42:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line partiql.y:222
+//line partiql.y:241
 		{
 			yyVAL.yesno = false
 		}
-	case 36:
+	case 43:
 		yyDollar = yyS[yypt-5 : yypt+1]
-//line partiql.y:225
+//line partiql.y:244
 		{
 			yyVAL.values = yyDollar[4].values
 		}
-	case 37:
+	case 44:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:226
+//line partiql.y:245
 		{
 			yyVAL.values = []expr.Node{}
 		}
-	case 38:
+	case 45:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line partiql.y:227
+//line partiql.y:246
 		{
 			yyVAL.values = nil
 		}
-	case 39:
+	case 46:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:233
+//line partiql.y:252
 		{
 			yyVAL.expr = yyDollar[1].expr
 		}
-	case 40:
+	case 47:
 		yyDollar = yyS[yypt-7 : yypt+1]
-//line partiql.y:237
+//line partiql.y:256
 		{
 			agg, err := toAggregate(expr.AggregateOp(yyDollar[1].integer), yyDollar[4].expr, yyDollar[3].yesno, yyDollar[6].expr, yyDollar[7].wind)
 			if err != nil {
@@ -1319,9 +1394,9 @@ yydefault:
 			}
 			yyVAL.expr = agg
 		}
-	case 41:
+	case 48:
 		yyDollar = yyS[yypt-6 : yypt+1]
-//line partiql.y:245
+//line partiql.y:264
 		{
 			distinct := false
 			agg, err := toAggregate(expr.AggregateOp(yyDollar[1].integer), expr.Star{}, distinct, yyDollar[5].expr, yyDollar[6].wind)
@@ -1330,9 +1405,9 @@ yydefault:
 			}
 			yyVAL.expr = agg
 		}
-	case 42:
+	case 49:
 		yyDollar = yyS[yypt-6 : yypt+1]
-//line partiql.y:254
+//line partiql.y:273
 		{
 			agg, err := createApproxCountDistinct(yyDollar[3].expr, expr.ApproxCountDistinctDefaultPrecision, yyDollar[5].expr, yyDollar[6].wind)
 			if err != nil {
@@ -1340,9 +1415,9 @@ yydefault:
 			}
 			yyVAL.expr = agg
 		}
-	case 43:
+	case 50:
 		yyDollar = yyS[yypt-8 : yypt+1]
-//line partiql.y:262
+//line partiql.y:281
 		{
 			agg, err := createApproxCountDistinct(yyDollar[3].expr, yyDollar[5].integer, yyDollar[7].expr, yyDollar[8].wind)
 			if err != nil {
@@ -1350,27 +1425,27 @@ yydefault:
 			}
 			yyVAL.expr = agg
 		}
-	case 44:
+	case 51:
 		yyDollar = yyS[yypt-5 : yypt+1]
-//line partiql.y:270
+//line partiql.y:289
 		{
 			yyVAL.expr = createCase(yyDollar[2].expr, yyDollar[3].limbs, yyDollar[4].expr)
 		}
-	case 45:
+	case 52:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line partiql.y:274
+//line partiql.y:293
 		{
 			yyVAL.expr = expr.Coalesce(yyDollar[3].values)
 		}
-	case 46:
+	case 53:
 		yyDollar = yyS[yypt-6 : yypt+1]
-//line partiql.y:278
+//line partiql.y:297
 		{
 			yyVAL.expr = expr.NullIf(yyDollar[3].expr, yyDollar[5].expr)
 		}
-	case 47:
+	case 54:
 		yyDollar = yyS[yypt-6 : yypt+1]
-//line partiql.y:282
+//line partiql.y:301
 		{
 			nod, ok := buildCast(yyDollar[3].expr, yyDollar[5].str)
 			if !ok {
@@ -1378,9 +1453,9 @@ yydefault:
 			}
 			yyVAL.expr = nod
 		}
-	case 48:
+	case 55:
 		yyDollar = yyS[yypt-8 : yypt+1]
-//line partiql.y:290
+//line partiql.y:309
 		{
 			part, ok := timePartFor(yyDollar[3].str, "DATE_ADD")
 			if !ok {
@@ -1388,9 +1463,9 @@ yydefault:
 			}
 			yyVAL.expr = expr.DateAdd(part, yyDollar[5].expr, yyDollar[7].expr)
 		}
-	case 49:
+	case 56:
 		yyDollar = yyS[yypt-8 : yypt+1]
-//line partiql.y:298
+//line partiql.y:317
 		{
 			part, ok := timePartFor(yyDollar[3].str, "DATE_DIFF")
 			if !ok {
@@ -1398,9 +1473,9 @@ yydefault:
 			}
 			yyVAL.expr = expr.DateDiff(part, yyDollar[5].expr, yyDollar[7].expr)
 		}
-	case 50:
+	case 57:
 		yyDollar = yyS[yypt-9 : yypt+1]
-//line partiql.y:306
+//line partiql.y:325
 		{
 			dow, ok := weekday(yyDollar[5].str)
 			if strings.ToUpper(yyDollar[3].str) != "WEEK" || !ok {
@@ -1408,9 +1483,9 @@ yydefault:
 			}
 			yyVAL.expr = expr.DateTruncWeekday(yyDollar[8].expr, dow)
 		}
-	case 51:
+	case 58:
 		yyDollar = yyS[yypt-6 : yypt+1]
-//line partiql.y:314
+//line partiql.y:333
 		{
 			part, ok := timePartFor(yyDollar[3].str, "DATE_TRUNC")
 			if !ok {
@@ -1418,9 +1493,29 @@ yydefault:
 			}
 			yyVAL.expr = expr.DateTrunc(part, yyDollar[5].expr)
 		}
-	case 52:
+	case 59:
+		yyDollar = yyS[yypt-11 : yypt+1]
+//line partiql.y:341
+		{
+			dow, ok := weekday(yyDollar[5].str)
+			if strings.ToUpper(yyDollar[3].str) != "WEEK" || !ok {
+				yylex.Error(__yyfmt__.Sprintf("bad DATE_TRUNC part %q(%q)", yyDollar[3].str, yyDollar[5].str))
+			}
+			yyVAL.expr = expr.DateTruncWeekdayZone(yyDollar[8].expr, dow, yyDollar[10].str)
+		}
+	case 60:
+		yyDollar = yyS[yypt-8 : yypt+1]
+//line partiql.y:349
+		{
+			part, ok := timePartFor(yyDollar[3].str, "DATE_TRUNC")
+			if !ok {
+				yylex.Error(__yyfmt__.Sprintf("bad DATE_TRUNC part %q", yyDollar[3].str))
+			}
+			yyVAL.expr = expr.DateTruncZone(part, yyDollar[5].expr, yyDollar[7].str)
+		}
+	case 61:
 		yyDollar = yyS[yypt-6 : yypt+1]
-//line partiql.y:322
+//line partiql.y:357
 		{
 			part, ok := timePartFor(yyDollar[3].str, "EXTRACT")
 			if !ok {
@@ -1428,15 +1523,34 @@ yydefault:
 			}
 			yyVAL.expr = expr.DateExtract(part, yyDollar[5].expr)
 		}
-	case 53:
+	case 62:
+		yyDollar = yyS[yypt-8 : yypt+1]
+//line partiql.y:365
+		{
+			part, ok := timePartFor(yyDollar[3].str, "EXTRACT")
+			if !ok {
+				yylex.Error(__yyfmt__.Sprintf("bad EXTRACT part %q", yyDollar[3].str))
+			}
+			yyVAL.expr = expr.DateExtract(part, expr.Call(expr.AtTimeZone, yyDollar[5].expr, expr.String(yyDollar[7].str)))
+		}
+	case 63:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line partiql.y:373
+		{
+			if !strings.EqualFold(yyDollar[3].str, "TIME") || !strings.EqualFold(yyDollar[4].str, "ZONE") {
+				yylex.Error(__yyfmt__.Sprintf("unexpected %s %s after AT", yyDollar[3].str, yyDollar[4].str))
+			}
+			yyVAL.expr = expr.Call(expr.AtTimeZone, yyDollar[1].expr, expr.String(yyDollar[5].str))
+		}
+	case 64:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:330
+//line partiql.y:380
 		{
 			yyVAL.expr = yylex.(*scanner).utcnow()
 		}
-	case 54:
+	case 65:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line partiql.y:334
+//line partiql.y:384
 		{
 			node, err := createTrimInvocation(trimBoth, yyDollar[3].expr, nil)
 			if err != nil {
@@ -1444,9 +1558,9 @@ yydefault:
 			}
 			yyVAL.expr = node
 		}
-	case 55:
+	case 66:
 		yyDollar = yyS[yypt-6 : yypt+1]
-//line partiql.y:342
+//line partiql.y:392
 		{
 			node, err := createTrimInvocation(trimBoth, yyDollar[3].expr, yyDollar[5].expr)
 			if err != nil {
@@ -1454,9 +1568,9 @@ yydefault:
 			}
 			yyVAL.expr = node
 		}
-	case 56:
+	case 67:
 		yyDollar = yyS[yypt-6 : yypt+1]
-//line partiql.y:350
+//line partiql.y:400
 		{
 			node, err := createTrimInvocation(trimBoth, yyDollar[5].expr, yyDollar[3].expr)
 			if err != nil {
@@ -1464,9 +1578,9 @@ yydefault:
 			}
 			yyVAL.expr = node
 		}
-	case 57:
+	case 68:
 		yyDollar = yyS[yypt-7 : yypt+1]
-//line partiql.y:358
+//line partiql.y:408
 		{
 			node, err := createTrimInvocation(yyDollar[3].integer, yyDollar[6].expr, yyDollar[4].expr)
 			if err != nil {
@@ -1474,9 +1588,9 @@ yydefault:
 			}
 			yyVAL.expr = node
 		}
-	case 58:
+	case 69:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:366
+//line partiql.y:416
 		{
 			op := expr.CallByName(yyDollar[1].str)
 			if op.Private() {
@@ -1484,9 +1598,9 @@ yydefault:
 			}
 			yyVAL.expr = op
 		}
-	case 59:
+	case 70:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line partiql.y:374
+//line partiql.y:424
 		{
 			op := expr.CallByName(yyDollar[1].str, yyDollar[3].values...)
 			if op.Private() {
@@ -1494,489 +1608,489 @@ yydefault:
 			}
 			yyVAL.expr = op
 		}
-	case 60:
+	case 71:
 		yyDollar = yyS[yypt-5 : yypt+1]
-//line partiql.y:382
+//line partiql.y:432
 		{
 			yyVAL.expr = expr.Call(expr.InSubquery, yyDollar[1].expr, yyDollar[4].sel)
 		}
-	case 61:
+	case 72:
 		yyDollar = yyS[yypt-5 : yypt+1]
-//line partiql.y:386
+//line partiql.y:436
 		{
 			yyVAL.expr = expr.In(yyDollar[1].expr, yyDollar[4].values...)
 		}
-	case 62:
+	case 73:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line partiql.y:390
+//line partiql.y:440
 		{
 			yyVAL.expr = exists(yyDollar[3].sel)
 		}
-	case 63:
+	case 74:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:394
+//line partiql.y:444
 		{
 			yyVAL.expr = expr.BitOr(yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 64:
+	case 75:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:398
+//line partiql.y:448
 		{
 			yyVAL.expr = expr.BitXor(yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 65:
+	case 76:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:402
+//line partiql.y:452
 		{
 			yyVAL.expr = expr.BitAnd(yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 66:
+	case 77:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:406
+//line partiql.y:456
 		{
 			yyVAL.expr = expr.ShiftLeftLogical(yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 67:
+	case 78:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:410
+//line partiql.y:460
 		{
 			yyVAL.expr = expr.ShiftRightLogical(yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 68:
+	case 79:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:414
+//line partiql.y:464
 		{
 			yyVAL.expr = expr.ShiftRightArithmetic(yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 69:
+	case 80:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:418
+//line partiql.y:468
 		{
 			yyVAL.expr = expr.Add(yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 70:
+	case 81:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:422
+//line partiql.y:472
 		{
 			yyVAL.expr = expr.Sub(yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 71:
+	case 82:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:426
+//line partiql.y:476
 		{
 			yyVAL.expr = expr.Mul(yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 72:
+	case 83:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:430
+//line partiql.y:480
 		{
 			yyVAL.expr = expr.Div(yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 73:
+	case 84:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:434
+//line partiql.y:484
 		{
 			yyVAL.expr = expr.Mod(yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 74:
+	case 85:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:438
+//line partiql.y:488
 		{
 			yyVAL.expr = expr.Call(expr.Concat, yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 75:
+	case 86:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:442
+//line partiql.y:492
 		{
 			yyVAL.expr = expr.Append(yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 76:
+	case 87:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line partiql.y:446
+//line partiql.y:496
 		{
 			yyVAL.expr = expr.Neg(yyDollar[2].expr)
 		}
-	case 77:
+	case 88:
 		yyDollar = yyS[yypt-5 : yypt+1]
-//line partiql.y:450
+//line partiql.y:500
 		{
 			yyVAL.expr = &expr.StringMatch{Op: expr.Ilike, Expr: yyDollar[1].expr, Pattern: yyDollar[3].str, Escape: yyDollar[5].str}
 		}
-	case 78:
+	case 89:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:454
+//line partiql.y:504
 		{
 			yyVAL.expr = &expr.StringMatch{Op: expr.Ilike, Expr: yyDollar[1].expr, Pattern: yyDollar[3].str}
 		}
-	case 79:
+	case 90:
 		yyDollar = yyS[yypt-5 : yypt+1]
-//line partiql.y:458
+//line partiql.y:508
 		{
 			yyVAL.expr = &expr.StringMatch{Op: expr.Like, Expr: yyDollar[1].expr, Pattern: yyDollar[3].str, Escape: yyDollar[5].str}
 		}
-	case 80:
+	case 91:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:462
+//line partiql.y:512
 		{
 			yyVAL.expr = &expr.StringMatch{Op: expr.Like, Expr: yyDollar[1].expr, Pattern: yyDollar[3].str}
 		}
-	case 81:
+	case 92:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line partiql.y:466
+//line partiql.y:516
 		{
 			yyVAL.expr = &expr.StringMatch{Op: expr.SimilarTo, Expr: yyDollar[1].expr, Pattern: yyDollar[4].str}
 		}
-	case 82:
+	case 93:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:470
+//line partiql.y:520
 		{
 			yyVAL.expr = &expr.StringMatch{Op: expr.RegexpMatch, Expr: yyDollar[1].expr, Pattern: yyDollar[3].str}
 		}
-	case 83:
+	case 94:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:474
+//line partiql.y:524
 		{
 			yyVAL.expr = &expr.StringMatch{Op: expr.RegexpMatchCi, Expr: yyDollar[1].expr, Pattern: yyDollar[3].str}
 		}
-	case 84:
+	case 95:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:478
+//line partiql.y:528
 		{
 			yyVAL.expr = expr.Compare(expr.Equals, yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 85:
+	case 96:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:482
+//line partiql.y:532
 		{
 			yyVAL.expr = expr.Compare(expr.NotEquals, yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 86:
+	case 97:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:486
+//line partiql.y:536
 		{
 			yyVAL.expr = expr.Compare(expr.Less, yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 87:
+	case 98:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:490
+//line partiql.y:540
 		{
 			yyVAL.expr = expr.Compare(expr.LessEquals, yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 88:
+	case 99:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:494
+//line partiql.y:544
 		{
 			yyVAL.expr = expr.Compare(expr.Greater, yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 89:
+	case 100:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:498
+//line partiql.y:548
 		{
 			yyVAL.expr = expr.Compare(expr.GreaterEquals, yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 90:
+	case 101:
 		yyDollar = yyS[yypt-5 : yypt+1]
-//line partiql.y:502
+//line partiql.y:552
 		{
 			yyVAL.expr = expr.Between(yyDollar[1].expr, yyDollar[3].expr, yyDollar[5].expr)
 		}
-	case 91:
+	case 102:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line partiql.y:506
+//line partiql.y:556
 		{
 			yyVAL.expr = &expr.Not{Expr: &expr.StringMatch{Op: expr.Like, Expr: yyDollar[1].expr, Pattern: yyDollar[4].str}}
 		}
-	case 92:
+	case 103:
 		yyDollar = yyS[yypt-6 : yypt+1]
-//line partiql.y:510
+//line partiql.y:560
 		{
 			yyVAL.expr = &expr.Not{Expr: &expr.StringMatch{Op: expr.Like, Expr: yyDollar[1].expr, Pattern: yyDollar[4].str, Escape: yyDollar[6].str}}
 		}
-	case 93:
+	case 104:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line partiql.y:514
+//line partiql.y:564
 		{
 			yyVAL.expr = &expr.Not{Expr: &expr.StringMatch{Op: expr.Like, Expr: yyDollar[1].expr, Pattern: yyDollar[4].str}}
 		}
-	case 94:
+	case 105:
 		yyDollar = yyS[yypt-6 : yypt+1]
-//line partiql.y:518
+//line partiql.y:568
 		{
 			yyVAL.expr = &expr.Not{Expr: &expr.StringMatch{Op: expr.Ilike, Expr: yyDollar[1].expr, Pattern: yyDollar[4].str, Escape: yyDollar[6].str}}
 		}
-	case 95:
+	case 106:
 		yyDollar = yyS[yypt-5 : yypt+1]
-//line partiql.y:522
+//line partiql.y:572
 		{
 			yyVAL.expr = &expr.Not{Expr: &expr.StringMatch{Op: expr.SimilarTo, Expr: yyDollar[1].expr, Pattern: yyDollar[5].str}}
 		}
-	case 96:
+	case 107:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line partiql.y:526
+//line partiql.y:576
 		{
 			yyVAL.expr = &expr.Not{Expr: &expr.StringMatch{Op: expr.RegexpMatch, Expr: yyDollar[1].expr, Pattern: yyDollar[4].str}}
 		}
-	case 97:
+	case 108:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line partiql.y:530
+//line partiql.y:580
 		{
 			yyVAL.expr = &expr.Not{Expr: &expr.StringMatch{Op: expr.RegexpMatchCi, Expr: yyDollar[1].expr, Pattern: yyDollar[4].str}}
 		}
-	case 98:
+	case 109:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line partiql.y:534
+//line partiql.y:584
 		{
 			yyVAL.expr = &expr.Not{Expr: yyDollar[2].expr}
 		}
-	case 99:
+	case 110:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line partiql.y:538
+//line partiql.y:588
 		{
 			yyVAL.expr = expr.BitNot(yyDollar[2].expr)
 		}
-	case 100:
+	case 111:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:542
+//line partiql.y:592
 		{
 			yyVAL.expr = expr.And(yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 101:
+	case 112:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:546
+//line partiql.y:596
 		{
 			yyVAL.expr = expr.Or(yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 102:
+	case 113:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:550
+//line partiql.y:600
 		{
 			yyVAL.expr = &expr.IsKey{Key: expr.IsNull, Expr: yyDollar[1].expr}
 		}
-	case 103:
+	case 114:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line partiql.y:554
+//line partiql.y:604
 		{
 			yyVAL.expr = &expr.IsKey{Key: expr.IsNotNull, Expr: yyDollar[1].expr}
 		}
-	case 104:
+	case 115:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:558
+//line partiql.y:608
 		{
 			yyVAL.expr = &expr.IsKey{Key: expr.IsMissing, Expr: yyDollar[1].expr}
 		}
-	case 105:
+	case 116:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line partiql.y:562
+//line partiql.y:612
 		{
 			yyVAL.expr = &expr.IsKey{Key: expr.IsNotMissing, Expr: yyDollar[1].expr}
 		}
-	case 106:
+	case 117:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:566
+//line partiql.y:616
 		{
 			yyVAL.expr = &expr.IsKey{Key: expr.IsTrue, Expr: yyDollar[1].expr}
 		}
-	case 107:
+	case 118:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line partiql.y:570
+//line partiql.y:620
 		{
 			yyVAL.expr = &expr.IsKey{Key: expr.IsNotTrue, Expr: yyDollar[1].expr}
 		}
-	case 108:
+	case 119:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:574
+//line partiql.y:624
 		{
 			yyVAL.expr = &expr.IsKey{Key: expr.IsFalse, Expr: yyDollar[1].expr}
 		}
-	case 109:
+	case 120:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line partiql.y:578
+//line partiql.y:628
 		{
 			yyVAL.expr = &expr.IsKey{Key: expr.IsNotFalse, Expr: yyDollar[1].expr}
 		}
-	case 110:
+	case 121:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:583
+//line partiql.y:633
 		{
 			yyVAL.expr = yyDollar[1].expr
 		}
-	case 111:
+	case 122:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:588
+//line partiql.y:638
 		{
 			yyVAL.expr = yyDollar[1].expr
 		}
-	case 112:
+	case 123:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:594
+//line partiql.y:644
 		{
 			yyVAL.bindings = []expr.Binding{yyDollar[1].bind}
 		}
-	case 113:
+	case 124:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:595
+//line partiql.y:645
 		{
 			yyVAL.bindings = append(yyDollar[1].bindings, yyDollar[3].bind)
 		}
-	case 114:
+	case 125:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:599
+//line partiql.y:649
 		{
 			yyVAL.values = []expr.Node{yyDollar[1].expr}
 		}
-	case 115:
+	case 126:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:600
+//line partiql.y:650
 		{
 			yyVAL.values = append(yyDollar[1].values, yyDollar[3].expr)
 		}
-	case 116:
+	case 127:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:604
+//line partiql.y:654
 		{
 			yyVAL.values = []expr.Node{yyDollar[1].expr}
 		}
-	case 117:
+	case 128:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:605
+//line partiql.y:655
 		{
 			yyVAL.values = []expr.Node{expr.Star{}}
 		}
-	case 118:
+	case 129:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:606
+//line partiql.y:656
 		{
 			yyVAL.values = append(yyDollar[1].values, yyDollar[3].expr)
 		}
-	case 119:
+	case 130:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:610
+//line partiql.y:660
 		{
 			yyVAL.values = []expr.Node{yyDollar[1].expr}
 		}
-	case 120:
+	case 131:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:611
+//line partiql.y:661
 		{
 			yyVAL.values = append(yyDollar[1].values, yyDollar[3].expr)
 		}
-	case 121:
+	case 132:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line partiql.y:612
+//line partiql.y:662
 		{
 			yyVAL.values = nil
 		}
-	case 122:
+	case 133:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:616
+//line partiql.y:666
 		{
 			yyVAL.values = yyDollar[1].values
 		}
-	case 123:
+	case 134:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:617
+//line partiql.y:667
 		{
 			yyVAL.values = append(yyDollar[1].values, yyDollar[3].values...)
 		}
-	case 124:
+	case 135:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line partiql.y:618
+//line partiql.y:668
 		{
 			yyVAL.values = nil
 		}
-	case 125:
+	case 136:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:622
+//line partiql.y:672
 		{
 			yyVAL.values = []expr.Node{expr.String(yyDollar[1].str), yyDollar[3].expr}
 		}
-	case 126:
+	case 137:
 		yyDollar = yyS[yypt-7 : yypt+1]
-//line partiql.y:626
+//line partiql.y:676
 		{
 			yyVAL.wind = &expr.Window{PartitionBy: yyDollar[5].values, OrderBy: yyDollar[6].orders}
 		}
-	case 127:
+	case 138:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line partiql.y:629
+//line partiql.y:679
 		{
 			yyVAL.wind = nil
 		}
-	case 128:
+	case 139:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:632
+//line partiql.y:682
 		{
 			yyVAL.jk = expr.InnerJoin
 		}
-	case 129:
+	case 140:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line partiql.y:633
+//line partiql.y:683
 		{
 			yyVAL.jk = expr.InnerJoin
 		}
-	case 130:
+	case 141:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line partiql.y:634
+//line partiql.y:684
 		{
 			yyVAL.jk = expr.LeftJoin
 		}
-	case 131:
+	case 142:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:635
+//line partiql.y:685
 		{
 			yyVAL.jk = expr.LeftJoin
 		}
-	case 132:
+	case 143:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line partiql.y:636
+//line partiql.y:686
 		{
 			yyVAL.jk = expr.RightJoin
 		}
-	case 133:
+	case 144:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:637
+//line partiql.y:687
 		{
 			yyVAL.jk = expr.RightJoin
 		}
-	case 134:
+	case 145:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line partiql.y:638
+//line partiql.y:688
 		{
 			yyVAL.jk = expr.FullJoin
 		}
-	case 137:
+	case 148:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:643
+//line partiql.y:693
 		{
 			yyVAL.from = yyDollar[1].from
 		}
-	case 138:
+	case 149:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line partiql.y:644
+//line partiql.y:694
 		{
 			yyVAL.from = nil
 		}
-	case 139:
+	case 150:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line partiql.y:651
+//line partiql.y:701
 		{
 			yyVAL.from = &expr.Table{Binding: yyDollar[2].bind}
 		}
-	case 140:
+	case 151:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:652
+//line partiql.y:702
 		{
 			yyVAL.from = &expr.Join{Kind: expr.CrossJoin, Left: yyDollar[1].from, Right: yyDollar[3].bind}
 		}
-	case 141:
+	case 152:
 		yyDollar = yyS[yypt-7 : yypt+1]
-//line partiql.y:654
+//line partiql.y:704
 		{
 			yyVAL.from = &expr.Join{Kind: yyDollar[2].jk, Left: yyDollar[1].from, Right: yyDollar[3].bind, On: &expr.OnEquals{Left: yyDollar[5].expr, Right: yyDollar[7].expr}}
 		}
-	case 142:
+	case 153:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:657
+//line partiql.y:707
 		{
 			var idxerr error
 			yyVAL.integer, idxerr = toint(yyDollar[1].expr)
@@ -1984,275 +2098,275 @@ yydefault:
 				yylex.Error(idxerr.Error())
 			}
 		}
-	case 143:
+	case 154:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line partiql.y:660
+//line partiql.y:710
 		{
 			yyVAL.pc = nil
 		}
-	case 144:
+	case 155:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:661
+//line partiql.y:711
 		{
 			yyVAL.pc = &expr.Dot{Field: yyDollar[2].str, Rest: yyDollar[3].pc}
 		}
-	case 145:
+	case 156:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line partiql.y:662
+//line partiql.y:712
 		{
 			yyVAL.pc = &expr.LiteralIndex{Field: yyDollar[2].integer, Rest: yyDollar[4].pc}
 		}
-	case 146:
+	case 157:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line partiql.y:663
+//line partiql.y:713
 		{
 			yyVAL.pc = &expr.Dot{Field: yyDollar[2].str, Rest: yyDollar[4].pc}
 		}
-	case 147:
+	case 158:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:672
+//line partiql.y:722
 		{
 			yyVAL.str = yyDollar[1].str
 		}
-	case 148:
+	case 159:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line partiql.y:675
+//line partiql.y:725
 		{
 			yyVAL.expr = nil
 		}
-	case 149:
+	case 160:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line partiql.y:676
+//line partiql.y:726
 		{
 			yyVAL.expr = yyDollar[2].expr
 		}
-	case 150:
+	case 161:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line partiql.y:679
+//line partiql.y:729
 		{
 			yyVAL.limbs = []expr.CaseLimb{{When: yyDollar[2].expr, Then: yyDollar[4].expr}}
 		}
-	case 151:
+	case 162:
 		yyDollar = yyS[yypt-5 : yypt+1]
-//line partiql.y:680
+//line partiql.y:730
 		{
 			yyVAL.limbs = append(yyDollar[1].limbs, expr.CaseLimb{When: yyDollar[3].expr, Then: yyDollar[5].expr})
 		}
-	case 152:
+	case 163:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line partiql.y:683
+//line partiql.y:733
 		{
 			yyVAL.expr = nil
 		}
-	case 153:
+	case 164:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:684
+//line partiql.y:734
 		{
 			yyVAL.expr = yyDollar[1].expr
 		}
-	case 154:
+	case 165:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line partiql.y:687
+//line partiql.y:737
 		{
 			yyVAL.expr = nil
 		}
-	case 155:
+	case 166:
 		yyDollar = yyS[yypt-5 : yypt+1]
-//line partiql.y:688
+//line partiql.y:738
 		{
 			yyVAL.expr = yyDollar[4].expr
 		}
-	case 156:
+	case 167:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line partiql.y:691
+//line partiql.y:741
 		{
 			yyVAL.expr = nil
 		}
-	case 157:
+	case 168:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line partiql.y:692
+//line partiql.y:742
 		{
 			yyVAL.expr = yyDollar[2].expr
 		}
-	case 158:
+	case 169:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line partiql.y:695
+//line partiql.y:745
 		{
 			yyVAL.expr = nil
 		}
-	case 159:
+	case 170:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line partiql.y:696
+//line partiql.y:746
 		{
 			yyVAL.expr = yyDollar[2].expr
 		}
-	case 160:
+	case 171:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line partiql.y:699
+//line partiql.y:749
 		{
 			yyVAL.bindings = nil
 		}
-	case 161:
+	case 172:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:700
+//line partiql.y:750
 		{
 			yyVAL.bindings = yyDollar[3].bindings
 		}
-	case 162:
+	case 173:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line partiql.y:704
+//line partiql.y:754
 		{
 			yyVAL.yesno = false
 		}
-	case 163:
+	case 174:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line partiql.y:705
+//line partiql.y:755
 		{
 			yyVAL.yesno = false
 		}
-	case 164:
+	case 175:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line partiql.y:706
+//line partiql.y:756
 		{
 			yyVAL.yesno = true
 		}
-	case 165:
+	case 176:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line partiql.y:710
+//line partiql.y:760
 		{
 			yyVAL.yesno = false
 		}
-	case 166:
+	case 177:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:711
+//line partiql.y:761
 		{
 			yyVAL.yesno = false
 		}
-	case 167:
+	case 178:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:712
+//line partiql.y:762
 		{
 			yyVAL.yesno = true
 		}
-	case 168:
+	case 179:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:716
+//line partiql.y:766
 		{
 			yyVAL.order = expr.Order{Column: yyDollar[1].expr, Desc: yyDollar[2].yesno, NullsLast: yyDollar[3].yesno}
 		}
-	case 169:
+	case 180:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:719
+//line partiql.y:769
 		{
 			yyVAL.orders = append(yyDollar[1].orders, yyDollar[3].order)
 		}
-	case 170:
+	case 181:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:720
+//line partiql.y:770
 		{
 			yyVAL.orders = []expr.Order{yyDollar[1].order}
 		}
-	case 171:
+	case 182:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line partiql.y:723
+//line partiql.y:773
 		{
 			yyVAL.orders = nil
 		}
-	case 172:
+	case 183:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:724
+//line partiql.y:774
 		{
 			yyVAL.orders = yyDollar[3].orders
 		}
-	case 173:
+	case 184:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line partiql.y:727
+//line partiql.y:777
 		{
 			yyVAL.exprint = nil
 		}
-	case 174:
+	case 185:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line partiql.y:728
+//line partiql.y:778
 		{
 			n := expr.Integer(yyDollar[2].integer)
 			yyVAL.exprint = &n
 		}
-	case 175:
+	case 186:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line partiql.y:731
+//line partiql.y:781
 		{
 			yyVAL.exprint = nil
 		}
-	case 176:
+	case 187:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line partiql.y:732
+//line partiql.y:782
 		{
 			n := expr.Integer(yyDollar[2].integer)
 			yyVAL.exprint = &n
 		}
-	case 177:
+	case 188:
 		yyDollar = yyS[yypt-6 : yypt+1]
-//line partiql.y:735
+//line partiql.y:785
 		{ /*Cloning, as the buffer gets overwritten*/
 			as := yyDollar[4].str
 			at := yyDollar[6].str
 			yyVAL.expr = &expr.Unpivot{TupleRef: yyDollar[2].expr, As: &as, At: &at}
 		}
-	case 178:
+	case 189:
 		yyDollar = yyS[yypt-6 : yypt+1]
-//line partiql.y:736
+//line partiql.y:786
 		{ /*Cloning, as the buffer gets overwritten*/
 			as := yyDollar[6].str
 			at := yyDollar[4].str
 			yyVAL.expr = &expr.Unpivot{TupleRef: yyDollar[2].expr, As: &as, At: &at}
 		}
-	case 179:
+	case 190:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line partiql.y:737
+//line partiql.y:787
 		{ /*Cloning, as the buffer gets overwritten*/
 			as := yyDollar[4].str
 			yyVAL.expr = &expr.Unpivot{TupleRef: yyDollar[2].expr, As: &as, At: nil}
 		}
-	case 180:
+	case 191:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line partiql.y:738
+//line partiql.y:788
 		{ /*Cloning, as the buffer gets overwritten*/
 			at := yyDollar[4].str
 			yyVAL.expr = &expr.Unpivot{TupleRef: yyDollar[2].expr, As: nil, At: &at}
 		}
-	case 181:
+	case 192:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:741
+//line partiql.y:794
 		{
 			yyVAL.expr = &expr.Table{Binding: expr.Bind(yyDollar[1].expr, "")}
 		}
-	case 182:
+	case 193:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:744
+//line partiql.y:797
 		{
 			yyVAL.expr = expr.Call(expr.MakeStruct, yyDollar[2].values...)
 		}
-	case 183:
+	case 194:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line partiql.y:747
+//line partiql.y:800
 		{
 			yyVAL.expr = expr.Call(expr.MakeList, yyDollar[2].values...)
 		}
-	case 184:
+	case 195:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:750
+//line partiql.y:803
 		{
 			yyVAL.integer = trimLeading
 		}
-	case 185:
+	case 196:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:751
+//line partiql.y:804
 		{
 			yyVAL.integer = trimTrailing
 		}
-	case 186:
+	case 197:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line partiql.y:752
+//line partiql.y:805
 		{
 			yyVAL.integer = trimBoth
 		}
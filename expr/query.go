@@ -41,9 +41,49 @@ func (c *CTE) Equals(other *CTE) bool {
 	return c.Table == other.Table && c.As.Equals(other.As)
 }
 
+// IntoMode describes how the results
+// of a query with an INTO table are stored.
+type IntoMode int
+
+const (
+	// IntoNew stores the results of
+	// SELECT ... INTO in a new table
+	// with a generated name.
+	IntoNew IntoMode = iota
+	// IntoInsert appends the results of
+	// INSERT INTO to an existing table.
+	IntoInsert
+	// IntoCreate stores the results of
+	// CREATE TABLE ... AS in a new table.
+	IntoCreate
+	// IntoReplace stores the results of
+	// CREATE OR REPLACE TABLE ... AS in a
+	// new table or replaces the contents
+	// of an existing table.
+	IntoReplace
+)
+
+func (m IntoMode) String() string {
+	switch m {
+	case IntoNew:
+		return "SELECT INTO"
+	case IntoInsert:
+		return "INSERT INTO"
+	case IntoCreate:
+		return "CREATE TABLE"
+	case IntoReplace:
+		return "CREATE OR REPLACE TABLE"
+	}
+	return fmt.Sprintf("IntoMode(%d)", int(m))
+}
+
 // Query contains a complete query.
 type Query struct {
 	Explain ExplainFormat
+	// Analyze is set for EXPLAIN ANALYZE,
+	// which executes the query in order to
+	// report its runtime statistics.
+	Analyze bool
 
 	With []CTE
 	// Into, if non-nil, is the INTO
@@ -51,6 +91,9 @@ type Query struct {
 	// a SELECT-FROM-WHERE that includes
 	// an INTO clause.
 	Into Node
+	// IntoMode determines how the
+	// results are stored in Into.
+	IntoMode IntoMode
 	// Body is the body of the query.
 	// Body can be:
 	//   - A SELECT expression
@@ -72,15 +115,37 @@ func (q *Query) Text() string {
 }
 
 func (q *Query) text(dst *strings.Builder, redact bool) {
-	switch q.Explain {
-	case ExplainDefault:
+	if q.Explain != ExplainNone {
 		dst.WriteString("EXPLAIN ")
+		if q.Analyze {
+			dst.WriteString("ANALYZE ")
+		}
+	}
+	switch q.Explain {
 	case ExplainText:
-		dst.WriteString("EXPLAIN AS text ")
+		dst.WriteString("AS text ")
 	case ExplainList:
-		dst.WriteString("EXPLAIN AS list ")
+		dst.WriteString("AS list ")
 	case ExplainGraphviz:
-		dst.WriteString("EXPLAIN AS graphviz ")
+		dst.WriteString("AS graphviz ")
+	}
+	into := q.Into
+	switch q.IntoMode {
+	case IntoInsert:
+		dst.WriteString("INSERT INTO ")
+	case IntoCreate:
+		dst.WriteString("CREATE TABLE ")
+	case IntoReplace:
+		dst.WriteString("CREATE OR REPLACE TABLE ")
+	}
+	if q.IntoMode != IntoNew && q.Into != nil {
+		q.Into.text(dst, redact)
+		if q.IntoMode == IntoInsert {
+			dst.WriteByte(' ')
+		} else {
+			dst.WriteString(" AS ")
+		}
+		into = nil
 	}
 
 	if len(q.With) > 0 {
@@ -95,7 +160,7 @@ func (q *Query) text(dst *strings.Builder, redact bool) {
 	}
 	if s, ok := q.Body.(*Select); ok {
 		// do not parenthesize final SELECT
-		s.write(dst, redact, q.Into)
+		s.write(dst, redact, into)
 	} else {
 		q.Body.text(dst, redact)
 	}
@@ -137,6 +202,11 @@ func (q *Query) Encode(dst *ion.Buffer, st *ion.Symtab) {
 	field("explain")
 	dst.WriteInt(int64(q.Explain))
 
+	if q.Analyze {
+		field("analyze")
+		dst.WriteBool(true)
+	}
+
 	if len(q.With) > 0 {
 		field("with")
 		dst.BeginList(-1)
@@ -150,6 +220,10 @@ func (q *Query) Encode(dst *ion.Buffer, st *ion.Symtab) {
 		field("into")
 		q.Into.Encode(dst, st)
 	}
+	if q.IntoMode != IntoNew {
+		field("into_mode")
+		dst.WriteInt(int64(q.IntoMode))
+	}
 	field("body")
 	q.Body.Encode(dst, st)
 	dst.EndStruct()
@@ -192,6 +266,12 @@ func DecodeQuery(st *ion.Symtab, msg []byte) (*Query, []byte, error) {
 
 			q.Explain = ExplainFormat(v)
 
+		case "analyze":
+			q.Analyze, _, err = ion.ReadBool(msg)
+			if err != nil {
+				return err
+			}
+
 		case "with":
 			hastable := false
 			var table string
@@ -228,6 +308,11 @@ func DecodeQuery(st *ion.Symtab, msg []byte) (*Query, []byte, error) {
 		case "into":
 			q.Into, _, err = Decode(st, msg)
 
+		case "into_mode":
+			var v int64
+			v, _, err = ion.ReadInt(msg)
+			q.IntoMode = IntoMode(v)
+
 		case "body":
 			q.Body, _, err = Decode(st, msg)
 
@@ -267,6 +352,15 @@ func (q *Query) CheckHint(h Hint) error {
 		with[name] = q.With[i].As
 	}
 
+	if q.IntoMode != IntoNew {
+		if q.Into == nil {
+			return fmt.Errorf("%s without a table", q.IntoMode)
+		}
+		if _, ok := q.Body.(*Select); !ok {
+			return fmt.Errorf("%s requires a SELECT", q.IntoMode)
+		}
+	}
+
 	// TODO: check references between CTEs and the main query
 	return CheckHint(q.Body, h)
 }
@@ -19,6 +19,8 @@ import (
 	"encoding/binary"
 	"math"
 
+	"github.com/SnellerInc/sneller/ion"
+
 	"github.com/dchest/siphash"
 )
 
@@ -55,3 +57,27 @@ func redactString(s string) string {
 	binary.LittleEndian.PutUint64(buf[:], res)
 	return base32.StdEncoding.EncodeToString(buf[:])
 }
+
+// Redact writes the redacted equivalent of d
+// into dst. Integers, floats, and strings are
+// hashed in the same way that constants are
+// redacted in query text; every other value is
+// replaced with NULL.
+func Redact(dst *ion.Buffer, d ion.Datum) {
+	switch d.Type() {
+	case ion.IntType:
+		i, _ := d.Int()
+		dst.WriteInt(redactInt(i))
+	case ion.UintType:
+		u, _ := d.Uint()
+		dst.WriteInt(redactInt(int64(u)))
+	case ion.FloatType:
+		f, _ := d.Float()
+		dst.WriteFloat64(redactFloat(f))
+	case ion.StringType, ion.SymbolType:
+		s, _ := d.String()
+		dst.WriteString(redactString(s))
+	default:
+		dst.WriteNull()
+	}
+}
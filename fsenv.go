@@ -18,7 +18,9 @@ import (
 	"fmt"
 	"hash"
 	"io"
+	"io/fs"
 	"path"
+	"strings"
 	"time"
 
 	"github.com/SnellerInc/sneller/date"
@@ -38,6 +40,9 @@ type CachedEnv interface {
 type savedIndex struct {
 	db, table string
 	index     *blockfmt.Index
+	masks     []db.Mask
+	filter    expr.Node
+	schema    expr.Hint
 }
 
 type savedList struct {
@@ -50,6 +55,10 @@ type FSEnv struct {
 	Root   db.FS
 	db     string
 	tenant db.Tenant
+	// config is the tenant configuration,
+	// or nil if the tenant does not implement
+	// db.TenantConfigurable
+	config *db.TenantConfig
 
 	recent []savedIndex
 	lists  []savedList
@@ -70,8 +79,13 @@ func Environ(t db.Tenant, dbname string) (*FSEnv, error) {
 		return nil, fmt.Errorf("db %T from auth cannot be used for reading", root)
 	}
 	h, _ := blake2b.New256(nil)
+	var cfg *db.TenantConfig
+	if tc, ok := t.(db.TenantConfigurable); ok {
+		cfg = tc.Config()
+	}
 	return &FSEnv{
 		tenant: t,
+		config: cfg,
 		Root:   src,
 		db:     dbname,
 		hash:   h,
@@ -100,13 +114,28 @@ func (f *FSEnv) CacheValues() ([]byte, time.Time) {
 	return f.hash.Sum(nil), f.modtime.Time()
 }
 
+// Tables returns the tables that were referenced
+// by the queries planned using f as "db.table",
+// in the order in which they were first referenced.
+func (f *FSEnv) Tables() []string {
+	out := make([]string, len(f.recent))
+	for i := range f.recent {
+		out[i] = f.recent[i].db + "." + f.recent[i].table
+	}
+	return out
+}
+
 var _ plan.Indexer = (*FSEnv)(nil)
 
 func (f *FSEnv) Index(p expr.Node) (plan.Index, error) {
-	return f.index(p)
+	saved, err := f.index(p)
+	if err != nil {
+		return nil, err
+	}
+	return saved.index, nil
 }
 
-func (f *FSEnv) index(e expr.Node) (*blockfmt.Index, error) {
+func (f *FSEnv) index(e expr.Node) (*savedIndex, error) {
 	var dbname, table string
 	var err error
 	p, ok := e.(*expr.Path)
@@ -128,24 +157,64 @@ func (f *FSEnv) index(e expr.Node) (*blockfmt.Index, error) {
 	if err != nil {
 		return nil, err
 	}
+	return f.load(dbname, table)
+}
 
+// Load loads the indexes of the given tables,
+// formatted as they are by Tables, in order.
+// Loading the tables that were referenced by
+// a query with a new FSEnv reproduces the
+// hash returned by CacheValues for the query
+// if none of the tables have been modified.
+func (f *FSEnv) Load(tables []string) error {
+	for _, t := range tables {
+		dbname, table, ok := strings.Cut(t, ".")
+		if !ok {
+			return syntax("no database+table reference in %q", t)
+		}
+		if _, err := f.load(dbname, table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FSEnv) load(dbname, table string) (*savedIndex, error) {
 	// if a query references the same table
 	// more than once (common with CTEs, nested SELECTs, etc.),
 	// then don't load the index more than once; it is expensive
 	for i := range f.recent {
 		if f.recent[i].db == dbname && f.recent[i].table == table {
-			return f.recent[i].index, nil
+			return &f.recent[i], nil
 		}
 	}
-	index, err := db.OpenPartialIndex(f.Root, dbname, table, f.tenant.Key())
+	grant, ok := f.config.Access(dbname, table)
+	if !ok {
+		return nil, fmt.Errorf("table %s.%s: %w", dbname, table, fs.ErrPermission)
+	}
+	var masks []db.Mask
+	var filter expr.Node
+	var err error
+	if grant != nil {
+		masks = grant.Masks
+		filter, err = grant.RowFilter()
+		if err != nil {
+			return nil, err
+		}
+	}
+	index, err := db.OpenIndexFor(f.Root, dbname, table, f.tenant, blockfmt.FlagSkipInputs)
 	if err != nil {
 		return nil, err
 	}
 	f.recent = append(f.recent, savedIndex{
-		db:    dbname,
-		table: table,
-		index: index,
+		db:     dbname,
+		table:  table,
+		index:  index,
+		masks:  masks,
+		filter: filter,
+		schema: maskedHint(f.schema(dbname, table), masks),
 	})
+	saved := &f.recent[len(f.recent)-1]
 	if f.modtime.IsZero() || f.modtime.Before(index.Created) {
 		f.modtime = index.Created
 	}
@@ -155,12 +224,88 @@ func (f *FSEnv) index(e expr.Node) (*blockfmt.Index, error) {
 	// ought to be unique per-input
 	io.WriteString(f.hash, path.Join(dbname, table))
 	io.WriteString(f.hash, index.Created.String())
-	return index, nil
+	// the results of a query also depend
+	// on the grant that allows access to the table
+	if grant != nil {
+		io.WriteString(f.hash, grant.Filter)
+		for i := range masks {
+			fmt.Fprintf(f.hash, "%s:%v", masks[i].Path, masks[i].Action)
+		}
+	}
+	return saved, nil
+}
+
+// schema returns the type hints for the
+// declared schema of a table, or nil if the
+// table has no (valid) declared schema
+func (f *FSEnv) schema(dbname, table string) expr.Hint {
+	def, err := db.OpenDefinition(f.Root, dbname, table)
+	if err != nil || def.Schema == nil {
+		return nil
+	}
+	h, err := def.Schema.Hint(def.Partitions)
+	if err != nil {
+		return nil
+	}
+	return h
+}
+
+var _ plan.Schemer = (*FSEnv)(nil)
+
+// Schema implements plan.Schemer.Schema
+//
+// The schema of a table is the Schema
+// declared in its db.Definition, if any.
+func (f *FSEnv) Schema(e expr.Node) expr.Hint {
+	saved, err := f.index(e)
+	if err != nil {
+		return nil
+	}
+	return saved.schema
+}
+
+var _ plan.Masker = (*FSEnv)(nil)
+
+// Mask implements plan.Masker.Mask
+//
+// References to hidden fields are replaced
+// with MISSING. References to fields that are
+// nulled or redacted are left as-is, since the
+// table handle masks them before they are
+// evaluated by the query.
+func (f *FSEnv) Mask(e expr.Node, p *expr.Path) expr.Node {
+	saved, err := f.index(e)
+	if err != nil || len(saved.masks) == 0 {
+		return nil
+	}
+	return newMaskTree(saved.masks).mask(p)
+}
+
+var _ plan.RowFilterer = (*FSEnv)(nil)
+
+// RowFilter implements plan.RowFilterer.RowFilter
+//
+// The row filter for a table is determined
+// by the db.Grant that grants the tenant
+// access to the table.
+func (f *FSEnv) RowFilter(e expr.Node) (expr.Node, error) {
+	saved, err := f.index(e)
+	if err != nil {
+		return nil, err
+	}
+	return saved.filter, nil
 }
 
 // Stat implements plan.Env.Stat
+//
+// If the tenant has a db.TenantConfig,
+// then Stat only succeeds for tables that
+// the configuration grants access to, and
+// the returned handle carries the column
+// masks that apply to the table, along
+// with the row filter in h, if any.
 func (f *FSEnv) Stat(e expr.Node, h *plan.Hints) (plan.TableHandle, error) {
-	index, err := f.index(e)
+	saved, err := f.index(e)
 	if err != nil {
 		return nil, err
 	}
@@ -168,9 +313,24 @@ func (f *FSEnv) Stat(e expr.Node, h *plan.Hints) (plan.TableHandle, error) {
 		Expr:      h.Filter,
 		Fields:    h.Fields,
 		AllFields: h.AllFields,
+		Masks:     saved.masks,
+		RowFilter: h.RowFilter,
 	}
-	fh.compiled.Compile(fh.Expr)
-	blobs, err := db.Blobs(f.Root, index, &fh.compiled)
+	if fh.RowFilter != nil {
+		// the row filter is always applied,
+		// so it can be used to skip blocks as well
+		if fh.Expr == nil {
+			fh.Expr = fh.RowFilter
+		} else {
+			fh.Expr = expr.And(fh.Expr, fh.RowFilter)
+		}
+	}
+	fh.compiled.Compile(unmasked(fh.Expr, fh.Masks))
+	blobs, err := db.Blobs(f.Root, saved.index, &fh.compiled)
+	if err != nil {
+		return nil, err
+	}
+	err = db.UnwrapKeys(f.tenant, blobs)
 	if err != nil {
 		return nil, err
 	}
@@ -194,6 +354,14 @@ func (f *FSEnv) ListTables(dbname string) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
+	// don't list tables that cannot be queried
+	out := li[:0]
+	for _, table := range li {
+		if _, ok := f.config.Access(dbname, table); ok {
+			out = append(out, table)
+		}
+	}
+	li = out
 	f.lists = append(f.lists, savedList{
 		db:   dbname,
 		list: li,
@@ -211,3 +379,37 @@ func (f *FSEnv) Uploader() plan.UploadFS {
 func (f *FSEnv) Key() *blockfmt.Key {
 	return f.tenant.Key()
 }
+
+var _ plan.WriteChecker = (*FSEnv)(nil)
+
+// CheckWrite implements plan.WriteChecker.CheckWrite
+//
+// Writing to a table requires unrestricted
+// access to it: a tenant that may only see
+// some of the rows or columns of a table
+// may not append to it or replace it.
+// No table in db.AuditDatabase may be written.
+func (f *FSEnv) CheckWrite(tbl *expr.Path) error {
+	dbname, table, err := tsplit(tbl)
+	if err != nil {
+		return err
+	}
+	if dbname == db.AuditDatabase {
+		return fmt.Errorf("database %s is read-only: %w", dbname, fs.ErrPermission)
+	}
+	grant, ok := f.config.Access(dbname, table)
+	if !ok {
+		return fmt.Errorf("table %s.%s: %w", dbname, table, fs.ErrPermission)
+	}
+	if grant != nil && (len(grant.Masks) > 0 || grant.Filter != "") {
+		return fmt.Errorf("table %s.%s: writing requires unrestricted access: %w", dbname, table, fs.ErrPermission)
+	}
+	return nil
+}
+
+var _ plan.EncryptEnv = (*FSEnv)(nil)
+
+// MasterKey implements plan.EncryptEnv.MasterKey
+func (f *FSEnv) MasterKey() *blockfmt.MasterKey {
+	return db.MasterKey(f.tenant)
+}
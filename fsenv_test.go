@@ -0,0 +1,59 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sneller
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/SnellerInc/sneller/db"
+	"github.com/SnellerInc/sneller/expr"
+)
+
+func TestCheckWrite(t *testing.T) {
+	cfg := &db.TenantConfig{
+		Grants: []db.Grant{
+			{Database: "logs", Table: "masked", Masks: []db.Mask{{Path: "email", Action: db.MaskHide}}},
+			{Database: "logs", Table: "filtered", Filter: "org_id = 'acme'"},
+			{Database: "logs", Table: "*"},
+		},
+	}
+	path := func(dbname, table string) *expr.Path {
+		return &expr.Path{First: dbname, Rest: &expr.Dot{Field: table}}
+	}
+	cases := []struct {
+		config *db.TenantConfig
+		db     string
+		table  string
+		ok     bool
+	}{
+		{nil, "any", "table", true},
+		{cfg, "logs", "events", true},
+		{cfg, "logs", "masked", false},
+		{cfg, "logs", "filtered", false},
+		{cfg, "other", "events", false},
+		{nil, db.AuditDatabase, "queries", false},
+	}
+	for _, c := range cases {
+		env := &FSEnv{config: c.config}
+		err := env.CheckWrite(path(c.db, c.table))
+		if c.ok && err != nil {
+			t.Errorf("%s.%s: unexpected error %v", c.db, c.table, err)
+		} else if !c.ok && !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("%s.%s: got error %v", c.db, c.table, err)
+		}
+	}
+}
@@ -1026,6 +1026,27 @@ CONST_DATA_U32(consts_days_until_month_from_march, 56, $0)
 CONST_DATA_U32(consts_days_until_month_from_march, 60, $0)
 CONST_GLOBAL(consts_days_until_month_from_march, $64)
 
+// A DWORD table designed for VPERMD that maps months of the year, where the index 0 represents
+// January, into the number of days in the month; February has 29 days, so the leap day has to
+// be validated separately.
+CONST_DATA_U32(consts_days_in_month,  0, $31)
+CONST_DATA_U32(consts_days_in_month,  4, $29)
+CONST_DATA_U32(consts_days_in_month,  8, $31)
+CONST_DATA_U32(consts_days_in_month, 12, $30)
+CONST_DATA_U32(consts_days_in_month, 16, $31)
+CONST_DATA_U32(consts_days_in_month, 20, $30)
+CONST_DATA_U32(consts_days_in_month, 24, $31)
+CONST_DATA_U32(consts_days_in_month, 28, $31)
+CONST_DATA_U32(consts_days_in_month, 32, $30)
+CONST_DATA_U32(consts_days_in_month, 36, $31)
+CONST_DATA_U32(consts_days_in_month, 40, $30)
+CONST_DATA_U32(consts_days_in_month, 44, $31)
+CONST_DATA_U32(consts_days_in_month, 48, $0)
+CONST_DATA_U32(consts_days_in_month, 52, $0)
+CONST_DATA_U32(consts_days_in_month, 56, $0)
+CONST_DATA_U32(consts_days_in_month, 60, $0)
+CONST_GLOBAL(consts_days_in_month, $64)
+
 // VPSHUFB predicate that calculates a quarter [1, 4] from a month in a [1, 12] range, where [1] represents March
 CONST_DATA_U64(consts_quarter_from_month_1_is_march, 0, $0x0303030202020100)
 CONST_DATA_U64(consts_quarter_from_month_1_is_march, 8, $0x0000000101040404)
@@ -15,6 +15,7 @@
 package blockfmt
 
 import (
+	"crypto/cipher"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -37,6 +38,7 @@ type blockpart struct {
 	offset int64
 	chunks int
 	ranges []TimeRange
+	run    uint64 // see startRun
 }
 
 func toDescs(dst []Blockdesc, src []blockpart) []Blockdesc {
@@ -143,6 +145,11 @@ type CompressionWriter struct {
 	// merged them and stuck them in Trailer
 	blocks []blockpart
 
+	// comp is Comp, wrapped so that its
+	// output is encrypted if Trailer.Encryption
+	// is set; it is initialized by the first Write
+	comp Compressor
+
 	buffer, alt []byte // buffered data
 	bg          chan error
 	partnum     int64 // previous part number
@@ -151,6 +158,7 @@ type CompressionWriter struct {
 	lastblock   int64
 	flushblocks int
 	skipChecks  bool
+	run         uint64
 
 	// metadata to be attached
 	// to the next block
@@ -209,6 +217,7 @@ func (w *CompressionWriter) Flush() error {
 		offset: w.lastblock,
 		chunks: w.flushblocks,
 		ranges: w.futureRange.pop(),
+		run:    w.run,
 	})
 	w.lastblock = w.offset
 	w.flushblocks = 0
@@ -226,7 +235,8 @@ func (w *CompressionWriter) SkipChecks() {
 // consume maybe *some* of an existing object
 // without doing any heavy lifting w.r.t compression
 func (w *CompressionWriter) writeStart(r io.Reader, t *Trailer) error {
-	if t.Algo != w.Comp.Name() || 1<<t.BlockShift != w.InputAlign {
+	if t.Algo != w.Comp.Name() || 1<<t.BlockShift != w.InputAlign ||
+		t.Encryption != nil || w.Trailer.Encryption != nil {
 		return nil // not directly compatible
 	}
 	j := 0
@@ -287,9 +297,21 @@ func (w *CompressionWriter) Write(p []byte) (n int, err error) {
 	if w.flushblocks == 0 && !w.skipChecks && !ion.IsBVM(p) {
 		return 0, fmt.Errorf("blockfmt.CompressionWriter.Write: blocks flushed, but no BVM")
 	}
+	if w.comp == nil {
+		w.comp, err = w.Trailer.Encryption.seal(w.Comp)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if w.flushblocks == 0 {
+		w.run, err = startRun(w.comp)
+		if err != nil {
+			return 0, err
+		}
+	}
 	w.flushblocks++
 	before := len(w.buffer)
-	w.buffer, err = appendFrame(w.buffer, w.Comp, p)
+	w.buffer, err = appendFrame(w.buffer, w.comp, p)
 	if err != nil {
 		return
 	}
@@ -307,6 +329,7 @@ func (w *CompressionWriter) Write(p []byte) (n int, err error) {
 // taking care to coalesce blocks where they fall below
 // the provided minimum size
 func finalize(dst *Trailer, src []blockpart, min int) {
+	dst.Encryption = dst.Encryption.withRuns(src)
 	src = coalesce(src, min)
 	for i := range src {
 		for j := range src[i].ranges {
@@ -340,16 +363,22 @@ func (w *CompressionWriter) Close() error {
 	w.buffer = append(w.buffer, trailer...)
 	w.Comp.Close()
 	w.Comp = nil
+	w.comp = nil
 	return w.Output.Close(w.buffer)
 }
 
 func (t *Trailer) trailer(comp Compressor, align int) []byte {
-	var st ion.Symtab
-	var buf ion.Buffer
-
 	t.Version = 1
 	t.Algo = comp.Name()
 	t.BlockShift = bits.TrailingZeros(uint(align))
+	return t.bytes()
+}
+
+// bytes returns the encoded trailer along
+// with its symbol table and its size
+func (t *Trailer) bytes() []byte {
+	var st ion.Symtab
+	var buf ion.Buffer
 
 	t.Encode(&buf, &st)
 	tail := buf.Bytes()
@@ -439,6 +468,30 @@ func appendFrame(dst []byte, comp Compressor, src []byte) ([]byte, error) {
 	return dst, nil
 }
 
+// CopyWithTrailer copies the blocks of an object
+// read from src to dst, followed by the trailer t,
+// which replaces the original trailer of the object.
+// t must describe the same blocks as the original
+// trailer (for example, it may differ only in the
+// wrapping of the data key; see Encryption.Rewrap),
+// and src must be positioned at the start of the object.
+func CopyWithTrailer(dst Uploader, src io.Reader, t *Trailer) error {
+	tail := t.bytes()
+	if t.Offset < int64(dst.MinPartSize()) {
+		buf := make([]byte, t.Offset, t.Offset+int64(len(tail)))
+		_, err := io.ReadFull(src, buf)
+		if err != nil {
+			return err
+		}
+		return dst.Close(append(buf, tail...))
+	}
+	_, err := uploadReader(dst, 1, src, t.Offset)
+	if err != nil {
+		return err
+	}
+	return dst.Close(tail)
+}
+
 // ReadTrailer reads a trailer from an io.ReaderAt
 // that has a backing size of 'size'.
 func ReadTrailer(src io.ReaderAt, size int64) (*Trailer, error) {
@@ -571,9 +624,28 @@ type Decoder struct {
 	// data allocated via Malloc.
 	Free func([]byte)
 
+	// Encryption is the encryption of the
+	// input data blocks, or nil if they
+	// are not encrypted. Its data key must
+	// have been unwrapped (see Encryption.Unwrap).
+	// Encryption is set automatically by Decoder.Set.
+	Encryption *Encryption
+
 	decomp decompressor
 	frame  [5]byte
 	tmp    []byte
+
+	// aead is the cipher for sealedBy,
+	// and plain holds decrypted frames
+	aead     cipher.AEAD
+	sealedBy *Encryption
+	plain    []byte
+	ad       [16]byte
+
+	// position of the next encrypted frame:
+	// the index of its run in Encryption
+	// and its index within that run
+	run, next int
 }
 
 // Set sets fields in the decoder in order
@@ -582,13 +654,38 @@ type Decoder struct {
 // To prepare for reading the whole trailer,
 // use Set(t, len(t.Blocks)).
 func (d *Decoder) Set(t *Trailer, lastblock int) {
+	d.SetRange(t, 0, lastblock)
+}
+
+// SetRange is like Set, but it prepares the
+// decoder for reading blocks starting at
+// firstblock rather than the first block.
+// The position of each block must be known
+// in order to decrypt it, so SetRange must
+// be used rather than Set when an encrypted
+// object is read from any block but the first.
+func (d *Decoder) SetRange(t *Trailer, firstblock, lastblock int) {
 	d.BlockShift = t.BlockShift
 	d.Algo = t.Algo
+	d.Encryption = t.Encryption
 	if lastblock >= len(t.Blocks) {
 		d.Offset = t.Offset
 	} else {
 		d.Offset = t.Blocks[lastblock].Offset
 	}
+	d.run, d.next = 0, 0
+	if d.Encryption != nil {
+		chunks := 0
+		for i := range t.Blocks[:firstblock] {
+			chunks += t.Blocks[i].Chunks
+		}
+		runs := d.Encryption.runs
+		for d.run < len(runs) && chunks >= runs[d.run].chunks {
+			chunks -= runs[d.run].chunks
+			d.run++
+		}
+		d.next = chunks
+	}
 }
 
 func (d *Decoder) realloc(size int) []byte {
@@ -626,6 +723,46 @@ func (d *Decoder) free() {
 	}
 }
 
+// open returns the decrypted contents of frame,
+// or frame itself if the blocks are not encrypted.
+// The returned slice is only valid until the next call.
+func (d *Decoder) open(frame []byte) ([]byte, error) {
+	if d.Encryption == nil {
+		return frame, nil
+	}
+	if d.aead == nil || d.sealedBy != d.Encryption {
+		aead, err := d.Encryption.aead()
+		if err != nil {
+			return nil, err
+		}
+		d.aead, d.sealedBy = aead, d.Encryption
+	}
+	ns := d.aead.NonceSize()
+	if len(frame) < ns+d.aead.Overhead() {
+		return nil, fmt.Errorf("encrypted frame too short (%d bytes)", len(frame))
+	}
+	// frame may be read-only memory,
+	// so never decrypt it in place
+	var err error
+	runs := d.Encryption.runs
+	if d.run >= len(runs) {
+		return nil, fmt.Errorf("encrypted frame beyond the last recorded run")
+	}
+	ad := aad(&d.ad, runs[d.run].id, d.next)
+	if d.next++; d.next >= runs[d.run].chunks {
+		d.run++
+		d.next = 0
+	}
+	d.plain, err = d.aead.Open(d.plain[:0], frame[:ns], frame[ns:], ad)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting block: %w", err)
+	}
+	// clip the capacity so that decompressors
+	// that append to their input cannot
+	// clobber the scratch space
+	return d.plain[:len(d.plain):len(d.plain)], nil
+}
+
 func (d *Decoder) decompressBlocks(src io.Reader, upto int, dst []byte) (int, error) {
 	off, count := 0, 0
 	bs := 1 << d.BlockShift
@@ -657,6 +794,10 @@ func (d *Decoder) decompressBlocks(src io.Reader, upto int, dst []byte) (int, er
 		if err != nil {
 			return off, err
 		}
+		buf, err = d.open(buf)
+		if err != nil {
+			return off, err
+		}
 		err = d.decomp.Decompress(buf, dst[off:off+bs])
 		if err != nil {
 			return 0, fmt.Errorf("decompress @ offset %d of %d block %d size %d: %w", count-n, upto, block, size, err)
@@ -712,7 +853,11 @@ func (d *Decoder) copyZion(w io.Writer, src []byte) (int64, error) {
 		if size < 5 || size > len(src) {
 			return nn, fmt.Errorf("unexpected frame size %d", size)
 		}
-		_, err := w.Write(src[5:size])
+		buf, err := d.open(src[5:size])
+		if err != nil {
+			return nn, err
+		}
+		_, err = w.Write(buf)
 		if err != nil {
 			return nn, err
 		}
@@ -750,6 +895,10 @@ func (d *Decoder) copyZionFrom(w io.Writer, src io.Reader) (int64, error) {
 		if err != nil {
 			return nn, err
 		}
+		buf, err = d.open(buf)
+		if err != nil {
+			return nn, err
+		}
 		_, err = w.Write(buf)
 		if err != nil {
 			return nn, err
@@ -812,7 +961,11 @@ func (d *Decoder) CopyBytes(dst io.Writer, src []byte) (int64, error) {
 		if size < 5 || size > len(src) {
 			return nn, fmt.Errorf("unexpected frame size %d", size)
 		}
-		err := d.decomp.Decompress(src[5:size], vmm)
+		buf, err := d.open(src[5:size])
+		if err != nil {
+			return nn, err
+		}
+		err = d.decomp.Decompress(buf, vmm)
 		if err != nil {
 			return nn, err
 		}
@@ -875,6 +1028,10 @@ func (d *Decoder) Copy(dst io.Writer, src io.Reader) (int64, error) {
 		if err != nil {
 			return nn, err
 		}
+		buf, err = d.open(buf)
+		if err != nil {
+			return nn, err
+		}
 		err = d.decomp.Decompress(buf, vmm)
 		if err != nil {
 			return nn, err
@@ -23,9 +23,12 @@ import (
 	"io/fs"
 	"runtime"
 
+	"github.com/SnellerInc/sneller/avro"
 	"github.com/SnellerInc/sneller/aws/s3"
 	"github.com/SnellerInc/sneller/ion"
 	"github.com/SnellerInc/sneller/jsonrl"
+	"github.com/SnellerInc/sneller/loglines"
+	"github.com/SnellerInc/sneller/parquet"
 	"github.com/SnellerInc/sneller/xsv"
 
 	"github.com/klauspost/compress/zstd"
@@ -147,6 +150,54 @@ func (t *xsvConverter) Name() string {
 	return t.name
 }
 
+type logConverter struct {
+	name   string
+	decomp func(r io.Reader) (io.Reader, error)
+	hints  *loglines.Hint
+}
+
+func (l *logConverter) Convert(r io.Reader, dst *ion.Chunker, cons []ion.Field) error {
+	rc := r
+	var err, err2 error
+	if l.decomp != nil {
+		rc, err = l.decomp(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = loglines.Convert(rc, dst, l.hints, cons)
+	if l.decomp != nil {
+		if cc, ok := rc.(io.Closer); ok {
+			err2 = cc.Close()
+		}
+	}
+	if err == nil {
+		err = err2
+	}
+	return err
+}
+
+func (l *logConverter) Name() string {
+	return l.name
+}
+
+type avroConverter struct{}
+
+func (a avroConverter) Name() string { return "avro" }
+
+func (a avroConverter) Convert(r io.Reader, dst *ion.Chunker, cons []ion.Field) error {
+	return avro.Convert(r, dst, cons)
+}
+
+type parquetConverter struct{}
+
+func (p parquetConverter) Name() string { return "parquet" }
+
+func (p parquetConverter) Convert(r io.Reader, dst *ion.Chunker, cons []ion.Field) error {
+	return parquet.Convert(r, dst, cons)
+}
+
 type ionConverter struct{}
 
 func (i ionConverter) Name() string { return "ion" }
@@ -288,6 +339,44 @@ func init() {
 			}, nil
 		}
 	}
+
+	// Text log files (logfmt, syslog, grok patterns)
+	for dn, dc := range decompressors {
+		decName := dn
+		decomp := dc
+		SuffixToFormat[".log"+decName] = func(h []byte) (RowFormat, error) {
+			if h == nil {
+				return nil, errors.New("log files require hints")
+			}
+			hints, err := loglines.ParseHint(h)
+			if err != nil {
+				return nil, err
+			}
+			return &logConverter{
+				name:   "log" + decName,
+				decomp: decomp,
+				hints:  hints,
+			}, nil
+		}
+	}
+
+	// Avro object container files
+	// (compression is part of the format)
+	SuffixToFormat[".avro"] = func(h []byte) (RowFormat, error) {
+		if h != nil {
+			return nil, errors.New("avro doesn't support hints")
+		}
+		return avroConverter{}, nil
+	}
+
+	// Parquet files
+	// (compression is part of the format)
+	SuffixToFormat[".parquet"] = func(h []byte) (RowFormat, error) {
+		if h != nil {
+			return nil, errors.New("parquet doesn't support hints")
+		}
+		return parquetConverter{}, nil
+	}
 }
 
 // Template is a templated constant field.
@@ -348,10 +437,21 @@ type Converter struct {
 	// DisablePrefetch, if true, disables
 	// prefetching of inputs.
 	DisablePrefetch bool
-
+	// MasterKey, if non-nil, is used to
+	// wrap a new data key with which the
+	// output blocks are encrypted.
+	// MasterKey is also used to unwrap the data
+	// key of Prepend.Trailer if it is encrypted.
+	MasterKey *MasterKey
+
+	// encryption of the output, if any
+	encryption *Encryption
 	// trailer built by the writer. This is only
 	// set if the object was written successfully.
 	trailer *Trailer
+	// statistics of the converted inputs;
+	// set along with trailer
+	stats *Stats
 }
 
 // static errors known to be fatal to decoding
@@ -366,6 +466,14 @@ var isFatal = []error{
 	zstd.ErrWindowSizeExceeded,
 	zstd.ErrWindowSizeTooSmall,
 	zstd.ErrBlockTooSmall,
+	avro.ErrMagicMismatch,
+	avro.ErrInvalidSchema,
+	avro.ErrCorrupt,
+	parquet.ErrMagicMismatch,
+	parquet.ErrInvalidSchema,
+	parquet.ErrCorrupt,
+	parquet.ErrUnsupported,
+	loglines.ErrTooLarge,
 
 	// these can be produced from the first
 	// fs.File.Read call on at least s3.File
@@ -419,6 +527,21 @@ func (c *Converter) Run() error {
 	if len(c.Inputs) == 0 && c.Prepend.R == nil {
 		return errors.New("no inputs or merge sources")
 	}
+	c.encryption = nil
+	if c.MasterKey != nil {
+		enc, err := NewEncryption(c.MasterKey)
+		if err != nil {
+			return err
+		}
+		c.encryption = enc
+		if t := c.Prepend.Trailer; c.Prepend.R != nil && t != nil &&
+			t.Encryption != nil && t.Encryption.DataKey == nil {
+			err := t.Encryption.Unwrap(c.MasterKey)
+			if err != nil {
+				return err
+			}
+		}
+	}
 	if c.MultiStream() {
 		return c.runMulti()
 	}
@@ -443,6 +566,7 @@ func (c *Converter) runSingle() error {
 		// half the target size
 		MinChunksPerBlock: c.FlushMeta / (c.Align * 2),
 	}
+	w.Trailer.Encryption = c.encryption
 	if len(c.Constants) > 0 {
 		w.Trailer.Sparse.consts = ion.NewStruct(nil, c.Constants)
 	}
@@ -459,6 +583,8 @@ func (c *Converter) runSingle() error {
 	if err != nil {
 		return err
 	}
+	sc := newStatsCollector()
+	cn.Observe = sc.observe
 	ready := make([]chan struct{}, len(c.Inputs))
 	next := 1
 	inflight := int64(0) // # bytes being prefetched
@@ -519,6 +645,7 @@ func (c *Converter) runSingle() error {
 	}
 	err = w.Close()
 	c.trailer = &w.Trailer
+	c.stats = sc.result()
 	return err
 }
 
@@ -569,6 +696,7 @@ func (c *Converter) runMulti() error {
 		// half the target size
 		MinChunksPerBlock: c.FlushMeta / (c.Align * 2),
 	}
+	w.Trailer.Encryption = c.encryption
 	if len(c.Constants) > 0 {
 		w.Trailer.Sparse.consts = ion.NewStruct(nil, c.Constants)
 	}
@@ -592,6 +720,7 @@ func (c *Converter) runMulti() error {
 		readyc = doPrefetch(startc, max, wantInflight)
 	}
 	errs := make(chan error, p)
+	collectors := make([]*statsCollector, p)
 	// NOTE: consume must be called
 	// before the send on errs so that
 	// the consumption of inputs happens
@@ -622,6 +751,8 @@ func (c *Converter) runMulti() error {
 					return
 				}
 			}
+			collectors[i] = newStatsCollector()
+			cn.Observe = collectors[i].observe
 			for in := range startc {
 				err := in.F.Convert(in.R, &cn, c.Constants)
 				err2 := in.R.Close()
@@ -672,9 +803,21 @@ func (c *Converter) runMulti() error {
 		return err
 	}
 	c.trailer = &w.Trailer
+	c.stats = new(Stats)
+	for i := range collectors {
+		c.stats.Merge(collectors[i].result())
+	}
 	return nil
 }
 
 func (c *Converter) Trailer() *Trailer {
 	return c.trailer
 }
+
+// Stats returns the statistics of the rows
+// converted from c.Inputs after a successful
+// call to Run. The rows from c.Prepend are
+// not included in the statistics.
+func (c *Converter) Stats() *Stats {
+	return c.stats
+}
@@ -17,11 +17,14 @@ package blockfmt
 import (
 	"bytes"
 	"compress/gzip"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"os"
 	"strings"
 	"testing"
+
+	"github.com/SnellerInc/sneller/date"
 )
 
 func testConvertMulti(t *testing.T, algo string, meta int) {
@@ -132,6 +135,120 @@ func TestConvertMultiFail(t *testing.T) {
 	}
 }
 
+// avroFile produces a minimal Avro object container
+// file with n records of the form {"id": long, "text": string}
+func avroFile(n int) []byte {
+	long := func(dst []byte, v int64) []byte {
+		return binary.AppendUvarint(dst, uint64(v<<1)^uint64(v>>63))
+	}
+	str := func(dst []byte, s string) []byte {
+		return append(long(dst, int64(len(s))), s...)
+	}
+	sync := []byte("sync-marker-0123")
+	buf := []byte{'O', 'b', 'j', 1}
+	buf = long(buf, 1)
+	buf = str(buf, "avro.schema")
+	buf = str(buf, `{"type": "record", "name": "r", "fields": [{"name": "id", "type": "long"}, {"name": "text", "type": "string"}]}`)
+	buf = long(buf, 0)
+	buf = append(buf, sync...)
+	var block []byte
+	for i := 0; i < n; i++ {
+		block = long(block, int64(i))
+		block = str(block, strings.Repeat("x", i%100))
+	}
+	buf = long(buf, int64(n))
+	buf = long(buf, int64(len(block)))
+	buf = append(buf, block...)
+	return append(buf, sync...)
+}
+
+func TestConvertAvroMulti(t *testing.T) {
+	var inputs []Input
+	want := 0
+	for _, n := range []int{1000, 3000, 2000} {
+		inputs = append(inputs, Input{
+			R: io.NopCloser(bytes.NewReader(avroFile(n))),
+			F: MustSuffixToFormat(".avro"),
+		})
+		want += n
+	}
+	var out BufferUploader
+	align := 4096
+	out.PartSize = 2 * align
+	c := Converter{
+		Output:    &out,
+		Comp:      "zstd",
+		Inputs:    inputs,
+		Align:     align,
+		FlushMeta: align * 4,
+		Parallel:  2,
+	}
+	if !c.MultiStream() {
+		t.Fatal("expected MultiStream to be true with 3 inputs")
+	}
+	if err := c.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if n := check(t, &out); n != want {
+		t.Errorf("got %d rows, want %d", n, want)
+	}
+
+	// corrupt files are fatal errors
+	c.Inputs = []Input{{
+		R: io.NopCloser(bytes.NewReader(avroFile(10)[:100])),
+		F: MustSuffixToFormat(".avro"),
+	}}
+	out = BufferUploader{PartSize: 2 * align}
+	if err := c.Run(); !IsFatal(err) {
+		t.Errorf("expected a fatal error, got %v", err)
+	}
+}
+
+func TestConvertLog(t *testing.T) {
+	var text bytes.Buffer
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&text, "ts=2022-10-01T12:%02d:%02dZ level=info n=%d\n", i/60, i%60, i)
+	}
+	text.WriteString("not logfmt\n")
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(text.Bytes())
+	w.Close()
+
+	if _, err := SuffixToFormat[".log.gz"](nil); err == nil {
+		t.Fatal("expected an error without hints")
+	}
+	f, err := SuffixToFormat[".log.gz"]([]byte(`{"format": "logfmt"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out BufferUploader
+	align := 4096
+	out.PartSize = 2 * align
+	c := Converter{
+		Output:    &out,
+		Comp:      "zstd",
+		Inputs:    []Input{{R: io.NopCloser(&gz), F: f}},
+		Align:     align,
+		FlushMeta: align * 4,
+	}
+	if err := c.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if n := check(t, &out); n != 1001 {
+		t.Errorf("got %d rows, want 1001", n)
+	}
+	ti := c.Trailer().Sparse.Get([]string{"ts"})
+	if ti == nil {
+		t.Fatal("no sparse index for ts")
+	}
+	min, _ := ti.Min()
+	max, _ := ti.Max()
+	if !min.Equal(date.Date(2022, 10, 1, 12, 0, 0, 0)) || !max.Equal(date.Date(2022, 10, 1, 12, 16, 39, 0)) {
+		t.Errorf("unexpected range %s to %s", min, max)
+	}
+}
+
 func TestConvertSingle(t *testing.T) {
 	multiples := []int{
 		1, 3, 7, 50,
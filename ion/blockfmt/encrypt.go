@@ -0,0 +1,487 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package blockfmt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/SnellerInc/sneller/ion"
+
+	"golang.org/x/exp/slices"
+)
+
+// MasterKeyLength is the length of a MasterKey.
+const MasterKeyLength = 32
+
+// dataKeyLength is the length of
+// the AES-256 key used to encrypt blocks
+const dataKeyLength = 32
+
+// EncryptionAlgo is the name of the
+// algorithm used to encrypt blocks.
+const EncryptionAlgo = "aes-256-gcm"
+
+// MasterKey is the AES-256 key that is used
+// to wrap the data key of each encrypted object.
+type MasterKey [MasterKeyLength]byte
+
+var (
+	// ErrWrongKey is returned when a data key
+	// cannot be unwrapped with a master key.
+	ErrWrongKey = errors.New("blockfmt: data key cannot be unwrapped with this master key")
+	// ErrNoDataKey is returned when an encrypted
+	// object is read before its data key
+	// has been unwrapped.
+	ErrNoDataKey = errors.New("blockfmt: data key of encrypted object is not unwrapped")
+)
+
+// Encryption describes the encryption of the
+// blocks within an object. Each block is sealed
+// with AES-GCM using a random nonce and a data key
+// that is unique to the object, so blocks can be
+// decrypted independently of one another.
+// The data key is stored in the Trailer of the object
+// after it has been wrapped (encrypted) with a MasterKey.
+//
+// Each compressed chunk is sealed with its position
+// in the object as additional authenticated data,
+// so chunks cannot be reordered, dropped, or moved
+// between blocks without failing to decrypt.
+// Since writers do not know the final position of
+// a chunk when it is sealed (see MultiWriter),
+// the position is expressed as a run ID and the
+// index of the chunk within the run. The runs are
+// recorded in the Trailer in the order in which
+// they appear in the object.
+type Encryption struct {
+	// Wrapped is the data key sealed
+	// with the master key, prefixed
+	// with the nonce used to seal it.
+	Wrapped []byte
+	// DataKey is the unwrapped data key,
+	// or nil if the key has not been unwrapped.
+	// DataKey is never written by Trailer.Encode.
+	DataKey []byte
+
+	// runs of chunks, in object order
+	runs []sealRun
+}
+
+// sealRun is a run of consecutive chunks
+// sealed with the same ID
+type sealRun struct {
+	id     uint64
+	chunks int
+}
+
+// aad returns the additional data
+// for the chunk at index n of run id
+func aad(dst *[16]byte, id uint64, n int) []byte {
+	binary.LittleEndian.PutUint64(dst[:8], id)
+	binary.LittleEndian.PutUint64(dst[8:], uint64(n))
+	return dst[:]
+}
+
+// withRuns returns a copy of e with the
+// runs of chunks recorded in blocks, which
+// must be in object order. (The Encryption
+// passed to a writer may be shared by
+// several objects, so it is never modified.)
+func (e *Encryption) withRuns(blocks []blockpart) *Encryption {
+	if e == nil {
+		return nil
+	}
+	out := *e
+	out.runs = make([]sealRun, len(blocks))
+	for i := range blocks {
+		out.runs[i] = sealRun{id: blocks[i].run, chunks: blocks[i].chunks}
+	}
+	return &out
+}
+
+// NewEncryption creates an Encryption with
+// a new random data key wrapped by master.
+func NewEncryption(master *MasterKey) (*Encryption, error) {
+	e := &Encryption{DataKey: make([]byte, dataKeyLength)}
+	if _, err := rand.Read(e.DataKey); err != nil {
+		return nil, err
+	}
+	if err := e.Rewrap(master); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func masterAEAD(master *MasterKey) cipher.AEAD {
+	c, err := aes.NewCipher(master[:])
+	if err != nil {
+		// only possible with a bad key length
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(c)
+	if err != nil {
+		panic(err)
+	}
+	return aead
+}
+
+// Unwrap sets e.DataKey by unwrapping
+// e.Wrapped with master. Unwrap returns
+// ErrWrongKey if e.Wrapped was not
+// wrapped with master.
+func (e *Encryption) Unwrap(master *MasterKey) error {
+	aead := masterAEAD(master)
+	ns := aead.NonceSize()
+	if len(e.Wrapped) < ns {
+		return fmt.Errorf("blockfmt: wrapped data key too short (%d bytes)", len(e.Wrapped))
+	}
+	key, err := aead.Open(nil, e.Wrapped[:ns], e.Wrapped[ns:], nil)
+	if err != nil {
+		return ErrWrongKey
+	}
+	if len(key) != dataKeyLength {
+		return fmt.Errorf("blockfmt: unexpected data key length %d", len(key))
+	}
+	e.DataKey = key
+	return nil
+}
+
+// Rewrap sets e.Wrapped to e.DataKey
+// wrapped with master. The data key
+// must already have been unwrapped.
+func (e *Encryption) Rewrap(master *MasterKey) error {
+	if e.DataKey == nil {
+		return ErrNoDataKey
+	}
+	aead := masterAEAD(master)
+	wrapped := make([]byte, aead.NonceSize(), aead.NonceSize()+len(e.DataKey)+aead.Overhead())
+	if _, err := rand.Read(wrapped); err != nil {
+		return err
+	}
+	e.Wrapped = aead.Seal(wrapped, wrapped, e.DataKey, nil)
+	return nil
+}
+
+func (e *Encryption) aead() (cipher.AEAD, error) {
+	if e.DataKey == nil {
+		return nil, ErrNoDataKey
+	}
+	c, err := aes.NewCipher(e.DataKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(c)
+}
+
+func (e *Encryption) encode(dst *ion.Buffer, st *ion.Symtab) {
+	dst.BeginStruct(-1)
+	dst.BeginField(st.Intern("algo"))
+	dst.WriteString(EncryptionAlgo)
+	dst.BeginField(st.Intern("wrapped-key"))
+	dst.WriteBlob(e.Wrapped)
+	dst.BeginField(st.Intern("runs"))
+	dst.BeginList(-1)
+	for i := range e.runs {
+		dst.WriteUint(e.runs[i].id)
+		dst.WriteInt(int64(e.runs[i].chunks))
+	}
+	dst.EndList()
+	dst.EndStruct()
+}
+
+func (e *Encryption) decode(st *ion.Symtab, body []byte) error {
+	return unpackStruct(st, body, func(name string, field []byte) error {
+		var err error
+		switch name {
+		case "algo":
+			var algo string
+			algo, _, err = ion.ReadString(field)
+			if err == nil && algo != EncryptionAlgo {
+				err = fmt.Errorf("unsupported encryption algorithm %q", algo)
+			}
+		case "wrapped-key":
+			e.Wrapped, _, err = ion.ReadBytes(field)
+		case "runs":
+			// runs are encoded as a flat list
+			// of (id, chunks) pairs
+			e.runs = e.runs[:0]
+			id, odd := uint64(0), false
+			_, err = ion.UnpackList(field, func(item []byte) error {
+				var err error
+				if !odd {
+					id, _, err = ion.ReadUint(item)
+				} else {
+					var chunks int64
+					chunks, _, err = ion.ReadInt(item)
+					e.runs = append(e.runs, sealRun{id: id, chunks: int(chunks)})
+				}
+				odd = !odd
+				return err
+			})
+			if err == nil && odd {
+				err = fmt.Errorf("odd number of items in encryption runs")
+			}
+		default:
+			err = fmt.Errorf("unexpected field %q", name)
+		}
+		return err
+	})
+}
+
+// sealer is a Compressor that encrypts
+// the output of another Compressor
+type sealer struct {
+	Compressor
+	aead cipher.AEAD
+	tmp  []byte
+	ad   [16]byte
+
+	// current run and the index
+	// of the next chunk within it
+	run  uint64
+	next int
+}
+
+// startRun begins a new run of chunks
+// if c encrypts its output and returns
+// the ID of the run. Each run of chunks
+// must be recorded in the blockpart that
+// contains it.
+func startRun(c Compressor) (uint64, error) {
+	s, ok := c.(*sealer)
+	if !ok {
+		return 0, nil
+	}
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return 0, err
+	}
+	s.run = binary.LittleEndian.Uint64(id[:])
+	s.next = 0
+	return s.run, nil
+}
+
+// seal returns a Compressor that encrypts
+// the output of comp if e is non-nil
+func (e *Encryption) seal(comp Compressor) (Compressor, error) {
+	if e == nil {
+		return comp, nil
+	}
+	aead, err := e.aead()
+	if err != nil {
+		return nil, err
+	}
+	return &sealer{Compressor: comp, aead: aead}, nil
+}
+
+// Compress appends the nonce followed by the
+// sealed output of s.Compressor to dst
+func (s *sealer) Compress(src, dst []byte) ([]byte, error) {
+	var err error
+	s.tmp, err = s.Compressor.Compress(src, s.tmp[:0])
+	if err != nil {
+		return dst, err
+	}
+	var nonce [12]byte
+	if _, err := rand.Read(nonce[:s.aead.NonceSize()]); err != nil {
+		return dst, err
+	}
+	dst = append(dst, nonce[:s.aead.NonceSize()]...)
+	dst = s.aead.Seal(dst, nonce[:s.aead.NonceSize()], s.tmp, aad(&s.ad, s.run, s.next))
+	s.next++
+	return dst, nil
+}
+
+// sealMagic is the prefix of a sealed object.
+// (It is neither a valid ion BVM nor
+// a valid zstd frame magic number, so a sealed
+// object can't be confused with an unsealed one.)
+const sealMagic = "\x00snseal1"
+
+// ErrSealed is returned when a sealed
+// object is read without a Sealer.
+var ErrSealed = errors.New("blockfmt: object is sealed, but no master key was provided")
+
+// IsSealed returns true if buf
+// is an object sealed by a Sealer.
+func IsSealed(buf []byte) bool {
+	return len(buf) >= len(sealMagic) && string(buf[:len(sealMagic)]) == sealMagic
+}
+
+// Sealer seals (encrypts) and unseals the
+// metadata objects that describe the packed
+// objects of a table: the signed Index, the
+// lists of descriptors referenced by an
+// IndirectTree, and the nodes of a FileTree.
+// These objects include object paths, input
+// paths, and statistics and time ranges of the
+// rows in the table, so they are sealed whenever
+// the packed objects themselves are encrypted.
+//
+// Each object is sealed with AES-GCM using a
+// data key that is wrapped by a MasterKey,
+// and the wrapped data key is stored in the
+// sealed object. The path of the object is
+// used as additional authenticated data, so
+// sealed objects can't be swapped for one another.
+//
+// A Sealer is safe to use from multiple goroutines.
+type Sealer struct {
+	// Encryption holds the data key
+	// used to seal new objects. If it is nil,
+	// the Sealer can only unseal objects.
+	Encryption *Encryption
+	// Master is used to unwrap the data keys
+	// of sealed objects. If it is nil, the
+	// Sealer can only seal objects.
+	Master *MasterKey
+	// Fallback, if non-nil, is used to unwrap
+	// data keys that cannot be unwrapped with
+	// Master (i.e. while re-keying).
+	Fallback *MasterKey
+
+	lock         sync.Mutex
+	wrapped      []byte // most recently unwrapped key
+	aead         cipher.AEAD
+	fallback     bool // wrapped was unwrapped with Fallback
+	usedFallback bool
+}
+
+// NewSealer returns a Sealer that seals objects
+// with a new data key wrapped with master
+// and unseals objects with master.
+func NewSealer(master *MasterKey) (*Sealer, error) {
+	enc, err := NewEncryption(master)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealer{Encryption: enc, Master: master}, nil
+}
+
+// UsedFallback returns true if s has
+// unsealed any object using s.Fallback.
+func (s *Sealer) UsedFallback() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.usedFallback
+}
+
+// Seal returns data sealed for storage at path.
+// If s is nil, Seal returns data as-is.
+func (s *Sealer) Seal(path string, data []byte) ([]byte, error) {
+	if s == nil {
+		return data, nil
+	}
+	if s.Encryption == nil {
+		return nil, errors.New("blockfmt: Sealer has no data key")
+	}
+	aead, err := s.Encryption.aead()
+	if err != nil {
+		return nil, err
+	}
+	wrapped := s.Encryption.Wrapped
+	ns := aead.NonceSize()
+	out := make([]byte, 0, len(sealMagic)+binary.MaxVarintLen64+len(wrapped)+ns+len(data)+aead.Overhead())
+	out = append(out, sealMagic...)
+	out = binary.AppendUvarint(out, uint64(len(wrapped)))
+	out = append(out, wrapped...)
+	nonce := out[len(out) : len(out)+ns]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out = out[:len(out)+ns]
+	return aead.Seal(out, nonce, data, []byte(path)), nil
+}
+
+// unwrap returns the cipher for the data key
+// in wrapped, reusing the previous one if
+// the key is the same, and whether the key
+// was unwrapped with s.Fallback
+func (s *Sealer) unwrap(wrapped []byte) (cipher.AEAD, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.aead != nil && bytes.Equal(wrapped, s.wrapped) {
+		return s.aead, s.fallback, nil
+	}
+	if s.Master == nil {
+		return nil, false, ErrSealed
+	}
+	e := &Encryption{Wrapped: wrapped}
+	fallback := false
+	err := e.Unwrap(s.Master)
+	if errors.Is(err, ErrWrongKey) && s.Fallback != nil {
+		err = e.Unwrap(s.Fallback)
+		fallback = err == nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	aead, err := e.aead()
+	if err != nil {
+		return nil, false, err
+	}
+	s.wrapped, s.aead, s.fallback = slices.Clone(wrapped), aead, fallback
+	s.usedFallback = s.usedFallback || fallback
+	return aead, fallback, nil
+}
+
+// Unseal returns the contents of data,
+// which was sealed for storage at path.
+// If data is not sealed (see IsSealed),
+// it is returned as-is. If s is nil,
+// sealed data is rejected with ErrSealed.
+func (s *Sealer) Unseal(path string, data []byte) ([]byte, error) {
+	out, _, err := s.unseal(path, data)
+	return out, err
+}
+
+// unseal is Unseal, but it also returns
+// whether data was sealed with a data key
+// that is wrapped with s.Fallback
+func (s *Sealer) unseal(path string, data []byte) ([]byte, bool, error) {
+	if !IsSealed(data) {
+		return data, false, nil
+	}
+	if s == nil {
+		return nil, false, fmt.Errorf("%s: %w", path, ErrSealed)
+	}
+	rest := data[len(sealMagic):]
+	n, size := binary.Uvarint(rest)
+	if size <= 0 || n > uint64(len(rest)-size) {
+		return nil, false, fmt.Errorf("blockfmt: %s: malformed sealed object", path)
+	}
+	rest = rest[size:]
+	aead, fallback, err := s.unwrap(rest[:n])
+	if err != nil {
+		return nil, false, fmt.Errorf("blockfmt: %s: %w", path, err)
+	}
+	rest = rest[n:]
+	ns := aead.NonceSize()
+	if len(rest) < ns+aead.Overhead() {
+		return nil, false, fmt.Errorf("blockfmt: %s: malformed sealed object", path)
+	}
+	out, err := aead.Open(nil, rest[:ns], rest[ns:], []byte(path))
+	if err != nil {
+		return nil, false, fmt.Errorf("blockfmt: %s: unsealing: %w", path, err)
+	}
+	return out, fallback, nil
+}
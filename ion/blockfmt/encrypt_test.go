@@ -0,0 +1,562 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package blockfmt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/SnellerInc/sneller/ion"
+)
+
+func testKey(b byte) *MasterKey {
+	var k MasterKey
+	for i := range k {
+		k[i] = b + byte(i)
+	}
+	return &k
+}
+
+// convertFile converts testdata/parking2.json
+// into a single object, encrypted if key is non-nil
+func convertFile(t *testing.T, algo string, key *MasterKey) *BufferUploader {
+	f, err := os.Open("../../testdata/parking2.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out BufferUploader
+	align := 2048
+	out.PartSize = align * 4
+	c := Converter{
+		Output: &out,
+		Comp:   algo,
+		Inputs: []Input{{
+			R: f,
+			F: MustSuffixToFormat(".json"),
+		}},
+		Align:     align,
+		FlushMeta: align * 4,
+		MasterKey: key,
+	}
+	err = c.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &out
+}
+
+func decompressAll(t *testing.T, src []byte, trailer *Trailer) ([]byte, error) {
+	var d Decoder
+	d.Set(trailer, len(trailer.Blocks))
+	out := make([]byte, trailer.Decompressed())
+	_, err := d.Decompress(bytes.NewReader(src), out)
+	return out, err
+}
+
+// rows returns the rows in decompressed data;
+// the converter does not produce the same
+// bytes for the same input every time
+// (struct fields may be ordered differently),
+// so the output must be compared row-by-row
+func rows(t *testing.T, buf []byte) []ion.Datum {
+	var st ion.Symtab
+	var out []ion.Datum
+	for len(buf) > 0 {
+		var err error
+		if ion.IsBVM(buf) || ion.TypeOf(buf) == ion.AnnotationType {
+			buf, err = st.Unmarshal(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if ion.TypeOf(buf) == ion.NullType {
+			// nop pad
+			buf = buf[ion.SizeOf(buf):]
+			continue
+		}
+		var d ion.Datum
+		d, buf, err = ion.ReadDatum(&st, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+func equalRows(t *testing.T, got, want []byte) bool {
+	gr, wr := rows(t, got), rows(t, want)
+	if len(gr) != len(wr) {
+		return false
+	}
+	for i := range gr {
+		if !gr[i].Equal(wr[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestEncryptedConvert(t *testing.T) {
+	key := testKey(1)
+	for _, algo := range []string{"zstd", "zion"} {
+		t.Run(algo, func(t *testing.T) {
+			plain := convertFile(t, algo, nil)
+			pt, err := ReadTrailer(bytes.NewReader(plain.Bytes()), int64(len(plain.Bytes())))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pt.Encryption != nil {
+				t.Fatal("unexpected encryption")
+			}
+			want, err := decompressAll(t, plain.Bytes(), pt)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			enc := convertFile(t, algo, key)
+			buf := enc.Bytes()
+			trailer, err := ReadTrailer(bytes.NewReader(buf), int64(len(buf)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if trailer.Encryption == nil || len(trailer.Encryption.Wrapped) == 0 {
+				t.Fatal("missing encryption in trailer")
+			}
+			if trailer.Encryption.DataKey != nil {
+				t.Fatal("data key was stored in the trailer")
+			}
+			_, err = decompressAll(t, buf, trailer)
+			if !errors.Is(err, ErrNoDataKey) {
+				t.Fatalf("decompressing without a data key: got error %v", err)
+			}
+			err = trailer.Encryption.Unwrap(testKey(2))
+			if !errors.Is(err, ErrWrongKey) {
+				t.Fatalf("unwrap with the wrong key: got error %v", err)
+			}
+			err = trailer.Encryption.Unwrap(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := decompressAll(t, buf, trailer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalRows(t, got, want) {
+				t.Fatal("decrypted output differs from unencrypted output")
+			}
+			var errlog bytes.Buffer
+			if n := Validate(bytes.NewReader(buf), trailer, &errlog); n == 0 || errlog.Len() > 0 {
+				t.Fatalf("validate: %d rows: %s", n, errlog.String())
+			}
+
+			// decode each block individually from
+			// its byte range, as a ranged read would
+			var d Decoder
+			d.Set(trailer, len(trailer.Blocks))
+			off := 0
+			for i := range trailer.Blocks {
+				start := trailer.Blocks[i].Offset
+				end := trailer.Offset
+				if i < len(trailer.Blocks)-1 {
+					end = trailer.Blocks[i+1].Offset
+				}
+				size := trailer.Blocks[i].Chunks << trailer.BlockShift
+				var dst bytes.Buffer
+				_, err := d.CopyBytes(&dst, buf[start:end])
+				if err != nil {
+					t.Fatalf("block %d: %s", i, err)
+				}
+				if dst.Len() != size {
+					t.Fatalf("block %d: got %d bytes instead of %d", i, dst.Len(), size)
+				}
+				if !equalRows(t, dst.Bytes(), got[off:off+size]) {
+					t.Fatalf("block %d: contents differ", i)
+				}
+				off += size
+			}
+
+			// a tampered block must not decrypt
+			bad := bytes.Clone(buf)
+			bad[trailer.Blocks[0].Offset+20] ^= 1
+			_, err = decompressAll(t, bad, trailer)
+			if err == nil {
+				t.Fatal("no error decrypting a modified block")
+			}
+
+			// each block can be decoded on its own,
+			// but only in the position it was written
+			block := func(i int) []byte {
+				end := trailer.Offset
+				if i < len(trailer.Blocks)-1 {
+					end = trailer.Blocks[i+1].Offset
+				}
+				return buf[trailer.Blocks[i].Offset:end]
+			}
+			if len(trailer.Blocks) < 2 {
+				t.Fatal("expected more than one block")
+			}
+			for i := len(trailer.Blocks) - 1; i >= 0; i-- {
+				var d Decoder
+				d.SetRange(trailer, i, i+1)
+				_, err := d.CopyBytes(io.Discard, block(i))
+				if err != nil {
+					t.Fatalf("block %d on its own: %s", i, err)
+				}
+				d.SetRange(trailer, i, i+1)
+				_, err = d.CopyBytes(io.Discard, block((i+1)%len(trailer.Blocks)))
+				if err == nil {
+					t.Fatalf("no error decrypting a block in place of block %d", i)
+				}
+			}
+			// dropping the first frame of a block
+			// must be detected, too
+			first := block(1)
+			d.SetRange(trailer, 1, 2)
+			_, err = d.CopyBytes(io.Discard, first[ion.SizeOf(first):])
+			if err == nil {
+				t.Fatal("no error decrypting a block with a missing frame")
+			}
+		})
+	}
+}
+
+func TestEncryptedConvertMulti(t *testing.T) {
+	key := testKey(3)
+	var inputs []Input
+	for _, name := range []string{"cloudtrail.json", "parking2.json", "parking3.json"} {
+		f, err := os.Open("../../testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, Input{
+			R: f,
+			F: MustSuffixToFormat(".json"),
+		})
+	}
+	var out BufferUploader
+	align := 4096
+	out.PartSize = 2 * align
+	c := Converter{
+		Output:    &out,
+		Comp:      "zstd",
+		Inputs:    inputs,
+		Align:     align,
+		FlushMeta: align * 4,
+		Parallel:  2,
+		MasterKey: key,
+	}
+	if !c.MultiStream() {
+		t.Fatal("expected MultiStream to be true with 3 inputs")
+	}
+	err := c.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := out.Bytes()
+	trailer, err := ReadTrailer(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trailer.Encryption == nil {
+		t.Fatal("missing encryption in trailer")
+	}
+	err = trailer.Encryption.Unwrap(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errlog bytes.Buffer
+	rows := Validate(bytes.NewReader(buf), trailer, &errlog)
+	if errlog.Len() > 0 {
+		t.Fatal(errlog.String())
+	}
+
+	// prepending the encrypted object
+	// must decrypt and re-encrypt its contents
+	trailer.Encryption.DataKey = nil
+	f, err := os.Open("../../testdata/parking3.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out2 BufferUploader
+	out2.PartSize = 2 * align
+	c = Converter{
+		Output:    &out2,
+		Comp:      "zstd",
+		Inputs:    []Input{{R: f, F: MustSuffixToFormat(".json")}},
+		Align:     align,
+		FlushMeta: align * 4,
+		MasterKey: key,
+	}
+	c.Prepend.R = io.NopCloser(bytes.NewReader(buf[:trailer.Offset]))
+	c.Prepend.Trailer = trailer
+	err = c.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf2 := out2.Bytes()
+	t2, err := ReadTrailer(bytes.NewReader(buf2), int64(len(buf2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if t2.Encryption == nil || bytes.Equal(t2.Encryption.Wrapped, trailer.Encryption.Wrapped) {
+		t.Fatal("expected a new data key")
+	}
+	err = t2.Encryption.Unwrap(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows2 := Validate(bytes.NewReader(buf2), t2, &errlog)
+	if errlog.Len() > 0 {
+		t.Fatal(errlog.String())
+	}
+	if rows2 <= rows {
+		t.Fatalf("got %d rows after prepending %d rows", rows2, rows)
+	}
+}
+
+func TestEncryptionRewrap(t *testing.T) {
+	e, err := NewEncryption(testKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := bytes.Clone(e.DataKey)
+	err = e.Rewrap(testKey(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := Trailer{Algo: "zstd", BlockShift: 20, Encryption: e}
+	var buf ion.Buffer
+	var st ion.Symtab
+	tr.Encode(&buf, &st)
+	td := TrailerDecoder{Symbols: &st}
+	out, err := td.Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Encryption == nil || out.Encryption.DataKey != nil {
+		t.Fatalf("unexpected decoded encryption %+v", out.Encryption)
+	}
+	if err := out.Encryption.Unwrap(testKey(1)); !errors.Is(err, ErrWrongKey) {
+		t.Fatalf("unwrap with the old key: got error %v", err)
+	}
+	if err := out.Encryption.Unwrap(testKey(2)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Encryption.DataKey, key) {
+		t.Fatal("data key changed after rewrap")
+	}
+}
+
+func TestCopyWithTrailer(t *testing.T) {
+	src := convertFile(t, "zstd", testKey(1))
+	buf := src.Bytes()
+	trailer, err := ReadTrailer(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := trailer.Encryption.Unwrap(testKey(1)); err != nil {
+		t.Fatal(err)
+	}
+	want, err := decompressAll(t, buf, trailer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := trailer.Encryption.Rewrap(testKey(2)); err != nil {
+		t.Fatal(err)
+	}
+	// copy the object both in one piece
+	// and in several parts
+	for _, partsize := range []int{len(buf), 1024} {
+		t.Run(fmt.Sprintf("partsize=%d", partsize), func(t *testing.T) {
+			out := BufferUploader{PartSize: partsize}
+			err := CopyWithTrailer(&out, bytes.NewReader(buf), trailer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := out.Bytes()
+			if !bytes.Equal(got[:trailer.Offset], buf[:trailer.Offset]) {
+				t.Fatal("blocks were modified")
+			}
+			tr, err := ReadTrailer(bytes.NewReader(got), int64(len(got)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tr.Encryption.Unwrap(testKey(1)); !errors.Is(err, ErrWrongKey) {
+				t.Fatalf("unwrap with the old key: got error %v", err)
+			}
+			if err := tr.Encryption.Unwrap(testKey(2)); err != nil {
+				t.Fatal(err)
+			}
+			data, err := decompressAll(t, got, tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, want) {
+				t.Fatal("decompressed output differs")
+			}
+		})
+	}
+}
+
+func TestSealer(t *testing.T) {
+	s, err := NewSealer(testKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("the quick brown fox")
+	sealed, err := s.Seal("db/foo/bar/index", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSealed(sealed) || bytes.Contains(sealed, data) {
+		t.Fatal("sealed object contains plaintext")
+	}
+	out, err := s.Unseal("db/foo/bar/index", sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatalf("got %q", out)
+	}
+	// unsealed objects are passed through
+	out, err = s.Unseal("db/foo/bar/index", data)
+	if err != nil || !bytes.Equal(out, data) {
+		t.Fatalf("got %q, %v", out, err)
+	}
+	// the path is authenticated
+	if _, err := s.Unseal("db/foo/baz/index", sealed); err == nil {
+		t.Fatal("unsealed an object at the wrong path")
+	}
+	// the master key is required
+	other := &Sealer{Master: testKey(2)}
+	if _, err := other.Unseal("db/foo/bar/index", sealed); !errors.Is(err, ErrWrongKey) {
+		t.Fatalf("unseal with the wrong key: got error %v", err)
+	}
+	other.Fallback = testKey(1)
+	out, err = other.Unseal("db/foo/bar/index", sealed)
+	if err != nil || !bytes.Equal(out, data) {
+		t.Fatalf("got %q, %v", out, err)
+	}
+	if !other.UsedFallback() {
+		t.Fatal("UsedFallback() = false")
+	}
+	var nilsealer *Sealer
+	if _, err := nilsealer.Unseal("db/foo/bar/index", sealed); !errors.Is(err, ErrSealed) {
+		t.Fatalf("unseal without a sealer: got error %v", err)
+	}
+}
+
+func TestSealedInputs(t *testing.T) {
+	lowsplit(t, 16)
+	dir := NewDirFS(t.TempDir())
+	s, err := NewSealer(testKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var idx Index
+	idx.Inputs.Backing = dir
+	idx.SetSealer(s)
+	const files = 200
+	for i := 0; i < files; i++ {
+		_, err := idx.Inputs.Append(fmt.Sprintf("input/file-%d.json", i), fmt.Sprintf("etag-%d", i), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = idx.SyncInputs("db/foo/bar", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the input files must not be legible
+	// without the master key
+	check := func(key *MasterKey) {
+		t.Helper()
+		names, err := fs.Glob(dir, "db/foo/bar/inputs-*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) == 0 {
+			t.Fatal("no inputs files written")
+		}
+		for _, name := range names {
+			buf, err := fs.ReadFile(dir, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !IsSealed(buf) || bytes.Contains(buf, []byte("input/file-")) {
+				t.Fatalf("%s is not sealed", name)
+			}
+			if _, err := (&Sealer{Master: key}).Unseal(name, buf); err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+		}
+	}
+	check(testKey(1))
+
+	reload := func(s *Sealer) *FileTree {
+		var st ion.Symtab
+		var buf ion.Buffer
+		idx.Inputs.encode(&buf, &st)
+		f := &FileTree{Backing: dir, Sealer: s}
+		if err := f.decode(&st, buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	count := func(f *FileTree) (int, error) {
+		n := 0
+		err := f.Walk("", func(string, string, int) bool {
+			n++
+			return true
+		})
+		return n, err
+	}
+	if n, err := count(reload(s)); err != nil || n != files {
+		t.Fatalf("walk: got %d files, %v", n, err)
+	}
+	if _, err := count(reload(nil)); !errors.Is(err, ErrSealed) {
+		t.Fatalf("walk without a sealer: got error %v", err)
+	}
+
+	// reseal with a new master key
+	s2, err := NewSealer(testKey(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2.Fallback = testKey(1)
+	idx.Inputs = *reload(s2)
+	idx.SetSealer(s2)
+	if err := idx.Inputs.Reseal(); err != nil {
+		t.Fatal(err)
+	}
+	err = idx.SyncInputs("db/foo/bar", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range idx.ToDelete {
+		dir.Remove(idx.ToDelete[i].Path)
+	}
+	check(testKey(2))
+	if n, err := count(reload(&Sealer{Master: testKey(2)})); err != nil || n != files {
+		t.Fatalf("walk after reseal: got %d files, %v", n, err)
+	}
+}
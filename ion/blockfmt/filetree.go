@@ -299,6 +299,37 @@ type FileTree struct {
 	// Backing is the backing store for the tree.
 	// Backing must be set to perform tree operations.
 	Backing UploadFS
+
+	// Sealer, if non-nil, is used to unseal
+	// the nodes of the tree. (See also Index.SyncInputs.)
+	// Sealer is not part of the serialized tree.
+	Sealer *Sealer
+
+	// reseal is set by Reseal to force
+	// the next sync to write every node
+	reseal bool
+}
+
+// sealedFS is the UploadFS passed to
+// the level methods when a FileTree has a Sealer
+type sealedFS struct {
+	UploadFS
+	sealer *Sealer
+}
+
+func (f *FileTree) backing() UploadFS {
+	if f.Sealer == nil {
+		return f.Backing
+	}
+	return &sealedFS{UploadFS: f.Backing, sealer: f.Sealer}
+}
+
+func unsealFrom(fs UploadFS, p string, buf []byte) ([]byte, error) {
+	var s *Sealer
+	if sfs, ok := fs.(*sealedFS); ok {
+		s = sfs.sealer
+	}
+	return s.Unseal(p, buf)
 }
 
 // this is adjusted in testing
@@ -351,6 +382,10 @@ func (f *level) load(fs UploadFS) error {
 		}
 		return err
 	}
+	buf, err = unsealFrom(fs, p, buf)
+	if err != nil {
+		return fmt.Errorf("FileTree.load: %w", err)
+	}
 	return f.decode(buf)
 }
 
@@ -544,7 +579,7 @@ func (f *FileTree) Prefetch(input []Input) {
 	}
 	slices.Sort(lst)
 	lst = slices.Compact(lst)
-	f.root.prefetchInner(f.Backing, lst)
+	f.root.prefetchInner(f.backing(), lst)
 }
 
 func (f *level) prefetchInner(src UploadFS, lst []string) {
@@ -619,7 +654,7 @@ func (f *FileTree) replay() error {
 		return nil
 	}
 	for k, v := range f.journal.entries {
-		ret, err := f.root.appendInner(f.Backing, k, v.etag, v.id)
+		ret, err := f.root.appendInner(f.backing(), k, v.etag, v.id)
 		if err != nil {
 			return err
 		}
@@ -662,7 +697,7 @@ func (f *FileTree) Append(path, etag string, id int) (bool, error) {
 		return false, err
 	}
 	// perform a real tree insert:
-	ret, err := f.root.appendInner(f.Backing, path, etag, id)
+	ret, err := f.root.appendInner(f.backing(), path, etag, id)
 	if err != nil || !ret {
 		return ret, err
 	}
@@ -854,7 +889,7 @@ func (f *FileTree) sync(fn syncfn) error {
 	)
 	resident := f.root.leafSizes() + f.journal.memsize()
 	if !f.root.isDirty ||
-		(len(f.journal.entries) < minJournaled && resident < maxLeafResident) {
+		(!f.reseal && len(f.journal.entries) < minJournaled && resident < maxLeafResident) {
 		return nil
 	}
 	// launch all of the uploads asynchronously
@@ -869,6 +904,7 @@ func (f *FileTree) sync(fn syncfn) error {
 	// if we write out a new tree, then
 	// this journal is committed and we can restart
 	f.journal.clear()
+	f.reseal = false
 	{
 		// update oldroot; we maintain the invariant
 		// that oldroot is the root associated with the
@@ -1038,12 +1074,55 @@ func (f *level) unmarshalInner(st *ion.Symtab, in []byte, root bool) error {
 	return err
 }
 
+// Reseal loads every node of the tree and marks
+// it dirty so that the next call to Index.SyncInputs
+// writes out every node again, sealed with the
+// current Sealer. Reseal is used when re-keying
+// a table, in which case f.Sealer.Fallback
+// should be set to the previous master key.
+func (f *FileTree) Reseal() error {
+	err := f.replay()
+	if err != nil {
+		return err
+	}
+	fs := f.backing()
+	for i := range f.root.levels {
+		err := f.root.levels[i].loadAll(fs)
+		if err != nil {
+			return err
+		}
+	}
+	if len(f.root.levels) > 0 {
+		f.root.isDirty = true
+		f.reseal = true
+	}
+	return nil
+}
+
+func (f *level) loadAll(fs UploadFS) error {
+	err := f.load(fs)
+	if err != nil {
+		return err
+	}
+	f.isDirty = true
+	if f.isInner {
+		for i := range f.levels {
+			err := f.levels[i].loadAll(fs)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // Reset resets the contents of the tree
 func (f *FileTree) Reset() {
 	// reset all private fields
 	// except f.root.isInner
 	*f = FileTree{
 		Backing: f.Backing,
+		Sealer:  f.Sealer,
 	}
 	f.root.isInner = true
 }
@@ -1054,7 +1133,7 @@ func (f *FileTree) Reset() {
 // either inner nodes or leaf nodes that still
 // constitute part of the tree state).
 func (f *FileTree) EachFile(fn func(filename string)) error {
-	return f.root.eachFile(f.Backing, fn)
+	return f.root.eachFile(f.backing(), fn)
 }
 
 func (f *level) eachFile(fs UploadFS, fn func(filename string)) error {
@@ -1131,7 +1210,7 @@ func (f *FileTree) Walk(start string, walk func(name, etag string, id int) bool)
 	if err != nil {
 		return err
 	}
-	err, _ = f.root.walkInner(f.Backing, start, walk)
+	err, _ = f.root.walkInner(f.backing(), start, walk)
 	return err
 }
 
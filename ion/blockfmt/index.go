@@ -165,6 +165,12 @@ type Index struct {
 	// Scanning indicates that scanning has
 	// not yet completed.
 	Scanning bool
+	// Stats are the statistics of the rows
+	// in the objects referenced by the index.
+	// Stats may be nil if statistics were
+	// not collected when the objects were
+	// ingested.
+	Stats *Stats
 }
 
 const (
@@ -231,6 +237,7 @@ func Sign(key *Key, idx *Index) ([]byte, error) {
 		expiry   = st.Intern("expiry")
 		indirect = st.Intern("indirect")
 		inputs   = st.Intern("inputs")
+		stats    = st.Intern("stats")
 	)
 	var ibuf ion.Buffer
 	buf.BeginStruct(-1)
@@ -280,6 +287,10 @@ func Sign(key *Key, idx *Index) ([]byte, error) {
 		}
 		buf.EndList()
 	}
+	if idx.Stats != nil {
+		buf.BeginField(stats)
+		idx.Stats.encode(&buf, &st)
+	}
 	if len(idx.Inline) == 0 {
 		// Do nothing...
 	} else if idx.Algo != "" {
@@ -594,6 +605,9 @@ func DecodeIndex(key *Key, index []byte, opts Flag) (*Index, error) {
 			})
 		case "last-scan":
 			idx.LastScan, _, err = ion.ReadTime(field)
+		case "stats":
+			idx.Stats = new(Stats)
+			err = idx.Stats.decode(&st, field)
 		default:
 			err = fmt.Errorf("unexpected field %q", name)
 		}
@@ -655,10 +669,16 @@ func uuid() string {
 // expiry relative to the current time.
 // Callers are required to call SyncInputs after
 // updating idx.Inputs.
+// If idx.Inputs.Sealer is non-nil,
+// the new input files are sealed.
 func (idx *Index) SyncInputs(dir string, expiry time.Duration) error {
 	var lock sync.Mutex
 	return idx.Inputs.sync(func(old string, buf []byte) (string, string, error) {
 		p := path.Join(dir, "inputs-"+uuid())
+		buf, err := idx.Inputs.Sealer.Seal(p, buf)
+		if err != nil {
+			return "", "", err
+		}
 		etag, err := idx.Inputs.Backing.WriteFile(p, buf)
 		if err == nil && old != "" {
 			// this closure can be called
@@ -674,6 +694,15 @@ func (idx *Index) SyncInputs(dir string, expiry time.Duration) error {
 	})
 }
 
+// SetSealer sets the Sealer used to seal and
+// unseal the files that hold idx.Inputs and
+// idx.Indirect. The signed index itself is sealed
+// and unsealed by the caller (see Sealer.Seal).
+func (idx *Index) SetSealer(s *Sealer) {
+	idx.Inputs.Sealer = s
+	idx.Indirect.Sealer = s
+}
+
 // SyncOutputs synchronizes idx.Indirect to a directory
 // with the provided UploadFS. SyncOutputs uses maxInlined
 // to determine which (if any) of the leading entries in
@@ -204,6 +204,13 @@ func TestIndexEncoding(t *testing.T) {
 					isInner: true,
 				},
 			},
+			Stats: &Stats{
+				Rows: 100,
+				Fields: []FieldStats{
+					{Name: "a", Count: 100, Sketch: make([]byte, sketchSize)},
+					{Name: "b", Count: 20, Sketch: make([]byte, sketchSize)},
+				},
+			},
 			Inline: []Descriptor{
 				{
 					ObjectInfo: ObjectInfo{
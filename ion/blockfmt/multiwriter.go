@@ -120,6 +120,7 @@ type singleStream struct {
 	comp        Compressor
 	lastblock   int64
 	flushblocks int
+	run         uint64
 
 	bg chan error
 }
@@ -169,6 +170,10 @@ func (m *MultiWriter) Open() (io.WriteCloser, error) {
 	if c == nil {
 		return nil, fmt.Errorf("blockfmt: no such compression algorithm %q", m.Algo)
 	}
+	c, err := m.Trailer.Encryption.seal(c)
+	if err != nil {
+		return nil, err
+	}
 	s := &singleStream{parent: m, tid: tid, comp: c}
 	s.curspan.partnum = m.nextpart
 	m.nextpart++
@@ -177,7 +182,8 @@ func (m *MultiWriter) Open() (io.WriteCloser, error) {
 
 func (m *MultiWriter) writeStart(r io.Reader, t *Trailer) error {
 	m.init()
-	if t.Algo != m.Algo || 1<<t.BlockShift != m.InputAlign {
+	if t.Algo != m.Algo || 1<<t.BlockShift != m.InputAlign ||
+		t.Encryption != nil || m.Trailer.Encryption != nil {
 		return nil // not directly compatible
 	}
 	j := 0
@@ -237,6 +243,7 @@ func (s *singleStream) Flush() error {
 			offset: s.lastblock,
 			chunks: s.flushblocks,
 			ranges: s.futureRange.pop(),
+			run:    s.run,
 		})
 		s.lastblock = int64(len(s.buf))
 		s.flushblocks = 0
@@ -273,8 +280,14 @@ func (s *singleStream) Write(p []byte) (int, error) {
 	if s.flushblocks == 0 && !s.parent.skipChecks && !ion.IsBVM(p) {
 		return 0, fmt.Errorf("blockfmt.MultiWriter: flush, but then no BVM")
 	}
-	s.flushblocks++
 	var err error
+	if s.flushblocks == 0 {
+		s.run, err = startRun(s.comp)
+		if err != nil {
+			return 0, err
+		}
+	}
+	s.flushblocks++
 	s.buf, err = appendFrame(s.buf, s.comp, p)
 	return len(p), err
 }
@@ -432,6 +445,7 @@ func (m *MultiWriter) finalize() {
 				offset: block.offset + offset,
 				chunks: block.chunks,
 				ranges: block.ranges,
+				run:    block.run,
 			})
 			prev = block.offset
 		}
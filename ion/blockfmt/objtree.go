@@ -37,6 +37,12 @@ type IndirectTree struct {
 	// Sparse describes the intervals within refs
 	// that correspond to particular time ranges.
 	Sparse SparseIndex
+
+	// Sealer, if non-nil, is used to seal
+	// new lists of descriptors and to unseal
+	// the lists pointed to by Refs.
+	// Sealer is not part of the serialized tree.
+	Sealer *Sealer
 }
 
 // IndirectRef references an object
@@ -166,21 +172,32 @@ func keepAny(t *Trailer, filt *Filter) bool {
 }
 
 func (i *IndirectTree) decode(ifs InputFS, src *IndirectRef, in []Descriptor, filt *Filter) ([]Descriptor, error) {
-	f, err := ifs.Open(src.Path)
+	buf, _, err := i.read(ifs, src)
 	if err != nil {
 		return in, err
 	}
+	return i.parseList(buf, in, filt)
+}
+
+// read reads the decompressed list of descriptors
+// pointed to by src and reports whether it was
+// sealed with a data key wrapped with i.Sealer.Fallback
+func (i *IndirectTree) read(ifs InputFS, src *IndirectRef) ([]byte, bool, error) {
+	f, err := ifs.Open(src.Path)
+	if err != nil {
+		return nil, false, err
+	}
 	defer f.Close()
 	info, err := f.Stat()
 	if err != nil {
-		return in, err
+		return nil, false, err
 	}
 	etag, err := ifs.ETag(src.Path, info)
 	if err != nil {
-		return in, err
+		return nil, false, err
 	}
 	if etag != src.ETag {
-		return in, fmt.Errorf("in IndirectTree: ETag changed: %s -> %s", src.ETag, etag)
+		return nil, false, fmt.Errorf("in IndirectTree: ETag changed: %s -> %s", src.ETag, etag)
 	}
 	// the contents of the object
 	// pointed to by an IndirectRef
@@ -193,14 +210,22 @@ func (i *IndirectTree) decode(ifs InputFS, src *IndirectRef, in []Descriptor, fi
 	buf := make([]byte, info.Size())
 	_, err = io.ReadFull(f, buf)
 	if err != nil {
-		return in, fmt.Errorf("IndirectTree: io.ReadFull: %w", err)
+		return nil, false, fmt.Errorf("IndirectTree: io.ReadFull: %w", err)
+	}
+	buf, stale, err := i.Sealer.unseal(src.Path, buf)
+	if err != nil {
+		return nil, false, fmt.Errorf("IndirectTree: %w", err)
 	}
 	buf, err = compr.DecodeZstd(buf, nil)
 	if err != nil {
-		return in, fmt.Errorf("IndirectTree: compr.DecodeZstd: %w", err)
+		return nil, false, fmt.Errorf("IndirectTree: compr.DecodeZstd: %w", err)
 	}
+	return buf, stale, nil
+}
+
+func (i *IndirectTree) parseList(buf []byte, in []Descriptor, filt *Filter) ([]Descriptor, error) {
 	var st ion.Symtab
-	buf, err = st.Unmarshal(buf)
+	buf, err := st.Unmarshal(buf)
 	if err != nil {
 		return in, fmt.Errorf("IndirectTree.load: %w", err)
 	}
@@ -306,7 +331,22 @@ func (idx *Index) append(i *IndirectTree, ofs UploadFS, basedir string, lst []De
 		pushSummary(&i.Sparse, lst)
 	}
 	all := append(prepend, lst...)
+	err = writeRef(ofs, basedir, all, i.Sealer, r)
+	if err != nil {
+		return err
+	}
+	if prev != "" {
+		idx.ToDelete = append(idx.ToDelete, Quarantined{
+			Path:   prev,
+			Expiry: date.Now().Add(expiry).Truncate(time.Microsecond),
+		})
+	}
+	return nil
+}
 
+// writeRef writes the list of descriptors all
+// to a new file in basedir and points r at it
+func writeRef(ofs UploadFS, basedir string, all []Descriptor, s *Sealer, r *IndirectRef) error {
 	// encode the list of objects:
 	var buf ion.Buffer
 	var st ion.Symtab
@@ -322,6 +362,10 @@ func (idx *Index) append(i *IndirectTree, ofs UploadFS, basedir string, lst []De
 	compressed := compr.Compression("zstd").Compress(append(symtab, body...), nil)
 
 	p := path.Join(basedir, "indirect-"+uuid())
+	compressed, err := s.Seal(p, compressed)
+	if err != nil {
+		return err
+	}
 	etag, err := ofs.WriteFile(p, compressed)
 	if err != nil {
 		return err
@@ -343,7 +387,46 @@ func (idx *Index) append(i *IndirectTree, ofs UploadFS, basedir string, lst []De
 		return fmt.Errorf("stored etag is %s instead of %s?", storedEtag, etag)
 	}
 	r.LastModified = date.FromTime(info.ModTime()).Truncate(time.Microsecond)
-	if prev != "" {
+	return nil
+}
+
+// UpdateIndirect calls update on each of the
+// descriptors in idx.Indirect. Each list of
+// descriptors in which update returns true for
+// at least one descriptor, or which was sealed
+// with a data key that is wrapped with the
+// Fallback key of idx.Indirect.Sealer,
+// is written to a new file in dir, and the file
+// that previously held the list is added to
+// idx.ToDelete. The update function must not
+// change the time ranges of a descriptor.
+func (idx *Index) UpdateIndirect(ofs UploadFS, dir string, expiry time.Duration, update func(d *Descriptor) (bool, error)) error {
+	i := &idx.Indirect
+	for j := range i.Refs {
+		r := &i.Refs[j]
+		buf, changed, err := i.read(ofs, r)
+		if err != nil {
+			return err
+		}
+		lst, err := i.parseList(buf, nil, nil)
+		if err != nil {
+			return err
+		}
+		for k := range lst {
+			ok, err := update(&lst[k])
+			if err != nil {
+				return err
+			}
+			changed = changed || ok
+		}
+		if !changed {
+			continue
+		}
+		prev := r.Path
+		err = writeRef(ofs, dir, lst, i.Sealer, r)
+		if err != nil {
+			return err
+		}
 		idx.ToDelete = append(idx.ToDelete, Quarantined{
 			Path:   prev,
 			Expiry: date.Now().Add(expiry).Truncate(time.Microsecond),
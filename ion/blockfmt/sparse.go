@@ -62,6 +62,11 @@ func (s *SparseIndex) Trim(j int) SparseIndex {
 	}
 }
 
+// Consts returns the constant fields that were
+// inserted into every row covered by s.
+// The returned struct is empty if there are none.
+func (s *SparseIndex) Consts() ion.Struct { return s.consts }
+
 // Fields returns the number of individually
 // indexed fields.
 func (s *SparseIndex) Fields() int { return len(s.indices) }
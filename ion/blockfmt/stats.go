@@ -0,0 +1,401 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package blockfmt
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+
+	"github.com/SnellerInc/sneller/ion"
+
+	"github.com/dchest/siphash"
+)
+
+// MaxStatsFields is the maximum number of
+// top-level fields for which Stats are collected.
+// Fields beyond the first MaxStatsFields
+// are not tracked.
+const MaxStatsFields = 256
+
+const (
+	// each distinct-count sketch is a
+	// HyperLogLog sketch with 1<<sketchBits
+	// one-byte registers, which has a standard
+	// error of about 6.5%
+	sketchBits = 8
+	sketchSize = 1 << sketchBits
+
+	// fixed keys so that sketches produced
+	// by different processes can be merged
+	sketchKey0 = 0x736e656c6c657221
+	sketchKey1 = 0x7374617473696e67
+)
+
+// Stats are statistics about the rows of
+// a table that are collected during ingestion.
+type Stats struct {
+	// Rows is the number of rows.
+	Rows int64
+	// Fields are the statistics for the
+	// top-level fields of the rows,
+	// sorted by name.
+	Fields []FieldStats
+}
+
+// FieldStats are the statistics
+// for one top-level field.
+type FieldStats struct {
+	// Name is the name of the field.
+	Name string
+	// Count is the number of rows in which
+	// the field is present and not null.
+	Count int64
+	// Sketch is a sketch of the distinct
+	// values of the field.
+	Sketch []byte
+}
+
+// Distinct returns the estimated number
+// of distinct non-null values of the field.
+func (f *FieldStats) Distinct() int64 {
+	n := int64(math.Round(sketchEstimate(f.Sketch)))
+	if n > f.Count {
+		n = f.Count
+	}
+	return n
+}
+
+// Field returns the statistics for the
+// field with the given name, or nil if
+// no statistics are present for the field.
+func (s *Stats) Field(name string) *FieldStats {
+	return findField(s.Fields, name)
+}
+
+func findField(lst []FieldStats, name string) *FieldStats {
+	i := sort.Search(len(lst), func(i int) bool {
+		return lst[i].Name >= name
+	})
+	if i < len(lst) && lst[i].Name == name {
+		return &lst[i]
+	}
+	return nil
+}
+
+// Distinct returns the estimated number of
+// distinct non-null values of the named field.
+// Fields that have not been tracked have an
+// unknown number of distinct values.
+func (s *Stats) Distinct(name string) (int64, bool) {
+	f := s.Field(name)
+	if f == nil {
+		return 0, s.complete()
+	}
+	return f.Distinct(), true
+}
+
+// NullFraction returns the fraction of rows
+// in which the named field is null or missing.
+func (s *Stats) NullFraction(name string) (float64, bool) {
+	if s.Rows == 0 {
+		return 0, false
+	}
+	f := s.Field(name)
+	if f == nil {
+		return 1, s.complete()
+	}
+	return 1 - float64(f.Count)/float64(s.Rows), true
+}
+
+// complete returns whether every field
+// in the rows has been tracked, in which
+// case a field without statistics is
+// known never to be present
+func (s *Stats) complete() bool {
+	return len(s.Fields) < MaxStatsFields
+}
+
+// Merge adds the statistics in o to s.
+func (s *Stats) Merge(o *Stats) {
+	s.Rows += o.Rows
+	// new fields are appended, so only the
+	// first n fields are sorted until the end
+	n := len(s.Fields)
+	for i := range o.Fields {
+		src := &o.Fields[i]
+		f := findField(s.Fields[:n], src.Name)
+		if f == nil {
+			if len(s.Fields) >= MaxStatsFields {
+				continue
+			}
+			s.Fields = append(s.Fields, FieldStats{
+				Name:   src.Name,
+				Sketch: make([]byte, sketchSize),
+			})
+			f = &s.Fields[len(s.Fields)-1]
+		}
+		f.Count += src.Count
+		sketchMerge(f.Sketch, src.Sketch)
+	}
+	if len(s.Fields) > n {
+		sort.Slice(s.Fields, func(i, j int) bool {
+			return s.Fields[i].Name < s.Fields[j].Name
+		})
+	}
+}
+
+func (s *Stats) encode(dst *ion.Buffer, st *ion.Symtab) {
+	var (
+		rows   = st.Intern("rows")
+		fields = st.Intern("fields")
+		name   = st.Intern("name")
+		count  = st.Intern("count")
+		sketch = st.Intern("sketch")
+	)
+	dst.BeginStruct(-1)
+	dst.BeginField(rows)
+	dst.WriteInt(s.Rows)
+	if len(s.Fields) > 0 {
+		dst.BeginField(fields)
+		dst.BeginList(-1)
+		for i := range s.Fields {
+			dst.BeginStruct(-1)
+			dst.BeginField(name)
+			dst.WriteString(s.Fields[i].Name)
+			dst.BeginField(count)
+			dst.WriteInt(s.Fields[i].Count)
+			dst.BeginField(sketch)
+			dst.WriteBlob(s.Fields[i].Sketch)
+			dst.EndStruct()
+		}
+		dst.EndList()
+	}
+	dst.EndStruct()
+}
+
+func (s *Stats) decode(st *ion.Symtab, body []byte) error {
+	return unpackStruct(st, body, func(name string, field []byte) error {
+		var err error
+		switch name {
+		case "rows":
+			s.Rows, _, err = ion.ReadInt(field)
+		case "fields":
+			err = unpackList(field, func(field []byte) error {
+				var f FieldStats
+				err := unpackStruct(st, field, func(name string, field []byte) error {
+					var err error
+					switch name {
+					case "name":
+						f.Name, _, err = ion.ReadString(field)
+					case "count":
+						f.Count, _, err = ion.ReadInt(field)
+					case "sketch":
+						f.Sketch, _, err = ion.ReadBytes(field)
+					default:
+						// ignore
+					}
+					return err
+				})
+				if err != nil {
+					return err
+				}
+				if len(f.Sketch) != sketchSize {
+					return fmt.Errorf("stats: field %q has sketch size %d", f.Name, len(f.Sketch))
+				}
+				s.Fields = append(s.Fields, f)
+				return nil
+			})
+		default:
+			// ignore
+		}
+		return err
+	})
+}
+
+// Rows returns the number of rows in the
+// objects referenced by the index, or false
+// if the index has no statistics.
+func (idx *Index) Rows() (int64, bool) {
+	if idx == nil || idx.Stats == nil {
+		return 0, false
+	}
+	return idx.Stats.Rows, true
+}
+
+// Distinct returns the estimated number of
+// distinct non-null values of the given top-level
+// field, or false if the index has no statistics.
+func (idx *Index) Distinct(field string) (int64, bool) {
+	if idx == nil || idx.Stats == nil {
+		return 0, false
+	}
+	return idx.Stats.Distinct(field)
+}
+
+// NullFraction returns the fraction of rows
+// in which the given top-level field is null
+// or missing, or false if the index has no statistics.
+func (idx *Index) NullFraction(field string) (float64, bool) {
+	if idx == nil || idx.Stats == nil {
+		return 0, false
+	}
+	return idx.Stats.NullFraction(field)
+}
+
+func sketchAdd(sketch []byte, h uint64) {
+	i := h >> (64 - sketchBits)
+	// the rank is the position of the first set bit
+	// in the remaining bits; the extra bit
+	// bounds the rank when they are all zero
+	rank := byte(bits.LeadingZeros64(h<<sketchBits|1<<(sketchBits-1))) + 1
+	if rank > sketch[i] {
+		sketch[i] = rank
+	}
+}
+
+func sketchMerge(dst, src []byte) {
+	for i := range src {
+		if src[i] > dst[i] {
+			dst[i] = src[i]
+		}
+	}
+}
+
+func sketchEstimate(sketch []byte) float64 {
+	if len(sketch) == 0 {
+		return 0
+	}
+	m := float64(len(sketch))
+	sum := 0.0
+	zeros := 0
+	for _, r := range sketch {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		// small range correction (linear counting)
+		e = m * math.Log(m/float64(zeros))
+	}
+	return e
+}
+
+// statsCollector collects Stats from the
+// rows committed to an ion.Chunker
+// (see ion.Chunker.Observe)
+type statsCollector struct {
+	rows   int64
+	fields map[string]*FieldStats
+	// fields indexed by the symbol ID
+	// they were last seen with
+	bysym []*FieldStats
+	tmp   ion.Buffer
+}
+
+func newStatsCollector() *statsCollector {
+	return &statsCollector{fields: make(map[string]*FieldStats)}
+}
+
+func (c *statsCollector) observe(st *ion.Symtab, obj []byte) {
+	if ion.TypeOf(obj) != ion.StructType {
+		return
+	}
+	c.rows++
+	body, _ := ion.Contents(obj)
+	for len(body) > 0 {
+		sym, rest, err := ion.ReadLabel(body)
+		if err != nil {
+			return
+		}
+		size := ion.SizeOf(rest)
+		if size <= 0 || size > len(rest) {
+			return
+		}
+		val := rest[:size]
+		body = rest[size:]
+		if isNull(val) {
+			continue
+		}
+		f := c.field(st, sym)
+		if f == nil {
+			continue
+		}
+		f.Count++
+		sketchAdd(f.Sketch, c.hash(st, val))
+	}
+}
+
+func isNull(val []byte) bool {
+	return ion.TypeOf(val) == ion.NullType || val[0]&0xf == 0xf
+}
+
+func (c *statsCollector) field(st *ion.Symtab, sym ion.Symbol) *FieldStats {
+	name, ok := st.Lookup(sym)
+	if !ok {
+		return nil
+	}
+	if int(sym) < len(c.bysym) {
+		if f := c.bysym[sym]; f != nil && f.Name == name {
+			return f
+		}
+	}
+	f := c.fields[name]
+	if f == nil {
+		if len(c.fields) >= MaxStatsFields {
+			return nil
+		}
+		f = &FieldStats{Name: name, Sketch: make([]byte, sketchSize)}
+		c.fields[name] = f
+	}
+	if int(sym) >= len(c.bysym) {
+		c.bysym = append(c.bysym, make([]*FieldStats, int(sym)+1-len(c.bysym))...)
+	}
+	c.bysym[sym] = f
+	return f
+}
+
+// hash hashes the encoded value; symbols are
+// hashed as the equivalent strings so that the
+// hash doesn't depend on the symbol table
+func (c *statsCollector) hash(st *ion.Symtab, val []byte) uint64 {
+	if ion.TypeOf(val) == ion.SymbolType {
+		sym, _, err := ion.ReadSymbol(val)
+		if err == nil {
+			c.tmp.Reset()
+			c.tmp.WriteString(st.Get(sym))
+			val = c.tmp.Bytes()
+		}
+	}
+	return siphash.Hash(sketchKey0, sketchKey1, val)
+}
+
+// result returns the collected statistics
+func (c *statsCollector) result() *Stats {
+	s := &Stats{
+		Rows:   c.rows,
+		Fields: make([]FieldStats, 0, len(c.fields)),
+	}
+	for _, f := range c.fields {
+		s.Fields = append(s.Fields, *f)
+	}
+	sort.Slice(s.Fields, func(i, j int) bool {
+		return s.Fields[i].Name < s.Fields[j].Name
+	})
+	return s
+}
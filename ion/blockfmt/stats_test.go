@@ -0,0 +1,122 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package blockfmt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/SnellerInc/sneller/ion"
+)
+
+func TestConvertStats(t *testing.T) {
+	const rows = 5000
+	input := func(start int) io.ReadCloser {
+		var buf bytes.Buffer
+		for i := start; i < start+rows/2; i++ {
+			fmt.Fprintf(&buf, `{"id": %d, "grp": "g%d", "nothing": null`, i, i%10)
+			if i%4 == 0 {
+				fmt.Fprintf(&buf, `, "opt": %d`, i)
+			}
+			buf.WriteString("}\n")
+		}
+		return io.NopCloser(&buf)
+	}
+	for _, parallel := range []int{1, 2} {
+		t.Run(fmt.Sprintf("parallel=%d", parallel), func(t *testing.T) {
+			var out BufferUploader
+			align := 4096
+			out.PartSize = 2 * align
+			c := Converter{
+				Output: &out,
+				Comp:   "zstd",
+				Inputs: []Input{
+					{R: input(0), F: MustSuffixToFormat(".json")},
+					{R: input(rows / 2), F: MustSuffixToFormat(".json")},
+				},
+				Align:     align,
+				FlushMeta: align * 4,
+				Parallel:  parallel,
+			}
+			if err := c.Run(); err != nil {
+				t.Fatal(err)
+			}
+			s := c.Stats()
+			if s.Rows != rows {
+				t.Fatalf("got %d rows, want %d", s.Rows, rows)
+			}
+			distinct := func(name string, want int64, tolerance float64) {
+				t.Helper()
+				n, ok := s.Distinct(name)
+				if !ok {
+					t.Fatalf("no distinct count for %s", name)
+				}
+				if math.Abs(float64(n-want)) > tolerance*float64(want) {
+					t.Errorf("%s: estimated %d distinct values, want %d", name, n, want)
+				}
+			}
+			distinct("id", rows, 0.15)
+			distinct("grp", 10, 0.15)
+			distinct("opt", rows/4, 0.15)
+			nulls := func(name string, want float64) {
+				t.Helper()
+				f, ok := s.NullFraction(name)
+				if !ok {
+					t.Fatalf("no null fraction for %s", name)
+				}
+				if f != want {
+					t.Errorf("%s: null fraction %g, want %g", name, f, want)
+				}
+			}
+			nulls("id", 0)
+			nulls("opt", 0.75)
+			nulls("nothing", 1)
+			nulls("not-present", 1)
+		})
+	}
+}
+
+func TestStatsMerge(t *testing.T) {
+	collect := func(start, end int) *Stats {
+		c := newStatsCollector()
+		var st ion.Symtab
+		var buf ion.Buffer
+		x := st.Intern("x")
+		for i := start; i < end; i++ {
+			buf.Reset()
+			buf.BeginStruct(-1)
+			buf.BeginField(x)
+			buf.WriteInt(int64(i))
+			buf.EndStruct()
+			c.observe(&st, buf.Bytes())
+		}
+		return c.result()
+	}
+	s := collect(0, 1000)
+	s.Merge(collect(500, 1500))
+	if s.Rows != 2000 {
+		t.Errorf("got %d rows, want 2000", s.Rows)
+	}
+	f := s.Field("x")
+	if f == nil || f.Count != 2000 {
+		t.Fatalf("unexpected stats for x: %+v", f)
+	}
+	if n := f.Distinct(); n < 1300 || n > 1700 {
+		t.Errorf("estimated %d distinct values, want about 1500", n)
+	}
+}
@@ -73,6 +73,9 @@ type Trailer struct {
 	// of timestamp ranges and constant fields
 	// within Blocks.
 	Sparse SparseIndex
+	// Encryption, if non-nil, describes
+	// the encryption of each block.
+	Encryption *Encryption
 }
 
 // Encode encodes a trailer to the provided buffer
@@ -94,6 +97,11 @@ func (t *Trailer) Encode(dst *ion.Buffer, st *ion.Symtab) {
 	dst.BeginField(st.Intern("blockshift"))
 	dst.WriteInt(int64(t.BlockShift))
 
+	if t.Encryption != nil {
+		dst.BeginField(st.Intern("encryption"))
+		t.Encryption.encode(dst, st)
+	}
+
 	if t.Sparse.blocks != len(t.Blocks) {
 		panic("Trailer.Encode: Sparse #blocks don't match trailer blocks")
 	}
@@ -350,6 +358,9 @@ func (d *TrailerDecoder) decode(t *Trailer, body []byte) error {
 				return err
 			}
 			t.BlockShift = int(shift)
+		case "encryption":
+			t.Encryption = new(Encryption)
+			return t.Encryption.decode(d.Symbols, body)
 		case "sparse":
 			seenSparse = true
 			return d.decodeSparse(&t.Sparse, body)
@@ -82,6 +82,12 @@ type Chunker struct {
 	// symbolized WalkTimeRanges
 	rangeSyms [][]Symbol
 
+	// Observe, if non-nil, is called by Commit
+	// with each object that is committed.
+	// The object is encoded with the symbols
+	// in Symbols and must not be retained.
+	Observe func(st *Symtab, obj []byte)
+
 	tmpbuf  Buffer // scratch buffer
 	lastoff int    // last committed object offset
 	lastst  int    // last symbol table size
@@ -394,6 +400,9 @@ func (c *Chunker) Commit() error {
 	if lastsize > c.Align {
 		return err2big(c.Align)
 	}
+	if c.Observe != nil {
+		c.Observe(&c.Symbols, cur[c.lastoff:])
+	}
 	c.compressed = false
 	// we're guessing here that if we leave enough
 	// slack space for the symbol table to double
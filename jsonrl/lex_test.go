@@ -183,6 +183,21 @@ func TestParseWithHints(t *testing.T) {
 			hints:    `{"value": "datetime"}`,
 			expected: `{"value": "2019-07-26T00:00:00Z"}`,
 		},
+		{
+			input:    `{"value": "12/Oct/2021:11:58:05 -0400"}`,
+			hints:    `{"value": {"format": "%d/%b/%Y:%H:%M:%S %z"}}`,
+			expected: `{"value": "2021-10-12T15:58:05Z"}`,
+		},
+		{
+			input:    `{"value": "2021-10-12 17:58:05", "other": "2021-10-12 17:58:05"}`,
+			hints:    `{"value": {"format": "%Y-%m-%d %H:%M:%S", "zone": "Europe/Berlin", "type": ["datetime", "no_index"]}}`,
+			expected: `{"value": "2021-10-12T15:58:05Z", "other": "2021-10-12T17:58:05Z"}`,
+		},
+		{
+			input:    `{"value": "not a date"}`,
+			hints:    `{"value": {"format": "%Y-%m-%d"}}`,
+			expected: `{"value": "not a date"}`,
+		},
 		{
 			input:    `{"value": 1634054285}`,
 			hints:    `{"value": "unix_seconds"}`,
@@ -66,6 +66,7 @@ const (
 type Hint struct {
 	parent              *Hint
 	hints               hints
+	format              *date.Format
 	isRecursiveWildcard bool
 	fields              map[string]*Hint
 	wildcard            *Hint
@@ -100,6 +101,20 @@ type Hint struct {
 //   - bool
 //   - datetime -> RFC3339Nano
 //   - unix_seconds
+//
+// Datetime strings in other formats can be parsed by
+// using an object with a strptime-style layout (see
+// date.CompileFormat) as the hint:
+//
+//	{
+//	  "path.to.time": {"format": "%d/%b/%Y:%H:%M:%S %z"},
+//	  "path.to.local": {"format": "%Y-%m-%d %H:%M:%S", "zone": "Europe/Berlin"},
+//	  "path.to.other": {"format": "%F %T", "type": ["datetime", "no_index"]}
+//	}
+//
+// The optional "zone" is the time zone of timestamps
+// without a UTC offset, and the optional "type" lists
+// additional hints (which must include datetime).
 func ParseHint(rules []byte) (*Hint, error) {
 	var obj map[string]interface{}
 	err := json.Unmarshal(rules, &obj)
@@ -114,15 +129,15 @@ func ParseHint(rules []byte) (*Hint, error) {
 		return nil, err
 	}
 
-	root := makeHintNode(nil, hintDefault, false)
+	root := makeHintNode(nil, hintDefault, nil, false)
 
 	for _, path := range keys {
 		value := obj[path]
-		hints, err := hintsFromJSON(value)
+		hints, format, err := hintsFromJSON(value)
 		if err != nil {
 			return nil, err
 		}
-		if err = root.encodeRuleString(path, hints); err != nil {
+		if err = root.encodeRuleString(path, hints, format); err != nil {
 			return nil, err
 		}
 	}
@@ -178,26 +193,73 @@ func skipValue(d *json.Decoder) error {
 
 var errErrDelim = errors.New("invalid end of array or object")
 
-func hintsFromJSON(value interface{}) (hints, error) {
-	s, ok := value.(string)
-	if ok {
-		return hintFromString(s)
-	}
-	a, ok := value.([]string)
-
-	if ok {
+func hintsFromJSON(value interface{}) (hints, *date.Format, error) {
+	switch v := value.(type) {
+	case string:
+		h, err := hintFromString(v)
+		return h, nil, err
+	case []interface{}:
 		result := hintDefault
-		for _, v := range a {
-			h, err := hintFromString(v)
+		for i := range v {
+			s, ok := v[i].(string)
+			if !ok {
+				return hintDefault, nil, errors.New("unsupported hint type; expected 'string' or '[]string'")
+			}
+			h, err := hintFromString(s)
 			if err != nil {
-				return hintDefault, err
+				return hintDefault, nil, err
 			}
 			result |= h
 		}
-		return result, nil
+		return result, nil, nil
+	case map[string]interface{}:
+		return formatFromJSON(v)
+	}
+	return hintDefault, nil, errors.New("unsupported hint type; expected 'string' or '[]string'")
+}
+
+// formatFromJSON parses a datetime hint
+// of the form {"format": ..., "zone": ..., "type": ...}
+func formatFromJSON(obj map[string]interface{}) (hints, *date.Format, error) {
+	result := hintDateTime
+	layout, zonename := "", ""
+	for k, v := range obj {
+		var ok bool
+		switch k {
+		case "format":
+			layout, ok = v.(string)
+		case "zone":
+			zonename, ok = v.(string)
+		case "type":
+			var err error
+			result, _, err = hintsFromJSON(v)
+			if err != nil {
+				return hintDefault, nil, err
+			}
+			ok = result&hintDateTime != 0
+		default:
+			return hintDefault, nil, fmt.Errorf("unsupported datetime hint field %q", k)
+		}
+		if !ok {
+			return hintDefault, nil, fmt.Errorf("invalid datetime hint field %q", k)
+		}
 	}
-
-	return hintDefault, errors.New("unsupported hint type; expected 'string' or '[]string'")
+	if layout == "" {
+		return hintDefault, nil, errors.New("datetime hint requires a format")
+	}
+	var zone *date.Zone
+	if zonename != "" {
+		var err error
+		zone, err = date.LoadZone(zonename)
+		if err != nil {
+			return hintDefault, nil, err
+		}
+	}
+	f, err := date.CompileFormat(layout, zone)
+	if err != nil {
+		return hintDefault, nil, err
+	}
+	return result, f, nil
 }
 
 func hintFromString(value string) (hints, error) {
@@ -231,10 +293,11 @@ func hintFromString(value string) (hints, error) {
 	return hintDefault, fmt.Errorf("unsupported hint '%s'", value)
 }
 
-func makeHintNode(parent *Hint, hints hints, isRecursiveWildcard bool) *Hint {
+func makeHintNode(parent *Hint, hints hints, format *date.Format, isRecursiveWildcard bool) *Hint {
 	return &Hint{
 		parent:              parent,
 		hints:               hints,
+		format:              format,
 		isRecursiveWildcard: isRecursiveWildcard,
 		fields:              map[string]*Hint{},
 	}
@@ -255,12 +318,12 @@ func (n *Hint) getNext(label []byte) *Hint {
 	return n
 }
 
-func (n *Hint) encodeRuleString(path string, hints hints) error {
+func (n *Hint) encodeRuleString(path string, hints hints, format *date.Format) error {
 	segments := strings.Split(path, ".")
-	return n.encodeRule(segments, hints)
+	return n.encodeRule(segments, hints, format)
 }
 
-func (n *Hint) encodeRule(path []string, hints hints) error {
+func (n *Hint) encodeRule(path []string, hints hints, format *date.Format) error {
 	segment := path[0]
 
 	if segment == "" {
@@ -299,20 +362,22 @@ func (n *Hint) encodeRule(path []string, hints hints) error {
 	}
 
 	nextHints := hintDefault
+	var nextFormat *date.Format
 	if isFinalSegment {
 		nextHints = hints
+		nextFormat = format
 	}
-	next := n.getOrCreate(segment, nextHints, isWildcard, isRecursiveWildcard)
+	next := n.getOrCreate(segment, nextHints, nextFormat, isWildcard, isRecursiveWildcard)
 
 	if isFinalSegment && !isRecursiveWildcard && hints&hintIgnore != 0 {
 		// Implicitly add a recursive wildcard to as well ignore nested elements, if the
 		// explicit field is a struct or an array
-		next.wildcard = next.getOrCreate("*", hintIgnore, true, true)
+		next.wildcard = next.getOrCreate("*", hintIgnore, nil, true, true)
 	}
 
 	if !isFinalSegment {
 		// Recursively encode the next segment
-		err := next.encodeRule(path[1:], hints)
+		err := next.encodeRule(path[1:], hints, format)
 		if err != nil {
 			return err
 		}
@@ -324,7 +389,7 @@ func (n *Hint) encodeRule(path []string, hints hints) error {
 		// We are encoding a wildcard (?) segment which is not the final segment
 		// => all existing nodes on the same level must encode the subsequent segments
 		for _, v := range n.fields {
-			err = v.encodeRule(path[1:], hints)
+			err = v.encodeRule(path[1:], hints, format)
 			if err != nil {
 				return err
 			}
@@ -341,6 +406,7 @@ func (n *Hint) encodeRule(path []string, hints hints) error {
 	// => update the current wildcard node
 	if next.hints == hintDefault {
 		next.hints = hints
+		next.format = format
 	}
 
 	if !isRecursiveWildcard {
@@ -350,13 +416,13 @@ func (n *Hint) encodeRule(path []string, hints hints) error {
 	// We are encoding a recursive wildcard (*) segment
 	// => all existing nodes on the same level must encode the wildcard recursively
 	for _, v := range n.fields {
-		err := v.encodeRule(path, hints)
+		err := v.encodeRule(path, hints, format)
 		if err != nil {
 			return err
 		}
 	}
 	if !n.isRecursiveWildcard {
-		err := n.wildcard.encodeRule(path, hints)
+		err := n.wildcard.encodeRule(path, hints, format)
 		if err != nil {
 			return err
 		}
@@ -365,10 +431,10 @@ func (n *Hint) encodeRule(path []string, hints hints) error {
 	return nil
 }
 
-func (n *Hint) getOrCreate(label string, hints hints, isWildcard bool, isRecursiveWildcard bool) *Hint {
+func (n *Hint) getOrCreate(label string, hints hints, format *date.Format, isWildcard bool, isRecursiveWildcard bool) *Hint {
 	if isWildcard {
 		if n.wildcard == nil {
-			n.wildcard = makeHintNode(n, hints, isRecursiveWildcard)
+			n.wildcard = makeHintNode(n, hints, format, isRecursiveWildcard)
 		}
 		return n.wildcard
 	}
@@ -382,7 +448,7 @@ func (n *Hint) getOrCreate(label string, hints hints, isWildcard bool, isRecursi
 		return n.wildcard
 	}
 
-	next = makeHintNode(n, hints, false)
+	next = makeHintNode(n, hints, format, false)
 	n.fields[label] = next
 
 	return next
@@ -391,6 +457,7 @@ func (n *Hint) getOrCreate(label string, hints hints, isWildcard bool, isRecursi
 type hintState struct {
 	root    *Hint
 	hints   hints
+	format  *date.Format
 	current *Hint
 	next    *Hint
 	level   int
@@ -452,8 +519,10 @@ func (s *hintState) field(label []byte) {
 	next := s.current.getNext(label)
 	if next == s.current && !s.current.isRecursiveWildcard {
 		s.hints = hintDefault
+		s.format = nil
 	} else {
 		s.hints = next.hints
+		s.format = next.format
 	}
 
 	s.next = next
@@ -534,6 +603,15 @@ func (s *state) coerceDateTime() bool {
 	return s.hints.hints&hintDateTime != 0
 }
 
+// parseDateTime parses a string hinted as
+// a datetime using the format of the hint (if any)
+func (s *state) parseDateTime(seg []byte) (date.Time, bool) {
+	if s.hints.format != nil {
+		return s.hints.format.Parse(seg)
+	}
+	return date.Parse(seg)
+}
+
 func (s *state) coerceUnixSeconds() bool {
 	return s.hints.hints&hintUnixSeconds != 0
 }
@@ -916,7 +994,7 @@ func (s *state) parseString(seg []byte, esc bool) {
 			s.out.WriteInt(int64(i))
 		}
 	} else if s.coerceDateTime() {
-		if t, ok := date.Parse(seg); ok {
+		if t, ok := s.parseDateTime(seg); ok {
 			emitDefault = false
 			s.addTimeRange(t)
 			s.out.WriteTime(t)
@@ -0,0 +1,174 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package loglines implements converting text log files
+// (logfmt, RFC 5424 syslog, and lines matching grok-style
+// patterns) to binary ION format.
+package loglines
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/SnellerInc/sneller/date"
+	"github.com/SnellerInc/sneller/ion"
+)
+
+var (
+	ErrNoHints  = errors.New("loglines: hints are mandatory")
+	ErrTooLarge = errors.New("loglines: line too large")
+)
+
+// MaxLineSize is the maximum size of a line
+const MaxLineSize = 1024 * 1024
+
+// rawField is the field that holds
+// the text of lines that cannot be parsed
+const rawField = "_raw"
+
+type valueKind uint8
+
+const (
+	kindString valueKind = iota
+	kindInt
+	kindFloat
+	kindBool
+	kindTime
+	kindStruct
+)
+
+// field is a parsed field of a line
+type field struct {
+	sym  ion.Symbol
+	kind valueKind
+	str  []byte
+	i    int64
+	f    float64
+	b    bool
+	t    date.Time
+	sub  []field
+}
+
+// set adds f to lst, replacing an
+// existing field with the same symbol
+func set(lst []field, f field) []field {
+	for i := range lst {
+		if lst[i].sym == f.sym {
+			lst[i] = f
+			return lst
+		}
+	}
+	return append(lst, f)
+}
+
+// parser parses the text of a line
+// (without the line terminator) into
+// a list of fields
+//
+// Implementations must be safe to use
+// from multiple goroutines.
+type parser interface {
+	parse(line []byte, st *ion.Symtab, dst []field) ([]field, bool)
+}
+
+// Convert reads lines from r, parses them
+// according to hint and writes each line into
+// dst as a structure, along with the provided
+// constants. Empty lines are skipped, and lines
+// that cannot be parsed are written with a single
+// _raw field. Top-level timestamp fields are
+// added to the sparse index.
+func Convert(r io.Reader, dst *ion.Chunker, hint *Hint, cons []ion.Field) error {
+	if hint == nil || hint.parser == nil {
+		return ErrNoHints
+	}
+
+	// make sure constant field IDs are interned
+	prev := ion.Symbol(0)
+	for i := range cons {
+		cons[i].Sym = dst.Symbols.Intern(cons[i].Label)
+		if cons[i].Sym < prev {
+			return fmt.Errorf("loglines: internal error: constant interned symbols out-of-order")
+		}
+		prev = cons[i].Sym
+	}
+	raw := dst.Symbols.Intern(rawField)
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), MaxLineSize)
+	var fields []field
+	var symbuf ion.Symbuf
+	for s.Scan() {
+		line := s.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		dst.BeginStruct(-1)
+		for i := range cons {
+			dst.BeginField(cons[i].Sym)
+			cons[i].Value.Encode(&dst.Buffer, &dst.Symbols)
+		}
+		var ok bool
+		fields, ok = hint.parser.parse(line, &dst.Symbols, fields[:0])
+		if ok {
+			for i := range fields {
+				write(dst, &fields[i])
+				if fields[i].kind == kindTime {
+					symbuf.Prepare(1)
+					symbuf.Push(fields[i].sym)
+					dst.Ranges.AddTime(symbuf, fields[i].t)
+				}
+			}
+		} else {
+			dst.BeginField(raw)
+			dst.WriteStringBytes(line)
+		}
+		dst.EndStruct()
+		if err := dst.Commit(); err != nil {
+			return err
+		}
+	}
+	if err := s.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return fmt.Errorf("%w (limit %d bytes)", ErrTooLarge, MaxLineSize)
+		}
+		return err
+	}
+	return nil
+}
+
+func write(dst *ion.Chunker, f *field) {
+	dst.BeginField(f.sym)
+	switch f.kind {
+	case kindString:
+		dst.WriteStringBytes(f.str)
+	case kindInt:
+		dst.WriteInt(f.i)
+	case kindFloat:
+		dst.WriteFloat64(f.f)
+	case kindBool:
+		dst.WriteBool(f.b)
+	case kindTime:
+		dst.WriteTime(f.t)
+	case kindStruct:
+		dst.BeginStruct(-1)
+		for i := range f.sub {
+			write(dst, &f.sub[i])
+		}
+		dst.EndStruct()
+	}
+}
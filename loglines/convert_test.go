@@ -0,0 +1,142 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package loglines
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/SnellerInc/sneller/ion"
+)
+
+func convert(t *testing.T, hint, text string) string {
+	t.Helper()
+	h, err := ParseHint([]byte(hint))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	dst := ion.Chunker{
+		Align: 1024 * 1024,
+		W:     ion.NewJSONWriter(&out, '\n'),
+	}
+	err = Convert(strings.NewReader(text), &dst, h, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestConvert(t *testing.T) {
+	runs := []struct {
+		name, hint, input, want string
+	}{
+		{
+			name: "logfmt",
+			hint: `{"format": "logfmt"}`,
+			input: `ts=2022-10-01T12:00:00Z level=info msg="hello \"world\"" n=42 dur=1.5 ok=true cached path=/x` + "\n" +
+				"\n" +
+				`time="2022-10-01T12:00:01Z" n=-1 n=2 x= big=99999999999999999999 id=0x10` + "\r\n" +
+				"plain text without pairs\n" +
+				`broken="unterminated` + "\n",
+			want: `{"ts": "2022-10-01T12:00:00Z", "level": "info", "msg": "hello \"world\"", "n": 42, "dur": 1.5, "ok": true, "cached": true, "path": "/x"}
+{"n": 2, "time": "2022-10-01T12:00:01Z", "x": "", "big": 1e+20, "id": "0x10"}
+{"_raw": "plain text without pairs"}
+{"_raw": "broken=\"unterminated"}
+`,
+		},
+		{
+			name: "syslog",
+			hint: `{"format": "syslog"}`,
+			input: `<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - ` + "\xef\xbb\xbf'su root' failed\n" +
+				`<165>1 2003-08-24T05:14:15.000003-07:00 192.0.2.1 myproc 8710 - [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"][examplePriority@32473 class="high\]\"x\""]` + "\n" +
+				`<13>1 - - - - - -` + "\n" +
+				`Oct 11 22:14:15 mymachine su: 'su root' failed` + "\n",
+			want: `{"facility": 4, "severity": 2, "timestamp": "2003-10-11T22:14:15.003Z", "hostname": "mymachine.example.com", "appname": "su", "msgid": "ID47", "message": "'su root' failed"}
+{"facility": 20, "severity": 5, "timestamp": "2003-08-24T12:14:15.000003Z", "hostname": "192.0.2.1", "appname": "myproc", "procid": "8710", "structured_data": {"exampleSDID@32473": {"iut": "3", "eventSource": "Application", "eventID": "1011"}, "examplePriority@32473": {"class": "high]\"x\""}}}
+{"facility": 1, "severity": 5}
+{"_raw": "Oct 11 22:14:15 mymachine su: 'su root' failed"}
+`,
+		},
+		{
+			name: "grok",
+			hint: `{"pattern": "%{IP:client} - - \\[%{HTTPDATE:ts}\\] \"%{METHOD:method} %{URIPATHPARAM:path} HTTP/%{NUMBER:version:string}\" %{INT:status} (?:%{INT:bytes}|-) %{NUMBER:took:float}s",
+			        "patterns": {"METHOD": "GET|POST"}}`,
+			input: `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /a.gif?x=1 HTTP/1.0" 200 2326 0.5s` + "\n" +
+				`::1 - - [10/Oct/2000:13:55:37 +0000] "POST / HTTP/1.1" 404 - 1s` + "\n" +
+				`127.0.0.1 - - [99/Oct/2000:13:55:36 -0700] "GET / HTTP/1.0" 200 1 1s` + "\n",
+			want: `{"version": "1.0", "client": "127.0.0.1", "ts": "2000-10-10T20:55:36Z", "method": "GET", "path": "/a.gif?x=1", "status": 200, "bytes": 2326, "took": 0.5}
+{"version": "1.1", "client": "::1", "ts": "2000-10-10T13:55:37Z", "method": "POST", "path": "/", "status": 404, "took": 1}
+{"_raw": "127.0.0.1 - - [99/Oct/2000:13:55:36 -0700] \"GET / HTTP/1.0\" 200 1 1s"}
+`,
+		},
+		{
+			name:  "combined",
+			hint:  `{"pattern": "%{COMBINEDAPACHELOG}"}`,
+			input: `example.com - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://example.com/start.html" "Mozilla/4.08"` + "\n",
+			want:  `{"clientip": "example.com", "ident": "-", "auth": "frank", "timestamp": "2000-10-10T20:55:36Z", "verb": "GET", "request": "/apache_pb.gif", "httpversion": "1.0", "response": 200, "bytes": 2326, "referrer": "\"http://example.com/start.html\"", "agent": "\"Mozilla/4.08\""}` + "\n",
+		},
+	}
+	for i := range runs {
+		t.Run(runs[i].name, func(t *testing.T) {
+			got := convert(t, runs[i].hint, runs[i].input)
+			if got != runs[i].want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, runs[i].want)
+			}
+		})
+	}
+}
+
+func TestParseHintErrors(t *testing.T) {
+	runs := []struct {
+		hint, err string
+	}{
+		{`{}`, "missing format"},
+		{`{"format": "xml"}`, "unknown format"},
+		{`{"format": "logfmt", "pattern": "%{INT}"}`, "only valid"},
+		{`{"format": "grok"}`, "requires a pattern"},
+		{`{"pattern": "%{NOPE:x}"}`, "unknown pattern"},
+		{`{"pattern": "%{INT:x:blob}"}`, "unknown type"},
+		{`{"pattern": "%{A}", "patterns": {"A": "x%{B}", "B": "%{A}"}}`, "refers to itself"},
+		{`{"pattern": "(%{INT}"}`, "invalid pattern"},
+	}
+	for i := range runs {
+		_, err := ParseHint([]byte(runs[i].hint))
+		if err == nil || !strings.Contains(err.Error(), runs[i].err) {
+			t.Errorf("%s: got error %v, want %q", runs[i].hint, err, runs[i].err)
+		}
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	var dst ion.Chunker
+	if err := Convert(strings.NewReader("x=1"), &dst, nil, nil); !errors.Is(err, ErrNoHints) {
+		t.Errorf("got %v, want ErrNoHints", err)
+	}
+	h, err := ParseHint([]byte(`{"format": "logfmt"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst = ion.Chunker{Align: 1024 * 1024, W: &bytes.Buffer{}}
+	long := "x=" + strings.Repeat("a", MaxLineSize) + "\n"
+	if err := Convert(strings.NewReader(long), &dst, h, nil); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("got %v, want ErrTooLarge", err)
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package loglines
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/SnellerInc/sneller/date"
+	"github.com/SnellerInc/sneller/ion"
+)
+
+const (
+	TypeString   = "string"
+	TypeInt      = "int"
+	TypeFloat    = "float"
+	TypeNumber   = "number" // int or float
+	TypeBool     = "bool"
+	TypeDateTime = "datetime"
+)
+
+// builtins are the built-in grok patterns
+var builtins = map[string]string{
+	"USERNAME":   `[a-zA-Z0-9._-]+`,
+	"USER":       `%{USERNAME}`,
+	"INT":        `[+-]?[0-9]+`,
+	"POSINT":     `[1-9][0-9]*`,
+	"NONNEGINT":  `[0-9]+`,
+	"NUMBER":     `[+-]?(?:[0-9]+(?:\.[0-9]*)?|\.[0-9]+)(?:[eE][+-]?[0-9]+)?`,
+	"WORD":       `\b\w+\b`,
+	"NOTSPACE":   `\S+`,
+	"SPACE":      `\s*`,
+	"DATA":       `.*?`,
+	"GREEDYDATA": `.*`,
+
+	"QUOTEDSTRING": `"(?:[^"\\]|\\.)*"`,
+	"QS":           `%{QUOTEDSTRING}`,
+	"UUID":         `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+
+	"IPV4":     `(?:(?:25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)\.){3}(?:25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)`,
+	"IPV6":     `(?:[0-9A-Fa-f]{0,4}:){2,7}(?:%{IPV4}|[0-9A-Fa-f]{0,4})`,
+	"IP":       `(?:%{IPV6}|%{IPV4})`,
+	"HOSTNAME": `\b[0-9A-Za-z][0-9A-Za-z-]{0,62}(?:\.[0-9A-Za-z][0-9A-Za-z-]{0,62})*\.?\b`,
+	"IPORHOST": `(?:%{IP}|%{HOSTNAME})`,
+	"HOSTPORT": `%{IPORHOST}:%{POSINT}`,
+
+	"URIPATH":      `(?:/[A-Za-z0-9$.+!*'(){},~:;=@#%&_\-]*)+`,
+	"URIPARAM":     `\?[A-Za-z0-9$.+!*'|(){},~@#%&/=:;_?\-\[\]<>]*`,
+	"URIPATHPARAM": `%{URIPATH}(?:%{URIPARAM})?`,
+
+	"MONTH":            `\b(?:Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec)[a-z]*\b`,
+	"MONTHNUM":         `(?:0?[1-9]|1[0-2])`,
+	"MONTHDAY":         `(?:0[1-9]|[12][0-9]|3[01]|[1-9])`,
+	"YEAR":             `[0-9]{4}`,
+	"HOUR":             `(?:2[0123]|[01]?[0-9])`,
+	"MINUTE":           `[0-5][0-9]`,
+	"SECOND":           `(?:[0-5]?[0-9]|60)(?:[.,][0-9]+)?`,
+	"TIME":             `%{HOUR}:%{MINUTE}(?::%{SECOND})?`,
+	"ISO8601_TIMEZONE": `(?:Z|[+-]%{HOUR}(?::?%{MINUTE}))`,
+	"TIMESTAMP_ISO8601": `%{YEAR}-%{MONTHNUM}-%{MONTHDAY}[T ]%{HOUR}:?%{MINUTE}(?::?%{SECOND})?` +
+		`%{ISO8601_TIMEZONE}?`,
+	"HTTPDATE": `%{MONTHDAY}/%{MONTH}/%{YEAR}:%{TIME} [+-][0-9]{4}`,
+	"LOGLEVEL": `\b(?i:trace|debug|info|notice|warn(?:ing)?|err(?:or)?|crit(?:ical)?|fatal|severe|emerg(?:ency)?|alert)\b`,
+
+	"COMMONAPACHELOG": `%{IPORHOST:clientip} %{USER:ident} %{USER:auth} \[%{HTTPDATE:timestamp}\] ` +
+		`"(?:%{WORD:verb} %{NOTSPACE:request}(?: HTTP/%{NUMBER:httpversion:string})?|%{DATA:rawrequest})" ` +
+		`%{INT:response} (?:%{INT:bytes}|-)`,
+	"COMBINEDAPACHELOG": `%{COMMONAPACHELOG} %{QS:referrer} %{QS:agent}`,
+}
+
+// defaultTypes are the types of captures
+// of built-in patterns that aren't strings
+var defaultTypes = map[string]string{
+	"INT":               TypeInt,
+	"POSINT":            TypeInt,
+	"NONNEGINT":         TypeInt,
+	"NUMBER":            TypeNumber,
+	"HTTPDATE":          TypeDateTime,
+	"TIMESTAMP_ISO8601": TypeDateTime,
+}
+
+var httpdate *date.Format
+
+func init() {
+	var err error
+	httpdate, err = date.CompileFormat("%d/%b/%Y:%H:%M:%S %z", nil)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// reference matches %{NAME}, %{NAME:field} and %{NAME:field:type}
+var reference = regexp.MustCompile(`%\{(\w+)(?::([^:}]+)(?::(\w+))?)?\}`)
+
+// maxExpansions limits the number of pattern
+// references that are expanded, which bounds
+// the size of the expanded regular expression
+const maxExpansions = 10000
+
+// grok matches lines against a regular expression
+// expanded from a grok-style pattern
+type grok struct {
+	re       *regexp.Regexp
+	captures []capture
+}
+
+// capture is a named field captured by a grok pattern
+type capture struct {
+	name  string
+	group int
+	conv  func(f *field, text []byte) bool
+}
+
+type grokCompiler struct {
+	patterns map[string]string
+	captures []capture
+	active   map[string]bool
+	expanded int
+}
+
+func compileGrok(pattern string, patterns map[string]string) (*grok, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("loglines: grok format requires a pattern")
+	}
+	c := &grokCompiler{patterns: patterns, active: make(map[string]bool)}
+	expr, err := c.expand(pattern)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("loglines: invalid pattern: %w", err)
+	}
+	g := &grok{re: re, captures: c.captures}
+	for i := range g.captures {
+		g.captures[i].group = re.SubexpIndex(fmt.Sprintf("f%d", i))
+	}
+	return g, nil
+}
+
+func (c *grokCompiler) lookup(name string) (string, bool) {
+	if p, ok := c.patterns[name]; ok {
+		return p, true
+	}
+	p, ok := builtins[name]
+	return p, ok
+}
+
+// expand replaces the pattern references in
+// pattern with the corresponding regular expressions
+func (c *grokCompiler) expand(pattern string) (string, error) {
+	var out strings.Builder
+	for {
+		loc := reference.FindStringSubmatchIndex(pattern)
+		if loc == nil {
+			out.WriteString(pattern)
+			return out.String(), nil
+		}
+		out.WriteString(pattern[:loc[0]])
+		name := pattern[loc[2]:loc[3]]
+		c.expanded++
+		if c.expanded > maxExpansions {
+			return "", fmt.Errorf("loglines: pattern expands to too many references")
+		}
+		sub, ok := c.lookup(name)
+		if !ok {
+			return "", fmt.Errorf("loglines: unknown pattern %q", name)
+		}
+		if c.active[name] {
+			return "", fmt.Errorf("loglines: pattern %q refers to itself", name)
+		}
+		c.active[name] = true
+		inner, err := c.expand(sub)
+		delete(c.active, name)
+		if err != nil {
+			return "", err
+		}
+		if loc[4] < 0 {
+			out.WriteString("(?:")
+		} else {
+			typ := defaultTypes[name]
+			if _, custom := c.patterns[name]; custom || typ == "" {
+				typ = TypeString
+			}
+			if loc[6] >= 0 {
+				typ = pattern[loc[6]:loc[7]]
+			}
+			conv, err := converter(name, typ)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&out, "(?P<f%d>", len(c.captures))
+			c.captures = append(c.captures, capture{name: pattern[loc[4]:loc[5]], conv: conv})
+		}
+		out.WriteString(inner)
+		out.WriteString(")")
+		pattern = pattern[loc[1]:]
+	}
+}
+
+func converter(pattern, typ string) (func(f *field, text []byte) bool, error) {
+	switch typ {
+	case TypeString:
+		return convString, nil
+	case TypeInt:
+		return convInt, nil
+	case TypeFloat:
+		return convFloat, nil
+	case TypeNumber:
+		return convNumber, nil
+	case TypeBool:
+		return convBool, nil
+	case TypeDateTime:
+		if pattern == "HTTPDATE" {
+			return convHTTPDate, nil
+		}
+		return convDateTime, nil
+	default:
+		return nil, fmt.Errorf("loglines: unknown type %q", typ)
+	}
+}
+
+func convString(f *field, text []byte) bool {
+	f.kind = kindString
+	f.str = text
+	return true
+}
+
+func convInt(f *field, text []byte) bool {
+	i, err := strconv.ParseInt(string(text), 10, 64)
+	f.kind = kindInt
+	f.i = i
+	return err == nil
+}
+
+func convFloat(f *field, text []byte) bool {
+	x, err := strconv.ParseFloat(string(text), 64)
+	f.kind = kindFloat
+	f.f = x
+	return err == nil && numeric(text)
+}
+
+func convNumber(f *field, text []byte) bool {
+	return convInt(f, text) || convFloat(f, text)
+}
+
+func convBool(f *field, text []byte) bool {
+	b, err := strconv.ParseBool(string(text))
+	f.kind = kindBool
+	f.b = b
+	return err == nil
+}
+
+func convDateTime(f *field, text []byte) bool {
+	t, ok := date.Parse(text)
+	f.kind = kindTime
+	f.t = t
+	return ok
+}
+
+func convHTTPDate(f *field, text []byte) bool {
+	t, ok := httpdate.Parse(text)
+	f.kind = kindTime
+	f.t = t
+	return ok
+}
+
+// parse implements parser.parse; lines that
+// don't match the pattern or in which a capture
+// cannot be converted to its type are rejected
+func (g *grok) parse(line []byte, st *ion.Symtab, dst []field) ([]field, bool) {
+	loc := g.re.FindSubmatchIndex(line)
+	if loc == nil {
+		return dst, false
+	}
+	for i := range g.captures {
+		c := &g.captures[i]
+		start, end := loc[2*c.group], loc[2*c.group+1]
+		if start < 0 {
+			// not part of the match
+			continue
+		}
+		f := field{sym: st.Intern(c.name)}
+		if !c.conv(&f, line[start:end]) {
+			return dst, false
+		}
+		dst = set(dst, f)
+	}
+	return dst, true
+}
@@ -0,0 +1,113 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package loglines
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	FormatLogfmt = "logfmt"
+	FormatSyslog = "syslog" // RFC 5424
+	FormatGrok   = "grok"
+)
+
+// Hint specifies how the lines
+// of a log file are parsed.
+type Hint struct {
+	// Format is one of "logfmt", "syslog" or "grok".
+	// It defaults to "grok" when Pattern is set.
+	Format string `json:"format,omitempty"`
+	// Pattern is the grok-style pattern
+	// used to parse each line (only
+	// applicable to the "grok" format)
+	Pattern string `json:"pattern,omitempty"`
+	// Patterns defines additional named
+	// patterns that may be referenced from
+	// Pattern (or from each other); they
+	// take precedence over the built-in patterns
+	Patterns map[string]string `json:"patterns,omitempty"`
+
+	// internals
+	parser parser
+}
+
+// ParseHint parses a json byte array into a Hint structure
+// that can be passed to Convert.
+//
+// The input must contain a valid JSON object, like:
+//
+//	{"format": "logfmt"}
+//	{"format": "syslog"}
+//	{
+//	  "pattern": "%{IPORHOST:client} %{USER} %{USER:user} \\[%{HTTPDATE:ts}\\] \"%{WORD:method} %{NOTSPACE:path} HTTP/%{NUMBER:version:string}\" %{INT:status} %{ID:request}",
+//	  "patterns": {"ID": "[0-9a-f]{16}"}
+//	}
+//
+// The logfmt format produces one field per key. Unquoted
+// values are converted to integers, floating-point numbers,
+// booleans or timestamps when possible, and keys without
+// a value are converted to true. Quoted values are strings
+// unless they contain a timestamp.
+//
+// The syslog format parses RFC 5424 messages into the fields
+// facility, severity, timestamp, hostname, appname, procid,
+// msgid, structured_data and message; fields with the
+// nil value ("-") are omitted.
+//
+// The grok format matches each line against a regular
+// expression in which %{NAME} refers to a named pattern,
+// %{NAME:field} captures the match as a field, and
+// %{NAME:field:type} additionally sets the type of the
+// field to one of string, int, float, number (int or float),
+// bool, or datetime. Captures of INT, POSINT and NONNEGINT
+// default to int, NUMBER to number, and HTTPDATE and
+// TIMESTAMP_ISO8601 to datetime; all other captures
+// default to string.
+//
+// Lines that cannot be parsed are ingested as
+// a structure with a single _raw field containing
+// the text of the line.
+func ParseHint(hint []byte) (*Hint, error) {
+	var h Hint
+	err := json.Unmarshal(hint, &h)
+	if err != nil {
+		return nil, err
+	}
+	if h.Format == "" && h.Pattern != "" {
+		h.Format = FormatGrok
+	}
+	if h.Format != FormatGrok && (h.Pattern != "" || h.Patterns != nil) {
+		return nil, fmt.Errorf("loglines: patterns are only valid for the %q format", FormatGrok)
+	}
+	switch h.Format {
+	case FormatLogfmt:
+		h.parser = logfmtParser{}
+	case FormatSyslog:
+		h.parser = syslogParser{}
+	case FormatGrok:
+		g, err := compileGrok(h.Pattern, h.Patterns)
+		if err != nil {
+			return nil, err
+		}
+		h.parser = g
+	case "":
+		return nil, fmt.Errorf("loglines: missing format")
+	default:
+		return nil, fmt.Errorf("loglines: unknown format %q", h.Format)
+	}
+	return &h, nil
+}
@@ -0,0 +1,154 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package loglines
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/SnellerInc/sneller/date"
+	"github.com/SnellerInc/sneller/ion"
+)
+
+// logfmtParser parses lines of key=value pairs;
+// lines without any key=value pair (i.e. plain
+// text) are not considered to be logfmt
+type logfmtParser struct{}
+
+func (logfmtParser) parse(line []byte, st *ion.Symtab, dst []field) ([]field, bool) {
+	pairs := 0
+	for {
+		line = bytes.TrimLeft(line, " \t")
+		if len(line) == 0 {
+			break
+		}
+		n := 0
+		for n < len(line) && line[n] > ' ' && line[n] != '=' && line[n] != '"' {
+			n++
+		}
+		if n == 0 {
+			return dst, false
+		}
+		f := field{sym: st.Intern(string(line[:n]))}
+		line = line[n:]
+		if len(line) == 0 || line[0] != '=' {
+			if len(line) > 0 && line[0] == '"' {
+				return dst, false
+			}
+			// a key without a value is a flag
+			f.kind = kindBool
+			f.b = true
+			dst = set(dst, f)
+			continue
+		}
+		line = line[1:]
+		pairs++
+		if len(line) > 0 && line[0] == '"' {
+			str, rest, ok := unquote(line)
+			if !ok || (len(rest) > 0 && rest[0] != ' ' && rest[0] != '\t') {
+				return dst, false
+			}
+			line = rest
+			if t, ok := date.Parse(str); ok {
+				f.kind = kindTime
+				f.t = t
+			} else {
+				f.kind = kindString
+				f.str = str
+			}
+		} else {
+			n = 0
+			for n < len(line) && line[n] > ' ' {
+				n++
+			}
+			f.infer(line[:n])
+			line = line[n:]
+		}
+		dst = set(dst, f)
+	}
+	return dst, pairs > 0
+}
+
+// unquote returns the unescaped contents of the
+// quoted string at the start of text and the
+// remaining text after the closing quote
+func unquote(text []byte) ([]byte, []byte, bool) {
+	escaped := false
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			escaped = true
+			i++
+		case '"':
+			if !escaped {
+				return text[1:i], text[i+1:], true
+			}
+			s, err := strconv.Unquote(string(text[:i+1]))
+			if err != nil {
+				return nil, nil, false
+			}
+			return []byte(s), text[i+1:], true
+		}
+	}
+	return nil, nil, false
+}
+
+// infer sets the value of f to text converted
+// to an integer, a floating-point number, a boolean
+// or a timestamp if possible, or a string otherwise
+func (f *field) infer(text []byte) {
+	if numeric(text) {
+		if i, err := strconv.ParseInt(string(text), 10, 64); err == nil {
+			f.kind = kindInt
+			f.i = i
+			return
+		}
+		if x, err := strconv.ParseFloat(string(text), 64); err == nil {
+			f.kind = kindFloat
+			f.f = x
+			return
+		}
+		if t, ok := date.Parse(text); ok {
+			f.kind = kindTime
+			f.t = t
+			return
+		}
+	}
+	switch string(text) {
+	case "true", "false":
+		f.kind = kindBool
+		f.b = text[0] == 't'
+		return
+	}
+	f.kind = kindString
+	f.str = text
+}
+
+// numeric returns whether text only consists of
+// characters that may be part of a decimal number
+// (or a timestamp); this excludes special values
+// like "inf" and hexadecimal numbers
+func numeric(text []byte) bool {
+	if len(text) == 0 {
+		return false
+	}
+	for _, c := range text {
+		if !(c >= '0' && c <= '9') && c != '.' && c != '-' && c != '+' &&
+			c != 'e' && c != 'E' && c != ':' && c != 'T' && c != 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,211 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package loglines
+
+import (
+	"bytes"
+
+	"github.com/SnellerInc/sneller/date"
+	"github.com/SnellerInc/sneller/ion"
+)
+
+// syslogParser parses RFC 5424 syslog messages:
+//
+//	<PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+type syslogParser struct{}
+
+var syslogHeader = []string{"hostname", "appname", "procid", "msgid"}
+
+var bom = []byte{0xef, 0xbb, 0xbf}
+
+func (syslogParser) parse(line []byte, st *ion.Symtab, dst []field) ([]field, bool) {
+	// <PRI>
+	if len(line) < 3 || line[0] != '<' {
+		return dst, false
+	}
+	pri, n := digits(line[1:], 3)
+	if n == 0 || pri > 191 || len(line) <= n+1 || line[n+1] != '>' {
+		return dst, false
+	}
+	line = line[n+2:]
+	dst = append(dst,
+		field{sym: st.Intern("facility"), kind: kindInt, i: int64(pri / 8)},
+		field{sym: st.Intern("severity"), kind: kindInt, i: int64(pri % 8)})
+
+	// VERSION
+	version, n := digits(line, 2)
+	if n == 0 || version == 0 {
+		return dst, false
+	}
+	line = line[n:]
+
+	// TIMESTAMP
+	tok, line, ok := token(line)
+	if !ok {
+		return dst, false
+	}
+	if !nilvalue(tok) {
+		t, ok := date.Parse(tok)
+		if !ok {
+			return dst, false
+		}
+		dst = append(dst, field{sym: st.Intern("timestamp"), kind: kindTime, t: t})
+	}
+
+	// HOSTNAME, APP-NAME, PROCID, MSGID
+	for _, name := range syslogHeader {
+		tok, line, ok = token(line)
+		if !ok {
+			return dst, false
+		}
+		if !nilvalue(tok) {
+			dst = append(dst, field{sym: st.Intern(name), kind: kindString, str: tok})
+		}
+	}
+
+	// STRUCTURED-DATA
+	if len(line) < 2 || line[0] != ' ' {
+		return dst, false
+	}
+	line = line[1:]
+	if line[0] == '-' {
+		line = line[1:]
+	} else {
+		sd := field{sym: st.Intern("structured_data"), kind: kindStruct}
+		for len(line) > 0 && line[0] == '[' {
+			var elem field
+			elem, line, ok = sdElement(line, st)
+			if !ok {
+				return dst, false
+			}
+			sd.sub = set(sd.sub, elem)
+		}
+		if sd.sub == nil {
+			return dst, false
+		}
+		dst = append(dst, sd)
+	}
+
+	// MSG
+	if len(line) > 0 {
+		if line[0] != ' ' {
+			return dst, false
+		}
+		msg := bytes.TrimPrefix(line[1:], bom)
+		dst = append(dst, field{sym: st.Intern("message"), kind: kindString, str: msg})
+	}
+	return dst, true
+}
+
+// digits parses up to max decimal digits
+// from the start of text and returns the value
+// and the number of digits
+func digits(text []byte, max int) (int, int) {
+	v, n := 0, 0
+	for n < len(text) && n < max && text[n] >= '0' && text[n] <= '9' {
+		v = v*10 + int(text[n]-'0')
+		n++
+	}
+	return v, n
+}
+
+// token parses a space followed by a
+// header field that cannot contain spaces
+func token(text []byte) ([]byte, []byte, bool) {
+	if len(text) < 2 || text[0] != ' ' {
+		return nil, nil, false
+	}
+	text = text[1:]
+	n := 0
+	for n < len(text) && text[n] > ' ' {
+		n++
+	}
+	if n == 0 {
+		return nil, nil, false
+	}
+	return text[:n], text[n:], true
+}
+
+func nilvalue(tok []byte) bool {
+	return len(tok) == 1 && tok[0] == '-'
+}
+
+// sdName returns the length of the SD-NAME at the start of text
+func sdName(text []byte) int {
+	n := 0
+	for n < len(text) && text[n] > ' ' && text[n] < 127 &&
+		text[n] != '=' && text[n] != ']' && text[n] != '"' {
+		n++
+	}
+	return n
+}
+
+// sdElement parses [SD-ID *(SP PARAM-NAME="PARAM-VALUE")]
+// into a structure named after the SD-ID
+func sdElement(text []byte, st *ion.Symtab) (field, []byte, bool) {
+	text = text[1:]
+	n := sdName(text)
+	if n == 0 {
+		return field{}, nil, false
+	}
+	elem := field{sym: st.Intern(string(text[:n])), kind: kindStruct, sub: []field{}}
+	text = text[n:]
+	for {
+		if len(text) == 0 {
+			return field{}, nil, false
+		}
+		if text[0] == ']' {
+			return elem, text[1:], true
+		}
+		if text[0] != ' ' {
+			return field{}, nil, false
+		}
+		text = text[1:]
+		n = sdName(text)
+		if n == 0 || len(text) < n+2 || text[n] != '=' || text[n+1] != '"' {
+			return field{}, nil, false
+		}
+		param := field{sym: st.Intern(string(text[:n])), kind: kindString}
+		text = text[n+2:]
+		// PARAM-VALUE escapes '"', '\' and ']'
+		// with a backslash; other backslashes
+		// are kept as they are
+		var val []byte
+		escaped := false
+		i := 0
+		for ; i < len(text) && text[i] != '"'; i++ {
+			if text[i] == '\\' && i+1 < len(text) &&
+				(text[i+1] == '"' || text[i+1] == '\\' || text[i+1] == ']') {
+				if !escaped {
+					val = append(val, text[:i]...)
+					escaped = true
+				}
+				i++
+			}
+			if escaped {
+				val = append(val, text[i])
+			}
+		}
+		if i == len(text) {
+			return field{}, nil, false
+		}
+		if !escaped {
+			val = text[:i]
+		}
+		param.str = val
+		elem.sub = set(elem.sub, param)
+		text = text[i+1:]
+	}
+}
@@ -0,0 +1,406 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sneller
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/SnellerInc/sneller/db"
+	"github.com/SnellerInc/sneller/expr"
+	"github.com/SnellerInc/sneller/ion"
+	"github.com/SnellerInc/sneller/plan"
+	"github.com/SnellerInc/sneller/vm"
+)
+
+// encode masks as [{path: ..., action: ...}, ...]
+func encodeMasks(dst *ion.Buffer, st *ion.Symtab, masks []db.Mask) {
+	dst.BeginList(-1)
+	for i := range masks {
+		dst.BeginStruct(-1)
+		dst.BeginField(st.Intern("path"))
+		dst.WriteString(masks[i].Path)
+		dst.BeginField(st.Intern("action"))
+		dst.WriteString(string(masks[i].Action))
+		dst.EndStruct()
+	}
+	dst.EndList()
+}
+
+func decodeMasks(st *ion.Symtab, body []byte) ([]db.Mask, []byte, error) {
+	var out []db.Mask
+	rest, err := ion.UnpackList(body, func(item []byte) error {
+		var m db.Mask
+		_, err := ion.UnpackStruct(st, item, func(name string, field []byte) error {
+			str, _, err := ion.ReadString(field)
+			if err != nil {
+				return err
+			}
+			switch name {
+			case "path":
+				m.Path = str
+			case "action":
+				m.Action = db.MaskAction(str)
+			default:
+				return fmt.Errorf("unrecognized mask field %q", name)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if !m.Valid() {
+			return fmt.Errorf("invalid mask (path %q, action %q)", m.Path, m.Action)
+		}
+		out = append(out, m)
+		return nil
+	})
+	return out, rest, err
+}
+
+// maskTree is a tree of db.Masks indexed
+// by path component
+type maskTree struct {
+	action db.MaskAction // set for leaves
+	sub    map[string]*maskTree
+}
+
+func newMaskTree(masks []db.Mask) *maskTree {
+	root := &maskTree{}
+	for i := range masks {
+		t := root
+		for _, name := range strings.Split(masks[i].Path, ".") {
+			if t.action != "" {
+				// a parent of this path is
+				// already masked in its entirety
+				break
+			}
+			next := t.sub[name]
+			if next == nil {
+				if t.sub == nil {
+					t.sub = make(map[string]*maskTree)
+				}
+				next = &maskTree{}
+				t.sub[name] = next
+			}
+			t = next
+		}
+		if t.action == "" {
+			t.action = masks[i].Action
+			t.sub = nil
+		}
+	}
+	return root
+}
+
+// mask returns the expression that replaces
+// the path p in a query (see plan.Masker.Mask),
+// or nil if no part of p is masked
+func (t *maskTree) mask(p *expr.Path) expr.Node {
+	t = t.sub[p.First]
+	rest := p.Rest
+	for t != nil && t.action == "" {
+		d, ok := rest.(*expr.Dot)
+		if !ok {
+			// p refers to a value
+			// with masked fields
+			return p
+		}
+		t = t.sub[d.Field]
+		rest = d.Rest
+	}
+	if t == nil {
+		return nil
+	}
+	if t.action == db.MaskHide {
+		return expr.Missing{}
+	}
+	return p
+}
+
+// unmasked returns the conjunctions in e
+// that do not reference masked fields, since
+// the sparse index of a table describes
+// the values of the fields before they are
+// masked and so can't be used to evaluate
+// anything about a masked field
+func unmasked(e expr.Node, masks []db.Mask) expr.Node {
+	if e == nil || len(masks) == 0 {
+		return e
+	}
+	t := newMaskTree(masks)
+	var keep func(e expr.Node) expr.Node
+	keep = func(e expr.Node) expr.Node {
+		if l, ok := e.(*expr.Logical); ok && l.Op == expr.OpAnd {
+			left, right := keep(l.Left), keep(l.Right)
+			if left == nil {
+				return right
+			} else if right == nil {
+				return left
+			}
+			return expr.And(left, right)
+		}
+		found := false
+		expr.Walk(pathVisitor(func(p *expr.Path) {
+			found = found || t.mask(p) != nil
+		}), e)
+		if found {
+			return nil
+		}
+		return e
+	}
+	return keep(e)
+}
+
+// pathVisitor is an expr.Visitor that
+// calls itself on every *expr.Path
+type pathVisitor func(p *expr.Path)
+
+func (v pathVisitor) Visit(e expr.Node) expr.Visitor {
+	if e == nil {
+		return nil
+	}
+	if p, ok := e.(*expr.Path); ok {
+		v(p)
+	}
+	return v
+}
+
+// maskHint adjusts the type hints of a
+// table schema to account for masked fields
+type maskHint struct {
+	tree  *maskTree
+	inner expr.Hint
+}
+
+// maskedHint returns a hint that applies
+// masks to h, or h itself if there are no
+// masks to apply
+func maskedHint(h expr.Hint, masks []db.Mask) expr.Hint {
+	if h == nil || len(masks) == 0 {
+		return h
+	}
+	return &maskHint{tree: newMaskTree(masks), inner: h}
+}
+
+// TypeOf implements expr.Hint.TypeOf
+func (m *maskHint) TypeOf(e expr.Node) expr.TypeSet {
+	p, ok := e.(*expr.Path)
+	if !ok {
+		return m.inner.TypeOf(e)
+	}
+	t := m.tree.sub[p.First]
+	for rest := p.Rest; t != nil && t.action == ""; {
+		d, ok := rest.(*expr.Dot)
+		if !ok {
+			break
+		}
+		t = t.sub[d.Field]
+		rest = d.Rest
+	}
+	if t == nil {
+		return m.inner.TypeOf(e)
+	}
+	switch t.action {
+	case db.MaskHide:
+		return expr.MissingType
+	case db.MaskNull:
+		// the field may be absent or null
+		return expr.MissingType | expr.NullType
+	case db.MaskRedact:
+		return expr.AnyType
+	}
+	return m.inner.TypeOf(e)
+}
+
+// maskTable wraps a vm.Table so that the
+// rows it produces have masks applied
+// before they are consumed by the query
+//
+// Because masking happens before any
+// part of the query is evaluated, a masked
+// field is indistinguishable from a field
+// that actually holds the masked value;
+// filters, projections, and SELECT *
+// all observe the masked rows.
+type maskTable struct {
+	vm.Table
+	tree *maskTree
+}
+
+// masked returns a table that applies masks
+// to the rows in t, or t itself if there
+// are no masks to apply
+func masked(t vm.Table, masks []db.Mask) vm.Table {
+	if len(masks) == 0 {
+		return t
+	}
+	return &maskTable{Table: t, tree: newMaskTree(masks)}
+}
+
+// cached returns the inner table
+// as a plan.CachedTable, or nil if
+// it does not implement plan.CachedTable
+func (m *maskTable) cached() plan.CachedTable {
+	ct, _ := m.Table.(plan.CachedTable)
+	return ct
+}
+
+func (m *maskTable) Hits() int64 {
+	if ct := m.cached(); ct != nil {
+		return ct.Hits()
+	}
+	return 0
+}
+
+func (m *maskTable) Misses() int64 {
+	if ct := m.cached(); ct != nil {
+		return ct.Misses()
+	}
+	return 0
+}
+
+func (m *maskTable) Bytes() int64 {
+	if ct := m.cached(); ct != nil {
+		return ct.Bytes()
+	}
+	return 0
+}
+
+func (m *maskTable) WriteChunks(dst vm.QuerySink, parallel int) error {
+	return m.Table.WriteChunks(&maskSink{dst: dst, tree: m.tree}, parallel)
+}
+
+type maskSink struct {
+	dst  vm.QuerySink
+	tree *maskTree
+}
+
+func (m *maskSink) Open() (io.WriteCloser, error) {
+	w, err := m.dst.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &maskWriter{dst: w, tree: m.tree}, nil
+}
+
+func (m *maskSink) Close() error { return m.dst.Close() }
+
+// maskWriter rewrites each chunk
+// written to it and passes the result
+// along to dst
+type maskWriter struct {
+	dst  io.WriteCloser
+	tree *maskTree
+	st   ion.Symtab
+	out  ion.Buffer
+}
+
+func (w *maskWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	w.out.Reset()
+	for len(p) > 0 {
+		if ion.IsBVM(p) || ion.TypeOf(p) == ion.AnnotationType {
+			rest, err := w.st.Unmarshal(p)
+			if err != nil {
+				return 0, err
+			}
+			// the symbol table is passed through as-is;
+			// masking never introduces new symbols
+			w.out.UnsafeAppend(p[:len(p)-len(rest)])
+			p = rest
+			continue
+		}
+		size := ion.SizeOf(p)
+		if size <= 0 || size > len(p) {
+			return 0, fmt.Errorf("object size %d out of range [:%d]", size, len(p))
+		}
+		if ion.TypeOf(p) == ion.StructType {
+			if err := w.rewrite(p[:size], w.tree); err != nil {
+				return 0, err
+			}
+		}
+		// anything else (i.e. nop pads) is dropped
+		p = p[size:]
+	}
+	_, err := w.dst.Write(w.out.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// rewrite writes the struct in body into
+// w.out with the masks in t applied
+func (w *maskWriter) rewrite(body []byte, t *maskTree) error {
+	body, _ = ion.Contents(body)
+	if body == nil {
+		return fmt.Errorf("invalid struct encoding")
+	}
+	w.out.BeginStruct(-1)
+	for len(body) > 0 {
+		sym, rest, err := ion.ReadLabel(body)
+		if err != nil {
+			return err
+		}
+		size := ion.SizeOf(rest)
+		if size <= 0 || size > len(rest) {
+			return fmt.Errorf("field size %d out of range [:%d]", size, len(rest))
+		}
+		val := rest[:size]
+		body = rest[size:]
+		name, ok := w.st.Lookup(sym)
+		if !ok {
+			return fmt.Errorf("symbol %d not in symbol table", sym)
+		}
+		sub := t.sub[name]
+		if sub == nil {
+			w.out.BeginField(sym)
+			w.out.UnsafeAppend(val)
+			continue
+		}
+		switch sub.action {
+		case db.MaskHide:
+			// omit the field entirely
+		case db.MaskNull:
+			w.out.BeginField(sym)
+			w.out.WriteNull()
+		case db.MaskRedact:
+			d, _, err := ion.ReadDatum(&w.st, val)
+			if err != nil {
+				return err
+			}
+			w.out.BeginField(sym)
+			expr.Redact(&w.out, d)
+		default:
+			w.out.BeginField(sym)
+			if ion.TypeOf(val) != ion.StructType {
+				w.out.UnsafeAppend(val)
+				continue
+			}
+			if err := w.rewrite(val, sub); err != nil {
+				return err
+			}
+		}
+	}
+	w.out.EndStruct()
+	return nil
+}
+
+// EndSegment implements vm.EndSegmentWriter.EndSegment
+func (w *maskWriter) EndSegment() { vm.HintEndSegment(w.dst) }
+
+func (w *maskWriter) Close() error { return w.dst.Close() }
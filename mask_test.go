@@ -0,0 +1,199 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sneller
+
+import (
+	"testing"
+
+	"github.com/SnellerInc/sneller/db"
+	"github.com/SnellerInc/sneller/expr"
+	"github.com/SnellerInc/sneller/ion"
+	"github.com/SnellerInc/sneller/vm"
+)
+
+func TestMaskTable(t *testing.T) {
+	var st ion.Symtab
+	var buf ion.Buffer
+	rows := []ion.Struct{
+		ion.NewStruct(&st, []ion.Field{
+			{Label: "name", Value: ion.String("alice")},
+			{Label: "email", Value: ion.String("alice@example.com")},
+			{Label: "score", Value: ion.Float(1.5)},
+			{Label: "user", Value: ion.NewStruct(&st, []ion.Field{
+				{Label: "id", Value: ion.Int(1)},
+				{Label: "ssn", Value: ion.String("123-45-6789")},
+			}).Datum()},
+		}),
+		ion.NewStruct(&st, []ion.Field{
+			{Label: "name", Value: ion.String("bob")},
+			{Label: "email", Value: ion.Int(-3)},
+			{Label: "user", Value: ion.String("not a struct")},
+		}),
+	}
+	st.Marshal(&buf, true)
+	for i := range rows {
+		rows[i].Encode(&buf, &st)
+	}
+	masks := []db.Mask{
+		{Path: "email", Action: db.MaskRedact},
+		{Path: "score", Action: db.MaskNull},
+		{Path: "user.ssn", Action: db.MaskHide},
+	}
+	var out vm.QueryBuffer
+	out.SetAlignment(len(buf.Bytes()))
+	tbl := masked(vm.BufferTable(buf.Bytes(), len(buf.Bytes())), masks)
+	err := tbl.WriteChunks(&out, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	redact := func(d ion.Datum) ion.Datum {
+		var buf ion.Buffer
+		expr.Redact(&buf, d)
+		ret, _, err := ion.ReadDatum(&st, buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ret
+	}
+	email0 := redact(ion.String("alice@example.com"))
+	email1 := redact(ion.Int(-3))
+	want := []ion.Struct{
+		ion.NewStruct(&st, []ion.Field{
+			{Label: "name", Value: ion.String("alice")},
+			{Label: "email", Value: email0},
+			{Label: "score", Value: ion.Null},
+			{Label: "user", Value: ion.NewStruct(&st, []ion.Field{
+				{Label: "id", Value: ion.Int(1)},
+			}).Datum()},
+		}),
+		ion.NewStruct(&st, []ion.Field{
+			{Label: "name", Value: ion.String("bob")},
+			{Label: "email", Value: email1},
+			{Label: "user", Value: ion.String("not a struct")},
+		}),
+	}
+
+	var outst ion.Symtab
+	body := out.Bytes()
+	var got []ion.Struct
+	for len(body) > 0 {
+		if ion.IsBVM(body) || ion.TypeOf(body) == ion.AnnotationType {
+			body, err = outst.Unmarshal(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		var d ion.Datum
+		d, body, err = ion.ReadDatum(&outst, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, ok := d.Struct(); ok {
+			got = append(got, s)
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d rows; want %d", len(got), len(want))
+	}
+	for i := range got {
+		if !got[i].Datum().Equal(want[i].Datum()) {
+			t.Errorf("row %d: got %v", i, got[i].Fields(nil))
+			t.Errorf("row %d: want %v", i, want[i].Fields(nil))
+		}
+	}
+}
+
+func TestMaskTree(t *testing.T) {
+	tree := newMaskTree([]db.Mask{
+		{Path: "a.b", Action: db.MaskNull},
+		{Path: "a", Action: db.MaskHide},
+		{Path: "a.c", Action: db.MaskRedact},
+		{Path: "x.y.z", Action: db.MaskRedact},
+	})
+	a := tree.sub["a"]
+	if a == nil || a.action != db.MaskHide || a.sub != nil {
+		t.Errorf("unexpected tree for a: %+v", a)
+	}
+	z := tree.sub["x"].sub["y"].sub["z"]
+	if z == nil || z.action != db.MaskRedact {
+		t.Errorf("unexpected tree for x.y.z: %+v", z)
+	}
+}
+
+func TestMaskPath(t *testing.T) {
+	tree := newMaskTree([]db.Mask{
+		{Path: "email", Action: db.MaskRedact},
+		{Path: "user.ssn", Action: db.MaskHide},
+		{Path: "score", Action: db.MaskNull},
+	})
+	tcs := []struct {
+		path string
+		want string // "" if not masked
+	}{
+		{"name", ""},
+		{"email", "email"},
+		{"score", "score"},
+		{"user", "user"},
+		{"user.id", ""},
+		{"user.ssn", "MISSING"},
+		{"user.ssn.x", "MISSING"},
+	}
+	for i := range tcs {
+		p, err := expr.ParsePath(tcs[i].path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := tree.mask(p)
+		if tcs[i].want == "" {
+			if got != nil {
+				t.Errorf("%s: got %s; expected no mask", tcs[i].path, expr.ToString(got))
+			}
+			continue
+		}
+		if got == nil || expr.ToString(got) != tcs[i].want {
+			t.Errorf("%s: got %v; want %s", tcs[i].path, got, tcs[i].want)
+		}
+	}
+}
+
+func TestUnmasked(t *testing.T) {
+	masks := []db.Mask{
+		{Path: "ts", Action: db.MaskRedact},
+		{Path: "user.ssn", Action: db.MaskHide},
+	}
+	ts := expr.Compare(expr.Less, expr.Identifier("ts"), expr.Integer(0))
+	x := expr.Compare(expr.Greater, expr.Identifier("x"), expr.Integer(1))
+	ssn := expr.Compare(expr.Equals, &expr.Path{First: "user", Rest: &expr.Dot{Field: "ssn"}}, expr.String("x"))
+	tcs := []struct {
+		in, want expr.Node
+	}{
+		{nil, nil},
+		{x, x},
+		{ts, nil},
+		{expr.And(ts, x), x},
+		{expr.And(x, expr.And(ssn, ts)), x},
+		// the whole disjunction depends on ts
+		{expr.Or(ts, x), nil},
+	}
+	for i := range tcs {
+		got := unmasked(tcs[i].in, masks)
+		if (got == nil) != (tcs[i].want == nil) ||
+			got != nil && !expr.Equivalent(got, tcs[i].want) {
+			t.Errorf("case %d: got %s; want %s", i, expr.ToString(got), expr.ToString(tcs[i].want))
+		}
+	}
+}
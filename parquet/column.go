@@ -0,0 +1,654 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// values holds decoded values of a column;
+// only one of the slices is used, depending
+// on the physical type of the column
+type values struct {
+	ints   []int64   // BOOLEAN, INT32, INT64
+	floats []float64 // FLOAT, DOUBLE
+	bytes  [][]byte  // INT96, BYTE_ARRAY, FIXED_LEN_BYTE_ARRAY
+}
+
+func (v *values) len(typ int32) int {
+	switch typ {
+	case typeBoolean, typeInt32, typeInt64:
+		return len(v.ints)
+	case typeFloat, typeDouble:
+		return len(v.floats)
+	}
+	return len(v.bytes)
+}
+
+// column holds the levels and values
+// of a leaf column within a row group
+type column struct {
+	leaf *node
+	// rep and def hold the repetition and
+	// definition level of each entry; they are
+	// nil if the maximum level is zero
+	rep, def []int16
+	// n is the number of entries
+	n int
+	// vals holds the value of each entry
+	// that has the maximum definition level
+	vals values
+	// cursors for the entries and values
+	pos, vpos int
+}
+
+func corrupt(f string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrCorrupt, fmt.Sprintf(f, args...))
+}
+
+// reader reads column chunks
+type reader struct {
+	file []byte
+	zstd *zstd.Decoder
+	// scratch space for levels
+	levels []uint64
+}
+
+func (r *reader) close() {
+	if r.zstd != nil {
+		r.zstd.Close()
+	}
+}
+
+// maxPageSize is the largest uncompressed
+// page size that is accepted
+const maxPageSize = 1 << 28
+
+// decompress decompresses a page of the given
+// (uncompressed) size; since the size comes from
+// the page header, buffers are sized according
+// to the compressed data and grown as needed
+func (r *reader) decompress(codec int32, src []byte, size int32) ([]byte, error) {
+	if size < 0 {
+		return nil, corrupt("negative page size")
+	}
+	if size > maxPageSize {
+		return nil, corrupt("page size %d exceeds the maximum of %d", size, maxPageSize)
+	}
+	hint := int(size)
+	if hint > 4*len(src) {
+		hint = 4 * len(src)
+	}
+	var out []byte
+	var err error
+	switch codec {
+	case codecUncompressed:
+		out = src
+	case codecSnappy:
+		var n int
+		n, err = s2.DecodedLen(src)
+		if err == nil && n != int(size) {
+			return nil, corrupt("page size %d does not match header (%d)", n, size)
+		}
+		if err == nil {
+			out, err = s2.Decode(make([]byte, n), src)
+		}
+	case codecGzip:
+		var zr *gzip.Reader
+		zr, err = gzip.NewReader(bytes.NewReader(src))
+		if err == nil {
+			buf := bytes.NewBuffer(make([]byte, 0, hint))
+			// read one byte more than expected
+			// so that the size check below fails
+			_, err = io.Copy(buf, io.LimitReader(zr, int64(size)+1))
+			out = buf.Bytes()
+		}
+	case codecZstd:
+		if r.zstd == nil {
+			r.zstd, err = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxPageSize))
+			if err != nil {
+				return nil, err
+			}
+		}
+		out, err = r.zstd.DecodeAll(src, make([]byte, 0, hint))
+	default:
+		return nil, fmt.Errorf("%w: compression codec %d", ErrUnsupported, codec)
+	}
+	if err != nil {
+		return nil, corrupt("decompressing page: %s", err)
+	}
+	if len(out) != int(size) {
+		return nil, corrupt("page size %d does not match header (%d)", len(out), size)
+	}
+	return out, nil
+}
+
+// column reads the column chunk m into c
+func (r *reader) column(c *column, m *columnMeta) error {
+	leaf := c.leaf
+	if m.typ != leaf.typ {
+		return corrupt("column %q: type %d does not match schema", leaf.path, m.typ)
+	}
+	start := m.dataOffset
+	if m.dictOffset > 0 && m.dictOffset < start {
+		start = m.dictOffset
+	}
+	if start < 0 || m.size < 0 || start > int64(len(r.file)) || m.size > int64(len(r.file))-start {
+		return corrupt("column %q: chunk out of range", leaf.path)
+	}
+	t := thrift{buf: r.file[start : start+m.size]}
+	var dict *values
+	for int64(c.n) < m.numValues && len(t.buf) > 0 {
+		h, err := t.pageHeader()
+		if err != nil {
+			return err
+		}
+		if h.compressedSize < 0 || int(h.compressedSize) > len(t.buf) || h.uncompressedSize < 0 {
+			return corrupt("column %q: page size out of range", leaf.path)
+		}
+		body := t.buf[:h.compressedSize]
+		t.buf = t.buf[h.compressedSize:]
+		switch h.typ {
+		case pageDictionary:
+			if h.dictEncoding != encPlain && h.dictEncoding != encPlainDictionary {
+				return fmt.Errorf("%w: dictionary encoding %d", ErrUnsupported, h.dictEncoding)
+			}
+			body, err = r.decompress(m.codec, body, h.uncompressedSize)
+			if err != nil {
+				return err
+			}
+			if h.dictValues < 0 {
+				return corrupt("column %q: negative dictionary size", leaf.path)
+			}
+			dict = &values{}
+			err = dict.plain(leaf, body, int(h.dictValues))
+		case pageData:
+			body, err = r.decompress(m.codec, body, h.uncompressedSize)
+			if err != nil {
+				return err
+			}
+			err = r.page(c, &h.data, body, dict, true)
+		case pageDataV2:
+			d := &h.data
+			if d.repLen < 0 || d.defLen < 0 || int64(d.repLen)+int64(d.defLen) > int64(len(body)) {
+				return corrupt("column %q: level sizes out of range", leaf.path)
+			}
+			// levels are never compressed
+			nlev := int(d.repLen + d.defLen)
+			levels, data := body[:nlev], body[nlev:]
+			if d.compressed {
+				data, err = r.decompress(m.codec, data, h.uncompressedSize-int32(nlev))
+				if err != nil {
+					return err
+				}
+			}
+			buf := make([]byte, 0, len(levels)+len(data))
+			buf = append(buf, levels...)
+			buf = append(buf, data...)
+			err = r.page(c, d, buf, dict, false)
+		default:
+			// index pages, etc.
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if int64(c.n) != m.numValues {
+		return corrupt("column %q: found %d values; expected %d", leaf.path, c.n, m.numValues)
+	}
+	if got, want := c.vals.len(leaf.typ), c.count(0); got != want {
+		return corrupt("column %q: found %d non-null values; expected %d", leaf.path, got, want)
+	}
+	return nil
+}
+
+// count returns the number of entries from
+// entry i onwards that have a value
+func (c *column) count(i int) int {
+	if c.def == nil {
+		return c.n - i
+	}
+	n := 0
+	for _, d := range c.def[i:] {
+		if d == c.leaf.def {
+			n++
+		}
+	}
+	return n
+}
+
+// page decodes a data page; if v1 is set, then
+// the levels are prefixed with their length
+// rather than having the lengths in the header
+func (r *reader) page(c *column, h *dataPageHeader, buf []byte, dict *values, v1 bool) error {
+	leaf := c.leaf
+	if h.numValues < 0 {
+		return corrupt("column %q: negative value count", leaf.path)
+	}
+	n := int(h.numValues)
+	var err error
+	readLevels := func(dst []int16, max int16, size int32) ([]int16, error) {
+		if v1 {
+			if len(buf) < 4 {
+				return nil, corrupt("column %q: missing levels", leaf.path)
+			}
+			size = int32(binary.LittleEndian.Uint32(buf))
+			buf = buf[4:]
+		}
+		if size < 0 || int(size) > len(buf) {
+			return nil, corrupt("column %q: levels out of range", leaf.path)
+		}
+		r.levels, err = hybrid(r.levels[:0], buf[:size], bits.Len16(uint16(max)), n)
+		if err != nil {
+			return nil, err
+		}
+		buf = buf[size:]
+		for _, l := range r.levels {
+			if l > uint64(max) {
+				return nil, corrupt("column %q: level %d out of range", leaf.path, l)
+			}
+			dst = append(dst, int16(l))
+		}
+		return dst, nil
+	}
+	if leaf.rep > 0 {
+		if c.rep, err = readLevels(c.rep, leaf.rep, h.repLen); err != nil {
+			return err
+		}
+	}
+	if leaf.def > 0 {
+		if c.def, err = readLevels(c.def, leaf.def, h.defLen); err != nil {
+			return err
+		}
+	}
+	first := c.n
+	c.n += n
+	count := c.count(first)
+	switch h.encoding {
+	case encPlain:
+		return c.vals.plain(leaf, buf, count)
+	case encPlainDictionary, encRLEDictionary:
+		if dict == nil {
+			return corrupt("column %q: missing dictionary page", leaf.path)
+		}
+		return c.vals.dictionary(leaf, buf, count, dict)
+	case encRLE:
+		if leaf.typ != typeBoolean {
+			break
+		}
+		if len(buf) < 4 {
+			return corrupt("column %q: missing values", leaf.path)
+		}
+		size := binary.LittleEndian.Uint32(buf)
+		if uint64(size) > uint64(len(buf)-4) {
+			return corrupt("column %q: values out of range", leaf.path)
+		}
+		r.levels, err = hybrid(r.levels[:0], buf[4:4+size], 1, count)
+		if err != nil {
+			return err
+		}
+		for _, b := range r.levels {
+			c.vals.ints = append(c.vals.ints, int64(b))
+		}
+		return nil
+	case encDeltaBinaryPacked:
+		if leaf.typ != typeInt32 && leaf.typ != typeInt64 {
+			break
+		}
+		start := len(c.vals.ints)
+		c.vals.ints, _, err = deltaBinary(c.vals.ints, buf, count)
+		if leaf.typ == typeInt32 {
+			for i := range c.vals.ints[start:] {
+				c.vals.ints[start+i] = int64(int32(c.vals.ints[start+i]))
+			}
+		}
+		return err
+	case encDeltaLengthByteArray:
+		if leaf.typ != typeByteArray {
+			break
+		}
+		c.vals.bytes, _, err = deltaLength(c.vals.bytes, buf, count)
+		return err
+	case encDeltaByteArray:
+		if leaf.typ != typeByteArray && leaf.typ != typeFixedLenByteArray {
+			break
+		}
+		c.vals.bytes, err = deltaByteArray(c.vals.bytes, buf, count)
+		return err
+	case encByteStreamSplit:
+		return c.vals.byteStreamSplit(leaf, buf, count)
+	}
+	return fmt.Errorf("%w: encoding %d for column %q", ErrUnsupported, h.encoding, leaf.path)
+}
+
+// plain decodes n PLAIN encoded values from buf
+func (v *values) plain(leaf *node, buf []byte, n int) error {
+	short := func() error {
+		return corrupt("column %q: expected %d values", leaf.path, n)
+	}
+	size := 0
+	switch leaf.typ {
+	case typeBoolean:
+		if (n+7)/8 > len(buf) {
+			return short()
+		}
+		for i := 0; i < n; i++ {
+			v.ints = append(v.ints, int64(buf[i/8]>>(i%8))&1)
+		}
+		return nil
+	case typeInt32, typeFloat:
+		size = 4
+	case typeInt64, typeDouble:
+		size = 8
+	case typeInt96:
+		size = 12
+	case typeFixedLenByteArray:
+		size = int(leaf.typeLength)
+	case typeByteArray:
+		for i := 0; i < n; i++ {
+			if len(buf) < 4 {
+				return short()
+			}
+			l := binary.LittleEndian.Uint32(buf)
+			buf = buf[4:]
+			if uint64(l) > uint64(len(buf)) {
+				return short()
+			}
+			v.bytes = append(v.bytes, buf[:l:l])
+			buf = buf[l:]
+		}
+		return nil
+	}
+	if size <= 0 || n > len(buf)/size {
+		return short()
+	}
+	for i := 0; i < n; i++ {
+		b := buf[i*size : (i+1)*size : (i+1)*size]
+		switch leaf.typ {
+		case typeInt32:
+			v.ints = append(v.ints, int64(int32(binary.LittleEndian.Uint32(b))))
+		case typeInt64:
+			v.ints = append(v.ints, int64(binary.LittleEndian.Uint64(b)))
+		case typeFloat:
+			v.floats = append(v.floats, float64(math.Float32frombits(binary.LittleEndian.Uint32(b))))
+		case typeDouble:
+			v.floats = append(v.floats, math.Float64frombits(binary.LittleEndian.Uint64(b)))
+		default:
+			v.bytes = append(v.bytes, b)
+		}
+	}
+	return nil
+}
+
+// dictionary decodes n dictionary indices
+// from buf and appends the values they
+// refer to in dict
+func (v *values) dictionary(leaf *node, buf []byte, n int, dict *values) error {
+	if n == 0 {
+		return nil
+	}
+	if len(buf) == 0 || buf[0] > 32 {
+		return corrupt("column %q: invalid dictionary index width", leaf.path)
+	}
+	idx, err := hybrid(nil, buf[1:], int(buf[0]), n)
+	if err != nil {
+		return err
+	}
+	size := uint64(dict.len(leaf.typ))
+	for _, i := range idx {
+		if i >= size {
+			return corrupt("column %q: dictionary index %d out of range", leaf.path, i)
+		}
+		switch leaf.typ {
+		case typeBoolean, typeInt32, typeInt64:
+			v.ints = append(v.ints, dict.ints[i])
+		case typeFloat, typeDouble:
+			v.floats = append(v.floats, dict.floats[i])
+		default:
+			v.bytes = append(v.bytes, dict.bytes[i])
+		}
+	}
+	return nil
+}
+
+// byteStreamSplit decodes n BYTE_STREAM_SPLIT
+// encoded values, which store the k-th byte
+// of every value in the k-th stream
+func (v *values) byteStreamSplit(leaf *node, buf []byte, n int) error {
+	size := 0
+	switch leaf.typ {
+	case typeInt32, typeFloat:
+		size = 4
+	case typeInt64, typeDouble:
+		size = 8
+	case typeFixedLenByteArray:
+		size = int(leaf.typeLength)
+	default:
+		return fmt.Errorf("%w: BYTE_STREAM_SPLIT encoding for column %q", ErrUnsupported, leaf.path)
+	}
+	if size == 0 || n > len(buf)/size {
+		return corrupt("column %q: expected %d values", leaf.path, n)
+	}
+	joined := make([]byte, n*size)
+	for i := 0; i < n; i++ {
+		for k := 0; k < size; k++ {
+			joined[i*size+k] = buf[k*n+i]
+		}
+	}
+	return v.plain(leaf, joined, n)
+}
+
+// unpack appends n values of the given bit
+// width, which are packed least-significant
+// bit first in src, to dst
+func unpack(dst []uint64, src []byte, width, n int) []uint64 {
+	pos := 0
+	for i := 0; i < n; i++ {
+		var u uint64
+		for got := 0; got < width; {
+			take := 8 - pos&7
+			if take > width-got {
+				take = width - got
+			}
+			b := uint64(src[pos>>3]>>(pos&7)) & (1<<take - 1)
+			u |= b << got
+			got += take
+			pos += take
+		}
+		dst = append(dst, u)
+	}
+	return dst
+}
+
+// hybrid decodes n values of the given bit
+// width that are encoded with the RLE/bit-packing
+// hybrid encoding and appends them to dst
+func hybrid(dst []uint64, src []byte, width, n int) ([]uint64, error) {
+	want := len(dst) + n
+	for len(dst) < want {
+		h, k := binary.Uvarint(src)
+		if k <= 0 {
+			return nil, corrupt("invalid run header")
+		}
+		src = src[k:]
+		left := uint64(want - len(dst))
+		if h&1 == 0 {
+			// repeated value
+			size := (width + 7) / 8
+			if len(src) < size {
+				return nil, corrupt("truncated run")
+			}
+			var u uint64
+			for i := 0; i < size; i++ {
+				u |= uint64(src[i]) << (8 * i)
+			}
+			src = src[size:]
+			count := h >> 1
+			if count > left {
+				count = left
+			}
+			for ; count > 0; count-- {
+				dst = append(dst, u)
+			}
+			continue
+		}
+		// groups of 8 bit-packed values
+		groups := h >> 1
+		if width > 0 && groups > uint64(len(src)/width) {
+			return nil, corrupt("truncated run")
+		}
+		size := int(groups) * width
+		count := groups * 8
+		if count > left {
+			count = left
+		}
+		dst = unpack(dst, src[:size], width, int(count))
+		src = src[size:]
+	}
+	return dst, nil
+}
+
+// maxDeltaBlock is the largest block size
+// accepted in DELTA_BINARY_PACKED data
+const maxDeltaBlock = 1 << 20
+
+// deltaBinary decodes n DELTA_BINARY_PACKED
+// integers from src, appends them to dst,
+// and returns the number of bytes consumed
+func deltaBinary(dst []int64, src []byte, n int) ([]int64, int, error) {
+	t := thrift{buf: src}
+	blockSize, err := t.uvarint()
+	if err != nil {
+		return nil, 0, err
+	}
+	miniBlocks, err := t.uvarint()
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := t.uvarint()
+	if err != nil {
+		return nil, 0, err
+	}
+	last, err := t.varint()
+	if err != nil {
+		return nil, 0, err
+	}
+	if blockSize == 0 || blockSize > maxDeltaBlock || blockSize%128 != 0 || miniBlocks == 0 ||
+		blockSize%miniBlocks != 0 || (blockSize/miniBlocks)%32 != 0 {
+		return nil, 0, corrupt("invalid delta block size %d/%d", blockSize, miniBlocks)
+	}
+	if total != uint64(n) {
+		return nil, 0, corrupt("found %d delta-encoded values; expected %d", total, n)
+	}
+	if n == 0 {
+		return dst, len(src) - len(t.buf), nil
+	}
+	per := int(blockSize / miniBlocks)
+	dst = append(dst, last)
+	left := n - 1
+	var deltas []uint64
+	for left > 0 {
+		minDelta, err := t.varint()
+		if err != nil {
+			return nil, 0, err
+		}
+		if uint64(len(t.buf)) < miniBlocks {
+			return nil, 0, corrupt("truncated delta block")
+		}
+		widths := t.buf[:miniBlocks]
+		t.buf = t.buf[miniBlocks:]
+		for _, w := range widths {
+			if left == 0 {
+				// trailing miniblocks are omitted
+				break
+			}
+			if w > 64 {
+				return nil, 0, corrupt("invalid delta bit width %d", w)
+			}
+			size := per * int(w) / 8
+			if len(t.buf) < size {
+				return nil, 0, corrupt("truncated delta block")
+			}
+			count := per
+			if count > left {
+				count = left
+			}
+			deltas = unpack(deltas[:0], t.buf[:size], int(w), count)
+			t.buf = t.buf[size:]
+			for _, d := range deltas {
+				last += minDelta + int64(d)
+				dst = append(dst, last)
+			}
+			left -= count
+		}
+	}
+	return dst, len(src) - len(t.buf), nil
+}
+
+// deltaLength decodes n DELTA_LENGTH_BYTE_ARRAY
+// values from src, appends them to dst,
+// and returns the number of bytes consumed
+func deltaLength(dst [][]byte, src []byte, n int) ([][]byte, int, error) {
+	lengths, k, err := deltaBinary(nil, src, n)
+	if err != nil {
+		return nil, 0, err
+	}
+	data := src[k:]
+	for _, l := range lengths {
+		if l < 0 || l > int64(len(data)) {
+			return nil, 0, corrupt("length %d out of range", l)
+		}
+		dst = append(dst, data[:l:l])
+		data = data[l:]
+	}
+	return dst, len(src) - len(data), nil
+}
+
+// deltaByteArray decodes n DELTA_BYTE_ARRAY
+// values, which are stored as the length of the
+// prefix shared with the previous value followed
+// by the rest of the value, and appends them to dst
+func deltaByteArray(dst [][]byte, src []byte, n int) ([][]byte, error) {
+	prefixes, k, err := deltaBinary(nil, src, n)
+	if err != nil {
+		return nil, err
+	}
+	suffixes, _, err := deltaLength(nil, src[k:], n)
+	if err != nil {
+		return nil, err
+	}
+	var prev []byte
+	for i := range suffixes {
+		p := prefixes[i]
+		if p < 0 || p > int64(len(prev)) {
+			return nil, corrupt("prefix length %d out of range", p)
+		}
+		v := make([]byte, 0, int(p)+len(suffixes[i]))
+		v = append(v, prev[:p]...)
+		v = append(v, suffixes[i]...)
+		dst = append(dst, v)
+		prev = v
+	}
+	return dst, nil
+}
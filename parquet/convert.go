@@ -0,0 +1,145 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package parquet implements converting
+// Apache Parquet files to binary ION format.
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/SnellerInc/sneller/ion"
+)
+
+var (
+	// ErrMagicMismatch is returned when the
+	// input is not a Parquet file.
+	ErrMagicMismatch = errors.New("parquet: not a parquet file")
+	// ErrInvalidSchema is returned when the
+	// schema of a file cannot be converted.
+	ErrInvalidSchema = errors.New("parquet: invalid schema")
+	// ErrCorrupt is returned when the
+	// file metadata or data are invalid.
+	ErrCorrupt = errors.New("parquet: corrupt data")
+	// ErrUnsupported is returned when a file
+	// uses a codec, encoding, or other feature
+	// that is not supported.
+	ErrUnsupported = errors.New("parquet: unsupported feature")
+)
+
+var magic = []byte("PAR1")
+
+// Convert reads a Parquet file from r and
+// writes each row into dst as a structure,
+// along with the provided constants.
+// The entire file is read into memory,
+// since the metadata is at the end of the file.
+//
+// The uncompressed, snappy, gzip, and zstd codecs
+// are supported, along with data page versions 1
+// and 2 and all of the encodings except for the
+// deprecated BIT_PACKED encoding.
+//
+// Groups are converted to structures, LIST groups
+// and repeated fields to lists, and MAP groups to
+// structures if their keys are strings and to lists
+// of key/value structures otherwise. Null values
+// are omitted from structures (except for map values,
+// since the key is part of the data). Strings, enums, and
+// JSON produce strings, and other byte arrays produce
+// blobs (except for UUIDs, which produce strings).
+// Dates, timestamps, and INT96 values produce
+// timestamps, which are added to the sparse index
+// unless they are inside lists or maps. Decimals
+// produce integers (when the scale is zero) or
+// floating-point numbers.
+func Convert(r io.Reader, dst *ion.Chunker, cons []ion.Field) error {
+	file, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(file) < 2*len(magic)+4 ||
+		!bytes.Equal(file[:len(magic)], magic) ||
+		!bytes.Equal(file[len(file)-len(magic):], magic) {
+		return ErrMagicMismatch
+	}
+	size := binary.LittleEndian.Uint32(file[len(file)-len(magic)-4:])
+	end := len(file) - len(magic) - 4
+	if uint64(size) > uint64(end-len(magic)) {
+		return corrupt("metadata size %d out of range", size)
+	}
+	t := thrift{buf: file[end-int(size) : end]}
+	meta, err := t.fileMeta()
+	if err != nil {
+		return err
+	}
+
+	// make sure constant field IDs are interned
+	prev := ion.Symbol(0)
+	for i := range cons {
+		cons[i].Sym = dst.Symbols.Intern(cons[i].Label)
+		if cons[i].Sym < prev {
+			return fmt.Errorf("parquet: internal error: constant interned symbols out-of-order")
+		}
+		prev = cons[i].Sym
+	}
+	root, leaves, err := build(meta.schema, &dst.Symbols)
+	if err != nil {
+		return err
+	}
+
+	rd := &reader{file: file}
+	defer rd.close()
+	d := decoder{dst: &dst.Buffer, st: &dst.Symbols, ranges: &dst.Ranges}
+	d.cols = make([]*column, len(leaves))
+	for i := range meta.rowGroups {
+		g := &meta.rowGroups[i]
+		if len(g.columns) != len(leaves) {
+			return corrupt("row group has %d columns; expected %d", len(g.columns), len(leaves))
+		}
+		for j := range leaves {
+			d.cols[j] = &column{leaf: leaves[j]}
+			if err := rd.column(d.cols[j], &g.columns[j]); err != nil {
+				return err
+			}
+		}
+		for n := g.numRows; n > 0; n-- {
+			if err := d.begin(); err != nil {
+				return err
+			}
+			dst.BeginStruct(-1)
+			for i := range cons {
+				dst.BeginField(cons[i].Sym)
+				cons[i].Value.Encode(&dst.Buffer, &dst.Symbols)
+			}
+			if err := d.fields(root); err != nil {
+				return err
+			}
+			dst.EndStruct()
+			if err := dst.Commit(); err != nil {
+				return err
+			}
+		}
+		for _, c := range d.cols {
+			if c.pos != c.n {
+				return corrupt("column %q: %d values left after %d rows", c.leaf.path, c.n-c.pos, g.numRows)
+			}
+		}
+	}
+	return nil
+}
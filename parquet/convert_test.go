@@ -0,0 +1,716 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"strings"
+	"testing"
+
+	"github.com/SnellerInc/sneller/ion"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// encoder produces thrift compact encoded structures
+type encoder struct {
+	buf  []byte
+	last []int16
+}
+
+func (e *encoder) header(id int16, typ byte) {
+	last := &e.last[len(e.last)-1]
+	if d := id - *last; d > 0 && d <= 15 {
+		e.buf = append(e.buf, byte(d)<<4|typ)
+	} else {
+		e.buf = append(e.buf, typ)
+		e.buf = binary.AppendUvarint(e.buf, uint64(id)<<1^uint64(id>>15))
+	}
+	*last = id
+}
+
+func (e *encoder) varint(n int64) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(n<<1)^uint64(n>>63))
+}
+
+// begin starts a structure
+func (e *encoder) begin() *encoder {
+	e.last = append(e.last, 0)
+	return e
+}
+
+// end ends a structure
+func (e *encoder) end() *encoder {
+	e.buf = append(e.buf, 0)
+	e.last = e.last[:len(e.last)-1]
+	return e
+}
+
+// field starts a structure field
+func (e *encoder) field(id int16) *encoder {
+	e.header(id, tstruct)
+	return e.begin()
+}
+
+func (e *encoder) i32(id int16, n int32) *encoder {
+	e.header(id, ti32)
+	e.varint(int64(n))
+	return e
+}
+
+func (e *encoder) i64(id int16, n int64) *encoder {
+	e.header(id, ti64)
+	e.varint(n)
+	return e
+}
+
+func (e *encoder) str(id int16, s string) *encoder {
+	e.header(id, tbinary)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(s)))
+	e.buf = append(e.buf, s...)
+	return e
+}
+
+func (e *encoder) bool(id int16, b bool) *encoder {
+	if b {
+		e.header(id, ttrue)
+	} else {
+		e.header(id, tfalse)
+	}
+	return e
+}
+
+// list starts a list field with n elements
+func (e *encoder) list(id int16, typ byte, n int) *encoder {
+	e.header(id, tlist)
+	if n < 15 {
+		e.buf = append(e.buf, byte(n)<<4|typ)
+	} else {
+		e.buf = append(e.buf, 0xf0|typ)
+		e.buf = binary.AppendUvarint(e.buf, uint64(n))
+	}
+	return e
+}
+
+// spec is a schema element
+type spec struct {
+	name      string
+	typ       int32 // -1 for groups
+	length    int32
+	rep       int32
+	children  int32
+	converted int32
+	scale     int32
+	logical   int16
+	unit      int16
+}
+
+func group(name string, rep int32, children int32, converted int32, logical int16) spec {
+	return spec{name: name, typ: -1, rep: rep, children: children, converted: converted, logical: logical}
+}
+
+func leaf(name string, typ, rep int32) spec {
+	return spec{name: name, typ: typ, rep: rep, converted: convertedNone}
+}
+
+func (el spec) with(converted int32, logical int16) spec {
+	el.converted = converted
+	el.logical = logical
+	return el
+}
+
+func (e *encoder) spec(el *spec) {
+	e.begin()
+	if el.typ >= 0 {
+		e.i32(1, el.typ)
+	}
+	if el.length > 0 {
+		e.i32(2, el.length)
+	}
+	e.i32(3, el.rep)
+	e.str(4, el.name)
+	if el.children > 0 {
+		e.i32(5, el.children)
+	}
+	if el.converted >= 0 {
+		e.i32(6, el.converted)
+	}
+	if el.scale > 0 {
+		e.i32(7, el.scale)
+	}
+	if el.logical != 0 {
+		e.field(10).field(el.logical)
+		switch el.logical {
+		case logicalDecimal:
+			e.i32(1, el.scale).i32(2, 9)
+		case logicalTimestamp:
+			e.bool(1, true).field(2).field(el.unit).end().end()
+		case logicalInteger:
+			e.header(1, tbyte)
+			e.buf = append(e.buf, 32)
+			e.bool(2, false)
+		}
+		e.end().end()
+	}
+	e.end()
+}
+
+// chunk is a column chunk with a single data page
+// (and optionally a dictionary page)
+type chunk struct {
+	typ               int32
+	maxRep, maxDef    int
+	rep, def          []int
+	encoding          int32
+	values            []byte
+	dict              []byte
+	dictN             int
+	rowsInPage, nulls int
+}
+
+// hybridRLE encodes vals with the RLE/bit-packing
+// hybrid encoding, using RLE runs for equal values
+// and bit-packed runs for everything else
+func hybridRLE(vals []int, width int) []byte {
+	var out []byte
+	for len(vals) > 0 {
+		n := 1
+		for n < len(vals) && vals[n] == vals[0] {
+			n++
+		}
+		if n >= 8 || len(vals) < 8 {
+			out = binary.AppendUvarint(out, uint64(n)<<1)
+			for i := 0; i < (width+7)/8; i++ {
+				out = append(out, byte(vals[0]>>(8*i)))
+			}
+			vals = vals[n:]
+			continue
+		}
+		// one bit-packed group of 8 values
+		out = binary.AppendUvarint(out, 1<<1|1)
+		out = append(out, pack(vals[:8], width)...)
+		vals = vals[8:]
+	}
+	return out
+}
+
+func pack(vals []int, width int) []byte {
+	out := make([]byte, (len(vals)*width+7)/8)
+	for i, v := range vals {
+		for b := 0; b < width; b++ {
+			if v&(1<<b) != 0 {
+				pos := i*width + b
+				out[pos/8] |= 1 << (pos % 8)
+			}
+		}
+	}
+	return out
+}
+
+// deltaPacked encodes vals with DELTA_BINARY_PACKED
+// encoding using blocks of 128 values and 4 miniblocks
+func deltaPacked(vals []int64) []byte {
+	var e encoder
+	e.buf = binary.AppendUvarint(e.buf, 128)
+	e.buf = binary.AppendUvarint(e.buf, 4)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(vals)))
+	if len(vals) == 0 {
+		e.varint(0)
+		return e.buf
+	}
+	e.varint(vals[0])
+	for i := 1; i < len(vals); i += 128 {
+		end := i + 128
+		if end > len(vals) {
+			end = len(vals)
+		}
+		deltas := make([]int64, end-i)
+		min := int64(math.MaxInt64)
+		for j := range deltas {
+			deltas[j] = vals[i+j] - vals[i+j-1]
+			if deltas[j] < min {
+				min = deltas[j]
+			}
+		}
+		e.varint(min)
+		packed := make([]int, 128)
+		width := 0
+		for j := range deltas {
+			packed[j] = int(deltas[j] - min)
+			if w := bits.Len(uint(packed[j])); w > width {
+				width = w
+			}
+		}
+		e.buf = append(e.buf, byte(width), byte(width), byte(width), byte(width))
+		for m := 0; m*32 < len(deltas); m++ {
+			e.buf = append(e.buf, pack(packed[m*32:m*32+32], width)...)
+		}
+	}
+	return e.buf
+}
+
+func plainInt64(vals ...int64) []byte {
+	var out []byte
+	for _, v := range vals {
+		out = binary.LittleEndian.AppendUint64(out, uint64(v))
+	}
+	return out
+}
+
+func plainInt32(vals ...int32) []byte {
+	var out []byte
+	for _, v := range vals {
+		out = binary.LittleEndian.AppendUint32(out, uint32(v))
+	}
+	return out
+}
+
+func plainBytes(vals ...string) []byte {
+	var out []byte
+	for _, v := range vals {
+		out = binary.LittleEndian.AppendUint32(out, uint32(len(v)))
+		out = append(out, v...)
+	}
+	return out
+}
+
+func compress(t *testing.T, codec int32, b []byte) []byte {
+	switch codec {
+	case codecSnappy:
+		return snappy.Encode(nil, b)
+	case codecGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write(b)
+		w.Close()
+		return buf.Bytes()
+	case codecZstd:
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer enc.Close()
+		return enc.EncodeAll(b, nil)
+	}
+	return b
+}
+
+// page encodes a page header followed by the page
+func page(typ int32, uncompressed, body []byte, hdr func(e *encoder)) []byte {
+	var e encoder
+	e.begin()
+	e.i32(1, typ).i32(2, int32(len(uncompressed))).i32(3, int32(len(body)))
+	hdr(&e)
+	e.end()
+	return append(e.buf, body...)
+}
+
+// pages encodes the pages of c
+func (c *chunk) pages(t *testing.T, codec int32, v2 bool) (dict, data []byte) {
+	width := func(max int) int { return bits.Len(uint(max)) }
+	n := len(c.def)
+	if c.def == nil {
+		n = c.rowsInPage
+	}
+	if c.dict != nil {
+		body := compress(t, codec, c.dict)
+		dict = page(pageDictionary, c.dict, body, func(e *encoder) {
+			e.field(7).i32(1, int32(c.dictN)).i32(2, encPlainDictionary).end()
+		})
+	}
+	var rep, def []byte
+	if c.maxRep > 0 {
+		rep = hybridRLE(c.rep, width(c.maxRep))
+	}
+	if c.maxDef > 0 {
+		def = hybridRLE(c.def, width(c.maxDef))
+	}
+	if !v2 {
+		var raw []byte
+		if rep != nil {
+			raw = binary.LittleEndian.AppendUint32(raw, uint32(len(rep)))
+			raw = append(raw, rep...)
+		}
+		if def != nil {
+			raw = binary.LittleEndian.AppendUint32(raw, uint32(len(def)))
+			raw = append(raw, def...)
+		}
+		raw = append(raw, c.values...)
+		data = page(pageData, raw, compress(t, codec, raw), func(e *encoder) {
+			e.field(5).i32(1, int32(n)).i32(2, c.encoding).i32(3, encRLE).i32(4, encRLE).end()
+		})
+		return dict, data
+	}
+	levels := append(append([]byte{}, rep...), def...)
+	raw := append(append([]byte{}, levels...), c.values...)
+	body := append(append([]byte{}, levels...), compress(t, codec, c.values)...)
+	data = page(pageDataV2, raw, body, func(e *encoder) {
+		e.field(8).i32(1, int32(n)).i32(2, int32(c.nulls)).i32(3, int32(c.rowsInPage))
+		e.i32(4, c.encoding).i32(5, int32(len(def))).i32(6, int32(len(rep)))
+		e.bool(7, codec != codecUncompressed).end()
+	})
+	return dict, data
+}
+
+// file produces a Parquet file with the given schema
+// and column chunks, which are repeated in each of
+// the given number of row groups
+func file(t *testing.T, schema []spec, chunks []chunk, rows int64, groups int, codec int32, v2 bool) []byte {
+	out := append([]byte{}, magic...)
+	type meta struct {
+		dictOffset, dataOffset, size int64
+		values                       int64
+	}
+	metas := make([]meta, len(chunks))
+	for i := range chunks {
+		dict, data := chunks[i].pages(t, codec, v2)
+		m := &metas[i]
+		if dict != nil {
+			m.dictOffset = int64(len(out))
+			out = append(out, dict...)
+		}
+		m.dataOffset = int64(len(out))
+		out = append(out, data...)
+		m.size = int64(len(dict) + len(data))
+		m.values = int64(len(chunks[i].def))
+		if chunks[i].def == nil {
+			m.values = rows
+		}
+	}
+	var e encoder
+	e.begin()
+	e.i32(1, 1)
+	e.list(2, tstruct, len(schema))
+	for i := range schema {
+		e.spec(&schema[i])
+	}
+	e.i64(3, rows*int64(groups))
+	e.list(4, tstruct, groups)
+	for g := 0; g < groups; g++ {
+		e.begin()
+		e.list(1, tstruct, len(chunks))
+		for i := range chunks {
+			m := &metas[i]
+			e.begin()
+			e.i64(2, m.dataOffset)
+			e.field(3)
+			e.i32(1, chunks[i].typ)
+			e.list(2, ti32, 1)
+			e.varint(int64(chunks[i].encoding))
+			e.list(3, tbinary, 1)
+			e.buf = binary.AppendUvarint(e.buf, 1)
+			e.buf = append(e.buf, 'x')
+			e.i32(4, codec)
+			e.i64(5, m.values)
+			e.i64(6, m.size)
+			e.i64(7, m.size)
+			e.i64(9, m.dataOffset)
+			if m.dictOffset > 0 {
+				e.i64(11, m.dictOffset)
+			}
+			e.end()
+			e.end()
+		}
+		e.i64(2, 1000)
+		e.i64(3, rows)
+		e.end()
+	}
+	e.str(6, "test")
+	e.end()
+	out = append(out, e.buf...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(e.buf)))
+	return append(out, magic...)
+}
+
+func convert(t *testing.T, file []byte) (string, error) {
+	var out bytes.Buffer
+	dst := ion.Chunker{
+		Align: 1024 * 1024,
+		W:     ion.NewJSONWriter(&out, '\n'),
+	}
+	err := Convert(bytes.NewReader(file), &dst, []ion.Field{{Label: "input_file", Value: ion.String("test.parquet")}})
+	if err != nil {
+		return "", err
+	}
+	if err := dst.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return out.String(), nil
+}
+
+// testSchema is
+//
+//	message test {
+//	  required int64 id;
+//	  optional binary name (STRING);
+//	  optional int64 ts (TIMESTAMP(MICROS, true));
+//	  optional group tags (LIST) {
+//	    repeated group list {
+//	      optional binary element (UTF8);
+//	    }
+//	  }
+//	  optional group attrs (MAP) {
+//	    repeated group key_value {
+//	      required binary key (UTF8);
+//	      optional int32 value;
+//	    }
+//	  }
+//	  repeated int32 nums;
+//	}
+var testSchema = []spec{
+	group("test", required, 6, convertedNone, 0),
+	leaf("id", typeInt64, required),
+	leaf("name", typeByteArray, optional).with(convertedNone, logicalString),
+	{name: "ts", typ: typeInt64, rep: optional, converted: convertedNone, logical: logicalTimestamp, unit: unitMicros},
+	group("tags", optional, 1, convertedList, logicalList),
+	group("list", repeated, 1, convertedNone, 0),
+	leaf("element", typeByteArray, optional).with(convertedUTF8, 0),
+	group("attrs", optional, 1, convertedMap, logicalMap),
+	group("key_value", repeated, 2, convertedMapKeyValue, 0),
+	leaf("key", typeByteArray, required).with(convertedUTF8, 0),
+	leaf("value", typeInt32, optional),
+	leaf("nums", typeInt32, repeated),
+}
+
+func testChunks(delta bool) []chunk {
+	id := chunk{typ: typeInt64, rowsInPage: 3, encoding: encPlain, values: plainInt64(1, 2, 3)}
+	if delta {
+		id.encoding = encDeltaBinaryPacked
+		id.values = deltaPacked([]int64{1, 2, 3})
+	}
+	return []chunk{
+		id,
+		{
+			// dictionary-encoded
+			typ: typeByteArray, maxDef: 1, rowsInPage: 3, nulls: 1,
+			def:      []int{1, 0, 1},
+			encoding: encRLEDictionary,
+			dict:     plainBytes("first", "third"),
+			dictN:    2,
+			values:   append([]byte{1}, hybridRLE([]int{0, 1}, 1)...),
+		},
+		{
+			typ: typeInt64, maxDef: 1, rowsInPage: 3, nulls: 1,
+			def:      []int{1, 0, 1},
+			encoding: encPlain,
+			values:   plainInt64(1136214245123456, 0),
+		},
+		{
+			typ: typeByteArray, maxRep: 1, maxDef: 3, rowsInPage: 3, nulls: 3,
+			rep:      []int{0, 1, 1, 0, 0},
+			def:      []int{3, 2, 3, 1, 0},
+			encoding: encPlain,
+			values:   plainBytes("x", "y"),
+		},
+		{
+			typ: typeByteArray, maxRep: 1, maxDef: 2, rowsInPage: 3, nulls: 1,
+			rep:      []int{0, 1, 0, 0},
+			def:      []int{2, 2, 0, 2},
+			encoding: encPlain,
+			values:   plainBytes("k1", "k2", "k3"),
+		},
+		{
+			typ: typeInt32, maxRep: 1, maxDef: 3, rowsInPage: 3, nulls: 2,
+			rep:      []int{0, 1, 0, 0},
+			def:      []int{3, 2, 0, 3},
+			encoding: encPlain,
+			values:   plainInt32(1, 3),
+		},
+		{
+			// 9 values in row 1 so that the levels
+			// include a bit-packed run
+			typ: typeInt32, maxRep: 1, maxDef: 1, rowsInPage: 3, nulls: 2,
+			rep:      []int{0, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0},
+			def:      []int{1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0},
+			encoding: encPlain,
+			values:   plainInt32(1, 2, 3, 4, 5, 6, 7, 8, 9),
+		},
+	}
+}
+
+const testOutput = `{"name": "first", "input_file": "test.parquet", "id": 1, "ts": "2006-01-02T15:04:05.123456Z", "tags": ["x", null, "y"], "attrs": {"k1": 1, "k2": null}, "nums": [1, 2, 3, 4, 5, 6, 7, 8, 9]}
+{"input_file": "test.parquet", "id": 2, "tags": [], "nums": []}
+{"name": "third", "input_file": "test.parquet", "id": 3, "ts": "1970-01-01T00:00:00Z", "attrs": {"k3": 3}, "nums": []}
+`
+
+func TestConvert(t *testing.T) {
+	codecs := []int32{codecUncompressed, codecSnappy, codecGzip, codecZstd}
+	for _, codec := range codecs {
+		for _, v2 := range []bool{false, true} {
+			t.Run(fmt.Sprintf("codec=%d/v2=%v", codec, v2), func(t *testing.T) {
+				got, err := convert(t, file(t, testSchema, testChunks(v2), 3, 1, codec, v2))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != testOutput {
+					t.Errorf("got:\n%s\nwant:\n%s", got, testOutput)
+				}
+				got, err = convert(t, file(t, testSchema, testChunks(v2), 3, 2, codec, v2))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != testOutput+testOutput {
+					t.Errorf("got:\n%s\nwant:\n%s", got, testOutput+testOutput)
+				}
+			})
+		}
+	}
+}
+
+func TestConvertTypes(t *testing.T) {
+	uuid := "\x12\x34\x56\x78\x12\x34\x56\x78\x12\x34\x56\x78\x12\x34\x56\x78"
+	int96 := make([]byte, 12)
+	binary.LittleEndian.PutUint64(int96, uint64(54245*1e9))
+	binary.LittleEndian.PutUint32(int96[8:], 2453738)
+	schema := []spec{
+		group("types", required, 11, convertedNone, 0),
+		leaf("ok", typeBoolean, required),
+		leaf("day", typeInt32, required).with(convertedDate, logicalDate),
+		{name: "price", typ: typeInt32, rep: required, converted: convertedDecimal, scale: 2},
+		leaf("big", typeInt32, required).with(convertedNone, logicalInteger),
+		leaf("old", typeInt64, required).with(convertedTimestampMillis, 0),
+		leaf("legacy", typeInt96, required),
+		{name: "id", typ: typeFixedLenByteArray, length: 16, rep: required, converted: convertedNone, logical: logicalUUID},
+		{name: "half", typ: typeFixedLenByteArray, length: 2, rep: required, converted: convertedNone, logical: logicalFloat16},
+		leaf("score", typeDouble, required),
+		leaf("ratio", typeFloat, required),
+		leaf("raw", typeByteArray, required),
+	}
+	chunks := []chunk{
+		{typ: typeBoolean, rowsInPage: 1, encoding: encPlain, values: []byte{1}},
+		{typ: typeInt32, rowsInPage: 1, encoding: encPlain, values: plainInt32(13150)},
+		{typ: typeInt32, rowsInPage: 1, encoding: encPlain, values: plainInt32(-500)},
+		{typ: typeInt32, rowsInPage: 1, encoding: encPlain, values: plainInt32(-1)},
+		{typ: typeInt64, rowsInPage: 1, encoding: encPlain, values: plainInt64(1136214245000)},
+		{typ: typeInt96, rowsInPage: 1, encoding: encPlain, values: int96},
+		{typ: typeFixedLenByteArray, rowsInPage: 1, encoding: encPlain, values: []byte(uuid)},
+		{typ: typeFixedLenByteArray, rowsInPage: 1, encoding: encPlain, values: []byte{0x00, 0x3e}},
+		{typ: typeDouble, rowsInPage: 1, encoding: encByteStreamSplit,
+			values: []byte{0, 0, 0, 0, 0, 0, 0xf8, 0x3f}},
+		{typ: typeFloat, rowsInPage: 1, encoding: encPlain, values: binary.LittleEndian.AppendUint32(nil, math.Float32bits(0.25))},
+		{typ: typeByteArray, rowsInPage: 1, encoding: encDeltaLengthByteArray,
+			values: append(deltaPacked([]int64{2}), 0xab, 0xcd)},
+	}
+	got, err := convert(t, file(t, schema, chunks, 1, 1, codecUncompressed, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"input_file": "test.parquet", "ok": true, "day": "2006-01-02T00:00:00Z", "price": -5, "big": 4294967295, "old": "2006-01-02T15:04:05Z", "legacy": "2006-01-02T15:04:05Z", "id": "12345678-1234-5678-1234-567812345678", "half": 1.5, "score": 1.5, "ratio": 0.25, "raw": "q80="}` + "\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestConvertDeltaByteArray(t *testing.T) {
+	schema := []spec{
+		group("s", required, 1, convertedNone, 0),
+		leaf("s", typeByteArray, required).with(convertedUTF8, 0),
+	}
+	// "apple", "applesauce", "apricot"
+	values := deltaPacked([]int64{0, 5, 2})
+	values = append(values, deltaPacked([]int64{5, 5, 5})...)
+	values = append(values, "applesaucericot"...)
+	chunks := []chunk{{typ: typeByteArray, rowsInPage: 3, encoding: encDeltaByteArray, values: values}}
+	got, err := convert(t, file(t, schema, chunks, 3, 1, codecUncompressed, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"input_file": "test.parquet", "s": "apple"}
+{"input_file": "test.parquet", "s": "applesauce"}
+{"input_file": "test.parquet", "s": "apricot"}
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	good := file(t, testSchema, testChunks(false), 3, 1, codecUncompressed, false)
+
+	// too many rows for the values
+	rows := file(t, testSchema, testChunks(false), 4, 1, codecUncompressed, false)
+	// a repetition level that starts a record mid-list
+	chunks := testChunks(false)
+	chunks[3].rep = []int{0, 1, 1, 1, 0}
+	misaligned := file(t, testSchema, chunks, 3, 1, codecUncompressed, false)
+	// a dictionary index out of range
+	chunks = testChunks(false)
+	chunks[1].values = append([]byte{2}, hybridRLE([]int{0, 3}, 2)...)
+	dict := file(t, testSchema, chunks, 3, 1, codecUncompressed, false)
+	// an empty group
+	schema := append([]spec{}, testSchema...)
+	schema[4] = group("tags", optional, 0, convertedList, logicalList)
+	badSchema := file(t, schema, testChunks(false), 3, 1, codecUncompressed, false)
+	// LZ4
+	lz4 := file(t, testSchema, testChunks(false), 3, 1, 5, false)
+
+	runs := []struct {
+		name string
+		file []byte
+		want error
+	}{
+		{"not parquet", []byte("{\"json\": true}"), ErrMagicMismatch},
+		{"empty", nil, ErrMagicMismatch},
+		{"truncated", append(good[:len(good)-20:len(good)-20], magic...), ErrCorrupt},
+		{"footer", append(good[:len(good)-8:len(good)-8], 0xff, 0xff, 0, 0, 'P', 'A', 'R', '1'), ErrCorrupt},
+		{"rows", rows, ErrCorrupt},
+		{"misaligned", misaligned, ErrCorrupt},
+		{"dictionary", dict, ErrCorrupt},
+		{"schema", badSchema, ErrInvalidSchema},
+		{"lz4", lz4, ErrUnsupported},
+	}
+	for i := range runs {
+		_, err := convert(t, runs[i].file)
+		if !errors.Is(err, runs[i].want) {
+			t.Errorf("%s: got error %v, want %v", runs[i].name, err, runs[i].want)
+		}
+	}
+	// no truncation of a valid file may panic
+	for i := 0; i < len(good)-len(magic); i++ {
+		b := append(good[:i:i], magic...)
+		_, err := convert(t, b)
+		if err == nil {
+			t.Fatalf("truncated to %d bytes: no error", i)
+		}
+		if strings.Contains(err.Error(), "internal error") {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDecompressSize(t *testing.T) {
+	var rd reader
+	defer rd.close()
+	for _, codec := range []int32{codecUncompressed, codecSnappy, codecGzip, codecZstd} {
+		body := compress(t, codec, []byte("page"))
+		for _, size := range []int32{3, 5, maxPageSize + 1, math.MaxInt32} {
+			_, err := rd.decompress(codec, body, size)
+			if !errors.Is(err, ErrCorrupt) {
+				t.Errorf("codec %d, size %d: got error %v", codec, size, err)
+			}
+		}
+		out, err := rd.decompress(codec, body, 4)
+		if err != nil || string(out) != "page" {
+			t.Errorf("codec %d: got %q, %v", codec, out, err)
+		}
+	}
+}
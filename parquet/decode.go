@@ -0,0 +1,430 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package parquet
+
+import (
+	"encoding/binary"
+	"math"
+	"math/big"
+
+	"github.com/SnellerInc/sneller/date"
+	"github.com/SnellerInc/sneller/ion"
+
+	"github.com/google/uuid"
+)
+
+// maxIndexingDepth is the maximum depth of
+// fields for which timestamp ranges are
+// recorded (see jsonrl.MaxIndexingDepth)
+const maxIndexingDepth = 3
+
+// julianUnixEpoch is the Julian day
+// number of the Unix epoch
+const julianUnixEpoch = 2440588
+
+// decoder assembles records from the
+// columns of a row group
+type decoder struct {
+	cols []*column
+	dst  *ion.Buffer
+	st   *ion.Symtab
+
+	// ranges, if non-nil, receives the timestamps
+	// of fields that are not inside lists or maps
+	ranges  *ion.Ranges
+	path    []ion.Symbol
+	noindex int
+	symbuf  ion.Symbuf
+}
+
+// begin checks that every column is
+// positioned at the start of a record
+func (d *decoder) begin() error {
+	for _, c := range d.cols {
+		if c.pos >= c.n {
+			return corrupt("column %q: too few values", c.leaf.path)
+		}
+		if c.rep != nil && c.rep[c.pos] != 0 {
+			return corrupt("column %q: misaligned record", c.leaf.path)
+		}
+	}
+	return nil
+}
+
+// level returns the definition level of the
+// current entry of the first leaf below n
+func (d *decoder) level(n *node) (int16, error) {
+	c := d.cols[n.first]
+	if c.pos >= c.n {
+		return 0, corrupt("column %q: too few values", c.leaf.path)
+	}
+	if c.def == nil {
+		return 0, nil
+	}
+	return c.def[c.pos], nil
+}
+
+// skip consumes the current entry of each
+// leaf below n, which must not have a value
+func (d *decoder) skip(n *node) error {
+	for _, c := range d.cols[n.first:n.last] {
+		if c.pos >= c.n {
+			return corrupt("column %q: too few values", c.leaf.path)
+		}
+		if c.def == nil || c.def[c.pos] == c.leaf.def {
+			return corrupt("column %q: unexpected value", c.leaf.path)
+		}
+		c.pos++
+	}
+	return nil
+}
+
+// more returns true if the next entry of the
+// first leaf below the repeated node r is
+// another element of the same list
+func (d *decoder) more(r *node) bool {
+	c := d.cols[r.first]
+	return c.pos < c.n && c.rep[c.pos] == r.rep
+}
+
+// null returns true if the optional node n is
+// null, in which case its entries are consumed
+func (d *decoder) null(n *node) (bool, error) {
+	if n.repetition != optional {
+		return false, nil
+	}
+	l, err := d.level(n)
+	if err != nil || l >= n.def {
+		return false, err
+	}
+	return true, d.skip(n)
+}
+
+// fields writes the children of n
+// as the fields of a structure
+func (d *decoder) fields(n *node) error {
+	for _, c := range n.children {
+		if c.repetition == repeated {
+			d.dst.BeginField(c.sym)
+			if err := d.repeated(c, c); err != nil {
+				return err
+			}
+			continue
+		}
+		null, err := d.null(c)
+		if err != nil {
+			return err
+		}
+		if null {
+			continue
+		}
+		d.dst.BeginField(c.sym)
+		d.path = append(d.path, c.sym)
+		err = d.value(c)
+		d.path = d.path[:len(d.path)-1]
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// repeated writes a list with the elements
+// of the repeated node r, which are the
+// values of the node elem
+func (d *decoder) repeated(r, elem *node) error {
+	d.noindex++
+	defer func() { d.noindex-- }()
+	d.dst.BeginList(-1)
+	l, err := d.level(r)
+	if err != nil {
+		return err
+	}
+	if l < r.def {
+		// empty list
+		if err := d.skip(r); err != nil {
+			return err
+		}
+		d.dst.EndList()
+		return nil
+	}
+	for {
+		if elem == r {
+			err = d.value(r)
+		} else {
+			err = d.item(elem)
+		}
+		if err != nil {
+			return err
+		}
+		if !d.more(r) {
+			break
+		}
+	}
+	d.dst.EndList()
+	return nil
+}
+
+// item writes the node n as a list element
+func (d *decoder) item(n *node) error {
+	if n.repetition == repeated {
+		return d.repeated(n, n)
+	}
+	null, err := d.null(n)
+	if err != nil {
+		return err
+	}
+	if null {
+		d.dst.WriteNull()
+		return nil
+	}
+	return d.value(n)
+}
+
+// value writes the value of the node n
+func (d *decoder) value(n *node) error {
+	switch n.kind {
+	case kindLeaf:
+		return d.leaf(n)
+	case kindStruct:
+		d.dst.BeginStruct(-1)
+		if err := d.fields(n); err != nil {
+			return err
+		}
+		d.dst.EndStruct()
+	case kindList:
+		return d.repeated(n.list, n.elem)
+	case kindMap, kindPairs:
+		return d.entries(n)
+	}
+	return nil
+}
+
+// entries writes the entries of a map; maps
+// with string keys are written as structures,
+// and other maps as lists of key/value structures
+func (d *decoder) entries(n *node) error {
+	d.noindex++
+	defer func() { d.noindex-- }()
+	if n.kind == kindMap {
+		d.dst.BeginStruct(-1)
+	} else {
+		d.dst.BeginList(-1)
+	}
+	l, err := d.level(n.list)
+	if err != nil {
+		return err
+	}
+	if l < n.list.def {
+		if err := d.skip(n.list); err != nil {
+			return err
+		}
+	} else {
+		for {
+			if n.kind == kindMap {
+				err = d.entry(n)
+			} else {
+				d.dst.BeginStruct(-1)
+				err = d.fields(n.list)
+				d.dst.EndStruct()
+			}
+			if err != nil {
+				return err
+			}
+			if !d.more(n.list) {
+				break
+			}
+		}
+	}
+	if n.kind == kindMap {
+		d.dst.EndStruct()
+	} else {
+		d.dst.EndList()
+	}
+	return nil
+}
+
+// entry writes a map entry with a string key
+// as a field of the current structure
+func (d *decoder) entry(n *node) error {
+	c := d.cols[n.key.first]
+	if c.pos >= c.n || c.vpos >= len(c.vals.bytes) {
+		return corrupt("column %q: too few values", c.leaf.path)
+	}
+	if c.def != nil && c.def[c.pos] != n.key.def {
+		return corrupt("column %q: missing key", c.leaf.path)
+	}
+	key := c.vals.bytes[c.vpos]
+	c.pos++
+	c.vpos++
+	d.dst.BeginField(d.st.Intern(string(key)))
+	// unlike null fields, null map values
+	// are kept, since the key is data
+	return d.item(n.value)
+}
+
+// leaf writes the current value of the leaf n
+func (d *decoder) leaf(n *node) error {
+	c := d.cols[n.first]
+	if c.pos >= c.n || c.vpos >= c.vals.len(n.typ) {
+		return corrupt("column %q: too few values", n.path)
+	}
+	if c.def != nil && c.def[c.pos] != n.def {
+		return corrupt("column %q: missing value", n.path)
+	}
+	i := c.vpos
+	c.pos++
+	c.vpos++
+	switch n.typ {
+	case typeBoolean:
+		d.dst.WriteBool(c.vals.ints[i] != 0)
+	case typeInt32, typeInt64:
+		v := c.vals.ints[i]
+		switch n.conv {
+		case convDate:
+			d.time(date.Unix(v*86400, 0))
+		case convTimestamp:
+			switch n.unit {
+			case unitMillis:
+				d.time(date.UnixMicro(v * 1000))
+			case unitMicros:
+				d.time(date.UnixMicro(v))
+			default:
+				d.time(date.Unix(0, v))
+			}
+		case convDecimal:
+			var b [8]byte
+			binary.BigEndian.PutUint64(b[:], uint64(v))
+			d.decimal(b[:], n.exp)
+		case convUint:
+			if n.typ == typeInt32 {
+				d.dst.WriteUint(uint64(uint32(v)))
+			} else {
+				d.dst.WriteUint(uint64(v))
+			}
+		default:
+			d.dst.WriteInt(v)
+		}
+	case typeInt96:
+		// nanoseconds within the day
+		// followed by the Julian day
+		b := c.vals.bytes[i]
+		ns := int64(binary.LittleEndian.Uint64(b))
+		day := int64(binary.LittleEndian.Uint32(b[8:]))
+		d.time(date.Unix((day-julianUnixEpoch)*86400, ns))
+	case typeFloat, typeDouble:
+		d.dst.WriteFloat64(c.vals.floats[i])
+	default:
+		b := c.vals.bytes[i]
+		switch n.conv {
+		case convString:
+			d.dst.WriteStringBytes(b)
+		case convDecimal:
+			d.decimal(b, n.exp)
+		case convUUID:
+			var u uuid.UUID
+			copy(u[:], b)
+			d.dst.WriteString(u.String())
+		case convFloat16:
+			d.dst.WriteFloat64(float16(binary.LittleEndian.Uint16(b)))
+		default:
+			d.dst.WriteBlob(b)
+		}
+	}
+	return nil
+}
+
+// time writes a timestamp and records
+// it in the ranges for its path
+func (d *decoder) time(t date.Time) {
+	d.dst.WriteTime(t)
+	if d.ranges == nil || d.noindex > 0 || len(d.path) > maxIndexingDepth {
+		return
+	}
+	d.symbuf.Prepare(len(d.path))
+	for i := range d.path {
+		d.symbuf.Push(d.path[i])
+	}
+	d.ranges.AddTime(d.symbuf, t)
+}
+
+// float16 converts an IEEE 754 half-precision
+// floating-point number to a float64
+func float16(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exp := int(h>>10) & 0x1f
+	frac := float64(h & 0x3ff)
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(frac, -24)
+	case 0x1f:
+		if frac == 0 {
+			return math.Inf(int(sign))
+		}
+		return math.NaN()
+	}
+	return sign * math.Ldexp(frac+1024, exp-25)
+}
+
+// decimal writes a two's-complement big-endian
+// unscaled integer with the given scale; values with
+// a scale of zero that fit into 64 bits are written
+// as integers, and everything else as a float
+func (d *decoder) decimal(b []byte, scale int) {
+	if len(b) <= 8 {
+		var v int64
+		for i := range b {
+			v = v<<8 | int64(b[i])
+		}
+		if len(b) > 0 && len(b) < 8 {
+			// sign-extend
+			shift := 64 - 8*len(b)
+			v = v << shift >> shift
+		}
+		if scale == 0 {
+			d.dst.WriteInt(v)
+			return
+		}
+		if scale < len(pow10) && v > -(1<<53) && v < 1<<53 {
+			d.dst.WriteFloat64(float64(v) / pow10[scale])
+			return
+		}
+	}
+	x := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		// subtract 2^(8*len(b)) for negative values
+		x.Sub(x, new(big.Int).Lsh(big.NewInt(1), uint(8*len(b))))
+	}
+	if scale == 0 && x.IsInt64() {
+		d.dst.WriteInt(x.Int64())
+		return
+	}
+	f := new(big.Float).SetInt(x)
+	if scale > 0 {
+		div := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)
+		f.Quo(f, new(big.Float).SetInt(div))
+	}
+	v, _ := f.Float64()
+	d.dst.WriteFloat64(v)
+}
+
+// exactly representable powers of 10
+var pow10 = []float64{
+	1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10, 1e11,
+	1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18, 1e19, 1e20, 1e21, 1e22,
+}
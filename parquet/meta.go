@@ -0,0 +1,462 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package parquet
+
+import "fmt"
+
+// physical types
+const (
+	typeBoolean = iota
+	typeInt32
+	typeInt64
+	typeInt96
+	typeFloat
+	typeDouble
+	typeByteArray
+	typeFixedLenByteArray
+)
+
+// field repetition types
+const (
+	required = iota
+	optional
+	repeated
+)
+
+// converted types (the legacy logical types)
+const (
+	convertedNone = iota - 1
+	convertedUTF8
+	convertedMap
+	convertedMapKeyValue
+	convertedList
+	convertedEnum
+	convertedDecimal
+	convertedDate
+	convertedTimeMillis
+	convertedTimeMicros
+	convertedTimestampMillis
+	convertedTimestampMicros
+	convertedUint8
+	convertedUint16
+	convertedUint32
+	convertedUint64
+	convertedInt8
+	convertedInt16
+	convertedInt32
+	convertedInt64
+	convertedJSON
+	convertedBSON
+	convertedInterval
+)
+
+// logical types; these are the field IDs
+// of the members of the LogicalType union
+const (
+	logicalNone      = 0
+	logicalString    = 1
+	logicalMap       = 2
+	logicalList      = 3
+	logicalEnum      = 4
+	logicalDecimal   = 5
+	logicalDate      = 6
+	logicalTime      = 7
+	logicalTimestamp = 8
+	logicalInteger   = 10
+	logicalUnknown   = 11
+	logicalJSON      = 12
+	logicalBSON      = 13
+	logicalUUID      = 14
+	logicalFloat16   = 15
+)
+
+// time units; these are the field IDs
+// of the members of the TimeUnit union
+const (
+	unitMillis = 1
+	unitMicros = 2
+	unitNanos  = 3
+)
+
+// compression codecs
+const (
+	codecUncompressed = 0
+	codecSnappy       = 1
+	codecGzip         = 2
+	codecZstd         = 6
+)
+
+// page types
+const (
+	pageData       = 0
+	pageDictionary = 2
+	pageDataV2     = 3
+)
+
+// encodings
+const (
+	encPlain                = 0
+	encPlainDictionary      = 2
+	encRLE                  = 3
+	encBitPacked            = 4
+	encDeltaBinaryPacked    = 5
+	encDeltaLengthByteArray = 6
+	encDeltaByteArray       = 7
+	encRLEDictionary        = 8
+	encByteStreamSplit      = 9
+)
+
+type logicalType struct {
+	kind int16
+	// DECIMAL
+	scale, precision int32
+	// TIME and TIMESTAMP
+	unit int16
+	// INTEGER
+	bitWidth int8
+	signed   bool
+}
+
+type schemaElement struct {
+	typ         int32 // -1 for groups
+	typeLength  int32
+	repetition  int32
+	name        string
+	numChildren int32
+	converted   int32
+	scale       int32
+	precision   int32
+	logical     logicalType
+}
+
+type columnMeta struct {
+	typ        int32
+	codec      int32
+	numValues  int64
+	size       int64 // total compressed size
+	dataOffset int64
+	dictOffset int64
+}
+
+type rowGroup struct {
+	columns []columnMeta
+	numRows int64
+}
+
+type fileMeta struct {
+	schema    []schemaElement
+	numRows   int64
+	rowGroups []rowGroup
+}
+
+type dataPageHeader struct {
+	numValues int32
+	encoding  int32
+	// v2 only
+	defLen, repLen int32
+	compressed     bool
+}
+
+type pageHeader struct {
+	typ              int32
+	uncompressedSize int32
+	compressedSize   int32
+	data             dataPageHeader
+	dictValues       int32
+	dictEncoding     int32
+}
+
+func (t *thrift) fileMeta() (*fileMeta, error) {
+	m := &fileMeta{}
+	err := t.structure(func(id int16, typ byte) error {
+		var err error
+		switch id {
+		case 2:
+			var n int
+			n, typ, err = t.list(typ)
+			if err != nil {
+				return err
+			}
+			m.schema = make([]schemaElement, n)
+			for i := range m.schema {
+				if err = t.schemaElement(typ, &m.schema[i]); err != nil {
+					return err
+				}
+			}
+		case 3:
+			m.numRows, err = t.int(typ)
+		case 4:
+			var n int
+			n, typ, err = t.list(typ)
+			if err != nil {
+				return err
+			}
+			m.rowGroups = make([]rowGroup, n)
+			for i := range m.rowGroups {
+				if err = t.rowGroup(typ, &m.rowGroups[i]); err != nil {
+					return err
+				}
+			}
+		default:
+			err = t.skip(typ)
+		}
+		return err
+	})
+	return m, err
+}
+
+func (t *thrift) expect(typ, want byte) error {
+	if typ != want {
+		return t.corrupt("expected type %d; found %d", want, typ)
+	}
+	return nil
+}
+
+func (t *thrift) schemaElement(typ byte, s *schemaElement) error {
+	if err := t.expect(typ, tstruct); err != nil {
+		return err
+	}
+	s.typ = -1
+	s.converted = convertedNone
+	return t.structure(func(id int16, typ byte) error {
+		var err error
+		switch id {
+		case 1:
+			s.typ, err = t.int32(typ)
+		case 2:
+			s.typeLength, err = t.int32(typ)
+		case 3:
+			s.repetition, err = t.int32(typ)
+		case 4:
+			s.name, err = t.string(typ)
+		case 5:
+			s.numChildren, err = t.int32(typ)
+		case 6:
+			s.converted, err = t.int32(typ)
+		case 7:
+			s.scale, err = t.int32(typ)
+		case 8:
+			s.precision, err = t.int32(typ)
+		case 10:
+			err = t.logicalType(typ, &s.logical)
+		default:
+			err = t.skip(typ)
+		}
+		return err
+	})
+}
+
+func (t *thrift) logicalType(typ byte, l *logicalType) error {
+	if err := t.expect(typ, tstruct); err != nil {
+		return err
+	}
+	return t.structure(func(id int16, typ byte) error {
+		if typ != tstruct {
+			return t.skip(typ)
+		}
+		l.kind = id
+		switch id {
+		case logicalDecimal:
+			return t.structure(func(id int16, typ byte) error {
+				var err error
+				switch id {
+				case 1:
+					l.scale, err = t.int32(typ)
+				case 2:
+					l.precision, err = t.int32(typ)
+				default:
+					err = t.skip(typ)
+				}
+				return err
+			})
+		case logicalTime, logicalTimestamp:
+			return t.structure(func(id int16, typ byte) error {
+				if id != 2 || typ != tstruct {
+					return t.skip(typ)
+				}
+				return t.structure(func(id int16, typ byte) error {
+					l.unit = id
+					return t.skip(typ)
+				})
+			})
+		case logicalInteger:
+			return t.structure(func(id int16, typ byte) error {
+				var err error
+				switch id {
+				case 1:
+					var n int64
+					n, err = t.int(typ)
+					l.bitWidth = int8(n)
+				case 2:
+					l.signed, err = t.bool(typ)
+				default:
+					err = t.skip(typ)
+				}
+				return err
+			})
+		}
+		return t.skip(typ)
+	})
+}
+
+func (t *thrift) rowGroup(typ byte, g *rowGroup) error {
+	if err := t.expect(typ, tstruct); err != nil {
+		return err
+	}
+	return t.structure(func(id int16, typ byte) error {
+		var err error
+		switch id {
+		case 1:
+			var n int
+			n, typ, err = t.list(typ)
+			if err != nil {
+				return err
+			}
+			g.columns = make([]columnMeta, n)
+			for i := range g.columns {
+				if err = t.columnChunk(typ, &g.columns[i]); err != nil {
+					return err
+				}
+			}
+		case 3:
+			g.numRows, err = t.int(typ)
+		default:
+			err = t.skip(typ)
+		}
+		return err
+	})
+}
+
+func (t *thrift) columnChunk(typ byte, c *columnMeta) error {
+	if err := t.expect(typ, tstruct); err != nil {
+		return err
+	}
+	c.typ = -1
+	return t.structure(func(id int16, typ byte) error {
+		switch id {
+		case 1:
+			return fmt.Errorf("%w: column chunks in other files", ErrUnsupported)
+		case 3:
+			if err := t.expect(typ, tstruct); err != nil {
+				return err
+			}
+			return t.structure(func(id int16, typ byte) error {
+				var err error
+				switch id {
+				case 1:
+					c.typ, err = t.int32(typ)
+				case 4:
+					c.codec, err = t.int32(typ)
+				case 5:
+					c.numValues, err = t.int(typ)
+				case 7:
+					c.size, err = t.int(typ)
+				case 9:
+					c.dataOffset, err = t.int(typ)
+				case 11:
+					c.dictOffset, err = t.int(typ)
+				default:
+					err = t.skip(typ)
+				}
+				return err
+			})
+		}
+		return t.skip(typ)
+	})
+}
+
+func (t *thrift) pageHeader() (*pageHeader, error) {
+	h := &pageHeader{}
+	err := t.structure(func(id int16, typ byte) error {
+		var err error
+		switch id {
+		case 1:
+			h.typ, err = t.int32(typ)
+		case 2:
+			h.uncompressedSize, err = t.int32(typ)
+		case 3:
+			h.compressedSize, err = t.int32(typ)
+		case 5:
+			err = t.dataPageHeader(typ, &h.data)
+		case 7:
+			if err = t.expect(typ, tstruct); err != nil {
+				return err
+			}
+			err = t.structure(func(id int16, typ byte) error {
+				var err error
+				switch id {
+				case 1:
+					h.dictValues, err = t.int32(typ)
+				case 2:
+					h.dictEncoding, err = t.int32(typ)
+				default:
+					err = t.skip(typ)
+				}
+				return err
+			})
+		case 8:
+			err = t.dataPageHeaderV2(typ, &h.data)
+		default:
+			err = t.skip(typ)
+		}
+		return err
+	})
+	return h, err
+}
+
+func (t *thrift) dataPageHeader(typ byte, d *dataPageHeader) error {
+	if err := t.expect(typ, tstruct); err != nil {
+		return err
+	}
+	return t.structure(func(id int16, typ byte) error {
+		var err error
+		switch id {
+		case 1:
+			d.numValues, err = t.int32(typ)
+		case 2:
+			d.encoding, err = t.int32(typ)
+		default:
+			// the level encodings are
+			// always RLE in practice
+			err = t.skip(typ)
+		}
+		return err
+	})
+}
+
+func (t *thrift) dataPageHeaderV2(typ byte, d *dataPageHeader) error {
+	if err := t.expect(typ, tstruct); err != nil {
+		return err
+	}
+	d.compressed = true
+	return t.structure(func(id int16, typ byte) error {
+		var err error
+		switch id {
+		case 1:
+			d.numValues, err = t.int32(typ)
+		case 4:
+			d.encoding, err = t.int32(typ)
+		case 5:
+			d.defLen, err = t.int32(typ)
+		case 6:
+			d.repLen, err = t.int32(typ)
+		case 7:
+			d.compressed, err = t.bool(typ)
+		default:
+			err = t.skip(typ)
+		}
+		return err
+	})
+}
@@ -0,0 +1,266 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package parquet
+
+import (
+	"fmt"
+
+	"github.com/SnellerInc/sneller/ion"
+)
+
+// maxDepth is the maximum nesting depth of the schema
+const maxDepth = 512
+
+// node kinds
+const (
+	kindLeaf   = iota
+	kindStruct // group
+	kindList   // LIST group
+	kindMap    // MAP group with string keys
+	kindPairs  // MAP group with other keys
+)
+
+// leaf conversions
+const (
+	convNone = iota
+	convString
+	convDecimal
+	convDate
+	convTimestamp
+	convUint
+	convUUID
+	convFloat16
+)
+
+// node is a node of the schema tree
+type node struct {
+	schemaElement
+	path     string
+	sym      ion.Symbol
+	children []*node
+	// def and rep are the maximum definition
+	// and repetition levels of the node
+	def, rep int16
+	// first and last are the range of
+	// leaf columns below the node
+	first, last int
+
+	kind int
+	// list is the repeated node of LIST and MAP
+	// groups and elem is the node of the list
+	// elements, which may be list itself
+	list, elem *node
+	// key and value are the children of list for MAPs
+	key, value *node
+
+	// conv and unit determine how the values
+	// of leaves are converted, and exp is the
+	// scale of decimals
+	conv int
+	unit int16
+	exp  int
+}
+
+type builder struct {
+	schema []schemaElement
+	st     *ion.Symtab
+	leaves []*node
+}
+
+func invalid(f string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidSchema, fmt.Sprintf(f, args...))
+}
+
+// build builds the schema tree from the flattened
+// schema, interning the names of the fields,
+// and returns the root and the leaf nodes
+func build(schema []schemaElement, st *ion.Symtab) (*node, []*node, error) {
+	if len(schema) == 0 || schema[0].numChildren <= 0 {
+		return nil, nil, invalid("no columns")
+	}
+	b := &builder{schema: schema, st: st}
+	root, err := b.node(nil, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(b.schema) != 0 {
+		return nil, nil, invalid("%d trailing schema elements", len(b.schema))
+	}
+	return root, b.leaves, nil
+}
+
+func (b *builder) node(parent *node, depth int) (*node, error) {
+	if depth > maxDepth {
+		return nil, invalid("schema nested too deeply")
+	}
+	if len(b.schema) == 0 {
+		return nil, invalid("missing schema elements")
+	}
+	n := &node{schemaElement: b.schema[0]}
+	b.schema = b.schema[1:]
+	if parent != nil {
+		n.def, n.rep = parent.def, parent.rep
+		switch n.repetition {
+		case required:
+		case optional:
+			n.def++
+		case repeated:
+			n.def++
+			n.rep++
+		default:
+			return nil, invalid("%q: unknown repetition %d", n.name, n.repetition)
+		}
+		n.path = n.name
+		if parent.path != "" {
+			n.path = parent.path + "." + n.name
+		}
+		n.sym = b.st.Intern(n.name)
+	}
+	n.first = len(b.leaves)
+	if n.numChildren <= 0 {
+		if n.typ < typeBoolean || n.typ > typeFixedLenByteArray {
+			return nil, invalid("%q: unknown type %d", n.path, n.typ)
+		}
+		if n.typ == typeFixedLenByteArray && n.typeLength <= 0 {
+			return nil, invalid("%q: invalid length %d", n.path, n.typeLength)
+		}
+		n.kind = kindLeaf
+		n.leaf()
+		b.leaves = append(b.leaves, n)
+		n.last = len(b.leaves)
+		return n, nil
+	}
+	if int(n.numChildren) > len(b.schema) {
+		return nil, invalid("%q: %d children out of range", n.path, n.numChildren)
+	}
+	n.children = make([]*node, n.numChildren)
+	for i := range n.children {
+		c, err := b.node(n, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		n.children[i] = c
+	}
+	n.last = len(b.leaves)
+	n.group()
+	return n, nil
+}
+
+// group determines how a group is converted
+func (n *node) group() {
+	n.kind = kindStruct
+	if len(n.children) != 1 || n.children[0].repetition != repeated {
+		return
+	}
+	r := n.children[0]
+	switch {
+	case n.converted == convertedList || n.logical.kind == logicalList:
+		n.kind = kindList
+		n.list = r
+		n.elem = r
+		// the repeated node is a wrapper for the element
+		// unless it could be the element itself (see the
+		// backward-compatibility rules for LIST)
+		if len(r.children) == 1 && r.name != "array" && r.name != n.name+"_tuple" {
+			n.elem = r.children[0]
+		}
+	case n.converted == convertedMap || n.converted == convertedMapKeyValue || n.logical.kind == logicalMap:
+		if len(r.children) == 0 || len(r.children) > 2 {
+			return
+		}
+		n.list = r
+		n.key = r.children[0]
+		if len(r.children) == 1 {
+			// a set of keys
+			n.kind = kindList
+			n.elem = n.key
+			return
+		}
+		n.value = r.children[1]
+		n.kind = kindPairs
+		if n.key.kind == kindLeaf && n.key.repetition == required && n.key.conv == convString {
+			n.kind = kindMap
+		}
+	}
+}
+
+// leaf determines how the values of a leaf are converted
+func (n *node) leaf() {
+	l := &n.logical
+	switch l.kind {
+	case logicalString, logicalEnum, logicalJSON:
+		n.conv = convString
+	case logicalDecimal:
+		n.conv = convDecimal
+		n.exp = int(l.scale)
+	case logicalDate:
+		n.conv = convDate
+	case logicalTimestamp:
+		n.conv = convTimestamp
+		n.unit = l.unit
+	case logicalInteger:
+		if !l.signed {
+			n.conv = convUint
+		}
+	case logicalUUID:
+		n.conv = convUUID
+	case logicalFloat16:
+		n.conv = convFloat16
+	case logicalNone:
+		switch n.converted {
+		case convertedUTF8, convertedEnum, convertedJSON:
+			n.conv = convString
+		case convertedDecimal:
+			n.conv = convDecimal
+			n.exp = int(n.scale)
+		case convertedDate:
+			n.conv = convDate
+		case convertedTimestampMillis:
+			n.conv = convTimestamp
+			n.unit = unitMillis
+		case convertedTimestampMicros:
+			n.conv = convTimestamp
+			n.unit = unitMicros
+		case convertedUint8, convertedUint16, convertedUint32, convertedUint64:
+			n.conv = convUint
+		}
+	}
+	// ignore annotations that don't
+	// apply to the physical type
+	ok := false
+	switch n.conv {
+	case convNone:
+		ok = true
+	case convString:
+		ok = n.typ == typeByteArray || n.typ == typeFixedLenByteArray
+	case convDecimal:
+		ok = n.typ == typeInt32 || n.typ == typeInt64 ||
+			n.typ == typeByteArray || n.typ == typeFixedLenByteArray
+		ok = ok && n.exp >= 0
+	case convDate:
+		ok = n.typ == typeInt32
+	case convTimestamp:
+		ok = n.typ == typeInt64 && n.unit >= unitMillis && n.unit <= unitNanos
+	case convUint:
+		ok = n.typ == typeInt32 || n.typ == typeInt64
+	case convUUID:
+		ok = n.typ == typeFixedLenByteArray && n.typeLength == 16
+	case convFloat16:
+		ok = n.typ == typeFixedLenByteArray && n.typeLength == 2
+	}
+	if !ok {
+		n.conv = convNone
+	}
+}
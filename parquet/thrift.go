@@ -0,0 +1,269 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package parquet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// thrift compact protocol types
+const (
+	ttrue   = 1
+	tfalse  = 2
+	tbyte   = 3
+	ti16    = 4
+	ti32    = 5
+	ti64    = 6
+	tdouble = 7
+	tbinary = 8
+	tlist   = 9
+	tset    = 10
+	tmap    = 11
+	tstruct = 12
+)
+
+// maxThriftDepth bounds the nesting of
+// structures that are skipped
+const maxThriftDepth = 64
+
+// thrift decodes the thrift compact protocol,
+// which is used for the file metadata
+// and the page headers
+type thrift struct {
+	buf []byte
+}
+
+func (t *thrift) corrupt(f string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrCorrupt, fmt.Sprintf(f, args...))
+}
+
+func (t *thrift) byte() (byte, error) {
+	if len(t.buf) == 0 {
+		return 0, t.corrupt("unexpected end of metadata")
+	}
+	b := t.buf[0]
+	t.buf = t.buf[1:]
+	return b, nil
+}
+
+func (t *thrift) uvarint() (uint64, error) {
+	u, n := binary.Uvarint(t.buf)
+	if n <= 0 {
+		return 0, t.corrupt("invalid varint")
+	}
+	t.buf = t.buf[n:]
+	return u, nil
+}
+
+// varint decodes a zig-zag encoded integer
+func (t *thrift) varint() (int64, error) {
+	u, err := t.uvarint()
+	return int64(u>>1) ^ -int64(u&1), err
+}
+
+// int decodes an integer field of type typ
+func (t *thrift) int(typ byte) (int64, error) {
+	switch typ {
+	case tbyte:
+		b, err := t.byte()
+		return int64(int8(b)), err
+	case ti16, ti32, ti64:
+		return t.varint()
+	}
+	return 0, t.corrupt("expected an integer; found type %d", typ)
+}
+
+// int32 is like int, but it also checks
+// that the value fits into 32 bits
+func (t *thrift) int32(typ byte) (int32, error) {
+	n, err := t.int(typ)
+	if err != nil {
+		return 0, err
+	}
+	if n < math.MinInt32 || n > math.MaxInt32 {
+		return 0, t.corrupt("integer %d out of range", n)
+	}
+	return int32(n), nil
+}
+
+// bool decodes a boolean field of type typ;
+// the value of boolean fields is part of the type
+func (t *thrift) bool(typ byte) (bool, error) {
+	switch typ {
+	case ttrue:
+		return true, nil
+	case tfalse:
+		return false, nil
+	}
+	return false, t.corrupt("expected a boolean; found type %d", typ)
+}
+
+func (t *thrift) binary(typ byte) ([]byte, error) {
+	if typ != tbinary {
+		return nil, t.corrupt("expected binary; found type %d", typ)
+	}
+	n, err := t.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(t.buf)) {
+		return nil, t.corrupt("length %d out of range", n)
+	}
+	b := t.buf[:n]
+	t.buf = t.buf[n:]
+	return b, nil
+}
+
+func (t *thrift) string(typ byte) (string, error) {
+	b, err := t.binary(typ)
+	return string(b), err
+}
+
+// list decodes the header of a list of type
+// typ and returns the number of elements
+// and their type
+func (t *thrift) list(typ byte) (int, byte, error) {
+	if typ != tlist && typ != tset {
+		return 0, 0, t.corrupt("expected a list; found type %d", typ)
+	}
+	b, err := t.byte()
+	if err != nil {
+		return 0, 0, err
+	}
+	n := uint64(b >> 4)
+	if n == 15 {
+		n, err = t.uvarint()
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	// every element occupies at least one byte
+	if n > uint64(len(t.buf)) {
+		return 0, 0, t.corrupt("list length %d out of range", n)
+	}
+	return int(n), b & 0xf, nil
+}
+
+// structure decodes the fields of a structure,
+// calling fn for each of them; fn must either
+// consume the value of the field or call t.skip
+func (t *thrift) structure(fn func(id int16, typ byte) error) error {
+	id := int16(0)
+	for {
+		b, err := t.byte()
+		if err != nil {
+			return err
+		}
+		if b == 0 {
+			return nil
+		}
+		typ := b & 0xf
+		if delta := int16(b >> 4); delta != 0 {
+			id += delta
+		} else {
+			n, err := t.varint()
+			if err != nil {
+				return err
+			}
+			id = int16(n)
+		}
+		if err := fn(id, typ); err != nil {
+			return err
+		}
+	}
+}
+
+// element returns the type with which
+// elements of type typ in lists and maps
+// are decoded; booleans occupy a byte there
+// rather than being part of the field type
+func element(typ byte) byte {
+	if typ == ttrue || typ == tfalse {
+		return tbyte
+	}
+	return typ
+}
+
+// skip skips a value of type typ
+func (t *thrift) skip(typ byte) error {
+	return t.skipn(typ, 0)
+}
+
+func (t *thrift) skipn(typ byte, depth int) error {
+	if depth > maxThriftDepth {
+		return t.corrupt("structures nested too deeply")
+	}
+	switch typ {
+	case ttrue, tfalse:
+		return nil
+	case tbyte:
+		_, err := t.byte()
+		return err
+	case ti16, ti32, ti64:
+		_, err := t.uvarint()
+		return err
+	case tdouble:
+		if len(t.buf) < 8 {
+			return t.corrupt("unexpected end of metadata")
+		}
+		t.buf = t.buf[8:]
+		return nil
+	case tbinary:
+		_, err := t.binary(typ)
+		return err
+	case tlist, tset:
+		n, et, err := t.list(typ)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if err := t.skipn(element(et), depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case tmap:
+		n, err := t.uvarint()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		if n > uint64(len(t.buf)) {
+			return t.corrupt("map length %d out of range", n)
+		}
+		kv, err := t.byte()
+		if err != nil {
+			return err
+		}
+		for i := uint64(0); i < n; i++ {
+			if err := t.skipn(element(kv>>4), depth+1); err != nil {
+				return err
+			}
+			if err := t.skipn(element(kv&0xf), depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case tstruct:
+		return t.structure(func(_ int16, typ byte) error {
+			return t.skipn(typ, depth+1)
+		})
+	}
+	return t.corrupt("unknown type %d", typ)
+}
@@ -0,0 +1,242 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package plan
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/SnellerInc/sneller/ion"
+	"github.com/SnellerInc/sneller/vm"
+)
+
+// Probe is an op that passes the rows
+// produced by its input through unchanged
+// while collecting statistics about them
+// into ExecParams.Stats.Ops.
+//
+// Probes are inserted after each op of
+// a plan executed by EXPLAIN ANALYZE.
+// Since they are encoded along with the rest
+// of the plan, the statistics collected
+// by remote peers are returned to (and merged by)
+// the peer that executed EXPLAIN ANALYZE.
+type Probe struct {
+	Nonterminal
+	// ID identifies the probe within the plan.
+	ID int
+}
+
+func (p *Probe) String() string { return fmt.Sprintf("PROBE %d", p.ID) }
+
+func (p *Probe) wrap(dst vm.QuerySink, ep *ExecParams) (int, vm.QuerySink, error) {
+	ps := &probeSink{dst: dst, stats: &ep.Stats}
+	ps.op.ID = p.ID
+	return p.From.wrap(ps, ep)
+}
+
+func (p *Probe) encode(dst *ion.Buffer, st *ion.Symtab) error {
+	dst.BeginStruct(-1)
+	settype("probe", dst, st)
+	dst.BeginField(st.Intern("id"))
+	dst.WriteInt(int64(p.ID))
+	dst.EndStruct()
+	return nil
+}
+
+func (p *Probe) setfield(d Decoder, name string, st *ion.Symtab, buf []byte) error {
+	switch name {
+	case "id":
+		i, _, err := ion.ReadInt(buf)
+		if err != nil {
+			return err
+		}
+		p.ID = int(i)
+	default:
+		return errUnexpectedField
+	}
+	return nil
+}
+
+// probeSink counts the rows written into dst
+// and measures the time spent in dst
+type probeSink struct {
+	dst   vm.QuerySink
+	stats *ExecStats
+	op    OpStats
+}
+
+func (s *probeSink) elapsed(start time.Time) {
+	atomic.AddInt64((*int64)(&s.op.Time), int64(time.Since(start)))
+}
+
+func (s *probeSink) Open() (io.WriteCloser, error) {
+	defer s.elapsed(time.Now())
+	w, err := s.dst.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &probeWriter{parent: s, dst: w}, nil
+}
+
+func (s *probeSink) Close() error {
+	// the memory used by the sink is
+	// highest right before it is closed
+	if mu, ok := s.dst.(vm.MemoryUser); ok {
+		s.op.Memory = mu.Memory()
+	}
+	start := time.Now()
+	err := s.dst.Close()
+	s.elapsed(start)
+	s.stats.addOps([]OpStats{{
+		ID:     s.op.ID,
+		Rows:   atomic.LoadInt64(&s.op.Rows),
+		Bytes:  atomic.LoadInt64(&s.op.Bytes),
+		Time:   time.Duration(atomic.LoadInt64((*int64)(&s.op.Time))),
+		Memory: s.op.Memory,
+	}})
+	return err
+}
+
+type probeWriter struct {
+	parent *probeSink
+	dst    io.WriteCloser
+}
+
+func (w *probeWriter) Write(p []byte) (int, error) {
+	atomic.AddInt64(&w.parent.op.Rows, countRows(p))
+	atomic.AddInt64(&w.parent.op.Bytes, int64(len(p)))
+	defer w.parent.elapsed(time.Now())
+	return w.dst.Write(p)
+}
+
+func (w *probeWriter) Close() error {
+	defer w.parent.elapsed(time.Now())
+	return w.dst.Close()
+}
+
+// EndSegment implements vm.EndSegmentWriter
+func (w *probeWriter) EndSegment() {
+	vm.HintEndSegment(w.dst)
+}
+
+// countRows counts the structures in
+// a chunk of ion data
+func countRows(p []byte) int64 {
+	n := int64(0)
+	for len(p) > 0 {
+		if ion.IsBVM(p) {
+			p = p[4:]
+			continue
+		}
+		size := ion.SizeOf(p)
+		if size <= 0 || size > len(p) {
+			break
+		}
+		if ion.TypeOf(p) == ion.StructType {
+			n++
+		}
+		p = p[size:]
+	}
+	return n
+}
+
+// instrument inserts a Probe after
+// every op in the tree
+func (t *Tree) instrument() {
+	id := 0
+	t.Root.instrument(&id)
+}
+
+func (n *Node) instrument(id *int) {
+	for i := range n.Children {
+		n.Children[i].instrument(id)
+	}
+	n.Op = probe(n.Op, id)
+}
+
+func probe(op Op, id *int) Op {
+	p := &Probe{ID: *id}
+	*id++
+	if in := op.input(); in != nil {
+		op.setinput(probe(in, id))
+	}
+	p.From = op
+	return p
+}
+
+// annotate returns the description of the
+// statistics collected for the op
+// that is the input of p
+func (e *ExecStats) annotate(p *Probe) string {
+	out := e.Op(p.ID)
+	if out == nil {
+		return " (not executed)"
+	}
+	var in *OpStats
+	if p, ok := p.From.input().(*Probe); ok {
+		in = e.Op(p.ID)
+	}
+	var b strings.Builder
+	b.WriteString(" (")
+	if in != nil {
+		fmt.Fprintf(&b, "rows in: %d, ", in.Rows)
+	}
+	fmt.Fprintf(&b, "rows out: %d, bytes out: %d", out.Rows, out.Bytes)
+	if in != nil {
+		// the time spent consuming the input
+		// includes the time spent consuming
+		// the output, which isn't part of this op
+		self := in.Time - out.Time
+		if self < 0 {
+			self = 0
+		}
+		fmt.Fprintf(&b, ", time: %s", self.Round(time.Microsecond))
+		if in.Memory > 0 {
+			fmt.Fprintf(&b, ", memory: %d", in.Memory)
+		}
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+// analyze executes e.Tree with a Probe after
+// every op and returns the collected statistics
+func (e *Explain) analyze(ep *ExecParams) (*ExecStats, time.Duration, error) {
+	e.Tree.instrument()
+	subep := &ExecParams{
+		Output:   io.Discard,
+		Rewrite:  ep.Rewrite,
+		Parallel: ep.Parallel,
+		Context:  ep.Context,
+		Limits:   ep.Limits,
+		budget:   ep.budget,
+	}
+	start := time.Now()
+	err := (&LocalTransport{}).Exec(e.Tree, subep)
+	elapsed := time.Since(start)
+	// the rest of the statistics are
+	// accounted to the EXPLAIN query
+	stats := &ExecStats{Ops: subep.Stats.Ops}
+	subep.Stats.Ops = nil
+	ep.Stats.atomicAdd(&subep.Stats)
+	if err != nil {
+		return nil, 0, err
+	}
+	return stats, elapsed, nil
+}
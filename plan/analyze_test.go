@@ -0,0 +1,201 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package plan
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SnellerInc/sneller/expr"
+	"github.com/SnellerInc/sneller/expr/partiql"
+	"github.com/SnellerInc/sneller/ion"
+)
+
+// remoteSplitter splits each table into
+// two copies that are each executed by a
+// Client connected to a separate server
+type remoteSplitter struct {
+	t   *testing.T
+	env *testenv
+}
+
+func (r *remoteSplitter) Split(tbl expr.Node, th TableHandle) (Subtables, error) {
+	sub := make(SubtableList, 2)
+	for i := range sub {
+		local, remote := net.Pipe()
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Serve(remote, r.env)
+		}()
+		c := &Client{Pipe: local}
+		r.t.Cleanup(func() {
+			c.Close()
+			wg.Wait()
+		})
+		sub[i] = Subtable{
+			Transport: c,
+			Table:     &expr.Table{Binding: expr.Bind(tbl, "")},
+			Handle:    th,
+		}
+	}
+	return sub, nil
+}
+
+func TestExplainAnalyze(t *testing.T) {
+	env := &testenv{t: t}
+	tcs := []struct {
+		query string
+		split Splitter
+		lines []string // regular expressions matching plan lines
+	}{
+		{
+			query: `EXPLAIN ANALYZE SELECT COUNT(*) FROM 'parking.10n' WHERE Fine > 100`,
+			lines: []string{
+				`^'parking.10n' \(rows out: 1023, bytes out: \d+\)$`,
+				`^WHERE Fine > 100 \(rows in: 1023, rows out: 35, bytes out: \d+, time: .*\)$`,
+				`^COUNT\(\*\) AS count \(rows in: 35, rows out: 1, bytes out: \d+, time: .*\)$`,
+			},
+		},
+		{
+			query: `EXPLAIN ANALYZE AS list SELECT Make, COUNT(*) FROM 'parking.10n' GROUP BY Make ORDER BY COUNT(*) DESC LIMIT 3`,
+			lines: []string{
+				`^'parking.10n' \(rows out: 1023, bytes out: \d+\)$`,
+				`^HASH AGGREGATE .* GROUP BY Make .* \(rows in: 1023, rows out: 3, bytes out: \d+, time: .*, memory: \d+\)$`,
+			},
+		},
+		{
+			// the statistics from both remote
+			// peers should be merged
+			query: `EXPLAIN ANALYZE SELECT COUNT(*) FROM 'parking.10n' WHERE Fine > 100`,
+			split: &remoteSplitter{t: t, env: env},
+			lines: []string{
+				`^'parking.10n' \(rows out: 2046, bytes out: \d+\)$`,
+				`^WHERE Fine > 100 \(rows in: 2046, rows out: 70, bytes out: \d+, time: .*\)$`,
+				`^COUNT\(\*\) AS \$_2_0 \(rows in: 70, rows out: 2, bytes out: \d+, time: .*\)$`,
+				`^UNION MAP .* \(rows in: 2, rows out: 2, bytes out: \d+, time: .*\)$`,
+				`^AGGREGATE SUM_COUNT\(\$_2_0\) AS "count" \(rows in: 2, rows out: 1, bytes out: \d+, time: .*\)$`,
+			},
+		},
+	}
+	for i := range tcs {
+		q, err := partiql.Parse([]byte(tcs[i].query))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tree *Tree
+		if tcs[i].split != nil {
+			tree, err = NewSplit(q, env, tcs[i].split)
+		} else {
+			tree, err = New(q, env)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tcs[i].split == nil {
+			testPlanSerialize(t, tree, env)
+		}
+		var out bytes.Buffer
+		var stat ExecStats
+		err = Exec(tree, &out, &stat)
+		if err != nil {
+			t.Fatalf("%s: %s", tcs[i].query, err)
+		}
+		if stat.BytesScanned == 0 {
+			t.Errorf("%s: no bytes scanned", tcs[i].query)
+		}
+		if len(stat.Ops) != 0 {
+			t.Errorf("%s: unexpected op statistics in the query statistics", tcs[i].query)
+		}
+		var st ion.Symtab
+		d, _, err := ion.ReadDatum(&st, out.Bytes()[4:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, _ := d.Struct()
+		var lines []string
+		if f, ok := s.FieldByName("plan"); ok {
+			text, _ := f.Value.String()
+			lines = regexp.MustCompile("\n").Split(text, -1)
+		} else if f, ok := s.FieldByName("plan-lines"); ok {
+			lst, _ := f.Value.List()
+			lst.Each(func(d ion.Datum) bool {
+				s, _ := d.String()
+				lines = append(lines, s)
+				return true
+			})
+		}
+		if f, ok := s.FieldByName("elapsed"); !ok {
+			t.Errorf("%s: missing elapsed", tcs[i].query)
+		} else if str, _ := f.Value.String(); str == "" {
+			t.Errorf("%s: empty elapsed", tcs[i].query)
+		}
+	outer:
+		for _, want := range tcs[i].lines {
+			re := regexp.MustCompile(want)
+			for _, line := range lines {
+				if re.MatchString(line) {
+					continue outer
+				}
+			}
+			t.Errorf("%s: no line matches %q", tcs[i].query, want)
+			for _, line := range lines {
+				t.Log(line)
+			}
+		}
+	}
+}
+
+func TestOpStatsEncoding(t *testing.T) {
+	stats := ExecStats{
+		BytesScanned: 100,
+		Ops: []OpStats{
+			{ID: 0, Rows: 1, Bytes: 100, Time: time.Millisecond},
+			{ID: 2, Rows: 10, Bytes: 1000, Time: time.Second, Memory: 4096},
+		},
+	}
+	var buf ion.Buffer
+	stats.Marshal(&buf)
+	var out ExecStats
+	if err := out.UnmarshalBinary(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&stats, &out) {
+		t.Errorf("got %#v", &out)
+	}
+
+	// merging should sum the statistics
+	// with the same ID and keep them sorted
+	out.atomicAdd(&ExecStats{
+		Ops: []OpStats{
+			{ID: 1, Rows: 5},
+			{ID: 2, Rows: 1, Bytes: 1, Time: 1, Memory: 1},
+		},
+	})
+	want := []OpStats{
+		{ID: 0, Rows: 1, Bytes: 100, Time: time.Millisecond},
+		{ID: 1, Rows: 5},
+		{ID: 2, Rows: 11, Bytes: 1001, Time: time.Second + 1, Memory: 4097},
+	}
+	if !reflect.DeepEqual(out.Ops, want) {
+		t.Errorf("got %#v", out.Ops)
+	}
+}
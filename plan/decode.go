@@ -261,6 +261,8 @@ func empty(name string) Op {
 		return &UnpivotAtDistinct{}
 	case "explain":
 		return &Explain{}
+	case "probe":
+		return &Probe{}
 	}
 	return nil
 }
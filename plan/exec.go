@@ -181,8 +181,9 @@ func (e *executor) run() error {
 }
 
 func (e *executor) runtask(t *task) error {
-	err := t.input.WriteChunks(t.sink, e.subp)
-	err2 := t.sink.Close()
+	sink := e.ep.limit(t.sink)
+	err := t.input.WriteChunks(sink, e.subp)
+	err2 := sink.Close()
 	if err == nil {
 		err = err2
 	}
@@ -26,6 +26,7 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
 	"sync"
@@ -1576,7 +1577,7 @@ func testRemoteEquivalent(t *testing.T, tree *Tree,
 	if remoteerr != nil {
 		t.Errorf("remote error: %s", remoteerr)
 	}
-	if ep.Stats != *wantstat {
+	if !reflect.DeepEqual(&ep.Stats, wantstat) {
 		t.Errorf("got stats %#v", &ep.Stats)
 		t.Errorf("wanted stats %#v", wantstat)
 	}
@@ -1653,7 +1654,7 @@ func testSplitEquivalent(t *testing.T, text string, e *testenv, expected []strin
 	// inputs across union maps, so stats for
 	// split queries are not expected to match the
 	// original query
-	if stat != *wantstat {
+	if !reflect.DeepEqual(&stat, wantstat) {
 		t.Logf("got stats %#v", &stat)
 		t.Logf("wanted stats %#v", wantstat)
 	}
@@ -1872,3 +1873,55 @@ func dates(min, max string) [2]date.Time {
 	}
 	return [2]date.Time{dmin, dmax}
 }
+
+func TestPrepared(t *testing.T) {
+	env := &testenv{t: t}
+	q, err := partiql.Parse([]byte(`select Make, COUNT(*) from 'parking.10n' where Make <> $make and Color = $color group by Make order by Make`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Prepare(q, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.New(nil, env); err == nil {
+		t.Fatal("executed a prepared statement without binding its parameters")
+	}
+	binds := []*expr.Bindings{{
+		Named: map[string]expr.Constant{"make": expr.String("TOYT"), "color": expr.String("BK")},
+	}, {
+		Named: map[string]expr.Constant{"make": expr.String("NISS"), "color": expr.String("WH")},
+	}}
+	exec := func(tree *Tree) []byte {
+		var dst bytes.Buffer
+		var stat ExecStats
+		if err := Exec(tree, &dst, &stat); err != nil {
+			t.Fatal(err)
+		}
+		return dst.Bytes()
+	}
+	for _, b := range binds {
+		bq, err := q.Bind(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := New(bq, env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := p.New(b, env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g, w := got.String(), want.String(); g != w {
+			t.Errorf("got plan:\n%s\nwant:\n%s", g, w)
+		}
+		g, w := exec(got), exec(want)
+		if rowcount(t, w) == 0 {
+			t.Fatal("no rows")
+		}
+		if !bytes.Equal(g, w) {
+			t.Errorf("results differ: %d bytes vs %d bytes", len(g), len(w))
+		}
+	}
+}
@@ -22,11 +22,15 @@ import (
 // Graphviz dumps the plan 't'
 // to 'dst' as dot(1)-compatible text.
 func Graphviz(t *Tree, dst io.Writer) error {
+	return graphviz(t, dst, nil)
+}
+
+func graphviz(t *Tree, dst io.Writer, ann annotator) error {
 	_, err := io.WriteString(dst, "digraph plan {\n")
 	if err != nil {
 		return err
 	}
-	_, _, err = gv(&t.Root, dst, 0, 0)
+	_, _, err = gv(&t.Root, dst, 0, 0, ann)
 	if err != nil {
 		return err
 	}
@@ -34,14 +38,22 @@ func Graphviz(t *Tree, dst io.Writer) error {
 	return err
 }
 
-func gv(n *Node, dst io.Writer, tid, oid int) (int, int, error) {
+func gv(n *Node, dst io.Writer, tid, oid int, ann annotator) (int, int, error) {
 	_, err := fmt.Fprintf(dst, "subgraph cluster_%d {\n", tid)
 	if err != nil {
 		return tid, oid, err
 	}
 	var prev Op
 	for o := n.Op; o != nil; o = o.input() {
-		fmt.Fprintf(dst, "n%d [label=%q];\n", oid, o.String())
+		label := o.String()
+		if p, ok := o.(*Probe); ok {
+			o = p.From
+			label = o.String()
+			if ann != nil {
+				label += ann(p)
+			}
+		}
+		fmt.Fprintf(dst, "n%d [label=%q];\n", oid, label)
 		if prev != nil {
 			fmt.Fprintf(dst, "n%d -> n%d;\n", oid, oid-1)
 		}
@@ -64,7 +76,7 @@ func gv(n *Node, dst io.Writer, tid, oid int) (int, int, error) {
 	self := oid - 1 // id of this Tree's terminal
 	for i := range n.Children {
 		start := oid // id of last op in child
-		tid, oid, err = gv(n.Children[i], dst, tid, oid)
+		tid, oid, err = gv(n.Children[i], dst, tid, oid, ann)
 		if err != nil {
 			return tid, oid, err
 		}
@@ -0,0 +1,351 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package plan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SnellerInc/sneller/ion"
+	"github.com/SnellerInc/sneller/vm"
+)
+
+// Limits are limits on the resources that
+// the execution of a query may consume.
+// The zero value of Limits imposes no limits.
+//
+// Limits are enforced while the query executes:
+// once a limit has been exceeded, the inputs of
+// the query stop producing data and the query
+// fails with a *LimitError. Remote transports
+// pass the remaining limits along with the
+// sub-queries that they execute.
+type Limits struct {
+	// Timeout, if non-zero, is the maximum
+	// amount of time the query may execute.
+	Timeout time.Duration
+	// MaxScan, if non-zero, is the maximum
+	// number of bytes the query may scan.
+	MaxScan int64
+}
+
+// Encode encodes l to dst using the
+// provided symbol table.
+func (l *Limits) Encode(dst *ion.Buffer, st *ion.Symtab) {
+	dst.BeginStruct(-1)
+	if l.Timeout != 0 {
+		dst.BeginField(st.Intern("timeout"))
+		dst.WriteInt(int64(l.Timeout))
+	}
+	if l.MaxScan != 0 {
+		dst.BeginField(st.Intern("max_scan"))
+		dst.WriteInt(l.MaxScan)
+	}
+	dst.EndStruct()
+}
+
+// Decode decodes limits produced by Encode.
+func (l *Limits) Decode(buf []byte, st *ion.Symtab) error {
+	*l = Limits{}
+	_, err := ion.UnpackStruct(st, buf, func(name string, field []byte) error {
+		i, _, err := ion.ReadInt(field)
+		if err != nil {
+			return err
+		}
+		switch name {
+		case "timeout":
+			l.Timeout = time.Duration(i)
+		case "max_scan":
+			l.MaxScan = i
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("plan.Limits.Decode: %w", err)
+	}
+	return nil
+}
+
+// LimitError is the error returned when the
+// execution of a query is aborted because
+// it exceeded one of its Limits.
+type LimitError struct {
+	// Timeout or MaxScan is the limit that
+	// was exceeded; the other one is zero.
+	Timeout time.Duration
+	MaxScan int64
+	// Stats are the statistics collected
+	// before the query was aborted.
+	Stats ExecStats
+}
+
+func (l *LimitError) Error() string {
+	if l.Timeout != 0 {
+		return fmt.Sprintf("query exceeded its time limit of %s", l.Timeout)
+	}
+	return fmt.Sprintf("query exceeded its scan limit of %d bytes", l.MaxScan)
+}
+
+// Encode encodes l to dst using the
+// provided symbol table.
+func (l *LimitError) Encode(dst *ion.Buffer, st *ion.Symtab) {
+	dst.BeginStruct(-1)
+	if l.Timeout != 0 {
+		dst.BeginField(st.Intern("timeout"))
+		dst.WriteInt(int64(l.Timeout))
+	}
+	if l.MaxScan != 0 {
+		dst.BeginField(st.Intern("max_scan"))
+		dst.WriteInt(l.MaxScan)
+	}
+	dst.BeginField(st.Intern("stats"))
+	l.Stats.Encode(dst, st)
+	dst.EndStruct()
+}
+
+// Decode decodes an error produced by Encode.
+func (l *LimitError) Decode(buf []byte, st *ion.Symtab) error {
+	*l = LimitError{}
+	_, err := ion.UnpackStruct(st, buf, func(name string, field []byte) error {
+		var i int64
+		var err error
+		switch name {
+		case "timeout":
+			i, _, err = ion.ReadInt(field)
+			l.Timeout = time.Duration(i)
+		case "max_scan":
+			l.MaxScan, _, err = ion.ReadInt(field)
+		case "stats":
+			err = l.Stats.Decode(field, st)
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("plan.LimitError.Decode: %w", err)
+	}
+	return nil
+}
+
+// Marshal encodes l as
+//
+//	limit_exceeded::{...}
+//
+// using the same symbol table that
+// UnmarshalBinary expects will be used.
+func (l *LimitError) Marshal(dst *ion.Buffer) {
+	dst.BeginAnnotation(1)
+	dst.BeginField(statsSymtab.Intern("limit_exceeded"))
+	l.Encode(dst, &statsSymtab)
+	dst.EndAnnotation()
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler
+func (l *LimitError) UnmarshalBinary(b []byte) error {
+	sym, body, _, err := ion.ReadAnnotation(b)
+	if err != nil {
+		return fmt.Errorf("plan.LimitError.UnmarshalBinary: %w", err)
+	}
+	if statsSymtab.Get(sym) != "limit_exceeded" {
+		return fmt.Errorf("plan.LimitError.UnmarshalBinary: unexpected annotation %q", statsSymtab.Get(sym))
+	}
+	return l.Decode(body, &statsSymtab)
+}
+
+// budget tracks the resources consumed
+// by a query against its Limits
+type budget struct {
+	limits   Limits
+	deadline time.Time
+	scanned  int64 // updated atomically
+
+	lock sync.Mutex
+	err  *LimitError
+}
+
+func (b *budget) fail(l *LimitError) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.err == nil {
+		b.err = l
+	}
+	return b.err
+}
+
+// scan accounts for n bytes scanned by the
+// query and returns a *LimitError if the
+// query has exceeded one of its limits
+func (b *budget) scan(n int64) error {
+	if b.limits.MaxScan > 0 && atomic.AddInt64(&b.scanned, n) > b.limits.MaxScan {
+		return b.fail(&LimitError{MaxScan: b.limits.MaxScan})
+	}
+	if !b.deadline.IsZero() && !time.Now().Before(b.deadline) {
+		return b.fail(&LimitError{Timeout: b.limits.Timeout})
+	}
+	return nil
+}
+
+// exceeded returns a copy of the error
+// describing the limit that the query
+// exceeded, or nil if it is within its limits
+func (b *budget) exceeded() *LimitError {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.err == nil && !b.deadline.IsZero() && !time.Now().Before(b.deadline) {
+		b.err = &LimitError{Timeout: b.limits.Timeout}
+	}
+	if b.err == nil {
+		return nil
+	}
+	l := *b.err
+	return &l
+}
+
+// remaining returns the limits that
+// are left for the rest of the query
+func (b *budget) remaining() Limits {
+	l := b.limits
+	if !b.deadline.IsZero() {
+		// an expired deadline is not
+		// the same as no deadline at all
+		l.Timeout = time.Until(b.deadline)
+		if l.Timeout <= 0 {
+			l.Timeout = 1
+		}
+	}
+	if l.MaxScan > 0 {
+		l.MaxScan -= atomic.LoadInt64(&b.scanned)
+		if l.MaxScan <= 0 {
+			l.MaxScan = 1
+		}
+	}
+	return l
+}
+
+// begin starts enforcing ep.Limits, unless
+// they are already being enforced by the query
+// that ep belongs to. The returned function
+// must be called once execution has completed.
+func (ep *ExecParams) begin() func() {
+	if ep.budget != nil || ep.Limits == (Limits{}) {
+		return func() {}
+	}
+	b := &budget{limits: ep.Limits}
+	ep.budget = b
+	ctx := ep.Context
+	cancel := func() {}
+	if b.limits.Timeout > 0 {
+		b.deadline = time.Now().Add(b.limits.Timeout)
+		parent := ctx
+		if parent == nil {
+			parent = context.Background()
+		}
+		ep.Context, cancel = context.WithDeadline(parent, b.deadline)
+	}
+	return func() {
+		cancel()
+		ep.Context = ctx
+		ep.budget = nil
+	}
+}
+
+// remaining returns the limits that
+// remain for the execution of ep
+func (ep *ExecParams) remaining() Limits {
+	if ep.budget == nil {
+		return ep.Limits
+	}
+	return ep.budget.remaining()
+}
+
+// limitErr returns a *LimitError carrying the
+// statistics collected so far if the query
+// exceeded one of its limits (in which case
+// err is merely a consequence of aborting the query)
+// and otherwise returns err
+//
+// limitErr must only be called once
+// execution has completed.
+func (ep *ExecParams) limitErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	var l *LimitError
+	if ep.budget != nil {
+		l = ep.budget.exceeded()
+	}
+	if l == nil {
+		if !errors.As(err, &l) {
+			return err
+		}
+		// a limit enforced by a remote transport;
+		// this applies to the rest of the query as well
+		if ep.budget != nil {
+			ep.budget.fail(l)
+		}
+	}
+	out := *l
+	out.Stats = ep.Stats
+	return &out
+}
+
+// limit wraps dst so that writing
+// to it accounts for the bytes scanned
+func (ep *ExecParams) limit(dst vm.QuerySink) vm.QuerySink {
+	if ep.budget == nil {
+		return dst
+	}
+	return &limitSink{dst: dst, budget: ep.budget}
+}
+
+// limitSink is a QuerySink that fails writes
+// once the query has exceeded its limits
+type limitSink struct {
+	dst    vm.QuerySink
+	budget *budget
+}
+
+func (s *limitSink) Open() (io.WriteCloser, error) {
+	w, err := s.dst.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &limitWriter{dst: w, budget: s.budget}, nil
+}
+
+func (s *limitSink) Close() error { return s.dst.Close() }
+
+type limitWriter struct {
+	dst    io.WriteCloser
+	budget *budget
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if err := w.budget.scan(int64(len(p))); err != nil {
+		return 0, err
+	}
+	return w.dst.Write(p)
+}
+
+func (w *limitWriter) Close() error { return w.dst.Close() }
+
+// EndSegment implements vm.EndSegmentWriter
+func (w *limitWriter) EndSegment() {
+	vm.HintEndSegment(w.dst)
+}
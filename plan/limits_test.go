@@ -0,0 +1,186 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package plan
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SnellerInc/sneller/expr"
+	"github.com/SnellerInc/sneller/expr/partiql"
+	"github.com/SnellerInc/sneller/ion"
+)
+
+func TestLimitsEncode(t *testing.T) {
+	var st ion.Symtab
+	var buf ion.Buffer
+	lim := Limits{Timeout: 3 * time.Second, MaxScan: 1000}
+	lim.Encode(&buf, &st)
+	var out Limits
+	if err := out.Decode(buf.Bytes(), &st); err != nil {
+		t.Fatal(err)
+	}
+	if out != lim {
+		t.Errorf("got %+v, want %+v", out, lim)
+	}
+
+	lerr := &LimitError{
+		MaxScan: 1000,
+		Stats:   ExecStats{BytesScanned: 2000, CacheHits: 1},
+	}
+	buf.Reset()
+	lerr.Marshal(&buf)
+	got := new(LimitError)
+	if err := got.UnmarshalBinary(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if got.MaxScan != lerr.MaxScan || got.Timeout != 0 ||
+		got.Stats.BytesScanned != 2000 || got.Stats.CacheHits != 1 {
+		t.Errorf("got %+v, want %+v", got, lerr)
+	}
+}
+
+func testLimitTree(t *testing.T, env Env, query string) *Tree {
+	s, err := partiql.Parse([]byte(query))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := New(s, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestScanLimit(t *testing.T) {
+	env := &testenv{t: t}
+	tree := testLimitTree(t, env, `select count(*) from 'parking.10n'`)
+
+	var out bytes.Buffer
+	ep := &ExecParams{
+		Output:  &out,
+		Context: context.Background(),
+		Limits:  Limits{MaxScan: 1000},
+	}
+	err := (&LocalTransport{}).Exec(tree, ep)
+	var lerr *LimitError
+	if !errors.As(err, &lerr) {
+		t.Fatalf("got error %v", err)
+	}
+	if lerr.MaxScan != 1000 || lerr.Timeout != 0 {
+		t.Errorf("unexpected error %+v", lerr)
+	}
+	if lerr.Stats.BytesScanned <= 0 {
+		t.Errorf("no partial stats in %+v", lerr)
+	}
+
+	// a generous limit doesn't interfere
+	out.Reset()
+	ep = &ExecParams{
+		Output:  &out,
+		Context: context.Background(),
+		Limits:  Limits{MaxScan: 1 << 30, Timeout: time.Minute},
+	}
+	if err := (&LocalTransport{}).Exec(tree, ep); err != nil {
+		t.Fatal(err)
+	}
+	if ep.budget != nil {
+		t.Error("budget not released")
+	}
+}
+
+// hangStatEnv is a testenv whose tables
+// never produce data until they are canceled
+type hangStatEnv struct {
+	*testenv
+}
+
+func (h *hangStatEnv) Stat(tbl expr.Node, hint *Hints) (TableHandle, error) {
+	return &hangHandle{}, nil
+}
+
+func TestTimeLimit(t *testing.T) {
+	env := &hangStatEnv{&testenv{t: t}}
+	tree := testLimitTree(t, env, `select count(*) from 'parking.10n'`)
+
+	var out bytes.Buffer
+	ep := &ExecParams{
+		Output:  &out,
+		Context: context.Background(),
+		Limits:  Limits{Timeout: 50 * time.Millisecond},
+	}
+	start := time.Now()
+	err := (&LocalTransport{}).Exec(tree, ep)
+	var lerr *LimitError
+	if !errors.As(err, &lerr) {
+		t.Fatalf("got error %v", err)
+	}
+	if lerr.Timeout != 50*time.Millisecond {
+		t.Errorf("unexpected error %+v", lerr)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("query took %s to time out", elapsed)
+	}
+	if ep.Context.Err() != nil {
+		t.Error("caller's context was replaced")
+	}
+}
+
+func TestRemoteScanLimit(t *testing.T) {
+	remote, local := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+	env := &testenv{t: t}
+
+	var serverr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		serverr = Serve(remote, env)
+	}()
+
+	tree := testLimitTree(t, env, `select count(*) from 'parking.10n'`)
+	cl := Client{Pipe: local}
+	var out bytes.Buffer
+	ep := &ExecParams{
+		Output:  &out,
+		Context: context.Background(),
+		Limits:  Limits{MaxScan: 1000},
+	}
+	err := cl.Exec(tree, ep)
+	var lerr *LimitError
+	if !errors.As(err, &lerr) {
+		t.Fatalf("got error %v", err)
+	}
+	if lerr.MaxScan != 1000 {
+		t.Errorf("unexpected error %+v", lerr)
+	}
+	if lerr.Stats.BytesScanned <= 0 || lerr.Stats.BytesScanned != ep.Stats.BytesScanned {
+		t.Errorf("partial stats %+v; ExecParams stats %+v", lerr.Stats, ep.Stats)
+	}
+	if err := cl.Close(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if serverr != nil {
+		t.Fatal(serverr)
+	}
+}
@@ -291,6 +291,25 @@ type UploadEnv interface {
 	Key() *blockfmt.Key
 }
 
+// EncryptEnv is an UploadEnv that
+// encrypts the objects that it uploads.
+type EncryptEnv interface {
+	UploadEnv
+	// MasterKey returns the key that should be
+	// used to wrap the data key of uploaded objects,
+	// or nil if they should not be encrypted.
+	MasterKey() *blockfmt.MasterKey
+}
+
+// WriteChecker may optionally be implemented
+// by an UploadEnv to restrict the tables that
+// a query may write to with INTO.
+type WriteChecker interface {
+	// CheckWrite returns an error if the
+	// query may not write to the table tbl.
+	CheckWrite(tbl *expr.Path) error
+}
+
 func lowerOutputPart(n *pir.OutputPart, env Env, input Op) (Op, error) {
 	if e, ok := env.(UploadEnv); ok {
 		if up := e.Uploader(); up != nil {
@@ -298,6 +317,15 @@ func lowerOutputPart(n *pir.OutputPart, env Env, input Op) (Op, error) {
 				Basename: n.Basename,
 				Store:    up,
 			}
+			if ee, ok := env.(EncryptEnv); ok {
+				if key := ee.MasterKey(); key != nil {
+					enc, err := blockfmt.NewEncryption(key)
+					if err != nil {
+						return nil, err
+					}
+					op.Encryption = enc
+				}
+			}
 			op.From = input
 			return op, nil
 		}
@@ -306,14 +334,23 @@ func lowerOutputPart(n *pir.OutputPart, env Env, input Op) (Op, error) {
 }
 
 func lowerOutputIndex(n *pir.OutputIndex, env Env, input Op) (Op, error) {
+	if c, ok := env.(WriteChecker); ok {
+		if err := c.CheckWrite(n.Table); err != nil {
+			return nil, err
+		}
+	}
 	if e, ok := env.(UploadEnv); ok {
 		if up := e.Uploader(); up != nil {
 			op := &OutputIndex{
 				Table:    n.Table,
 				Basename: n.Basename,
+				Mode:     n.Mode,
 				Store:    up,
 				Key:      e.Key(),
 			}
+			if ee, ok := env.(EncryptEnv); ok {
+				op.MasterKey = ee.MasterKey()
+			}
 			op.From = input
 			return op, nil
 		}
@@ -659,9 +696,39 @@ func (e pirenv) Index(tbl expr.Node) (pir.Index, error) {
 	if !ok {
 		return nil, nil
 	}
+	if rf, ok := e.env.(RowFilterer); ok {
+		// when the tables have different row filters,
+		// the filters are applied by the table handles,
+		// so the query can't rely on the index to
+		// describe the rows it can see
+		_, common, err := rowFilter(rf, tbl)
+		if err != nil {
+			return nil, err
+		}
+		if !common {
+			return nil, nil
+		}
+	}
 	return index(idx, tbl)
 }
 
+func (e pirenv) Mask(tbl expr.Node, p *expr.Path) expr.Node {
+	m, ok := e.env.(Masker)
+	if !ok {
+		return nil
+	}
+	return mask(m, tbl, p)
+}
+
+func (e pirenv) RowFilter(tbl expr.Node) (expr.Node, error) {
+	rf, ok := e.env.(RowFilterer)
+	if !ok {
+		return nil, nil
+	}
+	f, _, err := rowFilter(rf, tbl)
+	return f, err
+}
+
 // New creates a new Tree from raw query AST.
 func New(q *expr.Query, env Env) (*Tree, error) {
 	return NewSplit(q, env, nil)
@@ -673,6 +740,10 @@ func NewSplit(q *expr.Query, env Env, split Splitter) (*Tree, error) {
 	if err != nil {
 		return nil, err
 	}
+	return newSplit(q, b, env, split)
+}
+
+func newSplit(q *expr.Query, b *pir.Trace, env Env, split Splitter) (*Tree, error) {
 	if split != nil {
 		reduce, err := pir.Split(b)
 		if err != nil {
@@ -694,9 +765,10 @@ func NewSplit(q *expr.Query, env Env, split Splitter) (*Tree, error) {
 
 	// explain the query
 	op := &Explain{
-		Format: q.Explain,
-		Query:  q,
-		Tree:   tree,
+		Format:  q.Explain,
+		Analyze: q.Analyze,
+		Query:   q,
+		Tree:    tree,
 	}
 
 	res := &Tree{Root: Node{Op: op}}
@@ -704,6 +776,67 @@ func NewSplit(q *expr.Query, env Env, split Splitter) (*Tree, error) {
 
 }
 
+// Prepared is a query that has been planned
+// without binding its parameters, so that it
+// can be executed any number of times with
+// different parameters without being planned
+// again. A Prepared query may be used
+// concurrently.
+type Prepared struct {
+	query  *expr.Query
+	params []*expr.Param
+	trace  *pir.Trace
+}
+
+// Prepare plans q without binding its
+// parameters. Unlike New, Prepare does
+// not modify q.
+//
+// Since the plan may depend on the state
+// of env when it is prepared (for example,
+// on the time ranges in the index of a table),
+// the caller is responsible for preparing
+// the query again when that state changes.
+func Prepare(q *expr.Query, env Env) (*Prepared, error) {
+	b, err := pir.Prepare(q, pirenv{env})
+	if err != nil {
+		return nil, err
+	}
+	return &Prepared{query: q, params: q.Params(), trace: b}, nil
+}
+
+// Query returns the query that p was prepared from.
+func (p *Prepared) Query() *expr.Query { return p.query }
+
+// New is equivalent to p.NewSplit(b, env, nil).
+func (p *Prepared) New(b *expr.Bindings, env Env) (*Tree, error) {
+	return p.NewSplit(b, env, nil)
+}
+
+// NewSplit creates a new Tree from p with
+// its parameters bound to the values in b.
+// If the query has no parameters, b may be nil.
+func (p *Prepared) NewSplit(b *expr.Bindings, env Env, split Splitter) (*Tree, error) {
+	if b == nil {
+		b = &expr.Bindings{}
+	}
+	if err := b.Check(p.params); err != nil {
+		return nil, err
+	}
+	t, err := p.trace.BindParams(b)
+	if err != nil {
+		return nil, err
+	}
+	q := p.query
+	if q.Explain != expr.ExplainNone {
+		q, err = q.Bind(b)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return newSplit(q, t, env, split)
+}
+
 func lowerUnpivot(in *pir.Unpivot, from Op) (Op, error) {
 	u := &Unpivot{
 		Nonterminal: Nonterminal{From: from},
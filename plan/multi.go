@@ -29,6 +29,7 @@ import (
 	"github.com/SnellerInc/sneller/expr"
 	"github.com/SnellerInc/sneller/fsutil"
 	"github.com/SnellerInc/sneller/ion"
+	"github.com/SnellerInc/sneller/plan/pir"
 	"github.com/SnellerInc/sneller/vm"
 )
 
@@ -81,6 +82,69 @@ func (m multiIndex) TimeRange(p *expr.Path) (min, max date.Time, ok bool) {
 	return min, max, len(m) > 0
 }
 
+// Rows returns the total number of rows in
+// all the contained indexes.
+func (m multiIndex) Rows() (int64, bool) {
+	total := int64(0)
+	for i := range m {
+		s, ok := m[i].(pir.Statistics)
+		if !ok {
+			return 0, false
+		}
+		n, ok := s.Rows()
+		if !ok {
+			return 0, false
+		}
+		total += n
+	}
+	return total, len(m) > 0
+}
+
+// Distinct returns the sum of the distinct counts
+// of field in all the contained indexes, which is
+// an upper bound of the distinct count of the union.
+func (m multiIndex) Distinct(field string) (int64, bool) {
+	total := int64(0)
+	for i := range m {
+		s, ok := m[i].(pir.Statistics)
+		if !ok {
+			return 0, false
+		}
+		n, ok := s.Distinct(field)
+		if !ok {
+			return 0, false
+		}
+		total += n
+	}
+	return total, len(m) > 0
+}
+
+// NullFraction returns the fraction of rows in all
+// the contained indexes in which field is null or missing.
+func (m multiIndex) NullFraction(field string) (float64, bool) {
+	rows, nulls := 0.0, 0.0
+	for i := range m {
+		s, ok := m[i].(pir.Statistics)
+		if !ok {
+			return 0, false
+		}
+		n, ok := s.Rows()
+		if !ok {
+			return 0, false
+		}
+		f, ok := s.NullFraction(field)
+		if !ok && n > 0 {
+			return 0, false
+		}
+		rows += float64(n)
+		nulls += f * float64(n)
+	}
+	if rows == 0 {
+		return 0, false
+	}
+	return nulls / rows, true
+}
+
 func decodeHandles(d Decoder, st *ion.Symtab, mem []byte) (TableHandle, error) {
 	var ths tableHandles
 	ion.UnpackList(mem, func(mem []byte) error {
@@ -281,13 +345,13 @@ type TableLister interface {
 	ListTables(db string) ([]string, error)
 }
 
-func statGlob(tl TableLister, env Env, e *expr.Builtin, h *Hints) (TableHandle, error) {
+func statGlob(tl TableLister, env Env, e *expr.Builtin, h *Hints, restrict bool) (TableHandle, error) {
 	db, m, err := compileGlob(e)
 	if err != nil {
 		return nil, err
 	}
 	if m, ok := m.(literalMatcher); ok {
-		return env.Stat(mkpath(db, string(m)), h)
+		return statTable(env, mkpath(db, string(m)), h, restrict)
 	}
 	list, err := tl.ListTables(db)
 	if err != nil {
@@ -298,7 +362,7 @@ func statGlob(tl TableLister, env Env, e *expr.Builtin, h *Hints) (TableHandle,
 		if !m.MatchString(list[i]) {
 			continue
 		}
-		th, err := env.Stat(mkpath(db, list[i]), h)
+		th, err := statTable(env, mkpath(db, list[i]), h, restrict)
 		if errors.Is(err, fs.ErrNotExist) {
 			continue
 		} else if err != nil {
@@ -352,6 +416,57 @@ func indexGlob(tl TableLister, idx Indexer, e *expr.Builtin) (Index, error) {
 	}
 }
 
+func rowFilterGlob(tl TableLister, rf RowFilterer, e *expr.Builtin) (expr.Node, bool, error) {
+	db, m, err := compileGlob(e)
+	if err != nil {
+		return nil, false, err
+	}
+	if m, ok := m.(literalMatcher); ok {
+		f, err := rf.RowFilter(mkpath(db, string(m)))
+		return f, true, err
+	}
+	list, err := tl.ListTables(db)
+	if err != nil {
+		return nil, false, err
+	}
+	var lst []expr.Node
+	for i := range list {
+		if !m.MatchString(list[i]) {
+			continue
+		}
+		f, err := rf.RowFilter(mkpath(db, list[i]))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, false, err
+		}
+		lst = append(lst, f)
+	}
+	f, ok := commonFilter(lst)
+	return f, ok, nil
+}
+
+func maskGlob(tl TableLister, m Masker, e *expr.Builtin, p *expr.Path) expr.Node {
+	db, match, err := compileGlob(e)
+	if err != nil {
+		return p
+	}
+	if match, ok := match.(literalMatcher); ok {
+		return m.Mask(mkpath(db, string(match)), p)
+	}
+	list, err := tl.ListTables(db)
+	if err != nil {
+		return p
+	}
+	var lst []expr.Node
+	for i := range list {
+		if match.MatchString(list[i]) {
+			lst = append(lst, m.Mask(mkpath(db, list[i]), p))
+		}
+	}
+	return commonMask(lst, p)
+}
+
 func mkpath(db, tbl string) *expr.Path {
 	if db == "" {
 		return &expr.Path{First: tbl}
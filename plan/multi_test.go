@@ -15,11 +15,15 @@
 package plan
 
 import (
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/SnellerInc/sneller/date"
 	"github.com/SnellerInc/sneller/expr"
+	"github.com/SnellerInc/sneller/expr/partiql"
+
+	"golang.org/x/exp/slices"
 )
 
 func TestMultiIndex(t *testing.T) {
@@ -72,3 +76,177 @@ type timeIndex struct {
 func (h timeIndex) TimeRange(*expr.Path) (min, max date.Time, ok bool) {
 	return h.min, h.max, true
 }
+
+type rowFilterLister map[string]expr.Node
+
+func (r rowFilterLister) ListTables(db string) ([]string, error) {
+	var out []string
+	for name := range r {
+		out = append(out, name)
+	}
+	slices.Sort(out)
+	return out, nil
+}
+
+func (r rowFilterLister) RowFilter(tbl expr.Node) (expr.Node, error) {
+	p := tbl.(*expr.Path)
+	return r[p.Rest.(*expr.Dot).Field], nil
+}
+
+func TestRowFilterGlob(t *testing.T) {
+	orgA := expr.Compare(expr.Equals, expr.Identifier("org_id"), expr.String("a"))
+	orgB := expr.Compare(expr.Equals, expr.Identifier("org_id"), expr.String("b"))
+	rf := rowFilterLister{
+		"a0": orgA,
+		"a1": orgA,
+		"b0": orgB,
+		"c0": nil,
+	}
+	glob := func(pat string) expr.Node {
+		return expr.Call(expr.TableGlob, &expr.Path{First: "db", Rest: &expr.Dot{Field: pat}})
+	}
+	cases := []struct {
+		table  expr.Node
+		want   expr.Node
+		common bool
+	}{
+		{glob("a0"), orgA, true},
+		{glob("c*"), nil, true},
+		{glob("a*"), orgA, true},
+		// each table has to be filtered separately
+		{glob("[ac]*"), nil, false},
+		{glob("*"), nil, false},
+		{expr.Append(glob("a0"), glob("a1")), orgA, true},
+		{expr.Append(glob("a0"), glob("b0")), nil, false},
+	}
+	for i := range cases {
+		got, common, err := rowFilter(rf, cases[i].table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if common != cases[i].common {
+			t.Errorf("%s: got common=%v", expr.ToString(cases[i].table), common)
+		}
+		if (got == nil) != (cases[i].want == nil) ||
+			got != nil && !expr.Equivalent(got, cases[i].want) {
+			t.Errorf("%s: got %s, want %s", expr.ToString(cases[i].table), expr.ToString(got), expr.ToString(cases[i].want))
+		}
+	}
+}
+
+// hintHandle records the hints
+// passed to rowFilterLister.Stat
+type hintHandle struct {
+	TableHandle
+	hints Hints
+}
+
+func (r rowFilterLister) Stat(tbl expr.Node, h *Hints) (TableHandle, error) {
+	return &hintHandle{hints: *h}, nil
+}
+
+func TestStatGlobRowFilter(t *testing.T) {
+	orgA := expr.Compare(expr.Equals, expr.Identifier("org_id"), expr.String("a"))
+	orgB := expr.Compare(expr.Equals, expr.Identifier("org_id"), expr.String("b"))
+	rf := rowFilterLister{
+		"a0": orgA,
+		"b0": orgB,
+		"c0": nil,
+	}
+	glob := expr.Call(expr.TableGlob, &expr.Path{First: "db", Rest: &expr.Dot{Field: "*"}})
+	th, err := stat(rf, glob, &Hints{Fields: []string{"x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ths, ok := th.(tableHandles)
+	if !ok || len(ths) != 3 {
+		t.Fatalf("unexpected handle %#v", th)
+	}
+	want := []struct {
+		filter expr.Node
+		fields []string
+	}{
+		{orgA, []string{"org_id", "x"}},
+		{orgB, []string{"org_id", "x"}},
+		{nil, []string{"x"}},
+	}
+	for i := range ths {
+		h := ths[i].(*hintHandle).hints
+		if (h.RowFilter == nil) != (want[i].filter == nil) ||
+			h.RowFilter != nil && !expr.Equivalent(h.RowFilter, want[i].filter) {
+			t.Errorf("table %d: got row filter %s", i, expr.ToString(h.RowFilter))
+		}
+		if !slices.Equal(h.Fields, want[i].fields) {
+			t.Errorf("table %d: got fields %v, want %v", i, h.Fields, want[i].fields)
+		}
+	}
+
+	// a common row filter is applied by the query
+	glob = expr.Call(expr.TableGlob, &expr.Path{First: "db", Rest: &expr.Dot{Field: "a*"}})
+	th, err = stat(rf, glob, &Hints{Fields: []string{"x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := th.(*hintHandle).hints; h.RowFilter != nil {
+		t.Errorf("unexpected row filter %s", expr.ToString(h.RowFilter))
+	}
+}
+
+// maskFilterLister is a rowFilterLister
+// that also masks fields of every table
+// (see pir.Masker)
+type maskFilterLister struct {
+	rowFilterLister
+	masks map[string]expr.Node
+}
+
+func (m *maskFilterLister) Mask(tbl expr.Node, p *expr.Path) expr.Node {
+	return m.masks[p.First]
+}
+
+func TestRowFilterMasked(t *testing.T) {
+	orgA := expr.Compare(expr.Equals, expr.Identifier("org_id"), expr.String("a"))
+	for _, m := range []expr.Node{
+		&expr.Path{First: "org_id"}, // redacted
+		expr.Missing{},              // hidden
+	} {
+		env := &maskFilterLister{
+			rowFilterLister: rowFilterLister{"t": orgA},
+			masks:           map[string]expr.Node{"org_id": m},
+		}
+		q, err := partiql.Parse([]byte("SELECT * FROM db.t"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree, err := New(q, env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the row filter has to see the values of
+		// org_id before they are masked, so the table
+		// handle applies it rather than the query
+		if s := tree.String(); strings.Contains(s, "org_id") {
+			t.Errorf("%s: query applies the row filter:\n%s", expr.ToString(m), s)
+		}
+		if len(tree.Inputs) != 1 {
+			t.Fatalf("%d inputs", len(tree.Inputs))
+		}
+		h := tree.Inputs[0].Handle.(*hintHandle).hints
+		if h.RowFilter == nil || !expr.Equivalent(h.RowFilter, orgA) {
+			t.Errorf("%s: got row filter %s", expr.ToString(m), expr.ToString(h.RowFilter))
+		}
+	}
+	// a row filter that doesn't reference
+	// masked fields is applied by the query
+	env := &maskFilterLister{
+		rowFilterLister: rowFilterLister{"t": orgA},
+		masks:           map[string]expr.Node{"email": expr.Missing{}},
+	}
+	f, common, err := rowFilter(env, &expr.Path{First: "db", Rest: &expr.Dot{Field: "t"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !common || f == nil || !expr.Equivalent(f, orgA) {
+		t.Errorf("got row filter %s (common=%v)", expr.ToString(f), common)
+	}
+}
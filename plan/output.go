@@ -30,6 +30,8 @@ import (
 	"github.com/SnellerInc/sneller/ion"
 	"github.com/SnellerInc/sneller/ion/blockfmt"
 	"github.com/SnellerInc/sneller/vm"
+
+	"golang.org/x/exp/slices"
 )
 
 // uploadSink is a vm.QuerySink that uploads
@@ -143,6 +145,10 @@ type OutputPart struct {
 	Nonterminal
 	Basename string
 	Store    UploadFS
+	// Encryption, if non-nil, is used to
+	// encrypt each of the uploaded objects.
+	// Its data key must be unwrapped.
+	Encryption *blockfmt.Encryption
 }
 
 func uuid() string {
@@ -175,6 +181,7 @@ func (o *OutputPart) wrap(dst vm.QuerySink, ep *ExecParams) (int, vm.QuerySink,
 	us.mw.Output = up
 	us.mw.Algo = "zstd" // FIXME: grab this from elsewhere
 	us.mw.InputAlign = 1 << 20
+	us.mw.Trailer.Encryption = o.Encryption
 	return o.From.wrap(us, ep)
 }
 
@@ -187,6 +194,12 @@ func (o *OutputPart) encode(dst *ion.Buffer, st *ion.Symtab) error {
 	if err := o.Store.Encode(dst, st); err != nil {
 		return err
 	}
+	if o.Encryption != nil {
+		dst.BeginField(st.Intern("wrapped-key"))
+		dst.WriteBlob(o.Encryption.Wrapped)
+		dst.BeginField(st.Intern("data-key"))
+		dst.WriteBlob(o.Encryption.DataKey)
+	}
 	dst.EndStruct()
 	return nil
 }
@@ -209,6 +222,19 @@ func (o *OutputPart) setfield(d Decoder, name string, st *ion.Symtab, buf []byte
 			return err
 		}
 		o.Store = store
+	case "wrapped-key", "data-key":
+		b, _, err := ion.ReadBytes(buf)
+		if err != nil {
+			return err
+		}
+		if o.Encryption == nil {
+			o.Encryption = new(blockfmt.Encryption)
+		}
+		if name == "wrapped-key" {
+			o.Encryption.Wrapped = slices.Clone(b)
+		} else {
+			o.Encryption.DataKey = slices.Clone(b)
+		}
 	default:
 		return errUnexpectedField
 	}
@@ -222,14 +248,21 @@ func (o *OutputPart) String() string {
 // OutputIndex is a nonterminal plan node
 // that accepts rows from OutputPart and collects
 // them into an Index object. OutputIndex writes
-// one output row containing the autogenerated
-// table name.
+// one output row containing the table name,
+// which is autogenerated when Mode is expr.IntoNew.
 type OutputIndex struct {
 	Nonterminal
 	Table    *expr.Path
 	Basename string
-	Store    UploadFS
-	Key      *blockfmt.Key
+	// Mode determines whether the Index is
+	// written as a new table, appended to
+	// Table, or replaces Table.
+	Mode  expr.IntoMode
+	Store UploadFS
+	Key   *blockfmt.Key
+	// MasterKey, if non-nil, is used to seal
+	// the index of the output table (see blockfmt.Sealer).
+	MasterKey *blockfmt.MasterKey
 }
 
 // indexSink is a vm.QuerySink that collects
@@ -289,12 +322,7 @@ func (is *indexSink) Close() error {
 		return nil
 	}
 	is.closed = true
-	idxmem, err := blockfmt.Sign(is.parent.Key, is.idx)
-	if err != nil {
-		return err
-	}
-	idxpath := db.IndexPath(is.tbl.First, is.tbl.Rest.(*expr.Dot).Field)
-	_, err = is.parent.Store.WriteFile(idxpath, idxmem)
+	err := is.commit()
 	if err != nil {
 		return err
 	}
@@ -318,6 +346,54 @@ func (is *indexSink) Close() error {
 	return w.Close()
 }
 
+// commit writes the index of the output table
+func (is *indexSink) commit() error {
+	dbname, table := is.tbl.First, is.tbl.Rest.(*expr.Dot).Field
+	owner := &outputTenant{store: is.parent.Store, key: is.parent.Key, mkey: is.parent.MasterKey}
+	var b db.Builder
+	switch is.parent.Mode {
+	case expr.IntoInsert:
+		return b.Insert(owner, dbname, table, is.idx.Inline)
+	case expr.IntoCreate, expr.IntoReplace:
+		return b.Create(owner, dbname, table, is.idx.Inline, is.parent.Mode == expr.IntoReplace)
+	}
+	idxmem, err := blockfmt.Sign(is.parent.Key, is.idx)
+	if err != nil {
+		return err
+	}
+	p := db.IndexPath(dbname, table)
+	if is.parent.MasterKey != nil {
+		s, err := blockfmt.NewSealer(is.parent.MasterKey)
+		if err != nil {
+			return err
+		}
+		idxmem, err = s.Seal(p, idxmem)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = is.parent.Store.WriteFile(p, idxmem)
+	return err
+}
+
+// outputTenant is the db.Tenant
+// used to update existing tables
+type outputTenant struct {
+	store UploadFS
+	key   *blockfmt.Key
+	mkey  *blockfmt.MasterKey
+}
+
+func (o *outputTenant) ID() string                { return "" }
+func (o *outputTenant) Key() *blockfmt.Key        { return o.key }
+func (o *outputTenant) Root() (db.InputFS, error) { return o.store, nil }
+
+// MasterKey implements db.EncryptedTenant.MasterKey
+func (o *outputTenant) MasterKey() *blockfmt.MasterKey { return o.mkey }
+func (o *outputTenant) Split(string) (db.InputFS, string, error) {
+	return nil, "", fmt.Errorf("cannot split patterns for INTO")
+}
+
 func (o *OutputIndex) wrap(dst vm.QuerySink, ep *ExecParams) (int, vm.QuerySink, error) {
 	if o.Table == nil {
 		return -1, nil, fmt.Errorf("OutputIndex: table not set")
@@ -328,11 +404,14 @@ func (o *OutputIndex) wrap(dst vm.QuerySink, ep *ExecParams) (int, vm.QuerySink,
 	} else if o.Key == nil {
 		return -1, nil, fmt.Errorf("OutputIndex: key not set")
 	}
-	tbl := &expr.Path{
-		First: o.Table.First,
-		Rest: &expr.Dot{
-			Field: o.Table.Rest.(*expr.Dot).Field + "-" + uuid(),
-		},
+	tbl := o.Table
+	if o.Mode == expr.IntoNew {
+		tbl = &expr.Path{
+			First: o.Table.First,
+			Rest: &expr.Dot{
+				Field: o.Table.Rest.(*expr.Dot).Field + "-" + uuid(),
+			},
+		}
 	}
 	idx := &blockfmt.Index{
 		Name: tbl.Rest.(*expr.Dot).Field,
@@ -362,6 +441,10 @@ func (o *OutputIndex) setfield(d Decoder, name string, st *ion.Symtab, buf []byt
 		o.Table = p
 	case "basename":
 		o.Basename, _, err = ion.ReadString(buf)
+	case "mode":
+		var i int64
+		i, _, err = ion.ReadInt(buf)
+		o.Mode = expr.IntoMode(i)
 	case "store":
 		up, ok := d.(UploaderDecoder)
 		if !ok {
@@ -378,6 +461,16 @@ func (o *OutputIndex) setfield(d Decoder, name string, st *ion.Symtab, buf []byt
 		}
 		o.Key = new(blockfmt.Key)
 		copy(o.Key[:], inner)
+	case "master-key":
+		inner, _, err := ion.ReadBytesShared(buf)
+		if err != nil {
+			return err
+		}
+		if len(inner) != blockfmt.MasterKeyLength {
+			return fmt.Errorf("invalid master key length: %d", len(inner))
+		}
+		o.MasterKey = new(blockfmt.MasterKey)
+		copy(o.MasterKey[:], inner)
 
 	default:
 		return errUnexpectedField
@@ -392,16 +485,27 @@ func (o *OutputIndex) encode(dst *ion.Buffer, st *ion.Symtab) error {
 	o.Table.Encode(dst, st)
 	dst.BeginField(st.Intern("basename"))
 	dst.WriteString(o.Basename)
+	if o.Mode != expr.IntoNew {
+		dst.BeginField(st.Intern("mode"))
+		dst.WriteInt(int64(o.Mode))
+	}
 	dst.BeginField(st.Intern("store"))
 	if err := o.Store.Encode(dst, st); err != nil {
 		return err
 	}
 	dst.BeginField(st.Intern("key"))
 	dst.WriteBlob(o.Key[:])
+	if o.MasterKey != nil {
+		dst.BeginField(st.Intern("master-key"))
+		dst.WriteBlob(o.MasterKey[:])
+	}
 	dst.EndStruct()
 	return nil
 }
 
 func (o *OutputIndex) String() string {
+	if o.Mode != expr.IntoNew {
+		return fmt.Sprintf("OUTPUT INDEX %s AT %s (%s)", expr.ToString(o.Table), o.Basename, o.Mode)
+	}
 	return fmt.Sprintf("OUTPUT INDEX %s AT %s", expr.ToString(o.Table), o.Basename)
 }
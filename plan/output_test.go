@@ -16,7 +16,9 @@ package plan
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io/fs"
 	"math/rand"
 	"testing"
 
@@ -94,11 +96,176 @@ func TestOutput(t *testing.T) {
 	}
 }
 
+func TestOutputModes(t *testing.T) {
+	tmp := t.TempDir()
+	env := mkoutenv(t, tmp)
+	exec := func(text string) error {
+		q, err := partiql.Parse([]byte(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree, err := New(q, env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testPlanSerialize(t, tree, env)
+		var dst bytes.Buffer
+		var stat ExecStats
+		return Exec(tree, &dst, &stat)
+	}
+	objects := func(want, deleted int) {
+		t.Helper()
+		idx, err := db.OpenIndex(env.fs, "foo", "bar", env.Key())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := idx.Objects(); n != want {
+			t.Errorf("got %d objects; expected %d", n, want)
+		}
+		if n := len(idx.ToDelete); n != deleted {
+			t.Errorf("got %d objects to delete; expected %d", n, deleted)
+		}
+	}
+	err := exec("INSERT INTO foo.bar SELECT * FROM 'parking.10n'")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("INSERT INTO missing table: got error %v", err)
+	}
+	err = exec("CREATE TABLE foo.bar AS SELECT * FROM 'parking.10n'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects(1, 0)
+	err = exec("CREATE TABLE foo.bar AS SELECT * FROM 'parking.10n'")
+	if !errors.Is(err, db.ErrTableExists) {
+		t.Fatalf("CREATE TABLE of existing table: got error %v", err)
+	}
+	err = exec("INSERT INTO foo.bar SELECT * FROM 'parking.10n' WHERE Color = 'BK'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects(2, 0)
+	err = exec("CREATE OR REPLACE TABLE foo.bar AS SELECT Ticket FROM 'parking.10n'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects(1, 2)
+}
+
+func TestOutputEncrypted(t *testing.T) {
+	tmp := t.TempDir()
+	env := &encoutenv{outputenv: mkoutenv(t, tmp)}
+	rand.Read(env.mkey[:])
+	q, err := partiql.Parse([]byte("CREATE TABLE foo.bar AS SELECT * FROM 'parking.10n'"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := New(q, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPlanSerialize(t, tree, env)
+	var dst bytes.Buffer
+	var stat ExecStats
+	err = Exec(tree, &dst, &stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.OpenIndex(env.fs, "foo", "bar", env.Key())
+	if !errors.Is(err, blockfmt.ErrSealed) {
+		t.Fatalf("opening the index without a master key: got error %v", err)
+	}
+	p := db.IndexPath("foo", "bar")
+	buf, err := fs.ReadFile(env.fs, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err = (&blockfmt.Sealer{Master: &env.mkey}).Unseal(p, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := blockfmt.DecodeIndex(env.Key(), buf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Inline) == 0 {
+		t.Fatal("no objects")
+	}
+	for i := range idx.Inline {
+		desc := &idx.Inline[i]
+		enc := desc.Trailer.Encryption
+		if enc == nil || enc.DataKey != nil {
+			t.Fatalf("%s: unexpected encryption %+v", desc.Path, enc)
+		}
+		err := enc.Unwrap(&env.mkey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := env.fs.Open(desc.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var errlog bytes.Buffer
+		rows := blockfmt.Validate(f, desc.Trailer, &errlog)
+		f.Close()
+		if rows == 0 || errlog.Len() > 0 {
+			t.Fatalf("%s: %d rows: %s", desc.Path, rows, errlog.String())
+		}
+	}
+}
+
+// readonlyenv is an outputenv
+// that denies writes to foo.*
+type readonlyenv struct {
+	*outputenv
+}
+
+func (r *readonlyenv) CheckWrite(tbl *expr.Path) error {
+	if tbl.First == "foo" {
+		return fs.ErrPermission
+	}
+	return nil
+}
+
+func TestOutputWriteCheck(t *testing.T) {
+	env := &readonlyenv{outputenv: mkoutenv(t, t.TempDir())}
+	for _, text := range []string{
+		"SELECT * INTO foo.bar FROM 'parking.10n'",
+		"INSERT INTO foo.bar SELECT * FROM 'parking.10n'",
+		"CREATE TABLE foo.bar AS SELECT * FROM 'parking.10n'",
+		"CREATE OR REPLACE TABLE foo.bar AS SELECT * FROM 'parking.10n'",
+	} {
+		q, err := partiql.Parse([]byte(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = New(q, env)
+		if !errors.Is(err, fs.ErrPermission) {
+			t.Errorf("%s: got error %v", text, err)
+		}
+	}
+	q, err := partiql.Parse([]byte("CREATE TABLE other.bar AS SELECT * FROM 'parking.10n'"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(q, env); err != nil {
+		t.Fatal(err)
+	}
+}
+
 var _ interface {
 	UploadEnv
 	UploaderDecoder
 } = (*outputenv)(nil)
 
+var _ EncryptEnv = (*encoutenv)(nil)
+
+type encoutenv struct {
+	*outputenv
+	mkey blockfmt.MasterKey
+}
+
+func (e *encoutenv) MasterKey() *blockfmt.MasterKey { return &e.mkey }
+
 type outputenv struct {
 	testenv
 	fs  UploadFS
@@ -49,6 +49,19 @@ type Subtables interface {
 	Append(Subtables) Subtables
 }
 
+// Replanner may optionally be implemented by Subtables
+// to support re-planning a subtable after its
+// Transport has failed.
+type Replanner interface {
+	// Replan returns a new list of Subtables
+	// that covers the same data as subtable i
+	// without using the Transport of subtable i
+	// (or any other Transport that has already
+	// failed). Replan returns nil if subtable i
+	// cannot be re-planned.
+	Replan(i int) Subtables
+}
+
 // SubtableList is a basic implementation of Subtables.
 // This implementation is used if a Decoder does not
 // implement DecodeSubtables.
@@ -204,9 +217,10 @@ const (
 	framestart
 
 	// server-to-client frames
-	framedata // output query data
-	frameerr  // query encountered an error
-	framefin  // no more query data
+	framedata  // output query data
+	frameerr   // query encountered an error
+	framefin   // no more query data
+	framelimit // query exceeded its limits
 )
 
 func (f frame) kind() framekind {
@@ -415,6 +429,23 @@ func (s *server) fin(stat *ExecStats) error {
 	return err
 }
 
+// limit responds with the *LimitError l
+// along with the stats collected before
+// the query was aborted
+func (s *server) limit(l *LimitError, stat *ExecStats) error {
+	if s.writeFail {
+		return nil
+	}
+	out := &LimitError{Timeout: l.Timeout, MaxScan: l.MaxScan, Stats: *stat}
+	var buf ion.Buffer
+	buf.Set(s.tmp[:framesize])
+	out.Marshal(&buf)
+	msg := buf.Bytes()
+	mkframe(framelimit, buf.Size()-framesize).put(msg)
+	_, err := s.pipe.Write(msg)
+	return err
+}
+
 func (s *server) runQuery(buf []byte, ctx context.Context, cancel func()) error {
 	defer cancel()
 	s.st.Reset()
@@ -434,8 +465,19 @@ func (s *server) runQuery(buf []byte, ctx context.Context, cancel func()) error
 		Output:  s,
 		Context: ctx,
 	}
+	// the limits, if any, follow the plan
+	if rest := buf[ion.SizeOf(buf):]; len(rest) > 0 {
+		err = ep.Limits.Decode(rest, &s.st)
+		if err != nil {
+			return err
+		}
+	}
 	err = lp.Exec(t, &ep)
 	if err != nil {
+		var l *LimitError
+		if errors.As(err, &l) {
+			return s.limit(l, &ep.Stats)
+		}
 		return err
 	}
 	return s.fin(&ep.Stats)
@@ -482,14 +524,16 @@ var _ Transport = &Client{}
 // Exec is *not* safe to call from multiple goroutines
 // simultaneously.
 func (c *Client) Exec(t *Tree, ep *ExecParams) error {
+	done := ep.begin()
+	defer done()
 	c.st.Reset()
 	c.iob.Reset()
 	c.valid = 0
-	err := c.send(t, ep.Rewrite)
+	err := c.send(t, ep)
 	if err != nil {
 		return err
 	}
-	return c.copyout(ep)
+	return ep.limitErr(c.copyout(ep))
 }
 
 // Close closes c.Pipe
@@ -497,11 +541,14 @@ func (c *Client) Close() error {
 	return c.Pipe.Close()
 }
 
-func (c *Client) send(t *Tree, rw TableRewrite) error {
-	err := t.EncodePart(&c.iob, &c.st, rw)
+func (c *Client) send(t *Tree, ep *ExecParams) error {
+	err := t.EncodePart(&c.iob, &c.st, ep.Rewrite)
 	if err != nil {
 		return fmt.Errorf("plan.Client.Exec: encoding plan: %w", err)
 	}
+	if lim := ep.remaining(); lim != (Limits{}) {
+		lim.Encode(&c.iob, &c.st)
+	}
 	if cap(c.tmp) < framesize {
 		c.tmp = make([]byte, framesize)
 	}
@@ -604,7 +651,7 @@ func (c *Client) queryerr(size int) error {
 	return errors.New(bld.String())
 }
 
-func (c *Client) decodestat(stat *ExecStats, size int) error {
+func (c *Client) decodestat(ep *ExecParams, size int) error {
 	var tmp ExecStats
 	buf, err := c.buffer(size)
 	if err != nil {
@@ -614,10 +661,30 @@ func (c *Client) decodestat(stat *ExecStats, size int) error {
 	if err != nil {
 		return err
 	}
-	stat.atomicAdd(&tmp)
+	ep.Stats.atomicAdd(&tmp)
+	if ep.budget != nil {
+		// the remote end enforced the limits
+		// on its own part of the query, but the
+		// limits apply to the query as a whole
+		return ep.budget.scan(tmp.BytesScanned)
+	}
 	return nil
 }
 
+func (c *Client) limiterr(ep *ExecParams, size int) error {
+	buf, err := c.buffer(size)
+	if err != nil {
+		return err
+	}
+	l := new(LimitError)
+	err = l.UnmarshalBinary(buf)
+	if err != nil {
+		return err
+	}
+	ep.Stats.atomicAdd(&l.Stats)
+	return l
+}
+
 func closeOnCancel(pipe io.ReadWriteCloser, cancel, done <-chan struct{}) {
 	select {
 	case <-cancel:
@@ -628,7 +695,6 @@ func closeOnCancel(pipe io.ReadWriteCloser, cancel, done <-chan struct{}) {
 
 func (c *Client) copyout(ep *ExecParams) error {
 	dst := ep.Output
-	stat := &ep.Stats
 	var done chan struct{}
 	if cancel := ep.Context.Done(); cancel != nil {
 		done = make(chan struct{})
@@ -649,7 +715,7 @@ func (c *Client) copyout(ep *ExecParams) error {
 		switch f.kind() {
 		case framefin:
 			// done!
-			return c.decodestat(stat, f.length())
+			return c.decodestat(ep, f.length())
 		case framedata:
 			err = c.output(dst, f.length())
 			if err != nil {
@@ -663,6 +729,8 @@ func (c *Client) copyout(ep *ExecParams) error {
 			}
 		case frameerr:
 			return c.queryerr(f.length())
+		case framelimit:
+			return c.limiterr(ep, f.length())
 		default:
 			// unexpected frame
 			return fmt.Errorf("plan.Client: unexpected frame %x", f)
@@ -464,7 +464,11 @@ func aggelim(b *Trace) {
 		found = true
 		break
 	}
-	if !found || a.GroupBy != nil || tbl.Index == nil {
+	// the index describes every row in the table,
+	// so it cannot be used to answer a query over
+	// a table that has a filter (i.e. a row filter;
+	// see IterTable.restrict)
+	if !found || a.GroupBy != nil || tbl.Index == nil || tbl.Filter != nil {
 		return
 	}
 	// attempt to substitute aggregate expressions
@@ -148,6 +148,31 @@ type Env interface {
 	Index(expr.Node) (Index, error)
 }
 
+// RowFilterer may optionally be implemented
+// by an Env in order to restrict the rows of
+// a table that are visible to a query.
+type RowFilterer interface {
+	// RowFilter returns a predicate that every
+	// row of the given table expression must
+	// satisfy, or nil if every row is visible.
+	RowFilter(expr.Node) (expr.Node, error)
+}
+
+// Masker may optionally be implemented
+// by an Env in order to mask fields of
+// a table from a query.
+type Masker interface {
+	// Mask returns the expression that replaces
+	// a reference to the field p of the given
+	// table expression, or nil if p is not masked.
+	// Mask returns p itself if the table masks
+	// the value of p before the query evaluates it.
+	//
+	// The index of a table is never used to
+	// compute anything about a masked field.
+	Mask(tbl expr.Node, p *expr.Path) expr.Node
+}
+
 type Index interface {
 	// TimeRange returns the inclusive time range
 	// for the given path expression across the
@@ -162,6 +187,10 @@ type Index interface {
 // type information that can be used to type-check
 // and optimize the query.
 func Build(q *expr.Query, e Env) (*Trace, error) {
+	return buildQuery(q, e, false)
+}
+
+func buildQuery(q *expr.Query, e Env, prepared bool) (*Trace, error) {
 	body := q.Body
 	var err error
 	if len(q.With) > 0 {
@@ -171,7 +200,7 @@ func Build(q *expr.Query, e Env) (*Trace, error) {
 		}
 	}
 	if sel, ok := body.(*expr.Select); ok {
-		t, err := build(nil, sel, e)
+		t, err := buildTrace(&Trace{prepared: prepared}, sel, e)
 		if err != nil {
 			return nil, err
 		}
@@ -187,7 +216,7 @@ func Build(q *expr.Query, e Env) (*Trace, error) {
 			} else if tbl.Rest != nil {
 				return nil, fmt.Errorf("unsupported INTO: %q", expr.ToString(q.Into))
 			}
-			t.Into(p, path.Join("db", p.First, tbl.Field))
+			t.Into(p, path.Join("db", p.First, tbl.Field), q.IntoMode)
 		}
 		err = postcheck(t)
 		if err != nil {
@@ -200,9 +229,12 @@ func Build(q *expr.Query, e Env) (*Trace, error) {
 }
 
 func build(parent *Trace, s *expr.Select, e Env) (*Trace, error) {
-	b := &Trace{Parent: parent}
+	return buildTrace(&Trace{Parent: parent, prepared: parent.prepared}, s, e)
+}
+
+func buildTrace(b *Trace, s *expr.Select, e Env) (*Trace, error) {
 	s = expr.Simplify(s, b).(*expr.Select)
-	err := expr.Check(s)
+	err := b.checkSelect(s)
 	if err != nil {
 		return nil, err
 	}
@@ -210,6 +242,7 @@ func build(parent *Trace, s *expr.Select, e Env) (*Trace, error) {
 	if err != nil {
 		return nil, err
 	}
+	b.applyMasks()
 	b.optimize()
 	return b, nil
 }
@@ -512,7 +545,8 @@ func (h *hoistwalk) Rewrite(e expr.Node) expr.Node {
 		return e
 	}
 	scalar := len(t.FinalBindings()) == 1
-	class := t.Class()
+	before := t.Class()
+	class, est := t.estimatedClass()
 	if class == SizeZero {
 		return expr.Missing{}
 	}
@@ -537,23 +571,19 @@ func (h *hoistwalk) Rewrite(e expr.Node) expr.Node {
 		}
 		return expr.Call(expr.StructReplacement, index)
 	case SizeExactSmall, SizeColumnCardinality:
+		t.bound(before)
 		h.in = append(h.in, t)
 		if corrv != nil {
 			return expr.Call(expr.HashReplacement, index, listkind, label, corrv)
 		}
 		return expr.Call(expr.ListReplacement, index)
 	default:
-		h.err = errorf(s, "cardinality of sub-query is too large; use LIMIT")
+		h.err = errorf(s, "cardinality of sub-query is too large%s; use LIMIT", t.estimated(est))
 		return s
 	}
 }
 
 func (h *hoistwalk) rewriteInSubquery(b *expr.Builtin) expr.Node {
-	// TODO: push down a DISTINCT,
-	// since the IN expression
-	// is equivalent regardless of
-	// how many times the same result
-	// appears in the output
 	t, err := build(h.parent, b.Args[1].(*expr.Select), h.env)
 	if err != nil {
 		h.err = err
@@ -564,7 +594,16 @@ func (h *hoistwalk) rewriteInSubquery(b *expr.Builtin) expr.Node {
 		return b
 	}
 	index := len(h.in)
-	switch t.Class() {
+	before := t.Class()
+	class, est := t.estimatedClass()
+	// the IN expression is equivalent regardless
+	// of how many times the same result appears
+	// in the output, so a result that is too large
+	// may be made small by pushing down a DISTINCT
+	if !class.Small() && t.pushDistinct() {
+		class, est = t.estimatedClass()
+	}
+	switch class {
 	case SizeZero:
 		return expr.Bool(false)
 	case SizeOne:
@@ -572,10 +611,11 @@ func (h *hoistwalk) rewriteInSubquery(b *expr.Builtin) expr.Node {
 		repl := expr.Call(expr.ScalarReplacement, expr.Integer(index))
 		return expr.Compare(expr.Equals, b.Args[0], repl)
 	case SizeExactSmall, SizeColumnCardinality:
+		t.bound(before)
 		h.in = append(h.in, t)
 		return expr.Call(expr.InReplacement, b.Args[0], expr.Integer(index))
 	default:
-		h.err = errorf(b.Args[1].(*expr.Select), "sub-query cardinality too large: %s", b.Args[1])
+		h.err = errorf(b.Args[1].(*expr.Select), "sub-query cardinality too large%s: %s", t.estimated(est), b.Args[1])
 		return b
 	}
 }
@@ -597,7 +637,8 @@ func (h *hoistwalk) rewriteScalarArg(e expr.Node) expr.Node {
 		h.err = errorf(s, "cannot coerce sub-query with %d columns into a scalar", cols)
 		return nil
 	}
-	switch t.Class() {
+	class, est := t.estimatedClass()
+	switch class {
 	case SizeZero:
 		// NOTE: NULL is the obvious SQL answer,
 		// but doesn't MISSING make more sense in
@@ -611,7 +652,7 @@ func (h *hoistwalk) rewriteScalarArg(e expr.Node) expr.Node {
 		// have a known output size of 0 or 1,
 		// and make users provide LIMIT 1 if they
 		// really mean just the first result
-		h.err = errorf(e, "scalar sub-query %q has unbounded results; use LIMIT 1", expr.ToString(s))
+		h.err = errorf(e, "scalar sub-query %q has unbounded results%s; use LIMIT 1", expr.ToString(s), t.estimated(est))
 		return e
 	}
 }
@@ -15,6 +15,7 @@
 package pir
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/fs"
 	"path/filepath"
@@ -1030,6 +1031,25 @@ ORDER BY m, d, h`,
 			},
 			results: []expr.TypeSet{expr.StringType},
 		},
+		{
+			// INSERT INTO keeps the table name
+			input: `INSERT INTO my.stats SELECT x, SUM(y) FROM foo GROUP BY x`,
+			expect: []string{
+				"ITERATE foo FIELDS [x, y]",
+				"AGGREGATE SUM(y) AS \"sum\" BY x AS x",
+				"OUTPUT PART db/my/stats",
+				"OUTPUT INDEX my.stats AT db/my/stats (INSERT INTO)",
+			},
+			split: []string{
+				"UNION MAP foo (",
+				"	ITERATE PART foo FIELDS [x, y]",
+				"	AGGREGATE SUM(y) AS $_2_0 BY x AS x)",
+				"AGGREGATE SUM($_2_0) AS \"sum\" BY x AS x",
+				"OUTPUT PART db/my/stats",
+				"OUTPUT INDEX my.stats AT db/my/stats (INSERT INTO)",
+			},
+			results: []expr.TypeSet{expr.StringType},
+		},
 		{
 			// EXISTS -> semi-join
 			input: `SELECT x, EXISTS(SELECT * FROM other WHERE key = x) AS has_other FROM input`,
@@ -1400,3 +1420,350 @@ func parseTestcase(fname string) (*buildTestcase, error) {
 
 	return &tc, nil
 }
+
+// rowFilterEnv is an Env that
+// implements RowFilterer
+type rowFilterEnv map[string]expr.Node
+
+func (r rowFilterEnv) Schema(expr.Node) expr.Hint { return nil }
+
+func (r rowFilterEnv) Index(expr.Node) (Index, error) { return nil, nil }
+
+func (r rowFilterEnv) RowFilter(tbl expr.Node) (expr.Node, error) {
+	return r[expr.ToString(tbl)], nil
+}
+
+func TestRowFilter(t *testing.T) {
+	env := rowFilterEnv{
+		"t": expr.Compare(expr.Equals, expr.Identifier("org_id"), expr.String("acme")),
+		"u": expr.Compare(expr.Less, expr.Identifier("level"), expr.Integer(3)),
+	}
+	tcs := []struct {
+		input  string
+		expect []string
+	}{
+		{
+			input: "SELECT * FROM t",
+			expect: []string{
+				"ITERATE t FIELDS * WHERE org_id = 'acme'",
+			},
+		},
+		{
+			input: "SELECT x FROM t WHERE y > 1 OR org_id <> 'acme'",
+			expect: []string{
+				"ITERATE t FIELDS [org_id, x, y] WHERE org_id = 'acme' AND (y > 1 OR org_id <> 'acme')",
+				"PROJECT x AS x",
+			},
+		},
+		{
+			input: "SELECT a.x FROM t AS a WHERE a.y > 1",
+			expect: []string{
+				"ITERATE t AS a FIELDS [org_id, x, y] WHERE org_id = 'acme' AND y > 1",
+				"PROJECT x AS x",
+			},
+		},
+		{
+			input: "SELECT x, (SELECT COUNT(*) FROM u) AS c FROM t",
+			expect: []string{
+				"WITH (",
+				"	ITERATE u FIELDS [level] WHERE level < 3",
+				"	AGGREGATE COUNT(*) AS \"count\"",
+				") AS REPLACEMENT(0)",
+				"ITERATE t FIELDS [org_id, x] WHERE org_id = 'acme'",
+				"PROJECT x AS x, SCALAR_REPLACEMENT(0) AS c",
+			},
+		},
+	}
+	for i := range tcs {
+		q, err := partiql.Parse([]byte(tcs[i].input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := Build(q, env)
+		if err != nil {
+			t.Fatalf("%s: %s", tcs[i].input, err)
+		}
+		var out strings.Builder
+		NoSplit(b).Describe(&out)
+		got := out.String()
+		want := strings.Join(tcs[i].expect, "\n") + "\n"
+		if got != want {
+			t.Errorf("%s: got:\n%s", tcs[i].input, got)
+			t.Errorf("want:\n%s", want)
+		}
+	}
+}
+
+// rowFilterIndexEnv is a rowFilterEnv
+// with an index for every table
+type rowFilterIndexEnv struct {
+	rowFilterEnv
+	idx *blockfmt.Index
+}
+
+func (r *rowFilterIndexEnv) Index(expr.Node) (Index, error) { return r.idx, nil }
+
+func TestRowFilterIndex(t *testing.T) {
+	basetime, _ := date.Parse([]byte("2022-02-22T20:22:22Z"))
+	// the index covers the rows of every org,
+	// so it must not be used to answer the query
+	env := &rowFilterIndexEnv{
+		rowFilterEnv: rowFilterEnv{
+			"t": expr.Compare(expr.Equals, expr.Identifier("org_id"), expr.String("acme")),
+		},
+		idx: mkindex([][]blockfmt.Range{{
+			timeRange("ts", basetime, basetime.Add(time.Hour)),
+		}, {
+			timeRange("ts", basetime.Add(time.Hour), basetime.Add(2*time.Hour)),
+		}}),
+	}
+	q, err := partiql.Parse([]byte("SELECT EARLIEST(ts), LATEST(ts) FROM t"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Build(q, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	NoSplit(b).Describe(&out)
+	got := out.String()
+	want := strings.Join([]string{
+		"ITERATE t FIELDS [org_id, ts] WHERE org_id = 'acme'",
+		"AGGREGATE EARLIEST(ts) AS \"min\", LATEST(ts) AS \"max\"",
+	}, "\n") + "\n"
+	if got != want {
+		t.Errorf("got:\n%s", got)
+		t.Errorf("want:\n%s", want)
+	}
+}
+
+// maskEnv masks the fields of every
+// table: a field that maps to nil is masked
+// by the table itself, and any other field
+// is replaced with the expression it maps to
+type maskEnv struct {
+	masks map[string]expr.Node
+	idx   *blockfmt.Index
+}
+
+func (m *maskEnv) Schema(expr.Node) expr.Hint { return nil }
+
+func (m *maskEnv) Index(expr.Node) (Index, error) { return m.idx, nil }
+
+func (m *maskEnv) Mask(tbl expr.Node, p *expr.Path) expr.Node {
+	r, ok := m.masks[expr.ToString(p)]
+	if !ok {
+		return nil
+	}
+	if r == nil {
+		return p
+	}
+	return r
+}
+
+func TestMask(t *testing.T) {
+	basetime, _ := date.Parse([]byte("2022-02-22T20:22:22Z"))
+	env := &maskEnv{
+		masks: map[string]expr.Node{
+			"ts":     nil,
+			"secret": expr.Missing{},
+		},
+		idx: mkindex([][]blockfmt.Range{{
+			timeRange("ts", basetime, basetime.Add(time.Hour)),
+		}, {
+			timeRange("ts", basetime.Add(time.Hour), basetime.Add(2*time.Hour)),
+		}}),
+	}
+	tcs := []struct {
+		input  string
+		expect []string
+	}{
+		{
+			// the index describes the values
+			// of ts before they are masked,
+			// so it must not be used to answer the query
+			input: "SELECT EARLIEST(ts), LATEST(ts) FROM t",
+			expect: []string{
+				"ITERATE t FIELDS [ts]",
+				"AGGREGATE EARLIEST(ts) AS \"min\", LATEST(ts) AS \"max\"",
+			},
+		},
+		{
+			input: "SELECT a.x, a.secret AS s FROM t AS a WHERE a.x > 1",
+			expect: []string{
+				"ITERATE t AS a FIELDS [x] WHERE x > 1",
+				"PROJECT x AS x, MISSING AS s",
+			},
+		},
+		{
+			// no row can satisfy the filter, whatever
+			// the value of the field is before it is masked
+			input: "SELECT COUNT(*) FROM t WHERE secret = 'xyz'",
+			expect: []string{
+				"ITERATE t FIELDS [] WHERE MISSING",
+				"AGGREGATE COUNT(*) AS \"count\"",
+			},
+		},
+	}
+	for i := range tcs {
+		q, err := partiql.Parse([]byte(tcs[i].input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := Build(q, env)
+		if err != nil {
+			t.Fatalf("%s: %s", tcs[i].input, err)
+		}
+		var out strings.Builder
+		NoSplit(b).Describe(&out)
+		got := out.String()
+		want := strings.Join(tcs[i].expect, "\n") + "\n"
+		if got != want {
+			t.Errorf("%s: got:\n%s", tcs[i].input, got)
+			t.Errorf("want:\n%s", want)
+		}
+	}
+}
+
+func TestSchemaUnknownField(t *testing.T) {
+	env := &testenv{
+		hint: mkschema("x", expr.IntegerType, "y", expr.StringType|expr.MissingType),
+	}
+	tcs := []struct {
+		input string
+		err   string // empty if no error expected
+	}{
+		{input: "SELECT x, y FROM t"},
+		{input: "SELECT t.x FROM t AS t WHERE t.y = 'foo'"},
+		{input: "SELECT * FROM t"},
+		{
+			input: "SELECT x, z FROM t",
+			err:   "field z is not in the schema of table t",
+		},
+		{
+			input: "SELECT a.x, a.z FROM t AS a",
+			err:   "field z is not in the schema of table t",
+		},
+		{
+			input: "SELECT x.y FROM t",
+			err:   "field x.y is not in the schema of table t",
+		},
+	}
+	for i := range tcs {
+		q, err := partiql.Parse([]byte(tcs[i].input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = Build(q, env)
+		if tcs[i].err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %s", tcs[i].input, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: expected an error", tcs[i].input)
+		} else if !strings.Contains(err.Error(), tcs[i].err) {
+			t.Errorf("%s: got error %q; want %q", tcs[i].input, err, tcs[i].err)
+		}
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	tcs := []struct {
+		input string
+		binds []string // JSON-encoded bindings
+		bad   string   // JSON-encoded bindings that fail to check
+	}{
+		{
+			input: "SELECT x, y FROM t WHERE x > ? AND y = ?",
+			binds: []string{`[1, "foo"]`, `[2, "bar"]`},
+		},
+		{
+			input: "SELECT COUNT(*), SUM(x + $n) AS s FROM t WHERE y = $y GROUP BY z ORDER BY s DESC LIMIT 10",
+			binds: []string{`{"n": 1, "y": "a"}`, `{"n": 2.5, "y": "b"}`},
+		},
+		{
+			input: "SELECT x FROM t WHERE y = (SELECT MAX(y) FROM u WHERE z = ?)",
+			binds: []string{`[3]`, `["str"]`},
+		},
+		{
+			input: "SELECT DISTINCT x FROM t WHERE x <> $x",
+			binds: []string{`{"x": "xyz"}`},
+		},
+		{
+			input: "SELECT x FROM t WHERE NOT ?",
+			binds: []string{`[false]`},
+			bad:   `["xyz"]`,
+		},
+	}
+	bindings := func(str string) *expr.Bindings {
+		var st ion.Symtab
+		d, err := ion.FromJSON(&st, json.NewDecoder(strings.NewReader(str)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bind, err := expr.NewBindings(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bind
+	}
+	describe := func(b *Trace) string {
+		var out strings.Builder
+		b.Describe(&out)
+		return out.String()
+	}
+	for i := range tcs {
+		q, err := partiql.Parse([]byte(tcs[i].input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		prep, err := Prepare(q, nil)
+		if err != nil {
+			t.Fatalf("%s: %s", tcs[i].input, err)
+		}
+		before := describe(prep)
+		if _, err := prep.BindParams(nil); err == nil {
+			t.Errorf("%s: binding no values succeeded", tcs[i].input)
+		}
+		if tcs[i].bad != "" {
+			if _, err := prep.BindParams(bindings(tcs[i].bad)); err == nil {
+				t.Errorf("%s: binding %s succeeded", tcs[i].input, tcs[i].bad)
+			}
+		}
+		for _, str := range tcs[i].binds {
+			bind := bindings(str)
+			bq, err := q.Bind(bind)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := Build(bq, nil)
+			if err != nil {
+				t.Fatalf("%s: %s", tcs[i].input, err)
+			}
+			got, err := prep.BindParams(bind)
+			if err != nil {
+				t.Fatalf("%s with %s: %s", tcs[i].input, str, err)
+			}
+			want, err = Split(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err = Split(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if g, w := describe(got), describe(want); g != w {
+				t.Errorf("%s with %s: got:\n%s", tcs[i].input, str, g)
+				t.Errorf("want:\n%s", w)
+			}
+		}
+		// binding and splitting must not
+		// modify the prepared trace
+		if after := describe(prep); after != before {
+			t.Errorf("%s: prepared trace changed from\n%s\nto\n%s", tcs[i].input, before, after)
+		}
+	}
+}
@@ -14,6 +14,13 @@
 
 package pir
 
+import (
+	"fmt"
+	"math"
+
+	"github.com/SnellerInc/sneller/expr"
+)
+
 // SizeClass is one of the output
 // size classifications.
 // See SizeZero, SizeOne, etc.
@@ -130,3 +137,389 @@ func (b *Trace) Class() SizeClass {
 	}
 	return cur
 }
+
+// Statistics may optionally be implemented
+// by an Index to provide the table statistics
+// that are used to estimate the cardinality
+// of query results.
+type Statistics interface {
+	// Rows returns the number of rows in the table.
+	Rows() (n int64, ok bool)
+	// Distinct returns the estimated number
+	// of distinct non-null values of the
+	// top-level field with the given name.
+	Distinct(field string) (n int64, ok bool)
+	// NullFraction returns the estimated
+	// fraction of rows in which the top-level
+	// field with the given name is null or missing.
+	NullFraction(field string) (f float64, ok bool)
+}
+
+const (
+	// smallEstimate is the largest estimated
+	// cardinality of a trace with inexact cardinality
+	// that is considered to be "small"; it leaves room
+	// for estimation errors below LargeSize
+	smallEstimate = LargeSize / 2
+	// largeEstimate is the smallest estimated
+	// cardinality of a trace with inexact cardinality
+	// that is considered to be too large to be "small"
+	largeEstimate = 2 * LargeSize
+)
+
+// Estimate returns the estimated number of rows
+// produced by the trace, or false if the number
+// of rows cannot be estimated because there are
+// no statistics (see Statistics) for the tables
+// referenced by the trace.
+func (b *Trace) Estimate() (int64, bool) {
+	return b.estimate(b.top)
+}
+
+// estimatedClass returns the size class of the
+// trace along with its estimated cardinality
+// (or -1 if it cannot be estimated)
+//
+// The classes of traces with exact cardinality
+// are returned unchanged. Otherwise, traces that
+// are estimated to produce at most smallEstimate
+// rows are SizeColumnCardinality, and traces that
+// are estimated to produce more than largeEstimate
+// rows are SizeUnknown.
+func (b *Trace) estimatedClass() (SizeClass, int64) {
+	c := b.Class()
+	n, ok := b.Estimate()
+	if !ok {
+		return c, -1
+	}
+	if !c.Exact() {
+		if n <= smallEstimate {
+			c = SizeColumnCardinality
+		} else if n > largeEstimate {
+			c = SizeUnknown
+		}
+	}
+	return c, n
+}
+
+// estimate estimates the number of rows
+// produced by s, which is a step of b
+func (b *Trace) estimate(s Step) (int64, bool) {
+	switch s := s.(type) {
+	case *IterTable:
+		stats, ok := s.Index.(Statistics)
+		if !ok {
+			return 0, false
+		}
+		n, ok := stats.Rows()
+		if !ok {
+			return 0, false
+		}
+		if s.Filter != nil {
+			n = scale(n, b.selectivity(s, s.Filter))
+		}
+		return n, true
+	case NoOutput:
+		return 0, true
+	case DummyOutput:
+		return 1, true
+	case *Filter:
+		n, ok := b.estimate(s.parent())
+		return scale(n, b.selectivity(s.parent(), s.Where)), ok
+	case *Limit:
+		n, ok := b.estimate(s.parent())
+		if !ok || n > s.Count {
+			n = s.Count
+		}
+		return n, true
+	case *Aggregate:
+		if s.GroupBy == nil {
+			return 1, true
+		}
+		n, ok := b.estimate(s.parent())
+		if !ok {
+			return 0, false
+		}
+		cols := make([]expr.Node, len(s.GroupBy))
+		for i := range s.GroupBy {
+			cols[i] = s.GroupBy[i].Expr
+		}
+		return groups(s.parent(), cols, n)
+	case *Distinct:
+		n, ok := b.estimate(s.parent())
+		if !ok {
+			return 0, false
+		}
+		return groups(s.parent(), s.Columns, n)
+	case *Bind, *Order:
+		return b.estimate(s.parent())
+	}
+	return 0, false
+}
+
+func scale(n int64, f float64) int64 {
+	return int64(math.Ceil(float64(n) * f))
+}
+
+// column determines the table and the top-level
+// field of the table that e refers to when it is
+// evaluated against the output of s
+func column(s Step, e expr.Node) (Statistics, string, bool) {
+	p, ok := e.(*expr.Path)
+	if !ok || p.Rest != nil {
+		return nil, "", false
+	}
+	name := p.First
+	for s != nil {
+		switch st := s.(type) {
+		case *IterTable:
+			if name == st.Table.Result() {
+				return nil, "", false
+			}
+			// the statistics describe the
+			// values of the field before
+			// it is masked
+			if st.mask(&expr.Path{First: name}) != nil {
+				return nil, "", false
+			}
+			stats, ok := st.Index.(Statistics)
+			return stats, name, ok
+		case *Bind:
+			found := false
+			for i := len(st.bind) - 1; i >= 0; i-- {
+				if st.bind[i].Result() != name {
+					continue
+				}
+				p, ok := st.bind[i].Expr.(*expr.Path)
+				if !ok || p.Rest != nil {
+					return nil, "", false
+				}
+				name = p.First
+				found = true
+				break
+			}
+			if !found && st.complete {
+				return nil, "", false
+			}
+		case *IterValue:
+			if name == st.Result {
+				return nil, "", false
+			}
+		case *Filter, *Order, *Limit, *Distinct:
+			// rows pass through unchanged
+		default:
+			return nil, "", false
+		}
+		s = s.parent()
+	}
+	return nil, "", false
+}
+
+// groups estimates the number of distinct
+// combinations of cols in n rows produced by s
+func groups(s Step, cols []expr.Node, n int64) (int64, bool) {
+	total := int64(1)
+	for i := range cols {
+		stats, name, ok := column(s, cols[i])
+		if !ok {
+			return 0, false
+		}
+		d, ok := stats.Distinct(name)
+		if !ok {
+			return 0, false
+		}
+		// null and missing values form a group
+		if f, ok := stats.NullFraction(name); !ok || f > 0 {
+			d++
+		}
+		if d == 0 {
+			return 0, true
+		}
+		if total > n/d {
+			return n, true
+		}
+		total *= d
+	}
+	if total > n {
+		total = n
+	}
+	return total, true
+}
+
+// selectivity estimates the fraction of the
+// rows produced by s that satisfy e
+//
+// Predicates that can't be estimated from the
+// table statistics are assumed to be satisfied
+// by every row, so that the estimate is an upper
+// bound unless equality comparisons are involved.
+//
+// Semi-joins against other tables (the results of
+// IN (SELECT ...) and scalar sub-queries; see b.Replacements)
+// are estimated from the estimated cardinality of the
+// replacement, so that the filters of a query that
+// references several tables can be ordered as well.
+func (b *Trace) selectivity(s Step, e expr.Node) float64 {
+	switch e := e.(type) {
+	case expr.Bool:
+		if e {
+			return 1
+		}
+		return 0
+	case *expr.Logical:
+		l, r := b.selectivity(s, e.Left), b.selectivity(s, e.Right)
+		switch e.Op {
+		case expr.OpAnd:
+			return l * r
+		case expr.OpOr:
+			return l + r - l*r
+		}
+	case *expr.IsKey:
+		stats, name, ok := column(s, e.Expr)
+		if !ok {
+			return 1
+		}
+		f, ok := stats.NullFraction(name)
+		if !ok {
+			return 1
+		}
+		switch e.Key {
+		case expr.IsNull, expr.IsMissing:
+			return f
+		case expr.IsNotNull, expr.IsNotMissing:
+			return 1 - f
+		}
+	case *expr.Comparison:
+		if e.Op != expr.Equals {
+			return 1
+		}
+		arg, k := e.Left, e.Right
+		if scalar(arg) {
+			arg, k = k, arg
+		}
+		if !scalar(k) {
+			return 1
+		}
+		return equality(s, arg, 1)
+	case *expr.Member:
+		return equality(s, e.Arg, int64(len(e.Values)))
+	case *expr.Builtin:
+		if e.Func != expr.InReplacement {
+			return 1
+		}
+		n, ok := b.replacementRows(e.Args[1])
+		if !ok {
+			return 1
+		}
+		return equality(s, e.Args[0], n)
+	}
+	return 1
+}
+
+// scalar returns true if e is a constant
+// or the result of a scalar sub-query
+func scalar(e expr.Node) bool {
+	if _, ok := e.(expr.Constant); ok {
+		return true
+	}
+	bi, ok := e.(*expr.Builtin)
+	return ok && bi.Func == expr.ScalarReplacement
+}
+
+// replacementRows returns the estimated
+// number of rows in the replacement with
+// the given index (see IN_REPLACEMENT)
+func (b *Trace) replacementRows(index expr.Node) (int64, bool) {
+	i, ok := index.(expr.Integer)
+	if !ok || int(i) < 0 || int(i) >= len(b.Replacements) {
+		return 0, false
+	}
+	return b.Replacements[i].Estimate()
+}
+
+// equality estimates the fraction of rows
+// in which e is equal to one of n constants
+func equality(s Step, e expr.Node, n int64) float64 {
+	stats, name, ok := column(s, e)
+	if !ok {
+		return 1
+	}
+	d, ok := stats.Distinct(name)
+	if !ok {
+		return 1
+	}
+	f, ok := stats.NullFraction(name)
+	if !ok {
+		return 1
+	}
+	if d == 0 {
+		return 0
+	}
+	if n >= d {
+		return 1 - f
+	}
+	return (1 - f) * float64(n) / float64(d)
+}
+
+// pushDistinct inserts a DISTINCT before the
+// final projection of a trace that produces
+// one column if the distinct results of the
+// trace are estimated to be "small," and
+// returns whether or not it did so
+func (b *Trace) pushDistinct() bool {
+	bi, ok := b.top.(*Bind)
+	if !ok || len(bi.bind) != 1 {
+		return false
+	}
+	di := &Distinct{Columns: []expr.Node{bi.bind[0].Expr}}
+	di.setparent(bi.parent())
+	n, ok := b.estimate(di)
+	if !ok || n > smallEstimate {
+		return false
+	}
+	bi.setparent(di)
+	return true
+}
+
+// bound limits the results of a trace that is
+// only estimated to be "small" (i.e. whose size
+// class from Trace.Class is not small) to LargeSize+1
+// rows. The estimates are not upper bounds, so the
+// limit keeps the replacement from being materialized
+// without bound, and a replacement with more than
+// LargeSize rows fails when the query is executed
+// rather than being truncated silently.
+func (b *Trace) bound(before SizeClass) {
+	if before.Small() {
+		return
+	}
+	l := &Limit{Count: LargeSize + 1}
+	l.setparent(b.top)
+	b.top = l
+}
+
+// restricted returns true if any of the tables
+// that the trace iterates has a row filter
+// (see IterTable.restrict)
+func (b *Trace) restricted() bool {
+	for s := b.top; s != nil; s = s.parent() {
+		if it, ok := s.(*IterTable); ok && it.restricted {
+			return true
+		}
+	}
+	return false
+}
+
+// estimated describes the estimated
+// cardinality n of the trace (see Trace.estimatedClass)
+// in an error message
+//
+// The estimate is computed from statistics that
+// describe every row in a table, so it is omitted
+// if the trace is restricted by a row filter.
+func (b *Trace) estimated(n int64) string {
+	if n < 0 || b.restricted() {
+		return ""
+	}
+	return fmt.Sprintf(" (estimated %d rows)", n)
+}
@@ -16,8 +16,10 @@ package pir
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 
+	"github.com/SnellerInc/sneller/date"
 	"github.com/SnellerInc/sneller/expr"
 	"github.com/SnellerInc/sneller/expr/partiql"
 )
@@ -89,3 +91,222 @@ func TestCardinality(t *testing.T) {
 		}
 	}
 }
+
+// statsIndex is an Index with fixed statistics
+type statsIndex struct {
+	rows     int64
+	distinct map[string]int64
+	nulls    map[string]float64
+}
+
+func (s *statsIndex) TimeRange(*expr.Path) (min, max date.Time, ok bool) {
+	return date.Time{}, date.Time{}, false
+}
+
+func (s *statsIndex) Rows() (int64, bool) { return s.rows, true }
+
+func (s *statsIndex) Distinct(field string) (int64, bool) {
+	n, ok := s.distinct[field]
+	return n, ok
+}
+
+func (s *statsIndex) NullFraction(field string) (float64, bool) {
+	f, ok := s.nulls[field]
+	return f, ok
+}
+
+type statsEnv map[string]*statsIndex
+
+func (e statsEnv) Schema(expr.Node) expr.Hint { return nil }
+
+func (e statsEnv) Index(tbl expr.Node) (Index, error) {
+	if idx, ok := e[expr.ToString(tbl)]; ok {
+		return idx, nil
+	}
+	return nil, nil
+}
+
+func TestEstimate(t *testing.T) {
+	env := statsEnv{
+		"big": &statsIndex{
+			rows:     1000000,
+			distinct: map[string]int64{"id": 1000000, "x": 900000, "grp": 50},
+			nulls:    map[string]float64{"id": 0, "x": 0.1, "grp": 0},
+		},
+		"small": &statsIndex{
+			rows:     100,
+			distinct: map[string]int64{"y": 100},
+			nulls:    map[string]float64{"y": 0},
+		},
+	}
+	estimates := []struct {
+		query string
+		want  int64
+	}{
+		{"SELECT * FROM big", 1000000},
+		{"SELECT id FROM big WHERE grp = 'a'", 20000},
+		{"SELECT id FROM big WHERE grp IN ('a', 'b') AND x IS NOT NULL", 35641},
+		{"SELECT id FROM big WHERE id > 3", 1000000},
+		{"SELECT DISTINCT grp FROM big", 50},
+		{"SELECT grp, COUNT(*) FROM big GROUP BY grp", 50},
+		{"SELECT id, grp, COUNT(*) FROM big GROUP BY id, grp", 1000000},
+		{"SELECT x, COUNT(*) FROM big GROUP BY x", 900001},
+		{"SELECT * FROM big LIMIT 10", 10},
+		{"SELECT COUNT(*) FROM big", 1},
+	}
+	for i := range estimates {
+		q, err := partiql.Parse([]byte(estimates[i].query))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := Build(q, env)
+		if err != nil {
+			t.Fatalf("%s: %s", estimates[i].query, err)
+		}
+		n, ok := b.Estimate()
+		if !ok || n != estimates[i].want {
+			t.Errorf("%s: got estimate %d (%v), want %d", estimates[i].query, n, ok, estimates[i].want)
+		}
+	}
+
+	plans := []struct {
+		query  string
+		expect []string
+		err    string
+	}{
+		{
+			// small enough for a replacement
+			// without a LIMIT
+			query: "SELECT id FROM big WHERE x IN (SELECT y FROM small)",
+			expect: []string{
+				"WITH (",
+				"	ITERATE small FIELDS [y]",
+				"	PROJECT y AS y",
+				"	LIMIT 10001",
+				") AS REPLACEMENT(0)",
+				"ITERATE big FIELDS [id, x] WHERE IN_REPLACEMENT(x, 0)",
+				"PROJECT id AS id",
+			},
+		},
+		{
+			// the distinct results are small
+			query: "SELECT id FROM big WHERE x IN (SELECT grp FROM big WHERE id > 10)",
+			expect: []string{
+				"WITH (",
+				"	ITERATE big FIELDS [grp, id] WHERE id > 10",
+				"	FILTER DISTINCT [grp]",
+				"	PROJECT grp AS grp",
+				"	LIMIT 10001",
+				") AS REPLACEMENT(0)",
+				"ITERATE big FIELDS [id, x] WHERE IN_REPLACEMENT(x, 0)",
+				"PROJECT id AS id",
+			},
+		},
+		{
+			// the most selective filter comes first
+			query: "SELECT id FROM big WHERE id > 10 AND grp = 'a'",
+			expect: []string{
+				"ITERATE big FIELDS [grp, id] WHERE grp = 'a' AND id > 10",
+				"PROJECT id AS id",
+			},
+		},
+		{
+			// the semi-join against small is
+			// more selective than grp = 'a'
+			query: "SELECT id FROM big WHERE grp = 'a' AND id IN (SELECT y FROM small)",
+			expect: []string{
+				"WITH (",
+				"	ITERATE small FIELDS [y]",
+				"	PROJECT y AS y",
+				"	LIMIT 10001",
+				") AS REPLACEMENT(0)",
+				"ITERATE big FIELDS [grp, id] WHERE IN_REPLACEMENT(id, 0) AND grp = 'a'",
+				"PROJECT id AS id",
+			},
+		},
+		{
+			// ... but not more selective than id = 3
+			query: "SELECT id FROM big WHERE grp IN (SELECT y FROM small) AND id = 3",
+			expect: []string{
+				"WITH (",
+				"	ITERATE small FIELDS [y]",
+				"	PROJECT y AS y",
+				"	LIMIT 10001",
+				") AS REPLACEMENT(0)",
+				"ITERATE big FIELDS [grp, id] WHERE id = 3 AND IN_REPLACEMENT(grp, 0)",
+				"PROJECT id AS id",
+			},
+		},
+		{
+			query: "SELECT id FROM big WHERE x IN (SELECT id FROM big)",
+			err:   "estimated 1000000 rows",
+		},
+		{
+			query: "SELECT y, (SELECT x, COUNT(*) FROM big GROUP BY x) AS z FROM small",
+			err:   "estimated 900001 rows",
+		},
+	}
+	for i := range plans {
+		q, err := partiql.Parse([]byte(plans[i].query))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := Build(q, env)
+		if plans[i].err != "" {
+			if err == nil || !strings.Contains(err.Error(), plans[i].err) {
+				t.Errorf("%s: got error %v, want %q", plans[i].query, err, plans[i].err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", plans[i].query, err)
+		}
+		var out strings.Builder
+		NoSplit(b).Describe(&out)
+		got := out.String()
+		want := strings.Join(plans[i].expect, "\n") + "\n"
+		if got != want {
+			t.Errorf("%s: got:\n%s", plans[i].query, got)
+			t.Errorf("want:\n%s", want)
+		}
+	}
+}
+
+// restrictedStatsEnv is a statsEnv
+// with row filters (see RowFilterer)
+type restrictedStatsEnv struct {
+	statsEnv
+	filters rowFilterEnv
+}
+
+func (e *restrictedStatsEnv) RowFilter(tbl expr.Node) (expr.Node, error) {
+	return e.filters.RowFilter(tbl)
+}
+
+func TestEstimateRestricted(t *testing.T) {
+	env := &restrictedStatsEnv{
+		statsEnv: statsEnv{
+			"big": &statsIndex{
+				rows:     1000000,
+				distinct: map[string]int64{"id": 1000000, "org": 2},
+				nulls:    map[string]float64{"id": 0, "org": 0},
+			},
+		},
+		filters: rowFilterEnv{
+			"big": expr.Compare(expr.Equals, expr.Identifier("org"), expr.String("acme")),
+		},
+	}
+	q, err := partiql.Parse([]byte("SELECT id FROM big WHERE id IN (SELECT id FROM big)"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the statistics describe the rows of every org,
+	// so the estimate must not appear in the error
+	_, err = Build(q, env)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if strings.Contains(err.Error(), "estimated") {
+		t.Fatalf("error includes the estimate: %s", err)
+	}
+}
@@ -16,6 +16,8 @@ package pir
 
 import (
 	"github.com/SnellerInc/sneller/expr"
+
+	"golang.org/x/exp/slices"
 )
 
 func filterelim(b *Trace) {
@@ -201,3 +203,49 @@ func filterpushdown(b *Trace) {
 		}
 	}
 }
+
+// filterorder orders the conjunctions in the
+// filters of tables with statistics so that the
+// conjunctions that are estimated to be the most
+// selective are evaluated first, including
+// semi-joins against the results of sub-queries
+// over other tables (see Trace.selectivity)
+func filterorder(b *Trace) {
+	for s := b.top; s != nil; s = s.parent() {
+		it, ok := s.(*IterTable)
+		if !ok || it.Filter == nil {
+			continue
+		}
+		stats, ok := it.Index.(Statistics)
+		if !ok {
+			continue
+		}
+		if _, ok := stats.Rows(); !ok {
+			continue
+		}
+		conj := conjunctions(it.Filter, nil)
+		sel := make([]float64, len(conj))
+		same := true
+		for i := range conj {
+			sel[i] = b.selectivity(it, conj[i])
+			same = same && sel[i] == sel[0]
+		}
+		if same {
+			continue
+		}
+		order := make([]int, len(conj))
+		for i := range order {
+			order[i] = i
+		}
+		slices.SortStableFunc(order, func(i, j int) bool {
+			return sel[i] < sel[j]
+		})
+		// conjoinAll joins the conjunctions
+		// in reverse order
+		lst := make([]expr.Node, len(conj))
+		for i, j := range order {
+			lst[len(lst)-1-i] = conj[j]
+		}
+		it.Filter = conjoinAll(lst, b)
+	}
+}
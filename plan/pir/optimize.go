@@ -57,6 +57,7 @@ func (b *Trace) optimize() {
 	strengthReduce(b)      // strength-reduce kernels, replacing generic subtraces with their case-specific optimized variants
 	filterelim(b)          // eliminate WHERE TRUE
 	filterpushdown(b)      // merge adjacent filters
+	filterorder(b)         // evaluate the most selective filters first
 	projectpushdown(b)     // merge adjacent projections
 	projectelim(b)         // drop un-used bindings
 	limitpushdown(b)       // push down LIMIT
@@ -94,6 +94,13 @@ type IterTable struct {
 	Schema      expr.Hint
 	Index       Index
 	Partitioned bool
+
+	// restricted is set if Filter
+	// includes a row filter (see restrict)
+	restricted bool
+	// masker is set if the fields of
+	// the table may be masked
+	masker Masker
 }
 
 func (i *IterTable) equals(x Step) bool {
@@ -114,12 +121,23 @@ func (i *IterTable) rewrite(rw func(expr.Node, bool) expr.Node) {
 }
 
 func (i *IterTable) timeRange(p *expr.Path) (min, max date.Time, ok bool) {
-	if i.Index == nil {
+	if i.Index == nil || i.mask(p) != nil {
 		return date.Time{}, date.Time{}, false
 	}
 	return i.Index.TimeRange(p)
 }
 
+// mask returns the expression that replaces
+// the reference p to a field of the table,
+// or nil if the field is not masked
+// (see Masker.Mask)
+func (i *IterTable) mask(p *expr.Path) expr.Node {
+	if i.masker == nil {
+		return nil
+	}
+	return i.masker.Mask(i.Table.Expr, p)
+}
+
 // Wildcard returns true if the table
 // is referenced by the '*' operator
 // (in other words, if all column bindings
@@ -612,6 +630,9 @@ func (o *OutputPart) get(x string) (Step, expr.Node) {
 type OutputIndex struct {
 	Table    *expr.Path
 	Basename string
+	// Mode determines whether the output
+	// is stored in a new table or in Table.
+	Mode expr.IntoMode
 	parented
 	noexprs
 }
@@ -619,10 +640,14 @@ type OutputIndex struct {
 func (o *OutputIndex) equals(x Step) bool {
 	o2, ok := x.(*OutputIndex)
 	return ok && (o == o2 || o.Table.Equals(o2.Table) &&
-		o.Basename == o2.Basename)
+		o.Basename == o2.Basename && o.Mode == o2.Mode)
 }
 
 func (o *OutputIndex) describe(dst io.Writer) {
+	if o.Mode != expr.IntoNew {
+		fmt.Fprintf(dst, "OUTPUT INDEX %s AT %s (%s)\n", expr.ToString(o.Table), o.Basename, o.Mode)
+		return
+	}
 	fmt.Fprintf(dst, "OUTPUT INDEX %s AT %s\n", expr.ToString(o.Table), o.Basename)
 }
 
@@ -705,6 +730,14 @@ type Trace struct {
 	scope map[*expr.Path]scopeinfo
 	err   []error
 
+	// masked maps references to masked fields
+	// to their replacements (see applyMasks)
+	masked map[*expr.Path]expr.Node
+
+	// prepared is set if the trace may
+	// contain unbound parameters (see Prepare)
+	prepared bool
+
 	// final is the most recent
 	// complete set of bindings
 	// produced by an expression
@@ -744,11 +777,63 @@ func (b *Trace) Begin(f *expr.Table, e Env) error {
 			return err
 		}
 		it.Index = idx
+		it.masker, _ = e.(Masker)
+		if rf, ok := e.(RowFilterer); ok {
+			flt, err := rf.RowFilter(f.Expr)
+			if err != nil {
+				return err
+			}
+			if flt != nil {
+				if err := it.restrict(flt); err != nil {
+					return err
+				}
+			}
+		}
 	}
 	b.top = it
 	return nil
 }
 
+// restrict sets the filter of the table to a
+// row filter returned by RowFilterer.RowFilter
+//
+// Since the row filter is applied before any
+// other part of the query is built, every other
+// filter on the table is conjoined with it, so
+// there is no way for the rest of the query
+// to observe rows that don't satisfy it.
+func (i *IterTable) restrict(flt expr.Node) error {
+	flt = expr.Copy(flt)
+	if err := expr.Check(flt); err != nil {
+		return err
+	}
+	var err error
+	visit := visitfn(func(e expr.Node) bool {
+		if err != nil {
+			return false
+		}
+		switch e := e.(type) {
+		case *expr.Select:
+			err = errorf(e, "sub-query not allowed in row filter")
+			return false
+		case *expr.Aggregate:
+			err = errorf(e, "aggregate not allowed in row filter")
+			return false
+		case *expr.Path:
+			i.get(e.First)
+			return false
+		}
+		return true
+	})
+	expr.Walk(visit, flt)
+	if err != nil {
+		return err
+	}
+	i.Filter = flt
+	i.restricted = true
+	return nil
+}
+
 func (b *Trace) beginUnionMap(src *Trace, table *IterTable) {
 	// we know that the result of a
 	// parallelized query ought to be
@@ -921,13 +1006,14 @@ func (b *Trace) LimitOffset(limit, offset int64) error {
 
 // Into handles the INTO clause by pushing
 // the appropriate OutputIndex and OutputPart nodes.
-func (b *Trace) Into(table *expr.Path, basepath string) {
+func (b *Trace) Into(table *expr.Path, basepath string, mode expr.IntoMode) {
 	op := &OutputPart{Basename: basepath}
 	op.setparent(b.top)
 	b.add(expr.Identifier("part"), op, nil)
 	oi := &OutputIndex{
 		Table:    table,
 		Basename: basepath,
+		Mode:     mode,
 	}
 	oi.setparent(op)
 	b.top = oi
@@ -0,0 +1,371 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package pir
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/SnellerInc/sneller/expr"
+	"github.com/SnellerInc/sneller/vm"
+
+	"golang.org/x/exp/slices"
+)
+
+// Prepare is like Build, except that the
+// parameters of q may be left unbound and
+// q is not modified. The returned Trace must
+// be bound with BindParams before it is split
+// or lowered.
+func Prepare(q *expr.Query, e Env) (*Trace, error) {
+	cp := *q
+	if q.With != nil {
+		cp.With = make([]expr.CTE, len(q.With))
+		for i := range q.With {
+			cp.With[i].Table = q.With[i].Table
+			cp.With[i].As = expr.Copy(q.With[i].As).(*expr.Select)
+		}
+	}
+	cp.Body = expr.Copy(q.Body)
+	return buildQuery(&cp, e, true)
+}
+
+// BindParams returns a copy of b in which each
+// parameter has been replaced with its value
+// in p. The trace b is not modified, so it may
+// be bound any number of times, including
+// concurrently. If p is nil, then b must not
+// contain any parameters.
+//
+// The parameters of the query from which b
+// was built should be checked against p with
+// expr.Bindings.Check before calling BindParams,
+// since optimization may have eliminated
+// some of them from b.
+func (b *Trace) BindParams(p *expr.Bindings) (*Trace, error) {
+	if p == nil {
+		p = &expr.Bindings{}
+	}
+	out := b.clone()
+	if err := out.bindParams(p); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func hasParams(e expr.Node) bool {
+	found := false
+	expr.Walk(visitfn(func(e expr.Node) bool {
+		if _, ok := e.(*expr.Param); ok {
+			found = true
+		}
+		return !found
+	}), e)
+	return found
+}
+
+// bindParams replaces the parameters in b
+// (and in its inputs) with their values
+func (b *Trace) bindParams(p *expr.Bindings) error {
+	b.prepared = false
+	reg := expr.Simplifier(b)
+	log := expr.LogicSimplifier(b)
+	var err error
+	fn := func(e expr.Node, logic bool) expr.Node {
+		if err != nil || !hasParams(e) {
+			return e
+		}
+		e, err = p.Bind(e)
+		if err != nil {
+			return e
+		}
+		e = expr.Rewrite(reg, e)
+		if logic {
+			e = expr.Rewrite(log, e)
+		}
+		err = b.Check(e)
+		return e
+	}
+	for s := b.top; s != nil && err == nil; s = s.parent() {
+		s.rewrite(fn)
+		switch s := s.(type) {
+		case *IterTable:
+			s.elimTrue()
+		case *UnionMap:
+			s.Inner.rewrite(fn)
+			s.Inner.elimTrue()
+			if err == nil {
+				err = s.Child.bindParams(p)
+			}
+		}
+	}
+	// filters may have become trivial
+	filterelim(b)
+	for i := range b.final {
+		b.final[i].Expr = fn(b.final[i].Expr, false)
+	}
+	for i := range b.Replacements {
+		if err != nil {
+			break
+		}
+		err = b.Replacements[i].bindParams(p)
+	}
+	return err
+}
+
+func (i *IterTable) elimTrue() {
+	if i.Filter == expr.Bool(true) {
+		i.Filter = nil
+	}
+}
+
+// cloner makes deep copies of traces
+// along with the scope information that
+// refers to their steps and expressions
+type cloner struct {
+	traces map[*Trace]*Trace
+	steps  map[Step]Step
+	nodes  map[expr.Node]expr.Node
+}
+
+func (b *Trace) clone() *Trace {
+	c := &cloner{
+		traces: make(map[*Trace]*Trace),
+		steps:  make(map[Step]Step),
+		nodes:  make(map[expr.Node]expr.Node),
+	}
+	out := c.trace(b)
+	// scope entries may refer to steps in
+	// other traces, so they are copied once
+	// every trace has been cloned
+	for old, t := range c.traces {
+		t.scope = c.scope(old.scope)
+	}
+	return out
+}
+
+func (c *cloner) trace(t *Trace) *Trace {
+	if t == nil {
+		return nil
+	}
+	if out, ok := c.traces[t]; ok {
+		return out
+	}
+	out := &Trace{prepared: t.prepared, err: t.err}
+	c.traces[t] = out
+	out.Parent = c.trace(t.Parent)
+	out.top = c.step(t.top)
+	out.cur = c.step(t.cur)
+	if t.Replacements != nil {
+		out.Replacements = make([]*Trace, len(t.Replacements))
+		for i := range t.Replacements {
+			out.Replacements[i] = c.trace(t.Replacements[i])
+		}
+	}
+	if t.final != nil {
+		// the final bindings share their
+		// expressions with the steps that
+		// produce them, so prefer the copies
+		// that have been made already
+		out.final = make([]expr.Binding, len(t.final))
+		for i := range t.final {
+			out.final[i] = t.final[i]
+			out.final[i].Expr = c.lookup(t.final[i].Expr)
+		}
+	}
+	return out
+}
+
+func (c *cloner) scope(in map[*expr.Path]scopeinfo) map[*expr.Path]scopeinfo {
+	if in == nil {
+		return nil
+	}
+	out := make(map[*expr.Path]scopeinfo, len(in))
+	for p, info := range in {
+		np, ok := c.nodes[p]
+		if !ok {
+			// no longer referenced by the trace
+			continue
+		}
+		// origins and nodes that were eliminated
+		// from the trace are only used to compute
+		// types, so they can be shared
+		if s, ok := c.steps[info.origin]; ok {
+			info.origin = s
+		}
+		if ispointer(info.node) {
+			if n, ok := c.nodes[info.node]; ok {
+				info.node = n
+			}
+		}
+		out[np.(*expr.Path)] = info
+	}
+	return out
+}
+
+func ispointer(e expr.Node) bool {
+	return e != nil && reflect.ValueOf(e).Kind() == reflect.Pointer
+}
+
+func collect(dst *[]expr.Node) expr.Visitor {
+	return visitfn(func(e expr.Node) bool {
+		*dst = append(*dst, e)
+		return true
+	})
+}
+
+// node returns a deep copy of e and
+// records the copy of each node within e
+func (c *cloner) node(e expr.Node) expr.Node {
+	if e == nil {
+		return nil
+	}
+	out := expr.Copy(e)
+	var src, dst []expr.Node
+	expr.Walk(collect(&src), e)
+	expr.Walk(collect(&dst), out)
+	if len(src) != len(dst) {
+		return out
+	}
+	for i := range src {
+		if reflect.TypeOf(src[i]) != reflect.TypeOf(dst[i]) {
+			return out
+		}
+	}
+	for i := range src {
+		if ispointer(src[i]) {
+			c.nodes[src[i]] = dst[i]
+		}
+	}
+	return out
+}
+
+// lookup returns the copy of e made
+// by c.node, or a new copy of e if
+// it has not been copied yet
+func (c *cloner) lookup(e expr.Node) expr.Node {
+	if ispointer(e) {
+		if n, ok := c.nodes[e]; ok {
+			return n
+		}
+	}
+	return c.node(e)
+}
+
+func (c *cloner) exprs(lst []expr.Node) []expr.Node {
+	if lst == nil {
+		return nil
+	}
+	out := make([]expr.Node, len(lst))
+	for i := range lst {
+		out[i] = c.node(lst[i])
+	}
+	return out
+}
+
+func (c *cloner) bindings(lst []expr.Binding) []expr.Binding {
+	if lst == nil {
+		return nil
+	}
+	out := make([]expr.Binding, len(lst))
+	for i := range lst {
+		out[i] = lst[i]
+		out[i].Expr = c.node(lst[i].Expr)
+	}
+	return out
+}
+
+func (c *cloner) step(s Step) Step {
+	if s == nil {
+		return nil
+	}
+	if out, ok := c.steps[s]; ok {
+		return out
+	}
+	var out Step
+	switch s := s.(type) {
+	case *IterTable:
+		n := *s
+		n.Filter = c.node(s.Filter)
+		n.free = slices.Clone(s.free)
+		n.definite = slices.Clone(s.definite)
+		n.Table = c.node(s.Table).(*expr.Table)
+		out = &n
+	case *IterValue:
+		n := *s
+		n.Value = c.node(s.Value)
+		out = &n
+	case *UnionMap:
+		n := *s
+		n.Inner = c.step(s.Inner).(*IterTable)
+		n.Child = c.trace(s.Child)
+		out = &n
+	case *Filter:
+		n := *s
+		n.Where = c.node(s.Where)
+		out = &n
+	case *Distinct:
+		n := *s
+		n.Columns = c.exprs(s.Columns)
+		out = &n
+	case *Bind:
+		n := *s
+		n.bind = c.bindings(s.bind)
+		out = &n
+	case *Aggregate:
+		n := *s
+		n.Agg = make(vm.Aggregation, len(s.Agg))
+		for i := range s.Agg {
+			n.Agg[i].Expr = c.node(s.Agg[i].Expr).(*expr.Aggregate)
+			n.Agg[i].Result = s.Agg[i].Result
+		}
+		n.GroupBy = c.bindings(s.GroupBy)
+		out = &n
+	case *Order:
+		n := *s
+		n.Columns = slices.Clone(s.Columns)
+		for i := range n.Columns {
+			n.Columns[i].Column = c.node(s.Columns[i].Column)
+		}
+		out = &n
+	case *Limit:
+		n := *s
+		out = &n
+	case *OutputPart:
+		n := *s
+		out = &n
+	case *OutputIndex:
+		n := *s
+		n.Table = c.node(s.Table).(*expr.Path)
+		out = &n
+	case *Unpivot:
+		n := *s
+		n.Ast = c.node(s.Ast).(*expr.Unpivot)
+		out = &n
+	case *UnpivotAtDistinct:
+		n := *s
+		n.Ast = c.node(s.Ast).(*expr.Unpivot)
+		out = &n
+	case NoOutput, DummyOutput:
+		out = s
+	default:
+		panic(fmt.Sprintf("pir: cannot clone %T", s))
+	}
+	c.steps[s] = out
+	if par := s.parent(); par != nil {
+		out.setparent(c.step(par))
+	}
+	return out
+}
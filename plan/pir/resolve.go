@@ -36,6 +36,27 @@ func (b *Trace) Check(e expr.Node) error {
 	return expr.CheckHint(e, b)
 }
 
+// AllowUnbound implements expr.UnboundHint.AllowUnbound
+func (b *Trace) AllowUnbound() bool { return b.prepared }
+
+// checkSelect checks a SELECT before it is
+// walked; parameters are permitted if the
+// trace is being prepared
+func (b *Trace) checkSelect(s *expr.Select) error {
+	if b.prepared {
+		return expr.CheckHint(s, unbound{expr.HintFn(expr.NoHint)})
+	}
+	return expr.Check(s)
+}
+
+// unbound is an expr.UnboundHint
+// that permits unbound parameters
+type unbound struct {
+	expr.Hint
+}
+
+func (unbound) AllowUnbound() bool { return true }
+
 func (b *Trace) checkExpressions(n []expr.Node) error {
 	for i := range n {
 		err := b.Check(n[i])
@@ -110,6 +131,25 @@ func (b *Trace) visitPath(p *expr.Path) expr.Visitor {
 			// make sure we record this as a definite reference
 			it.definite = append(it.definite, p.First)
 		}
+		// if the table has a schema, then a reference
+		// that definitely belongs to the table must
+		// be to a field that the schema permits
+		if it, ok := src.(*IterTable); ok && it.Schema != nil &&
+			(node != nil || !it.haveParent) &&
+			it.Schema.TypeOf(p) == expr.MissingType {
+			b.errorf(p, "field %s is not in the schema of table %s", expr.ToString(p), expr.ToString(it.Table.Expr))
+		}
+		// a reference that definitely belongs to
+		// the table and is masked is replaced
+		// once the whole trace has been resolved
+		if it, ok := src.(*IterTable); ok && (node != nil || !it.haveParent) {
+			if m := it.mask(p); m != nil && m != expr.Node(p) {
+				if b.masked == nil {
+					b.masked = make(map[*expr.Path]expr.Node)
+				}
+				b.masked[p] = m
+			}
+		}
 		// references to tables, etc.
 		// do not need to be additionally
 		// type-checked
@@ -140,3 +180,32 @@ func (b *Trace) visitUnpivot(u *expr.Unpivot) expr.Visitor {
 	b.errorf(u, "the UNPIVOT cross join case is not supported yet")
 	return nil
 }
+
+// applyMasks replaces the references to
+// masked fields with the expressions returned
+// by Masker.Mask before the trace is optimized,
+// so that no optimization can observe the
+// values of the fields before they are masked
+func (b *Trace) applyMasks() {
+	if len(b.masked) == 0 {
+		return
+	}
+	b.Rewrite(&maskRewriter{masked: b.masked})
+}
+
+type maskRewriter struct {
+	masked map[*expr.Path]expr.Node
+}
+
+func (m *maskRewriter) Walk(e expr.Node) expr.Rewriter {
+	return m
+}
+
+func (m *maskRewriter) Rewrite(e expr.Node) expr.Node {
+	if p, ok := e.(*expr.Path); ok {
+		if r, ok := m.masked[p]; ok {
+			return r
+		}
+	}
+	return e
+}
@@ -19,12 +19,15 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/SnellerInc/sneller/expr"
 	"github.com/SnellerInc/sneller/ion"
 	"github.com/SnellerInc/sneller/plan/pir"
 	"github.com/SnellerInc/sneller/sorting"
 	"github.com/SnellerInc/sneller/vm"
+
+	"golang.org/x/exp/slices"
 )
 
 // Op represents a single node in
@@ -142,6 +145,17 @@ type Hints struct {
 	// are implicitly referenced in the query (i.e. via "*");
 	// otherwise it is set to false.
 	AllFields bool
+	// RowFilter, if non-nil, is the row filter
+	// of the table (see RowFilterer) that the query
+	// does not apply by itself, either because the
+	// table is one of several tables in a table
+	// expression that do not all have the same
+	// row filter, or because the row filter
+	// references masked fields (see Masker).
+	// The TableHandle returned by Env.Stat must
+	// only produce rows that satisfy RowFilter,
+	// evaluated before any fields are masked.
+	RowFilter expr.Node
 }
 
 // Env represents the global binding environment
@@ -162,11 +176,26 @@ type Env interface {
 // special handling for certain table expressions
 // (TABLE_GLOB, TABLE_PATTERN, ++ operator).
 func stat(env Env, tbl expr.Node, h *Hints) (TableHandle, error) {
+	restrict := false
+	if rf, ok := env.(RowFilterer); ok {
+		_, common, err := rowFilter(rf, tbl)
+		if err != nil {
+			return nil, err
+		}
+		restrict = !common
+	}
+	return statTables(env, tbl, h, restrict)
+}
+
+// statTables calls env.Stat for each of the tables
+// in tbl. If restrict is set, the handle of each
+// table applies the row filter of the table.
+func statTables(env Env, tbl expr.Node, h *Hints, restrict bool) (TableHandle, error) {
 	switch e := tbl.(type) {
 	case *expr.Appended:
 		ths := make(tableHandles, len(e.Values))
 		for i := range e.Values {
-			th, err := stat(env, e.Values[i], h)
+			th, err := statTables(env, e.Values[i], h, restrict)
 			if err != nil {
 				return nil, err
 			}
@@ -180,12 +209,60 @@ func stat(env Env, tbl expr.Node, h *Hints) (TableHandle, error) {
 			if !ok {
 				return nil, fmt.Errorf("listing not supported")
 			}
-			return statGlob(tl, env, e, h)
+			return statGlob(tl, env, e, h, restrict)
+		}
+	}
+	return statTable(env, tbl, h, restrict)
+}
+
+// statTable calls env.Stat(tbl, h), first setting
+// h.RowFilter to the row filter of tbl if restrict is set
+func statTable(env Env, tbl expr.Node, h *Hints, restrict bool) (TableHandle, error) {
+	if restrict {
+		f, err := env.(RowFilterer).RowFilter(tbl)
+		if err != nil {
+			return nil, err
+		}
+		if f != nil {
+			rh := *h
+			rh.RowFilter = f
+			if !rh.AllFields {
+				// the handle has to produce the fields
+				// that the row filter references as well
+				rh.Fields = append(slices.Clip(h.Fields), freeFields(f)...)
+				slices.Sort(rh.Fields)
+				rh.Fields = slices.Compact(rh.Fields)
+			}
+			h = &rh
 		}
 	}
 	return env.Stat(tbl, h)
 }
 
+// freeFields returns the top-level fields
+// that are referenced in e
+func freeFields(e expr.Node) []string {
+	var out []string
+	var visit visitfn
+	visit = func(e expr.Node) bool {
+		if p, ok := e.(*expr.Path); ok {
+			out = append(out, p.First)
+		}
+		return true
+	}
+	expr.Walk(visit, e)
+	return out
+}
+
+type visitfn func(e expr.Node) bool
+
+func (v visitfn) Visit(e expr.Node) expr.Visitor {
+	if e == nil || !v(e) {
+		return nil
+	}
+	return v
+}
+
 // Schemer may optionally be implemented by Env to
 // provide type hints for a table.
 type Schemer interface {
@@ -205,6 +282,169 @@ type Indexer interface {
 	Index(expr.Node) (Index, error)
 }
 
+// RowFilterer may optionally be implemented by Env
+// to restrict the rows of a table that are visible
+// to a query (i.e. for row-level security).
+type RowFilterer interface {
+	// RowFilter returns a predicate that every
+	// row of the given table expression must
+	// satisfy in order to be visible to the query.
+	// RowFilter may return (nil, nil) if every row
+	// in the table is visible.
+	//
+	// An Env that implements RowFilterer must
+	// also honor Hints.RowFilter in Env.Stat.
+	RowFilter(expr.Node) (expr.Node, error)
+}
+
+// Masker may optionally be implemented by Env
+// to mask fields of a table from a query
+// (i.e. for column-level security).
+type Masker interface {
+	// Mask returns the expression that replaces
+	// a reference to the field p of the given
+	// table in a query, or nil if p is not masked.
+	// Mask returns p itself if the TableHandle
+	// returned by Env.Stat masks the value of p
+	// before the query evaluates it.
+	//
+	// The Index of a table is never used to
+	// compute anything about a masked field.
+	Mask(tbl expr.Node, p *expr.Path) expr.Node
+}
+
+// mask calls m.Mask(tbl, p), with special
+// handling for certain table expressions.
+//
+// When a table expression refers to more than
+// one table and the tables do not all mask p
+// in the same way, then p is left as-is for each
+// table handle to mask, and mask returns p.
+func mask(m Masker, tbl expr.Node, p *expr.Path) expr.Node {
+	switch e := tbl.(type) {
+	case *expr.Appended:
+		lst := make([]expr.Node, len(e.Values))
+		for i := range e.Values {
+			lst[i] = mask(m, e.Values[i], p)
+		}
+		return commonMask(lst, p)
+	case *expr.Builtin:
+		switch e.Func {
+		case expr.TableGlob, expr.TablePattern:
+			tl, ok := m.(TableLister)
+			if !ok {
+				return p
+			}
+			return maskGlob(tl, m, e, p)
+		}
+	}
+	return m.Mask(tbl, p)
+}
+
+// commonMask returns the mask shared by
+// every table in lst, or p if the masks
+// of the tables are not all equivalent
+func commonMask(lst []expr.Node, p *expr.Path) expr.Node {
+	for _, m := range lst {
+		if (m == nil) != (lst[0] == nil) ||
+			m != nil && !expr.Equivalent(lst[0], m) {
+			return p
+		}
+	}
+	if len(lst) == 0 {
+		return nil
+	}
+	return lst[0]
+}
+
+// rowFilter calls rf.RowFilter(tbl), with special
+// handling for certain table expressions.
+//
+// When a table expression refers to more than
+// one table, the tables may not all have the
+// same row filter, in which case no single
+// predicate describes the visible rows and
+// rowFilter returns (nil, false, nil).
+// The handle of each table then has to apply
+// the row filter of that table (see Hints.RowFilter).
+//
+// The same is true when the row filter references
+// a field that is masked (see Masker), since the
+// query only sees the values of masked fields after
+// they are masked, and the row filter has to apply
+// to the values of the fields as they are stored.
+func rowFilter(rf RowFilterer, tbl expr.Node) (expr.Node, bool, error) {
+	f, ok, err := tablesFilter(rf, tbl)
+	if err != nil || !ok || f == nil {
+		return f, ok, err
+	}
+	if m, isMasker := rf.(Masker); isMasker && filterMasked(m, tbl, f) {
+		return nil, false, nil
+	}
+	return f, true, nil
+}
+
+// filterMasked returns true if the
+// row filter f of tbl references any
+// fields that are masked in tbl
+func filterMasked(m Masker, tbl, f expr.Node) bool {
+	masked := false
+	visit := visitfn(func(e expr.Node) bool {
+		if p, ok := e.(*expr.Path); ok {
+			masked = masked || mask(m, tbl, p) != nil
+			return false
+		}
+		return !masked
+	})
+	expr.Walk(visit, f)
+	return masked
+}
+
+// tablesFilter returns the row filter
+// shared by the tables in tbl (see rowFilter)
+func tablesFilter(rf RowFilterer, tbl expr.Node) (expr.Node, bool, error) {
+	switch e := tbl.(type) {
+	case *expr.Appended:
+		var lst []expr.Node
+		for i := range e.Values {
+			f, ok, err := tablesFilter(rf, e.Values[i])
+			if err != nil || !ok {
+				return nil, false, err
+			}
+			lst = append(lst, f)
+		}
+		f, ok := commonFilter(lst)
+		return f, ok, nil
+	case *expr.Builtin:
+		switch e.Func {
+		case expr.TableGlob, expr.TablePattern:
+			tl, ok := rf.(TableLister)
+			if !ok {
+				return nil, false, fmt.Errorf("listing not supported")
+			}
+			return rowFilterGlob(tl, rf, e)
+		}
+	}
+	f, err := rf.RowFilter(tbl)
+	return f, true, err
+}
+
+// commonFilter returns the filter shared by
+// every table in lst, or false if the filters
+// of the tables are not all equivalent
+func commonFilter(lst []expr.Node) (expr.Node, bool) {
+	for _, f := range lst {
+		if (f == nil) != (lst[0] == nil) ||
+			f != nil && !expr.Equivalent(lst[0], f) {
+			return nil, false
+		}
+	}
+	if len(lst) == 0 {
+		return nil, true
+	}
+	return lst[0], true
+}
+
 // An Index may be returned by Indexer.Index to provide
 // additional table metadata that may be used during
 // optimization.
@@ -1230,8 +1470,12 @@ func (u *UnpivotAtDistinct) setfield(_ Decoder, name string, st *ion.Symtab, buf
 // Explain is leaf executor for explaing queries
 type Explain struct {
 	Format expr.ExplainFormat
-	Query  *expr.Query
-	Tree   *Tree
+	// Analyze, if set, causes Tree to be
+	// executed so that the explained plan
+	// can be annotated with runtime statistics.
+	Analyze bool
+	Query   *expr.Query
+	Tree    *Tree
 }
 
 func (e *Explain) String() string        { return "EXPLAIN QUERY" }
@@ -1244,10 +1488,16 @@ func (e *Explain) encode(dst *ion.Buffer, st *ion.Symtab) error {
 	settype("explain", dst, st)
 	dst.BeginField(st.Intern("format"))
 	dst.WriteInt(int64(e.Format))
+	if e.Analyze {
+		dst.BeginField(st.Intern("analyze"))
+		dst.WriteBool(true)
+	}
 	dst.BeginField(st.Intern("query"))
 	e.Query.Encode(dst, st)
 	dst.BeginField(st.Intern("tree"))
-	e.Tree.Encode(dst, st)
+	if err := e.Tree.Encode(dst, st); err != nil {
+		return err
+	}
 	dst.EndStruct()
 	return nil
 }
@@ -1262,6 +1512,14 @@ func (e *Explain) setfield(d Decoder, field string, st *ion.Symtab, obj []byte)
 
 		e.Format = expr.ExplainFormat(k)
 
+	case "analyze":
+		b, _, err := ion.ReadBool(obj)
+		if err != nil {
+			return err
+		}
+
+		e.Analyze = b
+
 	case "query":
 		q, _, err := expr.DecodeQuery(st, obj)
 		if err != nil {
@@ -1289,11 +1547,25 @@ func (e *Explain) wrap(dst vm.QuerySink, ep *ExecParams) (int, vm.QuerySink, err
 	var b ion.Buffer
 	var st ion.Symtab
 
+	var ann annotator
+	var stats *ExecStats
+	var elapsed time.Duration
+	if e.Analyze {
+		var err error
+		stats, elapsed, err = e.analyze(ep)
+		if err != nil {
+			return -1, nil, err
+		}
+		ann = stats.annotate
+	}
+
 	// Build the following structure:
 	// "query": textual form of query being explained
 	// "plan": text or
 	// "plan-lines": list of plan lines or
 	// "graphviz": graphviz
+	// and for EXPLAIN ANALYZE:
+	// "elapsed": the query execution time
 	fieldName := func() string {
 		switch e.Format {
 		case expr.ExplainDefault, expr.ExplainText:
@@ -1311,6 +1583,9 @@ func (e *Explain) wrap(dst vm.QuerySink, ep *ExecParams) (int, vm.QuerySink, err
 
 	st.Intern("query")
 	st.Intern(fieldName())
+	if e.Analyze {
+		st.Intern("elapsed")
+	}
 	st.Marshal(&b, true)
 
 	b.BeginStruct(-1)
@@ -1319,13 +1594,16 @@ func (e *Explain) wrap(dst vm.QuerySink, ep *ExecParams) (int, vm.QuerySink, err
 
 	b.BeginField(st.Intern(fieldName()))
 
+	var text strings.Builder
 	switch e.Format {
 	case expr.ExplainDefault, expr.ExplainText:
-		b.WriteString(e.Tree.String())
+		e.Tree.describe(&text, ann)
+		b.WriteString(text.String())
 
 	case expr.ExplainList:
+		e.Tree.describe(&text, ann)
 		b.BeginList(-1)
-		for _, line := range strings.Split(e.Tree.String(), "\n") {
+		for _, line := range strings.Split(text.String(), "\n") {
 			if len(line) > 0 {
 				b.WriteString(line)
 			}
@@ -1333,12 +1611,15 @@ func (e *Explain) wrap(dst vm.QuerySink, ep *ExecParams) (int, vm.QuerySink, err
 		b.EndList()
 
 	case expr.ExplainGraphviz:
-		var sb strings.Builder
-		err := Graphviz(e.Tree, &sb)
+		err := graphviz(e.Tree, &text, ann)
 		if err != nil {
 			return -1, nil, err
 		}
-		b.WriteString(sb.String())
+		b.WriteString(text.String())
+	}
+	if e.Analyze {
+		b.BeginField(st.Intern("elapsed"))
+		b.WriteString(elapsed.String())
 	}
 	b.EndStruct()
 
@@ -43,6 +43,14 @@ type ExecParams struct {
 	// of the query. Transports are expected to
 	// stop processing queries after Context is canceled.
 	Context context.Context
+	// Limits are the limits on the resources
+	// that the query may consume while it executes.
+	// (See Limits and LimitError.)
+	Limits Limits
+
+	// budget is shared by all of the parts of
+	// a query that enforce the same Limits
+	budget *budget
 }
 
 // Exec executes a plan and writes the
@@ -87,7 +95,9 @@ func (l *LocalTransport) Exec(t *Tree, ep *ExecParams) error {
 	if ep.Parallel == 0 {
 		ep.Parallel = runtime.GOMAXPROCS(0)
 	}
-	return t.exec(s, ep)
+	done := ep.begin()
+	defer done()
+	return ep.limitErr(t.exec(s, ep))
 }
 
 // Transport models the exection environment
@@ -17,7 +17,10 @@ package plan
 import (
 	"context"
 	"fmt"
+	"io"
+	"net"
 	"strings"
+	"syscall"
 	"testing"
 
 	"github.com/SnellerInc/sneller/expr"
@@ -138,3 +141,101 @@ func TestSplit(t *testing.T) {
 		})
 	}
 }
+
+// failTransport fails with err after
+// writing partial bytes of output
+type failTransport struct {
+	err     error
+	partial int
+}
+
+func (f *failTransport) Exec(_ *Tree, ep *ExecParams) error {
+	if f.partial > 0 {
+		ep.Output.Write(make([]byte, f.partial))
+	}
+	return f.err
+}
+
+// okTransport writes a single byte
+type okTransport struct{}
+
+func (okTransport) Exec(_ *Tree, ep *ExecParams) error {
+	_, err := ep.Output.Write([]byte{1})
+	return err
+}
+
+// replanList re-plans every subtable
+// onto okTransport
+type replanList struct {
+	SubtableList
+	replans int
+}
+
+func (r *replanList) Replan(i int) Subtables {
+	r.replans++
+	return SubtableList{{
+		Transport: okTransport{},
+		Table:     r.SubtableList[i].Table,
+	}}
+}
+
+type countWriter struct {
+	n int
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	c.n += len(p)
+	return len(p), nil
+}
+
+func TestUnionMapRetry(t *testing.T) {
+	table := &expr.Table{Binding: expr.Bind(expr.Identifier("table"), "")}
+	tcs := []struct {
+		tp      Transport
+		retries int64
+		fail    bool
+	}{
+		{tp: &failTransport{err: io.ErrUnexpectedEOF}, retries: 1},
+		{tp: &failTransport{err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}}, retries: 1},
+		// not a transport error
+		{tp: &failTransport{err: fmt.Errorf("query error")}, fail: true},
+		// buffered partial output is discarded
+		{tp: &failTransport{err: io.ErrUnexpectedEOF, partial: 100}, retries: 1},
+		// partial output that has been forwarded
+		// cannot be retried
+		{tp: &failTransport{err: io.ErrUnexpectedEOF, partial: retryBufferSize + 1}, fail: true},
+		{tp: okTransport{}},
+	}
+	for i := range tcs {
+		tc := &tcs[i]
+		lst := &replanList{SubtableList: SubtableList{{Transport: tc.tp, Table: table}}}
+		u := &UnionMap{Orig: table, Sub: lst}
+		var out countWriter
+		ep := &ExecParams{Context: context.Background()}
+		err := u.exec(lst, 0, &out, ep)
+		if tc.fail {
+			if err == nil {
+				t.Errorf("case %d: expected an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: %s", i, err)
+			continue
+		}
+		if ep.Stats.Retries != tc.retries {
+			t.Errorf("case %d: got %d retries; expected %d", i, ep.Stats.Retries, tc.retries)
+		}
+		if out.n != 1 {
+			t.Errorf("case %d: got %d bytes of output", i, out.n)
+		}
+	}
+	// a destination that doesn't want any more
+	// output is not an error (see executor.runtask)
+	lst := &replanList{SubtableList: SubtableList{{Transport: okTransport{}, Table: table}}}
+	u := &UnionMap{Orig: table, Sub: lst}
+	err := u.exec(lst, 0, eofWriter{}, &ExecParams{Context: context.Background()})
+	if err != nil {
+		t.Errorf("writing to eofWriter: %s", err)
+	}
+}
@@ -16,7 +16,10 @@ package plan
 
 import (
 	"fmt"
+	"sort"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/SnellerInc/sneller/ion"
 	"github.com/SnellerInc/sneller/vm"
@@ -38,6 +41,77 @@ type ExecStats struct {
 	// BytesScanned is the number
 	// of bytes scanned.
 	BytesScanned int64
+	// Retries is the number of subqueries
+	// that were re-planned onto a different
+	// Transport after their Transport failed.
+	// (See Replanner.)
+	Retries int64
+	// Ops are the statistics collected by
+	// the Probes in a plan executed by
+	// EXPLAIN ANALYZE, sorted by Probe.ID.
+	Ops []OpStats
+}
+
+// OpStats are the statistics collected by
+// one Probe in a query plan. The statistics
+// from different threads and peers are summed.
+type OpStats struct {
+	// ID is the ID of the Probe.
+	ID int
+	// Rows and Bytes are the number of
+	// rows and bytes produced by the input
+	// of the Probe.
+	Rows, Bytes int64
+	// Time is the time spent consuming the
+	// rows, which includes the time spent
+	// in all of the subsequent operations.
+	Time time.Duration
+	// Memory is the number of bytes retained
+	// by the consumer of the rows when it
+	// was closed. (See vm.MemoryUser.)
+	Memory int64
+}
+
+func (o *OpStats) add(x *OpStats) {
+	o.Rows += x.Rows
+	o.Bytes += x.Bytes
+	o.Time += x.Time
+	o.Memory += x.Memory
+}
+
+// opsLock guards ExecStats.Ops, which is
+// updated concurrently by Probes and
+// sub-queries (but only for EXPLAIN ANALYZE)
+var opsLock sync.Mutex
+
+// Op returns the statistics for the
+// Probe with the given ID, or nil if
+// there are no statistics for it.
+func (e *ExecStats) Op(id int) *OpStats {
+	i := sort.Search(len(e.Ops), func(i int) bool {
+		return e.Ops[i].ID >= id
+	})
+	if i < len(e.Ops) && e.Ops[i].ID == id {
+		return &e.Ops[i]
+	}
+	return nil
+}
+
+func (e *ExecStats) addOps(lst []OpStats) {
+	opsLock.Lock()
+	defer opsLock.Unlock()
+	for i := range lst {
+		if o := e.Op(lst[i].ID); o != nil {
+			o.add(&lst[i])
+			continue
+		}
+		j := sort.Search(len(e.Ops), func(j int) bool {
+			return e.Ops[j].ID > lst[i].ID
+		})
+		e.Ops = append(e.Ops, OpStats{})
+		copy(e.Ops[j+1:], e.Ops[j:])
+		e.Ops[j] = lst[i]
+	}
 }
 
 // CachedTable is an interface optionally
@@ -57,6 +131,10 @@ func (e *ExecStats) atomicAdd(tmp *ExecStats) {
 	atomic.AddInt64(&e.CacheHits, tmp.CacheHits)
 	atomic.AddInt64(&e.CacheMisses, tmp.CacheMisses)
 	atomic.AddInt64(&e.BytesScanned, tmp.BytesScanned)
+	atomic.AddInt64(&e.Retries, tmp.Retries)
+	if len(tmp.Ops) > 0 {
+		e.addOps(tmp.Ops)
+	}
 }
 
 func (e *ExecStats) observe(table vm.Table) {
@@ -92,9 +170,56 @@ func (e *ExecStats) Encode(dst *ion.Buffer, st *ion.Symtab) {
 		dst.BeginField(st.Intern("scanned"))
 		dst.WriteInt(e.BytesScanned)
 	}
+	if e.Retries != 0 {
+		dst.BeginField(st.Intern("retries"))
+		dst.WriteInt(e.Retries)
+	}
+	if len(e.Ops) > 0 {
+		dst.BeginField(st.Intern("ops"))
+		dst.BeginList(-1)
+		for i := range e.Ops {
+			o := &e.Ops[i]
+			dst.BeginStruct(-1)
+			dst.BeginField(st.Intern("id"))
+			dst.WriteInt(int64(o.ID))
+			dst.BeginField(st.Intern("rows"))
+			dst.WriteInt(o.Rows)
+			dst.BeginField(st.Intern("bytes"))
+			dst.WriteInt(o.Bytes)
+			dst.BeginField(st.Intern("time"))
+			dst.WriteInt(int64(o.Time))
+			dst.BeginField(st.Intern("memory"))
+			dst.WriteInt(o.Memory)
+			dst.EndStruct()
+		}
+		dst.EndList()
+	}
 	dst.EndStruct()
 }
 
+func (o *OpStats) decode(buf []byte, st *ion.Symtab) error {
+	_, err := ion.UnpackStruct(st, buf, func(name string, field []byte) error {
+		i, _, err := ion.ReadInt(field)
+		if err != nil {
+			return err
+		}
+		switch name {
+		case "id":
+			o.ID = int(i)
+		case "rows":
+			o.Rows = i
+		case "bytes":
+			o.Bytes = i
+		case "time":
+			o.Time = time.Duration(i)
+		case "memory":
+			o.Memory = i
+		}
+		return nil
+	})
+	return err
+}
+
 func (e *ExecStats) Decode(buf []byte, st *ion.Symtab) error {
 	if len(buf) == 0 {
 		return fmt.Errorf("plan.ExecStats cannot be 0 encoded bytes")
@@ -120,6 +245,18 @@ func (e *ExecStats) Decode(buf []byte, st *ion.Symtab) error {
 			e.CacheMisses, inner, err = ion.ReadInt(inner)
 		case "scanned":
 			e.BytesScanned, inner, err = ion.ReadInt(inner)
+		case "retries":
+			e.Retries, inner, err = ion.ReadInt(inner)
+		case "ops":
+			e.Ops = e.Ops[:0]
+			inner, err = ion.UnpackList(inner, func(field []byte) error {
+				var o OpStats
+				if err := o.decode(field, st); err != nil {
+					return err
+				}
+				e.Ops = append(e.Ops, o)
+				return nil
+			})
 		default:
 			inner = inner[ion.SizeOf(inner):]
 		}
@@ -144,6 +281,17 @@ func init() {
 		"hits",
 		"misses",
 		"scanned",
+		"retries",
+		"ops",
+		"id",
+		"rows",
+		"bytes",
+		"time",
+		"memory",
+		"limit_exceeded",
+		"timeout",
+		"max_scan",
+		"stats",
 	} {
 		statsSymtab.Intern(s)
 	}
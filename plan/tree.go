@@ -81,28 +81,41 @@ func tabline(dst *strings.Builder, indent int, line string) {
 	dst.WriteByte('\n')
 }
 
-func printops(dst *strings.Builder, indent int, op Op, in []Input) {
+// annotator returns the annotation for
+// the op that is the input of a Probe
+type annotator func(p *Probe) string
+
+func printops(dst *strings.Builder, indent int, op Op, in []Input, ann annotator) {
+	// probes aren't printed; instead the
+	// op that they observe is annotated
+	suffix := ""
+	if p, ok := op.(*Probe); ok {
+		if ann != nil {
+			suffix = ann(p)
+		}
+		op = p.From
+	}
 	if u, ok := op.(*UnionMap); ok {
 		in = []Input{{Table: u.Orig}}
 	}
 	if from := op.input(); from != nil {
-		printops(dst, indent, from, in)
+		printops(dst, indent, from, in, ann)
 	}
 	if l, ok := op.(*Leaf); ok {
-		tabline(dst, indent, l.describe(in))
+		tabline(dst, indent, l.describe(in)+suffix)
 		return
 	}
-	tabline(dst, indent, op.String())
+	tabline(dst, indent, op.String()+suffix)
 }
 
-func (t *Tree) describe(dst *strings.Builder) {
-	t.Root.describe(0, dst, t.Inputs)
+func (t *Tree) describe(dst *strings.Builder, ann annotator) {
+	t.Root.describe(0, dst, t.Inputs, ann)
 }
 
 // String implements fmt.Stringer
 func (t *Tree) String() string {
 	var out strings.Builder
-	t.describe(&out)
+	t.describe(&out, nil)
 	return out.String()
 }
 
@@ -151,18 +164,18 @@ type Node struct {
 	Op Op
 }
 
-func (n *Node) describe(indent int, dst *strings.Builder, in []Input) {
+func (n *Node) describe(indent int, dst *strings.Builder, in []Input, ann annotator) {
 	for i := range n.Children {
 		tabfprintf(dst, indent, "WITH REPLACEMENT(%d) AS (\n", i)
-		n.Children[i].describe(indent+1, dst, n.Inputs)
+		n.Children[i].describe(indent+1, dst, n.Inputs, ann)
 		tabline(dst, indent, ")")
 	}
-	printops(dst, indent, n.Op, in)
+	printops(dst, indent, n.Op, in, ann)
 }
 
 // String implements fmt.Stringer
 func (n *Node) String() string {
 	var out strings.Builder
-	n.describe(0, &out, nil)
+	n.describe(0, &out, nil, nil)
 	return out.String()
 }
@@ -15,9 +15,13 @@
 package plan
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"sync"
+	"sync/atomic"
+	"syscall"
 
 	"github.com/SnellerInc/sneller/expr"
 	"github.com/SnellerInc/sneller/ion"
@@ -165,26 +169,7 @@ func (u *UnionMap) wrap(dst vm.QuerySink, ep *ExecParams) (int, vm.QuerySink, er
 	for i := 0; i < u.Sub.Len(); i++ {
 		go func(i int) {
 			defer wg.Done()
-			var sub Subtable
-			u.Sub.Subtable(i, &sub)
-			subep := &ExecParams{
-				Output:   s,
-				Parallel: ep.Parallel, // ...meaningful?
-				Context:  ep.Context,
-			}
-			// wrap the rest of the query in a Tree;
-			// this makes it look to the Transport
-			// like we are executing a sub-query, which
-			// is approximately true
-			stub := &Tree{
-				Root: Node{Op: u.From},
-				Inputs: []Input{{
-					Table:  sub.Table,
-					Handle: sub.Handle,
-				}},
-			}
-			errors[i] = sub.Exec(stub, subep)
-			ep.Stats.atomicAdd(&subep.Stats)
+			errors[i] = u.exec(u.Sub, i, s, ep)
 		}(i)
 	}
 	return -1, &unionMapSink{
@@ -192,6 +177,171 @@ func (u *UnionMap) wrap(dst vm.QuerySink, ep *ExecParams) (int, vm.QuerySink, er
 	}, nil
 }
 
+// retryBufferSize is the maximum number of
+// bytes of output from each subtable that
+// are held back from the destination so that
+// the subtable can be retried if its Transport
+// fails partway through execution
+const retryBufferSize = 4 << 20
+
+// exec executes subtable i of lst, writing
+// the results to dst
+//
+// If lst implements Replanner, then the output
+// of the subtable is buffered (up to retryBufferSize
+// bytes) until it has finished executing, and if the
+// subtable fails due to a transport error before any
+// of its output has been forwarded to dst, then the
+// subtable is re-planned and executed again.
+func (u *UnionMap) exec(lst Subtables, i int, dst io.Writer, ep *ExecParams) error {
+	var sub Subtable
+	lst.Subtable(i, &sub)
+	rp, canRetry := lst.(Replanner)
+	var out io.Writer = dst
+	var rb *retryBuffer
+	if canRetry {
+		rb = &retryBuffer{dst: dst, max: retryBufferSize}
+		out = rb
+	}
+	subep := &ExecParams{
+		Output:   out,
+		Parallel: ep.Parallel, // ...meaningful?
+		Context:  ep.Context,
+		Limits:   ep.Limits,
+		budget:   ep.budget,
+	}
+	// wrap the rest of the query in a Tree;
+	// this makes it look to the Transport
+	// like we are executing a sub-query, which
+	// is approximately true
+	stub := &Tree{
+		Root: Node{Op: u.From},
+		Inputs: []Input{{
+			Table:  sub.Table,
+			Handle: sub.Handle,
+		}},
+	}
+	err := sub.Exec(stub, subep)
+	ep.Stats.atomicAdd(&subep.Stats)
+	if !canRetry {
+		return err
+	}
+	if err == nil {
+		err = rb.flush()
+		if errors.Is(err, io.EOF) {
+			// dst doesn't want any more output
+			// (see executor.runtask)
+			err = nil
+		}
+		return err
+	}
+	// we can only retry if none of the output
+	// has been forwarded; otherwise we would
+	// produce duplicate results
+	if rb.flushed() || ep.Context != nil && ep.Context.Err() != nil || !retryable(err) {
+		return err
+	}
+	next := rp.Replan(i)
+	if next == nil {
+		return err
+	}
+	atomic.AddInt64(&ep.Stats.Retries, 1)
+	errs := make([]error, next.Len())
+	var wg sync.WaitGroup
+	wg.Add(next.Len())
+	for j := 0; j < next.Len(); j++ {
+		go func(j int) {
+			defer wg.Done()
+			errs[j] = u.exec(next, j, dst, ep)
+		}(j)
+	}
+	wg.Wait()
+	for j := range errs {
+		if errs[j] != nil {
+			return errs[j]
+		}
+	}
+	return nil
+}
+
+// retryable returns whether err indicates
+// that a Transport failed to communicate
+// with a remote peer (as opposed to the
+// query itself failing)
+func retryable(err error) bool {
+	var neterr net.Error
+	return errors.As(err, &neterr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// retryBuffer is an io.Writer that holds
+// back up to max bytes of writes from dst
+// until flush is called, and then forwards
+// all of its writes to dst
+//
+// Each buffered call to Write is forwarded
+// to dst as a separate call to Write, so the
+// boundaries between the writes are preserved.
+type retryBuffer struct {
+	dst  io.Writer
+	max  int
+	lock sync.Mutex
+	buf  []byte
+	ends []int // end of each buffered write in buf
+	done bool  // buffer has been forwarded to dst
+}
+
+func (r *retryBuffer) Write(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if !r.done && len(r.buf)+len(p) <= r.max {
+		r.buf = append(r.buf, p...)
+		r.ends = append(r.ends, len(r.buf))
+		return len(p), nil
+	}
+	if err := r.forward(); err != nil {
+		return 0, err
+	}
+	return r.dst.Write(p)
+}
+
+// forward writes the buffered writes to r.dst;
+// the caller must hold r.lock
+func (r *retryBuffer) forward() error {
+	if r.done {
+		return nil
+	}
+	r.done = true
+	start := 0
+	for _, end := range r.ends {
+		_, err := r.dst.Write(r.buf[start:end])
+		if err != nil {
+			return err
+		}
+		start = end
+	}
+	r.buf, r.ends = nil, nil
+	return nil
+}
+
+// flush forwards any buffered output to r.dst
+func (r *retryBuffer) flush() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.forward()
+}
+
+// flushed returns whether or not any output
+// has been forwarded to r.dst
+func (r *retryBuffer) flushed() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.done
+}
+
 type unionMapSink struct {
 	dst    vm.QuerySink
 	w      io.Closer
@@ -0,0 +1,79 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sneller
+
+import (
+	"github.com/SnellerInc/sneller/expr"
+	"github.com/SnellerInc/sneller/plan"
+	"github.com/SnellerInc/sneller/vm"
+)
+
+// filterTable is a vm.Table that only
+// produces the rows of the inner table
+// that satisfy a row filter
+//
+// The planner applies the row filter of a
+// table as part of the query, unless the
+// query reads from several tables with
+// different row filters; in that case each
+// table is wrapped in a filterTable instead.
+type filterTable struct {
+	vm.Table
+	filter expr.Node
+}
+
+// restricted returns a table that only produces
+// the rows in t that satisfy filter, or t itself
+// if filter is nil
+func restricted(t vm.Table, filter expr.Node) vm.Table {
+	if filter == nil {
+		return t
+	}
+	return &filterTable{Table: t, filter: filter}
+}
+
+func (f *filterTable) cached() plan.CachedTable {
+	ct, _ := f.Table.(plan.CachedTable)
+	return ct
+}
+
+func (f *filterTable) Hits() int64 {
+	if ct := f.cached(); ct != nil {
+		return ct.Hits()
+	}
+	return 0
+}
+
+func (f *filterTable) Misses() int64 {
+	if ct := f.cached(); ct != nil {
+		return ct.Misses()
+	}
+	return 0
+}
+
+func (f *filterTable) Bytes() int64 {
+	if ct := f.cached(); ct != nil {
+		return ct.Bytes()
+	}
+	return 0
+}
+
+func (f *filterTable) WriteChunks(dst vm.QuerySink, parallel int) error {
+	flt, err := vm.NewFilter(f.filter, dst)
+	if err != nil {
+		return err
+	}
+	return f.Table.WriteChunks(flt, parallel)
+}
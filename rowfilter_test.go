@@ -0,0 +1,93 @@
+// Copyright (C) 2022 Sneller, Inc.
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sneller
+
+import (
+	"testing"
+
+	"github.com/SnellerInc/sneller/db"
+	"github.com/SnellerInc/sneller/expr"
+	"github.com/SnellerInc/sneller/ion"
+	"github.com/SnellerInc/sneller/vm"
+)
+
+func TestRestrictedTable(t *testing.T) {
+	var st ion.Symtab
+	var buf ion.Buffer
+	orgs := []string{"acme", "other", "acme", "other", "acme"}
+	rows := make([]ion.Struct, len(orgs))
+	for i := range orgs {
+		rows[i] = ion.NewStruct(&st, []ion.Field{
+			{Label: "org_id", Value: ion.String(orgs[i])},
+			{Label: "secret", Value: ion.Int(int64(i))},
+		})
+	}
+	st.Marshal(&buf, true)
+	for i := range rows {
+		rows[i].Encode(&buf, &st)
+	}
+	filter := expr.Compare(expr.Equals, expr.Identifier("org_id"), expr.String("acme"))
+	masks := []db.Mask{{Path: "org_id", Action: db.MaskRedact}}
+	// the row filter has to match the
+	// values from before they are masked
+	tbl := masked(restricted(vm.BufferTable(buf.Bytes(), len(buf.Bytes())), filter), masks)
+	var out vm.QueryBuffer
+	out.SetAlignment(4096)
+	if err := tbl.WriteChunks(&out, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	var outst ion.Symtab
+	var err error
+	body := out.Bytes()
+	var got []uint64
+	for len(body) > 0 {
+		if ion.IsBVM(body) || ion.TypeOf(body) == ion.AnnotationType {
+			body, err = outst.Unmarshal(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		var d ion.Datum
+		d, body, err = ion.ReadDatum(&outst, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, ok := d.Struct()
+		if !ok {
+			continue
+		}
+		f, ok := s.FieldByName("secret")
+		if !ok {
+			t.Fatalf("row %v has no secret", s.Fields(nil))
+		}
+		n, _ := f.Value.Uint()
+		got = append(got, n)
+	}
+	want := []uint64{0, 2, 4}
+	if len(got) != len(want) {
+		t.Fatalf("got rows %v; want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("row %d: got %d, want %d", i, got[i], want[i])
+		}
+	}
+
+	if restricted(tbl, nil) != tbl {
+		t.Error("restricted with a nil filter should return the table")
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"time"
 
 	"github.com/SnellerInc/sneller/date"
+	"github.com/SnellerInc/sneller/db"
 	"github.com/SnellerInc/sneller/expr"
 	"github.com/SnellerInc/sneller/expr/blob"
 	"github.com/SnellerInc/sneller/ion"
@@ -128,10 +129,21 @@ func mkblob(url string) blob.Interface {
 
 func mksubs0(blobs, splits int) plan.Subtables {
 	words := []string{"foo", "bar", "baz", "quux"}
+	var peers []peer
+	if rand.Intn(2) == 0 {
+		peers = make([]peer, len(words))
+		for i := range peers {
+			peers[i] = peer{name: words[i], tp: fakeTransport(words[i])}
+		}
+	}
 	s := make([]split, splits)
 	for i := range s {
 		s[i].tp = fakeTransport(words[i%len(words)])
 		s[i].blobs = randblobs(blobs, 0.1)
+		s[i].peer = -1
+		if peers != nil {
+			s[i].peer = i % len(words)
+		}
 	}
 	t := expr.String(words[rand.Intn(len(words))])
 	b := make([]blob.Interface, blobs)
@@ -139,12 +151,27 @@ func mksubs0(blobs, splits int) plan.Subtables {
 		b[i] = mkblob("https://example.com/blobs/" + words[i%len(words)])
 	}
 	f := expr.Is(expr.Identifier("foo"), expr.IsNull)
+	var masks []db.Mask
+	if rand.Intn(2) == 0 {
+		masks = []db.Mask{
+			{Path: "email", Action: db.MaskRedact},
+			{Path: "user.ssn", Action: db.MaskHide},
+		}
+	}
+	var rf expr.Node
+	if rand.Intn(2) == 0 {
+		rf = expr.Compare(expr.Equals, expr.Identifier("org_id"), expr.String("acme"))
+	}
 	return &Subtables{
-		splits: s,
-		table:  t,
-		blobs:  b,
-		filter: f,
-		fn:     blobsToHandle,
+		splits:    s,
+		table:     t,
+		blobs:     b,
+		filter:    f,
+		masks:     masks,
+		rowFilter: rf,
+		peers:     peers,
+		replicas:  rand.Intn(3),
+		fn:        blobsToHandle,
 	}
 }
 
@@ -251,6 +278,18 @@ func subsequaln(n int, s1, s2 *Subtables) error {
 	if !reflect.DeepEqual(s1.filter, s2.filter) {
 		return fmt.Errorf("sub %d: filters are not equal", n)
 	}
+	if !reflect.DeepEqual(s1.masks, s2.masks) {
+		return fmt.Errorf("sub %d: masks are not equal", n)
+	}
+	if !reflect.DeepEqual(s1.rowFilter, s2.rowFilter) {
+		return fmt.Errorf("sub %d: row filters are not equal", n)
+	}
+	if !reflect.DeepEqual(s1.peers, s2.peers) {
+		return fmt.Errorf("sub %d: peers are not equal", n)
+	}
+	if s1.replicas != s2.replicas {
+		return fmt.Errorf("sub %d: replicas %d != %d", n, s1.replicas, s2.replicas)
+	}
 	if s1.next != nil {
 		if s2.next == nil {
 			return fmt.Errorf("sub %d: want next, got nil next", n)
@@ -262,3 +301,147 @@ func subsequaln(n int, s1, s2 *Subtables) error {
 	}
 	return nil
 }
+
+func TestRendezvous(t *testing.T) {
+	names := []string{"10.0.0.1:9000", "10.0.0.2:9000", "10.0.0.3:9000", "10.0.0.4:9000"}
+	etags := make([]string, 1000)
+	for i := range etags {
+		etags[i] = fmt.Sprintf("etag-%d", i)
+	}
+	before := make([]int, len(etags))
+	counts := make([]int, len(names))
+	for i := range etags {
+		before[i] = rank(etags[i], names)[0]
+		counts[before[i]]++
+	}
+	for i := range counts {
+		if counts[i] < len(etags)/(2*len(names)) {
+			t.Errorf("peer %d only assigned %d of %d blobs", i, counts[i], len(etags))
+		}
+	}
+	// adding a peer should only move blobs
+	// onto the new peer
+	names = append(names, "10.0.0.5:9000")
+	moved := 0
+	for i := range etags {
+		after := rank(etags[i], names)[0]
+		if after == before[i] {
+			continue
+		}
+		if after != len(names)-1 {
+			t.Errorf("blob %d moved from peer %d to peer %d", i, before[i], after)
+		}
+		moved++
+	}
+	if moved == 0 || moved > len(etags)/3 {
+		t.Errorf("%d of %d blobs moved", moved, len(etags))
+	}
+}
+
+func TestReplan(t *testing.T) {
+	words := []string{"foo", "bar", "baz", "quux"}
+	peers := make([]peer, len(words))
+	for i := range peers {
+		peers[i] = peer{name: words[i], tp: fakeTransport(words[i])}
+	}
+	names := peerNames(peers)
+	blobs := make([]blob.Interface, 40)
+	splits := make([]split, len(peers))
+	for i := range splits {
+		splits[i].tp = peers[i].tp
+		splits[i].peer = i
+	}
+	for i := range blobs {
+		blobs[i] = mkblob(fmt.Sprintf("https://example.com/blobs/%d", i))
+		info, _ := blobs[i].Stat()
+		p := rank(info.ETag, names)[0]
+		splits[p].blobs = append(splits[p].blobs, i)
+	}
+	rf := expr.Compare(expr.Equals, expr.Identifier("org_id"), expr.String("acme"))
+	s := &Subtables{
+		splits:    compact(splits),
+		table:     expr.Identifier("table"),
+		blobs:     blobs,
+		masks:     []db.Mask{{Path: "email", Action: db.MaskRedact}},
+		rowFilter: rf,
+		peers:     peers,
+		failed:    new(peerSet),
+		fn:        blobsToHandle,
+	}
+	// fail peers one at a time until
+	// there are none left
+	failed := make(map[int]bool)
+	var cur plan.Subtables = s
+	for len(failed) < len(peers) {
+		sp := cur.(*Subtables).splits[0]
+		failed[sp.peer] = true
+		next := cur.(plan.Replanner).Replan(0)
+		if len(failed) == len(peers) {
+			if next != nil {
+				t.Fatal("expected nil replan with no live peers")
+			}
+			break
+		}
+		if next == nil {
+			t.Fatalf("nil replan with %d of %d peers failed", len(failed), len(peers))
+		}
+		total := 0
+		for _, sp := range next.(*Subtables).splits {
+			if failed[sp.peer] {
+				t.Fatalf("replanned onto failed peer %d", sp.peer)
+			}
+			if sp.tp != peers[sp.peer].tp {
+				t.Fatalf("split for peer %d has transport %v", sp.peer, sp.tp)
+			}
+			total += len(sp.blobs)
+		}
+		if want := len(cur.(*Subtables).splits[0].blobs); total != want {
+			t.Fatalf("replan has %d blobs; expected %d", total, want)
+		}
+		// the row filter and masks must survive
+		// re-planning, or rows and fields hidden
+		// from the tenant would be returned
+		if got := next.(*Subtables).rowFilter; !reflect.DeepEqual(got, rf) {
+			t.Fatalf("replan has row filter %v; expected %v", got, rf)
+		}
+		if got := next.(*Subtables).masks; !reflect.DeepEqual(got, s.masks) {
+			t.Fatalf("replan has masks %v; expected %v", got, s.masks)
+		}
+		cur = next
+	}
+}
+
+func TestReplanReplicas(t *testing.T) {
+	words := []string{"foo", "bar", "baz", "quux"}
+	peers := make([]peer, len(words))
+	for i := range peers {
+		peers[i] = peer{name: words[i], tp: fakeTransport(words[i])}
+	}
+	names := peerNames(peers)
+	b := mkblob("https://example.com/blobs/0")
+	info, _ := b.Stat()
+	ranked := rank(info.ETag, names)
+	s := &Subtables{
+		splits:   []split{{tp: peers[ranked[0]].tp, blobs: []int{0}, peer: ranked[0]}},
+		table:    expr.Identifier("table"),
+		blobs:    []blob.Interface{b},
+		peers:    peers,
+		replicas: 2,
+		failed:   new(peerSet),
+		fn:       blobsToHandle,
+	}
+	next := s.Replan(0)
+	if next == nil {
+		t.Fatal("nil replan with one of two replicas failed")
+	}
+	sp := next.(*Subtables).splits
+	if len(sp) != 1 || sp[0].peer != ranked[1] {
+		t.Fatalf("expected replan onto peer %d; got %+v", ranked[1], sp)
+	}
+	// the remaining peers are not replicas
+	// of the blob, so there is nowhere left
+	// to re-plan the blob
+	if next.(plan.Replanner).Replan(0) != nil {
+		t.Fatal("expected nil replan with both replicas failed")
+	}
+}
@@ -17,8 +17,12 @@ package sneller
 import (
 	"fmt"
 	"net"
+	"sort"
+	"sync"
 	"time"
 
+	"github.com/SnellerInc/sneller/cgroup"
+	"github.com/SnellerInc/sneller/db"
 	"github.com/SnellerInc/sneller/expr"
 	"github.com/SnellerInc/sneller/expr/blob"
 	"github.com/SnellerInc/sneller/ion"
@@ -37,6 +41,27 @@ type Splitter struct {
 	Peers     []*net.TCPAddr
 	SelfAddr  string
 
+	// Replicas is the number of peers that are
+	// eligible to process each blob. Each blob is
+	// assigned to its highest-ranked peer, and if
+	// that peer fails, the blob is re-planned onto
+	// the next-ranked peer among its Replicas
+	// highest-ranked peers. If Replicas is zero,
+	// every peer is eligible to process every blob.
+	//
+	// Peers are ranked for each blob using
+	// rendezvous hashing, so adding or removing
+	// a peer only moves the blobs that were
+	// (or will be) assigned to that peer, and
+	// each blob is only ever processed (and cached)
+	// by the same few peers.
+	Replicas int
+
+	// Limits, if non-nil, are the resource
+	// limits sent to peers along with each
+	// remote request.
+	Limits *cgroup.Limits
+
 	// MaxScan is the computed maximum bytes
 	// scanned after sparse indexing has been
 	// applied.
@@ -54,12 +79,16 @@ func (s *Splitter) Split(table expr.Node, handle plan.TableHandle) (plan.Subtabl
 		size = DefaultSplitSize
 	}
 	flt, _ := fh.CompileFilter()
+	peers := make([]peer, len(s.Peers))
 	splits := make([]split, len(s.Peers))
 	for i := range splits {
-		splits[i].tp = s.transport(i)
+		peers[i] = peer{name: s.Peers[i].String(), tp: s.transport(i)}
+		splits[i].tp = peers[i].tp
+		splits[i].peer = i
 	}
+	names := peerNames(peers)
 	insert := func(b blob.Interface) error {
-		i, err := s.partition(b)
+		i, err := s.partition(b, names)
 		if err != nil {
 			return err
 		}
@@ -88,7 +117,8 @@ func (s *Splitter) Split(table expr.Node, handle plan.TableHandle) (plan.Subtabl
 		}
 		sub = stripsub(c.Trailer, sub, flt)
 		for i := range sub {
-			s.MaxScan += uint64(sub[i].Decompressed())
+			size := sub[i].Decompressed()
+			s.MaxScan += uint64(size)
 			if err := insert(&sub[i]); err != nil {
 				return nil, err
 			}
@@ -101,6 +131,11 @@ func (s *Splitter) Split(table expr.Node, handle plan.TableHandle) (plan.Subtabl
 		fields:    fh.Fields,
 		allFields: fh.AllFields,
 		filter:    nil, // pushed down later
+		masks:     fh.Masks,
+		rowFilter: fh.RowFilter,
+		peers:     peers,
+		replicas:  s.Replicas,
+		failed:    new(peerSet),
 		fn:        blobsToHandle,
 	}, nil
 }
@@ -131,21 +166,46 @@ func stripsub(t *blockfmt.Trailer, lst []blob.CompressedPart, f *blockfmt.Filter
 }
 
 // partition returns the index of the peer which should
-// handle the specified blob.
-func (s *Splitter) partition(b blob.Interface) (int, error) {
+// handle the specified blob, given the names of the peers
+//
+// The assignment depends only on the blob's ETag and
+// the set of peers (and not on the other blobs being
+// split), so each blob is consistently assigned to the
+// same peer across queries.
+func (s *Splitter) partition(b blob.Interface, names []string) (int, error) {
 	info, err := b.Stat()
 	if err != nil {
 		return 0, err
 	}
+	return rank(info.ETag, names)[0], nil
+}
 
+// rank returns the indices of the peers in names
+// ordered by their rendezvous hash score for the
+// blob with the given ETag, from highest to lowest
+func rank(etag string, names []string) []int {
 	// just two fixed random values
 	key0 := uint64(0x5d1ec810)
 	key1 := uint64(0xfebed702)
 
-	hash := siphash.Hash(key0, key1, []byte(info.ETag))
-	maxUint64 := ^uint64(0)
-	idx := hash / (maxUint64 / uint64(len(s.Peers)))
-	return int(idx), nil
+	scores := make([]uint64, len(names))
+	idx := make([]int, len(names))
+	buf := make([]byte, 0, len(etag)+32)
+	for i := range names {
+		buf = append(buf[:0], etag...)
+		buf = append(buf, 0)
+		buf = append(buf, names[i]...)
+		scores[i] = siphash.Hash(key0, key1, buf)
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool {
+		si, sj := scores[idx[i]], scores[idx[j]]
+		if si == sj {
+			return names[idx[i]] < names[idx[j]]
+		}
+		return si > sj
+	})
+	return idx
 }
 
 func (s *Splitter) transport(i int) plan.Transport {
@@ -159,15 +219,18 @@ func (s *Splitter) transport(i int) plan.Transport {
 		Net:     "tcp",
 		Addr:    nodeID,
 		Timeout: 3 * time.Second,
+		Limits:  s.Limits,
 	}
 }
 
 type split struct {
 	tp    plan.Transport
 	blobs []int
+	peer  int // index into Subtables.peers, or -1
 }
 
-// encode as [tp, blobs]
+// encode as [tp, blobs, peer]
+// where peer is omitted if it is unknown
 func (s *split) encode(st *ion.Symtab, buf *ion.Buffer) error {
 	buf.BeginList(-1)
 	if err := plan.EncodeTransport(s.tp, st, buf); err != nil {
@@ -178,12 +241,82 @@ func (s *split) encode(st *ion.Symtab, buf *ion.Buffer) error {
 		buf.WriteInt(int64(s.blobs[i]))
 	}
 	buf.EndList()
+	if s.peer >= 0 {
+		buf.WriteInt(int64(s.peer))
+	}
 	buf.EndList()
 	return nil
 }
 
+// peer is one of the peers that
+// subtables may be assigned to
+type peer struct {
+	name string // used for ranking
+	tp   plan.Transport
+}
+
+func peerNames(lst []peer) []string {
+	out := make([]string, len(lst))
+	for i := range lst {
+		out[i] = lst[i].name
+	}
+	return out
+}
+
+// encode as [name, tp]
+func (p *peer) encode(st *ion.Symtab, buf *ion.Buffer) error {
+	buf.BeginList(-1)
+	buf.WriteString(p.name)
+	if err := plan.EncodeTransport(p.tp, st, buf); err != nil {
+		return err
+	}
+	buf.EndList()
+	return nil
+}
+
+func decodePeer(st *ion.Symtab, body []byte) (peer, error) {
+	var p peer
+	if ion.TypeOf(body) != ion.ListType {
+		return p, fmt.Errorf("expected a list; found ion type %s", ion.TypeOf(body))
+	}
+	body, _ = ion.Contents(body)
+	if body == nil {
+		return p, fmt.Errorf("invalid list encoding")
+	}
+	var err error
+	p.name, body, err = ion.ReadString(body)
+	if err != nil {
+		return p, err
+	}
+	p.tp, err = plan.DecodeTransport(st, body)
+	return p, err
+}
+
+// peerSet is the set of peers that
+// have failed during query execution
+type peerSet struct {
+	lock sync.Mutex
+	set  map[int]struct{}
+}
+
+func (p *peerSet) add(i int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.set == nil {
+		p.set = make(map[int]struct{})
+	}
+	p.set[i] = struct{}{}
+}
+
+func (p *peerSet) has(i int) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	_, ok := p.set[i]
+	return ok
+}
+
 func decodeSplit(st *ion.Symtab, body []byte) (split, error) {
-	var s split
+	s := split{peer: -1}
 	if ion.TypeOf(body) != ion.ListType {
 		return s, fmt.Errorf("expected a list; found ion type %s", ion.TypeOf(body))
 	}
@@ -197,7 +330,7 @@ func decodeSplit(st *ion.Symtab, body []byte) (split, error) {
 		return s, err
 	}
 	body = body[ion.SizeOf(body):]
-	_, err = ion.UnpackList(body, func(body []byte) error {
+	body, err = ion.UnpackList(body, func(body []byte) error {
 		n, _, err := ion.ReadInt(body)
 		if err != nil {
 			return err
@@ -205,12 +338,17 @@ func decodeSplit(st *ion.Symtab, body []byte) (split, error) {
 		s.blobs = append(s.blobs, int(n))
 		return nil
 	})
+	if err != nil || len(body) == 0 {
+		return s, err
+	}
+	n, _, err := ion.ReadInt(body)
+	s.peer = int(n)
 	return s, err
 }
 
 // A tableHandleFn is used to produce a TableHandle
-// from a list of blobs and a filter.
-type tableHandleFn func(blobs []blob.Interface, h *plan.Hints) plan.TableHandle
+// from a list of blobs, a filter, and a list of masks.
+type tableHandleFn func(blobs []blob.Interface, h *plan.Hints, masks []db.Mask) plan.TableHandle
 
 // Subtables is the plan.Subtables implementation
 // returned by (*splitter).Split.
@@ -224,6 +362,20 @@ type Subtables struct {
 	fields    []string
 	allFields bool
 
+	// masks and row filter from
+	// the original FilterHandle
+	masks     []db.Mask
+	rowFilter expr.Node
+
+	// peers is the list of peers that
+	// subtables may be re-planned onto,
+	// and replicas is the number of
+	// highest-ranked peers that are eligible
+	// to process each blob (see Splitter.Replicas)
+	peers    []peer
+	replicas int
+	failed   *peerSet
+
 	next *Subtables // set if combined
 
 	// fn is called to produce the TableHandles
@@ -259,26 +411,33 @@ func (s *Subtables) Subtable(i int, sub *plan.Subtable) {
 		Filter:    s.filter,
 		Fields:    s.fields,
 		AllFields: s.allFields,
+		RowFilter: s.rowFilter,
 	}
 	*sub = plan.Subtable{
 		Transport: sp.tp,
 		Table:     table,
-		Handle:    s.fn(blobs, &hint),
+		Handle:    s.fn(blobs, &hint, s.masks),
 	}
 }
 
-func blobsToHandle(blobs []blob.Interface, hints *plan.Hints) plan.TableHandle {
+func blobsToHandle(blobs []blob.Interface, hints *plan.Hints, masks []db.Mask) plan.TableHandle {
 	return &FilterHandle{
 		Blobs:     &blob.List{Contents: blobs},
 		Fields:    hints.Fields,
 		AllFields: hints.AllFields,
 		Expr:      hints.Filter,
+		Masks:     masks,
+		RowFilter: hints.RowFilter,
 	}
 }
 
 // Encode implements plan.Subtables.Encode.
 func (s *Subtables) Encode(st *ion.Symtab, dst *ion.Buffer) error {
-	// encode as [splits, table, blobs, filter, fields, next]
+	// encode as [splits, table, blobs, filter, fields, next, masks, peers, row_filter, replicas]
+	// where masks are null or omitted if there are none,
+	// peers are [] or omitted if there are none,
+	// row_filter is null or omitted if there is none,
+	// and replicas is omitted if it is zero
 	dst.BeginList(-1)
 	dst.BeginList(-1)
 	for i := range s.splits {
@@ -310,6 +469,28 @@ func (s *Subtables) Encode(st *ion.Symtab, dst *ion.Buffer) error {
 	} else if err := s.next.Encode(st, dst); err != nil {
 		return err
 	}
+	if len(s.masks) > 0 {
+		encodeMasks(dst, st, s.masks)
+	} else if len(s.peers) > 0 || s.rowFilter != nil || s.replicas != 0 {
+		dst.WriteNull()
+	}
+	if len(s.peers) > 0 || s.rowFilter != nil || s.replicas != 0 {
+		dst.BeginList(-1)
+		for i := range s.peers {
+			if err := s.peers[i].encode(st, dst); err != nil {
+				return err
+			}
+		}
+		dst.EndList()
+	}
+	if s.rowFilter != nil {
+		s.rowFilter.Encode(dst, st)
+	} else if s.replicas != 0 {
+		dst.WriteNull()
+	}
+	if s.replicas != 0 {
+		dst.WriteInt(int64(s.replicas))
+	}
 	dst.EndList()
 	return nil
 }
@@ -376,9 +557,112 @@ func DecodeSubtables(st *ion.Symtab, body []byte, fn tableHandleFn) (*Subtables,
 			return nil, err
 		}
 	}
+	body = body[ion.SizeOf(body):]
+	if len(body) > 0 {
+		if ion.TypeOf(body) == ion.NullType {
+			body = body[ion.SizeOf(body):]
+		} else {
+			s.masks, body, err = decodeMasks(st, body)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(body) > 0 {
+		body, err = ion.UnpackList(body, func(body []byte) error {
+			p, err := decodePeer(st, body)
+			if err != nil {
+				return err
+			}
+			s.peers = append(s.peers, p)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.failed = new(peerSet)
+	}
+	if len(body) > 0 {
+		if ion.TypeOf(body) == ion.NullType {
+			body = body[ion.SizeOf(body):]
+		} else {
+			s.rowFilter, body, err = expr.Decode(st, body)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(body) > 0 {
+		var n int64
+		n, _, err = ion.ReadInt(body)
+		if err != nil {
+			return nil, err
+		}
+		s.replicas = int(n)
+	}
 	return s, nil
 }
 
+// Replan implements plan.Replanner.Replan.
+//
+// The blobs in subtable i are re-assigned to
+// their highest-ranked peers that have not
+// already failed. Only the first s.replicas
+// ranked peers (or every peer, if s.replicas
+// is zero) are eligible for each blob.
+func (s *Subtables) Replan(i int) plan.Subtables {
+	if s.next != nil && i >= len(s.splits) {
+		return s.next.Replan(i - len(s.splits))
+	}
+	sp := &s.splits[i]
+	if sp.peer < 0 || sp.peer >= len(s.peers) || s.failed == nil {
+		return nil
+	}
+	s.failed.add(sp.peer)
+	names := peerNames(s.peers)
+	splits := make([]split, len(s.peers))
+	for j := range splits {
+		splits[j].tp = s.peers[j].tp
+		splits[j].peer = j
+	}
+	for _, bi := range sp.blobs {
+		info, err := s.blobs[bi].Stat()
+		if err != nil {
+			return nil
+		}
+		p := -1
+		ranked := rank(info.ETag, names)
+		if s.replicas > 0 && s.replicas < len(ranked) {
+			ranked = ranked[:s.replicas]
+		}
+		for _, j := range ranked {
+			if !s.failed.has(j) {
+				p = j
+				break
+			}
+		}
+		if p < 0 {
+			// every eligible peer has failed
+			return nil
+		}
+		splits[p].blobs = append(splits[p].blobs, bi)
+	}
+	return &Subtables{
+		splits:    compact(splits),
+		table:     s.table,
+		blobs:     s.blobs,
+		filter:    s.filter,
+		fields:    s.fields,
+		allFields: s.allFields,
+		masks:     s.masks,
+		rowFilter: s.rowFilter,
+		peers:     s.peers,
+		replicas:  s.replicas,
+		failed:    s.failed,
+		fn:        s.fn,
+	}
+}
+
 // Filter implements plan.Subtables.Filter.
 func (s *Subtables) Filter(e expr.Node) {
 	s.filter = e
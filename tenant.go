@@ -91,12 +91,14 @@ var _ plan.SubtableDecoder = (*TenantEnv)(nil)
 
 // DecodeSubtables implements plan.SubtableDecoder.
 func (t *TenantEnv) DecodeSubtables(st *ion.Symtab, buf []byte) (plan.Subtables, error) {
-	thfn := func(blobs []blob.Interface, hint *plan.Hints) plan.TableHandle {
+	thfn := func(blobs []blob.Interface, hint *plan.Hints, masks []db.Mask) plan.TableHandle {
 		h := &FilterHandle{
 			Blobs:     &blob.List{Contents: blobs},
 			Fields:    hint.Fields,
 			AllFields: hint.AllFields,
 			Expr:      hint.Filter,
+			Masks:     masks,
+			RowFilter: hint.RowFilter,
 		}
 		return &TenantHandle{parent: t, inner: h}
 	}
@@ -161,7 +163,10 @@ func (h *TenantHandle) Open(ctx context.Context) (vm.Table, error) {
 	if CacheLimit > 0 && size > CacheLimit {
 		flags = dcache.FlagNoFill
 	}
-	return h.parent.Cache.MultiTable(ctx, segs, flags), nil
+	// the row filter is applied to the rows
+	// before they are masked
+	t := restricted(h.parent.Cache.MultiTable(ctx, segs, flags), fh.RowFilter)
+	return masked(t, fh.Masks), nil
 }
 
 func (h *TenantHandle) Filter(e expr.Node) plan.TableHandle {
@@ -283,7 +288,7 @@ func (b *blobSegment) Decode(dst io.Writer, src []byte) error {
 		dec.Malloc = vmMalloc
 		dec.Free = vm.Free
 		dec.Fields = b.fieldList()
-		dec.Set(c.Parent.Trailer, c.EndBlock)
+		dec.SetRange(c.Parent.Trailer, c.StartBlock, c.EndBlock)
 		_, err := dec.CopyBytes(dst, src)
 		return err
 	}
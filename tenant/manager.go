@@ -76,7 +76,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -144,6 +146,14 @@ type Manager struct {
 	// cg maps tenants to cgroups
 	cg func(id tnproto.ID) cgroup.Dir
 
+	// limits maps tenants to the resource
+	// limits for their cgroups (guarded by lock)
+	limits map[tnproto.ID]*cgroup.Limits
+	// peerLimits is the set of tenants whose
+	// limits were sent by a peer rather than
+	// set with SetLimits (guarded by lock)
+	peerLimits map[tnproto.ID]bool
+
 	// gcInterval is the interval at which
 	// processes that have been inactive for
 	// an extended period of time will be killed.
@@ -330,6 +340,34 @@ type child struct {
 	ctl     *net.UnixConn
 	touched time.Time
 	cg      cgroup.Dir
+
+	// exited is closed by reap
+	// once the process has exited
+	exited chan struct{}
+	// oomBase is the value of oom_kill
+	// in memory.events when the child was
+	// launched, and oom is set if the child
+	// exited after it was incremented
+	oomBase int64
+	oom     int32
+}
+
+// oomKilled returns true if the child
+// was killed by the OOM killer.
+// oomKilled waits up to one second for
+// the child to exit.
+func (c *child) oomKilled() bool {
+	if c.cg.IsZero() {
+		return false
+	}
+	t := time.NewTimer(time.Second)
+	defer t.Stop()
+	select {
+	case <-c.exited:
+		return atomic.LoadInt32(&c.oom) != 0
+	case <-t.C:
+		return false
+	}
 }
 
 var bufPool = sync.Pool{
@@ -370,9 +408,22 @@ func (c *child) unlock() {
 // currently pending for the same tenant.
 var ErrOverloaded = errors.New("child overloaded")
 
-func (c *child) directExec(t *plan.Tree, ofmt tnproto.OutputFormat, conn net.Conn) (io.ReadCloser, error) {
+// ErrOOMKilled is returned by Check when
+// the tenant process was killed because
+// it exceeded its memory limit.
+// (See Manager.SetLimits.)
+var ErrOOMKilled = errors.New("query aborted: tenant process exceeded its memory limit")
+
+// execResult is the io.ReadCloser
+// returned from child.directExec
+type execResult struct {
+	io.ReadCloser
+	c *child
+}
+
+func (c *child) directExec(t *plan.Tree, lim *plan.Limits, ofmt tnproto.OutputFormat, conn net.Conn) (io.ReadCloser, error) {
 	buf := bufPool.Get().(*tnproto.Buffer)
-	err := buf.Prepare(t, ofmt)
+	err := buf.PrepareWithLimits(t, ofmt, lim)
 	if err != nil {
 		return nil, err
 	}
@@ -382,7 +433,10 @@ func (c *child) directExec(t *plan.Tree, ofmt tnproto.OutputFormat, conn net.Con
 	defer c.unlock()
 	ret, err := buf.DirectExec(c.ctl, conn)
 	bufPool.Put(buf)
-	return ret, err
+	if err != nil {
+		return nil, err
+	}
+	return &execResult{ReadCloser: ret, c: c}, nil
 }
 
 func (c *child) proxyExec(peer net.Conn) error {
@@ -407,6 +461,15 @@ func (m *Manager) reap(c *child, id tnproto.ID) {
 		panic(err)
 	}
 	_ = state // TODO: examine state
+	if !c.cg.IsZero() {
+		// the cgroup may be removed below,
+		// so check for OOM kills first
+		n, err := c.cg.OOMKills()
+		if err == nil && n > c.oomBase {
+			atomic.StoreInt32(&c.oom, 1)
+		}
+	}
+	defer close(c.exited)
 	m.lock.Lock()
 	// only delete this child if it
 	// precisely the same child instance
@@ -566,13 +629,6 @@ func (m *Manager) launch(id tnproto.ID, key tnproto.Key) (*child, error) {
 	// open, since it is connected to the local fd
 	defer fd.Close()
 
-	// TODO: sandbox the query process.
-	// We can use a tool like bwrap(1) to make most
-	// of the filesystem and other pids invisible
-	// to the child process. We can also stick it
-	// in its own cgroup if we want to limit its
-	// memory and CPU use as well.
-	//
 	// the first file descriptor in exec.Cmd.ExtraFiles
 	// is always "3", so we pass that as the argument
 	// immediately following the tenant id
@@ -600,6 +656,7 @@ func (m *Manager) launch(id tnproto.ID, key tnproto.Key) (*child, error) {
 	cmd.ExtraFiles = []*os.File{fd, m.eventfd}
 
 	var cg cgroup.Dir
+	var oomBase int64
 	if m.Sandbox && CanSandbox() {
 		if m.cg != nil {
 			cg = m.cg(id)
@@ -607,6 +664,13 @@ func (m *Manager) launch(id tnproto.ID, key tnproto.Key) (*child, error) {
 			if err != nil {
 				return nil, err
 			}
+			if l := m.limits[id]; l != nil {
+				err = applyLimits(cg, l)
+				if err != nil {
+					return nil, err
+				}
+			}
+			oomBase, _ = cg.OOMKills()
 		}
 		err = m.sandboxStart(cmd, cg, m.cacheDir(id))
 	} else {
@@ -629,9 +693,98 @@ func (m *Manager) launch(id tnproto.ID, key tnproto.Key) (*child, error) {
 		ctl:     local,
 		touched: time.Now(),
 		cg:      cg,
+		exited:  make(chan struct{}),
+		oomBase: oomBase,
 	}, nil
 }
 
+func applyLimits(cg cgroup.Dir, l *cgroup.Limits) error {
+	err := cg.Parent().EnableControllers(l.Controllers()...)
+	if err != nil {
+		return fmt.Errorf("enabling cgroup controllers: %w", err)
+	}
+	err = cg.SetLimits(l)
+	if err != nil {
+		return fmt.Errorf("setting cgroup limits: %w", err)
+	}
+	return nil
+}
+
+// SetLimits sets the resource limits for the
+// cgroup of the tenant process with the given ID.
+// If l is nil, the limits are removed.
+//
+// The limits are applied when the tenant
+// process is launched, and they are applied
+// immediately if the process is already running.
+// Limits are only enforced when the Manager is
+// configured with Sandbox and WithCgroup.
+//
+// Limits set with SetLimits take precedence
+// over limits sent by peers with remote
+// requests (see tnproto.AttachWithLimits).
+func (m *Manager) SetLimits(id tnproto.ID, l *cgroup.Limits) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.peerLimits, id)
+	return m.setLimits(id, l)
+}
+
+// setPeerLimits sets the resource limits for
+// a tenant process that executes a query on
+// behalf of a peer, unless the limits for the
+// tenant have been set with SetLimits.
+//
+// The limits are forwarded by the tenant process
+// on the peer, which is not trusted to choose its
+// own limits, so they only take effect where no
+// limits have been configured locally, and they
+// can only make the current limits stricter
+// (see cgroup.Limits.Tighten).
+func (m *Manager) setPeerLimits(id tnproto.ID, l *cgroup.Limits) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	prev, ok := m.limits[id]
+	if ok && !m.peerLimits[id] {
+		return nil
+	}
+	if m.peerLimits == nil {
+		m.peerLimits = make(map[tnproto.ID]bool)
+	}
+	m.peerLimits[id] = true
+	return m.setLimits(id, prev.Tighten(l))
+}
+
+// keyMatches returns false if there is a live
+// process for id that was launched with a key
+// other than key.
+func (m *Manager) keyMatches(id tnproto.ID, key tnproto.Key) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	c, ok := m.live[id]
+	return !ok || c.key == key
+}
+
+func (m *Manager) setLimits(id tnproto.ID, l *cgroup.Limits) error {
+	prev := m.limits[id]
+	if l == nil {
+		delete(m.limits, id)
+	} else {
+		if m.limits == nil {
+			m.limits = make(map[tnproto.ID]*cgroup.Limits)
+		}
+		m.limits[id] = l
+	}
+	c, ok := m.live[id]
+	if !ok || c.cg.IsZero() || reflect.DeepEqual(prev, l) {
+		return nil
+	}
+	if l == nil {
+		l = &cgroup.Limits{}
+	}
+	return applyLimits(c.cg, l)
+}
+
 // get acquires the handle to a child process,
 // exec-ing the tenant associated with 'id'
 // if it has not been started yet
@@ -691,11 +844,21 @@ func (m *Manager) get(id tnproto.ID, key tnproto.Key) (*child, error) {
 // to Do will not close the connection from
 // the perspective of the tenant process.)
 func (m *Manager) Do(id tnproto.ID, key tnproto.Key, t *plan.Tree, ofmt tnproto.OutputFormat, into net.Conn) (io.ReadCloser, error) {
+	return m.DoWithLimits(id, key, t, nil, ofmt, into)
+}
+
+// DoWithLimits is like Do, except that the
+// tenant enforces lim while it executes the query
+// (and passes the limits along to any remote peers
+// that execute parts of the query).
+// If the query exceeds one of the limits, then
+// Check returns a *plan.LimitError.
+func (m *Manager) DoWithLimits(id tnproto.ID, key tnproto.Key, t *plan.Tree, lim *plan.Limits, ofmt tnproto.OutputFormat, into net.Conn) (io.ReadCloser, error) {
 	c, err := m.get(id, key)
 	if err != nil {
 		return nil, err
 	}
-	return c.directExec(t, ofmt, into)
+	return c.directExec(t, lim, ofmt, into)
 }
 
 // Quit sends a SIGQUIT to the tenant process
@@ -718,13 +881,24 @@ func (m *Manager) Quit(id tnproto.ID) bool {
 // tenant error pipe returned from Manager.Do.
 // Check blocks until the other end of the pipe
 // has been closed, and then closes this end of the pipe.
+//
+// If the query exceeded its limits (see Manager.DoWithLimits),
+// then Check returns a *plan.LimitError and
+// sets stats to the stats collected before
+// the query was aborted.
 func Check(rc io.ReadCloser, stats *plan.ExecStats) error {
 	defer rc.Close()
 	msg, err := io.ReadAll(rc)
 	if err != nil {
+		if r, ok := rc.(*execResult); ok && r.c.oomKilled() {
+			return ErrOOMKilled
+		}
 		return err
 	}
 	if len(msg) == 0 {
+		if r, ok := rc.(*execResult); ok && r.c.oomKilled() {
+			return ErrOOMKilled
+		}
 		return &tnproto.RemoteError{Text: "tenant crashed"}
 	}
 	if ion.TypeOf(msg) == ion.StringType {
@@ -734,6 +908,14 @@ func Check(rc io.ReadCloser, stats *plan.ExecStats) error {
 		}
 		return &tnproto.RemoteError{Text: "(malformed error response)"}
 	}
+	if ion.TypeOf(msg) == ion.AnnotationType {
+		lerr := new(plan.LimitError)
+		if lerr.UnmarshalBinary(msg) != nil {
+			return &tnproto.RemoteError{Text: "(malformed error response)"}
+		}
+		*stats = lerr.Stats
+		return lerr
+	}
 	err = stats.UnmarshalBinary(msg)
 	if err == nil {
 		return nil
@@ -752,7 +934,7 @@ func (m *Manager) errorf(msg string, args ...interface{}) {
 // tenant on *this* machine
 func (m *Manager) handleRemote(conn net.Conn) {
 	defer conn.Close()
-	id, key, err := tnproto.ReadHeader(conn)
+	id, key, lim, err := tnproto.ReadAttach(conn)
 	if err != nil {
 		m.errorf("connection: %s", err)
 		return
@@ -760,6 +942,21 @@ func (m *Manager) handleRemote(conn net.Conn) {
 	if id.IsZero() {
 		return // ping message; just expecting a Close()
 	}
+	if lim != nil {
+		// don't let a peer with the wrong key
+		// change the limits of a live process;
+		// closing the connection fails the query
+		// on the peer
+		if !m.keyMatches(id, key) {
+			m.errorf("key mismatch, possible compromised tenant: %s", id)
+			return
+		}
+		err = m.setPeerLimits(id, lim)
+		if err != nil {
+			m.errorf("id %s: updating resource limits: %s", id, err)
+			return
+		}
+	}
 	c, err := m.get(id, key)
 	if err != nil {
 		m.errorf("couldn't spawn %x: %s", id, err)
@@ -28,6 +28,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"strconv"
 	"strings"
@@ -782,3 +783,53 @@ func (b *benchenv) Stat(_ expr.Node, _ *plan.Hints) (plan.TableHandle, error) {
 	}
 	return &benchHandle{&blob.List{lst}}, nil
 }
+
+func TestCheckOOM(t *testing.T) {
+	for _, oom := range []int32{0, 1} {
+		c := &child{
+			cg:     cgroup.Dir("/sys/fs/cgroup/test"),
+			exited: make(chan struct{}),
+			oom:    oom,
+		}
+		close(c.exited)
+		rc := &execResult{ReadCloser: io.NopCloser(strings.NewReader("")), c: c}
+		var stats plan.ExecStats
+		err := Check(rc, &stats)
+		if oom != 0 && !errors.Is(err, ErrOOMKilled) {
+			t.Errorf("expected ErrOOMKilled; got %v", err)
+		} else if oom == 0 && (err == nil || errors.Is(err, ErrOOMKilled)) {
+			t.Errorf("expected a crash error; got %v", err)
+		}
+	}
+}
+
+func TestPeerLimits(t *testing.T) {
+	m := &Manager{}
+	var id tnproto.ID
+	id[0] = 1
+	set := func(l *cgroup.Limits) {
+		if err := m.setPeerLimits(id, l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(want *cgroup.Limits) {
+		t.Helper()
+		if got := m.limits[id]; !reflect.DeepEqual(got, want) {
+			t.Errorf("got limits %+v, want %+v", got, want)
+		}
+	}
+	set(&cgroup.Limits{MemoryMax: 1 << 30, CPUMax: 2})
+	check(&cgroup.Limits{MemoryMax: 1 << 30, CPUMax: 2})
+	// a peer can't relax or remove the limits
+	set(&cgroup.Limits{})
+	set(&cgroup.Limits{MemoryMax: 1 << 40, CPUMax: 4})
+	check(&cgroup.Limits{MemoryMax: 1 << 30, CPUMax: 2})
+	set(&cgroup.Limits{MemoryMax: 1 << 20})
+	check(&cgroup.Limits{MemoryMax: 1 << 20, CPUMax: 2})
+	// local limits take precedence
+	if err := m.SetLimits(id, &cgroup.Limits{MemoryMax: 1 << 32}); err != nil {
+		t.Fatal(err)
+	}
+	set(&cgroup.Limits{MemoryMax: 1 << 10})
+	check(&cgroup.Limits{MemoryMax: 1 << 32})
+}
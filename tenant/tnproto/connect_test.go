@@ -20,11 +20,13 @@ import (
 	"io"
 	"math/rand"
 	"net"
+	"reflect"
 	"runtime"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/SnellerInc/sneller/cgroup"
 	"github.com/SnellerInc/sneller/expr"
 	"github.com/SnellerInc/sneller/ion"
 	"github.com/SnellerInc/sneller/plan"
@@ -62,6 +64,64 @@ func TestAttach(t *testing.T) {
 	}
 }
 
+func TestAttachWithLimits(t *testing.T) {
+	lim := &cgroup.Limits{
+		MemoryMax: 1 << 30,
+		CPUWeight: 200,
+		CPUMax:    1.5,
+	}
+	for _, want := range []*cgroup.Limits{nil, lim} {
+		r, w := net.Pipe()
+		id, key := randpair()
+		go func() {
+			err := AttachWithLimits(w, id, key, want)
+			if err != nil {
+				panic(err)
+			}
+			w.Close()
+		}()
+		outid, outkey, outlim, err := ReadAttach(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != outid {
+			t.Fatalf("got id %x; wanted %x", outid, id)
+		}
+		if key != outkey {
+			t.Fatalf("got key %x; wanted %x", outkey, key)
+		}
+		if !reflect.DeepEqual(outlim, want) {
+			t.Fatalf("got limits %+v; wanted %+v", outlim, want)
+		}
+	}
+}
+
+func TestRemoteLimits(t *testing.T) {
+	id, key := randpair()
+	r := &Remote{
+		ID:     id,
+		Key:    key,
+		Net:    "tcp",
+		Addr:   "127.0.0.1:9000",
+		Limits: &cgroup.Limits{MemoryMax: 1 << 30, CPUWeight: 50},
+	}
+	var st ion.Symtab
+	var buf ion.Buffer
+	r.Encode(&buf, &st)
+	tp, err := plan.DecodeTransport(&st, buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, ok := tp.(*Remote)
+	if !ok {
+		t.Fatalf("decoded %T", tp)
+	}
+	if !reflect.DeepEqual(out, r) {
+		t.Fatalf("got %+v; wanted %+v", out, r)
+	}
+}
+
 type largeOpaque struct{}
 
 func (l largeOpaque) Open(_ context.Context) (vm.Table, error) {
@@ -157,7 +157,7 @@ type serializer struct {
 	prepared bool
 }
 
-func (s *serializer) prepare(t *plan.Tree, f OutputFormat) error {
+func (s *serializer) prepare(t *plan.Tree, f OutputFormat, lim *plan.Limits) error {
 	s.prepared = false
 	s.stbuf.Reset()
 	copy(s.pre[:], directmsg)
@@ -169,6 +169,10 @@ func (s *serializer) prepare(t *plan.Tree, f OutputFormat) error {
 	if err != nil {
 		return err
 	}
+	// the limits, if any, follow the plan
+	if lim != nil && *lim != (plan.Limits{}) {
+		lim.Encode(&s.mainbuf, &s.st)
+	}
 	s.st.Marshal(&s.stbuf, true)
 	size := uint32(s.mainbuf.Size() + s.stbuf.Size() - 8)
 	binary.LittleEndian.PutUint32(s.stbuf.Bytes()[3:], size)
@@ -211,7 +215,16 @@ type Buffer struct {
 // the serialized query produced by
 // preceding calls to Prepare.
 func (b *Buffer) Prepare(t *plan.Tree, f OutputFormat) error {
-	return b.prepare(t, f)
+	return b.prepare(t, f, nil)
+}
+
+// PrepareWithLimits is like Prepare, except that
+// the tenant enforces lim while it executes the query.
+// If the query exceeds one of the limits, the error
+// returned through the pipe returned by DirectExec
+// is a *plan.LimitError (see plan.LimitError.Marshal).
+func (b *Buffer) PrepareWithLimits(t *plan.Tree, f OutputFormat, lim *plan.Limits) error {
+	return b.prepare(t, f, lim)
 }
 
 // DirectExec sends a query plan to a tenant
@@ -338,7 +351,13 @@ func Serve(ctl *net.UnixConn, dec plan.Decoder) error {
 			if err != nil {
 				return fmt.Errorf("tnproto.Serve: decoding symbol table: %w", err)
 			}
+			var lim plan.Limits
 			t, err := plan.Decode(dec, &st, tmp)
+			if err == nil {
+				if rest := tmp[ion.SizeOf(tmp):]; len(rest) > 0 {
+					err = lim.Decode(rest, &st)
+				}
+			}
 			if err != nil {
 				err = errnow(ctl, err, tmp)
 				if err != nil {
@@ -349,7 +368,7 @@ func Serve(ctl *net.UnixConn, dec plan.Decoder) error {
 				if err != nil {
 					return err
 				}
-				go serveDirect(t, ofmt.writer(conn), errorWriter)
+				go serveDirect(t, &lim, ofmt.writer(conn), errorWriter)
 			}
 		} else {
 			if conn != nil {
@@ -386,25 +405,32 @@ func pipectx(errpipe net.Conn) context.Context {
 
 func sendError(conn io.WriteCloser, err error) {
 	var st ion.Symtab
-	var buf ion.Buffer
+	var buf, body ion.Buffer
 
 	// send
 	//   query_error::{error_message: "..."}
-	errsym := st.Intern("query_error")
-	message := st.Intern("error_message")
+	// or, if the query exceeded its limits,
+	//   query_error::{error_message: "...", limit: {...}}
+	// (see plan.LimitError.Encode)
+	body.BeginAnnotation(1)
+	body.BeginField(st.Intern("query_error"))
+	body.BeginStruct(-1)
+	body.BeginField(st.Intern("error_message"))
+	body.WriteString(err.Error())
+	var lerr *plan.LimitError
+	if errors.As(err, &lerr) {
+		body.BeginField(st.Intern("limit"))
+		lerr.Encode(&body, &st)
+	}
+	body.EndStruct()
+	body.EndAnnotation()
 	st.Marshal(&buf, true)
-	buf.BeginAnnotation(1)
-	buf.BeginField(errsym)
-	buf.BeginStruct(-1)
-	buf.BeginField(message)
-	buf.WriteString(err.Error())
-	buf.EndStruct()
-	buf.EndAnnotation()
+	buf.UnsafeAppend(body.Bytes())
 
 	conn.Write(buf.Bytes())
 }
 
-func serveDirect(t *plan.Tree, conn io.WriteCloser, errpipe net.Conn) {
+func serveDirect(t *plan.Tree, lim *plan.Limits, conn io.WriteCloser, errpipe net.Conn) {
 	defer errpipe.Close() // cancels ctx
 	ctx := pipectx(errpipe)
 
@@ -428,15 +454,20 @@ func serveDirect(t *plan.Tree, conn io.WriteCloser, errpipe net.Conn) {
 	ep := plan.ExecParams{
 		Output:  conn,
 		Context: ctx,
+		Limits:  *lim,
 	}
 	err := pl.Exec(t, &ep)
+	var lerr *plan.LimitError
+	errors.As(err, &lerr)
 	if err != nil {
 		sendError(conn, err)
 	}
 	// must close the connection before
 	// indicating the query status to the caller
 	conn.Close()
-	if err != nil {
+	if lerr != nil {
+		lerr.Marshal(&outbuf)
+	} else if err != nil {
 		outbuf.WriteString(err.Error())
 	} else {
 		ep.Stats.Marshal(&outbuf)
@@ -18,9 +18,12 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
+
+	"github.com/SnellerInc/sneller/cgroup"
 )
 
 const (
@@ -43,8 +46,21 @@ const (
 	magicSize   = 8
 	idOffset    = magicOffset + magicSize
 	keyOffset   = idOffset + IDSize
+	flagsOffset = keyOffset + KeySize
 )
 
+// header flags
+const (
+	// flagLimits indicates that the header
+	// is followed by a 4-byte little-endian length
+	// and a JSON-encoded cgroup.Limits
+	flagLimits = 1 << iota
+)
+
+// maxLimitsSize is the maximum size
+// of the limits following a header
+const maxLimitsSize = 64 * 1024
+
 // mostly random, but choosing 0xf0 as the first byte
 // means this cannot be confused for ion data
 const headerMagic uint64 = 0xf02edb72b983e448
@@ -95,6 +111,8 @@ func (h *header) Key() (key Key) {
 	return
 }
 
+func (h *header) flags() byte { return h.body[flagsOffset] }
+
 func (h *header) populate(id ID, key Key) {
 	binary.LittleEndian.PutUint64(h.body[magicOffset:], headerMagic)
 	copy(h.body[idOffset:], id[:])
@@ -104,16 +122,55 @@ func (h *header) populate(id ID, key Key) {
 // ReadHeader reads an Attach message from the
 // provided connection and returns the requested ID,
 // or an error if the message could not be read.
+// Any limits sent with AttachWithLimits are discarded.
 //
-// See also: Attach
+// See also: Attach, ReadAttach
 func ReadHeader(src net.Conn) (ID, Key, error) {
+	id, key, _, err := ReadAttach(src)
+	return id, key, err
+}
+
+// ReadAttach reads an Attach or AttachWithLimits
+// message from the provided connection and returns
+// the requested ID and the limits sent with it
+// (or nil if there were none), or an error if the
+// message could not be read.
+func ReadAttach(src net.Conn) (ID, Key, *cgroup.Limits, error) {
 	var hdr header
 	_, err := io.ReadFull(src, hdr.body[:])
 	if err != nil {
-		return ID{}, Key{}, err
+		return ID{}, Key{}, nil, err
+	}
+	if err := hdr.validate(); err != nil {
+		return ID{}, Key{}, nil, err
 	}
 	if hdr.Key().IsZero() && !hdr.ID().IsZero() {
-		return ID{}, Key{}, fmt.Errorf("zero key")
+		return ID{}, Key{}, nil, fmt.Errorf("zero key")
+	}
+	var lim *cgroup.Limits
+	if hdr.flags()&flagLimits != 0 {
+		var size [4]byte
+		_, err := io.ReadFull(src, size[:])
+		if err != nil {
+			return ID{}, Key{}, nil, err
+		}
+		n := binary.LittleEndian.Uint32(size[:])
+		if n > maxLimitsSize {
+			return ID{}, Key{}, nil, fmt.Errorf("limits size %d exceeds maximum", n)
+		}
+		buf := make([]byte, n)
+		_, err = io.ReadFull(src, buf)
+		if err != nil {
+			return ID{}, Key{}, nil, err
+		}
+		lim = new(cgroup.Limits)
+		err = json.Unmarshal(buf, lim)
+		if err != nil {
+			return ID{}, Key{}, nil, fmt.Errorf("decoding limits: %w", err)
+		}
+		if err := lim.Validate(); err != nil {
+			return ID{}, Key{}, nil, err
+		}
 	}
-	return hdr.ID(), hdr.Key(), hdr.validate()
+	return hdr.ID(), hdr.Key(), lim, nil
 }
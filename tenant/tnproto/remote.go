@@ -15,11 +15,13 @@
 package tnproto
 
 import (
+	"encoding/json"
 	"fmt"
 	"net"
 	"sync"
 	"time"
 
+	"github.com/SnellerInc/sneller/cgroup"
 	"github.com/SnellerInc/sneller/ion"
 	"github.com/SnellerInc/sneller/plan"
 )
@@ -56,6 +58,12 @@ type Remote struct {
 	// of dialing (like DNS resolution)
 	// are part of the timeout window.
 	Timeout time.Duration
+
+	// Limits, if non-nil, are the resource
+	// limits that the remote tenant manager
+	// should apply to the tenant before
+	// executing the query. (See AttachWithLimits.)
+	Limits *cgroup.Limits
 }
 
 // callback for decoding remote transports
@@ -88,6 +96,13 @@ func decodeRemote(st *ion.Symtab, fields []byte) (plan.Transport, error) {
 			if err == nil && copy(out.Key[:], buf) != len(out.Key[:]) {
 				err = fmt.Errorf("decoding tnproto.Remote: tenant key should not be %d bytes", len(buf))
 			}
+		case "limits":
+			// encoded as JSON; see AttachWithLimits
+			buf, fields, err = ion.ReadStringShared(fields)
+			if err == nil {
+				out.Limits = new(cgroup.Limits)
+				err = json.Unmarshal(buf, out.Limits)
+			}
 		default:
 			fields = fields[ion.SizeOf(fields):]
 		}
@@ -110,6 +125,12 @@ func (r *Remote) Encode(dst *ion.Buffer, st *ion.Symtab) {
 	dst.WriteBlob(r.ID[:])
 	dst.BeginField(st.Intern("key"))
 	dst.WriteBlob(r.Key[:])
+	if r.Limits != nil {
+		// cgroup.Limits is always serializable
+		buf, _ := json.Marshal(r.Limits)
+		dst.BeginField(st.Intern("limits"))
+		dst.WriteStringBytes(buf)
+	}
 	dst.EndStruct()
 }
 
@@ -121,11 +142,12 @@ var clientPool = sync.Pool{
 
 // Exec implements plan.Transport.Exec
 // by dialing the address given by r.Net and r.Addr
-// and sending it an Attach message, followed
-// by a single query execution request with
-// plan.Client.Exec.
+// and sending it an Attach message (or an
+// AttachWithLimits message if r.Limits is set),
+// followed by a single query execution request
+// with plan.Client.Exec.
 //
-// See also: Attach
+// See also: Attach, AttachWithLimits
 func (r *Remote) Exec(t *plan.Tree, ep *plan.ExecParams) error {
 	dl := net.Dialer{Timeout: r.Timeout}
 	conn, err := dl.DialContext(ep.Context, r.Net, r.Addr)
@@ -134,7 +156,7 @@ func (r *Remote) Exec(t *plan.Tree, ep *plan.ExecParams) error {
 	}
 	// tell the tenant manager to attach us
 	// to the right tenant instance
-	err = Attach(conn, r.ID, r.Key)
+	err = AttachWithLimits(conn, r.ID, r.Key, r.Limits)
 	if err != nil {
 		conn.Close()
 		return err
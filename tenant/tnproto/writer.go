@@ -15,9 +15,13 @@
 package tnproto
 
 import (
+	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"io"
 	"net"
+
+	"github.com/SnellerInc/sneller/cgroup"
 )
 
 // Attach takes a fresh connection to a remote
@@ -31,6 +35,36 @@ func Attach(dst net.Conn, id ID, key Key) error {
 	return err
 }
 
+// AttachWithLimits is like Attach, but it also
+// asks the remote tenant manager to apply the
+// resource limits lim to the tenant before
+// attaching the connection to it.
+// (See tenant.Manager.SetLimits.)
+// The remote tenant manager only uses lim to
+// make its current limits for the tenant stricter.
+// If lim is nil, AttachWithLimits is equivalent to Attach.
+func AttachWithLimits(dst net.Conn, id ID, key Key, lim *cgroup.Limits) error {
+	if lim == nil {
+		return Attach(dst, id, key)
+	}
+	body, err := json.Marshal(lim)
+	if err != nil {
+		return err
+	}
+	if len(body) > maxLimitsSize {
+		return errors.New("tnproto.AttachWithLimits: limits too large")
+	}
+	var hdr header
+	hdr.populate(id, key)
+	hdr.body[flagsOffset] |= flagLimits
+	msg := make([]byte, 0, len(hdr.body)+4+len(body))
+	msg = append(msg, hdr.body[:]...)
+	msg = binary.LittleEndian.AppendUint32(msg, uint32(len(body)))
+	msg = append(msg, body...)
+	_, err = dst.Write(msg)
+	return err
+}
+
 // Ping sends an Attach message with a zero
 // tenant ID and waits for the remote end to
 // close the connection.
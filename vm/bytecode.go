@@ -387,7 +387,9 @@ var opinfo = [_maxbcop]bcopinfo{
 	opdatetruncmonth:         {text: "datetruncmonth", flags: bcReadK | bcReadWriteS},
 	opdatetruncquarter:       {text: "datetruncquarter", flags: bcReadK | bcReadWriteS},
 	opdatetruncyear:          {text: "datetruncyear", flags: bcReadK | bcReadWriteS},
+	opdatetzoffset:           {text: "datetzoffset", imms: bcImmsDict, flags: bcReadK | bcReadWriteS},
 	opunboxts:                {text: "unboxts", flags: bcReadK | bcWriteS},
+	opparsets:                {text: "parsets", imms: bcImmsDict, flags: bcReadWriteK | bcReadWriteS},
 	opboxts:                  {text: "boxts", flags: bcReadK | bcReadS, scratch: 16 * 16},
 	opconsttm:                {text: "consttm", imms: bcImmsDict, flags: bcReadWriteS},
 	optimelt:                 {text: "timelt", flags: bcReadWriteK | bcReadS},
@@ -105,6 +105,16 @@ func (d *DistinctFilter) Open() (io.WriteCloser, error) {
 	}), nil
 }
 
+// Memory implements MemoryUser.Memory
+func (d *DistinctFilter) Memory() int64 {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.dedup == nil {
+		return 0
+	}
+	return d.dedup.memory()
+}
+
 func (d *DistinctFilter) Close() error {
 	return d.out.Close()
 }
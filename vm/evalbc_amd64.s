@@ -8209,6 +8209,537 @@ TEXT bcdatetruncyear(SB), NOSPLIT|NOFRAME, $0
 
   NEXT()
 
+// TZ offset(timestamp, table)
+//
+// Z2:Z3 <- the UTC offset (in microseconds) in effect at each
+// timestamp, looked up in a table of zone transitions that is
+// encoded as [n][times...][offsets...], where n is a power of two,
+// times are sorted, times[0] == math.MinInt64, and all the values
+// are 64-bit integers (see tzTable in ssa.go)
+//
+// The lookup is a branch-free binary search for the last
+// transition that is less than or equal to the timestamp:
+//   idx = 0
+//   for step := n/2; step > 0; step /= 2 {
+//     if times[idx+step] <= ts { idx += step }
+//   }
+//   offset = offsets[idx]
+TEXT bcdatetzoffset(SB), NOSPLIT|NOFRAME, $0
+  IMM_FROM_DICT(R8)
+  KSHIFTRW $8, K1, K2
+  MOVQ 0(R8), R8                           // R8 <- &table[0]
+  MOVQ 0(R8), R15                          // R15 <- n
+  LEAQ 8(R8), CX                           // CX <- &times[0]
+  VPXORQ Z4, Z4, Z4                        // Z4 <- idx (low)
+  VPXORQ Z5, Z5, Z5                        // Z5 <- idx (high)
+  SHRQ $1, R15                             // R15 <- step
+  JZ lookup_offset
+
+search_loop:
+  VPBROADCASTQ R15, Z6
+  VPADDQ Z6, Z4, Z8                        // Z8 <- idx + step (low)
+  VPADDQ Z6, Z5, Z9                        // Z9 <- idx + step (high)
+  KMOVB K1, K3
+  KMOVB K2, K4
+  VPGATHERQQ 0(CX)(Z8*8), K3, Z10          // Z10 <- times[idx + step] (low)
+  VPGATHERQQ 0(CX)(Z9*8), K4, Z11          // Z11 <- times[idx + step] (high)
+  VPCMPQ $VPCMP_IMM_LE, Z2, Z10, K1, K3    // K3 <- times[idx + step] <= ts (low)
+  VPCMPQ $VPCMP_IMM_LE, Z3, Z11, K2, K4    // K4 <- times[idx + step] <= ts (high)
+  VMOVDQA64 Z8, K3, Z4
+  VMOVDQA64 Z9, K4, Z5
+  SHRQ $1, R15
+  JNZ search_loop
+
+lookup_offset:
+  MOVQ 0(R8), R15
+  LEAQ 0(CX)(R15*8), CX                    // CX <- &offsets[0]
+  KMOVB K1, K3
+  KMOVB K2, K4
+  VPGATHERQQ 0(CX)(Z4*8), K3, Z2           // Z2 <- offsets[idx] (low)
+  VPGATHERQQ 0(CX)(Z5*8), K4, Z3           // Z3 <- offsets[idx] (high)
+  NEXT()
+
+// TSFMT_TWO_DIGITS decodes the two ASCII digits
+// in the low 16 bits of SRC into DST, clearing
+// lanes in MASK that are not both digits
+#define TSFMT_TWO_DIGITS(SRC, DST, TMP, MASK)               \
+  VPANDD.BCST CONSTD_0xFF(), SRC, DST                       \
+  VPSRLD $8, SRC, TMP                                       \
+  VPANDD.BCST CONSTD_0xFF(), TMP, TMP                       \
+  VPSUBD.BCST CONSTD_48(), DST, DST                         \
+  VPSUBD.BCST CONSTD_48(), TMP, TMP                         \
+  VPCMPUD.BCST $VPCMP_IMM_LE, CONSTD_9(), DST, MASK, MASK   \
+  VPCMPUD.BCST $VPCMP_IMM_LE, CONSTD_9(), TMP, MASK, MASK   \
+  VPMULLD.BCST CONSTD_10(), DST, DST                        \
+  VPADDD TMP, DST, DST
+
+// parsets parses the strings in Z2:Z3 into
+// timestamps by interpreting a program compiled
+// from a date.Format (see tsfmtProgram); lanes
+// that do not match the format are cleared from K1
+//
+// The timestamp components are accumulated as dwords:
+//   Z4 = year, Z5 = month, Z6 = day, Z7 = hour,
+//   Z8 = minute, Z9 = second, Z10 = microseconds,
+//   Z11 = UTC offset in minutes, Z12 = 12 for PM, otherwise 0
+TEXT bcparsets(SB), NOSPLIT|NOFRAME, $0
+  IMM_FROM_DICT(R8)
+  MOVQ 0(R8), R8                           // R8 <- &program[0]
+  VPBROADCASTD CONSTD_1(), Z13             // Z13 <- 1
+  MOVL $1970, R14
+  VPBROADCASTD R14, Z4
+  VMOVDQA32 Z13, Z5
+  VMOVDQA32 Z13, Z6
+  VPXORD Z7, Z7, Z7
+  VPXORD Z8, Z8, Z8
+  VPXORD Z9, Z9, Z9
+  VPXORD Z10, Z10, Z10
+  VPXORD Z11, Z11, Z11
+  VPXORD Z12, Z12, Z12
+
+next_step:
+  KTESTW K1, K1
+  JZ done
+  MOVBQZX 0(R8), CX                        // CX <- op
+  MOVBQZX 1(R8), DX                        // DX <- field
+  MOVBQZX 2(R8), BX                        // BX <- min
+  MOVBQZX 3(R8), R13                       // R13 <- max or char
+  ADDQ $4, R8
+  CMPQ CX, $const_tsfmtDigits
+  JEQ digits
+  CMPQ CX, $const_tsfmtFraction
+  JEQ fraction
+  CMPQ CX, $const_tsfmtLiteral
+  JEQ literal
+  CMPQ CX, $const_tsfmtSpace
+  JEQ space
+  CMPQ CX, $const_tsfmtMonthName
+  JEQ month_name
+  CMPQ CX, $const_tsfmtWeekdayName
+  JEQ weekday_name
+  CMPQ CX, $const_tsfmtMeridiem
+  JEQ meridiem
+  CMPQ CX, $const_tsfmtOffset
+  JEQ offset
+  CMPQ CX, $const_tsfmtZoneName
+  JEQ zone_name
+  CMPQ CX, $const_tsfmtHour12
+  JEQ hour12
+  CMPQ CX, $const_tsfmtYear2
+  JEQ year2
+  CMPQ CX, $const_tsfmtEnd
+  JEQ compose
+  JMP corrupt
+
+digits:
+  MOVQ R13, R15                            // R15 <- number of digits to accumulate
+  JMP parse_digits
+
+fraction:
+  // parse up to 9 digits, but only
+  // accumulate the first 6 (microseconds)
+  MOVL $1, BX
+  MOVL $9, R13
+  MOVL $6, R15
+
+parse_digits:
+  VPXORD Z15, Z15, Z15                     // Z15 <- value
+  VPXORD Z16, Z16, Z16                     // Z16 <- number of digits
+  VPBROADCASTD R15, Z17
+  KMOVW K1, K2
+
+digits_loop:
+  VPTESTMD Z3, Z3, K2, K2                  // K2 <- lanes with remaining bytes
+  KMOVW K2, K3
+  VPGATHERDD 0(SI)(Z2*1), K3, Z14
+  VPANDD.BCST CONSTD_0xFF(), Z14, Z14
+  VPSUBD.BCST CONSTD_48(), Z14, Z14
+  VPCMPUD.BCST $VPCMP_IMM_LE, CONSTD_9(), Z14, K2, K2 // K2 <- lanes with a digit
+  KTESTW K2, K2
+  JZ digits_done
+  VPCMPUD $VPCMP_IMM_LT, Z17, Z16, K2, K3  // K3 <- lanes still accumulating
+  VPMULLD.BCST CONSTD_10(), Z15, K3, Z15
+  VPADDD Z14, Z15, K3, Z15
+  VPADDD Z13, Z16, K2, Z16
+  VPADDD Z13, Z2, K2, Z2
+  VPSUBD Z13, Z3, K2, Z3
+  DECQ R13
+  JNZ digits_loop
+
+digits_done:
+  VPBROADCASTD BX, Z17
+  VPCMPUD $VPCMP_IMM_GE, Z17, Z16, K1, K1  // K1 <- lanes with at least min digits
+  CMPQ CX, $const_tsfmtFraction
+  JEQ fraction_done
+  CMPQ DX, $const_tsfieldYear
+  JNE digits_month
+  VMOVDQA32 Z15, K1, Z4
+  JMP next_step
+digits_month:
+  CMPQ DX, $const_tsfieldMonth
+  JNE digits_day
+  VMOVDQA32 Z15, K1, Z5
+  JMP next_step
+digits_day:
+  CMPQ DX, $const_tsfieldDay
+  JNE digits_hour
+  VMOVDQA32 Z15, K1, Z6
+  JMP next_step
+digits_hour:
+  CMPQ DX, $const_tsfieldHour
+  JNE digits_minute
+  VMOVDQA32 Z15, K1, Z7
+  JMP next_step
+digits_minute:
+  CMPQ DX, $const_tsfieldMinute
+  JNE digits_second
+  VMOVDQA32 Z15, K1, Z8
+  JMP next_step
+digits_second:
+  CMPQ DX, $const_tsfieldSecond
+  JNE corrupt
+  VMOVDQA32 Z15, K1, Z9
+  JMP next_step
+
+fraction_done:
+  // scale the fraction to microseconds
+  MOVL $5, R13
+fraction_scale:
+  VPCMPUD.BCST $VPCMP_IMM_LT, CONSTD_6(), Z16, K1, K2
+  VPMULLD.BCST CONSTD_10(), Z15, K2, Z15
+  VPADDD Z13, Z16, K2, Z16
+  DECQ R13
+  JNZ fraction_scale
+  VMOVDQA32 Z15, K1, Z10
+  JMP next_step
+
+literal:
+  VPTESTMD Z3, Z3, K1, K1
+  KMOVW K1, K2
+  VPGATHERDD 0(SI)(Z2*1), K2, Z14
+  VPANDD.BCST CONSTD_0xFF(), Z14, Z14
+  VPBROADCASTD R13, Z15
+  VPCMPEQD Z15, Z14, K1, K1
+  VPADDD Z13, Z2, K1, Z2
+  VPSUBD Z13, Z3, K1, Z3
+  JMP next_step
+
+space:
+  KMOVW K1, K2
+space_loop:
+  VPTESTMD Z3, Z3, K2, K2
+  KMOVW K2, K3
+  VPGATHERDD 0(SI)(Z2*1), K3, Z14
+  VPANDD.BCST CONSTD_0xFF(), Z14, Z14
+  VPCMPEQD.BCST CONSTD_32(), Z14, K2, K3   // K3 <- ' '
+  VPSUBD.BCST CONSTD_9(), Z14, Z14
+  VPCMPUD.BCST $VPCMP_IMM_LE, CONSTD_4(), Z14, K2, K2 // K2 <- '\t' to '\r'
+  KORW K3, K2, K2
+  KTESTW K2, K2
+  JZ next_step
+  VPADDD Z13, Z2, K2, Z2
+  VPSUBD Z13, Z3, K2, Z3
+  JMP space_loop
+
+month_name:
+  LEAQ tsfmtmonths<>(SB), R15
+  MOVL $12, R13
+  JMP match_name
+
+weekday_name:
+  LEAQ tsfmtweekdays<>(SB), R15
+  MOVL $7, R13
+
+match_name:
+  // Z14 <- first 3 bytes in lowercase
+  VPCMPUD.BCST $VPCMP_IMM_GE, CONSTD_3(), Z3, K1, K1
+  KMOVW K1, K2
+  VPGATHERDD 0(SI)(Z2*1), K2, Z14
+  MOVL $0x20202020, R14
+  VPBROADCASTD R14, Z19
+  VPORD Z19, Z14, Z14
+  VPANDD.BCST CONSTD_0xFFFFFF(), Z14, Z14
+  VPXORD Z15, Z15, Z15                     // Z15 <- matched index + 1
+  VPXORD Z16, Z16, Z16
+match_name_loop:
+  VPADDD Z13, Z16, Z16
+  VPCMPEQD.BCST 0(R15), Z14, K1, K2
+  VMOVDQA32 Z16, K2, Z15
+  ADDQ $4, R15
+  DECQ R13
+  JNZ match_name_loop
+  VPTESTMD Z15, Z15, K1, K1
+  VPADDD.BCST CONSTD_3(), Z2, K1, Z2
+  VPSUBD.BCST CONSTD_3(), Z3, K1, Z3
+
+  // skip any letters following the abbreviation
+  MOVL $'a', R14
+  VPBROADCASTD R14, Z17
+  MOVL $25, R14
+  VPBROADCASTD R14, Z18
+  KMOVW K1, K2
+name_loop:
+  VPTESTMD Z3, Z3, K2, K2
+  KMOVW K2, K3
+  VPGATHERDD 0(SI)(Z2*1), K3, Z14
+  VPORD.BCST CONSTD_0x20(), Z14, Z14
+  VPANDD.BCST CONSTD_0xFF(), Z14, Z14
+  VPSUBD Z17, Z14, Z14
+  VPCMPUD $VPCMP_IMM_LE, Z18, Z14, K2, K2
+  KTESTW K2, K2
+  JZ name_done
+  VPADDD Z13, Z2, K2, Z2
+  VPSUBD Z13, Z3, K2, Z3
+  JMP name_loop
+name_done:
+  CMPQ CX, $const_tsfmtMonthName
+  JNE next_step
+  VMOVDQA32 Z15, K1, Z5
+  JMP next_step
+
+meridiem:
+  VPCMPUD.BCST $VPCMP_IMM_GE, CONSTD_2(), Z3, K1, K1
+  KMOVW K1, K2
+  VPGATHERDD 0(SI)(Z2*1), K2, Z14
+  MOVL $0x20202020, R14
+  VPBROADCASTD R14, Z19
+  VPORD Z19, Z14, Z14
+  VPANDD.BCST CONSTD_0xFFFF(), Z14, Z14
+  MOVL $0x6d61, R14                        // "am"
+  VPBROADCASTD R14, Z15
+  VPCMPEQD Z15, Z14, K1, K2
+  MOVL $0x6d70, R14                        // "pm"
+  VPBROADCASTD R14, Z15
+  VPCMPEQD Z15, Z14, K1, K3
+  KORW K2, K3, K1
+  VPXORD Z12, Z12, K2, Z12
+  VPBROADCASTD CONSTD_12(), K3, Z12
+  VPADDD.BCST CONSTD_2(), Z2, K1, Z2
+  VPSUBD.BCST CONSTD_2(), Z3, K1, Z3
+  JMP next_step
+
+offset:
+  VPTESTMD Z3, Z3, K1, K1
+  KMOVW K1, K2
+  VPGATHERDD 0(SI)(Z2*1), K2, Z14          // Z14 <- [sign, h, h, ?]
+
+  // K2 <- 'Z' or 'z'
+  VPORD.BCST CONSTD_0x20(), Z14, Z15
+  VPANDD.BCST CONSTD_0xFF(), Z15, Z15
+  MOVL $'z', R14
+  VPBROADCASTD R14, Z16
+  VPCMPEQD Z16, Z15, K1, K2
+  VPXORD Z11, Z11, K2, Z11
+  VPADDD Z13, Z2, K2, Z2
+  VPSUBD Z13, Z3, K2, Z3
+  KMOVW K2, R15                            // R15 <- lanes with 'Z'
+
+  // K3 <- '+', K4 <- '-'
+  KANDNW K1, K2, K5
+  VPCMPUD.BCST $VPCMP_IMM_GE, CONSTD_3(), Z3, K5, K5
+  VPANDD.BCST CONSTD_0xFF(), Z14, Z15
+  MOVL $'+', R14
+  VPBROADCASTD R14, Z16
+  VPCMPEQD Z16, Z15, K5, K3
+  MOVL $'-', R14
+  VPBROADCASTD R14, Z16
+  VPCMPEQD Z16, Z15, K5, K4
+  KORW K3, K4, K5                          // K5 <- lanes with a sign
+
+  // Z20 <- hours
+  VPSRLD $8, Z14, Z17
+  TSFMT_TWO_DIGITS(Z17, Z20, Z18, K5)
+  MOVL $23, R14
+  VPBROADCASTD R14, Z16
+  VPCMPUD $VPCMP_IMM_LE, Z16, Z20, K5, K5
+  VPADDD.BCST CONSTD_3(), Z2, K5, Z2
+  VPSUBD.BCST CONSTD_3(), Z3, K5, Z3
+
+  // Z14 <- [':', m, m, ?] or [m, m, ?, ?]
+  VPTESTMD Z3, Z3, K5, K6
+  KMOVW K6, K3
+  VPGATHERDD 0(SI)(Z2*1), K3, Z14
+  VPXORD Z21, Z21, Z21                     // Z21 <- minutes
+  VPANDD.BCST CONSTD_0xFF(), Z14, Z15
+  MOVL $':', R14
+  VPBROADCASTD R14, Z16
+  VPCMPEQD Z16, Z15, K6, K3                // K3 <- lanes with ':'
+  KANDNW K6, K3, K6                        // K6 <- lanes without ':'
+  KANDNW K5, K3, K5
+
+  // ':' must be followed by two digits
+  VPCMPUD.BCST $VPCMP_IMM_GE, CONSTD_3(), Z3, K3, K3
+  VPSRLD $8, Z14, Z17
+  TSFMT_TWO_DIGITS(Z17, Z22, Z18, K3)
+  VMOVDQA32 Z22, K3, Z21
+  VPADDD.BCST CONSTD_3(), Z2, K3, Z2
+  VPSUBD.BCST CONSTD_3(), Z3, K3, Z3
+  KORW K3, K5, K5
+
+  // otherwise the minutes are optional
+  VPCMPUD.BCST $VPCMP_IMM_GE, CONSTD_2(), Z3, K6, K6
+  TSFMT_TWO_DIGITS(Z14, Z22, Z18, K6)
+  VMOVDQA32 Z22, K6, Z21
+  VPADDD.BCST CONSTD_2(), Z2, K6, Z2
+  VPSUBD.BCST CONSTD_2(), Z3, K6, Z3
+
+  // Z11 <- hours * 60 + minutes, negated for '-'
+  MOVL $59, R14
+  VPBROADCASTD R14, Z16
+  VPCMPUD $VPCMP_IMM_LE, Z16, Z21, K5, K5
+  VPMULLD.BCST CONSTD_60(), Z20, Z20
+  VPADDD Z21, Z20, Z20
+  VPXORD Z16, Z16, Z16
+  VPSUBD Z20, Z16, K4, Z20
+  VMOVDQA32 Z20, K5, Z11
+  KMOVW R15, K2
+  KORW K2, K5, K1
+  JMP next_step
+
+zone_name:
+  VPTESTMD Z3, Z3, K1, K1
+  KMOVW K1, K2
+  VPGATHERDD 0(SI)(Z2*1), K2, Z14
+  MOVL $0x20202020, R14
+  VPBROADCASTD R14, Z19
+  VPORD Z19, Z14, Z14
+  VPANDD.BCST CONSTD_0xFF(), Z14, Z15
+  MOVL $'z', R14
+  VPBROADCASTD R14, Z16
+  VPCMPEQD Z16, Z15, K1, K2                // K2 <- 'Z' or 'z'
+  KANDNW K1, K2, K3
+  VPCMPUD.BCST $VPCMP_IMM_GE, CONSTD_3(), Z3, K3, K3
+  VPANDD.BCST CONSTD_0xFFFFFF(), Z14, Z15
+  MOVL $0x637475, R14                      // "utc"
+  VPBROADCASTD R14, Z16
+  VPCMPEQD Z16, Z15, K3, K4
+  MOVL $0x746d67, R14                      // "gmt"
+  VPBROADCASTD R14, Z16
+  VPCMPEQD Z16, Z15, K3, K5
+  KORW K4, K5, K3                          // K3 <- "utc" or "gmt"
+  VPADDD Z13, Z2, K2, Z2
+  VPSUBD Z13, Z3, K2, Z3
+  VPADDD.BCST CONSTD_3(), Z2, K3, Z2
+  VPSUBD.BCST CONSTD_3(), Z3, K3, Z3
+  KORW K2, K3, K1
+  VPXORD Z11, Z11, K1, Z11
+  JMP next_step
+
+hour12:
+  // hour must be in [1, 12]; 12 becomes 0
+  VPSUBD Z13, Z7, Z15
+  VPCMPUD.BCST $VPCMP_IMM_LE, CONSTD_11(), Z15, K1, K1
+  VPCMPEQD.BCST CONSTD_12(), Z7, K1, K2
+  VPXORD Z7, Z7, K2, Z7
+  VPADDD Z12, Z7, K1, Z7
+  JMP next_step
+
+year2:
+  // 69-99 are 1969-1999, 0-68 are 2000-2068
+  MOVL $69, R14
+  VPBROADCASTD R14, Z15
+  VPCMPUD $VPCMP_IMM_LT, Z15, Z4, K1, K2
+  MOVL $1900, R14
+  VPBROADCASTD R14, Z15
+  VPADDD Z15, Z4, K1, Z4
+  VPADDD.BCST CONSTD_100(), Z4, K2, Z4
+  JMP next_step
+
+compose:
+  // K1 <- lanes that consumed the whole
+  //       string with valid components
+  VPTESTNMD Z3, Z3, K1, K1
+  VPSUBD Z13, Z5, Z15
+  VPCMPUD.BCST $VPCMP_IMM_LE, CONSTD_11(), Z15, K1, K1
+  VPSUBD Z13, Z6, Z15
+  MOVL $30, R14
+  VPBROADCASTD R14, Z16
+  VPCMPUD $VPCMP_IMM_LE, Z16, Z15, K1, K1
+  MOVL $23, R14
+  VPBROADCASTD R14, Z16
+  VPCMPUD $VPCMP_IMM_LE, Z16, Z7, K1, K1
+  MOVL $59, R14
+  VPBROADCASTD R14, Z16
+  VPCMPUD $VPCMP_IMM_LE, Z16, Z8, K1, K1
+  VPCMPUD.BCST $VPCMP_IMM_LE, CONSTD_60(), Z9, K1, K1
+
+  // K1 <- lanes where the day is within the month
+  VMOVDQU32 CONST_GET_PTR(consts_days_in_month, 0), Z15
+  VPSUBD Z13, Z5, Z16
+  VPERMD Z15, Z16, Z15
+  VPCMPUD $VPCMP_IMM_LE, Z15, Z6, K1, K1
+
+  // February 29th is only valid in leap years:
+  //   K3 <- year not divisible by 4
+  //   K4 <- year divisible by 25 (so by 100) but not by 16 (so not by 400)
+  VPCMPEQD.BCST CONSTD_29(), Z6, K1, K2
+  VPCMPEQD.BCST CONSTD_2(), Z5, K2, K2
+  VPTESTMD.BCST CONSTD_3(), Z4, K2, K3
+  MOVL $0xc28f5c29, R14                    // R14 <- inverse of 25 (mod 2^32)
+  VPBROADCASTD R14, Z16
+  VPMULLD Z16, Z4, Z16
+  MOVL $0x0a3d70a3, R14                    // R14 <- (2^32 - 1) / 25
+  VPBROADCASTD R14, Z17
+  VPCMPUD $VPCMP_IMM_LE, Z17, Z16, K2, K4
+  VPTESTMD.BCST CONSTD_15(), Z4, K4, K4
+  KORW K3, K4, K3
+  KANDNW K1, K3, K1
+
+  // Z4 <- year starting in March, Z5 <- month index where 0 is March
+  VPSUBD.BCST CONSTD_3(), Z5, Z5
+  VPMOVD2M Z5, K2
+  VPSUBD Z13, Z4, K2, Z4
+  VPADDD.BCST CONSTD_12(), Z5, K2, Z5
+
+  // Z15 <- day of the year
+  VMOVDQU32 CONST_GET_PTR(consts_days_until_month_from_march, 0), Z15
+  VPERMD Z15, Z5, Z15
+  VPADDD Z6, Z15, Z15
+  VPSUBD Z13, Z15, Z15
+
+  // Z16 <- seconds of the day, minus the UTC offset
+  VPMULLD.BCST CONSTD_3600(), Z7, Z16
+  VPMULLD.BCST CONSTD_60(), Z8, Z17
+  VPADDD Z17, Z16, Z16
+  VPADDD Z9, Z16, Z16
+  VPMULLD.BCST CONSTD_60(), Z11, Z17
+  VPSUBD Z17, Z16, Z16
+
+  // Z20/Z21 <- number of days of all years
+  VEXTRACTI32X8 $1, Z4, Y19
+  VPMOVSXDQ Y4, Z18
+  VPMOVSXDQ Y19, Z19
+  VEXTRACTI32X8 $1, Z15, Y21
+  VPMOVZXDQ Y15, Z20
+  VPMOVZXDQ Y21, Z21
+  BC_COMPOSE_YEAR_TO_DAYS(Z20, Z21, Z18, Z19, Z22, Z23, Z24, Z25, Z26, Z27)
+
+  // Z20/Z21 <- days, seconds, and microseconds combined
+  VPMULLQ.BCST CONSTQ_86400000000(), Z20, Z20
+  VPMULLQ.BCST CONSTQ_86400000000(), Z21, Z21
+  VEXTRACTI32X8 $1, Z16, Y17
+  VPMOVSXDQ Y16, Z16
+  VPMOVSXDQ Y17, Z17
+  VPMULLQ.BCST CONSTQ_1000000(), Z16, Z16
+  VPMULLQ.BCST CONSTQ_1000000(), Z17, Z17
+  VPADDQ Z16, Z20, Z20
+  VPADDQ Z17, Z21, Z21
+  VEXTRACTI32X8 $1, Z10, Y17
+  VPMOVZXDQ Y10, Z16
+  VPMOVZXDQ Y17, Z17
+  VPADDQ Z16, Z20, Z20
+  VPADDQ Z17, Z21, Z21
+
+  // Z2/Z3 <- make it a unix timestamp starting from 1970-01-01
+  VPSUBQ.BCST CONSTQ_1970_01_01_TO_0000_03_01_US_OFFSET(), Z20, Z2
+  VPSUBQ.BCST CONSTQ_1970_01_01_TO_0000_03_01_US_OFFSET(), Z21, Z3
+
+done:
+  NEXT()
+
+corrupt:
+  FAIL()
+
 TEXT bcunboxts(SB), NOSPLIT|NOFRAME, $0
   // TernLog:
   //   VPTERNLOG(0xD8) == (A & ~C) | (B & C) == Blend(A, B, ~C)
@@ -16391,3 +16922,26 @@ DATA byteidx<>+13(SB)/1, $13
 DATA byteidx<>+14(SB)/1, $14
 DATA byteidx<>+15(SB)/1, $15
 GLOBL byteidx<>(SB), RODATA|NOPTR, $16
+
+DATA tsfmtmonths<>+0(SB)/4, $0x006e616a // "jan"
+DATA tsfmtmonths<>+4(SB)/4, $0x00626566 // "feb"
+DATA tsfmtmonths<>+8(SB)/4, $0x0072616d // "mar"
+DATA tsfmtmonths<>+12(SB)/4, $0x00727061 // "apr"
+DATA tsfmtmonths<>+16(SB)/4, $0x0079616d // "may"
+DATA tsfmtmonths<>+20(SB)/4, $0x006e756a // "jun"
+DATA tsfmtmonths<>+24(SB)/4, $0x006c756a // "jul"
+DATA tsfmtmonths<>+28(SB)/4, $0x00677561 // "aug"
+DATA tsfmtmonths<>+32(SB)/4, $0x00706573 // "sep"
+DATA tsfmtmonths<>+36(SB)/4, $0x0074636f // "oct"
+DATA tsfmtmonths<>+40(SB)/4, $0x00766f6e // "nov"
+DATA tsfmtmonths<>+44(SB)/4, $0x00636564 // "dec"
+GLOBL tsfmtmonths<>(SB), RODATA|NOPTR, $48
+
+DATA tsfmtweekdays<>+0(SB)/4, $0x006e7573 // "sun"
+DATA tsfmtweekdays<>+4(SB)/4, $0x006e6f6d // "mon"
+DATA tsfmtweekdays<>+8(SB)/4, $0x00657574 // "tue"
+DATA tsfmtweekdays<>+12(SB)/4, $0x00646577 // "wed"
+DATA tsfmtweekdays<>+16(SB)/4, $0x00756874 // "thu"
+DATA tsfmtweekdays<>+20(SB)/4, $0x00697266 // "fri"
+DATA tsfmtweekdays<>+24(SB)/4, $0x00746173 // "sat"
+GLOBL tsfmtweekdays<>(SB), RODATA|NOPTR, $28
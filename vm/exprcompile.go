@@ -26,6 +26,7 @@ import (
 
 	"github.com/SnellerInc/sneller/regexp2"
 
+	"github.com/SnellerInc/sneller/date"
 	"github.com/SnellerInc/sneller/expr"
 	"github.com/SnellerInc/sneller/ion"
 )
@@ -702,6 +703,15 @@ func compilefuncaux(p *prog, b *expr.Builtin, args []expr.Node) (*value, error)
 		return p.WidthBucket(val, min, max, bucketCount), nil
 
 	case expr.TimeBucket:
+		var z *date.Zone
+		if len(args) == 3 {
+			var err error
+			z, err = expr.TimeZone(args[2])
+			if err != nil {
+				return nil, err
+			}
+			args = args[:2]
+		}
 		v, err := compileargs(p, args, compileTime, compileNumber)
 		if err != nil {
 			return nil, err
@@ -710,6 +720,9 @@ func compilefuncaux(p *prog, b *expr.Builtin, args []expr.Node) (*value, error)
 		arg := v[0]
 		interval := v[1]
 
+		if z != nil {
+			return p.TimeBucketZone(arg, interval, z), nil
+		}
 		return p.TimeBucket(arg, interval), nil
 
 	case expr.Trim, expr.Ltrim, expr.Rtrim:
@@ -858,6 +871,37 @@ func compilefuncaux(p *prog, b *expr.Builtin, args []expr.Node) (*value, error)
 
 		return p.DateToUnixMicro(v[0]), nil
 
+	case expr.AtTimeZone, expr.FromTimeZone:
+		if len(args) != 2 {
+			return nil, fmt.Errorf("%s expects 2 arguments, got %d", fn, len(args))
+		}
+		z, err := expr.TimeZone(args[1])
+		if err != nil {
+			return nil, err
+		}
+		val, err := p.compileAsTime(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if fn == expr.AtTimeZone {
+			return p.AtTimeZone(val, z), nil
+		}
+		return p.FromTimeZone(val, z), nil
+
+	case expr.ParseTimestamp:
+		if len(args) != 2 && len(args) != 3 {
+			return nil, fmt.Errorf("%s expects 2 or 3 arguments, got %d", fn, len(args))
+		}
+		f, err := expr.TimeFormat(args[1:])
+		if err != nil {
+			return nil, err
+		}
+		str, err := p.compileAsString(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return p.ParseTimestamp(str, f), nil
+
 	case expr.GeoHash, expr.GeoTileES:
 		v, err := compileargs(p, args, compileNumber, compileNumber, compileNumber)
 		if err != nil {
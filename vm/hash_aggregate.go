@@ -355,6 +355,16 @@ func (h *HashAggregate) sort(pairs []hpair) {
 	})
 }
 
+// Memory implements MemoryUser.Memory
+func (h *HashAggregate) Memory() int64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.final == nil {
+		return 0
+	}
+	return h.final.memory()
+}
+
 func (h *HashAggregate) Close() error {
 	c := atomic.LoadInt64(&h.children)
 	if c != 0 {
@@ -208,143 +208,145 @@ const (
 	opdatetruncmonth          bcop = 202
 	opdatetruncquarter        bcop = 203
 	opdatetruncyear           bcop = 204
-	opunboxts                 bcop = 205
-	opboxts                   bcop = 206
-	optimelt                  bcop = 207
-	optimegt                  bcop = 208
-	opconsttm                 bcop = 209
-	optmextract               bcop = 210
-	opwidthbucketf            bcop = 211
-	opwidthbucketi            bcop = 212
-	optimebucketts            bcop = 213
-	opgeohash                 bcop = 214
-	opgeohashimm              bcop = 215
-	opgeotilex                bcop = 216
-	opgeotiley                bcop = 217
-	opgeotilees               bcop = 218
-	opgeotileesimm            bcop = 219
-	opgeodistance             bcop = 220
-	opconcatlenget1           bcop = 221
-	opconcatlenget2           bcop = 222
-	opconcatlenget3           bcop = 223
-	opconcatlenget4           bcop = 224
-	opconcatlenacc1           bcop = 225
-	opconcatlenacc2           bcop = 226
-	opconcatlenacc3           bcop = 227
-	opconcatlenacc4           bcop = 228
-	opallocstr                bcop = 229
-	opappendstr               bcop = 230
-	opfindsym                 bcop = 231
-	opfindsym2                bcop = 232
-	opfindsym2rev             bcop = 233
-	opfindsym3                bcop = 234
-	opblendv                  bcop = 235
-	opblendrevv               bcop = 236
-	opblendnum                bcop = 237
-	opblendnumrev             bcop = 238
-	opblendslice              bcop = 239
-	opblendslicerev           bcop = 240
-	opunpack                  bcop = 241
-	opunsymbolize             bcop = 242
-	opunboxktoi64             bcop = 243
-	opunboxcoercef64          bcop = 244
-	opunboxcoercei64          bcop = 245
-	opunboxcvtf64             bcop = 246
-	opunboxcvti64             bcop = 247
-	optoint                   bcop = 248
-	optof64                   bcop = 249
-	opboxfloat                bcop = 250
-	opboxint                  bcop = 251
-	opboxmask                 bcop = 252
-	opboxmask2                bcop = 253
-	opboxmask3                bcop = 254
-	opboxstring               bcop = 255
-	opboxlist                 bcop = 256
-	opmakelist                bcop = 257
-	opmakestruct              bcop = 258
-	ophashvalue               bcop = 259
-	ophashvalueplus           bcop = 260
-	ophashmember              bcop = 261
-	ophashlookup              bcop = 262
-	opaggandk                 bcop = 263
-	opaggork                  bcop = 264
-	opaggsumf                 bcop = 265
-	opaggsumi                 bcop = 266
-	opaggminf                 bcop = 267
-	opaggmini                 bcop = 268
-	opaggmaxf                 bcop = 269
-	opaggmaxi                 bcop = 270
-	opaggandi                 bcop = 271
-	opaggori                  bcop = 272
-	opaggxori                 bcop = 273
-	opaggcount                bcop = 274
-	opaggbucket               bcop = 275
-	opaggslotandk             bcop = 276
-	opaggslotork              bcop = 277
-	opaggslotaddf             bcop = 278
-	opaggslotaddi             bcop = 279
-	opaggslotavgf             bcop = 280
-	opaggslotavgi             bcop = 281
-	opaggslotminf             bcop = 282
-	opaggslotmini             bcop = 283
-	opaggslotmaxf             bcop = 284
-	opaggslotmaxi             bcop = 285
-	opaggslotandi             bcop = 286
-	opaggslotori              bcop = 287
-	opaggslotxori             bcop = 288
-	opaggslotcount            bcop = 289
-	oplitref                  bcop = 290
-	opauxval                  bcop = 291
-	opsplit                   bcop = 292
-	optuple                   bcop = 293
-	opdupv                    bcop = 294
-	opzerov                   bcop = 295
-	opobjectsize              bcop = 296
-	opCmpStrEqCs              bcop = 297
-	opCmpStrEqCi              bcop = 298
-	opCmpStrEqUTF8Ci          bcop = 299
-	opCmpStrFuzzyA3           bcop = 300
-	opCmpStrFuzzyUnicodeA3    bcop = 301
-	opHasSubstrFuzzyA3        bcop = 302
-	opHasSubstrFuzzyUnicodeA3 bcop = 303
-	opSkip1charLeft           bcop = 304
-	opSkip1charRight          bcop = 305
-	opSkipNcharLeft           bcop = 306
-	opSkipNcharRight          bcop = 307
-	opTrimWsLeft              bcop = 308
-	opTrimWsRight             bcop = 309
-	opTrim4charLeft           bcop = 310
-	opTrim4charRight          bcop = 311
-	opContainsSuffixCs        bcop = 312
-	opContainsSuffixCi        bcop = 313
-	opContainsSuffixUTF8Ci    bcop = 314
-	opContainsPrefixCs        bcop = 315
-	opContainsPrefixCi        bcop = 316
-	opContainsPrefixUTF8Ci    bcop = 317
-	opLengthStr               bcop = 318
-	opSubstr                  bcop = 319
-	opSplitPart               bcop = 320
-	opContainsSubstrCs        bcop = 321
-	opContainsSubstrCi        bcop = 322
-	opContainsSubstrUTF8Ci    bcop = 323
-	opContainsPatternCs       bcop = 324
-	opContainsPatternCi       bcop = 325
-	opContainsPatternUTF8Ci   bcop = 326
-	opIsSubnetOfIP4           bcop = 327
-	opDfaT6                   bcop = 328
-	opDfaT7                   bcop = 329
-	opDfaT8                   bcop = 330
-	opDfaT6Z                  bcop = 331
-	opDfaT7Z                  bcop = 332
-	opDfaT8Z                  bcop = 333
-	opDfaLZ                   bcop = 334
-	opslower                  bcop = 335
-	opsupper                  bcop = 336
-	opsadjustsize             bcop = 337
-	opaggapproxcount          bcop = 338
-	opaggapproxcountmerge     bcop = 339
-	opaggslotapproxcount      bcop = 340
-	opaggslotapproxcountmerge bcop = 341
-	optrap                    bcop = 342
-	_maxbcop                       = 343
+	opdatetzoffset            bcop = 205
+	opparsets                 bcop = 206
+	opunboxts                 bcop = 207
+	opboxts                   bcop = 208
+	optimelt                  bcop = 209
+	optimegt                  bcop = 210
+	opconsttm                 bcop = 211
+	optmextract               bcop = 212
+	opwidthbucketf            bcop = 213
+	opwidthbucketi            bcop = 214
+	optimebucketts            bcop = 215
+	opgeohash                 bcop = 216
+	opgeohashimm              bcop = 217
+	opgeotilex                bcop = 218
+	opgeotiley                bcop = 219
+	opgeotilees               bcop = 220
+	opgeotileesimm            bcop = 221
+	opgeodistance             bcop = 222
+	opconcatlenget1           bcop = 223
+	opconcatlenget2           bcop = 224
+	opconcatlenget3           bcop = 225
+	opconcatlenget4           bcop = 226
+	opconcatlenacc1           bcop = 227
+	opconcatlenacc2           bcop = 228
+	opconcatlenacc3           bcop = 229
+	opconcatlenacc4           bcop = 230
+	opallocstr                bcop = 231
+	opappendstr               bcop = 232
+	opfindsym                 bcop = 233
+	opfindsym2                bcop = 234
+	opfindsym2rev             bcop = 235
+	opfindsym3                bcop = 236
+	opblendv                  bcop = 237
+	opblendrevv               bcop = 238
+	opblendnum                bcop = 239
+	opblendnumrev             bcop = 240
+	opblendslice              bcop = 241
+	opblendslicerev           bcop = 242
+	opunpack                  bcop = 243
+	opunsymbolize             bcop = 244
+	opunboxktoi64             bcop = 245
+	opunboxcoercef64          bcop = 246
+	opunboxcoercei64          bcop = 247
+	opunboxcvtf64             bcop = 248
+	opunboxcvti64             bcop = 249
+	optoint                   bcop = 250
+	optof64                   bcop = 251
+	opboxfloat                bcop = 252
+	opboxint                  bcop = 253
+	opboxmask                 bcop = 254
+	opboxmask2                bcop = 255
+	opboxmask3                bcop = 256
+	opboxstring               bcop = 257
+	opboxlist                 bcop = 258
+	opmakelist                bcop = 259
+	opmakestruct              bcop = 260
+	ophashvalue               bcop = 261
+	ophashvalueplus           bcop = 262
+	ophashmember              bcop = 263
+	ophashlookup              bcop = 264
+	opaggandk                 bcop = 265
+	opaggork                  bcop = 266
+	opaggsumf                 bcop = 267
+	opaggsumi                 bcop = 268
+	opaggminf                 bcop = 269
+	opaggmini                 bcop = 270
+	opaggmaxf                 bcop = 271
+	opaggmaxi                 bcop = 272
+	opaggandi                 bcop = 273
+	opaggori                  bcop = 274
+	opaggxori                 bcop = 275
+	opaggcount                bcop = 276
+	opaggbucket               bcop = 277
+	opaggslotandk             bcop = 278
+	opaggslotork              bcop = 279
+	opaggslotaddf             bcop = 280
+	opaggslotaddi             bcop = 281
+	opaggslotavgf             bcop = 282
+	opaggslotavgi             bcop = 283
+	opaggslotminf             bcop = 284
+	opaggslotmini             bcop = 285
+	opaggslotmaxf             bcop = 286
+	opaggslotmaxi             bcop = 287
+	opaggslotandi             bcop = 288
+	opaggslotori              bcop = 289
+	opaggslotxori             bcop = 290
+	opaggslotcount            bcop = 291
+	oplitref                  bcop = 292
+	opauxval                  bcop = 293
+	opsplit                   bcop = 294
+	optuple                   bcop = 295
+	opdupv                    bcop = 296
+	opzerov                   bcop = 297
+	opobjectsize              bcop = 298
+	opCmpStrEqCs              bcop = 299
+	opCmpStrEqCi              bcop = 300
+	opCmpStrEqUTF8Ci          bcop = 301
+	opCmpStrFuzzyA3           bcop = 302
+	opCmpStrFuzzyUnicodeA3    bcop = 303
+	opHasSubstrFuzzyA3        bcop = 304
+	opHasSubstrFuzzyUnicodeA3 bcop = 305
+	opSkip1charLeft           bcop = 306
+	opSkip1charRight          bcop = 307
+	opSkipNcharLeft           bcop = 308
+	opSkipNcharRight          bcop = 309
+	opTrimWsLeft              bcop = 310
+	opTrimWsRight             bcop = 311
+	opTrim4charLeft           bcop = 312
+	opTrim4charRight          bcop = 313
+	opContainsSuffixCs        bcop = 314
+	opContainsSuffixCi        bcop = 315
+	opContainsSuffixUTF8Ci    bcop = 316
+	opContainsPrefixCs        bcop = 317
+	opContainsPrefixCi        bcop = 318
+	opContainsPrefixUTF8Ci    bcop = 319
+	opLengthStr               bcop = 320
+	opSubstr                  bcop = 321
+	opSplitPart               bcop = 322
+	opContainsSubstrCs        bcop = 323
+	opContainsSubstrCi        bcop = 324
+	opContainsSubstrUTF8Ci    bcop = 325
+	opContainsPatternCs       bcop = 326
+	opContainsPatternCi       bcop = 327
+	opContainsPatternUTF8Ci   bcop = 328
+	opIsSubnetOfIP4           bcop = 329
+	opDfaT6                   bcop = 330
+	opDfaT7                   bcop = 331
+	opDfaT8                   bcop = 332
+	opDfaT6Z                  bcop = 333
+	opDfaT7Z                  bcop = 334
+	opDfaT8Z                  bcop = 335
+	opDfaLZ                   bcop = 336
+	opslower                  bcop = 337
+	opsupper                  bcop = 338
+	opsadjustsize             bcop = 339
+	opaggapproxcount          bcop = 340
+	opaggapproxcountmerge     bcop = 341
+	opaggslotapproxcount      bcop = 342
+	opaggslotapproxcountmerge bcop = 343
+	optrap                    bcop = 344
+	_maxbcop                       = 345
 )
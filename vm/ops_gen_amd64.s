@@ -207,145 +207,145 @@ DATA opaddrs+0x648(SB)/8, $bcdatetruncdow(SB)
 DATA opaddrs+0x650(SB)/8, $bcdatetruncmonth(SB)
 DATA opaddrs+0x658(SB)/8, $bcdatetruncquarter(SB)
 DATA opaddrs+0x660(SB)/8, $bcdatetruncyear(SB)
-DATA opaddrs+0x668(SB)/8, $bcunboxts(SB)
-DATA opaddrs+0x670(SB)/8, $bcboxts(SB)
-DATA opaddrs+0x678(SB)/8, $bctimelt(SB)
-DATA opaddrs+0x680(SB)/8, $bctimegt(SB)
-DATA opaddrs+0x688(SB)/8, $bcconsttm(SB)
-DATA opaddrs+0x690(SB)/8, $bctmextract(SB)
-DATA opaddrs+0x698(SB)/8, $bcwidthbucketf(SB)
-DATA opaddrs+0x6a0(SB)/8, $bcwidthbucketi(SB)
-DATA opaddrs+0x6a8(SB)/8, $bctimebucketts(SB)
-DATA opaddrs+0x6b0(SB)/8, $bcgeohash(SB)
-DATA opaddrs+0x6b8(SB)/8, $bcgeohashimm(SB)
-DATA opaddrs+0x6c0(SB)/8, $bcgeotilex(SB)
-DATA opaddrs+0x6c8(SB)/8, $bcgeotiley(SB)
-DATA opaddrs+0x6d0(SB)/8, $bcgeotilees(SB)
-DATA opaddrs+0x6d8(SB)/8, $bcgeotileesimm(SB)
-DATA opaddrs+0x6e0(SB)/8, $bcgeodistance(SB)
-DATA opaddrs+0x6e8(SB)/8, $bcconcatlenget1(SB)
-DATA opaddrs+0x6f0(SB)/8, $bcconcatlenget2(SB)
-DATA opaddrs+0x6f8(SB)/8, $bcconcatlenget3(SB)
-DATA opaddrs+0x700(SB)/8, $bcconcatlenget4(SB)
-DATA opaddrs+0x708(SB)/8, $bcconcatlenacc1(SB)
-DATA opaddrs+0x710(SB)/8, $bcconcatlenacc2(SB)
-DATA opaddrs+0x718(SB)/8, $bcconcatlenacc3(SB)
-DATA opaddrs+0x720(SB)/8, $bcconcatlenacc4(SB)
-DATA opaddrs+0x728(SB)/8, $bcallocstr(SB)
-DATA opaddrs+0x730(SB)/8, $bcappendstr(SB)
-DATA opaddrs+0x738(SB)/8, $bcfindsym(SB)
-DATA opaddrs+0x740(SB)/8, $bcfindsym2(SB)
-DATA opaddrs+0x748(SB)/8, $bcfindsym2rev(SB)
-DATA opaddrs+0x750(SB)/8, $bcfindsym3(SB)
-DATA opaddrs+0x758(SB)/8, $bcblendv(SB)
-DATA opaddrs+0x760(SB)/8, $bcblendrevv(SB)
-DATA opaddrs+0x768(SB)/8, $bcblendnum(SB)
-DATA opaddrs+0x770(SB)/8, $bcblendnumrev(SB)
-DATA opaddrs+0x778(SB)/8, $bcblendslice(SB)
-DATA opaddrs+0x780(SB)/8, $bcblendslicerev(SB)
-DATA opaddrs+0x788(SB)/8, $bcunpack(SB)
-DATA opaddrs+0x790(SB)/8, $bcunsymbolize(SB)
-DATA opaddrs+0x798(SB)/8, $bcunboxktoi64(SB)
-DATA opaddrs+0x7a0(SB)/8, $bcunboxcoercef64(SB)
-DATA opaddrs+0x7a8(SB)/8, $bcunboxcoercei64(SB)
-DATA opaddrs+0x7b0(SB)/8, $bcunboxcvtf64(SB)
-DATA opaddrs+0x7b8(SB)/8, $bcunboxcvti64(SB)
-DATA opaddrs+0x7c0(SB)/8, $bctoint(SB)
-DATA opaddrs+0x7c8(SB)/8, $bctof64(SB)
-DATA opaddrs+0x7d0(SB)/8, $bcboxfloat(SB)
-DATA opaddrs+0x7d8(SB)/8, $bcboxint(SB)
-DATA opaddrs+0x7e0(SB)/8, $bcboxmask(SB)
-DATA opaddrs+0x7e8(SB)/8, $bcboxmask2(SB)
-DATA opaddrs+0x7f0(SB)/8, $bcboxmask3(SB)
-DATA opaddrs+0x7f8(SB)/8, $bcboxstring(SB)
-DATA opaddrs+0x800(SB)/8, $bcboxlist(SB)
-DATA opaddrs+0x808(SB)/8, $bcmakelist(SB)
-DATA opaddrs+0x810(SB)/8, $bcmakestruct(SB)
-DATA opaddrs+0x818(SB)/8, $bchashvalue(SB)
-DATA opaddrs+0x820(SB)/8, $bchashvalueplus(SB)
-DATA opaddrs+0x828(SB)/8, $bchashmember(SB)
-DATA opaddrs+0x830(SB)/8, $bchashlookup(SB)
-DATA opaddrs+0x838(SB)/8, $bcaggandk(SB)
-DATA opaddrs+0x840(SB)/8, $bcaggork(SB)
-DATA opaddrs+0x848(SB)/8, $bcaggsumf(SB)
-DATA opaddrs+0x850(SB)/8, $bcaggsumi(SB)
-DATA opaddrs+0x858(SB)/8, $bcaggminf(SB)
-DATA opaddrs+0x860(SB)/8, $bcaggmini(SB)
-DATA opaddrs+0x868(SB)/8, $bcaggmaxf(SB)
-DATA opaddrs+0x870(SB)/8, $bcaggmaxi(SB)
-DATA opaddrs+0x878(SB)/8, $bcaggandi(SB)
-DATA opaddrs+0x880(SB)/8, $bcaggori(SB)
-DATA opaddrs+0x888(SB)/8, $bcaggxori(SB)
-DATA opaddrs+0x890(SB)/8, $bcaggcount(SB)
-DATA opaddrs+0x898(SB)/8, $bcaggbucket(SB)
-DATA opaddrs+0x8a0(SB)/8, $bcaggslotandk(SB)
-DATA opaddrs+0x8a8(SB)/8, $bcaggslotork(SB)
-DATA opaddrs+0x8b0(SB)/8, $bcaggslotaddf(SB)
-DATA opaddrs+0x8b8(SB)/8, $bcaggslotaddi(SB)
-DATA opaddrs+0x8c0(SB)/8, $bcaggslotavgf(SB)
-DATA opaddrs+0x8c8(SB)/8, $bcaggslotavgi(SB)
-DATA opaddrs+0x8d0(SB)/8, $bcaggslotminf(SB)
-DATA opaddrs+0x8d8(SB)/8, $bcaggslotmini(SB)
-DATA opaddrs+0x8e0(SB)/8, $bcaggslotmaxf(SB)
-DATA opaddrs+0x8e8(SB)/8, $bcaggslotmaxi(SB)
-DATA opaddrs+0x8f0(SB)/8, $bcaggslotandi(SB)
-DATA opaddrs+0x8f8(SB)/8, $bcaggslotori(SB)
-DATA opaddrs+0x900(SB)/8, $bcaggslotxori(SB)
-DATA opaddrs+0x908(SB)/8, $bcaggslotcount(SB)
-DATA opaddrs+0x910(SB)/8, $bclitref(SB)
-DATA opaddrs+0x918(SB)/8, $bcauxval(SB)
-DATA opaddrs+0x920(SB)/8, $bcsplit(SB)
-DATA opaddrs+0x928(SB)/8, $bctuple(SB)
-DATA opaddrs+0x930(SB)/8, $bcdupv(SB)
-DATA opaddrs+0x938(SB)/8, $bczerov(SB)
-DATA opaddrs+0x940(SB)/8, $bcobjectsize(SB)
-DATA opaddrs+0x948(SB)/8, $bcCmpStrEqCs(SB)
-DATA opaddrs+0x950(SB)/8, $bcCmpStrEqCi(SB)
-DATA opaddrs+0x958(SB)/8, $bcCmpStrEqUTF8Ci(SB)
-DATA opaddrs+0x960(SB)/8, $bcCmpStrFuzzyA3(SB)
-DATA opaddrs+0x968(SB)/8, $bcCmpStrFuzzyUnicodeA3(SB)
-DATA opaddrs+0x970(SB)/8, $bcHasSubstrFuzzyA3(SB)
-DATA opaddrs+0x978(SB)/8, $bcHasSubstrFuzzyUnicodeA3(SB)
-DATA opaddrs+0x980(SB)/8, $bcSkip1charLeft(SB)
-DATA opaddrs+0x988(SB)/8, $bcSkip1charRight(SB)
-DATA opaddrs+0x990(SB)/8, $bcSkipNcharLeft(SB)
-DATA opaddrs+0x998(SB)/8, $bcSkipNcharRight(SB)
-DATA opaddrs+0x9a0(SB)/8, $bcTrimWsLeft(SB)
-DATA opaddrs+0x9a8(SB)/8, $bcTrimWsRight(SB)
-DATA opaddrs+0x9b0(SB)/8, $bcTrim4charLeft(SB)
-DATA opaddrs+0x9b8(SB)/8, $bcTrim4charRight(SB)
-DATA opaddrs+0x9c0(SB)/8, $bcContainsSuffixCs(SB)
-DATA opaddrs+0x9c8(SB)/8, $bcContainsSuffixCi(SB)
-DATA opaddrs+0x9d0(SB)/8, $bcContainsSuffixUTF8Ci(SB)
-DATA opaddrs+0x9d8(SB)/8, $bcContainsPrefixCs(SB)
-DATA opaddrs+0x9e0(SB)/8, $bcContainsPrefixCi(SB)
-DATA opaddrs+0x9e8(SB)/8, $bcContainsPrefixUTF8Ci(SB)
-DATA opaddrs+0x9f0(SB)/8, $bcLengthStr(SB)
-DATA opaddrs+0x9f8(SB)/8, $bcSubstr(SB)
-DATA opaddrs+0xa00(SB)/8, $bcSplitPart(SB)
-DATA opaddrs+0xa08(SB)/8, $bcContainsSubstrCs(SB)
-DATA opaddrs+0xa10(SB)/8, $bcContainsSubstrCi(SB)
-DATA opaddrs+0xa18(SB)/8, $bcContainsSubstrUTF8Ci(SB)
-DATA opaddrs+0xa20(SB)/8, $bcContainsPatternCs(SB)
-DATA opaddrs+0xa28(SB)/8, $bcContainsPatternCi(SB)
-DATA opaddrs+0xa30(SB)/8, $bcContainsPatternUTF8Ci(SB)
-DATA opaddrs+0xa38(SB)/8, $bcIsSubnetOfIP4(SB)
-DATA opaddrs+0xa40(SB)/8, $bcDfaT6(SB)
-DATA opaddrs+0xa48(SB)/8, $bcDfaT7(SB)
-DATA opaddrs+0xa50(SB)/8, $bcDfaT8(SB)
-DATA opaddrs+0xa58(SB)/8, $bcDfaT6Z(SB)
-DATA opaddrs+0xa60(SB)/8, $bcDfaT7Z(SB)
-DATA opaddrs+0xa68(SB)/8, $bcDfaT8Z(SB)
-DATA opaddrs+0xa70(SB)/8, $bcDfaLZ(SB)
-DATA opaddrs+0xa78(SB)/8, $bcslower(SB)
-DATA opaddrs+0xa80(SB)/8, $bcsupper(SB)
-DATA opaddrs+0xa88(SB)/8, $bcsadjustsize(SB)
-DATA opaddrs+0xa90(SB)/8, $bcaggapproxcount(SB)
-DATA opaddrs+0xa98(SB)/8, $bcaggapproxcountmerge(SB)
-DATA opaddrs+0xaa0(SB)/8, $bcaggslotapproxcount(SB)
-DATA opaddrs+0xaa8(SB)/8, $bcaggslotapproxcountmerge(SB)
-DATA opaddrs+0xab0(SB)/8, $bctrap(SB)
-DATA opaddrs+0xab8(SB)/8, $bctrap(SB)
+DATA opaddrs+0x668(SB)/8, $bcdatetzoffset(SB)
+DATA opaddrs+0x670(SB)/8, $bcparsets(SB)
+DATA opaddrs+0x678(SB)/8, $bcunboxts(SB)
+DATA opaddrs+0x680(SB)/8, $bcboxts(SB)
+DATA opaddrs+0x688(SB)/8, $bctimelt(SB)
+DATA opaddrs+0x690(SB)/8, $bctimegt(SB)
+DATA opaddrs+0x698(SB)/8, $bcconsttm(SB)
+DATA opaddrs+0x6a0(SB)/8, $bctmextract(SB)
+DATA opaddrs+0x6a8(SB)/8, $bcwidthbucketf(SB)
+DATA opaddrs+0x6b0(SB)/8, $bcwidthbucketi(SB)
+DATA opaddrs+0x6b8(SB)/8, $bctimebucketts(SB)
+DATA opaddrs+0x6c0(SB)/8, $bcgeohash(SB)
+DATA opaddrs+0x6c8(SB)/8, $bcgeohashimm(SB)
+DATA opaddrs+0x6d0(SB)/8, $bcgeotilex(SB)
+DATA opaddrs+0x6d8(SB)/8, $bcgeotiley(SB)
+DATA opaddrs+0x6e0(SB)/8, $bcgeotilees(SB)
+DATA opaddrs+0x6e8(SB)/8, $bcgeotileesimm(SB)
+DATA opaddrs+0x6f0(SB)/8, $bcgeodistance(SB)
+DATA opaddrs+0x6f8(SB)/8, $bcconcatlenget1(SB)
+DATA opaddrs+0x700(SB)/8, $bcconcatlenget2(SB)
+DATA opaddrs+0x708(SB)/8, $bcconcatlenget3(SB)
+DATA opaddrs+0x710(SB)/8, $bcconcatlenget4(SB)
+DATA opaddrs+0x718(SB)/8, $bcconcatlenacc1(SB)
+DATA opaddrs+0x720(SB)/8, $bcconcatlenacc2(SB)
+DATA opaddrs+0x728(SB)/8, $bcconcatlenacc3(SB)
+DATA opaddrs+0x730(SB)/8, $bcconcatlenacc4(SB)
+DATA opaddrs+0x738(SB)/8, $bcallocstr(SB)
+DATA opaddrs+0x740(SB)/8, $bcappendstr(SB)
+DATA opaddrs+0x748(SB)/8, $bcfindsym(SB)
+DATA opaddrs+0x750(SB)/8, $bcfindsym2(SB)
+DATA opaddrs+0x758(SB)/8, $bcfindsym2rev(SB)
+DATA opaddrs+0x760(SB)/8, $bcfindsym3(SB)
+DATA opaddrs+0x768(SB)/8, $bcblendv(SB)
+DATA opaddrs+0x770(SB)/8, $bcblendrevv(SB)
+DATA opaddrs+0x778(SB)/8, $bcblendnum(SB)
+DATA opaddrs+0x780(SB)/8, $bcblendnumrev(SB)
+DATA opaddrs+0x788(SB)/8, $bcblendslice(SB)
+DATA opaddrs+0x790(SB)/8, $bcblendslicerev(SB)
+DATA opaddrs+0x798(SB)/8, $bcunpack(SB)
+DATA opaddrs+0x7a0(SB)/8, $bcunsymbolize(SB)
+DATA opaddrs+0x7a8(SB)/8, $bcunboxktoi64(SB)
+DATA opaddrs+0x7b0(SB)/8, $bcunboxcoercef64(SB)
+DATA opaddrs+0x7b8(SB)/8, $bcunboxcoercei64(SB)
+DATA opaddrs+0x7c0(SB)/8, $bcunboxcvtf64(SB)
+DATA opaddrs+0x7c8(SB)/8, $bcunboxcvti64(SB)
+DATA opaddrs+0x7d0(SB)/8, $bctoint(SB)
+DATA opaddrs+0x7d8(SB)/8, $bctof64(SB)
+DATA opaddrs+0x7e0(SB)/8, $bcboxfloat(SB)
+DATA opaddrs+0x7e8(SB)/8, $bcboxint(SB)
+DATA opaddrs+0x7f0(SB)/8, $bcboxmask(SB)
+DATA opaddrs+0x7f8(SB)/8, $bcboxmask2(SB)
+DATA opaddrs+0x800(SB)/8, $bcboxmask3(SB)
+DATA opaddrs+0x808(SB)/8, $bcboxstring(SB)
+DATA opaddrs+0x810(SB)/8, $bcboxlist(SB)
+DATA opaddrs+0x818(SB)/8, $bcmakelist(SB)
+DATA opaddrs+0x820(SB)/8, $bcmakestruct(SB)
+DATA opaddrs+0x828(SB)/8, $bchashvalue(SB)
+DATA opaddrs+0x830(SB)/8, $bchashvalueplus(SB)
+DATA opaddrs+0x838(SB)/8, $bchashmember(SB)
+DATA opaddrs+0x840(SB)/8, $bchashlookup(SB)
+DATA opaddrs+0x848(SB)/8, $bcaggandk(SB)
+DATA opaddrs+0x850(SB)/8, $bcaggork(SB)
+DATA opaddrs+0x858(SB)/8, $bcaggsumf(SB)
+DATA opaddrs+0x860(SB)/8, $bcaggsumi(SB)
+DATA opaddrs+0x868(SB)/8, $bcaggminf(SB)
+DATA opaddrs+0x870(SB)/8, $bcaggmini(SB)
+DATA opaddrs+0x878(SB)/8, $bcaggmaxf(SB)
+DATA opaddrs+0x880(SB)/8, $bcaggmaxi(SB)
+DATA opaddrs+0x888(SB)/8, $bcaggandi(SB)
+DATA opaddrs+0x890(SB)/8, $bcaggori(SB)
+DATA opaddrs+0x898(SB)/8, $bcaggxori(SB)
+DATA opaddrs+0x8a0(SB)/8, $bcaggcount(SB)
+DATA opaddrs+0x8a8(SB)/8, $bcaggbucket(SB)
+DATA opaddrs+0x8b0(SB)/8, $bcaggslotandk(SB)
+DATA opaddrs+0x8b8(SB)/8, $bcaggslotork(SB)
+DATA opaddrs+0x8c0(SB)/8, $bcaggslotaddf(SB)
+DATA opaddrs+0x8c8(SB)/8, $bcaggslotaddi(SB)
+DATA opaddrs+0x8d0(SB)/8, $bcaggslotavgf(SB)
+DATA opaddrs+0x8d8(SB)/8, $bcaggslotavgi(SB)
+DATA opaddrs+0x8e0(SB)/8, $bcaggslotminf(SB)
+DATA opaddrs+0x8e8(SB)/8, $bcaggslotmini(SB)
+DATA opaddrs+0x8f0(SB)/8, $bcaggslotmaxf(SB)
+DATA opaddrs+0x8f8(SB)/8, $bcaggslotmaxi(SB)
+DATA opaddrs+0x900(SB)/8, $bcaggslotandi(SB)
+DATA opaddrs+0x908(SB)/8, $bcaggslotori(SB)
+DATA opaddrs+0x910(SB)/8, $bcaggslotxori(SB)
+DATA opaddrs+0x918(SB)/8, $bcaggslotcount(SB)
+DATA opaddrs+0x920(SB)/8, $bclitref(SB)
+DATA opaddrs+0x928(SB)/8, $bcauxval(SB)
+DATA opaddrs+0x930(SB)/8, $bcsplit(SB)
+DATA opaddrs+0x938(SB)/8, $bctuple(SB)
+DATA opaddrs+0x940(SB)/8, $bcdupv(SB)
+DATA opaddrs+0x948(SB)/8, $bczerov(SB)
+DATA opaddrs+0x950(SB)/8, $bcobjectsize(SB)
+DATA opaddrs+0x958(SB)/8, $bcCmpStrEqCs(SB)
+DATA opaddrs+0x960(SB)/8, $bcCmpStrEqCi(SB)
+DATA opaddrs+0x968(SB)/8, $bcCmpStrEqUTF8Ci(SB)
+DATA opaddrs+0x970(SB)/8, $bcCmpStrFuzzyA3(SB)
+DATA opaddrs+0x978(SB)/8, $bcCmpStrFuzzyUnicodeA3(SB)
+DATA opaddrs+0x980(SB)/8, $bcHasSubstrFuzzyA3(SB)
+DATA opaddrs+0x988(SB)/8, $bcHasSubstrFuzzyUnicodeA3(SB)
+DATA opaddrs+0x990(SB)/8, $bcSkip1charLeft(SB)
+DATA opaddrs+0x998(SB)/8, $bcSkip1charRight(SB)
+DATA opaddrs+0x9a0(SB)/8, $bcSkipNcharLeft(SB)
+DATA opaddrs+0x9a8(SB)/8, $bcSkipNcharRight(SB)
+DATA opaddrs+0x9b0(SB)/8, $bcTrimWsLeft(SB)
+DATA opaddrs+0x9b8(SB)/8, $bcTrimWsRight(SB)
+DATA opaddrs+0x9c0(SB)/8, $bcTrim4charLeft(SB)
+DATA opaddrs+0x9c8(SB)/8, $bcTrim4charRight(SB)
+DATA opaddrs+0x9d0(SB)/8, $bcContainsSuffixCs(SB)
+DATA opaddrs+0x9d8(SB)/8, $bcContainsSuffixCi(SB)
+DATA opaddrs+0x9e0(SB)/8, $bcContainsSuffixUTF8Ci(SB)
+DATA opaddrs+0x9e8(SB)/8, $bcContainsPrefixCs(SB)
+DATA opaddrs+0x9f0(SB)/8, $bcContainsPrefixCi(SB)
+DATA opaddrs+0x9f8(SB)/8, $bcContainsPrefixUTF8Ci(SB)
+DATA opaddrs+0xa00(SB)/8, $bcLengthStr(SB)
+DATA opaddrs+0xa08(SB)/8, $bcSubstr(SB)
+DATA opaddrs+0xa10(SB)/8, $bcSplitPart(SB)
+DATA opaddrs+0xa18(SB)/8, $bcContainsSubstrCs(SB)
+DATA opaddrs+0xa20(SB)/8, $bcContainsSubstrCi(SB)
+DATA opaddrs+0xa28(SB)/8, $bcContainsSubstrUTF8Ci(SB)
+DATA opaddrs+0xa30(SB)/8, $bcContainsPatternCs(SB)
+DATA opaddrs+0xa38(SB)/8, $bcContainsPatternCi(SB)
+DATA opaddrs+0xa40(SB)/8, $bcContainsPatternUTF8Ci(SB)
+DATA opaddrs+0xa48(SB)/8, $bcIsSubnetOfIP4(SB)
+DATA opaddrs+0xa50(SB)/8, $bcDfaT6(SB)
+DATA opaddrs+0xa58(SB)/8, $bcDfaT7(SB)
+DATA opaddrs+0xa60(SB)/8, $bcDfaT8(SB)
+DATA opaddrs+0xa68(SB)/8, $bcDfaT6Z(SB)
+DATA opaddrs+0xa70(SB)/8, $bcDfaT7Z(SB)
+DATA opaddrs+0xa78(SB)/8, $bcDfaT8Z(SB)
+DATA opaddrs+0xa80(SB)/8, $bcDfaLZ(SB)
+DATA opaddrs+0xa88(SB)/8, $bcslower(SB)
+DATA opaddrs+0xa90(SB)/8, $bcsupper(SB)
+DATA opaddrs+0xa98(SB)/8, $bcsadjustsize(SB)
+DATA opaddrs+0xaa0(SB)/8, $bcaggapproxcount(SB)
+DATA opaddrs+0xaa8(SB)/8, $bcaggapproxcountmerge(SB)
+DATA opaddrs+0xab0(SB)/8, $bcaggslotapproxcount(SB)
+DATA opaddrs+0xab8(SB)/8, $bcaggslotapproxcountmerge(SB)
 DATA opaddrs+0xac0(SB)/8, $bctrap(SB)
 DATA opaddrs+0xac8(SB)/8, $bctrap(SB)
 DATA opaddrs+0xad0(SB)/8, $bctrap(SB)
@@ -55,6 +55,12 @@ func newRadixTree(datasize int) *radixTree64 {
 	return rt
 }
 
+// memory returns the number of bytes
+// allocated for the tree
+func (t *radixTree64) memory() int64 {
+	return int64(len(t.index))*tabsize*4 + int64(cap(t.values))
+}
+
 // use 'h' to find the leaf index pointer
 // returns (pointer, radix)
 func (t *radixTree64) find(h uint64) (*int32, int) {
@@ -332,6 +338,12 @@ type aggtable struct {
 	pairs []hpair
 }
 
+// memory returns the number of bytes
+// allocated for the table
+func (a *aggtable) memory() int64 {
+	return a.tree.memory() + int64(cap(a.repr)) + int64(cap(a.pairs))*8
+}
+
 // for an aggtable, get the hash of the value
 func (a *aggtable) hashof(p *hpair) uint64 {
 	return binary.LittleEndian.Uint64(a.tree.values[p.hloc:])
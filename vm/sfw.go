@@ -36,6 +36,15 @@ type QuerySink interface {
 	io.Closer
 }
 
+// MemoryUser may be implemented by a QuerySink
+// that retains rows or intermediate state
+// until it is closed.
+type MemoryUser interface {
+	// Memory returns the approximate number
+	// of bytes retained by the sink.
+	Memory() int64
+}
+
 // auxbindings is passed along with
 // symtab to rowConsumer.symbolize to indicate
 // that some variable bindings should be assumed
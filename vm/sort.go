@@ -167,6 +167,20 @@ func (s *Order) Open() (io.WriteCloser, error) {
 	return splitter(&sortstateMulticolumn{parent: s}), nil
 }
 
+// Memory implements MemoryUser.Memory
+func (s *Order) Memory() int64 {
+	s.recordsLock.Lock()
+	defer s.recordsLock.Unlock()
+	n := int64(len(s.bytesAlloc.blocks)) * int64(s.bytesAlloc.blockSize)
+	n += int64(len(s.indicesAlloc.blocks)) * int64(s.indicesAlloc.blockSize) * 8
+	for _, records := range s.rawrecords {
+		for i := range records {
+			n += int64(len(records[i]))
+		}
+	}
+	return n
+}
+
 // Close implements QuerySink.Close
 func (s *Order) Close() error {
 	// wait for all sorting threads to
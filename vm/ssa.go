@@ -403,6 +403,8 @@ const (
 	sdatetruncmonth
 	sdatetruncquarter
 	sdatetruncyear
+	sdatetzoffset
+	sparsets
 
 	sgeohash
 	sgeohashimm
@@ -1073,6 +1075,8 @@ var _ssainfo = [_ssamax]ssaopinfo{
 	sdatetruncmonth:         {text: "datetruncmonth", rettype: stTimeInt, argtypes: []ssatype{stTimeInt, stBool}, bc: opdatetruncmonth},
 	sdatetruncquarter:       {text: "datetruncquarter", rettype: stTimeInt, argtypes: []ssatype{stTimeInt, stBool}, bc: opdatetruncquarter},
 	sdatetruncyear:          {text: "datetruncyear", rettype: stTimeInt, argtypes: []ssatype{stTimeInt, stBool}, bc: opdatetruncyear},
+	sdatetzoffset:           {text: "datetzoffset", rettype: stInt, argtypes: []ssatype{stTimeInt, stBool}, immfmt: fmtdict, bc: opdatetzoffset},
+	sparsets:                {text: "parsets", rettype: stTimeIntMasked, argtypes: str1Args, immfmt: fmtdict, bc: opparsets},
 	stimebucketts:           {text: "timebucket.ts", rettype: stInt, argtypes: []ssatype{stInt, stInt, stBool}, bc: optimebucketts, emit: emitauto2},
 	sboxts:                  {text: "boxts", argtypes: []ssatype{stTimeInt, stBool}, rettype: stValue, bc: opboxts},
 
@@ -3728,6 +3732,145 @@ func (p *prog) TimeBucket(timestamp, interval *value) *value {
 	return p.ssa3(stimebucketts, tv, iv, p.And(p.mask(tv), im))
 }
 
+// TimeBucketZone is like TimeBucket, but the buckets
+// are aligned to the wall-clock time in z rather than UTC
+func (p *prog) TimeBucketZone(timestamp, interval *value, z *date.Zone) *value {
+	bucket := p.TimeBucket(p.AtTimeZone(timestamp, z), interval)
+	// bucket is the number of seconds since the epoch
+	// in wall-clock time; convert it back into a timestamp
+	// and then into UTC
+	zero := p.ssa0imm(sbroadcastts, int64(0))
+	local := p.ssa3imm(sdateaddmulimm, zero, bucket, p.mask(bucket), timePartMultiplier[expr.Second])
+	return p.DateToUnixEpoch(p.FromTimeZone(local, z))
+}
+
+// tzTable encodes a table of zone transitions
+// in the format expected by the datetzoffset
+// instruction: the number of entries n (rounded
+// up to a power of two), followed by n times and
+// n offsets, all as little-endian 64-bit integers
+func tzTable(times, offsets []int64) string {
+	n := 1
+	for n < len(times) {
+		n *= 2
+	}
+	buf := make([]byte, 8+16*n)
+	binary.LittleEndian.PutUint64(buf, uint64(n))
+	for i := 0; i < n; i++ {
+		t, off := int64(math.MaxInt64), offsets[len(offsets)-1]
+		if i < len(times) {
+			t, off = times[i], offsets[i]
+		}
+		binary.LittleEndian.PutUint64(buf[8+i*8:], uint64(t))
+		binary.LittleEndian.PutUint64(buf[8+(n+i)*8:], uint64(off))
+	}
+	return string(buf)
+}
+
+// AtTimeZone converts timestamps into the
+// wall-clock time in z (represented as UTC times)
+func (p *prog) AtTimeZone(val *value, z *date.Zone) *value {
+	v, m := p.coerceTimestamp(val)
+	off := p.ssa2imm(sdatetzoffset, v, m, tzTable(z.Transitions()))
+	return p.ssa3(sdateadd, v, off, m)
+}
+
+// FromTimeZone is the inverse of AtTimeZone:
+// it converts wall-clock times in z into UTC
+// (see date.Zone.UTC)
+func (p *prog) FromTimeZone(val *value, z *date.Zone) *value {
+	v, m := p.coerceTimestamp(val)
+	off := p.ssa2imm(sdatetzoffset, v, m, tzTable(z.LocalTransitions()))
+	return p.ssa3imm(sdateaddmulimm, v, off, m, int64(-1))
+}
+
+// operations performed by the parsets
+// instruction; see tsfmtProgram
+const (
+	tsfmtEnd = iota
+	tsfmtDigits
+	tsfmtFraction
+	tsfmtLiteral
+	tsfmtSpace
+	tsfmtMonthName
+	tsfmtWeekdayName
+	tsfmtMeridiem
+	tsfmtOffset
+	tsfmtZoneName
+	tsfmtHour12
+	tsfmtYear2
+)
+
+// timestamp components written by tsfmtDigits
+const (
+	tsfieldYear   = date.FieldYear
+	tsfieldMonth  = date.FieldMonth
+	tsfieldDay    = date.FieldDay
+	tsfieldHour   = date.FieldHour
+	tsfieldMinute = date.FieldMinute
+	tsfieldSecond = date.FieldSecond
+)
+
+// tsfmtProgram encodes the steps of f in the
+// format expected by the parsets instruction:
+// one 4-byte [op, field, min, max] tuple per step
+// (where max is the character for tsfmtLiteral),
+// followed by tsfmtEnd
+func tsfmtProgram(f *date.Format) (string, error) {
+	steps := f.Steps()
+	buf := make([]byte, 0, 4*(len(steps)+1))
+	for i := range steps {
+		s := &steps[i]
+		var op byte
+		switch s.Op {
+		case date.FormatDigits:
+			op = tsfmtDigits
+		case date.FormatFraction:
+			op = tsfmtFraction
+		case date.FormatLiteral:
+			buf = append(buf, tsfmtLiteral, 0, 0, s.Char)
+			continue
+		case date.FormatSpace:
+			op = tsfmtSpace
+		case date.FormatMonthName:
+			op = tsfmtMonthName
+		case date.FormatWeekdayName:
+			op = tsfmtWeekdayName
+		case date.FormatMeridiem:
+			op = tsfmtMeridiem
+		case date.FormatOffset:
+			op = tsfmtOffset
+		case date.FormatZoneName:
+			op = tsfmtZoneName
+		case date.FormatHour12:
+			op = tsfmtHour12
+		case date.FormatYear2:
+			op = tsfmtYear2
+		default:
+			return "", fmt.Errorf("unsupported timestamp format operation %d", s.Op)
+		}
+		buf = append(buf, op, byte(s.Field), byte(s.Min), byte(s.Max))
+	}
+	buf = append(buf, tsfmtEnd, 0, 0, 0)
+	return string(buf), nil
+}
+
+// ParseTimestamp parses strings into timestamps
+// according to f; strings that do not match f
+// produce MISSING
+func (p *prog) ParseTimestamp(str *value, f *date.Format) *value {
+	program, err := tsfmtProgram(f)
+	if err != nil {
+		return p.errorf("%s", err)
+	}
+	str = p.toStr(str)
+	ts := p.ssa2imm(sparsets, str, p.mask(str), program)
+	if !f.HasOffset() && f.Zone() != nil {
+		return p.FromTimeZone(ts, f.Zone())
+	}
+	return ts
+}
+
 func (p *prog) GeoHash(latitude, longitude, numChars *value) *value {
 	latV, latM := p.coercefp(latitude)
 	lonV, lonM := p.coercefp(longitude)
@@ -311,6 +311,14 @@ func dateToION(text string, d *ion.Chunker, noIndex bool, symbuf ion.Symbuf) err
 	return timeToION(t, d, noIndex, symbuf)
 }
 
+func formatToION(f *date.Format, text string, d *ion.Chunker, noIndex bool, symbuf ion.Symbuf) error {
+	t, ok := f.Parse([]byte(text))
+	if !ok {
+		return fmt.Errorf("date/time %q does not match format %q", text, f)
+	}
+	return timeToION(t, d, noIndex, symbuf)
+}
+
 func epochSecToION(text string, d *ion.Chunker, noIndex bool, symbuf ion.Symbuf) error {
 	e, err := strconv.ParseInt(text, 10, 64)
 	if err != nil {
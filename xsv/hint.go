@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/SnellerInc/sneller/date"
 	"github.com/SnellerInc/sneller/ion"
 	"golang.org/x/exp/slices"
 )
@@ -44,6 +45,7 @@ const (
 var (
 	ErrIngestEmptyOnlyValidForStrings = errors.New("only strings can be empty")
 	ErrFormatOnlyValidForDateTime     = errors.New("format only valid for datetime type")
+	ErrZoneOnlyValidForCustomFormat   = errors.New("zone only valid for datetime type with a custom format")
 	ErrBoolValuesOnlyValidForBool     = errors.New("custom true/false values only valid for bool type")
 	ErrRequireBothTrueAndFalseValues  = errors.New("require both true and false values")
 	ErrTrueAndFalseValuesOverlap      = errors.New("true and values values overlap")
@@ -99,6 +101,9 @@ type FieldHint struct {
 	Default string `json:"default,omitempty"`
 	// Ingestion format (i.e. different data formats)
 	Format string `json:"format,omitempty"`
+	// Time zone for datetime values with a custom
+	// format that doesn't include the UTC offset
+	Zone string `json:"zone,omitempty"`
 	// Allow empty values (only valid for strings) to
 	// be ingested. If flag is set to false, then the
 	// field won't be written for the record instead.
@@ -157,6 +162,9 @@ func (fh *FieldHint) UnmarshalJSON(data []byte) error {
 	if t != TypeDateTime && fh.Format != "" {
 		return ErrFormatOnlyValidForDateTime
 	}
+	if t != TypeDateTime && fh.Zone != "" {
+		return ErrZoneOnlyValidForCustomFormat
+	}
 	if fh.Type != TypeString && fh.AllowEmpty {
 		return ErrIngestEmptyOnlyValidForStrings
 	}
@@ -205,7 +213,27 @@ func (fh *FieldHint) UnmarshalJSON(data []byte) error {
 		case FormatDateTimeUnixNanoSec:
 			fh.convertAndWrite = epochNSecToION
 		default:
-			return fmt.Errorf("invalid date format %q", f)
+			if !strings.Contains(f, "%") {
+				return fmt.Errorf("invalid date format %q", f)
+			}
+			var zone *date.Zone
+			if fh.Zone != "" {
+				var err error
+				zone, err = date.LoadZone(fh.Zone)
+				if err != nil {
+					return err
+				}
+			}
+			df, err := date.CompileFormat(f, zone)
+			if err != nil {
+				return err
+			}
+			fh.convertAndWrite = func(text string, d *ion.Chunker, noIndex bool, symbuf ion.Symbuf) error {
+				return formatToION(df, text, d, noIndex, symbuf)
+			}
+		}
+		if fh.Zone != "" && !strings.Contains(f, "%") {
+			return ErrZoneOnlyValidForCustomFormat
 		}
 	default:
 		return fmt.Errorf("xsv: no converter for type %q", t)
@@ -228,6 +256,7 @@ func (fh *FieldHint) isRootField() bool {
 //	    {"name":"field", "type": "<type>"},
 //	    {"name":"field.a", "type": "<type>", "default:" "empty"},
 //	    {"name":"field.b", "type": "datetime", "format": "epoch", "noIndex": true},
+//	    {"name":"field.c", "type": "datetime", "format": "%Y-%m-%d %H:%M:%S", "zone": "Europe/Berlin"},
 //	    {"name":"anotherField", "type": "bool", "trueValues": ["Y"], "falseValues": ["N"]},
 //	    ...
 //	  ]
@@ -259,7 +288,9 @@ func (fh *FieldHint) isRootField() bool {
 //   - number -> either float or int
 //   - int
 //   - bool -> can support custom trueValues/falseValues
-//   - datetime -> formats: text (default), epoch, epoch_ms, epoch_us, epoch_ns
+//   - datetime -> formats: text (default), epoch, epoch_ms, epoch_us, epoch_ns,
+//     or a strptime-style layout like "%d/%b/%Y:%H:%M:%S %z" (see date.CompileFormat);
+//     set 'zone' to interpret timestamps without a UTC offset in that time zone
 func ParseHint(hint []byte) (*Hint, error) {
 	var h Hint
 	err := json.Unmarshal(hint, &h)